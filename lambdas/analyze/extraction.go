@@ -3,16 +3,30 @@ package main
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"math"
+	"math/rand/v2"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/projectcloudline/logbook-service/internal/anthropic"
+	"github.com/projectcloudline/logbook-service/internal/db"
 	"github.com/projectcloudline/logbook-service/internal/gemini"
+	"github.com/projectcloudline/logbook-service/internal/identity"
+	"github.com/projectcloudline/logbook-service/internal/imageutil"
+	"github.com/projectcloudline/logbook-service/internal/models"
+	"github.com/projectcloudline/logbook-service/internal/qa"
+	"github.com/projectcloudline/logbook-service/internal/rawextraction"
 	"github.com/projectcloudline/logbook-service/internal/slicer"
 )
 
@@ -23,12 +37,100 @@ var mimeTypeMap = map[string]string{
 	".heic": "image/heic", ".heif": "image/heif",
 }
 
+// extractionModel is the Gemini model that extracts entries and their
+// weight-and-balance figures. Pages and entries record it.
+const extractionModel = "gemini-2.5-flash"
+
+// sliceExtensions maps slicer output MIME types to S3 key extensions.
+var sliceExtensions = map[string]string{
+	"image/jpeg": ".jpg", "image/png": ".png", "image/webp": ".webp",
+}
+
+// sliceKey returns the S3 key of a slice for audit. The key ends in a hash of
+// the slice bytes, so a reprocess that crops differently writes new objects
+// instead of replacing the ones earlier entries point at. The index prefix
+// keeps a page's slices listed in order.
+func sliceKey(batchID string, pageNumber, index int, data []byte, ext string) string {
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf("slices/%s/page_%04d/slice_%03d_%x%s", batchID, pageNumber, index, sum[:8], ext)
+}
+
+// uploadSlice stores a slice for audit. Keys are content-addressed, so an
+// object already at the key holds the same bytes; a PUT is skipped when one
+// of the same size is there.
+func (h *Handler) uploadSlice(ctx context.Context, key, mimeType string, data []byte) error {
+	exists, size, err := h.s3.HeadObject(ctx, h.bucket, key)
+	if err != nil {
+		log.Printf("WARNING: head slice %s: %v", key, err)
+	} else if exists && size == int64(len(data)) {
+		return nil
+	}
+	return h.s3.PutObject(ctx, h.bucket, key, mimeType, bytes.NewReader(data))
+}
+
+// preprocessContrast enables grayscale conversion and contrast stretching of
+// slices before extraction, which helps with faint pencil on aged paper.
+const preprocessContrast = "contrast"
+
+// stickerSkip drops entries read from sticker slices instead of storing them.
+const stickerSkip = "skip"
+
+// stickerSource marks entries read from a sticker or label rather than the
+// logbook itself.
+const stickerSource = "sticker"
+
+// preprocessQuality is the JPEG quality of preprocessed slices.
+const preprocessQuality = 90
+
+// preprocessSlice returns the contrast-stretched slice as JPEG. If the slice
+// can't be processed, the original bytes are returned unchanged.
+func preprocessSlice(data []byte, mimeType string) ([]byte, string) {
+	out, err := imageutil.ContrastJPEG(data, preprocessQuality)
+	if err != nil {
+		log.Printf("WARNING: slice preprocessing failed, using original: %v", err)
+		return data, mimeType
+	}
+	return out, "image/jpeg"
+}
+
+// blankPageContentRatio is the slicer.ContentRatio under which a page that
+// sliced into one image is skipped when skipBlankPages is set. Blank pages
+// measure at or near zero, while one line of handwriting on a phone photo
+// comes to roughly 0.001.
+const blankPageContentRatio = 0.0005
+
 func (h *Handler) processPage(ctx context.Context, msg pageMessage) error {
-	// Mark page as processing
-	if err := h.db.Exec(ctx,
-		"UPDATE upload_pages SET extraction_status = 'processing' WHERE id = $1",
-		msg.PageID); err != nil {
-		return fmt.Errorf("mark processing: %w", err)
+	// A dry run extracts and checks as usual but writes nothing to the
+	// database, so prompt changes can be tried on real pages.
+	dryRun := h.isDryRun(msg)
+	// A candidate run likewise leaves the page and its entries alone, saving
+	// only its extraction for comparison with the live one.
+	candidate := h.isCandidate(msg)
+	switch {
+	case dryRun:
+		log.Printf("Page %s: dry run, nothing will be saved", msg.PageID)
+	case candidate:
+		log.Printf("Page %s: candidate extraction for prompt version %s", msg.PageID, msg.PromptVersion)
+	default:
+		// A page can be delivered again after it finished: a duplicate SQS
+		// message, or a requeue of a batch that looked stalled. Extracting it
+		// again would store its entries twice.
+		rows, err := h.db.Query(db.WithPrimary(ctx),
+			"SELECT extraction_status FROM upload_pages WHERE id = $1", msg.PageID)
+		if err != nil {
+			return fmt.Errorf("check page status: %w", err)
+		}
+		if len(rows) > 0 {
+			if status, _ := rows[0]["extraction_status"].(string); status == "completed" || status == "skipped" {
+				log.Printf("Page %s: already %s, skipping", msg.PageID, status)
+				return nil
+			}
+		}
+		if err := h.db.Exec(ctx,
+			"UPDATE upload_pages SET extraction_status = 'processing' WHERE id = $1",
+			msg.PageID); err != nil {
+			return fmt.Errorf("mark processing: %w", err)
+		}
 	}
 
 	// Download image from S3
@@ -53,19 +155,76 @@ func (h *Handler) processPage(ctx context.Context, msg pageMessage) error {
 	}
 
 	// Slice image into individual entry strips
-	slices, sliceErr := slicer.SliceImage(imageBytes, slicer.DefaultOptions())
+	sliceOpts := slicer.DefaultOptions()
+	if h.sliceFormat != "" {
+		sliceOpts.OutputFormat = h.sliceFormat
+	}
+	sliceOpts.CWebPPath = h.cwebpBinPath()
+	if h.maxImagePixels > 0 {
+		sliceOpts.MaxPixels = h.maxImagePixels
+	}
+	sliceOpts.AutoRotate = h.autoRotate
+	sliceOpts.ModelJPEGQuality = h.modelJPEGQuality
+	sliceOpts.ModelGrayscale = h.modelGrayscale
+	slices, sliceErr := slicer.SliceImage(imageBytes, sliceOpts)
+	if errors.Is(sliceErr, imageutil.ErrImageTooLarge) {
+		// Too large to decode safely, and too large to send whole.
+		return fmt.Errorf("slice image: %w", sliceErr)
+	}
 	if sliceErr != nil {
 		// Fallback: use the full image as a single slice
 		log.Printf("WARNING: slicer failed for page %s, using full image: %v", msg.PageID, sliceErr)
-		slices = []slicer.Slice{{Index: 0, ImageData: imageBytes, Y0: 0, Y1: 0}}
+		slices = []slicer.Slice{{Index: 0, ImageData: imageBytes, MIMEType: mimeType, Y0: 0, Y1: 0, Original: true}}
 	}
 	log.Printf("Page %s: sliced into %d strips", msg.PageID, len(slices))
 
+	// Blank pages and bare covers would each cost an extraction call for
+	// nothing. Only a page the slicer left whole is considered, and only
+	// when it carries less ink than a line of writing.
+	if h.skipBlankPages && sliceErr == nil && len(slices) == 1 {
+		ratio, err := slicer.ContentRatio(imageBytes, sliceOpts)
+		if err == nil && ratio < blankPageContentRatio {
+			log.Printf("Page %s: content ratio %.5f, skipping as blank", msg.PageID, ratio)
+			return h.skipBlankPage(ctx, msg, "", dryRun || candidate)
+		}
+	}
+
+	// A page that didn't split may be one long entry or no entry at all;
+	// OCR tells them apart more cheaply than a full-page extraction. If OCR
+	// can't run, the page is extracted whole as before.
+	if h.ocrPrepass && len(slices) == 1 {
+		words, err := h.runOCR(ctx, imageBytes)
+		switch {
+		case err != nil:
+			log.Printf("WARNING: OCR pre-pass failed for page %s, extracting the full page: %v", msg.PageID, err)
+		case !hasText(words):
+			// OCR misses faint or unusual handwriting too, so the page is
+			// left for someone to look at rather than skipped unseen.
+			log.Printf("Page %s: OCR found no text (%d words), skipping as blank for review", msg.PageID, len(words))
+			reason := fmt.Sprintf("OCR found no legible text (%d words read); skipped as blank without extraction", len(words))
+			return h.skipBlankPage(ctx, msg, reason, dryRun || candidate)
+		default:
+			log.Printf("Page %s: OCR found %d words, extracting the full page", msg.PageID, len(words))
+		}
+	}
+
 	// Call Gemini for each slice and collect entries
 	geminiClient, err := h.getGeminiClient(ctx)
 	if err != nil {
 		return fmt.Errorf("get gemini client: %w", err)
 	}
+	usage := &tokenUsage{UploadID: msg.UploadID, PageID: msg.PageID}
+	geminiClient = &usageClient{Client: geminiClient, usage: usage}
+	defer usage.log()
+
+	// A lone slice is the whole page (or nearly), usually with several
+	// entries on it; the slice prompt expects a single cropped entry and
+	// misses some, so use the full-page prompt instead.
+	prompt := SliceExtractionPrompt
+	if len(slices) == 1 {
+		prompt = MaintenanceExtractionPrompt
+	}
+	version := promptVersion(prompt)
 
 	batchID := extractBatchID(msg.S3Key)
 	var allEntries []extractedEntry
@@ -73,26 +232,70 @@ func (h *Handler) processPage(ctx context.Context, msg pageMessage) error {
 
 	for _, sl := range slices {
 		// Upload slice to S3 for debugging/audit (non-fatal)
-		sliceKey := fmt.Sprintf("slices/%s/page_%04d/slice_%03d.jpg", batchID, msg.PageNumber, sl.Index)
-		if putErr := h.s3.PutObject(ctx, h.bucket, sliceKey, "image/jpeg", bytes.NewReader(sl.ImageData)); putErr != nil {
-			log.Printf("WARNING: failed to upload slice %s: %v", sliceKey, putErr)
+		// An original slice is the page file itself, so it keeps the page's
+		// extension; anything else was encoded by the slicer.
+		sliceExt := sliceExtensions[sl.MIMEType]
+		if sl.Original {
+			sliceExt = ext
+		}
+		key := sliceKey(batchID, msg.PageNumber, sl.Index, sl.ImageData, sliceExt)
+		var origin *sliceOrigin
+		if h.skipSliceUploads {
+			// Entries still record where on the page they came from.
+			origin = &sliceOrigin{Y0: sl.Y0, Y1: sl.Y1}
+		} else if putErr := h.uploadSlice(ctx, key, sl.MIMEType, sl.ImageData); putErr != nil {
+			log.Printf("WARNING: failed to upload slice %s: %v", key, putErr)
+		} else {
+			origin = &sliceOrigin{Key: key, Y0: sl.Y0, Y1: sl.Y1}
 		}
 
-		// Determine which image data and MIME type to send.
-		// For fallback (slicer failed), slices contain the original bytes which may be PNG/etc.
-		sliceMIME := "image/jpeg"
+		// An original slice holds the page's own bytes and MIME type. The
+		// models get their own copy when the slicer made one.
+		sliceMIME := sl.MIMEType
 		sliceData := sl.ImageData
-		if sliceErr != nil {
-			sliceMIME = mimeType
-			sliceData = imageBytes
+		if sl.ModelImageData != nil {
+			sliceMIME, sliceData = "image/jpeg", sl.ModelImageData
+		}
+		if h.preprocess == preprocessContrast {
+			// The audit copy above stays untouched; only the models see this.
+			sliceData, sliceMIME = preprocessSlice(sliceData, sliceMIME)
 		}
 
-		entries, pageType, extractErr := h.extractAndVerifySlice(ctx, sliceData, sliceMIME, geminiClient, sl.Index, msg.PageID)
+		entries, pageType, extractErr := h.extractAndVerifySlice(ctx, sliceData, sliceMIME, geminiClient, prompt, sl.Index, msg.PageID)
 		if extractErr != nil {
 			log.Printf("WARNING: extract+verify failed for slice %d of page %s: %v", sl.Index, msg.PageID, extractErr)
 			continue
 		}
 
+		// Stickers and placards aren't logbook entries; what they say is
+		// kept apart from the real ones, or dropped.
+		if pageType == stickerSource {
+			if h.stickerSlices == stickerSkip {
+				log.Printf("  Skipping sticker slice %d of page %s (%d entries)", sl.Index, msg.PageID, len(entries))
+				entries = nil
+			} else {
+				for i := range entries {
+					entries[i].EntryType = "other"
+					entries[i].InspectionType = ""
+					entries[i].Source = stickerSource
+				}
+			}
+		}
+
+		for i := range entries {
+			entries[i].Slice = origin
+			entries[i].PromptVersion = version
+			if !isWeightBalanceEntry(&entries[i], pageType) {
+				continue
+			}
+			wb, wbErr := h.extractWeightBalance(ctx, geminiClient, sliceData, sliceMIME)
+			if wbErr != nil {
+				log.Printf("WARNING: W&B extraction failed for slice %d of page %s: %v", sl.Index, msg.PageID, wbErr)
+				continue
+			}
+			entries[i].WeightBalance = wb
+		}
+
 		allEntries = append(allEntries, entries...)
 		if pageType != "" {
 			lastPageType = pageType
@@ -109,13 +312,19 @@ func (h *Handler) processPage(ctx context.Context, msg pageMessage) error {
 	}
 
 	// Store raw extraction
-	rawJSON, _ := json.Marshal(extraction)
-	if err := h.db.Exec(ctx,
-		`UPDATE upload_pages SET raw_extraction = $1, page_type = $2,
-		 extraction_model = 'gemini-2.5-flash', extraction_timestamp = NOW()
-		 WHERE id = $3`,
-		string(rawJSON), extraction.PageType, msg.PageID); err != nil {
-		return fmt.Errorf("store extraction: %w", err)
+	if !dryRun && !candidate {
+		rawJSON, _ := json.Marshal(extraction)
+		rawJSON, err = rawextraction.Encode(rawJSON, h.compressRawExtraction)
+		if err != nil {
+			return fmt.Errorf("encode extraction: %w", err)
+		}
+		if err := h.db.Exec(ctx,
+			`UPDATE upload_pages SET raw_extraction = $1, page_type = $2,
+			 extraction_model = $4, extraction_timestamp = NOW()
+			 WHERE id = $3`,
+			string(rawJSON), extraction.PageType, msg.PageID, extractionModel); err != nil {
+			return fmt.Errorf("store extraction: %w", err)
+		}
 	}
 
 	// Get aircraft identity for validation
@@ -139,25 +348,39 @@ func (h *Handler) processPage(ctx context.Context, msg pageMessage) error {
 		model:        strVal(rows[0]["model"]),
 	}
 
-	// Process each entry
 	for i := range extraction.Entries {
 		checkAircraftIdentity(&extraction.Entries[i], expected)
+	}
+	flagEchoedNarratives(extraction.Entries)
+
+	if candidate {
+		return h.storeCandidate(ctx, msg, version, extraction)
+	}
+	if dryRun {
+		out, _ := json.Marshal(extraction)
+		log.Printf("Page %s: dry run, would save %d entries from %d slices: %s",
+			msg.PageID, len(extraction.Entries), len(slices), out)
+		return nil
+	}
+
+	// Process each entry
+	for i := range extraction.Entries {
 		if err := h.saveEntry(ctx, aircraftID, msg.PageID, &extraction.Entries[i]); err != nil {
 			log.Printf("WARNING: save entry failed: %v", err)
 		}
 	}
 
 	// Mark page complete
-	needsReview := false
-	for _, e := range extraction.Entries {
-		if e.NeedsReview {
-			needsReview = true
-			break
-		}
+	review := rollupPageReview(extraction.Entries)
+	var reasons any
+	if review.reasonSummary != "" {
+		reasons = review.reasonSummary
 	}
 	if err := h.db.Exec(ctx,
-		"UPDATE upload_pages SET extraction_status = 'completed', needs_review = $1 WHERE id = $2",
-		needsReview, msg.PageID); err != nil {
+		`UPDATE upload_pages SET extraction_status = 'completed', needs_review = $1,
+		 min_confidence = $2, review_reason_summary = $3
+		 WHERE id = $4`,
+		review.needsReview, review.minConfidence, reasons, msg.PageID); err != nil {
 		return fmt.Errorf("mark complete: %w", err)
 	}
 
@@ -168,6 +391,97 @@ func (h *Handler) processPage(ctx context.Context, msg pageMessage) error {
 	return nil
 }
 
+// storeCandidate saves extraction as the page's candidate for
+// msg.PromptVersion, replacing an earlier candidate for the same version.
+// The label is whatever the caller asked for, while version is the prompt
+// the page was actually read with (pages that don't split use the
+// full-page prompt), so it is stored alongside the entries.
+func (h *Handler) storeCandidate(ctx context.Context, msg pageMessage, version string, extraction extractionResult) error {
+	rawJSON, _ := json.Marshal(struct {
+		extractionResult
+		PromptVersion string `json:"promptVersion"`
+	}{extraction, version})
+	rawJSON, err := rawextraction.Encode(rawJSON, h.compressRawExtraction)
+	if err != nil {
+		return fmt.Errorf("encode candidate extraction: %w", err)
+	}
+	if err := h.db.Exec(ctx,
+		`UPDATE upload_pages SET raw_extraction_candidate =
+		 jsonb_set(COALESCE(raw_extraction_candidate, '{}'), ARRAY[$1], $2::jsonb)
+		 WHERE id = $3`,
+		msg.PromptVersion, string(rawJSON), msg.PageID); err != nil {
+		return fmt.Errorf("store candidate extraction: %w", err)
+	}
+	log.Printf("Page %s: stored candidate extraction of %d entries for prompt version %s (read with %s)",
+		msg.PageID, len(extraction.Entries), msg.PromptVersion, version)
+	return nil
+}
+
+// skipBlankPage marks the page skipped as blank, unless readOnly (a dry run
+// or candidate extraction) leaves it alone. A non-empty reviewReason also
+// flags the page for review with that reason, for pages only judged blank.
+func (h *Handler) skipBlankPage(ctx context.Context, msg pageMessage, reviewReason string, readOnly bool) error {
+	if readOnly {
+		return nil
+	}
+	var reason any
+	if reviewReason != "" {
+		reason = reviewReason
+	}
+	if err := h.db.Exec(ctx,
+		`UPDATE upload_pages SET extraction_status = 'skipped', page_type = 'blank',
+		 needs_review = $2, review_reason_summary = $3, extraction_timestamp = NOW()
+		 WHERE id = $1`,
+		msg.PageID, reviewReason != "", reason); err != nil {
+		return fmt.Errorf("mark skipped: %w", err)
+	}
+	h.checkBatchCompletion(ctx, msg.UploadID)
+	return nil
+}
+
+// pageReview is the page-level rollup of its entries' review state.
+type pageReview struct {
+	needsReview   bool
+	minConfidence *float64 // nil when no entry reported a confidence
+	reasonSummary string
+}
+
+// rollupPageReview aggregates entry review state for upload_pages: the page
+// needs review if any entry does, its confidence is that of its least
+// confident entry, and its reason summary joins the distinct notes of the
+// entries flagged for review, in order of first appearance.
+func rollupPageReview(entries []extractedEntry) pageReview {
+	var r pageReview
+	var notes []string
+	for _, e := range entries {
+		if c, ok := toFloat64(e.Confidence); ok && (r.minConfidence == nil || c < *r.minConfidence) {
+			r.minConfidence = &c
+		}
+		if !e.NeedsReview {
+			continue
+		}
+		r.needsReview = true
+		notes = append(notes, e.ExtractionNotes)
+	}
+	r.reasonSummary = models.ReviewReasonSummary(notes)
+	return r
+}
+
+// cwebpBinPath returns the cwebp binary WebP slices are encoded with: the
+// configured override, the binary bundled with the Lambda, or cwebp from
+// PATH.
+func (h *Handler) cwebpBinPath() string {
+	if h.cwebpPath != "" {
+		return h.cwebpPath
+	}
+	execDir, _ := os.Executable()
+	bundled := filepath.Join(filepath.Dir(execDir), "bin", "cwebp-arm64")
+	if _, err := os.Stat(bundled); err == nil {
+		return bundled
+	}
+	return "cwebp"
+}
+
 // extractBatchID parses the batch ID from an S3 key like "pages/{batchId}/page_0001.jpg".
 func extractBatchID(s3Key string) string {
 	parts := strings.Split(s3Key, "/")
@@ -182,12 +496,32 @@ func (h *Handler) markPageFailed(ctx context.Context, pageID string) {
 		"UPDATE upload_pages SET extraction_status = 'failed' WHERE id = $1", pageID)
 }
 
+// checkBatchCompletion moves the batch to its terminal status once every page
+// has finished. The page counts and the transition are one statement, so
+// analyze Lambdas finishing pages concurrently can't both complete the batch,
+// and a page finishing late can't overwrite a terminal status. Only the call
+// that made the transition gets a row back, so completion is announced once.
+// A batch split couldn't finish has lost pages, so it can't complete cleanly.
 func (h *Handler) checkBatchCompletion(ctx context.Context, batchID string) {
 	rows, err := h.db.Query(ctx,
-		`SELECT COUNT(*) AS total,
-		        COUNT(*) FILTER (WHERE extraction_status IN ('completed', 'skipped')) AS done,
-		        COUNT(*) FILTER (WHERE extraction_status = 'failed') AS failed
-		 FROM upload_pages WHERE document_id = $1`, batchID)
+		`WITH counts AS (
+			SELECT COUNT(*) AS total,
+			       COUNT(*) FILTER (WHERE extraction_status IN ('completed', 'skipped')) AS done,
+			       COUNT(*) FILTER (WHERE extraction_status = 'failed') AS failed
+			FROM upload_pages WHERE document_id = $1
+		)
+		UPDATE upload_batches ub
+		SET processing_status = CASE
+		        WHEN c.failed = 0 AND NOT ub.split_incomplete THEN 'completed'
+		        WHEN c.done = 0 THEN 'failed'
+		        ELSE 'completed_with_errors'
+		    END,
+		    updated_at = NOW()
+		FROM counts c
+		WHERE ub.id = $1
+		  AND ub.processing_status NOT IN ('completed', 'completed_with_errors', 'failed', 'expired')
+		  AND c.total > 0 AND c.done + c.failed = c.total
+		RETURNING ub.processing_status, ub.callback_url, c.total, c.done, c.failed`, batchID)
 	if err != nil {
 		log.Printf("WARNING: check batch completion failed: %v", err)
 		return
@@ -196,29 +530,69 @@ func (h *Handler) checkBatchCompletion(ctx context.Context, batchID string) {
 		return
 	}
 
-	total, _ := toInt64(rows[0]["total"])
-	done, _ := toInt64(rows[0]["done"])
-	failed, _ := toInt64(rows[0]["failed"])
+	row := rows[0]
+	status, _ := row["processing_status"].(string)
+	total, _ := toInt64(row["total"])
+	done, _ := toInt64(row["done"])
+	failed, _ := toInt64(row["failed"])
+	completion := batchCompletion{
+		UploadID:       batchID,
+		Status:         status,
+		TotalPages:     total,
+		CompletedPages: done,
+		FailedPages:    failed,
+	}
+	h.publishBatchComplete(ctx, completion)
+	callbackURL, _ := row["callback_url"].(string)
+	h.notifyBatchComplete(ctx, callbackURL, completion)
+}
 
-	if total > 0 && done+failed == total {
-		var status string
-		switch {
-		case failed == 0:
-			status = "completed"
-		case done == 0:
-			status = "failed"
-		default:
-			status = "completed_with_errors"
-		}
-		_ = h.db.Exec(ctx,
-			"UPDATE upload_batches SET processing_status = $1, updated_at = NOW() WHERE id = $2",
-			status, batchID)
+// batchCompletedEvent is the event type published when a batch finishes.
+const batchCompletedEvent = "batch.completed"
+
+// publishBatchComplete emits the completion for internal consumers. It is
+// best-effort: a failed publish is logged and the batch stays completed.
+func (h *Handler) publishBatchComplete(ctx context.Context, c batchCompletion) {
+	if h.publisher == nil {
+		return
+	}
+	if err := h.publisher.Publish(ctx, batchCompletedEvent, c); err != nil {
+		log.Printf("WARNING: publish completion event for upload %s failed: %v", c.UploadID, err)
+	}
+}
+
+// batchCompletion describes a finished batch. It is the webhook payload and
+// the detail of the published event; Event and CompletedAt are only set for
+// webhooks, since the event envelope carries its own type and time.
+type batchCompletion struct {
+	Event          string `json:"event,omitempty"`
+	UploadID       string `json:"uploadId"`
+	Status         string `json:"status"`
+	TotalPages     int64  `json:"totalPages"`
+	CompletedPages int64  `json:"completedPages"`
+	FailedPages    int64  `json:"failedPages"`
+	CompletedAt    string `json:"completedAt,omitempty"`
+}
+
+// notifyBatchComplete POSTs the completion to the upload's callback URL.
+// Uploads without one, or a handler without a notifier, are skipped. Delivery
+// failures are logged; the batch status is already recorded.
+func (h *Handler) notifyBatchComplete(ctx context.Context, callbackURL string, c batchCompletion) {
+	if callbackURL == "" || h.webhook == nil {
+		return
+	}
+	c.Event = "upload.completed"
+	c.CompletedAt = time.Now().UTC().Format(time.RFC3339)
+	if err := h.webhook.Send(ctx, callbackURL, c); err != nil {
+		log.Printf("WARNING: completion webhook for upload %s failed: %v", c.UploadID, err)
 	}
 }
 
+// getGeminiClient lazily initializes the Gemini client from secrets. Calls
+// on the returned client are bounded by the handler's per-call timeout.
 func (h *Handler) getGeminiClient(ctx context.Context) (gemini.Client, error) {
 	if h.gemini != nil {
-		return h.gemini, nil
+		return gemini.WithTimeout(h.gemini, h.llmCallTimeout), nil
 	}
 
 	apiKey, err := h.secrets.GetSecret(ctx, fmt.Sprintf("%s", mustEnv("GEMINI_SECRET_ARN")))
@@ -236,195 +610,507 @@ func (h *Handler) getGeminiClient(ctx context.Context) (gemini.Client, error) {
 		return nil, err
 	}
 	h.gemini = client
-	return client, nil
+	return gemini.WithTimeout(client, h.llmCallTimeout), nil
 }
 
 // ─── QA Verification ────────────────────────────────────────────────────────
 
-type qaVerdict string
+// qaVerdictError is recorded as an entry's QA verdict when the QA call itself
+// failed.
+const qaVerdictError = "error"
+
+// qaVerdictSkipped is recorded as an entry's QA verdict when sampling let
+// its slice through unchecked.
+const qaVerdictSkipped = "skipped"
+
+// qaSampleMinConfidence is the model confidence below which a slice is
+// always checked, whatever the sample rate.
+const qaSampleMinConfidence = 0.9
+
+// needsQA reports whether a freshly extracted slice goes to QA. With
+// sampling enabled, only slices whose entries are all confident and record
+// nothing airworthiness-critical may skip it, and then only when the sample
+// draw says so.
+func (h *Handler) needsQA(entries []extractedEntry) bool {
+	if h.qaSampleRate >= 1 {
+		return true
+	}
+	for i := range entries {
+		c, ok := toFloat64(entries[i].Confidence)
+		if !ok || c < qaSampleMinConfidence || hasCriticalFields(&entries[i]) {
+			return true
+		}
+	}
+	return rand.Float64() < h.qaSampleRate
+}
 
-const (
-	qaPass        qaVerdict = "pass"
-	qaFail        qaVerdict = "fail"
-	qaNeedsReview qaVerdict = "needs_review"
-)
+// hasCriticalFields reports whether e records something a mistake in would
+// matter for airworthiness: AD compliance, an inspection, or a weight and
+// balance change.
+func hasCriticalFields(e *extractedEntry) bool {
+	_, legacyInspection := legacyInspectionMap[e.EntryType]
+	return len(e.ADCompliance) > 0 || e.WeightBalance != nil ||
+		e.EntryType == "inspection" || e.InspectionType != "" || legacyInspection
+}
 
-type qaFieldIssue struct {
-	Field     string `json:"field"`
-	Issue     string `json:"issue"`
-	Expected  string `json:"expected"`
-	Extracted string `json:"extracted"`
-	Severity  string `json:"severity"`
+// defaultQAMaxRetries is the number of re-extractions allowed after a
+// critical QA failure when QA_MAX_RETRIES is not set.
+const defaultQAMaxRetries = 1
+
+// extractAndVerifySlice performs extraction with QA verification, using
+// basePrompt for the first attempt and as the base of retry prompts. A
+// critical QA failure triggers a re-extraction, up to the handler's retry
+// budget; entries still failing after that are flagged for review, and
+// entries with only minor issues are accepted with review flags. Slices
+// sampling lets through skip QA altogether (see needsQA). Every returned
+// entry records the retries spent and its final QA verdict, and has its
+// confidence recalibrated against them.
+func (h *Handler) extractAndVerifySlice(ctx context.Context, imageData []byte, mimeType string, geminiClient gemini.Client, basePrompt string, sliceIndex int, pageID string) ([]extractedEntry, string, error) {
+	entries, pageType, err := h.extractWithQA(ctx, imageData, mimeType, geminiClient, basePrompt, sliceIndex, pageID)
+	for i := range entries {
+		calibrateConfidence(&entries[i])
+		addQAUncertainFields(&entries[i])
+	}
+	return entries, pageType, err
 }
 
-type qaResult struct {
-	EntryIndex int            `json:"entryIndex"`
-	Verdict    qaVerdict      `json:"verdict"`
-	Issues     []qaFieldIssue `json:"issues"`
-	Summary    string         `json:"summary"`
+// addQAUncertainFields adds the fields QA raised issues with to the fields
+// the model itself was unsure of, so reviewers see one list. Issues about
+// the entry as a whole name no field and are left out.
+func addQAUncertainFields(e *extractedEntry) {
+	for _, issue := range e.QAIssues {
+		if issue.Field == "" || slices.Contains(e.UncertainFields, issue.Field) {
+			continue
+		}
+		e.UncertainFields = append(e.UncertainFields, issue.Field)
+	}
 }
 
-type qaReport struct {
-	Results []qaResult `json:"results"`
+// addNote appends note to the entry's extraction notes unless an earlier QA
+// round already left it. Every round judges every entry of the slice again,
+// including those kept from before a retry, so the same verdict comes back.
+func addNote(e *extractedEntry, note string) {
+	if !strings.Contains(e.ExtractionNotes, note) {
+		e.ExtractionNotes += note
+	}
 }
 
-// extractAndVerifySlice performs extraction with QA verification. Up to 2
-// extraction attempts. Returns entries with NeedsReview flags set as needed.
-func (h *Handler) extractAndVerifySlice(ctx context.Context, imageData []byte, mimeType string, geminiClient gemini.Client, sliceIndex int, pageID string) ([]extractedEntry, string, error) {
-	const maxAttempts = 2
+// extractWithQA is extractAndVerifySlice before confidence calibration.
+func (h *Handler) extractWithQA(ctx context.Context, imageData []byte, mimeType string, geminiClient gemini.Client, basePrompt string, sliceIndex int, pageID string) ([]extractedEntry, string, error) {
+	maxRetries := h.qaMaxRetries
 
-	for attempt := 1; attempt <= maxAttempts; attempt++ {
-		// Extract
-		prompt := SliceExtractionPrompt
-		var lastIssues []qaFieldIssue
-		if attempt > 1 {
-			prompt = buildRetryPrompt(lastIssues)
-		}
+	entries, pageType, err := h.extractSlice(ctx, geminiClient, imageData, mimeType, basePrompt, sliceIndex, pageID, 1)
+	if err != nil {
+		return nil, "", err
+	}
 
-		entries, pageType, err := h.extractSlice(ctx, geminiClient, imageData, mimeType, prompt, sliceIndex, pageID, attempt)
-		if err != nil {
-			return nil, "", err
+	if len(entries) == 0 {
+		return entries, pageType, nil
+	}
+	if !h.needsQA(entries) {
+		log.Printf("  Slice %d of page %s: QA skipped by sampling", sliceIndex, pageID)
+		for i := range entries {
+			entries[i].QAVerdict = qaVerdictSkipped
 		}
+		return entries, pageType, nil
+	}
 
+	for retry := 0; ; retry++ {
 		// Skip QA for empty extractions
 		if len(entries) == 0 {
 			return entries, pageType, nil
 		}
 
-		// Run QA
 		report, qaErr := h.verifyExtraction(ctx, imageData, mimeType, entries, geminiClient)
 		if qaErr != nil {
 			// QA failure is non-fatal — flag for review and return
 			log.Printf("WARNING: QA verification failed for slice %d of page %s: %v", sliceIndex, pageID, qaErr)
+			note := "QA verification error: "
+			if retry > 0 {
+				note = "QA verification error on retry: "
+			}
 			for i := range entries {
 				entries[i].NeedsReview = true
-				entries[i].ExtractionNotes += "QA verification error: " + qaErr.Error() + ". "
+				addNote(&entries[i], note+qaErr.Error()+". ")
+				entries[i].QARetries = retry
+				entries[i].QAVerdict = qaVerdictError
 			}
 			return entries, pageType, nil
 		}
 
-		// Evaluate QA results
-		allPassed := true
-		hasCriticalFail := false
-		var criticalIssues []qaFieldIssue
-
+		// Evaluate QA results. Verdicts are applied by entryIndex so that on
+		// multi-entry slices each entry is judged, retried and flagged on
+		// its own; a failure QA can't attribute to an entry puts the whole
+		// slice in question.
+		failNote := "QA fail: "
+		if retry > 0 {
+			failNote = "QA fail after retry: "
+		}
+		var criticalIssues []qa.FieldIssue
+		failedIssues := map[int][]qa.FieldIssue{}
+		judged := make([]bool, len(entries))
+		unattributedFail := false
+		for i := range entries {
+			entries[i].QARetries = retry
+			entries[i].QAVerdict = ""
+			entries[i].QAIssues = nil
+			entries[i].QAPassed = false
+		}
 		for _, r := range report.Results {
-			switch r.Verdict {
-			case qaPass:
-				// Entry is good
-			case qaNeedsReview:
-				if r.EntryIndex >= 0 && r.EntryIndex < len(entries) {
-					entries[r.EntryIndex].NeedsReview = true
-					entries[r.EntryIndex].ExtractionNotes += "QA: " + r.Summary + ". "
+			var critical []qa.FieldIssue
+			for _, issue := range r.Issues {
+				if issue.Severity == "critical" {
+					critical = append(critical, issue)
 				}
-			case qaFail:
-				allPassed = false
-				hasCriticalFail = true
-				for _, issue := range r.Issues {
-					if issue.Severity == "critical" {
-						criticalIssues = append(criticalIssues, issue)
-					}
+			}
+			if r.Verdict == qa.Fail {
+				criticalIssues = append(criticalIssues, critical...)
+			}
+			if r.EntryIndex < 0 || r.EntryIndex >= len(entries) {
+				if r.Verdict == qa.Fail {
+					unattributedFail = true
 				}
-				if r.EntryIndex >= 0 && r.EntryIndex < len(entries) {
-					entries[r.EntryIndex].ExtractionNotes += "QA fail: " + r.Summary + ". "
+				continue
+			}
+			judged[r.EntryIndex] = true
+			e := &entries[r.EntryIndex]
+			e.QAVerdict = string(r.Verdict)
+			e.QAIssues = append(e.QAIssues, r.Issues...)
+			switch r.Verdict {
+			case qa.Pass:
+				e.QAPassed = true
+			case qa.NeedsReview:
+				e.NeedsReview = true
+				addNote(e, "QA: "+r.Summary+". ")
+			case qa.Fail:
+				failedIssues[r.EntryIndex] = append(failedIssues[r.EntryIndex], critical...)
+				addNote(e, failNote+r.Summary+". ")
+				if retry > 0 {
+					e.NeedsReview = true
 				}
 			}
 		}
-
-		if allPassed {
-			log.Printf("  Slice %d of page %s: QA passed (attempt %d)", sliceIndex, pageID, attempt)
-			return entries, pageType, nil
+		for i := range entries {
+			if !judged[i] {
+				entries[i].NeedsReview = true
+				addNote(&entries[i], "QA returned no verdict for this entry. ")
+			}
 		}
 
-		if !hasCriticalFail {
-			// Only minor issues — accept with review flags
+		if len(failedIssues) == 0 && !unattributedFail {
+			// Passed, or only minor issues — accept with any review flags
+			if retry > 0 {
+				log.Printf("  Slice %d of page %s: QA passed after %d retries", sliceIndex, pageID, retry)
+			} else {
+				log.Printf("  Slice %d of page %s: QA passed (attempt 1)", sliceIndex, pageID)
+			}
 			return entries, pageType, nil
 		}
 
-		// Critical failure — retry if we have attempts left
-		if attempt < maxAttempts {
-			log.Printf("  Slice %d of page %s: QA failed with %d critical issues, retrying (attempt %d)", sliceIndex, pageID, len(criticalIssues), attempt)
-			lastIssues = criticalIssues
-			// Build retry prompt with the issues we found
-			prompt = buildRetryPrompt(lastIssues)
-
-			retryEntries, retryPageType, retryErr := h.extractSlice(ctx, geminiClient, imageData, mimeType, prompt, sliceIndex, pageID, attempt+1)
-			if retryErr != nil {
-				// Retry extraction failed — flag originals for review
-				for i := range entries {
+		// flagFailed marks the failing entries for review, or every entry
+		// when a failure couldn't be attributed.
+		flagFailed := func() {
+			for i := range entries {
+				if _, failed := failedIssues[i]; failed || unattributedFail {
 					entries[i].NeedsReview = true
 				}
-				return entries, pageType, nil
 			}
+		}
 
-			if len(retryEntries) == 0 {
-				return retryEntries, retryPageType, nil
-			}
+		if retry >= maxRetries {
+			// Retry budget spent — flag for review and return
+			log.Printf("  Slice %d of page %s: QA failed after %d attempts, flagging for review", sliceIndex, pageID, retry+1)
+			flagFailed()
+			return entries, pageType, nil
+		}
 
-			// QA the retry
-			retryReport, retryQAErr := h.verifyExtraction(ctx, imageData, mimeType, retryEntries, geminiClient)
-			if retryQAErr != nil {
-				for i := range retryEntries {
-					retryEntries[i].NeedsReview = true
-					retryEntries[i].ExtractionNotes += "QA verification error on retry: " + retryQAErr.Error() + ". "
+		// Critical failure — re-extract with the issues we found
+		prompt := buildRetryPrompt(basePrompt, criticalIssues)
+		if len(entries) > 1 && !unattributedFail {
+			var flagged []entryIssues
+			for i := range entries {
+				if issues, failed := failedIssues[i]; failed {
+					flagged = append(flagged, entryIssues{index: i, date: entries[i].Date, issues: issues})
 				}
-				return retryEntries, retryPageType, nil
 			}
+			prompt = buildMultiEntryRetryPrompt(basePrompt, len(entries), flagged)
+		}
+		log.Printf("  Slice %d of page %s: QA failed with %d critical issues, retrying (attempt %d)", sliceIndex, pageID, len(criticalIssues), retry+1)
+		retryEntries, retryPageType, retryErr := h.extractSlice(ctx, geminiClient, imageData, mimeType, prompt, sliceIndex, pageID, retry+2)
+		if retryErr != nil {
+			// Retry extraction failed — flag the failing originals for review
+			flagFailed()
+			return entries, pageType, nil
+		}
 
-			// Evaluate retry QA
-			retryAllPassed := true
-			for _, r := range retryReport.Results {
-				if r.Verdict == qaFail {
-					retryAllPassed = false
-					if r.EntryIndex >= 0 && r.EntryIndex < len(retryEntries) {
-						retryEntries[r.EntryIndex].NeedsReview = true
-						retryEntries[r.EntryIndex].ExtractionNotes += "QA fail after retry: " + r.Summary + ". "
-					}
-				} else if r.Verdict == qaNeedsReview {
-					if r.EntryIndex >= 0 && r.EntryIndex < len(retryEntries) {
-						retryEntries[r.EntryIndex].NeedsReview = true
-						retryEntries[r.EntryIndex].ExtractionNotes += "QA: " + r.Summary + ". "
-					}
-				}
-			}
+		// Keep original values for fields QA did not flag
+		entries = mergeRetryEntries(entries, retryEntries, report.Results)
+		pageType = retryPageType
+	}
+}
 
-			if retryAllPassed {
-				log.Printf("  Slice %d of page %s: QA passed after retry", sliceIndex, pageID)
-			} else {
-				log.Printf("  Slice %d of page %s: QA still failing after retry, flagging for review", sliceIndex, pageID)
-				for i := range retryEntries {
-					retryEntries[i].NeedsReview = true
-				}
+// Confidence calibration. Models report high confidence even for entries QA
+// finds fault with, so the stored confidence is the model's own, capped by
+// the QA verdict and scaled down for each issue QA raised and each retry it
+// took.
+const (
+	// unknownModelConfidence stands in when the model gave no confidence.
+	unknownModelConfidence = 0.5
+	// needsReviewConfidenceCap, failConfidenceCap and unverifiedConfidenceCap
+	// bound entries QA flagged, failed, or could not judge.
+	needsReviewConfidenceCap = 0.7
+	failConfidenceCap        = 0.4
+	unverifiedConfidenceCap  = 0.7
+	// criticalIssueFactor and minorIssueFactor apply once per issue.
+	criticalIssueFactor = 0.6
+	minorIssueFactor    = 0.9
+	// retryConfidenceFactor applies once per re-extraction.
+	retryConfidenceFactor = 0.95
+)
+
+// calibrateConfidence replaces e.Confidence with the calibrated confidence,
+// rounded to hundredths, keeping the model's value in e.ModelConfidence.
+func calibrateConfidence(e *extractedEntry) {
+	e.ModelConfidence = e.Confidence
+	c, ok := toFloat64(e.Confidence)
+	if !ok {
+		c = unknownModelConfidence
+	}
+	c = max(0, min(c, 1))
+
+	switch qa.Verdict(e.QAVerdict) {
+	case qa.Pass:
+	case qa.NeedsReview:
+		c = min(c, needsReviewConfidenceCap)
+	case qa.Fail:
+		c = min(c, failConfidenceCap)
+	default: // QA errored, was skipped, or gave no verdict
+		c = min(c, unverifiedConfidenceCap)
+	}
+	for _, issue := range e.QAIssues {
+		if issue.Severity == "critical" {
+			c *= criticalIssueFactor
+		} else {
+			c *= minorIssueFactor
+		}
+	}
+	c *= math.Pow(retryConfidenceFactor, float64(e.QARetries))
+
+	e.Confidence = math.Round(c*100) / 100
+}
+
+// retryBookkeepingFields are taken from the retry whenever an entry is merged,
+// since they describe the re-examined extraction as a whole.
+var retryBookkeepingFields = []string{"confidence", "needsReview", "missingData", "uncertainFields", "extractionNotes"}
+
+// mergeRetryEntries reconciles a retry extraction with the original one. For
+// each entry, only the fields QA flagged are taken from the retry; everything
+// QA accepted keeps its original value, so a retry cannot regress good data.
+// When the entry set itself is in question (entry-level issues, differing
+// entry counts, or a flagged field we can't map), the retry is used as-is.
+func mergeRetryEntries(original, retry []extractedEntry, results []qa.Result) []extractedEntry {
+	if len(original) != len(retry) {
+		return retry
+	}
+
+	flagged := map[int][]string{}
+	wholeEntry := map[int]bool{}
+	for _, r := range results {
+		if r.Verdict == qa.Fail && len(r.Issues) == 0 && r.EntryIndex >= 0 && r.EntryIndex < len(original) {
+			// Failed without saying which fields — nothing to keep.
+			wholeEntry[r.EntryIndex] = true
+		}
+		for _, issue := range r.Issues {
+			if issue.Issue == "missing_entry" || issue.Issue == "fabricated_entry" {
+				return retry
+			}
+			if r.EntryIndex < 0 || r.EntryIndex >= len(original) {
+				return retry
 			}
-			return retryEntries, retryPageType, nil
+			flagged[r.EntryIndex] = append(flagged[r.EntryIndex], topLevelField(issue.Field))
 		}
+	}
 
-		// Max attempts reached — flag for review and return
-		log.Printf("  Slice %d of page %s: QA failed after %d attempts, flagging for review", sliceIndex, pageID, maxAttempts)
-		for i := range entries {
-			entries[i].NeedsReview = true
+	merged := make([]extractedEntry, len(original))
+	copy(merged, original)
+	for i := range wholeEntry {
+		merged[i] = retry[i]
+	}
+	for i, fields := range flagged {
+		if wholeEntry[i] {
+			continue
 		}
-		return entries, pageType, nil
+		entry, ok := mergeEntryFields(original[i], retry[i], fields)
+		if !ok {
+			merged[i] = retry[i]
+			continue
+		}
+		merged[i] = entry
+	}
+	return merged
+}
+
+// mergeEntryFields copies the named JSON fields (plus bookkeeping fields) from
+// retry onto orig. Returns false if a field name doesn't exist on the entry.
+func mergeEntryFields(orig, retry extractedEntry, fields []string) (extractedEntry, bool) {
+	origMap, err1 := entryToMap(orig)
+	retryMap, err2 := entryToMap(retry)
+	if err1 != nil || err2 != nil {
+		return extractedEntry{}, false
 	}
 
-	// Should not be reached
-	return nil, "", nil
+	for _, f := range append(fields, retryBookkeepingFields...) {
+		v, inRetry := retryMap[f]
+		_, inOrig := origMap[f]
+		if !inRetry && !inOrig {
+			return extractedEntry{}, false
+		}
+		if inRetry {
+			origMap[f] = v
+		} else {
+			delete(origMap, f)
+		}
+	}
+
+	b, err := json.Marshal(origMap)
+	if err != nil {
+		return extractedEntry{}, false
+	}
+	var out extractedEntry
+	if err := json.Unmarshal(b, &out); err != nil {
+		return extractedEntry{}, false
+	}
+	return out, true
+}
+
+func entryToMap(e extractedEntry) (map[string]any, error) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]any
+	err = json.Unmarshal(b, &m)
+	return m, err
+}
+
+// topLevelField reduces a QA field path like "partsActions[0].partNumber" to
+// the entry field that contains it.
+func topLevelField(field string) string {
+	if i := strings.IndexAny(field, "[."); i >= 0 {
+		return field[:i]
+	}
+	return field
+}
+
+// defaultExtractionTemperature keeps extraction close to deterministic when
+// GENERATE_TEMPERATURE is unset.
+const defaultExtractionTemperature = float32(0.1)
+
+// extractionConfig returns the generation config for extraction calls: the
+// configured sampling, with defaultExtractionTemperature when no temperature
+// is set, and JSON output. Callers add their response schema. QA calls keep
+// their own settings.
+func (h *Handler) extractionConfig() *gemini.GenerateConfig {
+	cfg := h.sampling
+	if cfg.Temperature == nil {
+		temp := defaultExtractionTemperature
+		cfg.Temperature = &temp
+	}
+	cfg.ResponseMIMEType = "application/json"
+	return &cfg
+}
+
+// extractionSchema is the shape of extractionResult, mirroring the JSON the
+// extraction prompts ask for. Gemini holds its output to it, so responses
+// parse even when the model would otherwise fence or truncate them.
+var extractionSchema = objectSchema([]string{"pageType", "entries"},
+	schemaField{"pageType", enumSchema(false, "maintenance_entry", "inspection_form", "parts_list", "weight_balance", "sticker", "cover", "blank", "other")},
+	schemaField{"entries", &gemini.Schema{Type: gemini.TypeArray, Items: objectSchema(
+		[]string{"date", "maintenanceNarrative", "entryType", "confidence"},
+		schemaField{"date", nullable(gemini.TypeString)},
+		schemaField{"aircraftRegistration", nullable(gemini.TypeString)},
+		schemaField{"aircraftSerial", nullable(gemini.TypeString)},
+		schemaField{"aircraftMake", nullable(gemini.TypeString)},
+		schemaField{"aircraftModel", nullable(gemini.TypeString)},
+		schemaField{"hobbsTime", nullable(gemini.TypeNumber)},
+		schemaField{"tachTime", nullable(gemini.TypeNumber)},
+		schemaField{"flightTime", nullable(gemini.TypeNumber)},
+		schemaField{"timeSinceOverhaul", nullable(gemini.TypeNumber)},
+		schemaField{"shopName", nullable(gemini.TypeString)},
+		schemaField{"shopAddress", nullable(gemini.TypeString)},
+		schemaField{"shopPhone", nullable(gemini.TypeString)},
+		schemaField{"repairStationNumber", nullable(gemini.TypeString)},
+		schemaField{"mechanicName", nullable(gemini.TypeString)},
+		schemaField{"mechanicCertificate", nullable(gemini.TypeString)},
+		schemaField{"workOrderNumber", nullable(gemini.TypeString)},
+		schemaField{"maintenanceNarrative", &gemini.Schema{Type: gemini.TypeString}},
+		schemaField{"entryType", enumSchema(false, "maintenance", "inspection", "ad_compliance", "other")},
+		schemaField{"adCompliance", &gemini.Schema{Type: gemini.TypeArray, Items: objectSchema([]string{"adNumber"},
+			schemaField{"adNumber", &gemini.Schema{Type: gemini.TypeString}},
+			schemaField{"method", nullable(gemini.TypeString)},
+			schemaField{"notes", nullable(gemini.TypeString)},
+		)}},
+		schemaField{"partsActions", &gemini.Schema{Type: gemini.TypeArray, Items: objectSchema([]string{"action", "partName"},
+			schemaField{"action", enumSchema(false, "installed", "removed", "replaced", "repaired", "inspected", "overhauled")},
+			schemaField{"partName", &gemini.Schema{Type: gemini.TypeString}},
+			schemaField{"partNumber", nullable(gemini.TypeString)},
+			schemaField{"serialNumber", nullable(gemini.TypeString)},
+			schemaField{"oldPartNumber", nullable(gemini.TypeString)},
+			schemaField{"oldSerialNumber", nullable(gemini.TypeString)},
+			schemaField{"quantity", nullable(gemini.TypeNumber)},
+			schemaField{"notes", nullable(gemini.TypeString)},
+			schemaField{"lifeLimitHours", nullable(gemini.TypeNumber)},
+			schemaField{"lifeLimitMonths", nullable(gemini.TypeNumber)},
+		)}},
+		schemaField{"inspectionType", enumSchema(true, "annual", "100hr", "50hr", "progressive", "altimeter_static", "transponder", "elt")},
+		schemaField{"farReference", nullable(gemini.TypeString)},
+		schemaField{"confidence", &gemini.Schema{Type: gemini.TypeNumber}},
+		schemaField{"missingData", &gemini.Schema{Type: gemini.TypeArray, Items: &gemini.Schema{Type: gemini.TypeString}}},
+		schemaField{"uncertainFields", &gemini.Schema{Type: gemini.TypeArray, Items: &gemini.Schema{Type: gemini.TypeString}}},
+		schemaField{"needsReview", &gemini.Schema{Type: gemini.TypeBoolean}},
+		schemaField{"extractionNotes", nullable(gemini.TypeString)},
+	)}},
+)
+
+// schemaField is one property of an object schema.
+type schemaField struct {
+	name   string
+	schema *gemini.Schema
+}
+
+// objectSchema returns an object schema whose properties the model writes
+// in the order given.
+func objectSchema(required []string, fields ...schemaField) *gemini.Schema {
+	s := &gemini.Schema{Type: gemini.TypeObject, Properties: make(map[string]*gemini.Schema, len(fields)), Required: required}
+	for _, f := range fields {
+		s.Properties[f.name] = f.schema
+		s.PropertyOrdering = append(s.PropertyOrdering, f.name)
+	}
+	return s
+}
+
+func nullable(t gemini.Type) *gemini.Schema {
+	return &gemini.Schema{Type: t, Nullable: true}
+}
+
+func enumSchema(isNullable bool, values ...string) *gemini.Schema {
+	return &gemini.Schema{Type: gemini.TypeString, Enum: values, Nullable: isNullable}
 }
 
 // extractSlice calls Gemini to extract entries from a single slice image.
 func (h *Handler) extractSlice(ctx context.Context, geminiClient gemini.Client, imageData []byte, mimeType, prompt string, sliceIndex int, pageID string, attempt int) ([]extractedEntry, string, error) {
-	temp := float32(0.1)
-	responseText, err := geminiClient.GenerateContent(ctx, "gemini-2.5-flash", []gemini.Part{
+	cfg := h.extractionConfig()
+	cfg.ResponseSchema = extractionSchema
+	responseText, err := geminiClient.GenerateContent(ctx, extractionModel, []gemini.Part{
 		{Text: prompt},
 		{Data: imageData, MIMEType: mimeType},
-	}, &gemini.GenerateConfig{
-		Temperature:      &temp,
-		ResponseMIMEType: "application/json",
-	})
+	}, cfg)
 	if err != nil {
 		return nil, "", fmt.Errorf("gemini extraction (attempt %d): %w", attempt, err)
 	}
 
+	// The schema should keep responses bare JSON; strip fences anyway in
+	// case a model slips one in.
 	responseText = cleanMarkdownFences(responseText)
 	if responseText == "" {
 		log.Printf("WARNING: empty Gemini response for slice %d of page %s (attempt %d)", sliceIndex, pageID, attempt)
@@ -441,73 +1127,25 @@ func (h *Handler) extractSlice(ctx context.Context, geminiClient gemini.Client,
 
 // verifyExtraction sends the slice image and extraction JSON to the QA model.
 // Uses Claude if available, falls back to Gemini.
-func (h *Handler) verifyExtraction(ctx context.Context, imageData []byte, mimeType string, entries []extractedEntry, geminiClient gemini.Client) (*qaReport, error) {
+func (h *Handler) verifyExtraction(ctx context.Context, imageData []byte, mimeType string, entries []extractedEntry, geminiClient gemini.Client) (*qa.Report, error) {
 	extractionJSON, err := json.Marshal(entries)
 	if err != nil {
 		return nil, fmt.Errorf("marshal extraction for QA: %w", err)
 	}
 
-	qaPrompt := QAVerificationPrompt + "\n\nExtraction to verify:\n" + string(extractionJSON)
-
-	var responseText string
-
-	// Try Claude first, fall back to Gemini
+	// A Claude setup error is not fatal — QA runs on Gemini instead.
 	claudeClient, claudeErr := h.getClaudeClient(ctx)
-	if claudeErr == nil && claudeClient != nil {
-		responseText, err = claudeClient.CreateMessage(ctx, "claude-haiku-4-5-20251001", 4096, []anthropic.Message{
-			{
-				Role: "user",
-				Content: []anthropic.ContentPart{
-					{ImageData: imageData, MIMEType: mimeType},
-					{Text: qaPrompt},
-				},
-			},
-		})
-		if err != nil {
-			log.Printf("WARNING: Claude QA failed, falling back to Gemini: %v", err)
-			responseText, err = h.geminiQA(ctx, geminiClient, imageData, mimeType, qaPrompt)
-			if err != nil {
-				return nil, fmt.Errorf("gemini QA fallback: %w", err)
-			}
-		}
-	} else {
-		// No Claude available — use Gemini for QA
-		responseText, err = h.geminiQA(ctx, geminiClient, imageData, mimeType, qaPrompt)
-		if err != nil {
-			return nil, fmt.Errorf("gemini QA: %w", err)
-		}
-	}
-
-	responseText = cleanMarkdownFences(responseText)
-	if responseText == "" {
-		return nil, fmt.Errorf("empty QA response")
-	}
-
-	var report qaReport
-	if err := json.Unmarshal([]byte(responseText), &report); err != nil {
-		return nil, fmt.Errorf("parse QA response: %w", err)
+	if claudeErr != nil {
+		claudeClient = nil
 	}
-
-	return &report, nil
-}
-
-// geminiQA sends a QA request to Gemini (used as fallback when Claude is unavailable).
-func (h *Handler) geminiQA(ctx context.Context, geminiClient gemini.Client, imageData []byte, mimeType, qaPrompt string) (string, error) {
-	temp := float32(0.1)
-	return geminiClient.GenerateContent(ctx, "gemini-2.5-flash", []gemini.Part{
-		{Text: qaPrompt},
-		{Data: imageData, MIMEType: mimeType},
-	}, &gemini.GenerateConfig{
-		Temperature:      &temp,
-		ResponseMIMEType: "application/json",
-	})
+	return qa.Verify(ctx, claudeClient, geminiClient, imageData, mimeType, extractionJSON)
 }
 
 // getClaudeClient lazily initializes the Claude client from secrets.
 // Returns nil, nil if no ANTHROPIC_API_KEY is configured (triggering Gemini fallback).
 func (h *Handler) getClaudeClient(ctx context.Context) (anthropic.Client, error) {
 	if h.claude != nil {
-		return h.claude, nil
+		return anthropic.WithTimeout(h.claude, h.llmCallTimeout), nil
 	}
 
 	secretARN := mustEnv("GEMINI_SECRET_ARN") // Same secret, different key
@@ -533,7 +1171,7 @@ func (h *Handler) getClaudeClient(ctx context.Context) (anthropic.Client, error)
 
 	client := anthropic.New(apiKey)
 	h.claude = client
-	return client, nil
+	return anthropic.WithTimeout(client, h.llmCallTimeout), nil
 }
 
 // ─── Entry Normalization & Saving ───────────────────────────────────────────
@@ -567,9 +1205,39 @@ type extractedEntry struct {
 	Confidence           any               `json:"confidence"`
 	NeedsReview          bool              `json:"needsReview"`
 	MissingData          []string          `json:"missingData"`
+	UncertainFields      []string          `json:"uncertainFields"`
 	ExtractionNotes      string            `json:"extractionNotes"`
 	ADCompliance         []adComplianceRec `json:"adCompliance"`
 	PartsActions         []partsActionRec  `json:"partsActions"`
+	WeightBalance        *weightBalanceRec `json:"weightBalance,omitempty"`
+
+	// QAPassed is set by the verification step, never by the model output.
+	QAPassed bool `json:"-"`
+	// QARetries is the number of re-extractions spent on the entry's slice.
+	QARetries int `json:"-"`
+	// QAVerdict is the final QA verdict (pass, fail, needs_review or error);
+	// empty when QA did not run.
+	QAVerdict string `json:"-"`
+	// QAIssues are the issues QA raised with its final verdict.
+	QAIssues []qa.FieldIssue `json:"-"`
+	// ModelConfidence is the model's own confidence; Confidence holds the
+	// calibrated one once QA has run.
+	ModelConfidence any `json:"-"`
+	// Slice is the uploaded slice image the entry was read from, if any.
+	Slice *sliceOrigin `json:"-"`
+	// Source is stickerSource for entries read from a sticker slice.
+	Source string `json:"-"`
+	// PromptVersion identifies the extraction prompt the entry was read with.
+	PromptVersion string `json:"-"`
+}
+
+// sliceOrigin identifies the slice image an entry came from and its vertical
+// pixel bounds on the page. Y1 is 0 when the whole page was used, and Key is
+// empty when slices aren't uploaded.
+type sliceOrigin struct {
+	Key string
+	Y0  int
+	Y1  int
 }
 
 type adComplianceRec struct {
@@ -587,6 +1255,16 @@ type partsActionRec struct {
 	OldSerialNumber string `json:"oldSerialNumber"`
 	Quantity        any    `json:"quantity"`
 	Notes           string `json:"notes"`
+	LifeLimitHours  any    `json:"lifeLimitHours"`
+	LifeLimitMonths any    `json:"lifeLimitMonths"`
+}
+
+type weightBalanceRec struct {
+	EmptyWeight      any    `json:"emptyWeight"`
+	EmptyCG          any    `json:"emptyCG"`
+	UsefulLoad       any    `json:"usefulLoad"`
+	EquipmentChanges string `json:"equipmentChanges"`
+	Notes            string `json:"notes"`
 }
 
 var legacyInspectionMap = map[string]string{
@@ -597,10 +1275,6 @@ var legacyInspectionMap = map[string]string{
 	"transponder_check": "transponder",
 }
 
-var validEntryTypes = map[string]bool{
-	"maintenance": true, "inspection": true, "ad_compliance": true, "other": true,
-}
-
 var validActionTypes = map[string]bool{
 	"installed": true, "removed": true, "replaced": true,
 	"repaired": true, "inspected": true, "overhauled": true,
@@ -622,9 +1296,89 @@ var validComplianceMethods = map[string]bool{
 	"terminating_action": true, "recurring": true, "not_applicable": true, "other": true,
 }
 
-var validInspectionTypes = map[string]bool{
-	"annual": true, "100hr": true, "50hr": true, "progressive": true,
-	"altimeter_static": true, "transponder": true, "elt": true, "other": true,
+// adNumberPattern matches an FAA AD number as logbooks write it: an optional
+// "AD" prefix, a two- or four-digit year, the biweekly issue and the sequence
+// number, with any or no separators, and an optional revision.
+var adNumberPattern = regexp.MustCompile(`(?i)^\s*(?:AD)?[\s#:.-]*(\d{4}|\d{2})[\s.-]*(\d{2})[\s.-]*(\d{2})(?:[\s.-]*R(\d+))?\s*$`)
+
+// normalizeADNumber rewrites an AD number in the FAA's YYYY-NN-NN form
+// (YY-NN-NN for ADs issued before 2000), with any revision as a trailing
+// " R1". The second result is false when s isn't recognizable as an AD
+// number, in which case it is returned trimmed but otherwise untouched.
+func normalizeADNumber(s string) (string, bool) {
+	m := adNumberPattern.FindStringSubmatch(s)
+	if m == nil {
+		return strings.TrimSpace(s), false
+	}
+	n := m[1] + "-" + m[2] + "-" + m[3]
+	if m[4] != "" {
+		n += " R" + m[4]
+	}
+	return n, true
+}
+
+// normalizePartAction maps an extracted parts action onto the action types
+// parts_actions accepts, defaulting to installed.
+func normalizePartAction(action string) string {
+	if validActionTypes[action] {
+		return action
+	}
+	if mapped, ok := actionTypeMap[action]; ok {
+		return mapped
+	}
+	return "installed"
+}
+
+// maxPartQuantity is the largest parts quantity taken at face value. Larger
+// ones are more often a misread part number or hour figure.
+const maxPartQuantity = 1000
+
+// parseQuantity reads a parts quantity the model may have returned as a
+// number or as text like "2 ea" or "(4)", rounding fractions. Missing,
+// unparseable and non-positive quantities count as 1.
+func parseQuantity(v any) int {
+	if s, ok := v.(string); ok {
+		v = leadingNumber.FindString(strings.ReplaceAll(s, ",", ""))
+	}
+	f, ok := toFloat64(v)
+	if !ok || math.IsNaN(f) {
+		return 1
+	}
+	q := math.Round(f)
+	switch {
+	case q < 1:
+		return 1
+	case q > math.MaxInt32: // the column is an INTEGER
+		return math.MaxInt32
+	}
+	return int(q)
+}
+
+// farSectionPattern matches a CFR section number such as the 91.409 of
+// "14 CFR 91.409(a)(1)".
+var farSectionPattern = regexp.MustCompile(`\b\d{2,3}\.\d{1,4}\b`)
+
+// farReferenceMismatch reports whether ref cites another inspection's rule
+// and none of inspectionType's, returning the sections it expected. A
+// missing reference, or one citing no inspection rule at all, is no
+// contradiction.
+func farReferenceMismatch(inspectionType, ref string) (expected []string, mismatch bool) {
+	expected = models.InspectionRules[inspectionType].FARs
+	if len(expected) == 0 {
+		return nil, false
+	}
+	citesOther := false
+	for _, section := range farSectionPattern.FindAllString(ref, -1) {
+		if slices.Contains(expected, section) {
+			return expected, false
+		}
+		for _, rule := range models.InspectionRules {
+			if slices.Contains(rule.FARs, section) {
+				citesOther = true
+			}
+		}
+	}
+	return expected, citesOther
 }
 
 func normalizeEntryType(entry *extractedEntry) {
@@ -639,7 +1393,7 @@ func normalizeEntryType(entry *extractedEntry) {
 		entry.InspectionType = "other"
 	}
 
-	if !validEntryTypes[entry.EntryType] {
+	if !models.ValidEntryTypes[entry.EntryType] {
 		entry.EntryType = "other"
 	}
 }
@@ -653,25 +1407,113 @@ func (h *Handler) saveEntry(ctx context.Context, aircraftID, pageID string, entr
 		return nil
 	}
 
+	// AD numbers are normalized so compliance with the same AD groups
+	// together however it was written; one that isn't recognizable is kept
+	// as written and the entry flagged.
+	adNumbers := make([]string, len(entry.ADCompliance))
+	for i, ad := range entry.ADCompliance {
+		n, ok := normalizeADNumber(ad.ADNumber)
+		adNumbers[i] = n
+		if !ok {
+			entry.NeedsReview = true
+			entry.ExtractionNotes += fmt.Sprintf("Unrecognized AD number %q. ", ad.ADNumber)
+		}
+	}
+
+	// Quantities are normalized before the insert so an implausible one can
+	// still flag the entry for review.
+	quantities := make([]int, len(entry.PartsActions))
+	for i, part := range entry.PartsActions {
+		quantities[i] = parseQuantity(part.Quantity)
+		if quantities[i] > maxPartQuantity {
+			entry.NeedsReview = true
+			entry.ExtractionNotes += fmt.Sprintf("Implausible quantity %d for part %q. ", quantities[i], part.PartName)
+		}
+	}
+
+	// An FAR reference contradicting the inspection type suggests one of the
+	// two was misread. It is only a hint, so the entry is flagged, not
+	// changed.
+	if expected, mismatch := farReferenceMismatch(entry.InspectionType, entry.FARReference); mismatch {
+		entry.NeedsReview = true
+		entry.ExtractionNotes += fmt.Sprintf("FAR reference %q doesn't match a %s inspection (expected %s). ",
+			entry.FARReference, entry.InspectionType, strings.Join(expected, " or "))
+	}
+
+	// A narrative that is implausibly long or loops is usually the model
+	// running away. It is flagged rather than dropped.
+	maxNarrative := h.maxNarrativeLength
+	if maxNarrative <= 0 {
+		maxNarrative = defaultMaxNarrativeLength
+	}
+	if problem := narrativeProblem(entry.MaintenanceNarrative, maxNarrative); problem != "" {
+		entry.NeedsReview = true
+		entry.ExtractionNotes += problem + ". "
+	}
+
 	// Insert maintenance_entries
 	var missingData any
 	if len(entry.MissingData) > 0 {
 		missingData = entry.MissingData
 	}
 
+	var uncertainFields any
+	if len(entry.UncertainFields) > 0 {
+		b, _ := json.Marshal(entry.UncertainFields)
+		uncertainFields = string(b)
+	}
+
 	var extractionNotes any
 	if entry.ExtractionNotes != "" {
 		extractionNotes = entry.ExtractionNotes
 	}
 
+	reviewStatus := "pending"
+	var reviewedBy, reviewedAt any
+	if h.shouldAutoApprove(entry) {
+		reviewStatus = "approved"
+		reviewedBy = models.AutoApproveActor
+		reviewedAt = time.Now().UTC()
+	}
+
+	var sliceKey, sliceY0, sliceY1 any
+	if entry.Slice != nil {
+		if entry.Slice.Key != "" {
+			sliceKey = entry.Slice.Key
+		}
+		if entry.Slice.Y1 > entry.Slice.Y0 {
+			sliceY0 = entry.Slice.Y0
+			sliceY1 = entry.Slice.Y1
+		}
+	}
+
+	var qaVerdict any
+	if entry.QAVerdict != "" {
+		qaVerdict = entry.QAVerdict
+	}
+
+	var source any
+	if entry.Source != "" {
+		source = entry.Source
+	}
+
+	var version any
+	if entry.PromptVersion != "" {
+		version = entry.PromptVersion
+	}
+
 	entryID, err := h.db.Insert(ctx,
 		`INSERT INTO maintenance_entries
 		 (aircraft_id, page_id, entry_type, entry_date, hobbs_time, tach_time,
 		  flight_time, time_since_overhaul, shop_name, shop_address, shop_phone,
 		  repair_station_number, mechanic_name, mechanic_certificate,
 		  work_order_number, maintenance_narrative, confidence_score,
-		  needs_review, missing_data, extraction_notes)
-		 VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20)
+		  needs_review, missing_data, extraction_notes,
+		  review_status, reviewed_by, reviewed_at,
+		  slice_key, slice_y0, slice_y1, qa_verdict, qa_retries, model_confidence,
+		  uncertain_fields, source, aircraft_serial, aircraft_make, aircraft_model,
+		  extraction_model, prompt_version)
+		 VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,$20,$21,$22,$23,$24,$25,$26,$27,$28,$29,$30::jsonb,$31,$32,$33,$34,$35,$36)
 		 RETURNING id`,
 		aircraftID, pageID,
 		entry.EntryType,
@@ -692,28 +1534,30 @@ func (h *Handler) saveEntry(ctx context.Context, aircraftID, pageID string, entr
 		entry.NeedsReview,
 		missingData,
 		extractionNotes,
+		reviewStatus,
+		reviewedBy,
+		reviewedAt,
+		sliceKey,
+		sliceY0,
+		sliceY1,
+		qaVerdict,
+		entry.QARetries,
+		entry.ModelConfidence,
+		uncertainFields,
+		source,
+		entry.AircraftSerial,
+		entry.AircraftMake,
+		entry.AircraftModel,
+		extractionModel,
+		version,
 	)
 	if err != nil {
 		return fmt.Errorf("insert entry: %w", err)
 	}
 
 	// Parts actions
-	for _, part := range entry.PartsActions {
-		action := part.Action
-		if action == "" {
-			action = "installed"
-		}
-		if !validActionTypes[action] {
-			if mapped, ok := actionTypeMap[action]; ok {
-				action = mapped
-			} else {
-				action = "installed"
-			}
-		}
-		quantity := part.Quantity
-		if quantity == nil {
-			quantity = 1
-		}
+	for i, part := range entry.PartsActions {
+		action := normalizePartAction(part.Action)
 		if err := h.db.Exec(ctx,
 			`INSERT INTO parts_actions
 			 (entry_id, action_type, part_name, part_number, serial_number,
@@ -722,24 +1566,27 @@ func (h *Handler) saveEntry(ctx context.Context, aircraftID, pageID string, entr
 			entryID, action,
 			part.PartName, part.PartNumber,
 			part.SerialNumber, part.OldPartNumber,
-			part.OldSerialNumber, quantity,
+			part.OldSerialNumber, quantities[i],
 			part.Notes,
 		); err != nil {
 			log.Printf("WARNING: insert parts action failed: %v", err)
 		}
+		if action == "installed" || action == "replaced" {
+			h.recordLifeLimitedPart(ctx, aircraftID, entryID, entry, part)
+		}
 	}
 
 	// AD compliance
-	for _, ad := range entry.ADCompliance {
+	for i, ad := range entry.ADCompliance {
 		method := ad.Method
 		if method != "" && !validComplianceMethods[method] {
 			method = "other"
 		}
 		if err := h.db.Exec(ctx,
 			`INSERT INTO ad_compliance
-			 (entry_id, aircraft_id, ad_number, compliance_date, compliance_method, notes)
-			 VALUES ($1,$2,$3,$4,$5,$6)`,
-			entryID, aircraftID, ad.ADNumber,
+			 (entry_id, aircraft_id, ad_number, ad_number_raw, compliance_date, compliance_method, notes)
+			 VALUES ($1,$2,$3,$4,$5,$6,$7)`,
+			entryID, aircraftID, adNumbers[i], ad.ADNumber,
 			entry.Date, method, ad.Notes,
 		); err != nil {
 			log.Printf("WARNING: insert ad compliance failed: %v", err)
@@ -748,26 +1595,54 @@ func (h *Handler) saveEntry(ctx context.Context, aircraftID, pageID string, entr
 
 	// Inspection record
 	if entry.InspectionType != "" {
-		if !validInspectionTypes[entry.InspectionType] {
+		if !models.ValidInspectionTypes[entry.InspectionType] {
 			entry.InspectionType = "other"
 		}
+		nextDueDate, nextDueHours := nextInspectionDue(entry.InspectionType, entry.Date, entry.FlightTime)
 		if err := h.db.Exec(ctx,
 			`INSERT INTO inspection_records
 			 (aircraft_id, entry_id, inspection_type, inspection_date,
-			  aircraft_hours, far_reference, inspector_name, inspector_certificate)
-			 VALUES ($1,$2,$3,$4,$5,$6,$7,$8)`,
+			  aircraft_hours, far_reference, inspector_name, inspector_certificate,
+			  next_due_date, next_due_hours)
+			 VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)`,
 			aircraftID, entryID, entry.InspectionType,
 			entry.Date, entry.FlightTime,
 			entry.FARReference, entry.MechanicName,
 			entry.MechanicCertificate,
+			nextDueDate, nextDueHours,
 		); err != nil {
 			log.Printf("WARNING: insert inspection record failed: %v", err)
 		}
 	}
 
+	// Weight and balance revision
+	if wb := entry.WeightBalance; wb != nil {
+		emptyWeight, emptyCG, usefulLoad := parseWeightBalanceNumber(wb.EmptyWeight),
+			parseWeightBalanceNumber(wb.EmptyCG), parseWeightBalanceNumber(wb.UsefulLoad)
+		if emptyWeight != nil || emptyCG != nil || usefulLoad != nil {
+			if err := h.db.Exec(ctx,
+				`INSERT INTO weight_balance_revisions
+				 (aircraft_id, entry_id, revision_date, empty_weight, empty_cg,
+				  useful_load, equipment_changes, notes)
+				 VALUES ($1,$2,$3,$4,$5,$6,$7,$8)`,
+				aircraftID, entryID, entry.Date,
+				emptyWeight, emptyCG, usefulLoad,
+				wb.EquipmentChanges, wb.Notes,
+			); err != nil {
+				log.Printf("WARNING: insert weight and balance revision failed: %v", err)
+			}
+		}
+	}
+
+	h.supersedePriorEntries(ctx, aircraftID, pageID, entryID, entry)
+
 	// Generate embedding
-	if len(entry.MaintenanceNarrative) > 10 {
-		if err := h.generateEmbedding(ctx, entryID, entry.MaintenanceNarrative); err != nil {
+	if len(entry.MaintenanceNarrative) > 10 && !h.vectorUnavailable {
+		err := h.generateEmbedding(ctx, entryID, entry.MaintenanceNarrative)
+		if db.IsVectorUnavailable(err) {
+			h.vectorUnavailable = true
+			log.Printf("WARNING: skipping embeddings, entries will not be searchable: %v (%v)", db.ErrVectorUnavailable, err)
+		} else if err != nil {
 			log.Printf("WARNING: embedding generation failed for entry %s: %v", entryID, err)
 		}
 	}
@@ -775,23 +1650,218 @@ func (h *Handler) saveEntry(ctx context.Context, aircraftID, pageID string, entr
 	return nil
 }
 
+// nextInspectionDue computes when an inspection next falls due, by its
+// models.InspectionRules interval. Calendar months run to the end of the
+// month, so an annual signed off on 2024-03-15 is due by 2025-03-31. Either
+// result is nil when the type has no interval of that kind or the date or
+// hours reading is missing.
+func nextInspectionDue(inspectionType, date string, hours any) (dueDate, dueHours any) {
+	rule := models.InspectionRules[inspectionType]
+	if months := rule.Months; months > 0 {
+		if t, err := time.Parse("2006-01-02", date); err == nil {
+			// Day 0 of the month after the due month is its last day.
+			dueDate = time.Date(t.Year(), t.Month()+time.Month(months)+1, 0, 0, 0, 0, 0, time.UTC).Format("2006-01-02")
+		}
+	}
+	if interval := rule.Hours; interval > 0 {
+		if h, ok := toFloat64(hours); ok {
+			dueHours = h + interval
+		}
+	}
+	return dueDate, dueHours
+}
+
+// lifeLimitPattern matches a life limit written as "life limit 2000 hrs" or
+// "2000 hr life limit".
+var lifeLimitPattern = regexp.MustCompile(`(?i)life[\s-]*limit(?:ed)?(?:\s+(?:of|is))?\s*:?\s*(\d[\d,]*(?:\.\d+)?)\s*(hours?|hrs?|months?|mos?|years?|yrs?)\b|(\d[\d,]*(?:\.\d+)?)\s*(hours?|hrs?|months?|mos?|years?|yrs?)\.?\s+life[\s-]*limit`)
+
+// parseLifeLimit finds a life limit in free text, returning hours or months
+// (years are converted); both are nil when none is stated.
+func parseLifeLimit(text string) (hours, months any) {
+	m := lifeLimitPattern.FindStringSubmatch(text)
+	if m == nil {
+		return nil, nil
+	}
+	num, unit := m[1], m[2]
+	if num == "" {
+		num, unit = m[3], m[4]
+	}
+	n, err := strconv.ParseFloat(strings.ReplaceAll(num, ",", ""), 64)
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+	switch unit = strings.ToLower(unit); {
+	case strings.HasPrefix(unit, "h"):
+		return n, nil
+	case strings.HasPrefix(unit, "y"):
+		return nil, int(n * 12)
+	default:
+		return nil, int(n)
+	}
+}
+
+// partLifeLimit resolves an installed part's life limit from the structured
+// fields, then the part's notes, then the entry narrative. The narrative is
+// only trusted when the entry installs a single part, since otherwise the
+// limit can't be tied to one of them.
+func partLifeLimit(entry *extractedEntry, part partsActionRec) (hours, months any) {
+	if h, ok := toFloat64(part.LifeLimitHours); ok && h > 0 {
+		hours = h
+	}
+	if m, ok := toFloat64(part.LifeLimitMonths); ok && m > 0 {
+		months = int(m)
+	}
+	if hours != nil || months != nil {
+		return hours, months
+	}
+	if hours, months = parseLifeLimit(part.Notes); hours != nil || months != nil {
+		return hours, months
+	}
+	installs := 0
+	for _, p := range entry.PartsActions {
+		if a := normalizePartAction(p.Action); a == "installed" || a == "replaced" {
+			installs++
+		}
+	}
+	if installs == 1 {
+		return parseLifeLimit(entry.MaintenanceNarrative)
+	}
+	return nil, nil
+}
+
+// recordLifeLimitedPart tracks an installed part that has a life limit:
+// earlier active rows for the same part name are marked removed by this
+// entry, and a new active row is added. Re-saving the same install does not
+// add a duplicate. Failures are logged, not returned, like the other child
+// records of an entry.
+func (h *Handler) recordLifeLimitedPart(ctx context.Context, aircraftID, entryID string, entry *extractedEntry, part partsActionRec) {
+	hours, months := partLifeLimit(entry, part)
+	if (hours == nil && months == nil) || strings.TrimSpace(part.PartName) == "" {
+		return
+	}
+
+	var expiration any
+	if m, ok := months.(int); ok {
+		if t, err := time.Parse("2006-01-02", entry.Date); err == nil {
+			expiration = t.AddDate(0, m, 0).Format("2006-01-02")
+		}
+	}
+	var installHours any
+	if f, ok := toFloat64(entry.FlightTime); ok {
+		installHours = f
+	}
+	var serial, oldSerial any
+	if part.SerialNumber != "" {
+		serial = part.SerialNumber
+	}
+	if part.OldSerialNumber != "" {
+		oldSerial = part.OldSerialNumber
+	}
+
+	// Rows installed on or after this date are this install (or a later
+	// one) and stay active.
+	if err := h.db.Exec(ctx,
+		`UPDATE life_limited_parts
+		 SET is_active = FALSE, removal_date = $1, removal_entry_id = $2, updated_at = NOW()
+		 WHERE aircraft_id = $3 AND is_active = TRUE AND LOWER(part_name) = LOWER($4)
+		   AND (install_date IS NULL OR install_date < $1)
+		   AND ($5::text IS NULL OR serial_number = $5)`,
+		entry.Date, entryID, aircraftID, part.PartName, oldSerial,
+	); err != nil {
+		log.Printf("WARNING: deactivate replaced life-limited part failed: %v", err)
+	}
+
+	if err := h.db.Exec(ctx,
+		`INSERT INTO life_limited_parts
+		 (aircraft_id, part_name, part_number, serial_number, install_date,
+		  install_hours, life_limit_hours, life_limit_months, expiration_date)
+		 SELECT $1::uuid, $2, $3, $4, $5::date, $6::numeric, $7::numeric, $8::int, $9::date
+		 WHERE NOT EXISTS (
+		   SELECT 1 FROM life_limited_parts
+		   WHERE aircraft_id = $1 AND LOWER(part_name) = LOWER($2)
+		     AND serial_number IS NOT DISTINCT FROM $4 AND install_date = $5)`,
+		aircraftID, part.PartName, part.PartNumber, serial, entry.Date,
+		installHours, hours, months, expiration,
+	); err != nil {
+		log.Printf("WARNING: insert life-limited part failed: %v", err)
+	}
+}
+
+// weightBalanceKeywords match narratives that record a weight-and-balance revision.
+var weightBalanceKeywords = regexp.MustCompile(`(?i)\bw\s*(&|and)\s*b\b|weight\s*(&|and)\s*balance|empty\s+weight|useful\s+load|empty\s+c\.?\s?g\b`)
+
+// isWeightBalanceEntry reports whether an entry should get the dedicated W&B
+// extraction pass, either because the slice was classified as a W&B page or
+// because its narrative mentions weight and balance.
+func isWeightBalanceEntry(entry *extractedEntry, pageType string) bool {
+	if entry.WeightBalance != nil {
+		return false
+	}
+	return pageType == "weight_balance" || weightBalanceKeywords.MatchString(entry.MaintenanceNarrative)
+}
+
+// extractWeightBalance runs the W&B prompt against a slice image.
+func (h *Handler) extractWeightBalance(ctx context.Context, geminiClient gemini.Client, imageData []byte, mimeType string) (*weightBalanceRec, error) {
+	responseText, err := geminiClient.GenerateContent(ctx, extractionModel, []gemini.Part{
+		{Text: WeightBalancePrompt},
+		{Data: imageData, MIMEType: mimeType},
+	}, h.extractionConfig())
+	if err != nil {
+		return nil, fmt.Errorf("gemini W&B extraction: %w", err)
+	}
+
+	var wb weightBalanceRec
+	if err := json.Unmarshal([]byte(cleanMarkdownFences(responseText)), &wb); err != nil {
+		return nil, fmt.Errorf("parse W&B extraction: %w", err)
+	}
+	return &wb, nil
+}
+
+var leadingNumber = regexp.MustCompile(`-?\d+(\.\d+)?`)
+
+// parseWeightBalanceNumber converts an extracted W&B figure to a float,
+// tolerating thousands separators and trailing units. Returns nil when absent
+// or unparseable.
+func parseWeightBalanceNumber(v any) any {
+	if s, ok := v.(string); ok {
+		v = leadingNumber.FindString(strings.ReplaceAll(s, ",", ""))
+	}
+	f, ok := toFloat64(v)
+	if !ok {
+		return nil
+	}
+	return f
+}
+
+// shouldAutoApprove reports whether an entry can skip the review queue: auto
+// approval must be enabled, QA must have passed the entry, nothing may have
+// flagged it for review, and its confidence must exceed the threshold.
+func (h *Handler) shouldAutoApprove(entry *extractedEntry) bool {
+	if h.autoApproveThreshold <= 0 || !entry.QAPassed || entry.NeedsReview {
+		return false
+	}
+	confidence, ok := toFloat64(entry.Confidence)
+	return ok && confidence > h.autoApproveThreshold
+}
+
 func (h *Handler) generateEmbedding(ctx context.Context, entryID, text string) error {
 	geminiClient, err := h.getGeminiClient(ctx)
 	if err != nil {
 		return err
 	}
 
-	embedding, err := geminiClient.EmbedContent(ctx, "gemini-embedding-001", text)
+	embedding, err := h.embedding.Embed(ctx, geminiClient, text)
 	if err != nil {
 		return fmt.Errorf("embed content: %w", err)
 	}
 
-	embeddingStr := formatEmbedding(embedding)
+	embeddingStr := gemini.FormatEmbedding(embedding)
 	return h.db.Exec(ctx,
-		`INSERT INTO maintenance_embeddings (entry_id, embedding, chunk_text, chunk_type)
-		 VALUES ($1, $2::halfvec, $3, 'narrative')
-		 ON CONFLICT (entry_id, chunk_type) DO UPDATE SET embedding = EXCLUDED.embedding, chunk_text = EXCLUDED.chunk_text`,
-		entryID, embeddingStr, text)
+		`INSERT INTO maintenance_embeddings (entry_id, embedding, chunk_text, chunk_type, model)
+		 VALUES ($1, $2::halfvec, $3, 'narrative', $4)
+		 ON CONFLICT (entry_id, chunk_type) DO UPDATE
+		 SET embedding = EXCLUDED.embedding, chunk_text = EXCLUDED.chunk_text, model = EXCLUDED.model`,
+		entryID, embeddingStr, text, h.embedding.ModelName())
 }
 
 // ─── Identity Checks ────────────────────────────────────────────────────────
@@ -803,56 +1873,17 @@ type expectedIdentity struct {
 	model        string
 }
 
-func normalize(s string) string {
-	s = strings.ToUpper(strings.TrimSpace(s))
-	s = strings.ReplaceAll(s, "-", "")
-	s = strings.ReplaceAll(s, " ", "")
-	return s
-}
-
-func fuzzyMatch(extracted, expected string) bool {
-	a := normalize(extracted)
-	b := normalize(expected)
-	return strings.Contains(a, b) || strings.Contains(b, a)
-}
-
 func checkAircraftIdentity(entry *extractedEntry, expected expectedIdentity) {
-	if expected.serialNumber == "" {
-		return // No FAA data to compare against
-	}
-	if entry.AircraftSerial == "" {
-		return // Gemini didn't extract a serial
-	}
-
-	serialMatch := normalize(entry.AircraftSerial) == normalize(expected.serialNumber)
-
-	makeMatch := true
-	modelMatch := true
-	if entry.AircraftMake != "" && expected.make != "" {
-		makeMatch = fuzzyMatch(entry.AircraftMake, expected.make)
-	}
-	if entry.AircraftModel != "" && expected.model != "" {
-		modelMatch = fuzzyMatch(entry.AircraftModel, expected.model)
-	}
-
-	if !serialMatch || (!makeMatch && !modelMatch) {
-		var reasons []string
-		if !serialMatch {
-			reasons = append(reasons, fmt.Sprintf("serial %q != %q", entry.AircraftSerial, expected.serialNumber))
-		}
-		if !makeMatch {
-			reasons = append(reasons, fmt.Sprintf("make %q !~ %q", entry.AircraftMake, expected.make))
-		}
-		if !modelMatch {
-			reasons = append(reasons, fmt.Sprintf("model %q !~ %q", entry.AircraftModel, expected.model))
-		}
-
-		entry.NeedsReview = true
-		note := fmt.Sprintf("Aircraft identity mismatch: %s", strings.Join(reasons, ", "))
-		entry.ExtractionNotes += note
-		entry.MissingData = append(entry.MissingData, "aircraft_identity_mismatch")
-		log.Printf("  WARNING: %s", note)
+	note := identity.Mismatch(
+		identity.Aircraft{SerialNumber: entry.AircraftSerial, Make: entry.AircraftMake, Model: entry.AircraftModel},
+		identity.Aircraft{SerialNumber: expected.serialNumber, Make: expected.make, Model: expected.model})
+	if note == "" {
+		return
 	}
+	entry.NeedsReview = true
+	entry.ExtractionNotes += note
+	entry.MissingData = append(entry.MissingData, identity.MismatchTag)
+	log.Printf("  WARNING: %s", note)
 }
 
 // ─── Helpers ────────────────────────────────────────────────────────────────
@@ -871,19 +1902,6 @@ func cleanMarkdownFences(s string) string {
 	return strings.TrimSpace(s)
 }
 
-func formatEmbedding(embedding []float32) string {
-	var b strings.Builder
-	b.WriteByte('[')
-	for i, v := range embedding {
-		if i > 0 {
-			b.WriteByte(',')
-		}
-		fmt.Fprintf(&b, "%g", v)
-	}
-	b.WriteByte(']')
-	return b.String()
-}
-
 func strVal(v any) string {
 	if v == nil {
 		return ""
@@ -906,6 +1924,24 @@ func toInt64(v any) (int64, bool) {
 	}
 }
 
+func toFloat64(v any) (float64, bool) {
+	switch val := v.(type) {
+	case float64:
+		return val, true
+	case float32:
+		return float64(val), true
+	case int:
+		return float64(val), true
+	case int64:
+		return float64(val), true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
 func mustEnv(key string) string {
 	return os.Getenv(key)
 }
@@ -4,22 +4,39 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"image"
 	"image/color"
 	"image/draw"
 	"image/jpeg"
+	"image/png"
 	"io"
+	"log"
+	"math"
+	"net/http"
 	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 
 	"github.com/projectcloudline/logbook-service/internal/anthropic"
 	"github.com/projectcloudline/logbook-service/internal/gemini"
+	"github.com/projectcloudline/logbook-service/internal/imageutil"
+	"github.com/projectcloudline/logbook-service/internal/models"
+	"github.com/projectcloudline/logbook-service/internal/qa"
+	"github.com/projectcloudline/logbook-service/internal/rawextraction"
+	"github.com/projectcloudline/logbook-service/internal/slicer"
+	"github.com/projectcloudline/logbook-service/internal/webhook"
 )
 
 // ─── Mock DB ────────────────────────────────────────────────────────────────
@@ -51,6 +68,8 @@ func (m *mockDB) Exec(ctx context.Context, sql string, args ...any) error {
 	return nil
 }
 
+func (m *mockDB) Ping(ctx context.Context) error { return nil }
+
 func (m *mockDB) Pool() *pgxpool.Pool { return nil }
 
 // ─── Mock S3 ────────────────────────────────────────────────────────────────
@@ -58,11 +77,15 @@ func (m *mockDB) Pool() *pgxpool.Pool { return nil }
 type putObjectCall struct {
 	key         string
 	contentType string
+	data        []byte
 }
 
 type mockS3 struct {
 	getObjectFn func(ctx context.Context, bucket, key string) (io.ReadCloser, error)
 	putCalls    []putObjectCall
+	// objects maps keys to sizes; PutObject adds to it and HeadObject reads it.
+	objects map[string]int64
+	headErr error
 }
 
 func (m *mockS3) PresignPutObject(ctx context.Context, bucket, key, contentType string, expires time.Duration) (string, error) {
@@ -81,7 +104,28 @@ func (m *mockS3) GetObject(ctx context.Context, bucket, key string) (io.ReadClos
 }
 
 func (m *mockS3) PutObject(ctx context.Context, bucket, key, contentType string, body io.Reader) error {
-	m.putCalls = append(m.putCalls, putObjectCall{key: key, contentType: contentType})
+	data, _ := io.ReadAll(body)
+	m.putCalls = append(m.putCalls, putObjectCall{key: key, contentType: contentType, data: data})
+	if m.objects == nil {
+		m.objects = make(map[string]int64)
+	}
+	m.objects[key] = int64(len(data))
+	return nil
+}
+
+func (m *mockS3) HeadObject(ctx context.Context, bucket, key string) (bool, int64, error) {
+	if m.headErr != nil {
+		return false, 0, m.headErr
+	}
+	size, ok := m.objects[key]
+	return ok, size, nil
+}
+
+func (m *mockS3) ListObjects(ctx context.Context, bucket, prefix string) ([]string, error) {
+	return nil, nil
+}
+
+func (m *mockS3) DeleteObject(ctx context.Context, bucket, key string) error {
 	return nil
 }
 
@@ -381,7 +425,7 @@ func TestProcessPage(t *testing.T) {
 				return `{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","entryType":"maintenance","maintenanceNarrative":"Changed oil and filter","confidence":0.95}]}`, nil
 			},
 			EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
-				return make([]float32, 768), nil
+				return make([]float32, gemini.DefaultEmbeddingDimensions), nil
 			},
 		},
 		secrets: &mockSecrets{},
@@ -514,49 +558,6 @@ func TestHandle_ProcessPageError(t *testing.T) {
 	}
 }
 
-// ─── Tests: Normalize/Fuzzy ─────────────────────────────────────────────────
-
-func TestNormalize(t *testing.T) {
-	tests := []struct {
-		in   string
-		want string
-	}{
-		{"N-123AB", "N123AB"},
-		{"cessna 172", "CESSNA172"},
-		{"  hello  ", "HELLO"},
-	}
-	for _, tt := range tests {
-		got := normalize(tt.in)
-		if got != tt.want {
-			t.Errorf("normalize(%q) = %q, want %q", tt.in, got, tt.want)
-		}
-	}
-}
-
-func TestFuzzyMatch(t *testing.T) {
-	tests := []struct {
-		a, b string
-		want bool
-	}{
-		{"Cessna", "CESSNA", true},
-		{"172N", "172", true},
-		{"Piper", "Cessna", false},
-	}
-	for _, tt := range tests {
-		got := fuzzyMatch(tt.a, tt.b)
-		if got != tt.want {
-			t.Errorf("fuzzyMatch(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
-		}
-	}
-}
-
-func TestFormatEmbedding(t *testing.T) {
-	result := formatEmbedding([]float32{0.1, 0.2, 0.3})
-	if result != "[0.1,0.2,0.3]" {
-		t.Errorf("got %q, want %q", result, "[0.1,0.2,0.3]")
-	}
-}
-
 // ─── Tests: SaveEntry ────────────────────────────────────────────────────
 
 func TestSaveEntry(t *testing.T) {
@@ -667,7 +668,7 @@ func TestSaveEntry(t *testing.T) {
 				db: db,
 				gemini: &gemini.MockClient{
 					EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
-						return make([]float32, 768), nil
+						return make([]float32, gemini.DefaultEmbeddingDimensions), nil
 					},
 				},
 			}
@@ -706,84 +707,262 @@ func TestSaveEntry(t *testing.T) {
 
 // ─── Tests: CheckBatchCompletion ─────────────────────────────────────────
 
+// fakeBatch stands in for a batch row and its pages under the completion
+// UPDATE. The mutex plays the row lock, so concurrent calls see each other's
+// writes the way Postgres re-checks a locked row's WHERE clause.
+type fakeBatch struct {
+	mu                  sync.Mutex
+	status              string
+	callbackURL         any
+	total, done, failed int64
+	queries             int
+	writes              []string
+	// splitError is split_incomplete, set when split lost pages.
+	splitError bool
+}
+
+func (f *fakeBatch) query(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queries++
+	if !strings.Contains(sql, "UPDATE upload_batches") {
+		return nil, fmt.Errorf("unexpected query: %s", sql)
+	}
+	guarded := strings.Contains(sql, "processing_status NOT IN ('completed', 'completed_with_errors', 'failed', 'expired')")
+	if guarded && (f.status == "completed" || f.status == "completed_with_errors" || f.status == "failed" || f.status == "expired") {
+		return nil, nil
+	}
+	if f.total == 0 || f.done+f.failed != f.total {
+		return nil, nil
+	}
+	switch {
+	case f.failed == 0 && (!f.splitError || !strings.Contains(sql, "NOT ub.split_incomplete")):
+		f.status = "completed"
+	case f.failed == 0:
+		f.status = "completed_with_errors"
+	case f.done == 0:
+		f.status = "failed"
+	default:
+		f.status = "completed_with_errors"
+	}
+	f.writes = append(f.writes, f.status)
+	return []map[string]any{{
+		"processing_status": f.status,
+		"callback_url":      f.callbackURL,
+		"total":             f.total,
+		"done":              f.done,
+		"failed":            f.failed,
+	}}, nil
+}
+
 func TestCheckBatchCompletion(t *testing.T) {
 	tests := []struct {
-		name           string
-		total          int64
-		done           int64
-		failed         int64
-		wantStatus     string
-		wantExecCalled bool
+		name       string
+		status     string
+		total      int64
+		done       int64
+		failed     int64
+		splitError bool
+		wantStatus string
 	}{
-		{
-			name:           "all completed - no failures",
-			total:          5,
-			done:           5,
-			failed:         0,
-			wantStatus:     "completed",
-			wantExecCalled: true,
-		},
-		{
-			name:           "all failed",
-			total:          3,
-			done:           0,
-			failed:         3,
-			wantStatus:     "failed",
-			wantExecCalled: true,
-		},
-		{
-			name:           "mixed success and failure",
-			total:          10,
-			done:           7,
-			failed:         3,
-			wantStatus:     "completed_with_errors",
-			wantExecCalled: true,
-		},
-		{
-			name:           "still processing - not all done",
-			total:          5,
-			done:           3,
-			failed:         0,
-			wantExecCalled: false,
-		},
+		{name: "all completed - no failures", total: 5, done: 5, wantStatus: "completed"},
+		{name: "split stopped early", total: 5, done: 5, splitError: true, wantStatus: "completed_with_errors"},
+		{name: "all failed", total: 3, failed: 3, wantStatus: "failed"},
+		{name: "mixed success and failure", total: 10, done: 7, failed: 3, wantStatus: "completed_with_errors"},
+		{name: "still processing - not all done", total: 5, done: 3},
+		{name: "no pages", total: 0},
+		{name: "late page after completion", status: "completed", total: 4, done: 3, failed: 1},
+		{name: "expired batch", status: "expired", total: 2, done: 2},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			execCalled := false
-			var capturedStatus string
+			status := tt.status
+			if status == "" {
+				status = "processing"
+			}
+			batch := &fakeBatch{status: status, total: tt.total, done: tt.done, failed: tt.failed, splitError: tt.splitError}
+			pub := &mockPublisher{}
+			h := &Handler{db: &mockDB{queryFn: batch.query}, publisher: pub}
 
-			db := &mockDB{
-				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
-					return []map[string]any{{
-						"total":  tt.total,
-						"done":   tt.done,
-						"failed": tt.failed,
-					}}, nil
-				},
-				execFn: func(ctx context.Context, sql string, args ...any) error {
-					execCalled = true
-					if strings.Contains(sql, "UPDATE upload_batches") {
-						capturedStatus = fmt.Sprintf("%v", args[0])
-					}
-					return nil
-				},
+			h.checkBatchCompletion(context.Background(), "batch-1")
+
+			if batch.queries != 1 {
+				t.Errorf("queries = %d, want a single statement", batch.queries)
+			}
+			if tt.wantStatus == "" {
+				if len(batch.writes) != 0 || len(pub.events) != 0 {
+					t.Errorf("writes = %v, events = %d; want none", batch.writes, len(pub.events))
+				}
+				if tt.status != "" && batch.status != tt.status {
+					t.Errorf("status = %q, want %q left alone", batch.status, tt.status)
+				}
+				return
+			}
+			if len(batch.writes) != 1 || batch.writes[0] != tt.wantStatus {
+				t.Errorf("writes = %v, want [%s]", batch.writes, tt.wantStatus)
+			}
+			if c, ok := pub.events[0].(batchCompletion); !ok || c.Status != tt.wantStatus || c.TotalPages != tt.total {
+				t.Errorf("event = %+v", pub.events[0])
 			}
+		})
+	}
+}
 
-			h := &Handler{db: db}
+func TestCheckBatchCompletion_Concurrent(t *testing.T) {
+	// Every page has finished and each analyze invocation checks at once.
+	batch := &fakeBatch{status: "processing", total: 8, done: 7, failed: 1}
+	pub := &mockPublisher{}
+	h := &Handler{db: &mockDB{queryFn: batch.query}, publisher: pub}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
 			h.checkBatchCompletion(context.Background(), "batch-1")
+		}()
+	}
+	wg.Wait()
+
+	if len(batch.writes) != 1 {
+		t.Errorf("terminal writes = %v, want exactly one", batch.writes)
+	}
+	if len(pub.events) != 1 {
+		t.Errorf("published %d events, want exactly 1", len(pub.events))
+	}
+	if batch.status != "completed_with_errors" {
+		t.Errorf("status = %q", batch.status)
+	}
+}
+
+func TestCheckBatchCompletion_Webhook(t *testing.T) {
+	tests := []struct {
+		name        string
+		callbackURL any
+		// status is set when another page already completed the batch.
+		status    string
+		wantPosts int
+	}{
+		{name: "fires on completion", callbackURL: "https://hooks.example.com/logbook", wantPosts: 1},
+		{name: "no callback URL", callbackURL: nil},
+		{name: "status already set", callbackURL: "https://hooks.example.com/logbook", status: "completed_with_errors"},
+	}
 
-			if execCalled != tt.wantExecCalled {
-				t.Errorf("execCalled = %v, want %v", execCalled, tt.wantExecCalled)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := tt.status
+			if status == "" {
+				status = "processing"
 			}
+			batch := &fakeBatch{status: status, callbackURL: tt.callbackURL, total: 4, done: 3, failed: 1}
+			doer := &mockDoer{}
+			h := &Handler{db: &mockDB{queryFn: batch.query}, webhook: &webhook.Notifier{
+				Secrets:   &mockSecrets{secrets: map[string]string{"hook-secret": "s3cret"}},
+				SecretARN: "hook-secret",
+				HTTP:      doer,
+			}}
+
+			h.checkBatchCompletion(context.Background(), "batch-1")
 
-			if tt.wantExecCalled && capturedStatus != tt.wantStatus {
-				t.Errorf("status = %q, want %q", capturedStatus, tt.wantStatus)
+			if len(doer.requests) != tt.wantPosts {
+				t.Fatalf("posts = %d, want %d", len(doer.requests), tt.wantPosts)
+			}
+			if tt.wantPosts == 0 {
+				return
+			}
+			req := doer.requests[0]
+			if req.URL.String() != "https://hooks.example.com/logbook" || req.Method != "POST" {
+				t.Errorf("request = %s %s", req.Method, req.URL)
+			}
+			var payload map[string]any
+			if err := json.Unmarshal(doer.bodies[0], &payload); err != nil {
+				t.Fatalf("payload: %v", err)
+			}
+			for k, want := range map[string]any{
+				"event": "upload.completed", "uploadId": "batch-1", "status": "completed_with_errors",
+				"totalPages": 4.0, "completedPages": 3.0, "failedPages": 1.0,
+			} {
+				if payload[k] != want {
+					t.Errorf("payload[%s] = %v, want %v", k, payload[k], want)
+				}
+			}
+			if got, want := req.Header.Get(webhook.SignatureHeader), webhook.Sign([]byte("s3cret"), req.Header.Get(webhook.TimestampHeader), doer.bodies[0]); got != want {
+				t.Errorf("signature = %q, want %q", got, want)
 			}
 		})
 	}
 }
 
+func TestCheckBatchCompletion_PublishesEvent(t *testing.T) {
+	// Pages finish one at a time; the last page's check is repeated, as
+	// happens when two final pages complete together or a message is retried.
+	doneByCheck := []int64{1, 2, 3, 3}
+	batch := &fakeBatch{status: "processing", total: 3}
+	pub := &mockPublisher{}
+	h := &Handler{db: &mockDB{queryFn: batch.query}, publisher: pub}
+
+	for _, done := range doneByCheck {
+		batch.done = done
+		h.checkBatchCompletion(context.Background(), "batch-1")
+		if done < 3 && len(pub.events) != 0 {
+			t.Fatalf("published %d events after %d of 3 pages", len(pub.events), done)
+		}
+	}
+
+	if len(pub.events) != 1 {
+		t.Fatalf("published %d events, want exactly 1", len(pub.events))
+	}
+	if pub.types[0] != "batch.completed" {
+		t.Errorf("event type = %q", pub.types[0])
+	}
+	c, ok := pub.events[0].(batchCompletion)
+	if !ok || c.UploadID != "batch-1" || c.Status != "completed" || c.TotalPages != 3 || c.CompletedPages != 3 {
+		t.Errorf("event detail = %+v", pub.events[0])
+	}
+}
+
+func TestCheckBatchCompletion_PublishErrorIsNonFatal(t *testing.T) {
+	batch := &fakeBatch{status: "processing", total: 1, failed: 1}
+	pub := &mockPublisher{err: errors.New("queue unavailable")}
+	h := &Handler{db: &mockDB{queryFn: batch.query}, publisher: pub}
+
+	// Should log and return, not panic.
+	h.checkBatchCompletion(context.Background(), "batch-1")
+	if len(pub.events) != 1 {
+		t.Errorf("publish attempts = %d, want 1", len(pub.events))
+	}
+}
+
+// mockPublisher records published events.
+type mockPublisher struct {
+	mu     sync.Mutex
+	types  []string
+	events []any
+	err    error
+}
+
+func (m *mockPublisher) Publish(ctx context.Context, eventType string, detail any) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.types = append(m.types, eventType)
+	m.events = append(m.events, detail)
+	return m.err
+}
+
+// mockDoer records webhook requests and answers 200.
+type mockDoer struct {
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (m *mockDoer) Do(req *http.Request) (*http.Response, error) {
+	body, _ := io.ReadAll(req.Body)
+	m.requests = append(m.requests, req)
+	m.bodies = append(m.bodies, body)
+	return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(""))}, nil
+}
+
 // ─── Tests: ProcessPage Error Paths ──────────────────────────────────────
 
 func TestProcessPage_Errors(t *testing.T) {
@@ -1000,7 +1179,7 @@ func TestSaveEntry_PartsActionNormalization(t *testing.T) {
 				db: db,
 				gemini: &gemini.MockClient{
 					EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
-						return make([]float32, 768), nil
+						return make([]float32, gemini.DefaultEmbeddingDimensions), nil
 					},
 				},
 			}
@@ -1029,6 +1208,120 @@ func TestSaveEntry_PartsActionNormalization(t *testing.T) {
 	}
 }
 
+func TestParseLifeLimit(t *testing.T) {
+	tests := []struct {
+		text       string
+		wantHours  any
+		wantMonths any
+	}{
+		{"Installed new vacuum pump, life limit 500 hrs", 500.0, nil},
+		{"Life-limit: 2,000 hours", 2000.0, nil},
+		{"R/R ELT battery, 24 month life limit", nil, 24},
+		{"Installed fire extinguisher bottle. Life limit of 12 years.", nil, 144},
+		{"Changed oil and filter", nil, nil},
+		{"Life limit unknown", nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			hours, months := parseLifeLimit(tt.text)
+			if hours != tt.wantHours || months != tt.wantMonths {
+				t.Errorf("parseLifeLimit = %v, %v; want %v, %v", hours, months, tt.wantHours, tt.wantMonths)
+			}
+		})
+	}
+}
+
+func TestSaveEntry_LifeLimitedParts(t *testing.T) {
+	tests := []struct {
+		name           string
+		narrative      string
+		parts          []partsActionRec
+		wantInsert     []any
+		wantDeactivate []any
+	}{
+		{
+			name:      "install from structured limit",
+			narrative: "Installed new ELT battery",
+			parts: []partsActionRec{{Action: "installed", PartName: "ELT battery", PartNumber: "452-0133",
+				SerialNumber: "B123", LifeLimitMonths: 24.0}},
+			wantInsert:     []any{"aircraft-1", "ELT battery", "452-0133", "B123", "2024-01-15", 1234.5, nil, 24, "2026-01-15"},
+			wantDeactivate: []any{"2024-01-15", "entry-id-1", "aircraft-1", "ELT battery", nil},
+		},
+		{
+			name:      "replacement with limit in narrative",
+			narrative: "Replaced vacuum pump, life limit 500 hrs",
+			parts: []partsActionRec{{Action: "replaced", PartName: "Vacuum pump", PartNumber: "215CC",
+				SerialNumber: "V2", OldSerialNumber: "V1"}},
+			wantInsert:     []any{"aircraft-1", "Vacuum pump", "215CC", "V2", "2024-01-15", 1234.5, 500.0, nil, nil},
+			wantDeactivate: []any{"2024-01-15", "entry-id-1", "aircraft-1", "Vacuum pump", "V1"},
+		},
+		{
+			name:      "narrative limit ambiguous across several installs",
+			narrative: "Installed vacuum pump and filter, life limit 500 hrs",
+			parts:     []partsActionRec{{Action: "installed", PartName: "Vacuum pump"}, {Action: "installed", PartName: "Filter"}},
+		},
+		{
+			name:      "no life limit",
+			narrative: "Installed new spark plugs",
+			parts:     []partsActionRec{{Action: "installed", PartName: "Spark plug"}},
+		},
+		{
+			name:      "removal only",
+			narrative: "Removed vacuum pump, life limit 500 hrs",
+			parts:     []partsActionRec{{Action: "removed", PartName: "Vacuum pump"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var inserts, deactivations [][]any
+			db := &mockDB{
+				insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+					return "entry-id-1", nil
+				},
+				execFn: func(ctx context.Context, sql string, args ...any) error {
+					switch {
+					case strings.Contains(sql, "INSERT INTO life_limited_parts"):
+						inserts = append(inserts, args)
+					case strings.Contains(sql, "UPDATE life_limited_parts"):
+						if !strings.Contains(sql, "is_active = FALSE") {
+							t.Errorf("replacement should deactivate the prior part: %s", sql)
+						}
+						deactivations = append(deactivations, args)
+					}
+					return nil
+				},
+			}
+			h := &Handler{db: db, gemini: &gemini.MockClient{}}
+
+			entry := &extractedEntry{
+				Date:                 "2024-01-15",
+				EntryType:            "maintenance",
+				FlightTime:           1234.5,
+				MaintenanceNarrative: tt.narrative,
+				PartsActions:         tt.parts,
+			}
+			if err := h.saveEntry(context.Background(), "aircraft-1", "page-1", entry); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if tt.wantInsert == nil {
+				if len(inserts) != 0 || len(deactivations) != 0 {
+					t.Errorf("unexpected writes: inserts %v, deactivations %v", inserts, deactivations)
+				}
+				return
+			}
+			if len(inserts) != 1 || fmt.Sprint(inserts[0]) != fmt.Sprint(tt.wantInsert) {
+				t.Errorf("inserts = %v, want %v", inserts, tt.wantInsert)
+			}
+			if len(deactivations) != 1 || fmt.Sprint(deactivations[0]) != fmt.Sprint(tt.wantDeactivate) {
+				t.Errorf("deactivations = %v, want %v", deactivations, tt.wantDeactivate)
+			}
+		})
+	}
+}
+
 func TestSaveEntry_ADComplianceMethodNormalization(t *testing.T) {
 	var capturedMethod string
 	db := &mockDB{
@@ -1037,7 +1330,7 @@ func TestSaveEntry_ADComplianceMethodNormalization(t *testing.T) {
 		},
 		execFn: func(ctx context.Context, sql string, args ...any) error {
 			if strings.Contains(sql, "ad_compliance") {
-				capturedMethod = fmt.Sprintf("%v", args[4])
+				capturedMethod = fmt.Sprintf("%v", args[5])
 			}
 			return nil
 		},
@@ -1047,7 +1340,7 @@ func TestSaveEntry_ADComplianceMethodNormalization(t *testing.T) {
 		db: db,
 		gemini: &gemini.MockClient{
 			EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
-				return make([]float32, 768), nil
+				return make([]float32, gemini.DefaultEmbeddingDimensions), nil
 			},
 		},
 	}
@@ -1146,6 +1439,62 @@ func TestGenerateEmbedding_Error(t *testing.T) {
 	}
 }
 
+func TestGenerateEmbedding_Config(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    gemini.EmbeddingConfig
+		returned  int
+		wantModel string
+		wantErr   bool
+	}{
+		{name: "defaults", returned: 3072, wantModel: "gemini-embedding-001"},
+		{name: "configured model and dimensions", config: gemini.EmbeddingConfig{Model: "text-embedding-005", Dimensions: 768},
+			returned: 768, wantModel: "text-embedding-005"},
+		{name: "dimension mismatch", config: gemini.EmbeddingConfig{Model: "text-embedding-005"},
+			returned: 768, wantModel: "text-embedding-005", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotModel string
+			inserted := false
+			h := &Handler{
+				db: &mockDB{execFn: func(ctx context.Context, sql string, args ...any) error {
+					inserted = strings.Contains(sql, "maintenance_embeddings")
+					return nil
+				}},
+				gemini: &gemini.MockClient{
+					EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
+						gotModel = model
+						return make([]float32, tt.returned), nil
+					},
+				},
+				embedding: tt.config,
+			}
+
+			err := h.generateEmbedding(context.Background(), "entry-123", "test narrative")
+			if gotModel != tt.wantModel {
+				t.Errorf("model = %q, want %q", gotModel, tt.wantModel)
+			}
+			if tt.wantErr {
+				if !errors.Is(err, gemini.ErrEmbeddingDimensions) {
+					t.Fatalf("err = %v, want ErrEmbeddingDimensions", err)
+				}
+				if inserted {
+					t.Error("a mismatched embedding must not be stored")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !inserted {
+				t.Error("embedding was not stored")
+			}
+		})
+	}
+}
+
 func TestProcessPage_UploadBatchNotFound(t *testing.T) {
 	db := &mockDB{
 		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
@@ -1202,7 +1551,7 @@ func TestSaveEntry_InspectionTypeNormalization(t *testing.T) {
 		db: db,
 		gemini: &gemini.MockClient{
 			EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
-				return make([]float32, 768), nil
+				return make([]float32, gemini.DefaultEmbeddingDimensions), nil
 			},
 		},
 	}
@@ -1224,6 +1573,67 @@ func TestSaveEntry_InspectionTypeNormalization(t *testing.T) {
 	}
 }
 
+func TestSaveEntry_InspectionNextDue(t *testing.T) {
+	tests := []struct {
+		name           string
+		inspectionType string
+		date           string
+		flightTime     any
+		wantDate       any
+		wantHours      any
+	}{
+		{name: "annual runs to end of 12th month", inspectionType: "annual", date: "2024-03-15", flightTime: 2450.3, wantDate: "2025-03-31"},
+		{name: "annual in December", inspectionType: "annual", date: "2024-12-01", wantDate: "2025-12-31"},
+		{name: "100hr with hours", inspectionType: "100hr", date: "2024-03-15", flightTime: 2450.5, wantHours: 2550.5},
+		{name: "100hr with hours as text", inspectionType: "100hr", date: "2024-03-15", flightTime: "1200", wantHours: 1300.0},
+		{name: "100hr without hours", inspectionType: "100hr", date: "2024-03-15"},
+		{name: "altimeter static check", inspectionType: "altimeter_static", date: "2024-02-10", wantDate: "2026-02-28"},
+		{name: "transponder check", inspectionType: "transponder", date: "2023-06-30", wantDate: "2025-06-30"},
+		{name: "ELT inspection", inspectionType: "elt", date: "2024-05-10", wantDate: "2025-05-31"},
+		{name: "no interval", inspectionType: "other", date: "2024-03-15", flightTime: 100.0},
+		{name: "unparseable date", inspectionType: "annual", date: "March 2024"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var inspectionArgs []any
+			db := &mockDB{
+				insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+					return "entry-id-1", nil
+				},
+				execFn: func(ctx context.Context, sql string, args ...any) error {
+					if strings.Contains(sql, "inspection_records") {
+						inspectionArgs = args
+					}
+					return nil
+				},
+			}
+			h := &Handler{db: db, gemini: &gemini.MockClient{}}
+
+			entry := &extractedEntry{
+				Date:                 tt.date,
+				EntryType:            "inspection",
+				InspectionType:       tt.inspectionType,
+				FlightTime:           tt.flightTime,
+				MaintenanceNarrative: "Inspected",
+			}
+			if err := h.saveEntry(context.Background(), "aircraft-1", "page-1", entry); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(inspectionArgs) != 10 {
+				t.Fatalf("inspection args = %v", inspectionArgs)
+			}
+			if inspectionArgs[8] != tt.wantDate {
+				t.Errorf("next_due_date = %v, want %v", inspectionArgs[8], tt.wantDate)
+			}
+			if inspectionArgs[9] != tt.wantHours {
+				t.Errorf("next_due_hours = %v, want %v", inspectionArgs[9], tt.wantHours)
+			}
+		})
+	}
+}
+
 func TestCheckBatchCompletion_QueryError(t *testing.T) {
 	db := &mockDB{
 		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
@@ -1276,6 +1686,40 @@ func TestProcessPage_DBUpdateError(t *testing.T) {
 	}
 }
 
+func TestProcessPage_SkipsFinishedPages(t *testing.T) {
+	for _, status := range []string{"completed", "skipped"} {
+		t.Run(status, func(t *testing.T) {
+			db := &mockDB{
+				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+					if strings.HasPrefix(sql, "SELECT extraction_status FROM upload_pages") && args[0] == "page-1" {
+						return []map[string]any{{"extraction_status": status}}, nil
+					}
+					t.Errorf("unexpected query: %s", sql)
+					return nil, nil
+				},
+				execFn: func(ctx context.Context, sql string, args ...any) error {
+					t.Errorf("finished page was written to: %s", sql)
+					return nil
+				},
+			}
+			s3 := &mockS3{getObjectFn: func(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+				t.Errorf("finished page was downloaded: %s", key)
+				return nil, fmt.Errorf("unexpected download")
+			}}
+			h := &Handler{db: db, s3: s3, bucket: "test-bucket"}
+
+			if err := h.processPage(context.Background(), pageMessage{
+				UploadID:   "batch-1",
+				PageID:     "page-1",
+				PageNumber: 1,
+				S3Key:      "pages/batch-1/page_0001.jpg",
+			}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
 func TestProcessPage_S3GetObjectError(t *testing.T) {
 	db := &mockDB{
 		execFn: func(ctx context.Context, sql string, args ...any) error {
@@ -1324,7 +1768,7 @@ func TestSaveEntry_MissingDataHandling(t *testing.T) {
 		db: db,
 		gemini: &gemini.MockClient{
 			EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
-				return make([]float32, 768), nil
+				return make([]float32, gemini.DefaultEmbeddingDimensions), nil
 			},
 		},
 	}
@@ -1342,21 +1786,157 @@ func TestSaveEntry_MissingDataHandling(t *testing.T) {
 	}
 }
 
-func TestSaveEntry_ShortNarrative(t *testing.T) {
-	insertCalled := false
-	db := &mockDB{
-		insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
-			insertCalled = true
-			return "entry-id-1", nil
-		},
-		execFn: func(ctx context.Context, sql string, args ...any) error {
-			return nil
-		},
+func TestSaveEntry_AutoApprove(t *testing.T) {
+	tests := []struct {
+		name       string
+		threshold  float64
+		confidence any
+		qaPassed   bool
+		wantStatus string
+	}{
+		{"above threshold QA passed", 0.9, 0.95, true, "approved"},
+		{"below threshold QA passed", 0.9, 0.85, true, "pending"},
+		{"above threshold QA not passed", 0.9, 0.95, false, "pending"},
+		{"disabled by default", 0, 0.99, true, "pending"},
 	}
 
-	h := &Handler{
-		db: db,
-		gemini: &gemini.MockClient{
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotStatus string
+			var gotReviewer any
+			db := &mockDB{
+				insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+					gotStatus, _ = args[20].(string)
+					gotReviewer = args[21]
+					return "entry-id-1", nil
+				},
+			}
+			h := &Handler{db: db, autoApproveThreshold: tt.threshold}
+
+			entry := &extractedEntry{
+				Date:                 "2024-01-15",
+				EntryType:            "maintenance",
+				MaintenanceNarrative: "Oil",
+				Confidence:           tt.confidence,
+				QAPassed:             tt.qaPassed,
+			}
+			if err := h.saveEntry(context.Background(), "aircraft-1", "page-1", entry); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if gotStatus != tt.wantStatus {
+				t.Errorf("review_status = %q, want %q", gotStatus, tt.wantStatus)
+			}
+			if tt.wantStatus == "approved" && gotReviewer != models.AutoApproveActor {
+				t.Errorf("reviewed_by = %v, want %q", gotReviewer, models.AutoApproveActor)
+			}
+			if tt.wantStatus == "pending" && gotReviewer != nil {
+				t.Errorf("reviewed_by = %v, want nil", gotReviewer)
+			}
+		})
+	}
+}
+
+func TestSaveEntry_SliceOrigin(t *testing.T) {
+	tests := []struct {
+		name    string
+		slice   *sliceOrigin
+		wantKey any
+		wantY0  any
+		wantY1  any
+	}{
+		{"no slice", nil, nil, nil, nil},
+		{"strip", &sliceOrigin{Key: "slices/b/page_0001/slice_002.jpg", Y0: 120, Y1: 340}, "slices/b/page_0001/slice_002.jpg", 120, 340},
+		{"full page fallback", &sliceOrigin{Key: "slices/b/page_0001/slice_000.jpg"}, "slices/b/page_0001/slice_000.jpg", nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotArgs []any
+			db := &mockDB{
+				insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+					gotArgs = args
+					return "entry-id-1", nil
+				},
+			}
+			h := &Handler{db: db}
+
+			entry := &extractedEntry{
+				Date:                 "2024-01-15",
+				EntryType:            "maintenance",
+				MaintenanceNarrative: "Oil",
+				Slice:                tt.slice,
+			}
+			if err := h.saveEntry(context.Background(), "aircraft-1", "page-1", entry); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if gotArgs[23] != tt.wantKey {
+				t.Errorf("slice_key = %v, want %v", gotArgs[23], tt.wantKey)
+			}
+			if gotArgs[24] != tt.wantY0 || gotArgs[25] != tt.wantY1 {
+				t.Errorf("slice bounds = (%v, %v), want (%v, %v)", gotArgs[24], gotArgs[25], tt.wantY0, tt.wantY1)
+			}
+		})
+	}
+}
+
+func TestSaveEntry_QAOutcome(t *testing.T) {
+	tests := []struct {
+		name        string
+		verdict     string
+		retries     int
+		wantVerdict any
+	}{
+		{"QA skipped", "", 0, nil},
+		{"passed after retry", "pass", 1, "pass"},
+		{"failed after retries", "fail", 2, "fail"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotArgs []any
+			db := &mockDB{
+				insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+					gotArgs = args
+					return "entry-id-1", nil
+				},
+			}
+			h := &Handler{db: db}
+
+			entry := &extractedEntry{
+				Date:                 "2024-01-15",
+				EntryType:            "maintenance",
+				MaintenanceNarrative: "Oil",
+				QAVerdict:            tt.verdict,
+				QARetries:            tt.retries,
+			}
+			if err := h.saveEntry(context.Background(), "aircraft-1", "page-1", entry); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if gotArgs[26] != tt.wantVerdict || gotArgs[27] != tt.retries {
+				t.Errorf("qa outcome = (%v, %v), want (%v, %v)", gotArgs[26], gotArgs[27], tt.wantVerdict, tt.retries)
+			}
+		})
+	}
+}
+
+func TestSaveEntry_ShortNarrative(t *testing.T) {
+	insertCalled := false
+	db := &mockDB{
+		insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+			insertCalled = true
+			return "entry-id-1", nil
+		},
+		execFn: func(ctx context.Context, sql string, args ...any) error {
+			return nil
+		},
+	}
+
+	h := &Handler{
+		db: db,
+		gemini: &gemini.MockClient{
 			EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
 				t.Error("EmbedContent should not be called for short narrative")
 				return nil, nil
@@ -1393,6 +1973,8 @@ func TestProcessPage_WithSlicing(t *testing.T) {
 	extractCalls := 0
 	qaCalls := 0
 	insertCalls := 0
+	var prompts []string
+	var sliceKeys []any
 	s3Mock := &mockS3{
 		getObjectFn: func(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
 			return io.NopCloser(bytes.NewReader(testJPEG)), nil
@@ -1405,6 +1987,10 @@ func TestProcessPage_WithSlicing(t *testing.T) {
 		},
 		insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
 			insertCalls++
+			sliceKeys = append(sliceKeys, args[23])
+			if args[24] == nil || args[25] == nil {
+				t.Errorf("insert %d: slice bounds not persisted: y0=%v y1=%v", insertCalls, args[24], args[25])
+			}
 			return fmt.Sprintf("entry-id-%d", insertCalls), nil
 		},
 		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
@@ -1426,9 +2012,11 @@ func TestProcessPage_WithSlicing(t *testing.T) {
 	}
 
 	h := &Handler{
-		db:     db,
-		s3:     s3Mock,
-		bucket: "test-bucket",
+		qaMaxRetries: 1,
+		qaSampleRate: 1,
+		db:           db,
+		s3:           s3Mock,
+		bucket:       "test-bucket",
 		gemini: &gemini.MockClient{
 			GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
 				// Detect QA calls by checking if the prompt contains the QA marker
@@ -1439,10 +2027,11 @@ func TestProcessPage_WithSlicing(t *testing.T) {
 					}
 				}
 				extractCalls++
+				prompts = append(prompts, parts[0].Text)
 				return fmt.Sprintf(`{"pageType":"maintenance_entry","entries":[{"date":"2024-01-%02d","entryType":"maintenance","maintenanceNarrative":"Entry %d oil change and filter replacement","confidence":0.95}]}`, extractCalls, extractCalls), nil
 			},
 			EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
-				return make([]float32, 768), nil
+				return make([]float32, gemini.DefaultEmbeddingDimensions), nil
 			},
 		},
 		secrets: &mockSecrets{},
@@ -1463,6 +2052,13 @@ func TestProcessPage_WithSlicing(t *testing.T) {
 		t.Errorf("extractCalls = %d, want 3", extractCalls)
 	}
 
+	// Genuine multi-slice pages keep the per-entry prompt.
+	for i, p := range prompts {
+		if p != SliceExtractionPrompt {
+			t.Errorf("extraction %d used %.40q, want SliceExtractionPrompt", i, p)
+		}
+	}
+
 	// QA called once per slice (3 slices, all pass on first attempt).
 	if qaCalls != 3 {
 		t.Errorf("qaCalls = %d, want 3", qaCalls)
@@ -1485,56 +2081,63 @@ func TestProcessPage_WithSlicing(t *testing.T) {
 			t.Errorf("unexpected content type: %s", call.contentType)
 		}
 	}
+
+	// Each entry should be linked to the slice it was extracted from.
+	for i, key := range sliceKeys {
+		want := regexp.MustCompile(fmt.Sprintf(`^slices/batch-1/page_0001/slice_%03d_[0-9a-f]{16}\.jpg$`, i))
+		if k, _ := key.(string); !want.MatchString(k) || k != s3Mock.putCalls[i].key {
+			t.Errorf("entry %d slice_key = %v, want the uploaded key matching %s", i, key, want)
+		}
+	}
 }
 
-func TestProcessPage_SlicerFallback(t *testing.T) {
-	// Invalid image bytes → slicer fails → fallback to full image → 1 extract + 1 QA call.
-	extractCalls := 0
-	qaCalls := 0
-	s3Mock := &mockS3{}
+func TestProcessPage_SliceFormat(t *testing.T) {
+	testJPEG := makeTestJPEG(200, 600, [][2]int{
+		{50, 130},
+		{230, 330},
+		{430, 530},
+	})
 
-	db := &mockDB{
-		execFn: func(ctx context.Context, sql string, args ...any) error {
-			return nil
+	s3Mock := &mockS3{
+		getObjectFn: func(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(testJPEG)), nil
 		},
+	}
+	db := &mockDB{
+		execFn: func(ctx context.Context, sql string, args ...any) error { return nil },
 		insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
 			return "entry-id-1", nil
 		},
 		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
 			if strings.Contains(sql, "upload_batches") {
-				return []map[string]any{{
-					"aircraft_id":   "aircraft-1",
-					"registration":  "N123AB",
-					"serial_number": nil,
-					"make":          nil,
-					"model":         nil,
-				}}, nil
+				return []map[string]any{{"aircraft_id": "aircraft-1", "registration": "N123AB"}}, nil
 			}
-			return []map[string]any{{
-				"total":  int64(1),
-				"done":   int64(1),
-				"failed": int64(0),
-			}}, nil
+			return []map[string]any{{"total": int64(1), "done": int64(1), "failed": int64(0)}}, nil
 		},
 	}
 
+	var geminiMIMEs []string
 	h := &Handler{
-		db:     db,
-		s3:     s3Mock,
-		bucket: "test-bucket",
+		db:          db,
+		s3:          s3Mock,
+		bucket:      "test-bucket",
+		sliceFormat: slicer.FormatPNG,
 		gemini: &gemini.MockClient{
 			GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+				for _, p := range parts {
+					if p.Data != nil {
+						geminiMIMEs = append(geminiMIMEs, p.MIMEType)
+					}
+				}
 				for _, p := range parts {
 					if strings.Contains(p.Text, "QA specialist") {
-						qaCalls++
 						return `{"results":[{"entryIndex":0,"verdict":"pass","issues":[],"summary":"OK"}]}`, nil
 					}
 				}
-				extractCalls++
 				return `{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","entryType":"maintenance","maintenanceNarrative":"Changed oil","confidence":0.9}]}`, nil
 			},
 			EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
-				return make([]float32, 768), nil
+				return make([]float32, gemini.DefaultEmbeddingDimensions), nil
 			},
 		},
 		secrets: &mockSecrets{},
@@ -1550,374 +2153,1462 @@ func TestProcessPage_SlicerFallback(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	// Slicer fails on "fake-image-data" → falls back to 1 slice → 1 extract + 1 QA.
-	if extractCalls != 1 {
-		t.Errorf("extractCalls = %d, want 1 (fallback to full image)", extractCalls)
+	if len(s3Mock.putCalls) != 3 {
+		t.Fatalf("s3 putCalls = %d, want 3", len(s3Mock.putCalls))
 	}
-	if qaCalls != 1 {
-		t.Errorf("qaCalls = %d, want 1", qaCalls)
+	for i, call := range s3Mock.putCalls {
+		wantKey := regexp.MustCompile(fmt.Sprintf(`^slices/batch-1/page_0001/slice_%03d_[0-9a-f]{16}\.png$`, i))
+		if !wantKey.MatchString(call.key) {
+			t.Errorf("put key = %s, want a match for %s", call.key, wantKey)
+		}
+		if call.contentType != "image/png" {
+			t.Errorf("put content type = %s, want image/png", call.contentType)
+		}
+	}
+	if len(geminiMIMEs) == 0 {
+		t.Fatal("expected image parts sent to Gemini")
+	}
+	for _, m := range geminiMIMEs {
+		if m != "image/png" {
+			t.Errorf("Gemini image MIME = %s, want image/png", m)
+		}
 	}
 }
 
-// ─── Tests: QA Verification ──────────────────────────────────────────────
+func TestProcessPage_Preprocess(t *testing.T) {
+	testJPEG := makeTestJPEG(200, 600, [][2]int{
+		{50, 130},
+		{230, 330},
+		{430, 530},
+	})
 
-func TestExtractAndVerifySlice_QAPass(t *testing.T) {
-	// QA passes on first attempt — entries saved without review flag.
-	extractCalls := 0
-	qaCalls := 0
+	tests := []struct {
+		name       string
+		preprocess string
+		wantMIME   string
+	}{
+		{"disabled", "", "image/png"},
+		{"contrast", preprocessContrast, "image/jpeg"},
+	}
 
-	mockGemini := &gemini.MockClient{
-		GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
-			for _, p := range parts {
-				if strings.Contains(p.Text, "QA specialist") {
-					qaCalls++
-					return `{"results":[{"entryIndex":0,"verdict":"pass","issues":[],"summary":"All fields verified"}]}`, nil
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3Mock := &mockS3{
+				getObjectFn: func(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+					return io.NopCloser(bytes.NewReader(testJPEG)), nil
+				},
+			}
+			db := &mockDB{
+				execFn: func(ctx context.Context, sql string, args ...any) error { return nil },
+				insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+					return "entry-id-1", nil
+				},
+				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+					if strings.Contains(sql, "upload_batches") {
+						return []map[string]any{{"aircraft_id": "aircraft-1", "registration": "N123AB"}}, nil
+					}
+					return []map[string]any{{"total": int64(1), "done": int64(1), "failed": int64(0)}}, nil
+				},
+			}
+
+			var sent []gemini.Part
+			h := &Handler{
+				db:          db,
+				s3:          s3Mock,
+				bucket:      "test-bucket",
+				sliceFormat: slicer.FormatPNG,
+				preprocess:  tt.preprocess,
+				gemini: &gemini.MockClient{
+					GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+						for _, p := range parts {
+							if p.Data != nil {
+								sent = append(sent, p)
+							}
+						}
+						for _, p := range parts {
+							if strings.Contains(p.Text, "QA specialist") {
+								return `{"results":[{"entryIndex":0,"verdict":"pass","issues":[],"summary":"OK"}]}`, nil
+							}
+						}
+						return `{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","entryType":"maintenance","maintenanceNarrative":"Changed oil","confidence":0.9}]}`, nil
+					},
+					EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
+						return make([]float32, gemini.DefaultEmbeddingDimensions), nil
+					},
+				},
+				secrets: &mockSecrets{},
+			}
+
+			err := h.processPage(context.Background(), pageMessage{
+				UploadID:   "batch-1",
+				PageID:     "page-1",
+				PageNumber: 1,
+				S3Key:      "pages/batch-1/page_0001.jpg",
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// The audit copy in S3 is always the original slice.
+			if len(s3Mock.putCalls) == 0 {
+				t.Fatal("expected slices uploaded to S3")
+			}
+			uploaded := make(map[string]bool)
+			for _, call := range s3Mock.putCalls {
+				if call.contentType != "image/png" {
+					t.Errorf("put content type = %s, want image/png", call.contentType)
 				}
+				uploaded[string(call.data)] = true
 			}
-			extractCalls++
-			return `{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","entryType":"maintenance","maintenanceNarrative":"Changed oil and filter","confidence":0.95}]}`, nil
-		},
-	}
 
-	h := &Handler{secrets: &mockSecrets{}}
+			if len(sent) == 0 {
+				t.Fatal("expected image parts sent to Gemini")
+			}
+			for _, p := range sent {
+				if p.MIMEType != tt.wantMIME {
+					t.Errorf("Gemini image MIME = %s, want %s", p.MIMEType, tt.wantMIME)
+				}
+				if tt.preprocess == "" {
+					if !uploaded[string(p.Data)] {
+						t.Error("Gemini received bytes that differ from the uploaded slice")
+					}
+					continue
+				}
+				if uploaded[string(p.Data)] {
+					t.Error("Gemini received the unprocessed slice")
+				}
+				img, err := jpeg.Decode(bytes.NewReader(p.Data))
+				if err != nil {
+					t.Fatalf("preprocessed slice is not a valid JPEG: %v", err)
+				}
+				if _, ok := img.(*image.Gray); !ok {
+					t.Errorf("preprocessed slice decoded as %T, want *image.Gray", img)
+				}
+			}
+		})
+	}
+}
 
-	entries, pageType, err := h.extractAndVerifySlice(context.Background(), []byte("img"), "image/jpeg", mockGemini, 0, "page-1")
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+func TestMockS3_HeadObject(t *testing.T) {
+	m := &mockS3{}
+	if exists, _, err := m.HeadObject(context.Background(), "b", "k"); exists || err != nil {
+		t.Fatalf("empty mock: exists=%v err=%v", exists, err)
 	}
-	if len(entries) != 1 {
-		t.Fatalf("expected 1 entry, got %d", len(entries))
+	_ = m.PutObject(context.Background(), "b", "k", "image/jpeg", strings.NewReader("12345"))
+	exists, size, err := m.HeadObject(context.Background(), "b", "k")
+	if !exists || size != 5 || err != nil {
+		t.Errorf("after put: exists=%v size=%d err=%v, want true 5 nil", exists, size, err)
 	}
-	if entries[0].NeedsReview {
-		t.Error("entry should not need review when QA passes")
+	m.headErr = fmt.Errorf("denied")
+	if _, _, err := m.HeadObject(context.Background(), "b", "k"); err == nil {
+		t.Error("expected configured head error")
 	}
-	if pageType != "maintenance_entry" {
-		t.Errorf("pageType = %q, want %q", pageType, "maintenance_entry")
+}
+
+func TestSliceKey(t *testing.T) {
+	a := []byte("slice crop A")
+	b := []byte("slice crop B")
+
+	keyA := sliceKey("batch-1", 3, 2, a, ".jpg")
+	if !regexp.MustCompile(`^slices/batch-1/page_0003/slice_002_[0-9a-f]{16}\.jpg$`).MatchString(keyA) {
+		t.Errorf("key = %s", keyA)
 	}
-	if extractCalls != 1 {
-		t.Errorf("extractCalls = %d, want 1", extractCalls)
+	if again := sliceKey("batch-1", 3, 2, []byte("slice crop A"), ".jpg"); again != keyA {
+		t.Errorf("identical bytes got %s, want %s", again, keyA)
 	}
-	if qaCalls != 1 {
-		t.Errorf("qaCalls = %d, want 1", qaCalls)
+	if keyB := sliceKey("batch-1", 3, 2, b, ".jpg"); keyB == keyA {
+		t.Errorf("different bytes share key %s", keyB)
 	}
 }
 
-func TestExtractAndVerifySlice_QAFail_RetrySucceeds(t *testing.T) {
-	// QA fails on first attempt with critical issue, retry extraction passes QA.
-	extractCalls := 0
-	qaCalls := 0
+func TestProcessPage_SkipsExistingSlices(t *testing.T) {
+	testJPEG := makeTestJPEG(200, 600, [][2]int{
+		{50, 130},
+		{230, 330},
+		{430, 530},
+	})
+	msg := pageMessage{
+		UploadID:   "batch-1",
+		PageID:     "page-1",
+		PageNumber: 1,
+		S3Key:      "pages/batch-1/page_0001.jpg",
+	}
 
-	mockGemini := &gemini.MockClient{
-		GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
-			for _, p := range parts {
-				if strings.Contains(p.Text, "QA specialist") {
-					qaCalls++
-					if qaCalls == 1 {
-						return `{"results":[{"entryIndex":0,"verdict":"fail","issues":[{"field":"maintenanceNarrative","issue":"truncated","expected":"full text here","extracted":"partial","severity":"critical"}],"summary":"Narrative truncated"}]}`, nil
-					}
-					return `{"results":[{"entryIndex":0,"verdict":"pass","issues":[],"summary":"All fields match after retry"}]}`, nil
-				}
-			}
-			extractCalls++
-			if extractCalls == 1 {
-				return `{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","entryType":"maintenance","maintenanceNarrative":"partial","confidence":0.9}]}`, nil
+	tests := []struct {
+		name     string
+		prepare  func(m *mockS3) // runs after the first pass
+		wantPuts int             // PUTs on the second pass
+	}{
+		{"identical slices skipped", func(m *mockS3) {}, 0},
+		{"size mismatch re-uploaded", func(m *mockS3) {
+			for k := range m.objects {
+				m.objects[k] = 1
 			}
-			return `{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","entryType":"maintenance","maintenanceNarrative":"full text here","confidence":0.95}]}`, nil
-		},
-	}
-
-	h := &Handler{secrets: &mockSecrets{}}
-
-	entries, _, err := h.extractAndVerifySlice(context.Background(), []byte("img"), "image/jpeg", mockGemini, 0, "page-1")
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+		}, 3},
+		{"head failure falls back to put", func(m *mockS3) { m.headErr = fmt.Errorf("denied") }, 3},
 	}
-	if len(entries) != 1 {
-		t.Fatalf("expected 1 entry, got %d", len(entries))
-	}
-	if entries[0].NeedsReview {
-		t.Error("entry should not need review after successful retry")
-	}
-	if entries[0].MaintenanceNarrative != "full text here" {
-		t.Errorf("narrative = %q, want corrected version", entries[0].MaintenanceNarrative)
-	}
-	if extractCalls != 2 {
-		t.Errorf("extractCalls = %d, want 2", extractCalls)
-	}
-	if qaCalls != 2 {
-		t.Errorf("qaCalls = %d, want 2", qaCalls)
-	}
-}
 
-func TestExtractAndVerifySlice_QAFail_MaxRetries(t *testing.T) {
-	// QA fails on both attempts — entries flagged for review.
-	mockGemini := &gemini.MockClient{
-		GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
-			for _, p := range parts {
-				if strings.Contains(p.Text, "QA specialist") {
-					return `{"results":[{"entryIndex":0,"verdict":"fail","issues":[{"field":"date","issue":"incorrect","expected":"2024-02-15","extracted":"2024-01-15","severity":"critical"}],"summary":"Wrong date"}]}`, nil
-				}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s3Mock := &mockS3{
+				getObjectFn: func(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+					return io.NopCloser(bytes.NewReader(testJPEG)), nil
+				},
+			}
+			h := &Handler{
+				db: &mockDB{
+					execFn: func(ctx context.Context, sql string, args ...any) error { return nil },
+					insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+						return "entry-id-1", nil
+					},
+					queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+						if strings.Contains(sql, "upload_batches") {
+							return []map[string]any{{"aircraft_id": "aircraft-1", "registration": "N123AB"}}, nil
+						}
+						return []map[string]any{{"total": int64(1), "done": int64(1), "failed": int64(0)}}, nil
+					},
+				},
+				s3:     s3Mock,
+				bucket: "test-bucket",
+				gemini: &gemini.MockClient{
+					GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+						for _, p := range parts {
+							if strings.Contains(p.Text, "QA specialist") {
+								return `{"results":[{"entryIndex":0,"verdict":"pass","issues":[],"summary":"OK"}]}`, nil
+							}
+						}
+						return `{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","entryType":"maintenance","maintenanceNarrative":"Changed oil","confidence":0.9}]}`, nil
+					},
+					EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
+						return make([]float32, gemini.DefaultEmbeddingDimensions), nil
+					},
+				},
+				secrets: &mockSecrets{},
 			}
-			return `{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","entryType":"maintenance","maintenanceNarrative":"Oil change","confidence":0.9}]}`, nil
-		},
-	}
 
-	h := &Handler{secrets: &mockSecrets{}}
+			if err := h.processPage(context.Background(), msg); err != nil {
+				t.Fatalf("first pass: %v", err)
+			}
+			if len(s3Mock.putCalls) != 3 {
+				t.Fatalf("first pass putCalls = %d, want 3", len(s3Mock.putCalls))
+			}
 
-	entries, _, err := h.extractAndVerifySlice(context.Background(), []byte("img"), "image/jpeg", mockGemini, 0, "page-1")
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
-	}
-	if len(entries) != 1 {
-		t.Fatalf("expected 1 entry, got %d", len(entries))
-	}
-	if !entries[0].NeedsReview {
-		t.Error("entry should be flagged for review after max retries")
+			tt.prepare(s3Mock)
+			s3Mock.putCalls = nil
+			if err := h.processPage(context.Background(), msg); err != nil {
+				t.Fatalf("reprocess: %v", err)
+			}
+			if len(s3Mock.putCalls) != tt.wantPuts {
+				t.Errorf("reprocess putCalls = %d, want %d", len(s3Mock.putCalls), tt.wantPuts)
+			}
+		})
 	}
 }
 
-func TestExtractAndVerifySlice_QANeedsReview(t *testing.T) {
-	// QA returns needs_review — accepted without retry, flagged for review.
-	mockGemini := &gemini.MockClient{
-		GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
-			for _, p := range parts {
-				if strings.Contains(p.Text, "QA specialist") {
-					return `{"results":[{"entryIndex":0,"verdict":"needs_review","issues":[{"field":"mechanicCertificate","issue":"incorrect","expected":"unclear","extracted":"12345","severity":"minor"}],"summary":"Certificate number ambiguous"}]}`, nil
-				}
+func TestProcessPage_CompressRawExtraction(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		t.Run(fmt.Sprintf("compress=%v", compress), func(t *testing.T) {
+			var stored string
+			h := &Handler{
+				db: &mockDB{
+					execFn: func(ctx context.Context, sql string, args ...any) error {
+						if strings.Contains(sql, "raw_extraction") {
+							stored = args[0].(string)
+						}
+						return nil
+					},
+					insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+						return "entry-id-1", nil
+					},
+					queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+						if strings.Contains(sql, "upload_batches") {
+							return []map[string]any{{"aircraft_id": "aircraft-1", "registration": "N123AB"}}, nil
+						}
+						return []map[string]any{{"total": int64(1), "done": int64(1), "failed": int64(0)}}, nil
+					},
+				},
+				s3:     &mockS3{},
+				bucket: "test-bucket",
+				gemini: &gemini.MockClient{
+					GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+						for _, p := range parts {
+							if strings.Contains(p.Text, "QA specialist") {
+								return `{"results":[{"entryIndex":0,"verdict":"pass","issues":[],"summary":"OK"}]}`, nil
+							}
+						}
+						return `{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","entryType":"maintenance","maintenanceNarrative":"Changed oil","confidence":0.9}]}`, nil
+					},
+					EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
+						return make([]float32, gemini.DefaultEmbeddingDimensions), nil
+					},
+				},
+				secrets:               &mockSecrets{},
+				compressRawExtraction: compress,
 			}
-			return `{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","entryType":"maintenance","maintenanceNarrative":"Oil change","mechanicCertificate":"12345","confidence":0.85}]}`, nil
-		},
-	}
 
-	h := &Handler{secrets: &mockSecrets{}}
+			err := h.processPage(context.Background(), pageMessage{
+				UploadID:   "batch-1",
+				PageID:     "page-1",
+				PageNumber: 1,
+				S3Key:      "pages/batch-1/page_0001.jpg",
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
 
-	entries, _, err := h.extractAndVerifySlice(context.Background(), []byte("img"), "image/jpeg", mockGemini, 0, "page-1")
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
-	}
-	if len(entries) != 1 {
-		t.Fatalf("expected 1 entry, got %d", len(entries))
-	}
-	if !entries[0].NeedsReview {
-		t.Error("entry should be flagged for review with needs_review verdict")
-	}
-	if !strings.Contains(entries[0].ExtractionNotes, "Certificate number ambiguous") {
-		t.Errorf("extraction notes should contain QA summary, got: %q", entries[0].ExtractionNotes)
+			if got := strings.Contains(stored, rawextraction.EncodingGzip); got != compress {
+				t.Errorf("stored compressed = %v, want %v: %.80s", got, compress, stored)
+			}
+			raw, err := rawextraction.Decode([]byte(stored))
+			if err != nil {
+				t.Fatalf("decode stored extraction: %v", err)
+			}
+			var extraction extractionResult
+			if err := json.Unmarshal(raw, &extraction); err != nil {
+				t.Fatalf("stored extraction is not JSON: %v", err)
+			}
+			if extraction.PageType != "maintenance_entry" || len(extraction.Entries) == 0 {
+				t.Errorf("stored extraction = %+v", extraction)
+			}
+		})
 	}
 }
 
-func TestExtractAndVerifySlice_ClaudeError(t *testing.T) {
-	// Claude client fails — falls back to Gemini for QA.
+func TestProcessPage_SlicerFallback(t *testing.T) {
+	// Invalid image bytes → slicer fails → fallback to full image → 1 extract + 1 QA call.
+	extractCalls := 0
 	qaCalls := 0
+	var prompt string
+	s3Mock := &mockS3{}
 
-	mockGemini := &gemini.MockClient{
-		GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
-			for _, p := range parts {
-				if strings.Contains(p.Text, "QA specialist") {
-					qaCalls++
-					return `{"results":[{"entryIndex":0,"verdict":"pass","issues":[],"summary":"OK"}]}`, nil
-				}
-			}
-			return `{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","entryType":"maintenance","maintenanceNarrative":"Oil change","confidence":0.95}]}`, nil
+	db := &mockDB{
+		execFn: func(ctx context.Context, sql string, args ...any) error {
+			return nil
 		},
-	}
-
-	mockClaude := &anthropic.MockClient{
-		CreateMessageFn: func(ctx context.Context, model string, maxTokens int64, messages []anthropic.Message) (string, error) {
-			return "", fmt.Errorf("claude API error")
+		insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+			return "entry-id-1", nil
 		},
-	}
-
-	h := &Handler{
-		claude:  mockClaude,
-		secrets: &mockSecrets{},
-	}
-
-	entries, _, err := h.extractAndVerifySlice(context.Background(), []byte("img"), "image/jpeg", mockGemini, 0, "page-1")
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
-	}
-	if len(entries) != 1 {
-		t.Fatalf("expected 1 entry, got %d", len(entries))
-	}
-	// Should have fallen back to Gemini QA
-	if qaCalls != 1 {
-		t.Errorf("gemini QA calls = %d, want 1 (fallback from Claude)", qaCalls)
-	}
-}
-
-func TestExtractAndVerifySlice_NoClaude(t *testing.T) {
-	// No Claude client configured — Gemini used for QA.
-	qaCalls := 0
-
-	mockGemini := &gemini.MockClient{
-		GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
-			for _, p := range parts {
-				if strings.Contains(p.Text, "QA specialist") {
-					qaCalls++
-					return `{"results":[{"entryIndex":0,"verdict":"pass","issues":[],"summary":"OK"}]}`, nil
-				}
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			if strings.Contains(sql, "upload_batches") {
+				return []map[string]any{{
+					"aircraft_id":   "aircraft-1",
+					"registration":  "N123AB",
+					"serial_number": nil,
+					"make":          nil,
+					"model":         nil,
+				}}, nil
 			}
-			return `{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","entryType":"maintenance","maintenanceNarrative":"Oil change","confidence":0.95}]}`, nil
+			return []map[string]any{{
+				"total":  int64(1),
+				"done":   int64(1),
+				"failed": int64(0),
+			}}, nil
 		},
 	}
 
 	h := &Handler{
-		// No claude client set — should use Gemini fallback
+		qaMaxRetries: 1,
+		qaSampleRate: 1,
+		db:           db,
+		s3:           s3Mock,
+		bucket:       "test-bucket",
+		gemini: &gemini.MockClient{
+			GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+				for _, p := range parts {
+					if strings.Contains(p.Text, "QA specialist") {
+						qaCalls++
+						return `{"results":[{"entryIndex":0,"verdict":"pass","issues":[],"summary":"OK"}]}`, nil
+					}
+				}
+				extractCalls++
+				prompt = parts[0].Text
+				return `{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","entryType":"maintenance","maintenanceNarrative":"Changed oil","confidence":0.9}]}`, nil
+			},
+			EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
+				return make([]float32, gemini.DefaultEmbeddingDimensions), nil
+			},
+		},
 		secrets: &mockSecrets{},
 	}
 
-	entries, _, err := h.extractAndVerifySlice(context.Background(), []byte("img"), "image/jpeg", mockGemini, 0, "page-1")
+	err := h.processPage(context.Background(), pageMessage{
+		UploadID:   "batch-1",
+		PageID:     "page-1",
+		PageNumber: 1,
+		S3Key:      "pages/batch-1/page_0001.jpg",
+	})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if len(entries) != 1 {
-		t.Fatalf("expected 1 entry, got %d", len(entries))
+
+	// Slicer fails on "fake-image-data" → falls back to 1 slice → 1 extract + 1 QA.
+	if extractCalls != 1 {
+		t.Errorf("extractCalls = %d, want 1 (fallback to full image)", extractCalls)
 	}
 	if qaCalls != 1 {
-		t.Errorf("gemini QA calls = %d, want 1", qaCalls)
+		t.Errorf("qaCalls = %d, want 1", qaCalls)
+	}
+	// The whole page goes out as one image, so it gets the full-page prompt.
+	if prompt != MaintenanceExtractionPrompt {
+		t.Errorf("extraction used %.40q, want MaintenanceExtractionPrompt", prompt)
 	}
 }
 
-func TestExtractAndVerifySlice_EmptyExtraction(t *testing.T) {
-	// Empty extraction (blank/header slice) — QA skipped entirely.
-	qaCalls := 0
-
-	mockGemini := &gemini.MockClient{
-		GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
-			for _, p := range parts {
-				if strings.Contains(p.Text, "QA specialist") {
-					qaCalls++
-					return `{"results":[]}`, nil
-				}
-			}
-			return `{"pageType":"blank","entries":[]}`, nil
-		},
+func TestProcessPage_SkipBlankPages(t *testing.T) {
+	tests := []struct {
+		name        string
+		image       []byte
+		wantSkipped bool
+	}{
+		{name: "all white page", image: makeTestJPEG(200, 600, nil), wantSkipped: true},
+		{name: "banded page", image: makeTestJPEG(200, 600, [][2]int{{50, 130}, {230, 330}, {430, 530}})},
+		{name: "single entry", image: makeTestJPEG(200, 600, [][2]int{{250, 290}})},
 	}
 
-	h := &Handler{secrets: &mockSecrets{}}
-
-	entries, pageType, err := h.extractAndVerifySlice(context.Background(), []byte("img"), "image/jpeg", mockGemini, 0, "page-1")
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
-	}
-	if len(entries) != 0 {
-		t.Errorf("expected 0 entries, got %d", len(entries))
-	}
-	if pageType != "blank" {
-		t.Errorf("pageType = %q, want %q", pageType, "blank")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			extractCalls := 0
+			var statuses []string
+			db := &mockDB{
+				execFn: func(ctx context.Context, sql string, args ...any) error {
+					if strings.Contains(sql, "extraction_status = 'skipped'") {
+						statuses = append(statuses, "skipped")
+					} else if strings.Contains(sql, "extraction_status = 'completed'") {
+						statuses = append(statuses, "completed")
+					}
+					return nil
+				},
+				insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+					return "entry-id-1", nil
+				},
+				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+					if strings.Contains(sql, "upload_batches ub") && strings.Contains(sql, "JOIN aircraft") {
+						return []map[string]any{{"aircraft_id": "aircraft-1", "registration": "N123AB"}}, nil
+					}
+					return nil, nil
+				},
+			}
+
+			h := &Handler{
+				db: db,
+				s3: &mockS3{
+					getObjectFn: func(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+						return io.NopCloser(bytes.NewReader(tt.image)), nil
+					},
+				},
+				bucket:         "test-bucket",
+				skipBlankPages: true,
+				gemini: &gemini.MockClient{
+					GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+						for _, p := range parts {
+							if strings.Contains(p.Text, "QA specialist") {
+								return `{"results":[{"entryIndex":0,"verdict":"pass","issues":[],"summary":"OK"}]}`, nil
+							}
+						}
+						extractCalls++
+						return `{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","entryType":"maintenance","maintenanceNarrative":"Changed oil","confidence":0.9}]}`, nil
+					},
+					EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
+						return make([]float32, gemini.DefaultEmbeddingDimensions), nil
+					},
+				},
+				secrets: &mockSecrets{},
+			}
+
+			err := h.processPage(context.Background(), pageMessage{
+				UploadID:   "batch-1",
+				PageID:     "page-1",
+				PageNumber: 1,
+				S3Key:      "pages/batch-1/page_0001.jpg",
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if tt.wantSkipped {
+				if extractCalls != 0 || fmt.Sprint(statuses) != "[skipped]" {
+					t.Errorf("extractCalls = %d, statuses = %v, want no extraction and the page skipped", extractCalls, statuses)
+				}
+				return
+			}
+			if extractCalls == 0 || fmt.Sprint(statuses) != "[completed]" {
+				t.Errorf("extractCalls = %d, statuses = %v, want the page extracted", extractCalls, statuses)
+			}
+		})
 	}
-	if qaCalls != 0 {
-		t.Errorf("QA should be skipped for empty extraction, got %d calls", qaCalls)
+}
+
+func TestProcessPage_DryRun(t *testing.T) {
+	tests := []struct {
+		name        string
+		handlerFlag bool
+		msgFlag     bool
+		image       []byte
+		wantExtract bool
+	}{
+		{name: "handler flag", handlerFlag: true, image: makeTestJPEG(200, 600, [][2]int{{250, 290}}), wantExtract: true},
+		{name: "message flag", msgFlag: true, image: makeTestJPEG(200, 600, [][2]int{{50, 130}, {230, 330}, {430, 530}}), wantExtract: true},
+		{name: "blank page", handlerFlag: true, image: makeTestJPEG(200, 600, nil)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var writes []string
+			extractCalls, qaCalls, embedCalls := 0, 0, 0
+			db := &mockDB{
+				execFn: func(ctx context.Context, sql string, args ...any) error {
+					writes = append(writes, sql)
+					return nil
+				},
+				insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+					writes = append(writes, sql)
+					return "entry-id-1", nil
+				},
+				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+					if strings.Contains(sql, "upload_batches ub") && strings.Contains(sql, "JOIN aircraft") {
+						return []map[string]any{{"aircraft_id": "aircraft-1", "registration": "N123AB"}}, nil
+					}
+					return []map[string]any{{"total": int64(1), "done": int64(1), "failed": int64(0)}}, nil
+				},
+			}
+
+			h := &Handler{
+				qaMaxRetries: 1,
+				qaSampleRate: 1,
+				db:           db,
+				s3: &mockS3{
+					getObjectFn: func(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+						return io.NopCloser(bytes.NewReader(tt.image)), nil
+					},
+				},
+				bucket:         "test-bucket",
+				dryRun:         tt.handlerFlag,
+				skipBlankPages: true,
+				gemini: &gemini.MockClient{
+					GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+						for _, p := range parts {
+							if strings.Contains(p.Text, "QA specialist") {
+								qaCalls++
+								return `{"results":[{"entryIndex":0,"verdict":"pass","issues":[],"summary":"OK"}]}`, nil
+							}
+						}
+						extractCalls++
+						return `{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","entryType":"maintenance","maintenanceNarrative":"Changed oil","confidence":0.9}]}`, nil
+					},
+					EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
+						embedCalls++
+						return make([]float32, gemini.DefaultEmbeddingDimensions), nil
+					},
+				},
+				secrets: &mockSecrets{},
+			}
+
+			err := h.processPage(context.Background(), pageMessage{
+				UploadID:   "batch-1",
+				PageID:     "page-1",
+				PageNumber: 1,
+				S3Key:      "pages/batch-1/page_0001.jpg",
+				DryRun:     tt.msgFlag,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(writes) != 0 {
+				t.Errorf("dry run wrote to the database: %v", writes)
+			}
+			if embedCalls != 0 {
+				t.Errorf("embedCalls = %d, want 0", embedCalls)
+			}
+			if tt.wantExtract && (extractCalls == 0 || qaCalls == 0) {
+				t.Errorf("extractCalls = %d, qaCalls = %d, want extraction and QA to run", extractCalls, qaCalls)
+			}
+			if !tt.wantExtract && extractCalls != 0 {
+				t.Errorf("extractCalls = %d, want the blank page skipped", extractCalls)
+			}
+		})
 	}
 }
 
-func TestBuildRetryPrompt(t *testing.T) {
-	// No issues — returns base prompt.
-	t.Run("no issues", func(t *testing.T) {
-		result := buildRetryPrompt(nil)
-		if result != SliceExtractionPrompt {
-			t.Error("expected base prompt with no issues")
-		}
-	})
+func TestHandle_DryRunFailureNotRecorded(t *testing.T) {
+	var writes []string
+	h := &Handler{
+		db: &mockDB{execFn: func(ctx context.Context, sql string, args ...any) error {
+			writes = append(writes, sql)
+			return nil
+		}},
+		s3: &mockS3{
+			getObjectFn: func(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+				return nil, errors.New("no such key")
+			},
+		},
+		bucket: "test-bucket",
+	}
 
-	// Issues present — appends feedback.
-	t.Run("with issues", func(t *testing.T) {
-		issues := []qaFieldIssue{
-			{Field: "maintenanceNarrative", Issue: "truncated", Severity: "critical"},
-			{Field: "date", Issue: "incorrect", Severity: "critical"},
-			{Field: "entryType", Issue: "wrong_classification", Severity: "minor"},
-		}
-		result := buildRetryPrompt(issues)
+	body := `{"uploadId":"batch-1","pageId":"page-1","pageNumber":1,"s3Key":"pages/batch-1/page_0001.jpg","dryRun":true}`
+	err := h.Handle(context.Background(), events.SQSEvent{Records: []events.SQSMessage{{Body: body}}})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if len(writes) != 0 {
+		t.Errorf("dry run wrote to the database: %v", writes)
+	}
+}
 
-		if !strings.Contains(result, SliceExtractionPrompt) {
-			t.Error("retry prompt should contain base extraction prompt")
-		}
-		if !strings.Contains(result, "previous extraction had issues") {
-			t.Error("retry prompt should contain feedback header")
-		}
-		if !strings.Contains(result, "maintenanceNarrative") {
-			t.Error("retry prompt should reference flagged field")
-		}
-		if !strings.Contains(result, "re-read the full text carefully") {
-			t.Error("retry prompt should contain truncation-specific guidance")
-		}
-		if !strings.Contains(result, "verify this value") {
-			t.Error("retry prompt should contain incorrect-specific guidance")
-		}
-		if !strings.Contains(result, "reconsider the classification") {
-			t.Error("retry prompt should contain classification-specific guidance")
-		}
-		if !strings.Contains(result, "Do NOT accept corrections from external sources") {
-			t.Error("retry prompt should warn against accepting external corrections")
-		}
-	})
+func TestProcessPage_TokenUsage(t *testing.T) {
+	tests := []struct {
+		name     string
+		reported bool
+		want     string
+	}{
+		{name: "reported", reported: true, want: `usage {"uploadId":"batch-1","pageId":"page-1","calls":2,"inputTokens":2000,"outputTokens":100}`},
+		{name: "not reported", want: `usage {"uploadId":"batch-1","pageId":"page-1","calls":2,"inputTokens":0,"outputTokens":0}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			log.SetOutput(&logs)
+			defer log.SetOutput(os.Stderr)
+
+			page := makeTestJPEG(200, 600, [][2]int{{250, 290}})
+			h := &Handler{
+				qaMaxRetries: 1,
+				qaSampleRate: 1,
+				db: &mockDB{
+					queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+						if strings.Contains(sql, "upload_batches ub") && strings.Contains(sql, "JOIN aircraft") {
+							return []map[string]any{{"aircraft_id": "aircraft-1", "registration": "N123AB"}}, nil
+						}
+						return nil, nil
+					},
+				},
+				s3: &mockS3{
+					getObjectFn: func(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+						return io.NopCloser(bytes.NewReader(page)), nil
+					},
+				},
+				bucket: "test-bucket",
+				gemini: &gemini.MockClient{
+					GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+						for _, p := range parts {
+							if strings.Contains(p.Text, "QA specialist") {
+								return `{"results":[{"entryIndex":0,"verdict":"pass","issues":[],"summary":"OK"}]}`, nil
+							}
+						}
+						return `{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","entryType":"maintenance","maintenanceNarrative":"Changed oil","confidence":0.9}]}`, nil
+					},
+					UsageFn: func(parts []gemini.Part, text string) gemini.Usage {
+						if !tt.reported {
+							return gemini.Usage{}
+						}
+						return gemini.Usage{PromptTokens: 1000, CandidatesTokens: 50}
+					},
+				},
+				secrets: &mockSecrets{},
+			}
+
+			err := h.processPage(context.Background(), pageMessage{
+				UploadID:   "batch-1",
+				PageID:     "page-1",
+				PageNumber: 1,
+				S3Key:      "pages/batch-1/page_0001.jpg",
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !strings.Contains(logs.String(), tt.want+"\n") {
+				t.Errorf("log missing %s:\n%s", tt.want, logs.String())
+			}
+		})
+	}
 }
 
-func TestExtractAndVerifySlice_WithClaude(t *testing.T) {
-	// Claude available and used for QA — should call Claude, not Gemini for QA.
-	claudeCalls := 0
-	geminiQACalls := 0
+// ─── Tests: QA Verification ──────────────────────────────────────────────
+
+func TestExtractAndVerifySlice_QAPass(t *testing.T) {
+	// QA passes on first attempt — entries saved without review flag.
+	extractCalls := 0
+	qaCalls := 0
 
 	mockGemini := &gemini.MockClient{
 		GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
 			for _, p := range parts {
 				if strings.Contains(p.Text, "QA specialist") {
-					geminiQACalls++
-					return `{"results":[{"entryIndex":0,"verdict":"pass","issues":[],"summary":"OK"}]}`, nil
+					qaCalls++
+					return `{"results":[{"entryIndex":0,"verdict":"pass","issues":[],"summary":"All fields verified"}]}`, nil
 				}
 			}
-			return `{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","entryType":"maintenance","maintenanceNarrative":"Oil change","confidence":0.95}]}`, nil
-		},
-	}
-
-	mockClaude := &anthropic.MockClient{
-		CreateMessageFn: func(ctx context.Context, model string, maxTokens int64, messages []anthropic.Message) (string, error) {
-			claudeCalls++
-			if model != "claude-haiku-4-5-20251001" {
-				t.Errorf("expected claude-haiku-4-5-20251001, got %s", model)
-			}
-			return `{"results":[{"entryIndex":0,"verdict":"pass","issues":[],"summary":"All verified"}]}`, nil
+			extractCalls++
+			return `{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","entryType":"maintenance","maintenanceNarrative":"Changed oil and filter","confidence":0.95}]}`, nil
 		},
 	}
 
-	h := &Handler{
-		claude:  mockClaude,
-		secrets: &mockSecrets{},
-	}
+	h := &Handler{secrets: &mockSecrets{}, qaMaxRetries: 1, qaSampleRate: 1}
 
-	entries, _, err := h.extractAndVerifySlice(context.Background(), []byte("img"), "image/jpeg", mockGemini, 0, "page-1")
+	entries, pageType, err := h.extractAndVerifySlice(context.Background(), []byte("img"), "image/jpeg", mockGemini, SliceExtractionPrompt, 0, "page-1")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	if len(entries) != 1 {
 		t.Fatalf("expected 1 entry, got %d", len(entries))
 	}
-	if claudeCalls != 1 {
-		t.Errorf("claude calls = %d, want 1", claudeCalls)
+	if entries[0].NeedsReview {
+		t.Error("entry should not need review when QA passes")
 	}
-	if geminiQACalls != 0 {
-		t.Errorf("gemini QA calls = %d, want 0 (Claude should handle QA)", geminiQACalls)
+	if !entries[0].QAPassed {
+		t.Error("entry should be marked QA passed")
+	}
+	if pageType != "maintenance_entry" {
+		t.Errorf("pageType = %q, want %q", pageType, "maintenance_entry")
+	}
+	if extractCalls != 1 {
+		t.Errorf("extractCalls = %d, want 1", extractCalls)
+	}
+	if qaCalls != 1 {
+		t.Errorf("qaCalls = %d, want 1", qaCalls)
 	}
 }
 
-func TestProcessPage_WithQA(t *testing.T) {
-	// Full integration: processPage with QA using Claude mock.
+func TestExtractAndVerifySlice_QAFail_RetrySucceeds(t *testing.T) {
+	// QA fails on first attempt with critical issue, retry extraction passes QA.
 	extractCalls := 0
-	claudeQACalls := 0
-	insertCalls := 0
+	qaCalls := 0
 
-	db := &mockDB{
-		execFn: func(ctx context.Context, sql string, args ...any) error {
-			return nil
-		},
-		insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
-			insertCalls++
-			return fmt.Sprintf("entry-id-%d", insertCalls), nil
+	mockGemini := &gemini.MockClient{
+		GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+			for _, p := range parts {
+				if strings.Contains(p.Text, "QA specialist") {
+					qaCalls++
+					if qaCalls == 1 {
+						return `{"results":[{"entryIndex":0,"verdict":"fail","issues":[{"field":"maintenanceNarrative","issue":"truncated","expected":"full text here","extracted":"partial","severity":"critical"}],"summary":"Narrative truncated"}]}`, nil
+					}
+					return `{"results":[{"entryIndex":0,"verdict":"pass","issues":[],"summary":"All fields match after retry"}]}`, nil
+				}
+			}
+			extractCalls++
+			if extractCalls == 1 {
+				return `{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","entryType":"maintenance","maintenanceNarrative":"partial","confidence":0.9}]}`, nil
+			}
+			return `{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","entryType":"maintenance","maintenanceNarrative":"full text here","confidence":0.95}]}`, nil
 		},
-		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
-			if strings.Contains(sql, "upload_batches") {
-				return []map[string]any{{
+	}
+
+	h := &Handler{secrets: &mockSecrets{}, qaMaxRetries: 1, qaSampleRate: 1}
+
+	entries, _, err := h.extractAndVerifySlice(context.Background(), []byte("img"), "image/jpeg", mockGemini, SliceExtractionPrompt, 0, "page-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	if entries[0].NeedsReview {
+		t.Error("entry should not need review after successful retry")
+	}
+	if entries[0].MaintenanceNarrative != "full text here" {
+		t.Errorf("narrative = %q, want corrected version", entries[0].MaintenanceNarrative)
+	}
+	if extractCalls != 2 {
+		t.Errorf("extractCalls = %d, want 2", extractCalls)
+	}
+	if qaCalls != 2 {
+		t.Errorf("qaCalls = %d, want 2", qaCalls)
+	}
+}
+
+func TestExtractAndVerifySlice_RetryMergesFlaggedFieldsOnly(t *testing.T) {
+	// The retry fixes the flagged narrative but regresses the unflagged shop name.
+	// Only the flagged field should be taken from the retry.
+	qaCalls := 0
+	extractCalls := 0
+	var retryQAInput string
+
+	mockGemini := &gemini.MockClient{
+		GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+			for _, p := range parts {
+				if strings.Contains(p.Text, "QA specialist") {
+					qaCalls++
+					if qaCalls == 1 {
+						return `{"results":[{"entryIndex":0,"verdict":"fail","issues":[{"field":"maintenanceNarrative","issue":"truncated","severity":"critical"}],"summary":"Narrative truncated"}]}`, nil
+					}
+					retryQAInput = p.Text
+					return `{"results":[{"entryIndex":0,"verdict":"pass","issues":[],"summary":"OK"}]}`, nil
+				}
+			}
+			extractCalls++
+			if extractCalls == 1 {
+				return `{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","entryType":"maintenance","shopName":"Acme Aviation","maintenanceNarrative":"Changed oil","confidence":0.9}]}`, nil
+			}
+			return `{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","entryType":"maintenance","shopName":"Acme Avn","maintenanceNarrative":"Changed oil and filter, safety wired","confidence":0.93}]}`, nil
+		},
+	}
+
+	h := &Handler{secrets: &mockSecrets{}, qaMaxRetries: 1, qaSampleRate: 1}
+
+	entries, _, err := h.extractAndVerifySlice(context.Background(), []byte("img"), "image/jpeg", mockGemini, SliceExtractionPrompt, 0, "page-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	if entries[0].MaintenanceNarrative != "Changed oil and filter, safety wired" {
+		t.Errorf("narrative = %q, want retry value for flagged field", entries[0].MaintenanceNarrative)
+	}
+	if entries[0].ShopName != "Acme Aviation" {
+		t.Errorf("shopName = %q, want original value for unflagged field", entries[0].ShopName)
+	}
+	if !strings.Contains(retryQAInput, "Acme Aviation") {
+		t.Error("retry QA should verify the merged entry")
+	}
+}
+
+func TestMergeRetryEntries(t *testing.T) {
+	original := []extractedEntry{{Date: "2024-01-15", ShopName: "Acme", PartsActions: []partsActionRec{{PartNumber: "ABC-1"}}}}
+	retry := []extractedEntry{{Date: "2024-01-16", ShopName: "Acme Avn", PartsActions: []partsActionRec{{PartNumber: "ABC-7"}}}}
+
+	t.Run("nested field path", func(t *testing.T) {
+		got := mergeRetryEntries(original, retry, []qa.Result{{
+			EntryIndex: 0, Verdict: qa.Fail,
+			Issues: []qa.FieldIssue{{Field: "partsActions[0].partNumber", Issue: "incorrect", Severity: "critical"}},
+		}})
+		if got[0].PartsActions[0].PartNumber != "ABC-7" {
+			t.Errorf("partNumber = %q, want ABC-7", got[0].PartsActions[0].PartNumber)
+		}
+		if got[0].Date != "2024-01-15" || got[0].ShopName != "Acme" {
+			t.Errorf("unflagged fields changed: date=%q shop=%q", got[0].Date, got[0].ShopName)
+		}
+	})
+
+	t.Run("entry-level issue uses retry", func(t *testing.T) {
+		got := mergeRetryEntries(original, retry, []qa.Result{{
+			EntryIndex: 0, Verdict: qa.Fail,
+			Issues: []qa.FieldIssue{{Issue: "missing_entry", Severity: "critical"}},
+		}})
+		if got[0].ShopName != "Acme Avn" {
+			t.Errorf("shopName = %q, want retry value", got[0].ShopName)
+		}
+	})
+
+	t.Run("differing entry counts uses retry", func(t *testing.T) {
+		got := mergeRetryEntries(original, append(retry, extractedEntry{Date: "2024-02-01"}), nil)
+		if len(got) != 2 {
+			t.Errorf("len = %d, want 2", len(got))
+		}
+	})
+}
+
+func TestExtractAndVerifySlice_QAFail_MaxRetries(t *testing.T) {
+	// QA fails on both attempts — entries flagged for review.
+	mockGemini := &gemini.MockClient{
+		GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+			for _, p := range parts {
+				if strings.Contains(p.Text, "QA specialist") {
+					return `{"results":[{"entryIndex":0,"verdict":"fail","issues":[{"field":"date","issue":"incorrect","expected":"2024-02-15","extracted":"2024-01-15","severity":"critical"}],"summary":"Wrong date"}]}`, nil
+				}
+			}
+			return `{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","entryType":"maintenance","maintenanceNarrative":"Oil change","confidence":0.9}]}`, nil
+		},
+	}
+
+	h := &Handler{secrets: &mockSecrets{}, qaMaxRetries: 1, qaSampleRate: 1}
+
+	entries, _, err := h.extractAndVerifySlice(context.Background(), []byte("img"), "image/jpeg", mockGemini, SliceExtractionPrompt, 0, "page-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	if !entries[0].NeedsReview {
+		t.Error("entry should be flagged for review after max retries")
+	}
+}
+
+func TestExtractAndVerifySlice_ConfiguredRetries_PassOnThirdExtraction(t *testing.T) {
+	// With 2 retries, QA fails twice and passes on the third extraction.
+	extractCalls := 0
+	qaCalls := 0
+
+	mockGemini := &gemini.MockClient{
+		GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+			for _, p := range parts {
+				if strings.Contains(p.Text, "QA specialist") {
+					qaCalls++
+					if qaCalls < 3 {
+						return `{"results":[{"entryIndex":0,"verdict":"fail","issues":[{"field":"date","issue":"incorrect","expected":"2024-02-15","extracted":"wrong","severity":"critical"}],"summary":"Wrong date"}]}`, nil
+					}
+					return `{"results":[{"entryIndex":0,"verdict":"pass","issues":[],"summary":"OK"}]}`, nil
+				}
+			}
+			extractCalls++
+			date := "2024-01-1" + strconv.Itoa(extractCalls)
+			if extractCalls == 3 {
+				date = "2024-02-15"
+			}
+			return `{"pageType":"maintenance_entry","entries":[{"date":"` + date + `","entryType":"maintenance","maintenanceNarrative":"Oil change","confidence":0.9}]}`, nil
+		},
+	}
+
+	h := &Handler{secrets: &mockSecrets{}, qaMaxRetries: 2, qaSampleRate: 1}
+
+	entries, _, err := h.extractAndVerifySlice(context.Background(), []byte("img"), "image/jpeg", mockGemini, SliceExtractionPrompt, 0, "page-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if extractCalls != 3 || qaCalls != 3 {
+		t.Errorf("extractCalls = %d, qaCalls = %d, want 3 and 3", extractCalls, qaCalls)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	e := entries[0]
+	if e.Date != "2024-02-15" {
+		t.Errorf("date = %q, want the third extraction's value", e.Date)
+	}
+	if e.NeedsReview || !e.QAPassed {
+		t.Errorf("needsReview = %v, qaPassed = %v, want false and true", e.NeedsReview, e.QAPassed)
+	}
+	if e.QARetries != 2 || e.QAVerdict != "pass" {
+		t.Errorf("QA outcome = (%d retries, %q), want (2, pass)", e.QARetries, e.QAVerdict)
+	}
+}
+
+func TestExtractAndVerifySlice_RetriesKeepNotesOnce(t *testing.T) {
+	// Entry 0 needs review in every round; entry 1 fails every round and is
+	// re-extracted. Neither should pick up the same note twice.
+	mockGemini := &gemini.MockClient{
+		GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+			for _, p := range parts {
+				if strings.Contains(p.Text, "QA specialist") {
+					return `{"results":[` +
+						`{"entryIndex":0,"verdict":"needs_review","issues":[],"summary":"Certificate number ambiguous"},` +
+						`{"entryIndex":1,"verdict":"fail","issues":[{"field":"date","issue":"incorrect","expected":"2024-02-15","extracted":"2024-02-11","severity":"critical"}],"summary":"Wrong date"}]}`, nil
+				}
+			}
+			return `{"pageType":"maintenance_entry","entries":[` +
+				`{"date":"2024-01-15","entryType":"maintenance","maintenanceNarrative":"Oil change","confidence":0.9},` +
+				`{"date":"2024-02-11","entryType":"maintenance","maintenanceNarrative":"Replaced tire","confidence":0.9}]}`, nil
+		},
+	}
+
+	h := &Handler{secrets: &mockSecrets{}, qaMaxRetries: 3, qaSampleRate: 1}
+
+	entries, _, err := h.extractAndVerifySlice(context.Background(), []byte("img"), "image/jpeg", mockGemini, SliceExtractionPrompt, 0, "page-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if n := strings.Count(entries[0].ExtractionNotes, "QA: Certificate number ambiguous. "); n != 1 {
+		t.Errorf("entry 0 notes = %q, want the QA note once", entries[0].ExtractionNotes)
+	}
+	if n := strings.Count(entries[1].ExtractionNotes, "QA fail after retry: Wrong date. "); n != 1 {
+		t.Errorf("entry 1 notes = %q, want the retry failure once", entries[1].ExtractionNotes)
+	}
+	if got := rollupPageReview(entries).reasonSummary; got != "QA: Certificate number ambiguous; QA fail after retry: Wrong date" {
+		t.Errorf("page reason summary = %q", got)
+	}
+}
+
+func TestExtractAndVerifySlice_RetriesExhausted(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxRetries   int
+		wantExtracts int
+		wantRetries  int
+	}{
+		{"one retry", 1, 2, 1},
+		{"three retries", 3, 4, 3},
+		{"retries disabled", 0, 1, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			extractCalls := 0
+			mockGemini := &gemini.MockClient{
+				GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+					for _, p := range parts {
+						if strings.Contains(p.Text, "QA specialist") {
+							return `{"results":[{"entryIndex":0,"verdict":"fail","issues":[{"field":"date","issue":"incorrect","expected":"2024-02-15","extracted":"2024-01-15","severity":"critical"}],"summary":"Wrong date"}]}`, nil
+						}
+					}
+					extractCalls++
+					return `{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","entryType":"maintenance","maintenanceNarrative":"Oil change","confidence":0.9}]}`, nil
+				},
+			}
+
+			h := &Handler{secrets: &mockSecrets{}, qaMaxRetries: tt.maxRetries, qaSampleRate: 1}
+
+			entries, _, err := h.extractAndVerifySlice(context.Background(), []byte("img"), "image/jpeg", mockGemini, SliceExtractionPrompt, 0, "page-1")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if extractCalls != tt.wantExtracts {
+				t.Errorf("extractCalls = %d, want %d", extractCalls, tt.wantExtracts)
+			}
+			if len(entries) != 1 {
+				t.Fatalf("expected 1 entry, got %d", len(entries))
+			}
+			e := entries[0]
+			if !e.NeedsReview {
+				t.Error("entry should be flagged for review after retries are exhausted")
+			}
+			if e.QARetries != tt.wantRetries || e.QAVerdict != "fail" {
+				t.Errorf("QA outcome = (%d retries, %q), want (%d, fail)", e.QARetries, e.QAVerdict, tt.wantRetries)
+			}
+		})
+	}
+}
+
+func TestExtractAndVerifySlice_QANeedsReview(t *testing.T) {
+	// QA returns needs_review — accepted without retry, flagged for review.
+	mockGemini := &gemini.MockClient{
+		GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+			for _, p := range parts {
+				if strings.Contains(p.Text, "QA specialist") {
+					return `{"results":[{"entryIndex":0,"verdict":"needs_review","issues":[{"field":"mechanicCertificate","issue":"incorrect","expected":"unclear","extracted":"12345","severity":"minor"}],"summary":"Certificate number ambiguous"}]}`, nil
+				}
+			}
+			return `{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","entryType":"maintenance","maintenanceNarrative":"Oil change","mechanicCertificate":"12345","confidence":0.85}]}`, nil
+		},
+	}
+
+	h := &Handler{secrets: &mockSecrets{}}
+
+	entries, _, err := h.extractAndVerifySlice(context.Background(), []byte("img"), "image/jpeg", mockGemini, SliceExtractionPrompt, 0, "page-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	if !entries[0].NeedsReview {
+		t.Error("entry should be flagged for review with needs_review verdict")
+	}
+	if !strings.Contains(entries[0].ExtractionNotes, "Certificate number ambiguous") {
+		t.Errorf("extraction notes should contain QA summary, got: %q", entries[0].ExtractionNotes)
+	}
+}
+
+func TestExtractAndVerifySlice_ClaudeError(t *testing.T) {
+	// Claude client fails — falls back to Gemini for QA.
+	qaCalls := 0
+
+	mockGemini := &gemini.MockClient{
+		GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+			for _, p := range parts {
+				if strings.Contains(p.Text, "QA specialist") {
+					qaCalls++
+					return `{"results":[{"entryIndex":0,"verdict":"pass","issues":[],"summary":"OK"}]}`, nil
+				}
+			}
+			return `{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","entryType":"maintenance","maintenanceNarrative":"Oil change","confidence":0.95}]}`, nil
+		},
+	}
+
+	mockClaude := &anthropic.MockClient{
+		CreateMessageFn: func(ctx context.Context, model string, maxTokens int64, messages []anthropic.Message) (string, error) {
+			return "", fmt.Errorf("claude API error")
+		},
+	}
+
+	h := &Handler{
+		qaMaxRetries: 1,
+		qaSampleRate: 1,
+		claude:       mockClaude,
+		secrets:      &mockSecrets{},
+	}
+
+	entries, _, err := h.extractAndVerifySlice(context.Background(), []byte("img"), "image/jpeg", mockGemini, SliceExtractionPrompt, 0, "page-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	// Should have fallen back to Gemini QA
+	if qaCalls != 1 {
+		t.Errorf("gemini QA calls = %d, want 1 (fallback from Claude)", qaCalls)
+	}
+}
+
+func TestExtractAndVerifySlice_NoClaude(t *testing.T) {
+	// No Claude client configured — Gemini used for QA.
+	qaCalls := 0
+
+	mockGemini := &gemini.MockClient{
+		GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+			for _, p := range parts {
+				if strings.Contains(p.Text, "QA specialist") {
+					qaCalls++
+					return `{"results":[{"entryIndex":0,"verdict":"pass","issues":[],"summary":"OK"}]}`, nil
+				}
+			}
+			return `{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","entryType":"maintenance","maintenanceNarrative":"Oil change","confidence":0.95}]}`, nil
+		},
+	}
+
+	h := &Handler{
+		qaMaxRetries: 1,
+		qaSampleRate: 1,
+		// No claude client set — should use Gemini fallback
+		secrets: &mockSecrets{},
+	}
+
+	entries, _, err := h.extractAndVerifySlice(context.Background(), []byte("img"), "image/jpeg", mockGemini, SliceExtractionPrompt, 0, "page-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	if qaCalls != 1 {
+		t.Errorf("gemini QA calls = %d, want 1", qaCalls)
+	}
+}
+
+func TestExtractAndVerifySlice_Sampling(t *testing.T) {
+	temp, topP, topK := float32(0.4), float32(0.8), int32(20)
+	tests := []struct {
+		name     string
+		sampling gemini.GenerateConfig
+		want     string
+	}{
+		{name: "defaults", want: "temp=0.1 topP=<nil> topK=<nil> mime=application/json"},
+		{
+			name:     "configured",
+			sampling: gemini.GenerateConfig{Temperature: &temp, TopP: &topP, TopK: &topK},
+			want:     "temp=0.4 topP=0.8 topK=20 mime=application/json",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var extractConfig, qaConfig *gemini.GenerateConfig
+			mockGemini := &gemini.MockClient{
+				GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+					for _, p := range parts {
+						if strings.Contains(p.Text, "QA specialist") {
+							qaConfig = config
+							return `{"results":[{"entryIndex":0,"verdict":"pass","issues":[],"summary":"OK"}]}`, nil
+						}
+					}
+					extractConfig = config
+					return `{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","entryType":"maintenance","maintenanceNarrative":"Oil change","confidence":0.95}]}`, nil
+				},
+			}
+			h := &Handler{secrets: &mockSecrets{}, sampling: tt.sampling, qaMaxRetries: 1, qaSampleRate: 1}
+
+			if _, _, err := h.extractAndVerifySlice(context.Background(), []byte("img"), "image/jpeg", mockGemini, SliceExtractionPrompt, 0, "page-1"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if extractConfig == nil || qaConfig == nil {
+				t.Fatal("expected an extraction call and a QA call")
+			}
+			got := fmt.Sprintf("temp=%v topP=%v topK=%v mime=%s", deref(extractConfig.Temperature),
+				deref(extractConfig.TopP), deref(extractConfig.TopK), extractConfig.ResponseMIMEType)
+			if got != tt.want {
+				t.Errorf("extraction config = %s, want %s", got, tt.want)
+			}
+			if qaConfig.TopP != nil || qaConfig.TopK != nil || *qaConfig.Temperature == temp {
+				t.Errorf("QA config picked up extraction sampling: %+v", qaConfig)
+			}
+		})
+	}
+}
+
+// deref returns *p, or nil for a nil pointer, for printing optional fields.
+func deref[T any](p *T) any {
+	if p == nil {
+		return nil
+	}
+	return *p
+}
+
+func TestExtractAndVerifySlice_EmptyExtraction(t *testing.T) {
+	// Empty extraction (blank/header slice) — QA skipped entirely.
+	qaCalls := 0
+
+	mockGemini := &gemini.MockClient{
+		GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+			for _, p := range parts {
+				if strings.Contains(p.Text, "QA specialist") {
+					qaCalls++
+					return `{"results":[]}`, nil
+				}
+			}
+			return `{"pageType":"blank","entries":[]}`, nil
+		},
+	}
+
+	h := &Handler{secrets: &mockSecrets{}}
+
+	entries, pageType, err := h.extractAndVerifySlice(context.Background(), []byte("img"), "image/jpeg", mockGemini, SliceExtractionPrompt, 0, "page-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected 0 entries, got %d", len(entries))
+	}
+	if pageType != "blank" {
+		t.Errorf("pageType = %q, want %q", pageType, "blank")
+	}
+	if qaCalls != 0 {
+		t.Errorf("QA should be skipped for empty extraction, got %d calls", qaCalls)
+	}
+}
+
+func TestBuildRetryPrompt(t *testing.T) {
+	// No issues — returns base prompt.
+	t.Run("no issues", func(t *testing.T) {
+		result := buildRetryPrompt(SliceExtractionPrompt, nil)
+		if result != SliceExtractionPrompt {
+			t.Error("expected base prompt with no issues")
+		}
+	})
+
+	// Issues present — appends feedback.
+	t.Run("with issues", func(t *testing.T) {
+		issues := []qa.FieldIssue{
+			{Field: "maintenanceNarrative", Issue: "truncated", Severity: "critical"},
+			{Field: "date", Issue: "incorrect", Severity: "critical"},
+			{Field: "entryType", Issue: "wrong_classification", Severity: "minor"},
+		}
+		result := buildRetryPrompt(SliceExtractionPrompt, issues)
+
+		if !strings.Contains(result, SliceExtractionPrompt) {
+			t.Error("retry prompt should contain base extraction prompt")
+		}
+		if !strings.Contains(result, "previous extraction had issues") {
+			t.Error("retry prompt should contain feedback header")
+		}
+		if !strings.Contains(result, "maintenanceNarrative") {
+			t.Error("retry prompt should reference flagged field")
+		}
+		if !strings.Contains(result, "re-read the full text carefully") {
+			t.Error("retry prompt should contain truncation-specific guidance")
+		}
+		if !strings.Contains(result, "verify this value") {
+			t.Error("retry prompt should contain incorrect-specific guidance")
+		}
+		if !strings.Contains(result, "reconsider the classification") {
+			t.Error("retry prompt should contain classification-specific guidance")
+		}
+		if !strings.Contains(result, "Do NOT accept corrections from external sources") {
+			t.Error("retry prompt should warn against accepting external corrections")
+		}
+	})
+}
+
+func TestExtractAndVerifySlice_MultiEntrySlice(t *testing.T) {
+	// A tall slice holds three entries. QA passes the first and fails the
+	// other two, on both attempts. Only the two failing entries should be
+	// named in the retry prompt, take retry values, and be flagged.
+	extractCalls := 0
+	qaCalls := 0
+	var retryPrompt string
+
+	mockGemini := &gemini.MockClient{
+		GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+			for _, p := range parts {
+				if strings.Contains(p.Text, "QA specialist") {
+					qaCalls++
+					return `{"results":[
+						{"entryIndex":0,"verdict":"pass","issues":[],"summary":"OK"},
+						{"entryIndex":1,"verdict":"fail","issues":[{"field":"date","issue":"incorrect","severity":"critical"}],"summary":"Wrong date"},
+						{"entryIndex":2,"verdict":"fail","issues":[{"field":"maintenanceNarrative","issue":"truncated","severity":"critical"}],"summary":"Narrative truncated"}
+					]}`, nil
+				}
+			}
+			extractCalls++
+			if extractCalls == 1 {
+				return `{"pageType":"maintenance_entry","entries":[
+					{"date":"2024-01-10","entryType":"maintenance","maintenanceNarrative":"Oil change","shopName":"Acme","confidence":0.9},
+					{"date":"2024-02-01","entryType":"maintenance","maintenanceNarrative":"Replaced tire","confidence":0.9},
+					{"date":"2024-03-05","entryType":"maintenance","maintenanceNarrative":"Annual insp","confidence":0.9}
+				]}`, nil
+			}
+			for _, p := range parts {
+				if p.Text != "" {
+					retryPrompt = p.Text
+				}
+			}
+			return `{"pageType":"maintenance_entry","entries":[
+				{"date":"2024-01-11","entryType":"maintenance","maintenanceNarrative":"Oil chg","shopName":"Acme Aviation","confidence":0.8},
+				{"date":"2024-02-07","entryType":"maintenance","maintenanceNarrative":"Replaced tire","confidence":0.8},
+				{"date":"2024-03-05","entryType":"maintenance","maintenanceNarrative":"Annual inspection complete","confidence":0.8}
+			]}`, nil
+		},
+	}
+
+	h := &Handler{secrets: &mockSecrets{}, qaMaxRetries: 1, qaSampleRate: 1}
+
+	entries, _, err := h.extractAndVerifySlice(context.Background(), []byte("img"), "image/jpeg", mockGemini, SliceExtractionPrompt, 0, "page-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if extractCalls != 2 || qaCalls != 2 {
+		t.Errorf("extractCalls = %d, qaCalls = %d, want 2 and 2", extractCalls, qaCalls)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+
+	for _, want := range []string{"Entry 2 of 3 (dated 2024-02-01)", "Entry 3 of 3 (dated 2024-03-05)", "Entries 1 passed verification"} {
+		if !strings.Contains(retryPrompt, want) {
+			t.Errorf("retry prompt missing %q", want)
+		}
+	}
+	if strings.Contains(retryPrompt, "Entry 1 of 3") {
+		t.Error("retry prompt should not carry feedback for the passing entry")
+	}
+	if i := strings.Index(retryPrompt, "Entry 3 of 3"); i < 0 || !strings.Contains(retryPrompt[i:], `"maintenanceNarrative"`) || strings.Contains(retryPrompt[i:], `"date"`) {
+		t.Error("entry 3 feedback should cover only its own flagged field")
+	}
+
+	// The passing entry keeps its original values and stays out of review.
+	if e := entries[0]; e.NeedsReview || !e.QAPassed || e.QAVerdict != "pass" {
+		t.Errorf("entry 0: needsReview = %v, qaPassed = %v, verdict = %q", e.NeedsReview, e.QAPassed, e.QAVerdict)
+	}
+	if entries[0].MaintenanceNarrative != "Oil change" || entries[0].ShopName != "Acme" {
+		t.Errorf("entry 0 took retry values: %+v", entries[0])
+	}
+
+	// The failing entries take only their flagged fields from the retry.
+	if entries[1].Date != "2024-02-07" || entries[2].MaintenanceNarrative != "Annual inspection complete" {
+		t.Errorf("flagged fields not taken from retry: %q, %q", entries[1].Date, entries[2].MaintenanceNarrative)
+	}
+	for _, i := range []int{1, 2} {
+		if e := entries[i]; !e.NeedsReview || e.QAPassed || e.QAVerdict != "fail" || e.QARetries != 1 {
+			t.Errorf("entry %d: needsReview = %v, qaPassed = %v, verdict = %q, retries = %d", i, e.NeedsReview, e.QAPassed, e.QAVerdict, e.QARetries)
+		}
+	}
+}
+
+func TestExtractAndVerifySlice_EntryWithoutVerdict(t *testing.T) {
+	// QA only judges the first of two entries; the other is flagged.
+	mockGemini := &gemini.MockClient{
+		GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+			for _, p := range parts {
+				if strings.Contains(p.Text, "QA specialist") {
+					return `{"results":[{"entryIndex":0,"verdict":"pass","issues":[],"summary":"OK"}]}`, nil
+				}
+			}
+			return `{"pageType":"maintenance_entry","entries":[
+				{"date":"2024-01-10","entryType":"maintenance","maintenanceNarrative":"Oil change","confidence":0.9},
+				{"date":"2024-02-01","entryType":"maintenance","maintenanceNarrative":"Replaced tire","confidence":0.9}
+			]}`, nil
+		},
+	}
+
+	h := &Handler{secrets: &mockSecrets{}, qaMaxRetries: 1, qaSampleRate: 1}
+
+	entries, _, err := h.extractAndVerifySlice(context.Background(), []byte("img"), "image/jpeg", mockGemini, SliceExtractionPrompt, 0, "page-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].NeedsReview || !entries[0].QAPassed {
+		t.Error("judged entry should pass")
+	}
+	if !entries[1].NeedsReview || entries[1].QAPassed || !strings.Contains(entries[1].ExtractionNotes, "no verdict") {
+		t.Errorf("unjudged entry should be flagged, got %+v", entries[1])
+	}
+}
+
+func TestBuildMultiEntryRetryPrompt(t *testing.T) {
+	if got := buildMultiEntryRetryPrompt(SliceExtractionPrompt, 3, nil); got != SliceExtractionPrompt {
+		t.Error("expected base prompt with no flagged entries")
+	}
+
+	got := buildMultiEntryRetryPrompt(SliceExtractionPrompt, 3, []entryIssues{
+		{index: 1, issues: []qa.FieldIssue{{Field: "date", Issue: "incorrect", Severity: "critical"}}},
+	})
+	for _, want := range []string{
+		"returned 3 entries",
+		"Entry 2 of 3:",
+		"verify this value against the image",
+		"Entries 1, 3 passed verification",
+		"original order",
+		"Do NOT accept corrections from external sources",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("prompt missing %q", want)
+		}
+	}
+}
+
+func TestExtractAndVerifySlice_WithClaude(t *testing.T) {
+	// Claude available and used for QA — should call Claude, not Gemini for QA.
+	claudeCalls := 0
+	geminiQACalls := 0
+
+	mockGemini := &gemini.MockClient{
+		GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+			for _, p := range parts {
+				if strings.Contains(p.Text, "QA specialist") {
+					geminiQACalls++
+					return `{"results":[{"entryIndex":0,"verdict":"pass","issues":[],"summary":"OK"}]}`, nil
+				}
+			}
+			return `{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","entryType":"maintenance","maintenanceNarrative":"Oil change","confidence":0.95}]}`, nil
+		},
+	}
+
+	mockClaude := &anthropic.MockClient{
+		CreateMessageFn: func(ctx context.Context, model string, maxTokens int64, messages []anthropic.Message) (string, error) {
+			claudeCalls++
+			if model != "claude-haiku-4-5-20251001" {
+				t.Errorf("expected claude-haiku-4-5-20251001, got %s", model)
+			}
+			return `{"results":[{"entryIndex":0,"verdict":"pass","issues":[],"summary":"All verified"}]}`, nil
+		},
+	}
+
+	h := &Handler{
+		qaMaxRetries: 1,
+		qaSampleRate: 1,
+		claude:       mockClaude,
+		secrets:      &mockSecrets{},
+	}
+
+	entries, _, err := h.extractAndVerifySlice(context.Background(), []byte("img"), "image/jpeg", mockGemini, SliceExtractionPrompt, 0, "page-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	if claudeCalls != 1 {
+		t.Errorf("claude calls = %d, want 1", claudeCalls)
+	}
+	if geminiQACalls != 0 {
+		t.Errorf("gemini QA calls = %d, want 0 (Claude should handle QA)", geminiQACalls)
+	}
+}
+
+func TestProcessPage_WithQA(t *testing.T) {
+	// Full integration: processPage with QA using Claude mock.
+	extractCalls := 0
+	claudeQACalls := 0
+	insertCalls := 0
+
+	db := &mockDB{
+		execFn: func(ctx context.Context, sql string, args ...any) error {
+			return nil
+		},
+		insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+			insertCalls++
+			return fmt.Sprintf("entry-id-%d", insertCalls), nil
+		},
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			if strings.Contains(sql, "upload_batches") {
+				return []map[string]any{{
 					"aircraft_id":   "aircraft-1",
 					"registration":  "N123AB",
 					"serial_number": "12345",
@@ -1925,31 +3616,1773 @@ func TestProcessPage_WithQA(t *testing.T) {
 					"model":         "172N",
 				}}, nil
 			}
-			return []map[string]any{{
-				"total":  int64(1),
-				"done":   int64(1),
-				"failed": int64(0),
-			}}, nil
+			return []map[string]any{{
+				"total":  int64(1),
+				"done":   int64(1),
+				"failed": int64(0),
+			}}, nil
+		},
+	}
+
+	h := &Handler{
+		qaMaxRetries: 1,
+		qaSampleRate: 1,
+		db:           db,
+		s3:           &mockS3{},
+		bucket:       "test-bucket",
+		gemini: &gemini.MockClient{
+			GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+				extractCalls++
+				return `{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","entryType":"maintenance","maintenanceNarrative":"Changed oil and filter per SB 1234","confidence":0.95}]}`, nil
+			},
+			EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
+				return make([]float32, gemini.DefaultEmbeddingDimensions), nil
+			},
+		},
+		claude: &anthropic.MockClient{
+			CreateMessageFn: func(ctx context.Context, model string, maxTokens int64, messages []anthropic.Message) (string, error) {
+				claudeQACalls++
+				return `{"results":[{"entryIndex":0,"verdict":"pass","issues":[],"summary":"Verified"}]}`, nil
+			},
+		},
+		secrets: &mockSecrets{},
+	}
+
+	err := h.processPage(context.Background(), pageMessage{
+		UploadID:   "batch-1",
+		PageID:     "page-1",
+		PageNumber: 1,
+		S3Key:      "pages/batch-1/page_0001.jpg",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if extractCalls != 1 {
+		t.Errorf("extractCalls = %d, want 1", extractCalls)
+	}
+	if claudeQACalls != 1 {
+		t.Errorf("claudeQACalls = %d, want 1", claudeQACalls)
+	}
+	if insertCalls != 1 {
+		t.Errorf("insertCalls = %d, want 1", insertCalls)
+	}
+}
+
+// TestQAWithRealLLMs sends an image through extraction + QA with real APIs.
+//
+// Usage:
+//
+//	GEMINI_API_KEY=... ANTHROPIC_API_KEY=... TEST_IMAGE_PATH=/path/to/slice.jpg go test ./analyze/ -run TestQAWithRealLLMs -v -count=1
+func TestProcessPage_WeightBalanceRevision(t *testing.T) {
+	// A W&B narrative triggers the dedicated extraction and persists the revision.
+	wbCalls := 0
+	var wbArgs []any
+
+	db := &mockDB{
+		execFn: func(ctx context.Context, sql string, args ...any) error {
+			if strings.Contains(sql, "weight_balance_revisions") {
+				wbArgs = args
+			}
+			return nil
+		},
+		insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+			return "entry-id-1", nil
+		},
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			if strings.Contains(sql, "upload_batches") {
+				return []map[string]any{{"aircraft_id": "aircraft-1", "registration": "N123AB"}}, nil
+			}
+			return []map[string]any{{"total": int64(1), "done": int64(1), "failed": int64(0)}}, nil
+		},
+	}
+
+	h := &Handler{
+		db:     db,
+		s3:     &mockS3{},
+		bucket: "test-bucket",
+		gemini: &gemini.MockClient{
+			GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+				for _, p := range parts {
+					if strings.Contains(p.Text, "weight-and-balance specialist") {
+						wbCalls++
+						if model != extractionModel {
+							t.Errorf("W&B model = %s, want %s", model, extractionModel)
+						}
+						return `{"emptyWeight":"1,650.5 lbs","emptyCG":"38.2 in.","usefulLoad":null,"equipmentChanges":"Installed GTN 650"}`, nil
+					}
+					if strings.Contains(p.Text, "QA specialist") {
+						return `{"results":[{"entryIndex":0,"verdict":"pass","issues":[],"summary":"Verified"}]}`, nil
+					}
+				}
+				return `{"pageType":"maintenance_entry","entries":[{"date":"2024-03-01","entryType":"maintenance","maintenanceNarrative":"Installed Garmin GTN 650. Revised W&B, new empty weight 1650.5","confidence":0.95}]}`, nil
+			},
+			EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
+				return make([]float32, gemini.DefaultEmbeddingDimensions), nil
+			},
+		},
+		secrets: &mockSecrets{},
+	}
+
+	err := h.processPage(context.Background(), pageMessage{
+		UploadID:   "batch-1",
+		PageID:     "page-1",
+		PageNumber: 1,
+		S3Key:      "pages/batch-1/page_0001.jpg",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if wbCalls != 1 {
+		t.Fatalf("wbCalls = %d, want 1", wbCalls)
+	}
+	if wbArgs == nil {
+		t.Fatal("expected weight_balance_revisions insert")
+	}
+	if wbArgs[1] != "entry-id-1" || wbArgs[2] != "2024-03-01" {
+		t.Errorf("entry/date = %v/%v, want entry-id-1/2024-03-01", wbArgs[1], wbArgs[2])
+	}
+	if wbArgs[3] != 1650.5 {
+		t.Errorf("empty_weight = %v, want 1650.5", wbArgs[3])
+	}
+	if wbArgs[4] != 38.2 {
+		t.Errorf("empty_cg = %v, want 38.2", wbArgs[4])
+	}
+	if wbArgs[5] != nil {
+		t.Errorf("useful_load = %v, want nil", wbArgs[5])
+	}
+}
+
+func TestIsWeightBalanceEntry(t *testing.T) {
+	tests := []struct {
+		narrative string
+		pageType  string
+		want      bool
+	}{
+		{"Revised W&B per installation", "maintenance_entry", true},
+		{"New weight and balance computed", "maintenance_entry", true},
+		{"Empty weight 1612.0 lbs useful load 688", "maintenance_entry", true},
+		{"Changed oil and filter", "maintenance_entry", false},
+		{"", "weight_balance", true},
+	}
+	for _, tt := range tests {
+		entry := &extractedEntry{MaintenanceNarrative: tt.narrative}
+		if got := isWeightBalanceEntry(entry, tt.pageType); got != tt.want {
+			t.Errorf("isWeightBalanceEntry(%q, %q) = %v, want %v", tt.narrative, tt.pageType, got, tt.want)
+		}
+	}
+}
+
+func TestQAWithRealLLMs(t *testing.T) {
+	geminiKey := os.Getenv("GEMINI_API_KEY")
+	imgPath := os.Getenv("TEST_IMAGE_PATH")
+	if geminiKey == "" || imgPath == "" {
+		t.Skip("set GEMINI_API_KEY and TEST_IMAGE_PATH to run this test")
+	}
+
+	ctx := context.Background()
+	geminiClient, err := gemini.New(ctx, geminiKey)
+	if err != nil {
+		t.Fatalf("create gemini client: %v", err)
+	}
+
+	data, err := os.ReadFile(imgPath)
+	if err != nil {
+		t.Fatalf("read image: %v", err)
+	}
+	t.Logf("Image: %s (%d bytes)", imgPath, len(data))
+
+	h := &Handler{secrets: &mockSecrets{}}
+
+	// Set up Claude if key is available
+	anthropicKey := os.Getenv("ANTHROPIC_API_KEY")
+	if anthropicKey != "" {
+		h.claude = anthropic.New(anthropicKey)
+		t.Log("Using Claude for QA")
+	} else {
+		t.Log("No ANTHROPIC_API_KEY set, using Gemini for QA")
+	}
+
+	entries, pageType, err := h.extractAndVerifySlice(ctx, data, "image/jpeg", geminiClient, SliceExtractionPrompt, 0, "test-page")
+	if err != nil {
+		t.Fatalf("extract+verify failed: %v", err)
+	}
+
+	t.Logf("pageType=%q, entries=%d", pageType, len(entries))
+	for i, e := range entries {
+		t.Logf("  Entry %d: date=%s type=%s needsReview=%v", i, e.Date, e.EntryType, e.NeedsReview)
+		if e.ExtractionNotes != "" {
+			t.Logf("    Notes: %s", e.ExtractionNotes)
+		}
+		if len(e.MaintenanceNarrative) > 100 {
+			t.Logf("    Narrative: %.100s...", e.MaintenanceNarrative)
+		} else {
+			t.Logf("    Narrative: %s", e.MaintenanceNarrative)
+		}
+	}
+}
+
+// TestExtractionWithRealLLM sends an image through the actual Gemini API with
+// the SliceExtractionPrompt and prints the response. Use this to verify LLM
+// behavior on specific images (e.g., scanner backgrounds, blank pages).
+//
+// Usage:
+//
+//	GEMINI_API_KEY=... TEST_IMAGE_PATH=/tmp/slicer-pdf-batch/.../slice_001.jpg go test ./analyze/ -run TestExtractionWithRealLLM -v -count=1
+func TestExtractionWithRealLLM(t *testing.T) {
+	apiKey := os.Getenv("GEMINI_API_KEY")
+	imgPath := os.Getenv("TEST_IMAGE_PATH")
+	if apiKey == "" || imgPath == "" {
+		t.Skip("set GEMINI_API_KEY and TEST_IMAGE_PATH to run this test")
+	}
+
+	ctx := context.Background()
+	client, err := gemini.New(ctx, apiKey)
+	if err != nil {
+		t.Fatalf("create gemini client: %v", err)
+	}
+
+	data, err := os.ReadFile(imgPath)
+	if err != nil {
+		t.Fatalf("read image: %v", err)
+	}
+	t.Logf("Image: %s (%d bytes)", imgPath, len(data))
+
+	temp := float32(0.1)
+	resp, err := client.GenerateContent(ctx, "gemini-2.5-flash", []gemini.Part{
+		{Text: SliceExtractionPrompt},
+		{Data: data, MIMEType: "image/jpeg"},
+	}, &gemini.GenerateConfig{
+		Temperature:      &temp,
+		ResponseMIMEType: "application/json",
+	})
+	if err != nil {
+		t.Fatalf("gemini call failed: %v", err)
+	}
+
+	// Pretty-print the JSON response.
+	var parsed json.RawMessage
+	if err := json.Unmarshal([]byte(resp), &parsed); err != nil {
+		t.Logf("Raw response (not JSON): %s", resp)
+	} else {
+		pretty, _ := json.MarshalIndent(parsed, "", "  ")
+		t.Logf("Response:\n%s", pretty)
+	}
+
+	// Parse and check entries.
+	var result extractionResult
+	if err := json.Unmarshal([]byte(resp), &result); err != nil {
+		t.Fatalf("parse response: %v", err)
+	}
+	t.Logf("pageType=%q, entries=%d", result.PageType, len(result.Entries))
+}
+
+func TestExtractBatchID(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"pages/batch-123/page_0001.jpg", "batch-123"},
+		{"pages/abc-def-ghi/page_0003.jpg", "abc-def-ghi"},
+		{"singlepart", "unknown"},
+		{"a/b/c/d", "b"},
+	}
+	for _, tt := range tests {
+		got := extractBatchID(tt.key)
+		if got != tt.want {
+			t.Errorf("extractBatchID(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
+
+func TestProcessPage_ImageTooLarge(t *testing.T) {
+	testJPEG := makeTestJPEG(200, 600, [][2]int{{50, 130}})
+
+	s3Mock := &mockS3{
+		getObjectFn: func(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(testJPEG)), nil
+		},
+	}
+	db := &mockDB{
+		execFn: func(ctx context.Context, sql string, args ...any) error { return nil },
+	}
+
+	geminiCalls := 0
+	h := &Handler{
+		db:             db,
+		s3:             s3Mock,
+		bucket:         "test-bucket",
+		maxImagePixels: 20000, // 120,000-pixel page is over the budget
+		gemini: &gemini.MockClient{
+			GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+				geminiCalls++
+				return `{"pageType":"unknown","entries":[]}`, nil
+			},
+		},
+		secrets: &mockSecrets{},
+	}
+
+	err := h.processPage(context.Background(), pageMessage{
+		UploadID:   "batch-1",
+		PageID:     "page-1",
+		PageNumber: 1,
+		S3Key:      "pages/batch-1/page_0001.jpg",
+	})
+	if !errors.Is(err, imageutil.ErrImageTooLarge) {
+		t.Fatalf("expected ErrImageTooLarge, got %v", err)
+	}
+	if geminiCalls != 0 {
+		t.Errorf("gemini called %d times, want 0", geminiCalls)
+	}
+	if len(s3Mock.putCalls) != 0 {
+		t.Errorf("s3 putCalls = %d, want 0", len(s3Mock.putCalls))
+	}
+}
+
+func TestRollupPageReview(t *testing.T) {
+	tests := []struct {
+		name        string
+		entries     []extractedEntry
+		wantReview  bool
+		wantMin     any // float64, or nil for no confidence
+		wantReasons string
+	}{
+		{
+			name:    "no entries",
+			entries: nil,
+			wantMin: nil,
+		},
+		{
+			name: "all clean",
+			entries: []extractedEntry{
+				{Confidence: 0.95},
+				{Confidence: 0.9},
+			},
+			wantMin: 0.9,
+		},
+		{
+			name: "lowest confidence entry wins",
+			entries: []extractedEntry{
+				{Confidence: 0.92},
+				{Confidence: "0.41", NeedsReview: true, ExtractionNotes: "QA: Date unclear. "},
+				{Confidence: 0.77},
+			},
+			wantReview:  true,
+			wantMin:     0.41,
+			wantReasons: "QA: Date unclear",
+		},
+		{
+			name: "distinct reasons concatenated in order",
+			entries: []extractedEntry{
+				{Confidence: 0.6, NeedsReview: true, ExtractionNotes: "QA: Tach illegible. QA returned no verdict for this entry. "},
+				{Confidence: 0.5, NeedsReview: true, ExtractionNotes: "QA returned no verdict for this entry. "},
+				{Confidence: 0.7, NeedsReview: true, ExtractionNotes: `Aircraft identity mismatch: serial "123" != "456"`},
+			},
+			wantReview:  true,
+			wantMin:     0.5,
+			wantReasons: `QA: Tach illegible; QA returned no verdict for this entry; Aircraft identity mismatch: serial "123" != "456"`,
+		},
+		{
+			name: "notes on entries not needing review are ignored",
+			entries: []extractedEntry{
+				{Confidence: 0.9, ExtractionNotes: "Smudged signature. "},
+				{NeedsReview: true, ExtractionNotes: "QA: Date unclear. "},
+			},
+			wantReview:  true,
+			wantMin:     0.9,
+			wantReasons: "QA: Date unclear",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rollupPageReview(tt.entries)
+			if got.needsReview != tt.wantReview {
+				t.Errorf("needsReview = %v, want %v", got.needsReview, tt.wantReview)
+			}
+			switch {
+			case tt.wantMin == nil && got.minConfidence != nil:
+				t.Errorf("minConfidence = %v, want nil", *got.minConfidence)
+			case tt.wantMin != nil && got.minConfidence == nil:
+				t.Errorf("minConfidence = nil, want %v", tt.wantMin)
+			case tt.wantMin != nil && *got.minConfidence != tt.wantMin.(float64):
+				t.Errorf("minConfidence = %v, want %v", *got.minConfidence, tt.wantMin)
+			}
+			if got.reasonSummary != tt.wantReasons {
+				t.Errorf("reasonSummary = %q, want %q", got.reasonSummary, tt.wantReasons)
+			}
+		})
+	}
+}
+
+func TestProcessPage_OriginalSlice(t *testing.T) {
+	// One band leaves the page whole, so the PNG goes out as it was uploaded.
+	img, err := jpeg.Decode(bytes.NewReader(makeTestJPEG(200, 300, [][2]int{{100, 200}})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var page bytes.Buffer
+	if err := png.Encode(&page, img); err != nil {
+		t.Fatal(err)
+	}
+
+	s3Mock := &mockS3{
+		getObjectFn: func(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(page.Bytes())), nil
+		},
+	}
+	db := &mockDB{
+		execFn: func(ctx context.Context, sql string, args ...any) error { return nil },
+		insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+			return "entry-id-1", nil
+		},
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			if strings.Contains(sql, "upload_batches") {
+				return []map[string]any{{"aircraft_id": "aircraft-1", "registration": "N123AB"}}, nil
+			}
+			return []map[string]any{{"total": int64(1), "done": int64(1), "failed": int64(0)}}, nil
+		},
+	}
+
+	var sent [][]byte
+	var sentMIMEs []string
+	h := &Handler{
+		db:     db,
+		s3:     s3Mock,
+		bucket: "test-bucket",
+		gemini: &gemini.MockClient{
+			GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+				for _, p := range parts {
+					if p.Data != nil {
+						sent = append(sent, p.Data)
+						sentMIMEs = append(sentMIMEs, p.MIMEType)
+					}
+				}
+				for _, p := range parts {
+					if strings.Contains(p.Text, "QA specialist") {
+						return `{"results":[{"entryIndex":0,"verdict":"pass","issues":[],"summary":"OK"}]}`, nil
+					}
+				}
+				return `{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","entryType":"maintenance","maintenanceNarrative":"Changed oil","confidence":0.9}]}`, nil
+			},
+			EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
+				return make([]float32, gemini.DefaultEmbeddingDimensions), nil
+			},
+		},
+		secrets: &mockSecrets{},
+	}
+
+	err = h.processPage(context.Background(), pageMessage{
+		UploadID:   "batch-1",
+		PageID:     "page-1",
+		PageNumber: 1,
+		S3Key:      "pages/batch-1/page_0001.png",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(s3Mock.putCalls) != 1 {
+		t.Fatalf("s3 putCalls = %d, want 1", len(s3Mock.putCalls))
+	}
+	call := s3Mock.putCalls[0]
+	if !strings.HasSuffix(call.key, ".png") || call.contentType != "image/png" {
+		t.Errorf("put %s as %s, want a .png key stored as image/png", call.key, call.contentType)
+	}
+	if len(sent) == 0 {
+		t.Fatal("expected image parts sent to Gemini")
+	}
+	for i := range sent {
+		if sentMIMEs[i] != "image/png" || !bytes.Equal(sent[i], page.Bytes()) {
+			t.Errorf("Gemini got %d bytes of %s, want the original PNG", len(sent[i]), sentMIMEs[i])
+		}
+	}
+}
+
+func TestExtractSlice_ResponseSchema(t *testing.T) {
+	var extractConfig, qaConfig *gemini.GenerateConfig
+	mockGemini := &gemini.MockClient{
+		GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+			for _, p := range parts {
+				if strings.Contains(p.Text, "QA specialist") {
+					qaConfig = config
+					return `{"results":[{"entryIndex":0,"verdict":"pass","issues":[],"summary":"OK"}]}`, nil
+				}
+			}
+			extractConfig = config
+			// Fenced despite the schema; still parsed.
+			return "```json\n{\"pageType\":\"maintenance_entry\",\"entries\":[{\"date\":\"2024-01-15\",\"entryType\":\"maintenance\",\"maintenanceNarrative\":\"Changed oil\",\"confidence\":0.95}]}\n```", nil
+		},
+	}
+
+	h := &Handler{secrets: &mockSecrets{}}
+	entries, pageType, err := h.extractAndVerifySlice(context.Background(), []byte("img"), "image/jpeg", mockGemini, SliceExtractionPrompt, 0, "page-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 1 || entries[0].MaintenanceNarrative != "Changed oil" || pageType != "maintenance_entry" {
+		t.Errorf("got %d entries on a %q page, want the fenced entry parsed", len(entries), pageType)
+	}
+
+	if extractConfig == nil || extractConfig.ResponseSchema != extractionSchema {
+		t.Error("extraction call did not carry extractionSchema")
+	} else if extractConfig.ResponseMIMEType != "application/json" {
+		t.Errorf("extraction ResponseMIMEType = %q, want application/json", extractConfig.ResponseMIMEType)
+	}
+	if qaConfig != nil && qaConfig.ResponseSchema != nil {
+		t.Error("QA call should not carry the extraction schema")
+	}
+	// The shared config must not pick up the schema, or the W&B call would
+	// be held to it too.
+	if h.extractionConfig().ResponseSchema != nil {
+		t.Error("extractionConfig returned a response schema")
+	}
+}
+
+func TestExtractionSchema_MatchesEntry(t *testing.T) {
+	// Every field the model is asked for must be in the schema, or Gemini
+	// will never fill it in.
+	entrySchema := extractionSchema.Properties["entries"].Items
+	checkFields := func(t *testing.T, typ reflect.Type, s *gemini.Schema) {
+		t.Helper()
+		for i := range typ.NumField() {
+			name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+			if name == "" || name == "-" || name == "weightBalance" {
+				continue
+			}
+			if s.Properties[name] == nil {
+				t.Errorf("%s.%s is missing from the schema", typ.Name(), name)
+			}
+		}
+		if len(s.PropertyOrdering) != len(s.Properties) {
+			t.Errorf("%s schema orders %d of %d properties", typ.Name(), len(s.PropertyOrdering), len(s.Properties))
+		}
+	}
+	checkFields(t, reflect.TypeOf(extractionResult{}), extractionSchema)
+	checkFields(t, reflect.TypeOf(extractedEntry{}), entrySchema)
+	checkFields(t, reflect.TypeOf(adComplianceRec{}), entrySchema.Properties["adCompliance"].Items)
+	checkFields(t, reflect.TypeOf(partsActionRec{}), entrySchema.Properties["partsActions"].Items)
+}
+
+func TestSaveEntry_VectorUnavailable(t *testing.T) {
+	embedCalls, embedInserts := 0, 0
+	h := &Handler{
+		db: &mockDB{
+			insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+				return "entry-id-1", nil
+			},
+			execFn: func(ctx context.Context, sql string, args ...any) error {
+				if strings.Contains(sql, "maintenance_embeddings") {
+					embedInserts++
+					return fmt.Errorf("exec: %w", &pgconn.PgError{Code: "42704", Message: `type "halfvec" does not exist`})
+				}
+				return nil
+			},
+		},
+		gemini: &gemini.MockClient{
+			EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
+				embedCalls++
+				return make([]float32, gemini.DefaultEmbeddingDimensions), nil
+			},
+		},
+	}
+
+	for range 3 {
+		entry := &extractedEntry{
+			Date:                 "2024-01-15",
+			EntryType:            "maintenance",
+			MaintenanceNarrative: "Changed oil and filter",
+		}
+		// The entry itself is still saved.
+		if err := h.saveEntry(context.Background(), "aircraft-1", "page-1", entry); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if embedCalls != 1 || embedInserts != 1 {
+		t.Errorf("embedded %d and stored %d times, want 1 each before skipping", embedCalls, embedInserts)
+	}
+	if !h.vectorUnavailable {
+		t.Error("vectorUnavailable not set")
+	}
+}
+
+func TestCalibrateConfidence(t *testing.T) {
+	critical := qa.FieldIssue{Field: "date", Severity: "critical"}
+	minor := qa.FieldIssue{Field: "shopName", Severity: "minor"}
+
+	tests := []struct {
+		name       string
+		confidence any
+		verdict    string
+		issues     []qa.FieldIssue
+		retries    int
+		want       float64
+	}{
+		{"clean pass keeps model confidence", 0.95, "pass", nil, 0, 0.95},
+		{"pass after retry", 0.95, "pass", nil, 1, 0.9},
+		{"pass with minor issue", 0.95, "pass", []qa.FieldIssue{minor}, 0, 0.86},
+		{"needs review is capped", 0.95, "needs_review", []qa.FieldIssue{minor}, 0, 0.63},
+		{"fail is capped", 0.95, "fail", []qa.FieldIssue{critical}, 2, 0.22},
+		{"QA error is capped", 0.95, "error", nil, 0, 0.7},
+		{"no verdict is capped", 0.95, "", nil, 0, 0.7},
+		{"low model confidence stays low", 0.3, "pass", nil, 0, 0.3},
+		{"missing model confidence", nil, "pass", nil, 0, 0.5},
+		{"string model confidence", "0.8", "pass", nil, 0, 0.8},
+		{"out of range model confidence", 1.5, "pass", nil, 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &extractedEntry{Confidence: tt.confidence, QAVerdict: tt.verdict, QAIssues: tt.issues, QARetries: tt.retries}
+			calibrateConfidence(e)
+			if e.Confidence != tt.want {
+				t.Errorf("Confidence = %v, want %v", e.Confidence, tt.want)
+			}
+			if e.ModelConfidence != tt.confidence {
+				t.Errorf("ModelConfidence = %v, want %v", e.ModelConfidence, tt.confidence)
+			}
+		})
+	}
+}
+
+func TestExtractAndVerifySlice_CalibratesConfidence(t *testing.T) {
+	failed := `{"results":[{"entryIndex":0,"verdict":"fail","issues":[{"field":"date","issue":"wrong","expected":"2024-01-18","extracted":"2024-01-15","severity":"critical"}],"summary":"Wrong date"}]}`
+	passed := `{"results":[{"entryIndex":0,"verdict":"pass","issues":[],"summary":"OK"}]}`
+	flagged := `{"results":[{"entryIndex":0,"verdict":"needs_review","issues":[{"field":"shopName","issue":"unclear","expected":"unclear","extracted":"Acme","severity":"minor"}],"summary":"Shop name unclear"}]}`
+
+	tests := []struct {
+		name      string
+		qa        []string // QA responses, in order
+		want      float64
+		wantModel any
+	}{
+		{"pass keeps confidence high", []string{passed}, 0.95, 0.95},
+		{"needs review lowers confidence", []string{flagged}, 0.63, 0.95},
+		{"pass after retry", []string{failed, passed}, 0.9, 0.95},
+		{"fail after retries", []string{failed}, 0.23, 0.95},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qaCalls := 0
+			mockGemini := &gemini.MockClient{
+				GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+					for _, p := range parts {
+						if strings.Contains(p.Text, "QA specialist") {
+							qaCalls++
+							return tt.qa[min(qaCalls, len(tt.qa))-1], nil
+						}
+					}
+					return `{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","entryType":"maintenance","shopName":"Acme","maintenanceNarrative":"Changed oil","confidence":0.95}]}`, nil
+				},
+			}
+			h := &Handler{secrets: &mockSecrets{}, qaMaxRetries: 1, qaSampleRate: 1}
+
+			entries, _, err := h.extractAndVerifySlice(context.Background(), []byte("img"), "image/jpeg", mockGemini, SliceExtractionPrompt, 0, "page-1")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(entries) != 1 {
+				t.Fatalf("expected 1 entry, got %d", len(entries))
+			}
+			if entries[0].Confidence != tt.want {
+				t.Errorf("Confidence = %v, want %v", entries[0].Confidence, tt.want)
+			}
+			if entries[0].ModelConfidence != tt.wantModel {
+				t.Errorf("ModelConfidence = %v, want %v", entries[0].ModelConfidence, tt.wantModel)
+			}
+		})
+	}
+}
+
+func TestSaveEntry_ModelConfidence(t *testing.T) {
+	var gotArgs []any
+	db := &mockDB{
+		insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+			gotArgs = args
+			return "entry-id-1", nil
+		},
+	}
+	h := &Handler{db: db}
+
+	entry := &extractedEntry{
+		Date:                 "2024-01-15",
+		EntryType:            "maintenance",
+		MaintenanceNarrative: "Oil",
+		Confidence:           0.63,
+		ModelConfidence:      0.95,
+	}
+	if err := h.saveEntry(context.Background(), "aircraft-1", "page-1", entry); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotArgs[16] != 0.63 || gotArgs[28] != 0.95 {
+		t.Errorf("confidence args = (%v, %v), want (0.63, 0.95)", gotArgs[16], gotArgs[28])
+	}
+}
+
+func TestProcessPage_Candidate(t *testing.T) {
+	// The page doesn't split, so it is read with the full-page prompt.
+	version := promptVersion(MaintenanceExtractionPrompt)
+	var execs []string
+	var candidateArgs []any
+	inserts := 0
+	db := &mockDB{
+		execFn: func(ctx context.Context, sql string, args ...any) error {
+			execs = append(execs, sql)
+			if strings.Contains(sql, "raw_extraction_candidate") {
+				candidateArgs = args
+			}
+			return nil
+		},
+		insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+			inserts++
+			return "entry-id-1", nil
+		},
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			if strings.Contains(sql, "upload_batches ub") && strings.Contains(sql, "JOIN aircraft") {
+				return []map[string]any{{"aircraft_id": "aircraft-1", "registration": "N123AB"}}, nil
+			}
+			return nil, nil
+		},
+	}
+	embedCalls := 0
+	h := &Handler{
+		db: db,
+		s3: &mockS3{
+			getObjectFn: func(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(makeTestJPEG(200, 600, [][2]int{{250, 290}}))), nil
+			},
+		},
+		bucket: "test-bucket",
+		gemini: &gemini.MockClient{
+			GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+				for _, p := range parts {
+					if strings.Contains(p.Text, "QA specialist") {
+						return `{"results":[{"entryIndex":0,"verdict":"pass","issues":[],"summary":"OK"}]}`, nil
+					}
+				}
+				return `{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","entryType":"maintenance","maintenanceNarrative":"Changed oil","confidence":0.9}]}`, nil
+			},
+			EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
+				embedCalls++
+				return make([]float32, gemini.DefaultEmbeddingDimensions), nil
+			},
+		},
+		secrets: &mockSecrets{},
+	}
+
+	err := h.processPage(context.Background(), pageMessage{
+		UploadID:      "batch-1",
+		PageID:        "page-1",
+		PageNumber:    1,
+		S3Key:         "pages/batch-1/page_0001.jpg",
+		PromptVersion: version,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(execs) != 1 || candidateArgs == nil {
+		t.Fatalf("writes = %v, want only the candidate extraction", execs)
+	}
+	if candidateArgs[0] != version || candidateArgs[2] != "page-1" {
+		t.Errorf("candidate stored as (%v, %v), want (%s, page-1)", candidateArgs[0], candidateArgs[2], version)
+	}
+	var stored struct {
+		extractionResult
+		PromptVersion string `json:"promptVersion"`
+	}
+	if err := json.Unmarshal([]byte(candidateArgs[1].(string)), &stored); err != nil {
+		t.Fatalf("candidate is not an extraction: %v", err)
+	}
+	if len(stored.Entries) != 1 || stored.Entries[0].MaintenanceNarrative != "Changed oil" {
+		t.Errorf("candidate entries = %+v", stored.Entries)
+	}
+	if stored.PromptVersion != version {
+		t.Errorf("candidate promptVersion = %q, want %q", stored.PromptVersion, version)
+	}
+	if inserts != 0 || embedCalls != 0 {
+		t.Errorf("inserts = %d, embedCalls = %d, want live entries untouched", inserts, embedCalls)
+	}
+}
+
+func TestProcessPage_CandidateOtherPromptVersion(t *testing.T) {
+	type stored struct {
+		label, promptVersion string
+	}
+	var candidates []stored
+	h := &Handler{
+		db: &mockDB{
+			execFn: func(ctx context.Context, sql string, args ...any) error {
+				if !strings.Contains(sql, "raw_extraction_candidate") {
+					t.Errorf("unexpected write: %s", sql)
+					return nil
+				}
+				var c struct {
+					PromptVersion string `json:"promptVersion"`
+				}
+				if err := json.Unmarshal([]byte(args[1].(string)), &c); err != nil {
+					t.Fatalf("candidate is not JSON: %v", err)
+				}
+				candidates = append(candidates, stored{args[0].(string), c.PromptVersion})
+				return nil
+			},
+			queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+				if strings.Contains(sql, "upload_batches ub") && strings.Contains(sql, "JOIN aircraft") {
+					return []map[string]any{{"aircraft_id": "aircraft-1", "registration": "N123AB"}}, nil
+				}
+				return nil, nil
+			},
+		},
+		s3: &mockS3{
+			getObjectFn: func(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(makeTestJPEG(200, 600, [][2]int{{250, 290}}))), nil
+			},
+		},
+		bucket: "test-bucket",
+		gemini: &gemini.MockClient{
+			GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+				return `{"pageType":"maintenance_entry","entries":[]}`, nil
+			},
+		},
+		secrets: &mockSecrets{},
+	}
+
+	// A made-up label, and the per-entry prompt's version for a page read
+	// with the full-page one: both are stored under the label, recording
+	// the prompt actually used.
+	labels := []string{"v2", promptVersion(SliceExtractionPrompt)}
+	for _, label := range labels {
+		err := h.processPage(context.Background(), pageMessage{
+			UploadID:      "batch-1",
+			PageID:        "page-1",
+			PageNumber:    1,
+			S3Key:         "pages/batch-1/page_0001.jpg",
+			PromptVersion: label,
+		})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", label, err)
+		}
+	}
+	if len(candidates) != len(labels) {
+		t.Fatalf("candidates = %+v, want one per label", candidates)
+	}
+	used := promptVersion(MaintenanceExtractionPrompt)
+	for i, label := range labels {
+		if want := (stored{label, used}); candidates[i] != want {
+			t.Errorf("candidate %d = %+v, want %+v", i, candidates[i], want)
+		}
+	}
+}
+
+func TestHandle_CandidateFailureNotRecorded(t *testing.T) {
+	var writes []string
+	h := &Handler{
+		db: &mockDB{execFn: func(ctx context.Context, sql string, args ...any) error {
+			writes = append(writes, sql)
+			return nil
+		}},
+		s3: &mockS3{
+			getObjectFn: func(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+				return nil, errors.New("no such key")
+			},
+		},
+		bucket: "test-bucket",
+	}
+
+	body := `{"uploadId":"batch-1","pageId":"page-1","pageNumber":1,"s3Key":"pages/batch-1/page_0001.jpg","promptVersion":"v2"}`
+	err := h.Handle(context.Background(), events.SQSEvent{Records: []events.SQSMessage{{Body: body}}})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if len(writes) != 0 {
+		t.Errorf("candidate run wrote to the live page: %v", writes)
+	}
+}
+
+func TestExtractedEntry_UncertainFieldsJSON(t *testing.T) {
+	var e extractedEntry
+	if err := json.Unmarshal([]byte(`{"date":"2024-01-15","uncertainFields":["hobbsTime","mechanicCertificate"]}`), &e); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(e.UncertainFields, []string{"hobbsTime", "mechanicCertificate"}) {
+		t.Fatalf("UncertainFields = %v", e.UncertainFields)
+	}
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	var back extractedEntry
+	if err := json.Unmarshal(b, &back); err != nil {
+		t.Fatalf("unmarshal round trip: %v", err)
+	}
+	if !reflect.DeepEqual(back.UncertainFields, e.UncertainFields) {
+		t.Errorf("round trip UncertainFields = %v, want %v", back.UncertainFields, e.UncertainFields)
+	}
+}
+
+func TestExtractAndVerifySlice_QAIssuesAddUncertainFields(t *testing.T) {
+	flagged := `{"results":[{"entryIndex":0,"verdict":"needs_review","issues":[` +
+		`{"field":"hobbsTime","issue":"unclear","expected":"unclear","extracted":"1234.5","severity":"minor"},` +
+		`{"field":"shopName","issue":"unclear","expected":"unclear","extracted":"Acme","severity":"minor"},` +
+		`{"field":"","issue":"general","expected":"","extracted":"","severity":"minor"}` +
+		`],"summary":"Hard to read"}]}`
+	mockGemini := &gemini.MockClient{
+		GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+			for _, p := range parts {
+				if strings.Contains(p.Text, "QA specialist") {
+					return flagged, nil
+				}
+			}
+			return `{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","entryType":"maintenance","hobbsTime":1234.5,"shopName":"Acme","maintenanceNarrative":"Changed oil","uncertainFields":["hobbsTime","mechanicName"]}]}`, nil
+		},
+	}
+	h := &Handler{secrets: &mockSecrets{}}
+
+	entries, _, err := h.extractAndVerifySlice(context.Background(), []byte("img"), "image/jpeg", mockGemini, SliceExtractionPrompt, 0, "page-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(entries))
+	}
+	want := []string{"hobbsTime", "mechanicName", "shopName"}
+	if !reflect.DeepEqual(entries[0].UncertainFields, want) {
+		t.Errorf("UncertainFields = %v, want %v", entries[0].UncertainFields, want)
+	}
+}
+
+func TestSaveEntry_UncertainFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		fields []string
+		want   any
+	}{
+		{"stored as JSON", []string{"hobbsTime", "partsActions[0].partNumber"}, `["hobbsTime","partsActions[0].partNumber"]`},
+		{"none stored as null", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotSQL string
+			var gotArgs []any
+			db := &mockDB{
+				insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+					gotSQL, gotArgs = sql, args
+					return "entry-id-1", nil
+				},
+			}
+			h := &Handler{db: db}
+
+			entry := &extractedEntry{
+				Date:                 "2024-01-15",
+				EntryType:            "maintenance",
+				MaintenanceNarrative: "Oil",
+				UncertainFields:      tt.fields,
+			}
+			if err := h.saveEntry(context.Background(), "aircraft-1", "page-1", entry); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !strings.Contains(gotSQL, "uncertain_fields") {
+				t.Fatalf("insert does not set uncertain_fields: %s", gotSQL)
+			}
+			if gotArgs[29] != tt.want {
+				t.Errorf("uncertain_fields arg = %v, want %v", gotArgs[29], tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractAndVerifySlice_QASampling(t *testing.T) {
+	passed := `{"results":[{"entryIndex":0,"verdict":"pass","issues":[],"summary":"OK"}]}`
+	tests := []struct {
+		name        string
+		rate        float64
+		entry       string
+		wantQA      bool
+		wantVerdict string
+	}{
+		{"rate 1 checks every slice", 1, `{"date":"2024-01-15","entryType":"maintenance","maintenanceNarrative":"Changed oil","confidence":0.98}`, true, "pass"},
+		{"rate 0 skips confident entries", 0, `{"date":"2024-01-15","entryType":"maintenance","maintenanceNarrative":"Changed oil","confidence":0.98}`, false, qaVerdictSkipped},
+		{"low confidence always checked", 0, `{"date":"2024-01-15","entryType":"maintenance","maintenanceNarrative":"Changed oil","confidence":0.6}`, true, "pass"},
+		{"missing confidence always checked", 0, `{"date":"2024-01-15","entryType":"maintenance","maintenanceNarrative":"Changed oil"}`, true, "pass"},
+		{"AD compliance always checked", 0, `{"date":"2024-01-15","entryType":"ad_compliance","maintenanceNarrative":"Complied with AD","confidence":0.98,"adCompliance":[{"adNumber":"2020-12-34"}]}`, true, "pass"},
+		{"inspection always checked", 0, `{"date":"2024-01-15","entryType":"inspection","inspectionType":"annual","maintenanceNarrative":"Annual","confidence":0.98}`, true, "pass"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qaCalls := 0
+			mockGemini := &gemini.MockClient{
+				GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+					for _, p := range parts {
+						if strings.Contains(p.Text, "QA specialist") {
+							qaCalls++
+							return passed, nil
+						}
+					}
+					return `{"pageType":"maintenance_entry","entries":[` + tt.entry + `]}`, nil
+				},
+			}
+			h := &Handler{secrets: &mockSecrets{}, qaMaxRetries: 1, qaSampleRate: tt.rate}
+
+			entries, _, err := h.extractAndVerifySlice(context.Background(), []byte("img"), "image/jpeg", mockGemini, SliceExtractionPrompt, 0, "page-1")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(entries) != 1 {
+				t.Fatalf("expected 1 entry, got %d", len(entries))
+			}
+			if (qaCalls > 0) != tt.wantQA {
+				t.Errorf("QA calls = %d, want QA run %v", qaCalls, tt.wantQA)
+			}
+			if entries[0].QAVerdict != tt.wantVerdict {
+				t.Errorf("QAVerdict = %q, want %q", entries[0].QAVerdict, tt.wantVerdict)
+			}
+		})
+	}
+}
+
+func TestProcessPage_QASkippedStillSaves(t *testing.T) {
+	var qaVerdict any
+	inserts := 0
+	db := &mockDB{
+		insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+			if strings.Contains(sql, "INSERT INTO maintenance_entries") {
+				inserts++
+				qaVerdict = args[26]
+			}
+			return "entry-id-1", nil
+		},
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			if strings.Contains(sql, "upload_batches ub") && strings.Contains(sql, "JOIN aircraft") {
+				return []map[string]any{{"aircraft_id": "aircraft-1", "registration": "N123AB"}}, nil
+			}
+			return nil, nil
+		},
+	}
+	h := &Handler{
+		qaMaxRetries: 1,
+		db:           db,
+		s3: &mockS3{
+			getObjectFn: func(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(makeTestJPEG(200, 600, [][2]int{{250, 290}}))), nil
+			},
+		},
+		bucket: "test-bucket",
+		gemini: &gemini.MockClient{
+			GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+				for _, p := range parts {
+					if strings.Contains(p.Text, "QA specialist") {
+						t.Error("QA ran for a slice sampling should skip")
+					}
+				}
+				return `{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","entryType":"maintenance","maintenanceNarrative":"Changed oil","confidence":0.98}]}`, nil
+			},
+			EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
+				return make([]float32, gemini.DefaultEmbeddingDimensions), nil
+			},
+		},
+		secrets:      &mockSecrets{},
+		qaSampleRate: 0,
+	}
+
+	err := h.processPage(context.Background(), pageMessage{
+		UploadID:   "batch-1",
+		PageID:     "page-1",
+		PageNumber: 1,
+		S3Key:      "pages/batch-1/page_0001.jpg",
+	})
+	if err != nil {
+		t.Fatalf("processPage: %v", err)
+	}
+	if inserts != 1 {
+		t.Fatalf("inserted %d entries, want 1", inserts)
+	}
+	if qaVerdict != qaVerdictSkipped {
+		t.Errorf("qa_verdict = %v, want %q", qaVerdict, qaVerdictSkipped)
+	}
+}
+
+func TestProcessPage_LLMCallTimeout(t *testing.T) {
+	inserts := 0
+	db := &mockDB{
+		insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+			if strings.Contains(sql, "INSERT INTO maintenance_entries") {
+				inserts++
+			}
+			return "entry-id-1", nil
+		},
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			if strings.Contains(sql, "upload_batches ub") && strings.Contains(sql, "JOIN aircraft") {
+				return []map[string]any{{"aircraft_id": "aircraft-1", "registration": "N123AB"}}, nil
+			}
+			return nil, nil
+		},
+	}
+	extractions := 0
+	h := &Handler{
+		db: db,
+		s3: &mockS3{
+			getObjectFn: func(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(makeTestJPEG(200, 600, [][2]int{{50, 150}, {350, 450}}))), nil
+			},
+		},
+		bucket: "test-bucket",
+		gemini: &gemini.MockClient{
+			GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+				for _, p := range parts {
+					if strings.Contains(p.Text, "QA specialist") {
+						return `{"results":[{"entryIndex":0,"verdict":"pass","issues":[],"summary":"OK"}]}`, nil
+					}
+				}
+				extractions++
+				if extractions == 1 {
+					// The first slice's call hangs until the timeout.
+					select {
+					case <-ctx.Done():
+						return "", ctx.Err()
+					case <-time.After(5 * time.Second):
+						t.Error("extraction call was not cancelled")
+						return "", errors.New("not cancelled")
+					}
+				}
+				return `{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","entryType":"maintenance","maintenanceNarrative":"Changed oil","confidence":0.9}]}`, nil
+			},
+			EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
+				return make([]float32, gemini.DefaultEmbeddingDimensions), nil
+			},
+		},
+		secrets:        &mockSecrets{},
+		llmCallTimeout: 20 * time.Millisecond,
+	}
+
+	err := h.processPage(context.Background(), pageMessage{
+		UploadID:   "batch-1",
+		PageID:     "page-1",
+		PageNumber: 1,
+		S3Key:      "pages/batch-1/page_0001.jpg",
+	})
+	if err != nil {
+		t.Fatalf("processPage: %v", err)
+	}
+	if extractions < 2 {
+		t.Fatalf("extraction calls = %d, want the second slice tried after the first timed out", extractions)
+	}
+	if inserts != 1 {
+		t.Errorf("inserted %d entries, want 1 from the slice that answered", inserts)
+	}
+}
+
+func TestParseQuantity(t *testing.T) {
+	tests := []struct {
+		name string
+		in   any
+		want int
+	}{
+		{"nil", nil, 1},
+		{"integer", 2, 2},
+		{"JSON number", float64(4), 4},
+		{"float rounds", 2.6, 3},
+		{"fraction rounds up to 1", 0.4, 1},
+		{"zero", float64(0), 1},
+		{"negative", float64(-3), 1},
+		{"numeric string", "6", 6},
+		{"unit suffix", "2 ea", 2},
+		{"unit suffix no space", "12ea", 12},
+		{"parenthesized", "(4)", 4},
+		{"thousands separator", "1,200", 1200},
+		{"garbage", "several", 1},
+		{"empty string", "", 1},
+		{"bool", true, 1},
+		{"overflow", 1e12, math.MaxInt32},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseQuantity(tt.in); got != tt.want {
+				t.Errorf("parseQuantity(%v) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSaveEntry_PartQuantities(t *testing.T) {
+	var quantities []any
+	var entryArgs []any
+	db := &mockDB{
+		insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+			entryArgs = args
+			return "entry-id-1", nil
+		},
+		execFn: func(ctx context.Context, sql string, args ...any) error {
+			if strings.Contains(sql, "INSERT INTO parts_actions") {
+				quantities = append(quantities, args[7])
+			}
+			return nil
+		},
+	}
+	h := &Handler{db: db, gemini: &gemini.MockClient{}, autoApproveThreshold: 0.5}
+
+	entry := &extractedEntry{
+		Date:                 "2024-01-15",
+		EntryType:            "maintenance",
+		MaintenanceNarrative: "Replaced spark plugs",
+		Confidence:           0.95,
+		QAPassed:             true,
+		PartsActions: []partsActionRec{
+			{Action: "installed", PartName: "Spark plug", Quantity: "(4)"},
+			{Action: "installed", PartName: "Gasket", Quantity: "2 ea"},
+			{Action: "installed", PartName: "Oil filter"},
+			{Action: "installed", PartName: "Washer", Quantity: float64(2401)},
+		},
+	}
+	if err := h.saveEntry(context.Background(), "aircraft-1", "page-1", entry); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []any{4, 2, 1, 2401}; !reflect.DeepEqual(quantities, want) {
+		t.Errorf("quantities = %v, want %v", quantities, want)
+	}
+	if entryArgs[17] != true {
+		t.Errorf("needs_review = %v, want true for an implausible quantity", entryArgs[17])
+	}
+	if notes, _ := entryArgs[19].(string); !strings.Contains(notes, `Implausible quantity 2401 for part "Washer"`) {
+		t.Errorf("extraction_notes = %q, want the implausible quantity noted", notes)
+	}
+	if entryArgs[20] != "pending" {
+		t.Errorf("review_status = %v, want pending", entryArgs[20])
+	}
+}
+
+func TestNormalizeADNumber(t *testing.T) {
+	tests := []struct {
+		in     string
+		want   string
+		wantOK bool
+	}{
+		{"2020-26-11", "2020-26-11", true},
+		{"AD 2020-26-11", "2020-26-11", true},
+		{"ad2020-26-11", "2020-26-11", true},
+		{"AD2020-2611", "2020-26-11", true},
+		{"AD# 2020.26.11", "2020-26-11", true},
+		{"20202611", "2020-26-11", true},
+		{" 2020 26 11 ", "2020-26-11", true},
+		{"AD 2020-26-11R1", "2020-26-11 R1", true},
+		{"2020-26-11 r2", "2020-26-11 R2", true},
+		{"AD 78-12-04", "78-12-04", true},
+		{"EASA AD 2021-0123", "EASA AD 2021-0123", false},
+		{" Cessna SEB 07-5 ", "Cessna SEB 07-5", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, ok := normalizeADNumber(tt.in)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("normalizeADNumber(%q) = (%q, %v), want (%q, %v)", tt.in, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestSaveEntry_ADNumberNormalization(t *testing.T) {
+	var adArgs [][]any
+	var entryArgs []any
+	db := &mockDB{
+		insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+			entryArgs = args
+			return "entry-id-1", nil
+		},
+		execFn: func(ctx context.Context, sql string, args ...any) error {
+			if strings.Contains(sql, "INSERT INTO ad_compliance") {
+				adArgs = append(adArgs, args)
+			}
+			return nil
+		},
+	}
+	h := &Handler{db: db, gemini: &gemini.MockClient{}}
+
+	entry := &extractedEntry{
+		Date:                 "2024-01-15",
+		EntryType:            "ad_compliance",
+		MaintenanceNarrative: "Complied with ADs",
+		ADCompliance: []adComplianceRec{
+			{ADNumber: "AD2020-2611", Method: "inspection"},
+			{ADNumber: "SB 123", Method: "inspection"},
+		},
+	}
+	if err := h.saveEntry(context.Background(), "aircraft-1", "page-1", entry); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(adArgs) != 2 {
+		t.Fatalf("inserted %d AD compliance rows, want 2", len(adArgs))
+	}
+	if adArgs[0][2] != "2020-26-11" || adArgs[0][3] != "AD2020-2611" {
+		t.Errorf("AD number = (%v, raw %v), want (2020-26-11, raw AD2020-2611)", adArgs[0][2], adArgs[0][3])
+	}
+	if adArgs[1][2] != "SB 123" || adArgs[1][3] != "SB 123" {
+		t.Errorf("unrecognized AD number = (%v, raw %v), want it kept as written", adArgs[1][2], adArgs[1][3])
+	}
+	if entryArgs[17] != true {
+		t.Errorf("needs_review = %v, want true for an unrecognized AD number", entryArgs[17])
+	}
+	if notes, _ := entryArgs[19].(string); !strings.Contains(notes, `Unrecognized AD number "SB 123"`) {
+		t.Errorf("extraction_notes = %q, want the unrecognized AD number noted", notes)
+	}
+}
+
+// ocrTSVHeader is the header row tesseract writes before its TSV rows.
+const ocrTSVHeader = "level\tpage_num\tblock_num\tpar_num\tline_num\tword_num\tleft\ttop\twidth\theight\tconf\ttext\n"
+
+func TestParseOCRTSV(t *testing.T) {
+	tsv := ocrTSVHeader +
+		"1\t1\t0\t0\t0\t0\t0\t0\t200\t600\t-1\t\n" +
+		"5\t1\t1\t1\t1\t1\t10\t250\t40\t20\t91.5\tChanged\n" +
+		"5\t1\t1\t1\t1\t2\t55\t250\t20\t20\t88\toil\n" +
+		"5\t1\t1\t1\t1\t3\t80\t250\t10\t20\t95\t \n" +
+		"5\t1\t1\t1\t1\t4\t80\t250\t10\t20\tbad\tword\n"
+	got := parseOCRTSV([]byte(tsv))
+	want := []ocrWord{{Text: "Changed", Confidence: 91.5}, {Text: "oil", Confidence: 88}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseOCRTSV = %+v, want %+v", got, want)
+	}
+}
+
+func TestHasText(t *testing.T) {
+	word := func(text string, conf float64) ocrWord { return ocrWord{Text: text, Confidence: conf} }
+	tests := []struct {
+		name  string
+		words []ocrWord
+		want  bool
+	}{
+		{"no words", nil, false},
+		{"a line of writing", []ocrWord{word("Changed", 90), word("oil", 85), word("filter", 80)}, true},
+		{"specks", []ocrWord{word("|", 95), word("~", 90), word(".", 90), word("-", 90)}, false},
+		{"low confidence", []ocrWord{word("Cha", 20), word("ngd", 30), word("oll", 40)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hasText(tt.words); got != tt.want {
+				t.Errorf("hasText = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProcessPage_OCRPrepass(t *testing.T) {
+	dir := t.TempDir()
+	// fakeTesseract writes a script that prints tsv as tesseract would for
+	// "tesseract <image> stdout tsv".
+	fakeTesseract := func(name, tsv string) string {
+		path := filepath.Join(dir, name)
+		script := "#!/bin/sh\n[ \"$2\" = stdout ] && [ \"$3\" = tsv ] || exit 1\ncat <<'EOF'\n" + tsv + "EOF\n"
+		if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	words := fakeTesseract("tesseract-words", ocrTSVHeader+
+		"5\t1\t1\t1\t1\t1\t10\t250\t40\t20\t91\tChanged\n"+
+		"5\t1\t1\t1\t1\t2\t55\t250\t20\t20\t88\toil\n"+
+		"5\t1\t1\t1\t1\t3\t80\t250\t30\t20\t90\tfilter\n")
+	empty := fakeTesseract("tesseract-empty", ocrTSVHeader+"1\t1\t0\t0\t0\t0\t0\t0\t200\t600\t-1\t\n")
+	faint := fakeTesseract("tesseract-faint", ocrTSVHeader+
+		"5\t1\t1\t1\t1\t1\t10\t250\t40\t20\t31\tChanged\n"+
+		"5\t1\t1\t1\t1\t2\t55\t250\t20\t20\t24\toil\n"+
+		"5\t1\t1\t1\t1\t3\t80\t250\t30\t20\t40\tfilter\n")
+
+	tests := []struct {
+		name        string
+		tesseract   string
+		wantSkipped bool
+	}{
+		{"text found", words, false},
+		{"no text", empty, true},
+		{"only faint text", faint, true},
+		{"binary missing", filepath.Join(dir, "missing"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			extractCalls := 0
+			skipped := false
+			var skipArgs []any
+			db := &mockDB{
+				execFn: func(ctx context.Context, sql string, args ...any) error {
+					if strings.Contains(sql, "extraction_status = 'skipped'") {
+						skipped = true
+						skipArgs = args
+					}
+					return nil
+				},
+				insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+					return "entry-id-1", nil
+				},
+				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+					if strings.Contains(sql, "upload_batches ub") && strings.Contains(sql, "JOIN aircraft") {
+						return []map[string]any{{"aircraft_id": "aircraft-1", "registration": "N123AB"}}, nil
+					}
+					return nil, nil
+				},
+			}
+			h := &Handler{
+				db: db,
+				s3: &mockS3{
+					getObjectFn: func(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+						return io.NopCloser(bytes.NewReader(makeTestJPEG(200, 600, [][2]int{{250, 290}}))), nil
+					},
+				},
+				bucket:        "test-bucket",
+				ocrPrepass:    true,
+				tesseractPath: tt.tesseract,
+				gemini: &gemini.MockClient{
+					GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+						for _, p := range parts {
+							if strings.Contains(p.Text, "QA specialist") {
+								return `{"results":[{"entryIndex":0,"verdict":"pass","issues":[],"summary":"OK"}]}`, nil
+							}
+						}
+						extractCalls++
+						return `{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","entryType":"maintenance","maintenanceNarrative":"Changed oil","confidence":0.9}]}`, nil
+					},
+					EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
+						return make([]float32, gemini.DefaultEmbeddingDimensions), nil
+					},
+				},
+				secrets: &mockSecrets{},
+			}
+
+			err := h.processPage(context.Background(), pageMessage{
+				UploadID:   "batch-1",
+				PageID:     "page-1",
+				PageNumber: 1,
+				S3Key:      "pages/batch-1/page_0001.jpg",
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if skipped != tt.wantSkipped {
+				t.Errorf("skipped = %v, want %v", skipped, tt.wantSkipped)
+			}
+			// A page OCR reads nothing on is skipped, but not unseen.
+			if skipped {
+				if reason, _ := skipArgs[2].(string); skipArgs[1] != true || !strings.Contains(reason, "OCR") {
+					t.Errorf("skipped with needs_review = %v, reason %v; want it flagged for review", skipArgs[1], skipArgs[2])
+				}
+			}
+			if wantExtract := !tt.wantSkipped; (extractCalls > 0) != wantExtract {
+				t.Errorf("extraction calls = %d, want extraction %v", extractCalls, wantExtract)
+			}
+		})
+	}
+}
+
+// ─── Tests: supersedePriorEntries ──────────────────────────────────────────
+
+func TestNarrativeSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		min, max float64
+	}{
+		{"Changed oil and filter.", "changed oil and filter", 1, 1},
+		{"Changed oil & filter, safety wired.", "Changed oil and filter. Safety wired", 0.8, 0.9},
+		{"Changed oil and filter", "Replaced left main tire", 0, 0},
+		{"", "", 0, 0},
+		{"Changed oil", "", 0, 0},
+	}
+	for _, tt := range tests {
+		if got := narrativeSimilarity(tt.a, tt.b); got < tt.min || got > tt.max {
+			t.Errorf("narrativeSimilarity(%q, %q) = %.2f, want %.2f–%.2f", tt.a, tt.b, got, tt.min, tt.max)
+		}
+	}
+}
+
+func TestSaveEntry_SupersedesPriorEntry(t *testing.T) {
+	// The new entry is read from page 2 of an airframe logbook upload.
+	page := func(logbookType string, pageNumber int) map[string]any {
+		return map[string]any{"logbook_type": logbookType, "page_number": pageNumber}
+	}
+	tests := []struct {
+		name       string
+		candidates []map[string]any
+		want       string
+	}{
+		{
+			name: "closest match superseded",
+			candidates: []map[string]any{
+				{"id": "old-tire", "maintenance_narrative": "Replaced left main tire", "page": page("airframe", 2)},
+				{"id": "old-oil", "maintenance_narrative": "Changed o1l and filter. Safety wired drain plug", "page": page("airframe", 2)},
+			},
+			want: "old-oil",
+		},
+		{
+			name:       "nothing alike",
+			candidates: []map[string]any{{"id": "old-tire", "maintenance_narrative": "Replaced left main tire", "page": page("airframe", 2)}},
 		},
+		{
+			// The engine log records the same oil change on the same day;
+			// both entries stand.
+			name: "other logbook type",
+			candidates: []map[string]any{
+				{"id": "engine-oil", "maintenance_narrative": "Changed oil and filter. Safety wired drain plug", "page": page("engine", 2)},
+			},
+		},
+		{
+			// A single corrected page re-uploaded on its own is page 1 of
+			// its upload, wherever the original sat.
+			name: "other page number",
+			candidates: []map[string]any{
+				{"id": "old-oil", "maintenance_narrative": "Changed oil and filter. Safety wired drain plug", "page": page("airframe", 7)},
+			},
+			want: "old-oil",
+		},
+		{name: "no candidates"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var lookupArgs []any
+			var superseded []any
+			db := &mockDB{
+				insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+					return "entry-new", nil
+				},
+				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+					if strings.Contains(sql, "superseded_by IS NULL") {
+						lookupArgs = args
+						if !strings.Contains(sql, "b.logbook_type IS NOT DISTINCT FROM nb.logbook_type") {
+							t.Errorf("candidates not limited to the same logbook:\n%s", sql)
+						}
+						if strings.Contains(sql, "page_number") {
+							t.Errorf("candidates limited by page position:\n%s", sql)
+						}
+						// Apply that condition for the new entry's page.
+						var rows []map[string]any
+						for _, c := range tt.candidates {
+							if page := c["page"].(map[string]any); page["logbook_type"] == "airframe" {
+								rows = append(rows, c)
+							}
+						}
+						return rows, nil
+					}
+					return nil, nil
+				},
+				execFn: func(ctx context.Context, sql string, args ...any) error {
+					if strings.Contains(sql, "SET superseded_by") {
+						superseded = args
+					}
+					return nil
+				},
+			}
+			h := &Handler{db: db, gemini: &gemini.MockClient{}}
+
+			entry := &extractedEntry{
+				Date:                 "2024-01-15",
+				MaintenanceNarrative: "Changed oil and filter. Safety wired drain plug",
+			}
+			if err := h.saveEntry(context.Background(), "aircraft-1", "page-2", entry); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(lookupArgs, []any{"aircraft-1", "2024-01-15", "entry-new", "page-2"}) {
+				t.Errorf("candidates looked up with %v", lookupArgs)
+			}
+			if tt.want == "" {
+				if superseded != nil {
+					t.Errorf("superseded %v, want nothing", superseded)
+				}
+				return
+			}
+			if !reflect.DeepEqual(superseded, []any{"entry-new", tt.want}) {
+				t.Errorf("superseded args = %v, want [entry-new %s]", superseded, tt.want)
+			}
+		})
+	}
+}
+
+// ─── Tests: FAR reference check ────────────────────────────────────────────
+
+func TestSaveEntry_FARReference(t *testing.T) {
+	tests := []struct {
+		name           string
+		inspectionType string
+		farReference   string
+		wantFlag       bool
+	}{
+		{name: "matching", inspectionType: "transponder", farReference: "14 CFR 91.413"},
+		{name: "matching with paragraph", inspectionType: "annual", farReference: "FAR 91.409(a)(1)"},
+		{name: "mismatched", inspectionType: "transponder", farReference: "91.409", wantFlag: true},
+		{name: "missing", inspectionType: "transponder"},
+		{name: "part 43 only", inspectionType: "annual", farReference: "IAW 14 CFR 43.9 and 43.11"},
+		{name: "type without a rule", inspectionType: "50hr", farReference: "91.413"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var entryArgs []any
+			db := &mockDB{
+				insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+					entryArgs = args
+					return "entry-id-1", nil
+				},
+			}
+			h := &Handler{db: db, gemini: &gemini.MockClient{}}
+
+			entry := &extractedEntry{
+				Date:                 "2024-01-15",
+				EntryType:            "inspection",
+				InspectionType:       tt.inspectionType,
+				FARReference:         tt.farReference,
+				MaintenanceNarrative: "Inspection completed",
+			}
+			if err := h.saveEntry(context.Background(), "aircraft-1", "page-1", entry); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if entryArgs[17] != tt.wantFlag {
+				t.Errorf("needs_review = %v, want %v", entryArgs[17], tt.wantFlag)
+			}
+			notes, _ := entryArgs[19].(string)
+			if got := strings.Contains(notes, "FAR reference"); got != tt.wantFlag {
+				t.Errorf("extraction_notes = %q, want a FAR note %v", notes, tt.wantFlag)
+			}
+			if tt.wantFlag && !strings.Contains(notes, `FAR reference "91.409" doesn't match a transponder inspection (expected 91.413)`) {
+				t.Errorf("extraction_notes = %q", notes)
+			}
+		})
+	}
+}
+
+func TestProcessPage_StickerSlices(t *testing.T) {
+	tests := []struct {
+		name          string
+		stickerSlices string
+		wantEntries   int
+	}{
+		{"kept", "", 1},
+		{"skipped", stickerSkip, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var inserts [][]any
+			var pageType any
+			h := &Handler{
+				db: &mockDB{
+					execFn: func(ctx context.Context, sql string, args ...any) error {
+						if strings.Contains(sql, "raw_extraction") {
+							pageType = args[1]
+						}
+						return nil
+					},
+					insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+						if strings.Contains(sql, "INSERT INTO maintenance_entries") {
+							inserts = append(inserts, args)
+						}
+						return "entry-id-1", nil
+					},
+					queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+						if strings.Contains(sql, "upload_batches") {
+							return []map[string]any{{"aircraft_id": "aircraft-1", "registration": "N123AB"}}, nil
+						}
+						return []map[string]any{{"total": int64(1), "done": int64(1), "failed": int64(0)}}, nil
+					},
+				},
+				s3:     &mockS3{},
+				bucket: "test-bucket",
+				gemini: &gemini.MockClient{
+					GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+						for _, p := range parts {
+							if strings.Contains(p.Text, "QA specialist") {
+								return `{"results":[{"entryIndex":0,"verdict":"pass","issues":[],"summary":"OK"}]}`, nil
+							}
+						}
+						return `{"pageType":"sticker","entries":[{"date":"2024-01-15","entryType":"inspection","inspectionType":"annual","maintenanceNarrative":"Next oil change due 1250.0 tach","confidence":0.9}]}`, nil
+					},
+					EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
+						return make([]float32, gemini.DefaultEmbeddingDimensions), nil
+					},
+				},
+				secrets:       &mockSecrets{},
+				stickerSlices: tt.stickerSlices,
+			}
+
+			err := h.processPage(context.Background(), pageMessage{
+				UploadID:   "batch-1",
+				PageID:     "page-1",
+				PageNumber: 1,
+				S3Key:      "pages/batch-1/page_0001.jpg",
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if pageType != "sticker" {
+				t.Errorf("page_type = %v, want sticker", pageType)
+			}
+			if len(inserts) != tt.wantEntries {
+				t.Fatalf("inserted %d entries, want %d", len(inserts), tt.wantEntries)
+			}
+			for _, args := range inserts {
+				if args[2] != "other" {
+					t.Errorf("entry_type = %v, want other", args[2])
+				}
+				if args[30] != stickerSource {
+					t.Errorf("source = %v, want %q", args[30], stickerSource)
+				}
+			}
+		})
+	}
+}
+
+func TestPromptVersion(t *testing.T) {
+	v := promptVersion(SliceExtractionPrompt)
+	if len(v) != 12 {
+		t.Errorf("promptVersion = %q, want 12 hex digits", v)
+	}
+	if promptVersion(SliceExtractionPrompt) != v {
+		t.Error("promptVersion is not stable")
 	}
+	if promptVersion(MaintenanceExtractionPrompt) == v || promptVersion(SliceExtractionPrompt+" ") == v {
+		t.Error("different prompts share a version")
+	}
+}
 
+func TestProcessPage_RecordsExtractionModel(t *testing.T) {
+	var entryArgs, pageArgs []any
 	h := &Handler{
-		db:     db,
+		db: &mockDB{
+			execFn: func(ctx context.Context, sql string, args ...any) error {
+				if strings.Contains(sql, "raw_extraction") {
+					pageArgs = args
+				}
+				return nil
+			},
+			insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+				if strings.Contains(sql, "INSERT INTO maintenance_entries") {
+					entryArgs = args
+				}
+				return "entry-id-1", nil
+			},
+			queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+				if strings.Contains(sql, "upload_batches") {
+					return []map[string]any{{"aircraft_id": "aircraft-1", "registration": "N123AB"}}, nil
+				}
+				return []map[string]any{{"total": int64(1), "done": int64(1), "failed": int64(0)}}, nil
+			},
+		},
 		s3:     &mockS3{},
 		bucket: "test-bucket",
 		gemini: &gemini.MockClient{
 			GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
-				extractCalls++
-				return `{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","entryType":"maintenance","maintenanceNarrative":"Changed oil and filter per SB 1234","confidence":0.95}]}`, nil
+				for _, p := range parts {
+					if strings.Contains(p.Text, "QA specialist") {
+						return `{"results":[{"entryIndex":0,"verdict":"pass","issues":[],"summary":"OK"}]}`, nil
+					}
+				}
+				return `{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","entryType":"maintenance","maintenanceNarrative":"Changed oil","confidence":0.9}]}`, nil
 			},
 			EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
-				return make([]float32, 768), nil
-			},
-		},
-		claude: &anthropic.MockClient{
-			CreateMessageFn: func(ctx context.Context, model string, maxTokens int64, messages []anthropic.Message) (string, error) {
-				claudeQACalls++
-				return `{"results":[{"entryIndex":0,"verdict":"pass","issues":[],"summary":"Verified"}]}`, nil
+				return make([]float32, gemini.DefaultEmbeddingDimensions), nil
 			},
 		},
 		secrets: &mockSecrets{},
@@ -1965,140 +5398,281 @@ func TestProcessPage_WithQA(t *testing.T) {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	if extractCalls != 1 {
-		t.Errorf("extractCalls = %d, want 1", extractCalls)
+	if entryArgs == nil {
+		t.Fatal("no entry saved")
 	}
-	if claudeQACalls != 1 {
-		t.Errorf("claudeQACalls = %d, want 1", claudeQACalls)
+	if entryArgs[34] != extractionModel || pageArgs[3] != extractionModel {
+		t.Errorf("extraction model = %v on the entry, %v on the page, want %q", entryArgs[34], pageArgs[3], extractionModel)
 	}
-	if insertCalls != 1 {
-		t.Errorf("insertCalls = %d, want 1", insertCalls)
+	// The mock page isn't sliced, so it is read with the full-page prompt.
+	if want := promptVersion(MaintenanceExtractionPrompt); entryArgs[35] != want {
+		t.Errorf("prompt_version = %v, want %q", entryArgs[35], want)
 	}
 }
 
-// TestQAWithRealLLMs sends an image through extraction + QA with real APIs.
-//
-// Usage:
-//
-//	GEMINI_API_KEY=... ANTHROPIC_API_KEY=... TEST_IMAGE_PATH=/path/to/slice.jpg go test ./analyze/ -run TestQAWithRealLLMs -v -count=1
-func TestQAWithRealLLMs(t *testing.T) {
-	geminiKey := os.Getenv("GEMINI_API_KEY")
-	imgPath := os.Getenv("TEST_IMAGE_PATH")
-	if geminiKey == "" || imgPath == "" {
-		t.Skip("set GEMINI_API_KEY and TEST_IMAGE_PATH to run this test")
+func TestProcessPage_ModelSliceCopy(t *testing.T) {
+	testJPEG := makeTestJPEG(200, 600, [][2]int{
+		{50, 130},
+		{230, 330},
+		{430, 530},
+	})
+	s3Mock := &mockS3{
+		getObjectFn: func(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(testJPEG)), nil
+		},
 	}
-
-	ctx := context.Background()
-	geminiClient, err := gemini.New(ctx, geminiKey)
-	if err != nil {
-		t.Fatalf("create gemini client: %v", err)
+	var sent []gemini.Part
+	h := &Handler{
+		db: &mockDB{
+			execFn: func(ctx context.Context, sql string, args ...any) error { return nil },
+			insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+				return "entry-id-1", nil
+			},
+			queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+				if strings.Contains(sql, "upload_batches") {
+					return []map[string]any{{"aircraft_id": "aircraft-1", "registration": "N123AB"}}, nil
+				}
+				return []map[string]any{{"total": int64(1), "done": int64(1), "failed": int64(0)}}, nil
+			},
+		},
+		s3:               s3Mock,
+		bucket:           "test-bucket",
+		sliceFormat:      slicer.FormatPNG,
+		modelJPEGQuality: 95,
+		modelGrayscale:   true,
+		gemini: &gemini.MockClient{
+			GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+				for _, p := range parts {
+					if p.Data != nil {
+						sent = append(sent, p)
+					}
+				}
+				for _, p := range parts {
+					if strings.Contains(p.Text, "QA specialist") {
+						return `{"results":[{"entryIndex":0,"verdict":"pass","issues":[],"summary":"OK"}]}`, nil
+					}
+				}
+				return `{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","entryType":"maintenance","maintenanceNarrative":"Changed oil","confidence":0.9}]}`, nil
+			},
+			EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
+				return make([]float32, gemini.DefaultEmbeddingDimensions), nil
+			},
+		},
+		secrets: &mockSecrets{},
 	}
 
-	data, err := os.ReadFile(imgPath)
+	err := h.processPage(context.Background(), pageMessage{
+		UploadID:   "batch-1",
+		PageID:     "page-1",
+		PageNumber: 1,
+		S3Key:      "pages/batch-1/page_0001.jpg",
+	})
 	if err != nil {
-		t.Fatalf("read image: %v", err)
+		t.Fatalf("unexpected error: %v", err)
 	}
-	t.Logf("Image: %s (%d bytes)", imgPath, len(data))
-
-	h := &Handler{secrets: &mockSecrets{}}
 
-	// Set up Claude if key is available
-	anthropicKey := os.Getenv("ANTHROPIC_API_KEY")
-	if anthropicKey != "" {
-		h.claude = anthropic.New(anthropicKey)
-		t.Log("Using Claude for QA")
-	} else {
-		t.Log("No ANTHROPIC_API_KEY set, using Gemini for QA")
+	// The audit copies keep the slice format; the models get the JPEGs.
+	if len(s3Mock.putCalls) == 0 {
+		t.Fatal("expected slices uploaded to S3")
 	}
-
-	entries, pageType, err := h.extractAndVerifySlice(ctx, data, "image/jpeg", geminiClient, 0, "test-page")
-	if err != nil {
-		t.Fatalf("extract+verify failed: %v", err)
+	for _, call := range s3Mock.putCalls {
+		if call.contentType != "image/png" {
+			t.Errorf("put content type = %s, want image/png", call.contentType)
+		}
 	}
-
-	t.Logf("pageType=%q, entries=%d", pageType, len(entries))
-	for i, e := range entries {
-		t.Logf("  Entry %d: date=%s type=%s needsReview=%v", i, e.Date, e.EntryType, e.NeedsReview)
-		if e.ExtractionNotes != "" {
-			t.Logf("    Notes: %s", e.ExtractionNotes)
+	if len(sent) == 0 {
+		t.Fatal("expected image parts sent to Gemini")
+	}
+	for _, p := range sent {
+		if p.MIMEType != "image/jpeg" {
+			t.Errorf("Gemini image MIME = %s, want image/jpeg", p.MIMEType)
+			continue
 		}
-		if len(e.MaintenanceNarrative) > 100 {
-			t.Logf("    Narrative: %.100s...", e.MaintenanceNarrative)
-		} else {
-			t.Logf("    Narrative: %s", e.MaintenanceNarrative)
+		img, err := jpeg.Decode(bytes.NewReader(p.Data))
+		if err != nil {
+			t.Fatalf("Gemini image does not decode: %v", err)
+		}
+		if _, ok := img.(*image.Gray); !ok {
+			t.Errorf("Gemini image decodes as %T, want grayscale", img)
 		}
 	}
 }
 
-// TestExtractionWithRealLLM sends an image through the actual Gemini API with
-// the SliceExtractionPrompt and prints the response. Use this to verify LLM
-// behavior on specific images (e.g., scanner backgrounds, blank pages).
-//
-// Usage:
-//
-//	GEMINI_API_KEY=... TEST_IMAGE_PATH=/tmp/slicer-pdf-batch/.../slice_001.jpg go test ./analyze/ -run TestExtractionWithRealLLM -v -count=1
-func TestExtractionWithRealLLM(t *testing.T) {
-	apiKey := os.Getenv("GEMINI_API_KEY")
-	imgPath := os.Getenv("TEST_IMAGE_PATH")
-	if apiKey == "" || imgPath == "" {
-		t.Skip("set GEMINI_API_KEY and TEST_IMAGE_PATH to run this test")
-	}
-
-	ctx := context.Background()
-	client, err := gemini.New(ctx, apiKey)
-	if err != nil {
-		t.Fatalf("create gemini client: %v", err)
+func TestProcessPage_SkipSliceUploads(t *testing.T) {
+	testJPEG := makeTestJPEG(200, 600, [][2]int{
+		{50, 130},
+		{230, 330},
+		{430, 530},
+	})
+	s3Mock := &mockS3{
+		getObjectFn: func(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(testJPEG)), nil
+		},
 	}
-
-	data, err := os.ReadFile(imgPath)
-	if err != nil {
-		t.Fatalf("read image: %v", err)
+	extractCalls := 0
+	insertCalls := 0
+	h := &Handler{
+		db: &mockDB{
+			execFn: func(ctx context.Context, sql string, args ...any) error { return nil },
+			insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+				insertCalls++
+				// No slice image to point at, but the bounds are kept.
+				if args[23] != nil {
+					t.Errorf("insert %d: slice_key = %v, want NULL", insertCalls, args[23])
+				}
+				if args[24] == nil || args[25] == nil {
+					t.Errorf("insert %d: slice bounds not persisted: y0=%v y1=%v", insertCalls, args[24], args[25])
+				}
+				return fmt.Sprintf("entry-id-%d", insertCalls), nil
+			},
+			queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+				if strings.Contains(sql, "upload_batches") {
+					return []map[string]any{{"aircraft_id": "aircraft-1", "registration": "N123AB"}}, nil
+				}
+				return []map[string]any{{"total": int64(1), "done": int64(1), "failed": int64(0)}}, nil
+			},
+		},
+		s3:               s3Mock,
+		bucket:           "test-bucket",
+		skipSliceUploads: true,
+		gemini: &gemini.MockClient{
+			GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+				for _, p := range parts {
+					if strings.Contains(p.Text, "QA specialist") {
+						return `{"results":[{"entryIndex":0,"verdict":"pass","issues":[],"summary":"OK"}]}`, nil
+					}
+				}
+				extractCalls++
+				return fmt.Sprintf(`{"pageType":"maintenance_entry","entries":[{"date":"2024-01-%02d","entryType":"maintenance","maintenanceNarrative":"Changed oil","confidence":0.9}]}`, extractCalls), nil
+			},
+			EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
+				return make([]float32, gemini.DefaultEmbeddingDimensions), nil
+			},
+		},
+		secrets: &mockSecrets{},
 	}
-	t.Logf("Image: %s (%d bytes)", imgPath, len(data))
 
-	temp := float32(0.1)
-	resp, err := client.GenerateContent(ctx, "gemini-2.5-flash", []gemini.Part{
-		{Text: SliceExtractionPrompt},
-		{Data: data, MIMEType: "image/jpeg"},
-	}, &gemini.GenerateConfig{
-		Temperature:      &temp,
-		ResponseMIMEType: "application/json",
+	err := h.processPage(context.Background(), pageMessage{
+		UploadID:   "batch-1",
+		PageID:     "page-1",
+		PageNumber: 1,
+		S3Key:      "pages/batch-1/page_0001.jpg",
 	})
 	if err != nil {
-		t.Fatalf("gemini call failed: %v", err)
+		t.Fatalf("unexpected error: %v", err)
 	}
 
-	// Pretty-print the JSON response.
-	var parsed json.RawMessage
-	if err := json.Unmarshal([]byte(resp), &parsed); err != nil {
-		t.Logf("Raw response (not JSON): %s", resp)
-	} else {
-		pretty, _ := json.MarshalIndent(parsed, "", "  ")
-		t.Logf("Response:\n%s", pretty)
+	if len(s3Mock.putCalls) != 0 {
+		t.Errorf("expected no S3 uploads, got %d (first %s)", len(s3Mock.putCalls), s3Mock.putCalls[0].key)
 	}
-
-	// Parse and check entries.
-	var result extractionResult
-	if err := json.Unmarshal([]byte(resp), &result); err != nil {
-		t.Fatalf("parse response: %v", err)
+	if extractCalls != 3 {
+		t.Errorf("extract calls = %d, want one per slice", extractCalls)
+	}
+	if insertCalls != 3 {
+		t.Errorf("inserts = %d, want 3", insertCalls)
 	}
-	t.Logf("pageType=%q, entries=%d", result.PageType, len(result.Entries))
 }
 
-func TestExtractBatchID(t *testing.T) {
+func TestSaveEntry_NarrativeSanity(t *testing.T) {
 	tests := []struct {
-		key  string
-		want string
+		name      string
+		narrative string
+		maxLen    int
+		wantNote  string
 	}{
-		{"pages/batch-123/page_0001.jpg", "batch-123"},
-		{"pages/abc-def-ghi/page_0003.jpg", "abc-def-ghi"},
-		{"singlepart", "unknown"},
-		{"a/b/c/d", "b"},
+		{
+			name:      "normal",
+			narrative: "Changed oil and filter, 8 qts Aeroshell 15W-50. Inspected filter, no metal found. Ran engine, no leaks.",
+		},
+		{
+			name:      "itemized list",
+			narrative: "Removed and replaced left main tire. Removed and replaced right main tire. Removed and replaced nose tire.",
+		},
+		{
+			name:      "over-long",
+			narrative: strings.Repeat("x", 10) + " " + strings.Repeat("Inspected wing attach fittings per service bulletin. ", 3),
+			maxLen:    50,
+			wantNote:  "Narrative is implausibly long (170 characters)",
+		},
+		{
+			name:      "default length",
+			narrative: strings.Repeat("word ", 700),
+			wantNote:  "Narrative is implausibly long (3500 characters)",
+		},
+		{
+			name:      "character run",
+			narrative: "Replaced ELT battery 0000000000000000 exp 2030",
+			wantNote:  `Narrative repeats '0' 10 or more times in a row`,
+		},
+		{
+			name:      "repeated phrases",
+			narrative: "Changed oil " + strings.Repeat("and filter and inspected ", 8),
+			wantNote:  "Narrative repeats the same phrases",
+		},
+		{
+			name:      "dot leaders",
+			narrative: "Oil changed.................. 8 qts",
+		},
 	}
+
 	for _, tt := range tests {
-		got := extractBatchID(tt.key)
-		if got != tt.want {
-			t.Errorf("extractBatchID(%q) = %q, want %q", tt.key, got, tt.want)
+		t.Run(tt.name, func(t *testing.T) {
+			var entryArgs []any
+			db := &mockDB{
+				insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+					entryArgs = args
+					return "entry-id-1", nil
+				},
+			}
+			h := &Handler{db: db, gemini: &gemini.MockClient{}, maxNarrativeLength: tt.maxLen}
+
+			entry := &extractedEntry{
+				Date:                 "2024-01-15",
+				EntryType:            "maintenance",
+				MaintenanceNarrative: tt.narrative,
+			}
+			if err := h.saveEntry(context.Background(), "aircraft-1", "page-1", entry); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// Flagged entries are still saved, narrative and all.
+			if entryArgs[15] != tt.narrative {
+				t.Errorf("narrative = %q", entryArgs[15])
+			}
+			wantFlag := tt.wantNote != ""
+			if entryArgs[17] != wantFlag {
+				t.Errorf("needs_review = %v, want %v", entryArgs[17], wantFlag)
+			}
+			notes, _ := entryArgs[19].(string)
+			if wantFlag && !strings.Contains(notes, tt.wantNote) {
+				t.Errorf("extraction_notes = %q, want %q", notes, tt.wantNote)
+			}
+			if !wantFlag && notes != "" {
+				t.Errorf("extraction_notes = %q, want none", notes)
+			}
+		})
+	}
+}
+
+func TestFlagEchoedNarratives(t *testing.T) {
+	entries := []extractedEntry{
+		{Date: "2024-01-15", MaintenanceNarrative: "Annual inspection completed IAW 14 CFR Part 43 Appendix D, aircraft found airworthy."},
+		// Read again from the next slice.
+		{Date: "2024-01-15", MaintenanceNarrative: "Annual inspection completed IAW 14 CFR Part 43 Appendix D. Aircraft found airworthy"},
+		// The same work on another date is a real entry.
+		{Date: "2025-01-20", MaintenanceNarrative: "Annual inspection completed IAW 14 CFR Part 43 Appendix D, aircraft found airworthy."},
+		// Different work on the same date too.
+		{Date: "2025-01-20", MaintenanceNarrative: "Replaced left brake linings, bled brakes."},
+	}
+
+	flagEchoedNarratives(entries)
+
+	for i, want := range []bool{false, true, false, false} {
+		if entries[i].NeedsReview != want {
+			t.Errorf("entry %d: needs review = %v, want %v", i, entries[i].NeedsReview, want)
 		}
 	}
+	if !strings.Contains(entries[1].ExtractionNotes, "nearly repeats the previous entry") {
+		t.Errorf("extraction_notes = %q", entries[1].ExtractionNotes)
+	}
 }
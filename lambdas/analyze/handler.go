@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 
@@ -12,6 +13,8 @@ import (
 	"github.com/projectcloudline/logbook-service/internal/awsutil"
 	"github.com/projectcloudline/logbook-service/internal/db"
 	"github.com/projectcloudline/logbook-service/internal/gemini"
+	"github.com/projectcloudline/logbook-service/internal/slicer"
+	"github.com/projectcloudline/logbook-service/internal/webhook"
 )
 
 // Handler holds dependencies for the Analyze Lambda.
@@ -22,6 +25,105 @@ type Handler struct {
 	gemini  gemini.Client
 	claude  anthropic.Client
 	bucket  string
+
+	// autoApproveThreshold approves QA-passed entries whose confidence
+	// exceeds it at save time. Zero disables auto approval.
+	autoApproveThreshold float64
+
+	// sliceFormat is the encoding for slice images sent to the models and
+	// stored for audit. Empty uses the slicer default (JPEG).
+	sliceFormat slicer.OutputFormat
+	// cwebpPath overrides the cwebp binary WebP slices are encoded with
+	// (for testing).
+	cwebpPath string
+
+	// modelJPEGQuality, when set, has the slicer encode a separate JPEG copy
+	// of each slice at this quality for the models; the audit copy keeps
+	// sliceFormat. Zero sends the models the audit copy.
+	modelJPEGQuality int
+
+	// modelGrayscale encodes the models' copy as grayscale, which keeps
+	// thin colored ink sharp on dense handwriting where chroma subsampling
+	// would blur it.
+	modelGrayscale bool
+
+	// skipSliceUploads sends slices to the models without storing a copy in
+	// S3 for audit. Entries then have no slice image to review or verify
+	// against.
+	skipSliceUploads bool
+
+	// maxImagePixels is the decode pixel budget passed to the slicer. Zero
+	// uses the slicer default.
+	maxImagePixels int
+
+	// autoRotate has the slicer turn pages that look upside down the right
+	// way up before slicing them.
+	autoRotate bool
+
+	// llmCallTimeout bounds each Gemini and Claude call, so one hung call
+	// fails its slice instead of the whole invocation. Zero leaves calls
+	// bounded only by the invocation deadline.
+	llmCallTimeout time.Duration
+
+	// qaMaxRetries caps re-extractions after a critical QA failure. Zero
+	// disables retries.
+	qaMaxRetries int
+
+	// qaSampleRate is the chance that a slice of confident, routine entries
+	// still goes to QA. 1 checks every slice; 0 checks only the slices
+	// sampling never skips.
+	qaSampleRate float64
+
+	// preprocess names the image preprocessing applied to slices before they
+	// are sent to the models ("contrast"). Empty disables it.
+	preprocess string
+
+	// stickerSlices is what happens to entries read from stickers and labels
+	// (stickerSkip drops them). Empty keeps them as entry_type 'other' with
+	// source 'sticker'.
+	stickerSlices string
+
+	// maxNarrativeLength is the longest narrative, in characters, saved
+	// without being flagged for review. Zero uses defaultMaxNarrativeLength.
+	maxNarrativeLength int
+
+	// compressRawExtraction gzips upload_pages.raw_extraction before storing it.
+	compressRawExtraction bool
+
+	// skipBlankPages marks pages with almost no ink skipped instead of
+	// sending them for extraction.
+	skipBlankPages bool
+
+	// ocrPrepass runs OCR over pages the slicer left whole and skips those
+	// it finds no text on, flagged for review. Without the OCR binary pages
+	// are extracted as usual.
+	ocrPrepass bool
+	// tesseractPath overrides the tesseract binary the OCR pre-pass runs
+	// (for testing).
+	tesseractPath string
+
+	// dryRun runs extraction and QA for every page without writing to the
+	// database. A message can also ask for it with pageMessage.DryRun.
+	dryRun bool
+
+	// sampling holds the temperature, top-p and top-k for extraction calls.
+	// Nil fields use the defaults; see extractionConfig.
+	sampling gemini.GenerateConfig
+
+	// embedding selects the narrative embedding model and its dimension.
+	embedding gemini.EmbeddingConfig
+
+	// vectorUnavailable is set once storing an embedding finds the database
+	// without pgvector; later entries skip embedding rather than fail the
+	// same way after paying for the embedding call.
+	vectorUnavailable bool
+
+	// webhook delivers batch completion callbacks. Nil disables them.
+	webhook *webhook.Notifier
+
+	// publisher emits batch completion events for internal consumers. Nil
+	// disables them.
+	publisher awsutil.EventPublisher
 }
 
 // Handle processes SQS messages — one page per message.
@@ -36,7 +138,9 @@ func (h *Handler) Handle(ctx context.Context, event events.SQSEvent) error {
 
 		if err := h.processPage(ctx, msg); err != nil {
 			log.Printf("ERROR processing page %s: %v", msg.PageID, err)
-			h.markPageFailed(ctx, msg.PageID)
+			if !h.isDryRun(msg) && !h.isCandidate(msg) {
+				h.markPageFailed(ctx, msg.PageID)
+			}
 			return err
 		}
 	}
@@ -48,4 +152,23 @@ type pageMessage struct {
 	PageID     string `json:"pageId"`
 	PageNumber int    `json:"pageNumber"`
 	S3Key      string `json:"s3Key"`
+	// DryRun extracts the page without saving anything; see Handler.dryRun.
+	DryRun bool `json:"dryRun,omitempty"`
+	// PromptVersion, when set, extracts the page as a candidate for a new
+	// prompt: the extraction is stored under this version in
+	// upload_pages.raw_extraction_candidate and nothing live is touched. The
+	// stored candidate records the promptVersion of the prompt the page was
+	// actually read with, which can differ from the label.
+	PromptVersion string `json:"promptVersion,omitempty"`
+}
+
+// isDryRun reports whether msg should be processed without database writes.
+func (h *Handler) isDryRun(msg pageMessage) bool {
+	return h.dryRun || msg.DryRun
+}
+
+// isCandidate reports whether msg should store a candidate extraction
+// instead of the live one. A dry run stores neither.
+func (h *Handler) isCandidate(msg pageMessage) bool {
+	return msg.PromptVersion != "" && !h.isDryRun(msg)
 }
@@ -6,14 +6,19 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
 
 	"github.com/aws/aws-lambda-go/lambda"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
 
 	"github.com/projectcloudline/logbook-service/internal/awsutil"
 	"github.com/projectcloudline/logbook-service/internal/db"
+	"github.com/projectcloudline/logbook-service/internal/gemini"
+	"github.com/projectcloudline/logbook-service/internal/slicer"
+	"github.com/projectcloudline/logbook-service/internal/webhook"
 )
 
 func main() {
@@ -48,17 +53,208 @@ func main() {
 		}
 		return creds, nil
 	})
+	// Say at cold start whether the database can store and search embeddings.
+	db.LogVectorSupport(ctx, database)
 
 	h := &Handler{
 		db:      database,
 		s3:      s3Client,
 		secrets: secrets,
 		bucket:  os.Getenv("BUCKET_NAME"),
+
+		autoApproveThreshold:  autoApproveThreshold(),
+		sliceFormat:           sliceFormat(),
+		maxImagePixels:        maxImagePixels(),
+		modelJPEGQuality:      modelJPEGQuality(),
+		modelGrayscale:        os.Getenv("SLICE_MODEL_GRAYSCALE") == "true",
+		skipSliceUploads:      os.Getenv("UPLOAD_SLICES") == "false",
+		autoRotate:            os.Getenv("SLICER_AUTO_ROTATE") == "true",
+		qaMaxRetries:          qaMaxRetries(),
+		qaSampleRate:          qaSampleRate(),
+		llmCallTimeout:        gemini.CallTimeoutFromEnv(),
+		preprocess:            preprocessMode(),
+		stickerSlices:         stickerSlices(),
+		maxNarrativeLength:    maxNarrativeLength(),
+		compressRawExtraction: os.Getenv("COMPRESS_RAW_EXTRACTION") == "true",
+		skipBlankPages:        os.Getenv("SKIP_BLANK_PAGES") == "true",
+		ocrPrepass:            os.Getenv("OCR_PREPASS") == "true",
+		dryRun:                os.Getenv("DRY_RUN_EXTRACTION") == "true",
+		sampling:              generateSampling(),
+		embedding:             gemini.EmbeddingConfigFromEnv(),
+	}
+	if arn := os.Getenv("WEBHOOK_SECRET_ARN"); arn != "" {
+		h.webhook = &webhook.Notifier{Secrets: secrets, SecretARN: arn}
+	}
+	if queueURL := os.Getenv("BATCH_EVENTS_QUEUE_URL"); queueURL != "" {
+		h.publisher = awsutil.NewSQSEventPublisher(sqs.NewFromConfig(cfg), queueURL)
 	}
 
 	lambda.Start(h.Handle)
 }
 
+// autoApproveThreshold parses AUTO_APPROVE_THRESHOLD (0–1). Unset or invalid
+// values disable auto approval.
+func autoApproveThreshold() float64 {
+	raw := os.Getenv("AUTO_APPROVE_THRESHOLD")
+	if raw == "" {
+		return 0
+	}
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil || v <= 0 || v > 1 {
+		log.Printf("WARNING: ignoring invalid AUTO_APPROVE_THRESHOLD %q", raw)
+		return 0
+	}
+	return v
+}
+
+// sliceFormat parses SLICE_FORMAT (jpeg, png or webp). Unset or invalid
+// values fall back to JPEG.
+func sliceFormat() slicer.OutputFormat {
+	f := slicer.OutputFormat(os.Getenv("SLICE_FORMAT"))
+	if _, err := f.MIMEType(); err != nil {
+		log.Printf("WARNING: ignoring invalid SLICE_FORMAT %q", f)
+		return slicer.FormatJPEG
+	}
+	return f
+}
+
+// modelJPEGQuality parses SLICE_MODEL_JPEG_QUALITY (1–100), the quality of
+// the slice copies sent to the models. Unset or invalid values send the
+// audit copies.
+func modelJPEGQuality() int {
+	raw := os.Getenv("SLICE_MODEL_JPEG_QUALITY")
+	if raw == "" {
+		return 0
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v < 1 || v > 100 {
+		log.Printf("WARNING: ignoring invalid SLICE_MODEL_JPEG_QUALITY %q", raw)
+		return 0
+	}
+	return v
+}
+
+// maxImagePixels parses MAX_IMAGE_PIXELS, the decode pixel budget for page
+// images. Unset or invalid values use the slicer default.
+func maxImagePixels() int {
+	raw := os.Getenv("MAX_IMAGE_PIXELS")
+	if raw == "" {
+		return 0
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v <= 0 {
+		log.Printf("WARNING: ignoring invalid MAX_IMAGE_PIXELS %q", raw)
+		return 0
+	}
+	return v
+}
+
+// maxNarrativeLength parses MAX_NARRATIVE_LENGTH, the longest narrative
+// saved without being flagged. Unset or invalid values use the default.
+func maxNarrativeLength() int {
+	raw := os.Getenv("MAX_NARRATIVE_LENGTH")
+	if raw == "" {
+		return 0
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v <= 0 {
+		log.Printf("WARNING: ignoring invalid MAX_NARRATIVE_LENGTH %q", raw)
+		return 0
+	}
+	return v
+}
+
+// qaMaxRetries parses QA_MAX_RETRIES, the number of re-extractions allowed
+// after a critical QA failure; 0 disables retries. Unset or invalid values
+// use the default of 1.
+func qaMaxRetries() int {
+	raw := os.Getenv("QA_MAX_RETRIES")
+	if raw == "" {
+		return defaultQAMaxRetries
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v < 0 {
+		log.Printf("WARNING: ignoring invalid QA_MAX_RETRIES %q", raw)
+		return defaultQAMaxRetries
+	}
+	return v
+}
+
+// qaSampleRate parses QA_SAMPLE_RATE (0–1), the fraction of confident,
+// routine slices that still get QA; 0 skips all of them. Unset or invalid
+// values use 1, checking every slice.
+func qaSampleRate() float64 {
+	raw := os.Getenv("QA_SAMPLE_RATE")
+	if raw == "" {
+		return 1
+	}
+	v, err := strconv.ParseFloat(raw, 64)
+	if err != nil || v < 0 || v > 1 {
+		log.Printf("WARNING: ignoring invalid QA_SAMPLE_RATE %q", raw)
+		return 1
+	}
+	return v
+}
+
+// preprocessMode parses ANALYZE_PREPROCESS. Only "contrast" is supported;
+// unset or unknown values disable preprocessing.
+func preprocessMode() string {
+	raw := os.Getenv("ANALYZE_PREPROCESS")
+	switch raw {
+	case "", preprocessContrast:
+		return raw
+	}
+	log.Printf("WARNING: ignoring invalid ANALYZE_PREPROCESS %q", raw)
+	return ""
+}
+
+// stickerSlices parses STICKER_SLICES. Only "skip" is supported; unset or
+// unknown values keep sticker entries.
+func stickerSlices() string {
+	raw := os.Getenv("STICKER_SLICES")
+	switch raw {
+	case "", stickerSkip:
+		return raw
+	}
+	log.Printf("WARNING: ignoring invalid STICKER_SLICES %q", raw)
+	return ""
+}
+
+// generateSampling parses GENERATE_TEMPERATURE (0–2), GENERATE_TOP_P (0–1)
+// and GENERATE_TOP_K (a positive integer) for Gemini generation calls. Unset
+// or invalid values leave that setting at its default.
+func generateSampling() gemini.GenerateConfig {
+	var cfg gemini.GenerateConfig
+	if raw := os.Getenv("GENERATE_TEMPERATURE"); raw != "" {
+		v, err := strconv.ParseFloat(raw, 32)
+		if err != nil || v < 0 || v > 2 {
+			log.Printf("WARNING: ignoring invalid GENERATE_TEMPERATURE %q", raw)
+		} else {
+			temp := float32(v)
+			cfg.Temperature = &temp
+		}
+	}
+	if raw := os.Getenv("GENERATE_TOP_P"); raw != "" {
+		v, err := strconv.ParseFloat(raw, 32)
+		if err != nil || v <= 0 || v > 1 {
+			log.Printf("WARNING: ignoring invalid GENERATE_TOP_P %q", raw)
+		} else {
+			topP := float32(v)
+			cfg.TopP = &topP
+		}
+	}
+	if raw := os.Getenv("GENERATE_TOP_K"); raw != "" {
+		v, err := strconv.ParseInt(raw, 10, 32)
+		if err != nil || v <= 0 {
+			log.Printf("WARNING: ignoring invalid GENERATE_TOP_K %q", raw)
+		} else {
+			topK := int32(v)
+			cfg.TopK = &topK
+		}
+	}
+	return cfg
+}
+
 func envOrDefault(key, def string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Extraction sometimes goes wrong in ways the schema can't catch: the model
+// loops, repeating a phrase until its output runs out, or reads an entry
+// again from a neighboring slice. Such narratives pollute search, so the
+// entries are flagged for review. They are kept, since the text may still be
+// right.
+const (
+	defaultMaxNarrativeLength = 3000 // Characters; itemized annual inspections are the longest real ones
+	maxCharRun                = 10   // The same letter or digit this many times in a row
+	minRepetitionWords        = 12   // Shorter narratives aren't judged for repeated phrases
+	maxRepeatedTrigrams       = 0.5  // Fraction of word trigrams that repeat an earlier one
+	minEchoSimilarity         = 0.9  // Narrative similarity that makes an adjacent entry on the same date an echo
+)
+
+// narrativeProblem describes what makes a narrative implausible, or returns
+// "" for one that looks normal. maxLen is in characters.
+func narrativeProblem(narrative string, maxLen int) string {
+	if n := utf8.RuneCountInString(narrative); n > maxLen {
+		return fmt.Sprintf("Narrative is implausibly long (%d characters)", n)
+	}
+	if r, ok := longCharRun(narrative); ok {
+		return fmt.Sprintf("Narrative repeats %q %d or more times in a row", r, maxCharRun)
+	}
+	if repeatsPhrases(narrative) {
+		return "Narrative repeats the same phrases"
+	}
+	return ""
+}
+
+// longCharRun returns the first letter or digit repeated maxCharRun times in
+// a row. Runs of punctuation, like the dot leaders on printed forms, don't
+// count.
+func longCharRun(s string) (rune, bool) {
+	var prev rune
+	run := 0
+	for _, r := range s {
+		if r == prev && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			run++
+		} else {
+			prev, run = r, 1
+		}
+		if run >= maxCharRun {
+			return r, true
+		}
+	}
+	return 0, false
+}
+
+// repeatsPhrases reports whether most of a narrative's word trigrams repeat
+// earlier ones, as when the model loops over the same few words. Lists of
+// similar items ("removed and replaced left main tire, removed and replaced
+// right main tire") repeat some but stay well under the limit.
+func repeatsPhrases(s string) bool {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) < minRepetitionWords {
+		return false
+	}
+	seen := make(map[[3]string]bool)
+	repeats := 0
+	for i := 2; i < len(words); i++ {
+		t := [3]string{words[i-2], words[i-1], words[i]}
+		if seen[t] {
+			repeats++
+		}
+		seen[t] = true
+	}
+	return float64(repeats)/float64(len(words)-2) >= maxRepeatedTrigrams
+}
+
+// flagEchoedNarratives flags each entry that repeats the one before it: the
+// same date and a near-identical narrative. That is usually a slice that
+// caught part of its neighbor reading the neighbor's entry again, rather
+// than two real entries.
+func flagEchoedNarratives(entries []extractedEntry) {
+	for i := 1; i < len(entries); i++ {
+		prev, e := &entries[i-1], &entries[i]
+		if e.Date == "" || e.Date != prev.Date {
+			continue
+		}
+		if narrativeSimilarity(prev.MaintenanceNarrative, e.MaintenanceNarrative) < minEchoSimilarity {
+			continue
+		}
+		e.NeedsReview = true
+		e.ExtractionNotes += "Narrative nearly repeats the previous entry's. "
+	}
+}
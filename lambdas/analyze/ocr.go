@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The OCR pre-pass runs tesseract over pages the slicer couldn't split, to
+// tell a page with writing on it from a cover, a photo or a smudged blank
+// before paying for a full-page extraction. It is optional: without the
+// binary, or when it fails, the page is extracted as before.
+
+// OCR words count towards a page having text only when tesseract is at
+// least this confident in them and they are this long, which keeps the
+// specks and ruling it reads as stray characters out.
+const (
+	minOCRWordConfidence = 60
+	minOCRWordLength     = 2
+	// minOCRWords is how many such words a page needs to be worth extracting.
+	minOCRWords = 3
+)
+
+// ocrWord is one word tesseract recognized.
+type ocrWord struct {
+	Text       string
+	Confidence float64
+}
+
+// ocrPath returns the tesseract binary to run: the configured override, the
+// binary bundled with the Lambda, or tesseract from PATH.
+func (h *Handler) ocrPath() string {
+	if h.tesseractPath != "" {
+		return h.tesseractPath
+	}
+	execDir, _ := os.Executable()
+	bundled := filepath.Join(filepath.Dir(execDir), "bin", "tesseract-arm64")
+	if _, err := os.Stat(bundled); err == nil {
+		return bundled
+	}
+	return "tesseract"
+}
+
+// runOCR returns the words tesseract finds in imageData.
+func (h *Handler) runOCR(ctx context.Context, imageData []byte) ([]ocrWord, error) {
+	in, err := os.CreateTemp("", "ocr-in-*")
+	if err != nil {
+		return nil, fmt.Errorf("create temp input: %w", err)
+	}
+	defer os.Remove(in.Name())
+	if _, err := in.Write(imageData); err != nil {
+		in.Close()
+		return nil, fmt.Errorf("write temp input: %w", err)
+	}
+	in.Close()
+
+	// tesseract <image> stdout tsv
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, h.ocrPath(), in.Name(), "stdout", "tsv")
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("tesseract: %w (%s)", err, strings.TrimSpace(stderr.String()))
+	}
+	return parseOCRTSV(out), nil
+}
+
+// parseOCRTSV reads the words out of tesseract's TSV output, whose columns
+// are level, page_num, block_num, par_num, line_num, word_num, left, top,
+// width, height, conf and text. Word rows are level 5; the rest describe
+// the layout around them. Unreadable rows are skipped.
+func parseOCRTSV(tsv []byte) []ocrWord {
+	var words []ocrWord
+	sc := bufio.NewScanner(bytes.NewReader(tsv))
+	for sc.Scan() {
+		f := strings.Split(sc.Text(), "\t")
+		if len(f) < 12 || f[0] != "5" {
+			continue
+		}
+		text := strings.TrimSpace(f[11])
+		conf, err := strconv.ParseFloat(f[10], 64)
+		if text == "" || err != nil {
+			continue
+		}
+		words = append(words, ocrWord{Text: text, Confidence: conf})
+	}
+	return words
+}
+
+// hasText reports whether words amount to writing worth extracting.
+func hasText(words []ocrWord) bool {
+	n := 0
+	for _, w := range words {
+		if w.Confidence >= minOCRWordConfidence && len([]rune(w.Text)) >= minOCRWordLength {
+			n++
+		}
+	}
+	return n >= minOCRWords
+}
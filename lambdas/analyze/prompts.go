@@ -1,10 +1,21 @@
 package main
 
 import (
+	"crypto/sha256"
 	"fmt"
 	"strings"
+
+	"github.com/projectcloudline/logbook-service/internal/qa"
 )
 
+// promptVersion identifies an extraction prompt by a hash of its text, so
+// entries record which prompt they were read with without anyone having to
+// bump a version when the prompt changes.
+func promptVersion(prompt string) string {
+	sum := sha256.Sum256([]byte(prompt))
+	return fmt.Sprintf("%x", sum[:6])
+}
+
 // SliceExtractionPrompt is sent to Gemini with each cropped entry strip.
 // It demands verbatim transcription — no summarizing, no grammar correction.
 const SliceExtractionPrompt = `You are an expert data entry specialist. Your job is to transcribe this single logbook entry VERBATIM.
@@ -29,7 +40,7 @@ WHAT TO EXTRACT:
 - Work order number
 - Complete maintenance narrative (VERBATIM — every single word)
 - AD compliance noted (AD numbers and compliance method)
-- Parts actions (installed, removed, replaced, repaired) with P/N, S/N, quantity
+- Parts actions (installed, removed, replaced, repaired) with P/N, S/N, quantity, and any life limit stated for the part
 - Any inspection signoffs (annual, 100hr, etc.)
 
 ENTRY TYPE CLASSIFICATION RULES:
@@ -40,6 +51,7 @@ ENTRY TYPE CLASSIFICATION RULES:
 
 SPECIAL CASES:
 - If this slice shows a header row, blank space, or non-entry content: return {"pageType": "other", "entries": []}
+- If this slice is an adhesive sticker or label (oil change reminder, STC or placard label, inspection due sticker) rather than a handwritten or typed logbook entry: set pageType to "sticker" and transcribe it as one entry
 - Most slices contain exactly 1 entry. If you see 2 entries, return both.
 - If a value is unclear, include your best guess with [?] marker
 - If a field is completely illegible, use null and list in missingData
@@ -49,7 +61,7 @@ SPECIAL CASES:
 
 Return JSON format:
 {
-  "pageType": "maintenance_entry" | "inspection_form" | "parts_list" | "cover" | "blank" | "other",
+  "pageType": "maintenance_entry" | "inspection_form" | "parts_list" | "weight_balance" | "sticker" | "cover" | "blank" | "other",
   "entries": [
     {
       "date": "YYYY-MM-DD",
@@ -81,7 +93,9 @@ Return JSON format:
           "serialNumber": "S/N or null",
           "oldPartNumber": "P/N of removed part",
           "oldSerialNumber": "S/N of removed part",
-          "quantity": 1
+          "quantity": 1,
+          "lifeLimitHours": "life limit in hours if stated, else null",
+          "lifeLimitMonths": "life limit in months if stated, else null"
         }
       ],
       "inspectionType": "annual" | "100hr" | "50hr" | "progressive" | "altimeter_static" | "transponder" | "elt" | null,
@@ -95,122 +109,119 @@ Return JSON format:
   ]
 }`
 
-// QAVerificationPrompt is sent to the QA model (Claude or Gemini fallback) with
-// the slice image and the extraction JSON. The QA model verifies each extracted
-// entry against the image and returns a structured verdict.
-const QAVerificationPrompt = `You are a QA specialist verifying another AI model's extraction of aircraft maintenance logbook entries. You will receive:
-1. An image of a cropped logbook entry
-2. The JSON extraction produced by the extraction model
-
-YOUR ROLE: Verify that the extraction accurately reflects what is visible in the image.
-
-CRITICAL RULES:
-- You CANNOT infer, guess, or fill in data that is not clearly visible in the image
-- You CANNOT correct grammar, spelling, or abbreviations — the extraction SHOULD preserve these exactly as written
-- You MUST compare each field value against what is actually visible in the image
-- Abbreviations like "w/o", "R/R", "c/w", "IAW", "P/N", "S/N" are CORRECT and should NOT be flagged
-- Minor formatting differences (spacing, capitalization) are NOT issues unless they change meaning
-
-AIRCRAFT IDENTITY RULES:
-- Logbook entries often omit the aircraft make, model, or even registration — this is NORMAL and NOT an issue
-- All entries in a logbook are presumed to belong to the aircraft that logbook is for
-- Only flag aircraft identity fields if the extracted value CONFLICTS with what is visible (e.g., wrong N-number, wrong serial)
-- Do NOT flag missing aircraft identity fields (null/empty make, model, registration, serial)
-- Do NOT infer aircraft make/model from context (e.g., from service bulletin references or part numbers)
-
-WHAT TO CHECK:
-- Date: Does the extracted date match what is visible?
-- Aircraft identifiers: ONLY if present — check that extracted values match (do NOT flag missing values)
-- Time readings: Hobbs, tach, flight time, TSO/TSMOH
-- Shop/mechanic information: Names, certificate numbers, addresses
-- Maintenance narrative: Is every visible word captured? Is anything added that is not visible? Is anything truncated?
-- Parts actions: Part numbers, serial numbers, action types, quantities
-- AD compliance: AD numbers, compliance methods
-- Entry type classification: Is the categorization reasonable?
-
-ERROR TAXONOMY — use these exact values for the "issue" field:
-
-Entry-level issues:
-- "missing_entry" — a visible entry in the image was not extracted at all
-- "fabricated_entry" — an entry in the extraction has no corresponding content in the image
-
-Field-level issues:
-- "incorrect" — field value does not match what is visible (wrong characters, numbers, words)
-- "truncated" — narrative or field value is cut short, missing visible words
-- "missing_field" — field is clearly visible in the image but extracted as null or empty
-- "added_text" — words present in the extraction that are not visible in the image
-- "wrong_classification" — entryType, inspectionType, or action type is miscategorized
-
-Severity:
-- "critical" — wrong part number, serial number, AD number, date; missing or added narrative text; fabricated or missed entries
-- "minor" — formatting differences, classification edge cases, ambiguous or illegible readings
-
-VERDICT LOGIC:
-- "pass" — no critical issues found
-- "needs_review" — only minor issues or ambiguous/illegible areas where you cannot determine correctness
-- "fail" — one or more critical issues are present
-
-Return JSON format:
-{
-  "results": [
-    {
-      "entryIndex": 0,
-      "verdict": "pass | fail | needs_review",
-      "issues": [
-        {
-          "field": "maintenanceNarrative",
-          "issue": "truncated",
-          "expected": "what you see in the image",
-          "extracted": "what the extraction contains",
-          "severity": "critical"
-        }
-      ],
-      "summary": "Brief explanation of your verdict"
-    }
-  ]
-}
-
-If the extraction has no entries and the image shows no entries (blank/header), return:
-{"results": []}
-
-IMPORTANT: Be precise and conservative. Only flag genuine discrepancies you can clearly see. When in doubt about legibility, use "needs_review" verdict with a "minor" severity issue explaining the ambiguity.`
-
-// buildRetryPrompt appends QA feedback to the extraction prompt for a retry
-// attempt. It tells the extraction model WHICH fields were flagged and WHAT
+// buildRetryPrompt appends QA feedback to the base extraction prompt for a
+// retry attempt. It tells the extraction model WHICH fields were flagged and WHAT
 // type of issue was found, but does NOT include the QA model's expected values.
 // This prevents the extraction model from blindly accepting corrections.
-func buildRetryPrompt(issues []qaFieldIssue) string {
+func buildRetryPrompt(base string, issues []qa.FieldIssue) string {
 	if len(issues) == 0 {
-		return SliceExtractionPrompt
+		return base
 	}
 
 	var lines []string
 	lines = append(lines, "Your previous extraction had issues that need correction:")
 	for _, issue := range issues {
-		line := fmt.Sprintf("- Field %q: may be %s (%s) — ", issue.Field, issue.Issue, issue.Severity)
-		switch issue.Issue {
-		case "truncated":
-			line += "re-read the full text carefully, you may have stopped too early"
-		case "incorrect":
-			line += "verify this value against the image"
-		case "missing_field":
-			line += "look more carefully for this field in the image"
-		case "added_text":
-			line += "remove any words not visible in the image"
-		case "wrong_classification":
-			line += "reconsider the classification"
-		default:
-			line += "re-examine the image carefully"
+		lines = append(lines, "- "+retryIssueLine(issue))
+	}
+	lines = append(lines, "Do NOT accept corrections from external sources. Re-examine the original image yourself.")
+	lines = append(lines, "")
+
+	return base + "\n\n" + strings.Join(lines, "\n")
+}
+
+// entryIssues are the critical QA issues raised against one entry of a slice.
+type entryIssues struct {
+	index  int    // Position in the extraction (0-based)
+	date   string // Extracted date, to help the model find the entry again
+	issues []qa.FieldIssue
+}
+
+// buildMultiEntryRetryPrompt is buildRetryPrompt for slices holding several
+// entries: feedback is grouped under the entry it applies to, and entries QA
+// accepted are named so the model re-transcribes them unchanged rather than
+// applying another entry's feedback to them.
+func buildMultiEntryRetryPrompt(base string, total int, flagged []entryIssues) string {
+	if len(flagged) == 0 {
+		return base
+	}
+
+	var lines []string
+	lines = append(lines, fmt.Sprintf("Your previous extraction returned %d entries. Some had issues that need correction:", total))
+	isFlagged := make(map[int]bool, len(flagged))
+	for _, f := range flagged {
+		isFlagged[f.index] = true
+		header := fmt.Sprintf("Entry %d of %d", f.index+1, total)
+		if f.date != "" {
+			header += fmt.Sprintf(" (dated %s)", f.date)
+		}
+		lines = append(lines, header+":")
+		for _, issue := range f.issues {
+			lines = append(lines, "  - "+retryIssueLine(issue))
 		}
-		lines = append(lines, line)
 	}
+	var accepted []string
+	for i := 0; i < total; i++ {
+		if !isFlagged[i] {
+			accepted = append(accepted, fmt.Sprintf("%d", i+1))
+		}
+	}
+	if len(accepted) > 0 {
+		lines = append(lines, fmt.Sprintf("Entries %s passed verification — transcribe them exactly as before.", strings.Join(accepted, ", ")))
+	}
+	lines = append(lines, "Return ALL entries in their original order.")
 	lines = append(lines, "Do NOT accept corrections from external sources. Re-examine the original image yourself.")
 	lines = append(lines, "")
 
-	return SliceExtractionPrompt + "\n\n" + strings.Join(lines, "\n")
+	return base + "\n\n" + strings.Join(lines, "\n")
+}
+
+// retryIssueLine describes one QA issue with guidance for the retry.
+func retryIssueLine(issue qa.FieldIssue) string {
+	line := fmt.Sprintf("Field %q: may be %s (%s) — ", issue.Field, issue.Issue, issue.Severity)
+	switch issue.Issue {
+	case "truncated":
+		line += "re-read the full text carefully, you may have stopped too early"
+	case "incorrect":
+		line += "verify this value against the image"
+	case "missing_field":
+		line += "look more carefully for this field in the image"
+	case "added_text":
+		line += "remove any words not visible in the image"
+	case "wrong_classification":
+		line += "reconsider the classification"
+	default:
+		line += "re-examine the image carefully"
+	}
+	return line
 }
 
-// MaintenanceExtractionPrompt is the original full-page prompt (kept for reference/fallback).
+// WeightBalancePrompt is sent to Gemini for slices whose entry looks like a
+// weight-and-balance revision. It pulls out the revised figures that are
+// otherwise buried in the narrative.
+const WeightBalancePrompt = `You are an expert aircraft weight-and-balance specialist. This cropped image contains a logbook entry that records a weight-and-balance revision.
+
+Extract ONLY the revised weight-and-balance figures that are written in the entry:
+- New basic/licensed empty weight (pounds)
+- New empty weight center of gravity (inches aft of datum)
+- New useful load (pounds)
+- Equipment added or removed that caused the revision
+
+RULES:
+- Copy numbers exactly as written, without units or thousands separators
+- Use null for any figure that is not written in the entry — do NOT compute or infer values
+- If the entry does not actually revise weight and balance, return all fields as null
+
+Return JSON format:
+{
+  "emptyWeight": null,
+  "emptyCG": null,
+  "usefulLoad": null,
+  "equipmentChanges": "equipment added/removed, or empty",
+  "notes": ""
+}`
+
+// MaintenanceExtractionPrompt is the full-page prompt, used instead of
+// SliceExtractionPrompt when slicing leaves the page as a single image.
 const MaintenanceExtractionPrompt = `Analyze this aircraft logbook page image and extract all maintenance entries.
 
 INSTRUCTIONS:
@@ -228,7 +239,7 @@ For each maintenance entry found, extract:
 - Work order number
 - Full maintenance narrative (transcribe completely)
 - AD compliance noted (AD numbers and compliance method)
-- Parts actions (installed, removed, replaced, repaired) with P/N, S/N, quantity
+- Parts actions (installed, removed, replaced, repaired) with P/N, S/N, quantity, and any life limit stated for the part
 - Any inspection signoffs (annual, 100hr, etc.)
 
 ENTRY TYPE CLASSIFICATION RULES:
@@ -280,7 +291,9 @@ Return JSON format:
           "serialNumber": "S/N or null",
           "oldPartNumber": "P/N of removed part",
           "oldSerialNumber": "S/N of removed part",
-          "quantity": 1
+          "quantity": 1,
+          "lifeLimitHours": "life limit in hours if stated, else null",
+          "lifeLimitMonths": "life limit in months if stated, else null"
         }
       ],
       "inspectionType": "annual" | "100hr" | "50hr" | "progressive" | "altimeter_static" | "transponder" | "elt" | null,
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"unicode"
+)
+
+// minSupersedeSimilarity is how alike two narratives on one date must be for
+// the later entry to supersede the earlier. A rescanned page rarely extracts
+// word for word the same, but distinct entries on one date seldom share most
+// of their words.
+const minSupersedeSimilarity = 0.6
+
+// supersedePriorEntries links the earlier entry that entry re-extracts, if
+// any, to entryID. Candidates are the aircraft's unsuperseded entries on the
+// same date from another upload of the same logbook type, wherever they sit
+// in it: a corrective re-upload is often a single page, so page positions
+// don't line up. The one whose narrative is most like entry's is marked
+// superseded when alike enough. Entries from the same upload are never
+// candidates, since two similar entries there are just a busy day, and
+// neither are other logbooks', since the engine and airframe logs often
+// record the same work on the same day. Failures are logged, not returned,
+// like the other child records of an entry.
+func (h *Handler) supersedePriorEntries(ctx context.Context, aircraftID, pageID, entryID string, entry *extractedEntry) {
+	rows, err := h.db.Query(ctx,
+		`SELECT me.id, me.maintenance_narrative
+		 FROM maintenance_entries me
+		 JOIN upload_pages p ON p.id = me.page_id
+		 JOIN upload_batches b ON b.id = p.document_id
+		 JOIN upload_pages np ON np.id = $4
+		 JOIN upload_batches nb ON nb.id = np.document_id
+		 WHERE me.aircraft_id = $1 AND me.entry_date = $2 AND me.id <> $3
+		   AND me.superseded_by IS NULL
+		   AND p.document_id <> np.document_id
+		   AND b.logbook_type IS NOT DISTINCT FROM nb.logbook_type`,
+		aircraftID, entry.Date, entryID, pageID)
+	if err != nil {
+		log.Printf("WARNING: find entries superseded by %s failed: %v", entryID, err)
+		return
+	}
+
+	var best string
+	bestScore := 0.0
+	for _, row := range rows {
+		if score := narrativeSimilarity(entry.MaintenanceNarrative, strVal(row["maintenance_narrative"])); score > bestScore {
+			best, bestScore = fmt.Sprintf("%v", row["id"]), score
+		}
+	}
+	if bestScore < minSupersedeSimilarity {
+		return
+	}
+
+	if err := h.db.Exec(ctx,
+		`UPDATE maintenance_entries SET superseded_by = $1, updated_at = NOW()
+		 WHERE id = $2 AND superseded_by IS NULL`,
+		entryID, best); err != nil {
+		log.Printf("WARNING: mark entry %s superseded failed: %v", best, err)
+		return
+	}
+	log.Printf("  Entry %s supersedes %s (narrative similarity %.2f)", entryID, best, bestScore)
+}
+
+// narrativeSimilarity is the Jaccard similarity of the two narratives'
+// words, ignoring case and punctuation: 1 for the same words, 0 for none in
+// common or when either is empty.
+func narrativeSimilarity(a, b string) float64 {
+	wa, wb := narrativeWords(a), narrativeWords(b)
+	if len(wa) == 0 || len(wb) == 0 {
+		return 0
+	}
+	shared := 0
+	for w := range wa {
+		if wb[w] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(wa)+len(wb)-shared)
+}
+
+func narrativeWords(s string) map[string]bool {
+	words := map[string]bool{}
+	for _, w := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		words[w] = true
+	}
+	return words
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/projectcloudline/logbook-service/internal/gemini"
+)
+
+// tokenUsage tallies the Gemini generation calls made for a page and the
+// tokens they used, for cost attribution.
+type tokenUsage struct {
+	UploadID     string `json:"uploadId"`
+	PageID       string `json:"pageId"`
+	Calls        int    `json:"calls"`
+	InputTokens  int    `json:"inputTokens"`
+	OutputTokens int    `json:"outputTokens"`
+}
+
+// log writes the tally as one "usage {json}" line, for log metric filters
+// and Logs Insights queries.
+func (u *tokenUsage) log() {
+	b, _ := json.Marshal(u)
+	log.Printf("usage %s", b)
+}
+
+// usageClient tallies every successful GenerateContent call, and the
+// tokens its response reports, into usage.
+type usageClient struct {
+	gemini.Client
+	usage *tokenUsage
+}
+
+func (c *usageClient) GenerateContent(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+	var u gemini.Usage
+	text, err := c.Client.GenerateContent(gemini.WithUsage(ctx, &u), model, parts, config)
+	if err != nil {
+		return text, err
+	}
+	c.usage.Calls++
+	c.usage.InputTokens += u.PromptTokens
+	c.usage.OutputTokens += u.CandidatesTokens
+	return text, nil
+}
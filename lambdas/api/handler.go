@@ -1,24 +1,46 @@
 package main
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
 	cryptoRand "crypto/rand"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"net/http"
+	"math"
+	"net/netip"
+	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
+	"runtime/debug"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/aws/aws-lambda-go/events"
 
+	"github.com/projectcloudline/logbook-service/internal/anthropic"
 	"github.com/projectcloudline/logbook-service/internal/awsutil"
 	"github.com/projectcloudline/logbook-service/internal/db"
+	"github.com/projectcloudline/logbook-service/internal/faa"
 	"github.com/projectcloudline/logbook-service/internal/gemini"
+	"github.com/projectcloudline/logbook-service/internal/imageutil"
 	"github.com/projectcloudline/logbook-service/internal/models"
+	"github.com/projectcloudline/logbook-service/internal/qa"
+	"github.com/projectcloudline/logbook-service/internal/rawextraction"
+	"github.com/projectcloudline/logbook-service/internal/report"
+	"github.com/projectcloudline/logbook-service/internal/slicer"
+	"github.com/projectcloudline/logbook-service/internal/sourceurl"
+	"github.com/projectcloudline/logbook-service/internal/webhook"
 )
 
 // Handler holds dependencies for all API endpoints.
@@ -27,7 +49,75 @@ type Handler struct {
 	s3      awsutil.S3Client
 	secrets awsutil.SecretsProvider
 	gemini  gemini.Client
+	claude  anthropic.Client
 	bucket  string
+
+	// sqs and fetchQueueURL queue server-side downloads for sourceUrl uploads.
+	sqs           awsutil.SQSClient
+	fetchQueueURL string
+	// sourceHosts lists the hosts sourceUrl uploads may come from. Empty
+	// disables sourceUrl uploads.
+	sourceHosts sourceurl.Allowlist
+
+	// faa enriches uploaded aircraft from the FAA registry. Nil disables it.
+	faa *faa.Enricher
+	// enrichQueueURL, when set, hands enrichment to the enrich worker over
+	// SQS instead of running it in a background goroutine here.
+	enrichQueueURL string
+	// enrichWG tracks background FAA enrichments so tests can wait on them.
+	enrichWG sync.WaitGroup
+
+	// embedding selects the question embedding model; it must match the
+	// model the stored narrative embeddings came from.
+	embedding gemini.EmbeddingConfig
+
+	// llmCallTimeout bounds each Gemini and Claude call. Zero leaves calls
+	// bounded only by the invocation deadline.
+	llmCallTimeout time.Duration
+
+	// sampling holds the temperature, top-p and top-k for query answers.
+	// A nil temperature uses defaultQueryTemperature.
+	sampling gemini.GenerateConfig
+
+	// queryStreaming has Invoke answer POST /aircraft/{tailNumber}/query in
+	// the response streaming format. It must match the integration: on only
+	// when API Gateway invokes that method with response streaming.
+	queryStreaming bool
+
+	// slicerDiagnostics routes the slicer diagnostic endpoint. It is meant
+	// for operators, so it stays off unless configured.
+	slicerDiagnostics bool
+
+	// presignPutTTL and presignGetTTL are the lifetimes of presigned upload
+	// and download URLs. Zero uses defaultPresignTTL; see presignTTL.
+	presignPutTTL time.Duration
+	presignGetTTL time.Duration
+
+	// analyzeQueueURL queues pages for candidate extraction.
+	analyzeQueueURL string
+	// adminKeys holds the API key IDs allowed to use admin endpoints. Empty
+	// leaves them forbidden to everyone.
+	adminKeys map[string]bool
+}
+
+const (
+	// defaultPresignTTL is the lifetime of presigned URLs when none is
+	// configured.
+	defaultPresignTTL = time.Hour
+	// maxPresignTTL is the longest lifetime S3 accepts for a presigned URL.
+	maxPresignTTL = 7 * 24 * time.Hour
+)
+
+// presignTTL returns ttl, defaulted and clamped to S3's maximum.
+func presignTTL(ttl time.Duration) time.Duration {
+	switch {
+	case ttl <= 0:
+		return defaultPresignTTL
+	case ttl > maxPresignTTL:
+		return maxPresignTTL
+	default:
+		return ttl
+	}
 }
 
 var pdfExtensions = map[string]bool{".pdf": true}
@@ -45,109 +135,476 @@ var contentTypeMap = map[string]string{
 	".pdf": "application/pdf",
 }
 
+// Sort allowlists map the `sort` query param to fixed ORDER BY clauses so user
+// input is never interpolated into SQL. A leading "-" means descending.
+var entrySorts = map[string]string{
+	"date":        "me.entry_date ASC, me.id",
+	"-date":       "me.entry_date DESC, me.id",
+	"confidence":  "me.confidence_score ASC NULLS LAST, me.id",
+	"-confidence": "me.confidence_score DESC NULLS LAST, me.id",
+	"created":     "me.created_at ASC, me.id",
+	"-created":    "me.created_at DESC, me.id",
+}
+
+var inspectionSorts = map[string]string{
+	"date":     "ir.inspection_date ASC, ir.id",
+	"-date":    "ir.inspection_date DESC, ir.id",
+	"created":  "ir.created_at ASC, ir.id",
+	"-created": "ir.created_at DESC, ir.id",
+}
+
+var adSorts = map[string]string{
+	"date":     "ad.compliance_date ASC NULLS LAST, ad.id",
+	"-date":    "ad.compliance_date DESC NULLS LAST, ad.id",
+	"created":  "ad.created_at ASC, ad.id",
+	"-created": "ad.created_at DESC, ad.id",
+}
+
 // Handle routes incoming events to the appropriate handler.
-func (h *Handler) Handle(ctx context.Context, rawEvent json.RawMessage) (events.APIGatewayProxyResponse, error) {
+func (h *Handler) Handle(ctx context.Context, rawEvent json.RawMessage) (resp events.APIGatewayProxyResponse, err error) {
+	var event events.APIGatewayProxyRequest
+	// A panic anywhere below would otherwise escape the Lambda as an opaque
+	// 502; answer with a clean 500 instead.
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("ERROR: panic handling %s %s: %v\n%s", event.HTTPMethod, event.Resource, r, debug.Stack())
+			resp, err = errResponse(500, codeInternal, "Internal server error")
+			resp = withCORS(resp, requestOrigin(event.Headers))
+		}
+	}()
+
 	// Check for EventBridge warmer
 	var warmer struct {
 		Source string `json:"source"`
 	}
 	if json.Unmarshal(rawEvent, &warmer) == nil && warmer.Source == "logbook.warmer" {
+		// Open the pool now so the next real request doesn't pay for it.
+		if err := h.db.Ping(ctx); err != nil {
+			log.Printf("WARNING: warmer DB ping failed: %v", err)
+		}
 		return events.APIGatewayProxyResponse{StatusCode: 200, Body: "warm"}, nil
 	}
 
-	var event events.APIGatewayProxyRequest
 	if err := json.Unmarshal(rawEvent, &event); err != nil {
-		return errResponse(400, "invalid request")
+		return errResponse(400, codeInvalidRequest, "invalid request")
+	}
+
+	// CORS preflight — answer for every resource before routing
+	if event.HTTPMethod == "OPTIONS" {
+		return models.PreflightResponse(requestOrigin(event.Headers)), nil
+	}
+
+	resp, err = h.route(withTenant(ctx, callerTenant(event)), event)
+	if err != nil {
+		if resp, err = errorResponse(err); err != nil {
+			return resp, err
+		}
+	}
+	return withCORS(resp, requestOrigin(event.Headers)), nil
+}
+
+// Invoke is the Lambda entry point. It hands every event to Handle except,
+// with query streaming on, POST /aircraft/{tailNumber}/query: API Gateway
+// invokes that method in response streaming mode, so its response goes back
+// as a stream, either the answer as server-sent events when the client
+// accepts text/event-stream or else the JSON response Handle gives.
+func (h *Handler) Invoke(ctx context.Context, rawEvent json.RawMessage) (any, error) {
+	var event events.APIGatewayProxyRequest
+	if !h.queryStreaming || json.Unmarshal(rawEvent, &event) != nil ||
+		event.Resource != "/aircraft/{tailNumber}/query" || event.HTTPMethod != "POST" {
+		return h.Handle(ctx, rawEvent)
 	}
+	if !acceptsEventStream(event.Headers) {
+		resp, err := h.Handle(ctx, rawEvent)
+		if err != nil {
+			return nil, err
+		}
+		return streamingResponse(resp), nil
+	}
+
+	origin := requestOrigin(event.Headers)
+	ctx = withTenant(ctx, callerTenant(event))
+	q, early, err := h.prepareQuery(ctx, event.PathParameters["tailNumber"], event)
+	if err != nil {
+		resp, err := errorResponse(err)
+		if err != nil {
+			return nil, err
+		}
+		return streamingResponse(withCORS(resp, origin)), nil
+	}
+	if early != nil {
+		return streamingResponse(withCORS(*early, origin)), nil
+	}
+
+	body, w := io.Pipe()
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("ERROR: panic streaming query answer: %v\n%s", r, debug.Stack())
+				w.CloseWithError(fmt.Errorf("panic: %v", r))
+			}
+		}()
+		w.CloseWithError(h.streamQuery(ctx, q, w))
+	}()
+	headers := models.CORSHeaders(origin)
+	headers["Content-Type"] = "text/event-stream"
+	headers["Cache-Control"] = "no-cache"
+	return &events.LambdaFunctionURLStreamingResponse{StatusCode: 200, Headers: headers, Body: body}, nil
+}
+
+// acceptsEventStream reports whether the Accept header asks for server-sent
+// events.
+func acceptsEventStream(headers map[string]string) bool {
+	return strings.Contains(strings.ToLower(headerValue(headers, "Accept")), "text/event-stream")
+}
+
+// streamingResponse wraps a buffered response in the envelope streaming
+// integrations expect.
+func streamingResponse(resp events.APIGatewayProxyResponse) *events.LambdaFunctionURLStreamingResponse {
+	return &events.LambdaFunctionURLStreamingResponse{
+		StatusCode: resp.StatusCode,
+		Headers:    resp.Headers,
+		Body:       strings.NewReader(resp.Body),
+	}
+}
 
+// route dispatches the request to the matching endpoint handler.
+func (h *Handler) route(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	method := event.HTTPMethod
 	path := event.Resource
 	pathParams := event.PathParameters
 
 	switch {
+	case path == "/health" && method == "GET":
+		return h.handleHealth(ctx, event)
 	case path == "/uploads" && method == "POST":
 		return h.handleUpload(ctx, event)
+	case path == "/uploads/status" && method == "POST":
+		return h.handleBulkStatus(ctx, event)
+	case path == "/uploads/{id}/finalize" && method == "POST":
+		return h.handleFinalizeUpload(ctx, pathParams["id"])
+	case path == "/uploads/{id}/pages" && method == "POST":
+		return h.handleAppendPages(ctx, pathParams["id"], event)
+	case path == "/uploads/{id}/pages/order" && method == "PATCH":
+		return h.handleReorderPages(ctx, pathParams["id"], event)
 	case path == "/uploads/{id}/status" && method == "GET":
 		return h.handleStatus(ctx, pathParams["id"])
 	case path == "/uploads/{id}/pages/{pageNumber}/image" && method == "GET":
 		return h.handlePageImage(ctx, pathParams["id"], pathParams["pageNumber"])
+	case path == "/uploads/{id}/pages/{pageNumber}/thumbnail" && method == "GET":
+		return h.handlePageThumbnail(ctx, pathParams["id"], pathParams["pageNumber"])
+	case path == "/uploads/{id}/pages/{pageNumber}/slices/diag" && method == "GET" && h.slicerDiagnostics:
+		return h.handleSliceDiagnostics(ctx, pathParams["id"], pathParams["pageNumber"], event)
+	case path == "/uploads/{id}/pages/{pageNumber}/slices.zip" && method == "GET":
+		return h.handleSlicesZip(ctx, pathParams["id"], pathParams["pageNumber"])
+	case path == "/uploads/{id}/pages/{pageNumber}/extraction" && method == "GET":
+		return h.handlePageExtraction(ctx, pathParams["id"], pathParams["pageNumber"])
+	case path == "/uploads/{id}/candidates" && method == "POST":
+		return h.handleQueueCandidates(ctx, pathParams["id"], event)
+	case path == "/uploads/{id}/pages/{pageNumber}/extraction/candidates/{promptVersion}" && method == "GET":
+		return h.handleCandidateDiff(ctx, pathParams["id"], pathParams["pageNumber"], pathParams["promptVersion"], event)
+	case path == "/aircraft/{tailNumber}" && method == "DELETE":
+		return h.handleDeleteAircraft(ctx, pathParams["tailNumber"], event)
 	case path == "/aircraft/{tailNumber}/uploads" && method == "GET":
 		return h.handleListUploads(ctx, pathParams["tailNumber"])
 	case path == "/aircraft/{tailNumber}/summary" && method == "GET":
-		return h.handleSummary(ctx, pathParams["tailNumber"])
+		return h.handleSummary(ctx, pathParams["tailNumber"], event)
 	case path == "/aircraft/{tailNumber}/query" && method == "POST":
 		return h.handleQuery(ctx, pathParams["tailNumber"], event)
 	case path == "/aircraft/{tailNumber}/entries" && method == "GET":
 		return h.handleEntries(ctx, pathParams["tailNumber"], event)
+	case path == "/aircraft/{tailNumber}/entries/search" && method == "GET":
+		return h.handleSearchEntries(ctx, pathParams["tailNumber"], event)
 	case path == "/aircraft/{tailNumber}/entries/{entryId}" && method == "GET":
 		return h.handleEntryDetail(ctx, pathParams["tailNumber"], pathParams["entryId"])
 	case path == "/aircraft/{tailNumber}/entries/{entryId}" && method == "PATCH":
 		return h.handleUpdateEntry(ctx, pathParams["tailNumber"], pathParams["entryId"], event)
+	case path == "/aircraft/{tailNumber}/entries/{entryId}/history" && method == "GET":
+		return h.handleEntryHistory(ctx, pathParams["tailNumber"], pathParams["entryId"])
+	case path == "/aircraft/{tailNumber}/entries/{entryId}/similar" && method == "GET":
+		return h.handleSimilarEntries(ctx, pathParams["tailNumber"], pathParams["entryId"], event)
+	case path == "/aircraft/{tailNumber}/find-similar" && method == "POST":
+		return h.handleFindSimilar(ctx, pathParams["tailNumber"], event)
+	case path == "/aircraft/{tailNumber}/entries/{entryId}/recheck" && method == "POST":
+		return h.handleRecheckEntry(ctx, pathParams["tailNumber"], pathParams["entryId"])
 	case path == "/aircraft/{tailNumber}/inspections" && method == "GET":
 		return h.handleInspections(ctx, pathParams["tailNumber"], event)
 	case path == "/aircraft/{tailNumber}/ads" && method == "GET":
 		return h.handleAds(ctx, pathParams["tailNumber"], event)
+	case path == "/aircraft/{tailNumber}/ads/status" && method == "GET":
+		return h.handleAdStatus(ctx, pathParams["tailNumber"])
 	case path == "/aircraft/{tailNumber}/parts" && method == "GET":
 		return h.handleParts(ctx, pathParams["tailNumber"], event)
+	case path == "/aircraft/{tailNumber}/facets" && method == "GET":
+		return h.handleFacets(ctx, pathParams["tailNumber"])
+	case path == "/aircraft/{tailNumber}/weight-balance" && method == "GET":
+		return h.handleWeightBalance(ctx, pathParams["tailNumber"])
+	case path == "/aircraft/{tailNumber}/gaps" && method == "GET":
+		return h.handleGaps(ctx, pathParams["tailNumber"], event)
+	case path == "/aircraft/{tailNumber}/report.pdf" && method == "GET":
+		return h.handleReport(ctx, pathParams["tailNumber"])
+	case path == "/fleet/query" && method == "POST":
+		return h.handleFleetQuery(ctx, event)
 	default:
-		return errResponse(404, "Not found")
+		return errResponse(404, codeRouteNotFound, "Not found")
+	}
+}
+
+// withCORS replaces the response's CORS headers with those resolved for the
+// request origin against the configured allowlist.
+func withCORS(resp events.APIGatewayProxyResponse, origin string) events.APIGatewayProxyResponse {
+	if resp.Headers == nil {
+		resp.Headers = map[string]string{}
+	}
+	delete(resp.Headers, "Access-Control-Allow-Origin")
+	for k, v := range models.CORSHeaders(origin) {
+		resp.Headers[k] = v
+	}
+	return resp
+}
+
+// requestOrigin returns the Origin header.
+func requestOrigin(headers map[string]string) string {
+	return headerValue(headers, "Origin")
+}
+
+// headerValue returns the named header, matched case-insensitively since
+// API Gateway passes headers through as the client sent them.
+func headerValue(headers map[string]string, name string) string {
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
+
+// Error codes returned in the "code" field of error responses. They are part
+// of the API contract: clients branch on them, so never rename one.
+const (
+	codeValidation          = "VALIDATION_ERROR"
+	codeInvalidRequest      = "INVALID_REQUEST"
+	codeRouteNotFound       = "ROUTE_NOT_FOUND"
+	codeAircraftNotFound    = "AIRCRAFT_NOT_FOUND"
+	codeUploadNotFound      = "UPLOAD_NOT_FOUND"
+	codePageNotFound        = "PAGE_NOT_FOUND"
+	codePageNotExtracted    = "PAGE_NOT_EXTRACTED"
+	codeEntryNotFound       = "ENTRY_NOT_FOUND"
+	codeUploadExpired       = "UPLOAD_EXPIRED"
+	codeUploadNotAppendable = "UPLOAD_NOT_APPENDABLE"
+	codeNoSliceImage        = "NO_SLICE_IMAGE"
+	codeImageUndecodable    = "IMAGE_UNDECODABLE"
+	codeSearchUnavailable   = "SEARCH_UNAVAILABLE"
+	codeForbidden           = "FORBIDDEN"
+	codeCandidateNotFound   = "CANDIDATE_NOT_FOUND"
+	codeResponseTooLarge    = "RESPONSE_TOO_LARGE"
+	codeInternal            = "INTERNAL_ERROR"
+)
+
+// apiError is an error a client can act on: the HTTP status, a stable code
+// and a human-readable message. Handlers may return one as their error, and
+// Handle renders it like errResponse would.
+type apiError struct {
+	Status  int
+	Code    string
+	Message string
+	// Fields maps each offending request field to what is wrong with it.
+	Fields map[string]string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// response renders e as {"error": {"code", "message", "fields"}}.
+func (e *apiError) response() (events.APIGatewayProxyResponse, error) {
+	body := map[string]any{"code": e.Code, "message": e.Message}
+	if len(e.Fields) > 0 {
+		body["fields"] = e.Fields
+	}
+	return models.APIResponse(e.Status, map[string]any{"error": body})
+}
+
+func errResponse(status int, code, msg string) (events.APIGatewayProxyResponse, error) {
+	return (&apiError{Status: status, Code: code, Message: msg}).response()
+}
+
+// errorResponse renders an error returned by an endpoint handler: an
+// apiError as itself, anything else as an internal error.
+func errorResponse(err error) (events.APIGatewayProxyResponse, error) {
+	var ae *apiError
+	if errors.As(err, &ae) {
+		return ae.response()
+	}
+	return internalErrorResponse(err)
+}
+
+// internalErrorResponse logs err and answers with a generic 500, so SQL and
+// other internals never reach the client.
+func internalErrorResponse(err error) (events.APIGatewayProxyResponse, error) {
+	log.Printf("ERROR: %v", err)
+	return errResponse(500, codeInternal, "Internal server error")
+}
+
+// vectorSearchError is err from a vector search, as a 503 naming the fix
+// when the database lacks pgvector rather than a bare internal error.
+func vectorSearchError(err error) error {
+	if !db.IsVectorUnavailable(err) {
+		return err
+	}
+	log.Printf("ERROR: vector search: %v", err)
+	return &apiError{
+		Status:  503,
+		Code:    codeSearchUnavailable,
+		Message: "Semantic search is unavailable: the database is missing the pgvector extension. Install pgvector 0.7 or later, run CREATE EXTENSION vector and apply sql/schema.sql.",
 	}
 }
 
-func errResponse(status int, msg string) (events.APIGatewayProxyResponse, error) {
-	return models.APIResponse(status, map[string]string{"error": msg})
+type tenantKey struct{}
+
+// withTenant marks ctx with the tenant making the request. Aircraft lookups
+// are scoped to it: a caller only sees the aircraft its tenant owns.
+func withTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// tenantFrom returns the tenant ctx was marked with, or "" when there is
+// none. "" is scoped like any other tenant: requests without one share the
+// aircraft they create among themselves.
+func tenantFrom(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+// callerTenant identifies the caller's tenant: the tenantId an authorizer
+// put in the request context, or else the ID of the API key API Gateway
+// authenticated the request with.
+func callerTenant(event events.APIGatewayProxyRequest) string {
+	if tenant, ok := event.RequestContext.Authorizer["tenantId"].(string); ok && tenant != "" {
+		return tenant
+	}
+	return event.RequestContext.Identity.APIKeyID
+}
+
+// requireAdmin returns a 403 apiError unless the request was authenticated
+// with one of the admin API keys.
+func (h *Handler) requireAdmin(event events.APIGatewayProxyRequest) error {
+	if h.adminKeys[event.RequestContext.Identity.APIKeyID] {
+		return nil
+	}
+	return &apiError{Status: 403, Code: codeForbidden, Message: "Admin access required"}
 }
 
-// getAircraftID looks up the aircraft ID by registration, returning an error response if not found.
+// getAircraftID looks up the aircraft ID by registration among the calling
+// tenant's aircraft, returning an error response if not found. Another
+// tenant's aircraft is not found either, so its existence doesn't leak.
 func (h *Handler) getAircraftID(ctx context.Context, tailNumber string) (string, *events.APIGatewayProxyResponse, error) {
 	tail := strings.ToUpper(tailNumber)
-	rows, err := h.db.Query(ctx, "SELECT id FROM aircraft WHERE registration = $1", tail)
+	rows, err := h.db.Query(ctx, "SELECT id FROM aircraft WHERE registration = $1 AND tenant_id = $2", tail, tenantFrom(ctx))
 	if err != nil {
 		return "", nil, err
 	}
 	if len(rows) == 0 {
-		resp, _ := errResponse(404, fmt.Sprintf("Aircraft %s not found", tail))
+		resp, _ := errResponse(404, codeAircraftNotFound, fmt.Sprintf("Aircraft %s not found", tail))
 		return "", &resp, nil
 	}
 	return fmt.Sprintf("%v", rows[0]["id"]), nil, nil
 }
 
-func (h *Handler) enrichAircraftFromFAA(ctx context.Context, aircraftID, tailNumber string) {
-	defer func() {
-		if r := recover(); r != nil {
-			log.Printf("WARNING: FAA enrichment panic for %s: %v", tailNumber, r)
-		}
-	}()
-
-	apiKey, err := h.secrets.GetSecret(ctx, os.Getenv("FAA_REGISTRY_SECRET_ARN"))
+// getUploadBatch looks up an upload batch among the calling tenant's
+// aircraft, returning an error response if not found. Like getAircraftID,
+// another tenant's upload is simply not found. Every /uploads/{id} handler
+// goes through it before touching the batch or its pages.
+func (h *Handler) getUploadBatch(ctx context.Context, batchID string) (map[string]any, *events.APIGatewayProxyResponse, error) {
+	rows, err := h.db.Query(ctx,
+		`SELECT ub.id, ub.upload_type, ub.s3_key, ub.processing_status
+		 FROM upload_batches ub
+		 JOIN aircraft a ON a.id = ub.aircraft_id
+		 WHERE ub.id = $1 AND a.tenant_id = $2`, batchID, tenantFrom(ctx))
 	if err != nil {
-		log.Printf("WARNING: FAA enrichment failed for %s: %v", tailNumber, err)
+		return nil, nil, err
+	}
+	if len(rows) == 0 {
+		resp, _ := errResponse(404, codeUploadNotFound, "Upload not found")
+		return nil, &resp, nil
+	}
+	return rows[0], nil, nil
+}
+
+// enrichAircraft refreshes the aircraft's FAA registry data without making
+// the upload wait on the registry. With a queue configured the enrich worker
+// does the lookup; otherwise it runs in a goroutine with its own context.
+// Lambda freezes that goroutine once the response is sent, so it is
+// best-effort: it finishes on a later invocation of the same container or
+// times out and is retried on the next upload.
+func (h *Handler) enrichAircraft(ctx context.Context, aircraftID, tailNumber string) {
+	if h.faa == nil {
+		return
+	}
+	if h.enrichQueueURL != "" {
+		body, _ := json.Marshal(faa.Message{AircraftID: aircraftID, TailNumber: tailNumber})
+		if err := h.sqs.SendMessage(ctx, h.enrichQueueURL, string(body)); err != nil {
+			log.Printf("WARNING: queue FAA enrichment for %s: %v", tailNumber, err)
+		}
 		return
 	}
 
-	url := fmt.Sprintf("%s/registry/%s", os.Getenv("FAA_REGISTRY_URL"), tailNumber)
-	req, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
-	req.Header.Set("x-api-key", apiKey)
+	h.enrichWG.Add(1)
+	go func() {
+		defer h.enrichWG.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("WARNING: FAA enrichment panic for %s: %v", tailNumber, r)
+			}
+		}()
+		ctx, cancel := context.WithTimeout(context.Background(), faa.Timeout)
+		defer cancel()
+		if err := h.faa.Enrich(ctx, aircraftID, tailNumber); err != nil {
+			log.Printf("WARNING: FAA enrichment failed for %s: %v", tailNumber, err)
+		}
+	}()
+}
 
-	client := &http.Client{Timeout: 5 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Printf("WARNING: FAA enrichment failed for %s: %v", tailNumber, err)
-		return
+// ─── GET /health ────────────────────────────────────────────────────────────
+
+// healthCheckTimeout bounds each dependency probe so a hung database can't
+// hold the health check for the full Lambda timeout.
+const healthCheckTimeout = 5 * time.Second
+
+// healthProbeKey is HEAD-requested to check S3 reachability. It need not
+// exist; a missing object still proves the bucket answers.
+const healthProbeKey = "health/probe"
+
+// handleHealth reports database reachability, and S3 reachability when
+// called with ?s3=true. Any failed check makes the response a 503.
+func (h *Handler) handleHealth(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	checks := map[string]string{}
+	healthy := true
+	probe := func(name string, fn func(ctx context.Context) error) {
+		ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+		defer cancel()
+		if err := fn(ctx); err != nil {
+			log.Printf("WARNING: health check %s failed: %v", name, err)
+			checks[name] = "error"
+			healthy = false
+			return
+		}
+		checks[name] = "ok"
 	}
-	defer resp.Body.Close()
 
-	body, _ := io.ReadAll(resp.Body)
-	var data map[string]any
-	if err := json.Unmarshal(body, &data); err != nil {
-		log.Printf("WARNING: FAA enrichment parse failed for %s: %v", tailNumber, err)
-		return
+	probe("db", h.db.Ping)
+	if event.QueryStringParameters["s3"] == "true" {
+		probe("s3", func(ctx context.Context) error {
+			_, _, err := h.s3.HeadObject(ctx, h.bucket, healthProbeKey)
+			return err
+		})
 	}
 
-	_ = h.db.Exec(ctx,
-		"UPDATE aircraft SET make = $1, model = $2, serial_number = $3, updated_at = NOW() WHERE id = $4",
-		data["manufacturer"], data["model"], data["serialNumber"], aircraftID,
-	)
+	status, state := 200, "ok"
+	if !healthy {
+		status, state = 503, "unavailable"
+	}
+	return models.APIResponse(status, map[string]any{"status": state, "checks": checks})
 }
 
 // ─── POST /uploads ──────────────────────────────────────────────────────────
@@ -156,86 +613,334 @@ type uploadRequest struct {
 	TailNumber string       `json:"tailNumber"`
 	LogType    string       `json:"logType"`
 	Files      []uploadFile `json:"files"`
+	// SourceURL asks us to fetch the logbook ourselves instead of handing
+	// back presigned upload URLs.
+	SourceURL string `json:"sourceUrl"`
+	// IdempotencyKey is the body alternative to the Idempotency-Key header.
+	IdempotencyKey string `json:"idempotencyKey"`
+	// CallbackURL receives a signed POST when the batch finishes processing.
+	CallbackURL string `json:"callbackUrl"`
 }
 
 type uploadFile struct {
 	Filename string `json:"filename"`
 }
 
+// maxIdempotencyKeyLen matches the upload_batches.idempotency_key column.
+const maxIdempotencyKeyLen = 255
+
+// maxCallbackURLLen matches the upload_batches.callback_url column.
+const maxCallbackURLLen = 2048
+
+// checkCallbackURL validates a completion webhook URL. It must be HTTPS, and
+// literal internal addresses are refused up front. Hostnames are checked
+// again when the webhook is delivered, against the addresses they resolve to.
+func checkCallbackURL(raw string) error {
+	if len(raw) > maxCallbackURLLen {
+		return fmt.Errorf("callbackUrl must be at most %d characters", maxCallbackURLLen)
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || u.Hostname() == "" || u.User != nil {
+		return errors.New("callbackUrl must be an https URL")
+	}
+	host := u.Hostname()
+	if strings.EqualFold(host, "localhost") {
+		return errors.New("callbackUrl host is not allowed")
+	}
+	if addr, err := netip.ParseAddr(host); err == nil && webhook.BlockedAddr(addr) {
+		return errors.New("callbackUrl host is not allowed")
+	}
+	return nil
+}
+
 func (h *Handler) handleUpload(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	var req uploadRequest
 	if err := json.Unmarshal([]byte(event.Body), &req); err != nil {
-		return errResponse(400, "invalid request body")
+		return errResponse(400, codeInvalidRequest, "invalid request body")
 	}
 
 	tail := strings.ToUpper(strings.TrimSpace(req.TailNumber))
 	if tail == "" {
-		return errResponse(400, "tailNumber is required")
+		return errResponse(400, codeValidation, "tailNumber is required")
 	}
-	if len(req.Files) == 0 {
-		return errResponse(400, "files array is required")
+
+	idemKey := strings.TrimSpace(headerValue(event.Headers, "Idempotency-Key"))
+	if idemKey == "" {
+		idemKey = strings.TrimSpace(req.IdempotencyKey)
 	}
-	if len(req.Files) > 500 {
-		return errResponse(400, "Maximum 500 files per upload")
+	if len(idemKey) > maxIdempotencyKeyLen {
+		return errResponse(400, codeValidation, fmt.Sprintf("Idempotency-Key must be at most %d characters", maxIdempotencyKeyLen))
+	}
+
+	callbackURL := strings.TrimSpace(req.CallbackURL)
+	if callbackURL != "" {
+		if err := checkCallbackURL(callbackURL); err != nil {
+			return errResponse(400, codeValidation, err.Error())
+		}
 	}
 
-	// Classify files
+	var sourceURL *url.URL
 	var pdfFiles, imgFiles []uploadFile
-	for _, f := range req.Files {
-		ext := strings.ToLower(filepath.Ext(f.Filename))
-		if pdfExtensions[ext] {
-			pdfFiles = append(pdfFiles, f)
-		} else if imageExtensions[ext] {
-			imgFiles = append(imgFiles, f)
+	if req.SourceURL != "" {
+		if len(req.Files) > 0 {
+			return errResponse(400, codeValidation, "Provide either files or sourceUrl, not both")
+		}
+		u, errResp := h.checkSourceURL(req.SourceURL)
+		if errResp != nil {
+			return *errResp, nil
+		}
+		sourceURL = u
+	} else {
+		if len(req.Files) == 0 {
+			return errResponse(400, codeValidation, "files array is required")
+		}
+		if len(req.Files) > 500 {
+			return errResponse(400, codeValidation, "Maximum 500 files per upload")
+		}
+
+		// Classify files
+		for _, f := range req.Files {
+			ext := strings.ToLower(filepath.Ext(f.Filename))
+			if pdfExtensions[ext] {
+				pdfFiles = append(pdfFiles, f)
+			} else if imageExtensions[ext] {
+				imgFiles = append(imgFiles, f)
+			}
+		}
+
+		if len(pdfFiles) > 0 && len(imgFiles) > 0 {
+			return errResponse(400, codeValidation, "Cannot mix PDF and image files in one upload")
+		}
+		if len(pdfFiles) == 0 && len(imgFiles) == 0 {
+			return errResponse(400, codeValidation, "Files must be PDF (.pdf) or images (.jpg, .jpeg, .png, etc.)")
+		}
+		if len(pdfFiles) > 1 {
+			return errResponse(400, codeValidation, "Only one PDF per upload")
+		}
+	}
+
+	aircraftID, err := h.upsertAircraft(ctx, tail)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	// A repeated key returns the batch the first request created.
+	if idemKey != "" {
+		resp, ok, err := h.replayUpload(ctx, aircraftID, idemKey)
+		if err != nil || ok {
+			return resp, err
 		}
 	}
 
-	if len(pdfFiles) > 0 && len(imgFiles) > 0 {
-		return errResponse(400, "Cannot mix PDF and image files in one upload")
+	batchID := newUUIDv7()
+	upload := newBatch{id: batchID, aircraftID: aircraftID, logType: req.LogType, idempotencyKey: idemKey, callbackURL: callbackURL}
+
+	var resp events.APIGatewayProxyResponse
+	switch {
+	case sourceURL != nil:
+		resp, err = h.handleURLUpload(ctx, upload, sourceURL)
+	case len(pdfFiles) > 0:
+		resp, err = h.handlePDFUpload(ctx, upload, pdfFiles[0])
+	default:
+		resp, err = h.handleMultiImageUpload(ctx, upload, imgFiles)
 	}
-	if len(pdfFiles) == 0 && len(imgFiles) == 0 {
-		return errResponse(400, "Files must be PDF (.pdf) or images (.jpg, .jpeg, .png, etc.)")
+	if err != nil && idemKey != "" {
+		// A concurrent request with the same key may have won the unique
+		// constraint; answer with its batch instead of failing.
+		if replay, ok, rerr := h.replayUpload(ctx, aircraftID, idemKey); rerr == nil && ok {
+			return replay, nil
+		}
+	}
+	return resp, err
+}
+
+// newBatch carries the fields every upload_batches insert shares.
+type newBatch struct {
+	id             string
+	aircraftID     string
+	logType        string
+	idempotencyKey string // empty when the client sent none
+	callbackURL    string // empty when the client sent none
+}
+
+// idempotencyKeyArg returns the key as a query argument, NULL when unset so
+// the per-aircraft unique index ignores it.
+func (b newBatch) idempotencyKeyArg() any {
+	if b.idempotencyKey == "" {
+		return nil
 	}
-	if len(pdfFiles) > 1 {
-		return errResponse(400, "Only one PDF per upload")
+	return b.idempotencyKey
+}
+
+// callbackURLArg returns the callback URL as a query argument, NULL when
+// unset.
+func (b newBatch) callbackURLArg() any {
+	if b.callbackURL == "" {
+		return nil
 	}
+	return b.callbackURL
+}
 
-	// Upsert aircraft
+// upsertAircraft returns the ID of the calling tenant's aircraft registered
+// as tail, creating it and enriching it from the FAA registry as needed.
+// Tenants each have their own aircraft for a tail number.
+func (h *Handler) upsertAircraft(ctx context.Context, tail string) (string, error) {
 	aircraftID, err := h.db.Insert(ctx,
-		`INSERT INTO aircraft (registration) VALUES ($1)
-		 ON CONFLICT (registration) DO UPDATE SET updated_at = NOW()
-		 RETURNING id`, tail)
+		`INSERT INTO aircraft (registration, tenant_id) VALUES ($1, $2)
+		 ON CONFLICT (tenant_id, registration) DO UPDATE SET updated_at = NOW()
+		 RETURNING id`, tail, tenantFrom(ctx))
+	if err != nil {
+		return "", fmt.Errorf("upsert aircraft: %w", err)
+	}
+
+	h.enrichAircraft(ctx, aircraftID, tail)
+	return aircraftID, nil
+}
+
+// replayUpload rebuilds the response for the batch an earlier request with
+// the same idempotency key created for this aircraft. Presigned URLs are
+// issued afresh since the original ones may have expired. ok is false when
+// no batch has the key.
+func (h *Handler) replayUpload(ctx context.Context, aircraftID, key string) (events.APIGatewayProxyResponse, bool, error) {
+	// The batch may have been committed moments ago by a concurrent request.
+	ctx = db.WithPrimary(ctx)
+	rows, err := h.db.Query(ctx,
+		`SELECT id, upload_type, source_filename, s3_key, source_url
+		 FROM upload_batches WHERE aircraft_id = $1 AND idempotency_key = $2`,
+		aircraftID, key)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, false, fmt.Errorf("lookup idempotency key: %w", err)
+	}
+	if len(rows) == 0 {
+		return events.APIGatewayProxyResponse{}, false, nil
+	}
+
+	b := rows[0]
+	batchID := fmt.Sprintf("%v", b["id"])
+	log.Printf("Replaying upload %s for idempotency key %q", batchID, key)
+
+	var resp events.APIGatewayProxyResponse
+	switch {
+	case b["source_url"] != nil:
+		resp, err = urlUploadResponse(batchID, fmt.Sprintf("%v", b["upload_type"]), fmt.Sprintf("%v", b["source_url"]), fmt.Sprintf("%v", b["s3_key"]))
+	case b["upload_type"] == "multi_image":
+		resp, err = h.replayMultiImageUpload(ctx, batchID)
+	default:
+		resp, err = h.pdfUploadResponse(ctx, batchID, fmt.Sprintf("%v", b["source_filename"]), fmt.Sprintf("%v", b["s3_key"]))
+	}
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, false, err
+	}
+	if resp.Headers == nil {
+		resp.Headers = map[string]string{}
+	}
+	resp.Headers["Idempotent-Replayed"] = "true"
+	return resp, true, nil
+}
+
+func (h *Handler) replayMultiImageUpload(ctx context.Context, batchID string) (events.APIGatewayProxyResponse, error) {
+	pages, err := h.db.Query(ctx,
+		`SELECT id, page_number, image_path FROM upload_pages
+		 WHERE document_id = $1 ORDER BY page_number`, batchID)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, fmt.Errorf("query pages: %w", err)
+	}
+
+	var resultFiles []map[string]any
+	for _, p := range pages {
+		pageNum, _ := toInt(p["page_number"])
+		pageKey := fmt.Sprintf("%v", p["image_path"])
+		f, err := h.presignPage(ctx, fmt.Sprintf("%v", p["id"]), pageNum, filepath.Base(pageKey), pageKey)
+		if err != nil {
+			return events.APIGatewayProxyResponse{}, err
+		}
+		resultFiles = append(resultFiles, f)
+	}
+	return multiImageUploadResponse(batchID, resultFiles)
+}
+
+// checkSourceURL validates a sourceUrl against the allowlist and the
+// supported file types, returning an error response when it is rejected.
+func (h *Handler) checkSourceURL(raw string) (*url.URL, *events.APIGatewayProxyResponse) {
+	reject := func(msg string) (*url.URL, *events.APIGatewayProxyResponse) {
+		resp, _ := errResponse(400, codeValidation, msg)
+		return nil, &resp
+	}
+	if len(h.sourceHosts) == 0 || h.fetchQueueURL == "" {
+		return reject("sourceUrl uploads are not enabled")
+	}
+	u, err := h.sourceHosts.Validate(raw)
 	if err != nil {
-		return events.APIGatewayProxyResponse{}, fmt.Errorf("upsert aircraft: %w", err)
+		return reject(err.Error())
 	}
+	ext := strings.ToLower(filepath.Ext(sourceurl.Filename(u)))
+	if !pdfExtensions[ext] && !imageExtensions[ext] {
+		return reject("sourceUrl must point to a PDF (.pdf) or image (.jpg, .jpeg, .png, etc.)")
+	}
+	return u, nil
+}
 
-	// Enrich with FAA data (non-blocking)
-	h.enrichAircraftFromFAA(ctx, aircraftID, tail)
+// handleURLUpload creates a batch for a logbook hosted elsewhere and queues
+// a server-side download into uploads/, where the normal pipeline takes over.
+func (h *Handler) handleURLUpload(ctx context.Context, batch newBatch, u *url.URL) (events.APIGatewayProxyResponse, error) {
+	filename := sourceurl.Filename(u)
+	s3Key := fmt.Sprintf("uploads/%s/%s", batch.id, filename)
+	// checkSourceURL only lets PDFs and images through; an image is one
+	// file under uploads/ like a PDF, which split turns into a single page.
+	uploadType := "image"
+	if pdfExtensions[strings.ToLower(filepath.Ext(filename))] {
+		uploadType = "pdf"
+	}
 
-	batchID := newUUID()
+	_, err := h.db.Insert(ctx,
+		`INSERT INTO upload_batches (id, aircraft_id, logbook_type, upload_type, source_filename, s3_key, source_url, callback_url, idempotency_key, processing_status)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, 'pending') RETURNING id`,
+		batch.id, batch.aircraftID, batch.logType, uploadType, filename, s3Key, u.String(), batch.callbackURLArg(), batch.idempotencyKeyArg())
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, fmt.Errorf("insert batch: %w", err)
+	}
 
-	if len(pdfFiles) > 0 {
-		return h.handlePDFUpload(ctx, batchID, aircraftID, req.LogType, pdfFiles[0])
+	msg, _ := json.Marshal(map[string]any{
+		"uploadId":  batch.id,
+		"sourceUrl": u.String(),
+		"s3Key":     s3Key,
+	})
+	if err := h.sqs.SendMessage(ctx, h.fetchQueueURL, string(msg)); err != nil {
+		return events.APIGatewayProxyResponse{}, fmt.Errorf("queue fetch: %w", err)
 	}
-	return h.handleMultiImageUpload(ctx, batchID, aircraftID, req.LogType, imgFiles)
+
+	return urlUploadResponse(batch.id, uploadType, u.String(), s3Key)
+}
+
+func urlUploadResponse(batchID, uploadType, sourceURL, s3Key string) (events.APIGatewayProxyResponse, error) {
+	return models.APIResponse(202, map[string]any{
+		"uploadId":   batchID,
+		"uploadType": uploadType,
+		"sourceUrl":  sourceURL,
+		"s3Key":      s3Key,
+	})
 }
 
-func (h *Handler) handlePDFUpload(ctx context.Context, batchID, aircraftID, logType string, file uploadFile) (events.APIGatewayProxyResponse, error) {
+func (h *Handler) handlePDFUpload(ctx context.Context, batch newBatch, file uploadFile) (events.APIGatewayProxyResponse, error) {
 	filename := file.Filename
 	if filename == "" {
 		filename = "logbook.pdf"
 	}
-	s3Key := fmt.Sprintf("uploads/%s/%s", batchID, filename)
+	s3Key := fmt.Sprintf("uploads/%s/%s", batch.id, filename)
 
 	_, err := h.db.Insert(ctx,
-		`INSERT INTO upload_batches (id, aircraft_id, logbook_type, upload_type, source_filename, s3_key, processing_status)
-		 VALUES ($1, $2, $3, 'pdf', $4, $5, 'pending') RETURNING id`,
-		batchID, aircraftID, logType, filename, s3Key)
+		`INSERT INTO upload_batches (id, aircraft_id, logbook_type, upload_type, source_filename, s3_key, callback_url, idempotency_key, processing_status)
+		 VALUES ($1, $2, $3, 'pdf', $4, $5, $6, $7, 'pending') RETURNING id`,
+		batch.id, batch.aircraftID, batch.logType, filename, s3Key, batch.callbackURLArg(), batch.idempotencyKeyArg())
 	if err != nil {
 		return events.APIGatewayProxyResponse{}, fmt.Errorf("insert batch: %w", err)
 	}
 
-	uploadURL, err := h.s3.PresignPutObject(ctx, h.bucket, s3Key, "application/pdf", time.Hour)
+	return h.pdfUploadResponse(ctx, batch.id, filename, s3Key)
+}
+
+func (h *Handler) pdfUploadResponse(ctx context.Context, batchID, filename, s3Key string) (events.APIGatewayProxyResponse, error) {
+	uploadURL, err := h.s3.PresignPutObject(ctx, h.bucket, s3Key, "application/pdf", presignTTL(h.presignPutTTL))
 	if err != nil {
 		return events.APIGatewayProxyResponse{}, fmt.Errorf("presign: %w", err)
 	}
@@ -249,7 +954,7 @@ func (h *Handler) handlePDFUpload(ctx context.Context, batchID, aircraftID, logT
 	})
 }
 
-func (h *Handler) handleMultiImageUpload(ctx context.Context, batchID, aircraftID, logType string, files []uploadFile) (events.APIGatewayProxyResponse, error) {
+func (h *Handler) handleMultiImageUpload(ctx context.Context, batch newBatch, files []uploadFile) (events.APIGatewayProxyResponse, error) {
 	pageCount := len(files)
 	sourceName := files[0].Filename
 	if pageCount > 1 {
@@ -257,9 +962,9 @@ func (h *Handler) handleMultiImageUpload(ctx context.Context, batchID, aircraftI
 	}
 
 	_, err := h.db.Insert(ctx,
-		`INSERT INTO upload_batches (id, aircraft_id, logbook_type, upload_type, source_filename, page_count, processing_status)
-		 VALUES ($1, $2, $3, 'multi_image', $4, $5, 'pending') RETURNING id`,
-		batchID, aircraftID, logType, sourceName, pageCount)
+		`INSERT INTO upload_batches (id, aircraft_id, logbook_type, upload_type, source_filename, page_count, callback_url, idempotency_key, processing_status)
+		 VALUES ($1, $2, $3, 'multi_image', $4, $5, $6, $7, 'pending') RETURNING id`,
+		batch.id, batch.aircraftID, batch.logType, sourceName, pageCount, batch.callbackURLArg(), batch.idempotencyKeyArg())
 	if err != nil {
 		return events.APIGatewayProxyResponse{}, fmt.Errorf("insert batch: %w", err)
 	}
@@ -272,222 +977,2298 @@ func (h *Handler) handleMultiImageUpload(ctx context.Context, batchID, aircraftI
 			filename = fmt.Sprintf("page_%04d.jpg", pageNum)
 		}
 		ext := strings.ToLower(filepath.Ext(filename))
-		ct := contentTypeMap[ext]
-		if ct == "" {
-			ct = "image/jpeg"
-		}
-		pageKey := fmt.Sprintf("pages/%s/page_%04d%s", batchID, pageNum, ext)
+		pageKey := fmt.Sprintf("pages/%s/page_%04d%s", batch.id, pageNum, ext)
 
-		_, err := h.db.Insert(ctx,
+		pageID, err := h.db.Insert(ctx,
 			`INSERT INTO upload_pages (document_id, page_number, image_path, extraction_status)
 			 VALUES ($1, $2, $3, 'pending') RETURNING id`,
-			batchID, pageNum, pageKey)
+			batch.id, pageNum, pageKey)
 		if err != nil {
 			return events.APIGatewayProxyResponse{}, fmt.Errorf("insert page: %w", err)
 		}
 
-		url, err := h.s3.PresignPutObject(ctx, h.bucket, pageKey, ct, time.Hour)
+		file, err := h.presignPage(ctx, pageID, pageNum, filename, pageKey)
 		if err != nil {
-			return events.APIGatewayProxyResponse{}, fmt.Errorf("presign: %w", err)
+			return events.APIGatewayProxyResponse{}, err
 		}
+		resultFiles = append(resultFiles, file)
+	}
 
-		resultFiles = append(resultFiles, map[string]any{
-			"filename":   filename,
-			"pageNumber": pageNum,
-			"uploadUrl":  url,
-			"s3Key":      pageKey,
-		})
+	return multiImageUploadResponse(batch.id, resultFiles)
+}
+
+// presignPage issues the upload URL for one page of a multi-image batch.
+func (h *Handler) presignPage(ctx context.Context, pageID string, pageNum int, filename, pageKey string) (map[string]any, error) {
+	ct := contentTypeMap[strings.ToLower(filepath.Ext(pageKey))]
+	if ct == "" {
+		ct = "image/jpeg"
+	}
+	uploadURL, err := h.s3.PresignPutObject(ctx, h.bucket, pageKey, ct, presignTTL(h.presignPutTTL))
+	if err != nil {
+		return nil, fmt.Errorf("presign: %w", err)
 	}
+	return map[string]any{
+		"filename":   filename,
+		"pageId":     pageID,
+		"pageNumber": pageNum,
+		"uploadUrl":  uploadURL,
+		"s3Key":      pageKey,
+	}, nil
+}
 
+func multiImageUploadResponse(batchID string, files []map[string]any) (events.APIGatewayProxyResponse, error) {
 	return models.APIResponse(200, map[string]any{
 		"uploadId":   batchID,
 		"uploadType": "multi_image",
-		"pageCount":  pageCount,
-		"files":      resultFiles,
+		"pageCount":  len(files),
+		"files":      files,
 	})
 }
 
-// ─── GET /uploads/{id}/status ───────────────────────────────────────────────
+// ─── POST /uploads/{id}/pages ───────────────────────────────────────────────
 
-func (h *Handler) handleStatus(ctx context.Context, batchID string) (events.APIGatewayProxyResponse, error) {
-	rows, err := h.db.Query(ctx,
-		`SELECT ub.id, ub.processing_status, ub.page_count, ub.source_filename,
-		        ub.logbook_type, ub.upload_type, ub.created_at,
-		        COUNT(up.id) FILTER (WHERE up.extraction_status = 'completed') AS completed_pages,
-		        COUNT(up.id) FILTER (WHERE up.extraction_status = 'failed') AS failed_pages,
-		        COUNT(up.id) FILTER (WHERE up.needs_review = TRUE) AS needs_review_pages,
-		        COUNT(up.id) AS total_pages
-		 FROM upload_batches ub
-		 LEFT JOIN upload_pages up ON up.document_id = ub.id
-		 WHERE ub.id = $1
-		 GROUP BY ub.id`, batchID)
+// appendPagesRequest is the body of POST /uploads/{id}/pages.
+type appendPagesRequest struct {
+	Files []uploadFile `json:"files"`
+}
+
+// reopenableStatuses are the finished states an append moves back to
+// processing, so the batch completes again once the new pages are analyzed.
+var reopenableStatuses = []string{"completed", "completed_with_errors", "failed"}
+
+// handleAppendPages adds pages to the end of a multi-image batch and returns
+// upload URLs for them. Page numbers are reserved by bumping page_count in a
+// single UPDATE, so concurrent appends never hand out the same number.
+func (h *Handler) handleAppendPages(ctx context.Context, batchID string, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var req appendPagesRequest
+	if err := json.Unmarshal([]byte(event.Body), &req); err != nil {
+		return errResponse(400, codeInvalidRequest, "invalid request body")
+	}
+	if len(req.Files) == 0 {
+		return errResponse(400, codeValidation, "files array is required")
+	}
+	if len(req.Files) > 500 {
+		return errResponse(400, codeValidation, "Maximum 500 files per upload")
+	}
+	for _, f := range req.Files {
+		if !imageExtensions[strings.ToLower(filepath.Ext(f.Filename))] {
+			return errResponse(400, codeValidation, "Appended files must be images (.jpg, .jpeg, .png, etc.)")
+		}
+	}
+
+	batch, notFound, err := h.getUploadBatch(ctx, batchID)
 	if err != nil {
 		return events.APIGatewayProxyResponse{}, err
 	}
-	if len(rows) == 0 {
-		return errResponse(404, "Upload not found")
+	if notFound != nil {
+		return *notFound, nil
+	}
+	if batch["processing_status"] == "expired" {
+		return errResponse(409, codeUploadExpired, "Upload has expired")
+	}
+	if batch["upload_type"] != "multi_image" {
+		return errResponse(409, codeUploadNotAppendable, "Pages can only be appended to multi-image uploads")
 	}
 
-	row := rows[0]
-	pageCount := row["page_count"]
-	if pageCount == nil || pageCount == int64(0) {
-		pageCount = row["total_pages"]
+	// The WHERE clause repeats the checks above so a batch that expired in
+	// between is not reopened.
+	updated, err := h.db.Query(db.WithPrimary(ctx),
+		`UPDATE upload_batches
+		 SET page_count = COALESCE(page_count, 0) + $2,
+		     processing_status = CASE WHEN processing_status = ANY($3) THEN 'processing' ELSE processing_status END,
+		     error_message = CASE WHEN processing_status = ANY($3) THEN NULL ELSE error_message END,
+		     updated_at = NOW()
+		 WHERE id = $1 AND upload_type = 'multi_image' AND processing_status <> 'expired'
+		 RETURNING page_count`,
+		batchID, len(req.Files), reopenableStatuses)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
 	}
+	if len(updated) == 0 {
+		return errResponse(409, codeUploadExpired, "Upload has expired")
+	}
+	pageCount, _ := toInt(updated[0]["page_count"])
+	first := pageCount - len(req.Files) + 1
 
-	result := map[string]any{
-		"uploadId":         fmt.Sprintf("%v", row["id"]),
-		"status":           row["processing_status"],
+	var resultFiles []map[string]any
+	for i, f := range req.Files {
+		pageNum := first + i
+		ext := strings.ToLower(filepath.Ext(f.Filename))
+		pageKey := fmt.Sprintf("pages/%s/page_%04d%s", batchID, pageNum, ext)
+
+		pageID, err := h.db.Insert(ctx,
+			`INSERT INTO upload_pages (document_id, page_number, image_path, extraction_status)
+			 VALUES ($1, $2, $3, 'pending') RETURNING id`,
+			batchID, pageNum, pageKey)
+		if err != nil {
+			return events.APIGatewayProxyResponse{}, fmt.Errorf("insert page: %w", err)
+		}
+
+		file, err := h.presignPage(ctx, pageID, pageNum, f.Filename, pageKey)
+		if err != nil {
+			return events.APIGatewayProxyResponse{}, err
+		}
+		resultFiles = append(resultFiles, file)
+	}
+
+	return models.APIResponse(200, map[string]any{
+		"uploadId":   batchID,
+		"uploadType": "multi_image",
+		"pageCount":  pageCount,
+		"files":      resultFiles,
+	})
+}
+
+// ─── PATCH /uploads/{id}/pages/order ────────────────────────────────────────
+
+// reorderPagesRequest is the body of PATCH /uploads/{id}/pages/order: the new
+// page number for every page of the upload, keyed by page id.
+type reorderPagesRequest struct {
+	Order map[string]int `json:"order"`
+}
+
+// handleReorderPages renumbers an upload's pages, for images uploaded out of
+// their physical order. The mapping must be a permutation of the existing
+// page numbers. It only renumbers: extracted entries keep their own dates.
+func (h *Handler) handleReorderPages(ctx context.Context, batchID string, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var req reorderPagesRequest
+	if err := json.Unmarshal([]byte(event.Body), &req); err != nil {
+		return errResponse(400, codeInvalidRequest, "invalid request body")
+	}
+	if len(req.Order) == 0 {
+		return errResponse(400, codeValidation, "order is required")
+	}
+
+	batch, notFound, err := h.getUploadBatch(ctx, batchID)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	if notFound != nil {
+		return *notFound, nil
+	}
+	if batch["processing_status"] == "expired" {
+		return errResponse(409, codeUploadExpired, "Upload has expired")
+	}
+
+	pages, err := h.db.Query(ctx,
+		`SELECT id, page_number FROM upload_pages WHERE document_id = $1 ORDER BY page_number`,
+		batchID)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	order := make(map[string]int, len(req.Order))
+	for id, n := range req.Order {
+		order[strings.ToLower(id)] = n
+	}
+	current := make(map[string]int, len(pages))
+	unused := make(map[int]bool, len(pages))
+	for _, p := range pages {
+		n, _ := toInt(p["page_number"])
+		current[fmt.Sprintf("%v", p["id"])] = n
+		unused[n] = true
+	}
+	if len(order) != len(current) {
+		return errResponse(400, codeValidation, fmt.Sprintf("order must list all %d pages of the upload", len(current)))
+	}
+	for id, n := range order {
+		if _, ok := current[id]; !ok {
+			return errResponse(400, codeValidation, fmt.Sprintf("page %s is not part of this upload", id))
+		}
+		if !unused[n] {
+			return errResponse(400, codeValidation, "new page numbers must be a permutation of the existing page numbers")
+		}
+		delete(unused, n)
+	}
+
+	// One statement is its own transaction, and the deferrable unique
+	// constraint lets it swap numbers between pages.
+	var ids []string
+	var numbers []int64
+	for id, n := range order {
+		if current[id] != n {
+			ids = append(ids, id)
+			numbers = append(numbers, int64(n))
+		}
+	}
+	if len(ids) > 0 {
+		if err := h.db.Exec(ctx,
+			`UPDATE upload_pages p SET page_number = o.page_number
+			 FROM unnest($2::uuid[], $3::int8[]) AS o(id, page_number)
+			 WHERE p.id = o.id AND p.document_id = $1`,
+			batchID, ids, numbers); err != nil {
+			return events.APIGatewayProxyResponse{}, err
+		}
+	}
+
+	result := make([]map[string]any, 0, len(order))
+	for id, n := range order {
+		result = append(result, map[string]any{"pageId": id, "pageNumber": n})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i]["pageNumber"].(int) < result[j]["pageNumber"].(int)
+	})
+
+	return models.APIResponse(200, map[string]any{
+		"uploadId": batchID,
+		"pages":    result,
+	})
+}
+
+// ─── POST /uploads/{id}/finalize ────────────────────────────────────────────
+
+// handleFinalizeUpload is called by the client once it has PUT every file.
+// It checks each expected object actually landed in S3, flags the pages whose
+// file is missing, and moves a pending batch to processing only when nothing
+// is missing.
+func (h *Handler) handleFinalizeUpload(ctx context.Context, batchID string) (events.APIGatewayProxyResponse, error) {
+	batch, notFound, err := h.getUploadBatch(ctx, batchID)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	if notFound != nil {
+		return *notFound, nil
+	}
+	status := fmt.Sprintf("%v", batch["processing_status"])
+	if status == "expired" {
+		return errResponse(409, codeUploadExpired, "Upload has expired")
+	}
+
+	type expectedFile struct {
+		pageNumber any
+		s3Key      string
+	}
+	var expected []expectedFile
+	if batch["upload_type"] == "multi_image" {
+		pages, err := h.db.Query(ctx,
+			`SELECT page_number, image_path FROM upload_pages
+			 WHERE document_id = $1 ORDER BY page_number`, batchID)
+		if err != nil {
+			return events.APIGatewayProxyResponse{}, err
+		}
+		for _, p := range pages {
+			expected = append(expected, expectedFile{p["page_number"], fmt.Sprintf("%v", p["image_path"])})
+		}
+	} else if batch["s3_key"] != nil {
+		expected = append(expected, expectedFile{nil, fmt.Sprintf("%v", batch["s3_key"])})
+	}
+
+	missing := []map[string]any{}
+	missingPages := []int64{} // non-nil so ANY($2) never sees NULL
+	for _, f := range expected {
+		ok, _, err := h.s3.HeadObject(ctx, h.bucket, f.s3Key)
+		if err != nil {
+			return events.APIGatewayProxyResponse{}, err
+		}
+		if ok {
+			continue
+		}
+		m := map[string]any{"s3Key": f.s3Key}
+		if f.pageNumber != nil {
+			m["pageNumber"] = f.pageNumber
+			if n, ok := toInt64(f.pageNumber); ok {
+				missingPages = append(missingPages, n)
+			}
+		}
+		missing = append(missing, m)
+	}
+
+	if batch["upload_type"] == "multi_image" {
+		if err := h.db.Exec(ctx,
+			`UPDATE upload_pages SET file_missing = (page_number = ANY($2)) WHERE document_id = $1`,
+			batchID, missingPages); err != nil {
+			return events.APIGatewayProxyResponse{}, err
+		}
+	}
+
+	complete := len(expected) > 0 && len(missing) == 0
+	if complete && status == "pending" {
+		if err := h.db.Exec(ctx,
+			"UPDATE upload_batches SET processing_status = 'processing', updated_at = NOW() WHERE id = $1 AND processing_status = 'pending'",
+			batchID); err != nil {
+			return events.APIGatewayProxyResponse{}, err
+		}
+		status = "processing"
+	}
+
+	return models.APIResponse(200, map[string]any{
+		"uploadId":      batchID,
+		"status":        status,
+		"complete":      complete,
+		"expectedFiles": len(expected),
+		"missingFiles":  missing,
+	})
+}
+
+// ─── GET /uploads/{id}/status ───────────────────────────────────────────────
+
+// uploadStatusQuery aggregates each batch's page counts; %s is the WHERE
+// condition on ub.id.
+const uploadStatusQuery = `SELECT ub.id, ub.processing_status, ub.page_count, ub.source_filename,
+		        ub.logbook_type, ub.upload_type, ub.error_message, ub.created_at,
+		        COUNT(up.id) FILTER (WHERE up.extraction_status = 'completed') AS completed_pages,
+		        COUNT(up.id) FILTER (WHERE up.extraction_status = 'failed') AS failed_pages,
+		        COUNT(up.id) FILTER (WHERE up.extraction_status = 'skipped') AS skipped_pages,
+		        COUNT(up.id) FILTER (WHERE up.needs_review = TRUE) AS needs_review_pages,
+		        MIN(up.min_confidence) AS min_confidence,
+		        COUNT(up.id) AS total_pages
+		 FROM upload_batches ub
+		 JOIN aircraft a ON a.id = ub.aircraft_id
+		 LEFT JOIN upload_pages up ON up.document_id = ub.id
+		 WHERE a.tenant_id = $1 AND %s
+		 GROUP BY ub.id`
+
+func (h *Handler) handleStatus(ctx context.Context, batchID string) (events.APIGatewayProxyResponse, error) {
+	rows, err := h.db.Query(ctx, fmt.Sprintf(uploadStatusQuery, "ub.id = $2"), tenantFrom(ctx), batchID)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	if len(rows) == 0 {
+		return errResponse(404, codeUploadNotFound, "Upload not found")
+	}
+
+	row := rows[0]
+	result := uploadStatus(row)
+
+	failedPages, _ := toInt64(row["failed_pages"])
+	if failedPages > 0 {
+		failedRows, err := h.db.Query(ctx,
+			`SELECT page_number FROM upload_pages
+			 WHERE document_id = $1 AND extraction_status = 'failed'
+			 ORDER BY page_number`, batchID)
+		if err == nil {
+			var nums []any
+			for _, r := range failedRows {
+				nums = append(nums, r["page_number"])
+			}
+			result["failedPageNumbers"] = nums
+		}
+	}
+
+	// Pages needing review, least confident first, so a reviewer knows where
+	// to start.
+	reviewPages, _ := toInt64(row["needs_review_pages"])
+	if reviewPages > 0 {
+		reviewRows, err := h.db.Query(ctx,
+			`SELECT page_number, min_confidence, review_reason_summary FROM upload_pages
+			 WHERE document_id = $1 AND needs_review = TRUE
+			 ORDER BY min_confidence ASC NULLS LAST, page_number`, batchID)
+		if err == nil {
+			pages := make([]map[string]any, 0, len(reviewRows))
+			for _, r := range reviewRows {
+				pages = append(pages, reviewPage(r))
+			}
+			result["reviewPages"] = pages
+		}
+	}
+
+	return models.APIResponse(200, result)
+}
+
+// uploadStatus builds the status payload from an uploadStatusQuery row.
+func uploadStatus(row map[string]any) map[string]any {
+	pageCount := row["page_count"]
+	if pageCount == nil || pageCount == int64(0) {
+		pageCount = row["total_pages"]
+	}
+
+	return map[string]any{
+		"uploadId":         fmt.Sprintf("%v", row["id"]),
+		"status":           row["processing_status"],
 		"filename":         row["source_filename"],
 		"logType":          row["logbook_type"],
 		"uploadType":       row["upload_type"],
 		"pageCount":        pageCount,
 		"completedPages":   row["completed_pages"],
 		"failedPages":      row["failed_pages"],
+		"skippedPages":     row["skipped_pages"],
 		"needsReviewPages": row["needs_review_pages"],
+		"minConfidence":    row["min_confidence"],
+		"errorMessage":     row["error_message"],
 		"createdAt":        row["created_at"],
 	}
+}
+
+func reviewPage(r map[string]any) map[string]any {
+	return map[string]any{
+		"pageNumber":          r["page_number"],
+		"minConfidence":       r["min_confidence"],
+		"reviewReasonSummary": r["review_reason_summary"],
+	}
+}
+
+// ─── POST /uploads/status ───────────────────────────────────────────────────
+
+// maxBulkStatusIDs caps the uploads one bulk status request may ask about.
+const maxBulkStatusIDs = 100
+
+// handleBulkStatus returns the status payload of GET /uploads/{id}/status for
+// each requested upload, in request order, with three queries however many
+// are asked for. Ids that don't name an upload are listed under notFound
+// rather than failing the request.
+func (h *Handler) handleBulkStatus(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var req struct {
+		UploadIDs []string `json:"uploadIds"`
+	}
+	if err := json.Unmarshal([]byte(event.Body), &req); err != nil {
+		return errResponse(400, codeInvalidRequest, "invalid request body")
+	}
+	if len(req.UploadIDs) == 0 {
+		return errResponse(400, codeValidation, "uploadIds is required")
+	}
+	if len(req.UploadIDs) > maxBulkStatusIDs {
+		return errResponse(400, codeValidation, fmt.Sprintf("uploadIds may list at most %d uploads", maxBulkStatusIDs))
+	}
+
+	// Malformed ids can't name an upload, and would fail the uuid[] cast.
+	// Ids are compared lowercased throughout, so one upload listed in two
+	// cases is reported once.
+	var ids []string
+	seen := map[string]bool{}
+	for i, id := range req.UploadIDs {
+		id = strings.ToLower(id)
+		req.UploadIDs[i] = id
+		if !seen[id] && isUUID(id) {
+			ids = append(ids, id)
+		}
+		seen[id] = true
+	}
+
+	statuses := map[string]map[string]any{}
+	if len(ids) > 0 {
+		rows, err := h.db.Query(ctx, fmt.Sprintf(uploadStatusQuery, "ub.id = ANY($2::uuid[])"), tenantFrom(ctx), ids)
+		if err != nil {
+			return events.APIGatewayProxyResponse{}, err
+		}
+		for _, row := range rows {
+			result := uploadStatus(row)
+			statuses[result["uploadId"].(string)] = result
+		}
+	}
+
+	var failedIDs, reviewIDs []string
+	for id, result := range statuses {
+		if n, _ := toInt64(result["failedPages"]); n > 0 {
+			failedIDs = append(failedIDs, id)
+		}
+		if n, _ := toInt64(result["needsReviewPages"]); n > 0 {
+			reviewIDs = append(reviewIDs, id)
+		}
+	}
+	if len(failedIDs) > 0 {
+		failedRows, err := h.db.Query(ctx,
+			`SELECT document_id, page_number FROM upload_pages
+			 WHERE document_id = ANY($1::uuid[]) AND extraction_status = 'failed'
+			 ORDER BY document_id, page_number`, failedIDs)
+		if err == nil {
+			for _, r := range failedRows {
+				if result := statuses[fmt.Sprintf("%v", r["document_id"])]; result != nil {
+					nums, _ := result["failedPageNumbers"].([]any)
+					result["failedPageNumbers"] = append(nums, r["page_number"])
+				}
+			}
+		}
+	}
+	if len(reviewIDs) > 0 {
+		reviewRows, err := h.db.Query(ctx,
+			`SELECT document_id, page_number, min_confidence, review_reason_summary FROM upload_pages
+			 WHERE document_id = ANY($1::uuid[]) AND needs_review = TRUE
+			 ORDER BY document_id, min_confidence ASC NULLS LAST, page_number`, reviewIDs)
+		if err == nil {
+			for _, r := range reviewRows {
+				if result := statuses[fmt.Sprintf("%v", r["document_id"])]; result != nil {
+					pages, _ := result["reviewPages"].([]map[string]any)
+					result["reviewPages"] = append(pages, reviewPage(r))
+				}
+			}
+		}
+	}
+
+	uploads := make([]map[string]any, 0, len(statuses))
+	notFound := []string{}
+	listed := map[string]bool{}
+	for _, id := range req.UploadIDs {
+		if listed[id] {
+			continue
+		}
+		listed[id] = true
+		if result, ok := statuses[id]; ok {
+			uploads = append(uploads, result)
+		} else {
+			notFound = append(notFound, id)
+		}
+	}
+
+	return models.APIResponse(200, map[string]any{
+		"uploads":  uploads,
+		"notFound": notFound,
+	})
+}
+
+// ─── GET /uploads/{id}/pages/{pageNumber}/image ────────────────────────────
+
+func (h *Handler) handlePageImage(ctx context.Context, batchID, pageNumber string) (events.APIGatewayProxyResponse, error) {
+	if _, notFound, err := h.getUploadBatch(ctx, batchID); err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	} else if notFound != nil {
+		return *notFound, nil
+	}
+
+	rows, err := h.db.Query(ctx,
+		`SELECT image_path FROM upload_pages WHERE document_id = $1 AND page_number = $2`,
+		batchID, pageNumber)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	if len(rows) == 0 {
+		return errResponse(404, codePageNotFound, "Page not found")
+	}
+
+	imagePath := fmt.Sprintf("%v", rows[0]["image_path"])
+	imageURL, err := h.s3.PresignGetObject(ctx, h.bucket, imagePath, presignTTL(h.presignGetTTL))
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	return models.APIResponse(200, map[string]any{
+		"uploadId":   batchID,
+		"pageNumber": pageNumber,
+		"imageUrl":   imageURL,
+	})
+}
+
+// ─── GET /uploads/{id}/pages/{pageNumber}/thumbnail ────────────────────────
+
+const (
+	thumbnailMaxDim  = 400
+	thumbnailQuality = 80
+)
+
+func (h *Handler) handlePageThumbnail(ctx context.Context, batchID, pageNumber string) (events.APIGatewayProxyResponse, error) {
+	pageNum, err := strconv.Atoi(pageNumber)
+	if err != nil || pageNum < 1 {
+		return errResponse(400, codeValidation, "pageNumber must be a positive integer")
+	}
+
+	if _, notFound, err := h.getUploadBatch(ctx, batchID); err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	} else if notFound != nil {
+		return *notFound, nil
+	}
+
+	rows, err := h.db.Query(ctx,
+		`SELECT image_path FROM upload_pages WHERE document_id = $1 AND page_number = $2`,
+		batchID, pageNum)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	if len(rows) == 0 {
+		return errResponse(404, codePageNotFound, "Page not found")
+	}
+
+	// Thumbnails are keyed by the image file rather than the page number, so
+	// reordering pages never serves another page's cached thumbnail.
+	imagePath := fmt.Sprintf("%v", rows[0]["image_path"])
+	thumbKey := fmt.Sprintf("thumbnails/%s/%s.jpg", batchID,
+		strings.TrimSuffix(filepath.Base(imagePath), filepath.Ext(imagePath)))
+
+	// Thumbnails are generated on first request and cached in S3
+	cached := false
+	if existing, err := h.s3.GetObject(ctx, h.bucket, thumbKey); err == nil {
+		existing.Close()
+		cached = true
+	}
+
+	if !cached {
+		reader, err := h.s3.GetObject(ctx, h.bucket, imagePath)
+		if err != nil {
+			return events.APIGatewayProxyResponse{}, fmt.Errorf("download page image: %w", err)
+		}
+		data, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return events.APIGatewayProxyResponse{}, fmt.Errorf("read page image: %w", err)
+		}
+
+		thumb, err := imageutil.JPEGThumbnail(data, thumbnailMaxDim, thumbnailQuality)
+		if err != nil {
+			log.Printf("WARNING: thumbnail for %s: %v", imagePath, err)
+			return errResponse(422, codeImageUndecodable, "Page image could not be decoded")
+		}
+		if err := h.s3.PutObject(ctx, h.bucket, thumbKey, "image/jpeg", bytes.NewReader(thumb)); err != nil {
+			return events.APIGatewayProxyResponse{}, fmt.Errorf("upload thumbnail: %w", err)
+		}
+	}
+
+	thumbURL, err := h.s3.PresignGetObject(ctx, h.bucket, thumbKey, presignTTL(h.presignGetTTL))
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	return models.APIResponse(200, map[string]any{
+		"uploadId":     batchID,
+		"pageNumber":   pageNum,
+		"thumbnailUrl": thumbURL,
+		"cached":       cached,
+	})
+}
+
+// ─── GET /uploads/{id}/pages/{pageNumber}/slices/diag ──────────────────────
+
+// handleSliceDiagnostics runs the slicer on a page with the analyzer's default
+// options and reports how it found the entry regions, so a page that sliced
+// poorly can be understood without shell access. Rows are those of the
+// decoded image. Admin only, and only routed when slicerDiagnostics is set.
+func (h *Handler) handleSliceDiagnostics(ctx context.Context, batchID, pageNumber string, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if err := h.requireAdmin(event); err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	pageNum, err := strconv.Atoi(pageNumber)
+	if err != nil || pageNum < 1 {
+		return errResponse(400, codeValidation, "pageNumber must be a positive integer")
+	}
+
+	if _, notFound, err := h.getUploadBatch(ctx, batchID); err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	} else if notFound != nil {
+		return *notFound, nil
+	}
+
+	rows, err := h.db.Query(ctx,
+		`SELECT image_path FROM upload_pages WHERE document_id = $1 AND page_number = $2`,
+		batchID, pageNum)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	if len(rows) == 0 {
+		return errResponse(404, codePageNotFound, "Page not found")
+	}
+
+	imagePath := fmt.Sprintf("%v", rows[0]["image_path"])
+	reader, err := h.s3.GetObject(ctx, h.bucket, imagePath)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, fmt.Errorf("download page image: %w", err)
+	}
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, fmt.Errorf("read page image: %w", err)
+	}
+
+	d, err := slicer.Diagnose(data, slicer.DefaultOptions())
+	if err != nil {
+		log.Printf("WARNING: slice diagnostics for %s: %v", imagePath, err)
+		return errResponse(422, codeImageUndecodable, "Page image could not be decoded")
+	}
+
+	return models.APIResponse(200, map[string]any{
+		"uploadId":   batchID,
+		"pageNumber": pageNum,
+		"imagePath":  imagePath,
+		"width":      d.Width,
+		"height":     d.Height,
+		"options": map[string]any{
+			"darknessThreshold": d.Options.DarknessThreshold,
+			"adaptiveThreshold": d.Options.AdaptiveThreshold,
+			"deskew":            d.Options.Deskew,
+			"autoRotate":        d.Options.AutoRotate,
+			"dilationRadius":    d.Options.DilationRadius,
+			"minGapHeight":      d.Options.MinGapHeight,
+			"minSliceHeight":    d.Options.MinSliceHeight,
+			"padding":           d.Options.Padding,
+			"dropBlankSlices":   d.Options.DropBlankSlices,
+			"maxPixels":         d.Options.MaxPixels,
+			"minEntryFraction":  d.Options.MinEntryFraction,
+			"preferMergeDown":   d.Options.PreferMergeDown,
+		},
+		"threshold":        d.Threshold,
+		"deskewAngle":      d.DeskewAngle,
+		"flipped":          d.Flipped,
+		"noiseFloor":       d.NoiseFloor,
+		"contentThreshold": d.ContentThreshold,
+		"minEntryHeight":   d.MinEntryHeight,
+		"profile":          d.Profile,
+		"smoothed":         d.Smoothed,
+		"regions":          diagRegions(d.Regions),
+		"absorbedRegions":  diagRegions(d.Absorbed),
+		"slices":           diagRegions(d.Slices),
+	})
+}
+
+func diagRegions(regions []slicer.Region) []map[string]any {
+	out := make([]map[string]any, len(regions))
+	for i, r := range regions {
+		out[i] = map[string]any{"y0": r.Y0, "y1": r.Y1, "height": r.Height(), "gap": r.Gap}
+	}
+	return out
+}
+
+// ─── GET /uploads/{id}/pages/{pageNumber}/slices.zip ───────────────────────
+
+// maxSlicesZipBytes caps the slice images put in one zip. API Gateway rejects
+// Lambda responses over 6 MB, and the body grows by a third when base64
+// encoded.
+const maxSlicesZipBytes = 4 << 20
+
+// handleSlicesZip returns every slice image the page's entries were read
+// from as a zip, for reviewing a page's extraction offline. Slices are found
+// through the entries rather than by their key prefix, which holds the page
+// number at analysis time and so goes stale when pages are reordered. Slice
+// keys are content-addressed, so slices of entries from earlier analyses of
+// the page are included too.
+func (h *Handler) handleSlicesZip(ctx context.Context, batchID, pageNumber string) (events.APIGatewayProxyResponse, error) {
+	pageNum, err := strconv.Atoi(pageNumber)
+	if err != nil || pageNum < 1 {
+		return errResponse(400, codeValidation, "pageNumber must be a positive integer")
+	}
+	if _, notFound, err := h.getUploadBatch(ctx, batchID); err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	} else if notFound != nil {
+		return *notFound, nil
+	}
+
+	rows, err := h.db.Query(ctx,
+		`SELECT id FROM upload_pages WHERE document_id = $1 AND page_number = $2`,
+		batchID, pageNum)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	if len(rows) == 0 {
+		return errResponse(404, codePageNotFound, "Page not found")
+	}
+
+	sliceRows, err := h.db.Query(ctx,
+		`SELECT DISTINCT slice_key FROM maintenance_entries
+		 WHERE page_id = $1 AND COALESCE(slice_key, '') <> ''
+		 ORDER BY slice_key`,
+		rows[0]["id"])
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	keys := make([]string, 0, len(sliceRows))
+	for _, r := range sliceRows {
+		if key, _ := r["slice_key"].(string); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return errResponse(404, codeNoSliceImage, "Page has no slice images")
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	total := 0
+	for _, key := range keys {
+		reader, err := h.s3.GetObject(ctx, h.bucket, key)
+		if err != nil {
+			return events.APIGatewayProxyResponse{}, fmt.Errorf("download slice: %w", err)
+		}
+		data, err := io.ReadAll(io.LimitReader(reader, int64(maxSlicesZipBytes-total+1)))
+		reader.Close()
+		if err != nil {
+			return events.APIGatewayProxyResponse{}, fmt.Errorf("read slice %s: %w", key, err)
+		}
+		total += len(data)
+		if total > maxSlicesZipBytes {
+			return errResponse(413, codeResponseTooLarge, "Page slice images are too large to download together")
+		}
+		// Slices are already compressed images; storing them as they are
+		// saves deflating them for nothing.
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: filepath.Base(key), Method: zip.Store})
+		if err != nil {
+			return events.APIGatewayProxyResponse{}, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return events.APIGatewayProxyResponse{}, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	filename := fmt.Sprintf("%s-page-%04d-slices.zip", batchID, pageNum)
+	return models.BinaryResponse(200, "application/zip", filename, buf.Bytes()), nil
+}
+
+// ─── GET /uploads/{id}/pages/{pageNumber}/extraction ───────────────────────
+
+func (h *Handler) handlePageExtraction(ctx context.Context, batchID, pageNumber string) (events.APIGatewayProxyResponse, error) {
+	if _, notFound, err := h.getUploadBatch(ctx, batchID); err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	} else if notFound != nil {
+		return *notFound, nil
+	}
+
+	rows, err := h.db.Query(ctx,
+		`SELECT page_type, extraction_model, extraction_timestamp, raw_extraction::text AS raw_extraction
+		 FROM upload_pages WHERE document_id = $1 AND page_number = $2`,
+		batchID, pageNumber)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	if len(rows) == 0 {
+		return errResponse(404, codePageNotFound, "Page not found")
+	}
+	row := rows[0]
+	stored, ok := row["raw_extraction"].(string)
+	if !ok {
+		return errResponse(404, codePageNotExtracted, "Page has not been extracted")
+	}
+
+	// Stored compressed when COMPRESS_RAW_EXTRACTION was on; older rows are plain.
+	raw, err := rawextraction.Decode([]byte(stored))
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, fmt.Errorf("decode extraction: %w", err)
+	}
+
+	return models.APIResponse(200, map[string]any{
+		"uploadId":            batchID,
+		"pageNumber":          pageNumber,
+		"pageType":            row["page_type"],
+		"extractionModel":     row["extraction_model"],
+		"extractionTimestamp": row["extraction_timestamp"],
+		"extraction":          json.RawMessage(raw),
+	})
+}
+
+// ─── POST /uploads/{id}/candidates ──────────────────────────────────────────
+
+// maxPromptVersionLen caps the length of a candidate's prompt version.
+const maxPromptVersionLen = 64
+
+// validPromptVersion reports whether v can label a candidate extraction:
+// letters, digits, '.', '_' and '-', so it is safe in a URL path.
+func validPromptVersion(v string) bool {
+	if v == "" || len(v) > maxPromptVersionLen {
+		return false
+	}
+	for _, c := range v {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '.', c == '_', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// handleQueueCandidates re-extracts every page of an upload with the prompts
+// the analyze Lambda is running, storing the results as candidates for
+// promptVersion. Each candidate records the version of the prompt its page was
+// read with. Live extractions and entries are left alone, so the
+// candidates can be compared with them before the new prompt goes live.
+// Admin only.
+func (h *Handler) handleQueueCandidates(ctx context.Context, batchID string, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if err := h.requireAdmin(event); err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	var req struct {
+		PromptVersion string `json:"promptVersion"`
+	}
+	if err := json.Unmarshal([]byte(event.Body), &req); err != nil {
+		return errResponse(400, codeInvalidRequest, "invalid request body")
+	}
+	if !validPromptVersion(req.PromptVersion) {
+		return errResponse(400, codeValidation, fmt.Sprintf("promptVersion must be 1-%d letters, digits, '.', '_' or '-'", maxPromptVersionLen))
+	}
+
+	if _, notFound, err := h.getUploadBatch(ctx, batchID); err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	} else if notFound != nil {
+		return *notFound, nil
+	}
+
+	pages, err := h.db.Query(ctx,
+		`SELECT id, page_number, image_path FROM upload_pages
+		 WHERE document_id = $1 AND NOT file_missing ORDER BY page_number`,
+		batchID)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	if len(pages) == 0 {
+		return errResponse(404, codeUploadNotFound, "Upload not found or has no pages")
+	}
+
+	for _, p := range pages {
+		pageNumber, _ := toInt(p["page_number"])
+		msg, _ := json.Marshal(map[string]any{
+			"uploadId":      batchID,
+			"pageId":        fmt.Sprintf("%v", p["id"]),
+			"pageNumber":    pageNumber,
+			"s3Key":         p["image_path"],
+			"promptVersion": req.PromptVersion,
+		})
+		if err := h.sqs.SendMessage(ctx, h.analyzeQueueURL, string(msg)); err != nil {
+			return events.APIGatewayProxyResponse{}, fmt.Errorf("queue candidate page %d: %w", pageNumber, err)
+		}
+	}
+
+	return models.APIResponse(202, map[string]any{
+		"uploadId":      batchID,
+		"promptVersion": req.PromptVersion,
+		"pagesQueued":   len(pages),
+	})
+}
+
+// ─── GET /uploads/{id}/pages/{pageNumber}/extraction/candidates/{promptVersion}
+
+// pageExtraction is the part of a stored extraction the candidate diff
+// compares. Entries stay generic so every extracted field is compared.
+type pageExtraction struct {
+	PageType string           `json:"pageType"`
+	Entries  []map[string]any `json:"entries"`
+}
+
+// candidateChange is one difference between a page's live and candidate
+// extractions. Entries are matched by position; Field is empty when the
+// entry exists in only one of them.
+type candidateChange struct {
+	Entry     int    `json:"entry"`
+	Field     string `json:"field,omitempty"`
+	Live      any    `json:"live"`
+	Candidate any    `json:"candidate"`
+}
+
+// diffExtractions lists the entry fields that differ between live and
+// candidate, in entry then field order.
+func diffExtractions(live, candidate pageExtraction) []candidateChange {
+	changes := []candidateChange{}
+	for i := range max(len(live.Entries), len(candidate.Entries)) {
+		if i >= len(live.Entries) {
+			changes = append(changes, candidateChange{Entry: i, Candidate: candidate.Entries[i]})
+			continue
+		}
+		if i >= len(candidate.Entries) {
+			changes = append(changes, candidateChange{Entry: i, Live: live.Entries[i]})
+			continue
+		}
+		l, c := live.Entries[i], candidate.Entries[i]
+		fields := make([]string, 0, len(l)+len(c))
+		for f := range l {
+			fields = append(fields, f)
+		}
+		for f := range c {
+			if _, ok := l[f]; !ok {
+				fields = append(fields, f)
+			}
+		}
+		sort.Strings(fields)
+		for _, f := range fields {
+			if !reflect.DeepEqual(l[f], c[f]) {
+				changes = append(changes, candidateChange{Entry: i, Field: f, Live: l[f], Candidate: c[f]})
+			}
+		}
+	}
+	return changes
+}
+
+// handleCandidateDiff compares a page's candidate extraction for
+// promptVersion with its live one. Admin only.
+func (h *Handler) handleCandidateDiff(ctx context.Context, batchID, pageNumber, promptVersion string, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if err := h.requireAdmin(event); err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	if !validPromptVersion(promptVersion) {
+		return errResponse(400, codeValidation, "Invalid promptVersion")
+	}
+
+	if _, notFound, err := h.getUploadBatch(ctx, batchID); err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	} else if notFound != nil {
+		return *notFound, nil
+	}
+
+	rows, err := h.db.Query(ctx,
+		`SELECT raw_extraction::text AS live,
+		        (raw_extraction_candidate -> $3)::text AS candidate
+		 FROM upload_pages WHERE document_id = $1 AND page_number = $2`,
+		batchID, pageNumber, promptVersion)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	if len(rows) == 0 {
+		return errResponse(404, codePageNotFound, "Page not found")
+	}
+	storedLive, ok := rows[0]["live"].(string)
+	if !ok {
+		return errResponse(404, codePageNotExtracted, "Page has not been extracted")
+	}
+	storedCandidate, ok := rows[0]["candidate"].(string)
+	if !ok {
+		return errResponse(404, codeCandidateNotFound, fmt.Sprintf("Page has no candidate extraction for prompt version %s", promptVersion))
+	}
+
+	var raw [2]json.RawMessage
+	var parsed [2]pageExtraction
+	for i, stored := range []string{storedLive, storedCandidate} {
+		// Either may be stored compressed; see rawextraction.
+		if raw[i], err = rawextraction.Decode([]byte(stored)); err != nil {
+			return events.APIGatewayProxyResponse{}, fmt.Errorf("decode extraction: %w", err)
+		}
+		if err := json.Unmarshal(raw[i], &parsed[i]); err != nil {
+			return events.APIGatewayProxyResponse{}, fmt.Errorf("parse extraction: %w", err)
+		}
+	}
+	live, candidate := parsed[0], parsed[1]
+	changes := diffExtractions(live, candidate)
+
+	return models.APIResponse(200, map[string]any{
+		"uploadId":      batchID,
+		"pageNumber":    pageNumber,
+		"promptVersion": promptVersion,
+		"live":          raw[0],
+		"candidate":     raw[1],
+		"diff": map[string]any{
+			"identical":        len(changes) == 0 && live.PageType == candidate.PageType,
+			"pageType":         map[string]any{"live": live.PageType, "candidate": candidate.PageType},
+			"liveEntries":      len(live.Entries),
+			"candidateEntries": len(candidate.Entries),
+			"changes":          changes,
+		},
+	})
+}
+
+// ─── DELETE /aircraft/{tailNumber} ──────────────────────────────────────────
+
+// handleDeleteAircraft removes an aircraft and everything recorded against
+// it, reporting how many rows went from each table. Admin only, and the
+// request must carry confirm=true so a stray DELETE can't wipe a logbook.
+// The uploads' files in S3 are deleted first: the bucket has no lifecycle
+// rules, and once the rows are gone nothing would find the files again. If
+// that fails the rows are kept, so the request can simply be retried.
+func (h *Handler) handleDeleteAircraft(ctx context.Context, tailNumber string, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if err := h.requireAdmin(event); err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	if event.QueryStringParameters["confirm"] != "true" {
+		return errResponse(400, codeValidation, "Deleting an aircraft requires confirm=true")
+	}
+	tail := strings.ToUpper(tailNumber)
+	aid, notFound, err := h.getAircraftID(ctx, tail)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	if notFound != nil {
+		return *notFound, nil
+	}
+
+	ctx = db.WithPrimary(ctx)
+	batches, err := h.db.Query(ctx,
+		`SELECT id, s3_key FROM upload_batches WHERE aircraft_id = $1`, aid)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, fmt.Errorf("list aircraft uploads: %w", err)
+	}
+	for _, b := range batches {
+		s3Key, _ := b["s3_key"].(string)
+		if err := h.deleteBatchObjects(ctx, fmt.Sprint(b["id"]), s3Key); err != nil {
+			return events.APIGatewayProxyResponse{}, err
+		}
+	}
+
+	// One statement, so the cascade commits or rolls back as a whole.
+	// Dependents go before the rows they reference; every sub-statement sees
+	// the same snapshot, so entries and batches can still be found by
+	// aircraft after they are deleted.
+	rows, err := h.db.Query(ctx,
+		`WITH embeddings AS (
+			DELETE FROM maintenance_embeddings
+			WHERE entry_id IN (SELECT id FROM maintenance_entries WHERE aircraft_id = $1)
+			RETURNING 1
+		), parts AS (
+			DELETE FROM parts_actions
+			WHERE entry_id IN (SELECT id FROM maintenance_entries WHERE aircraft_id = $1)
+			RETURNING 1
+		), ads AS (
+			DELETE FROM ad_compliance WHERE aircraft_id = $1 RETURNING 1
+		), inspections AS (
+			DELETE FROM inspection_records WHERE aircraft_id = $1 RETURNING 1
+		), weight_balance AS (
+			DELETE FROM weight_balance_revisions WHERE aircraft_id = $1 RETURNING 1
+		), revisions AS (
+			DELETE FROM entry_revisions WHERE aircraft_id = $1 RETURNING 1
+		), entries AS (
+			DELETE FROM maintenance_entries WHERE aircraft_id = $1 RETURNING 1
+		), pages AS (
+			DELETE FROM upload_pages
+			WHERE document_id IN (SELECT id FROM upload_batches WHERE aircraft_id = $1)
+			RETURNING 1
+		), batches AS (
+			DELETE FROM upload_batches WHERE aircraft_id = $1 RETURNING 1
+		), life_limited AS (
+			DELETE FROM life_limited_parts WHERE aircraft_id = $1 RETURNING 1
+		), deleted_aircraft AS (
+			DELETE FROM aircraft WHERE id = $1 RETURNING 1
+		)
+		SELECT (SELECT COUNT(*) FROM embeddings) AS "embeddings",
+		       (SELECT COUNT(*) FROM parts) AS "partsActions",
+		       (SELECT COUNT(*) FROM ads) AS "adCompliance",
+		       (SELECT COUNT(*) FROM inspections) AS "inspections",
+		       (SELECT COUNT(*) FROM weight_balance) AS "weightBalanceRevisions",
+		       (SELECT COUNT(*) FROM revisions) AS "entryRevisions",
+		       (SELECT COUNT(*) FROM entries) AS "entries",
+		       (SELECT COUNT(*) FROM pages) AS "pages",
+		       (SELECT COUNT(*) FROM batches) AS "uploads",
+		       (SELECT COUNT(*) FROM life_limited) AS "lifeLimitedParts",
+		       (SELECT COUNT(*) FROM deleted_aircraft) AS "aircraft"`, aid)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, fmt.Errorf("delete aircraft: %w", err)
+	}
+	var deleted map[string]any
+	if len(rows) > 0 {
+		deleted = rows[0]
+	}
+
+	return models.APIResponse(200, map[string]any{
+		"tailNumber": tail,
+		"deleted":    deleted,
+	})
+}
+
+// batchObjectPrefixes are the S3 prefixes an upload batch's files live
+// under, each followed by the batch id.
+var batchObjectPrefixes = []string{"uploads/", "pages/", "slices/", "thumbnails/"}
+
+// deleteBatchObjects deletes everything stored in S3 for an upload batch: the
+// uploaded source file, rendered pages, slices and thumbnails.
+func (h *Handler) deleteBatchObjects(ctx context.Context, batchID, s3Key string) error {
+	var keys []string
+	for _, prefix := range batchObjectPrefixes {
+		found, err := h.s3.ListObjects(ctx, h.bucket, prefix+batchID+"/")
+		if err != nil {
+			return fmt.Errorf("list %s%s/: %w", prefix, batchID, err)
+		}
+		keys = append(keys, found...)
+	}
+	// Older uploads were stored outside uploads/<batch id>/.
+	if s3Key != "" && !slices.Contains(keys, s3Key) {
+		keys = append(keys, s3Key)
+	}
+	for _, key := range keys {
+		if err := h.s3.DeleteObject(ctx, h.bucket, key); err != nil {
+			return fmt.Errorf("delete %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// ─── GET /aircraft/{tailNumber}/uploads ─────────────────────────────────────
+
+func (h *Handler) handleListUploads(ctx context.Context, tailNumber string) (events.APIGatewayProxyResponse, error) {
+	tail := strings.ToUpper(tailNumber)
+	rows, err := h.db.Query(ctx,
+		`SELECT ub.id, ub.logbook_type, ub.upload_type, ub.source_filename,
+		        ub.processing_status, ub.page_count, ub.date_range_start,
+		        ub.date_range_end, ub.created_at
+		 FROM upload_batches ub
+		 JOIN aircraft a ON ub.aircraft_id = a.id
+		 WHERE a.registration = $1 AND a.tenant_id = $2
+		 ORDER BY ub.created_at DESC`, tail, tenantFrom(ctx))
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	return models.APIResponse(200, map[string]any{
+		"tailNumber": tail,
+		"uploads":    rows,
+	})
+}
+
+// ─── GET /aircraft/{tailNumber}/summary ─────────────────────────────────────
+
+// handleSummary reports an aircraft's maintenance status. An unknown tail is
+// a 404 unless the request has create=true, in which case the aircraft is
+// created as an upload would create it and its (empty) summary returned.
+// Entries superseded by a re-upload are left out unless includeSuperseded is
+// true.
+func (h *Handler) handleSummary(ctx context.Context, tailNumber string, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	tail := strings.ToUpper(tailNumber)
+	create := strings.EqualFold(event.QueryStringParameters["create"], "true")
+	current := "me.superseded_by IS NULL"
+	if strings.EqualFold(event.QueryStringParameters["includeSuperseded"], "true") {
+		current = "TRUE"
+	}
+
+	const aircraftSQL = "SELECT * FROM aircraft WHERE registration = $1 AND tenant_id = $2"
+	aircraft, err := h.db.Query(ctx, aircraftSQL, tail, tenantFrom(ctx))
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	if len(aircraft) == 0 && create {
+		if _, err := h.upsertAircraft(ctx, tail); err != nil {
+			return events.APIGatewayProxyResponse{}, err
+		}
+		// Read it back from the primary, which replicas may not have caught
+		// up with.
+		ctx = db.WithPrimary(ctx)
+		if aircraft, err = h.db.Query(ctx, aircraftSQL, tail, tenantFrom(ctx)); err != nil {
+			return events.APIGatewayProxyResponse{}, err
+		}
+	}
+	if len(aircraft) == 0 {
+		return errResponse(404, codeAircraftNotFound, fmt.Sprintf("Aircraft %s not found", tail))
+	}
+	aid := fmt.Sprintf("%v", aircraft[0]["id"])
+
+	annual, _ := h.db.Query(ctx,
+		fmt.Sprintf(`SELECT me.entry_date, me.flight_time
+		 FROM inspection_records ir
+		 JOIN maintenance_entries me ON ir.entry_id = me.id
+		 WHERE ir.aircraft_id = $1 AND ir.inspection_type = 'annual' AND %s
+		 ORDER BY ir.inspection_date DESC LIMIT 1`, current), aid)
+
+	hundredhr, _ := h.db.Query(ctx,
+		fmt.Sprintf(`SELECT me.entry_date, me.flight_time
+		 FROM inspection_records ir
+		 JOIN maintenance_entries me ON ir.entry_id = me.id
+		 WHERE ir.aircraft_id = $1 AND ir.inspection_type = '100hr' AND %s
+		 ORDER BY ir.inspection_date DESC LIMIT 1`, current), aid)
+
+	oil, _ := h.db.Query(ctx,
+		fmt.Sprintf(`SELECT me.entry_date, me.flight_time FROM maintenance_entries me
+		 WHERE me.aircraft_id = $1 AND %s
+		   AND (lower(me.maintenance_narrative) LIKE '%%oil change%%'
+		        OR lower(me.maintenance_narrative) LIKE '%%oil filter%%')
+		 ORDER BY me.entry_date DESC LIMIT 1`, current), aid)
+
+	tt, _ := h.db.Query(ctx,
+		fmt.Sprintf(`SELECT me.flight_time, me.flight_time::float8 AS hours FROM maintenance_entries me
+		 WHERE me.aircraft_id = $1 AND me.flight_time IS NOT NULL AND %s
+		 ORDER BY me.entry_date DESC LIMIT 1`, current), aid)
+
+	// Latest record of each calendar check, with when the next one is due
+	checks, _ := h.db.Query(ctx,
+		fmt.Sprintf(`SELECT DISTINCT ON (ir.inspection_type) ir.inspection_type,
+		        me.entry_date, me.flight_time, ir.next_due_date
+		 FROM inspection_records ir
+		 JOIN maintenance_entries me ON ir.entry_id = me.id
+		 WHERE ir.aircraft_id = $1 AND %s
+		   AND ir.inspection_type IN ('elt', 'altimeter_static', 'transponder')
+		 ORDER BY ir.inspection_type, ir.inspection_date DESC`, current), aid)
+
+	expirations, _ := h.db.Query(ctx,
+		fmt.Sprintf(`SELECT 'life_limited_part' AS type, part_name AS name, expiration_date
+		 FROM life_limited_parts WHERE aircraft_id = $1 AND is_active = TRUE
+		   AND expiration_date IS NOT NULL AND expiration_date <= CURRENT_DATE + INTERVAL '90 days'
+		 UNION ALL
+		 SELECT ir.inspection_type AS type, ir.inspection_type || ' inspection' AS name, ir.next_due_date AS expiration_date
+		 FROM inspection_records ir
+		 LEFT JOIN maintenance_entries me ON ir.entry_id = me.id
+		 WHERE ir.aircraft_id = $1 AND %s
+		   AND ir.next_due_date IS NOT NULL AND ir.next_due_date <= CURRENT_DATE + INTERVAL '90 days'
+		 ORDER BY expiration_date`, current), aid, aid)
+
+	result := map[string]any{
+		"tailNumber":          tail,
+		"aircraft":            aircraft[0],
+		"lastAnnual":          firstOrNil(annual),
+		"last100hr":           firstOrNil(hundredhr),
+		"lastOilChange":       firstOrNil(oil),
+		"totalTime":           nil,
+		"totalTimeFormatted":  nil,
+		"upcomingExpirations": expirations,
+	}
+
+	if len(tt) > 0 {
+		result["totalTime"] = tt[0]["flight_time"]
+		result["totalTimeFormatted"] = hoursText(tt[0]["hours"])
+	}
+
+	for _, key := range summaryCheckKeys {
+		result[key] = nil
+	}
+	for _, c := range checks {
+		typ, _ := c["inspection_type"].(string)
+		if key, ok := summaryCheckKeys[typ]; ok {
+			result[key] = map[string]any{
+				"entry_date":    c["entry_date"],
+				"flight_time":   c["flight_time"],
+				"next_due_date": c["next_due_date"],
+			}
+		}
+	}
+
+	return models.APIResponse(200, result)
+}
+
+// summaryCheckKeys maps the calendar checks reported in the summary to their
+// response keys.
+var summaryCheckKeys = map[string]string{
+	"elt":              "lastElt",
+	"altimeter_static": "lastAltimeterStatic",
+	"transponder":      "lastTransponder",
+}
+
+// ─── POST /aircraft/{tailNumber}/query ──────────────────────────────────────
+
+// defaultQueryTemperature is used for answers when GENERATE_TEMPERATURE is
+// unset.
+const defaultQueryTemperature = float32(0.2)
+
+func (h *Handler) handleQuery(ctx context.Context, tailNumber string, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	q, early, err := h.prepareQuery(ctx, tailNumber, event)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	if early != nil {
+		return *early, nil
+	}
+	if q.prompt != "" {
+		answer, err := q.client.GenerateContent(ctx, "gemini-2.5-flash", []gemini.Part{
+			{Text: q.prompt},
+		}, h.queryConfig())
+		if err != nil {
+			return events.APIGatewayProxyResponse{}, fmt.Errorf("generate answer: %w", err)
+		}
+		q.response["answer"] = answer
+	}
+	return models.APIResponse(200, q.response)
+}
+
+// ragQuery is a validated question with its records retrieved, ready for
+// the answer to be generated.
+type ragQuery struct {
+	client gemini.Client
+	// prompt is the RAG prompt to answer. It is empty when there is nothing
+	// to generate, in which case response already holds the answer.
+	prompt string
+	// response is the query response, less the answer.
+	response map[string]any
+}
+
+// prepareQuery validates the question, retrieves the aircraft's closest
+// records and builds the prompt. A non-nil response is a client error to
+// return as-is.
+func (h *Handler) prepareQuery(ctx context.Context, tailNumber string, event events.APIGatewayProxyRequest) (*ragQuery, *events.APIGatewayProxyResponse, error) {
+	var body struct {
+		Question string `json:"question"`
+	}
+	if err := json.Unmarshal([]byte(event.Body), &body); err != nil || strings.TrimSpace(body.Question) == "" {
+		resp, err := errResponse(400, codeValidation, "question is required")
+		return nil, &resp, err
+	}
+
+	tail := strings.ToUpper(tailNumber)
+	aid, notFound, err := h.getAircraftID(ctx, tail)
+	if err != nil {
+		return nil, nil, err
+	}
+	if notFound != nil {
+		return nil, notFound, nil
+	}
+
+	geminiClient, err := h.getGeminiClient(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Generate embedding for the question
+	embedding, err := h.embedding.Embed(ctx, geminiClient, body.Question)
+	if err != nil {
+		return nil, nil, fmt.Errorf("embed question: %w", err)
+	}
+
+	embeddingStr := gemini.FormatEmbedding(embedding)
+
+	// Only embeddings from the same model are comparable with the question's.
+	results, err := h.db.Query(ctx,
+		`SELECT me.entry_id, me.chunk_text, me.chunk_type,
+		        m.entry_date, m.entry_type, m.maintenance_narrative,
+		        ir.inspection_type,
+		        1 - (me.embedding <=> $1::halfvec) AS similarity
+		 FROM maintenance_embeddings me
+		 JOIN maintenance_entries m ON me.entry_id = m.id
+		 LEFT JOIN inspection_records ir ON ir.entry_id = m.id
+		 WHERE m.aircraft_id = $2 AND me.model = $3 AND m.superseded_by IS NULL
+		 ORDER BY me.embedding <=> $1::halfvec
+		 LIMIT 10`, embeddingStr, aid, h.embedding.ModelName())
+	if err != nil {
+		return nil, nil, vectorSearchError(err)
+	}
+
+	if len(results) == 0 {
+		return &ragQuery{client: geminiClient, response: map[string]any{
+			"tailNumber": tail,
+			"question":   body.Question,
+			"answer":     "No maintenance records found for this aircraft.",
+			"sources":    []any{},
+			"retrieved":  []any{},
+			"usage":      map[string]any{"chunks": 0, "contextTokens": 0},
+		}}, nil, nil
+	}
+
+	// Build context for Gemini
+	var contextParts []string
+	for _, r := range results {
+		contextParts = append(contextParts, contextRecord(r))
+	}
+	contextText := strings.Join(contextParts, "\n---\n")
+
+	ragPrompt := fmt.Sprintf(`You are an aircraft maintenance expert assistant. Answer the question based ONLY on the maintenance records provided below.
+
+Aircraft: %s
+
+MAINTENANCE RECORDS:
+%s
+
+QUESTION: %s
+
+Provide a clear, accurate answer. Cite specific dates and entries. If the records don't contain enough information, say so.`, tail, contextText, body.Question)
+
+	// Every retrieved chunk is returned; the top ones are also cited as sources
+	retrieved := make([]map[string]any, 0, len(results))
+	for _, r := range results {
+		retrieved = append(retrieved, querySource(r))
+	}
+	sources := retrieved[:min(len(retrieved), queryCitedSources)]
+
+	return &ragQuery{client: geminiClient, prompt: ragPrompt, response: map[string]any{
+		"tailNumber": tail,
+		"question":   body.Question,
+		"sources":    sources,
+		"retrieved":  retrieved,
+		"usage": map[string]any{
+			"chunks":        len(results),
+			"contextTokens": estimateTokens(contextText),
+		},
+	}}, nil, nil
+}
+
+// streamQuery writes q's response to w as server-sent events: "sources"
+// with everything but the answer, an "answer" event per chunk of text as the
+// model produces it, then "done". The status is already sent by the time
+// generation can fail, so a failure ends the stream with an "error" event
+// instead of "done".
+func (h *Handler) streamQuery(ctx context.Context, q *ragQuery, w io.Writer) error {
+	meta := make(map[string]any, len(q.response))
+	for k, v := range q.response {
+		if k != "answer" {
+			meta[k] = v
+		}
+	}
+	if err := writeEvent(w, "sources", meta); err != nil {
+		return err
+	}
+
+	if q.prompt == "" {
+		if err := writeEvent(w, "answer", map[string]any{"text": q.response["answer"]}); err != nil {
+			return err
+		}
+		return writeEvent(w, "done", map[string]any{})
+	}
+
+	var writeErr error
+	err := q.client.GenerateContentStream(ctx, "gemini-2.5-flash", []gemini.Part{
+		{Text: q.prompt},
+	}, h.queryConfig(), func(text string) error {
+		writeErr = writeEvent(w, "answer", map[string]any{"text": text})
+		return writeErr
+	})
+	if writeErr != nil {
+		return writeErr
+	}
+	if err != nil {
+		log.Printf("ERROR: stream answer: %v", err)
+		return writeEvent(w, "error", map[string]any{"code": codeInternal, "message": "Internal server error"})
+	}
+	return writeEvent(w, "done", map[string]any{})
+}
+
+// writeEvent writes one server-sent event with data as its JSON payload.
+func writeEvent(w io.Writer, name string, data any) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, b)
+	return err
+}
+
+// queryConfig returns the generation config for answers: the configured
+// sampling, with defaultQueryTemperature when no temperature is set.
+func (h *Handler) queryConfig() *gemini.GenerateConfig {
+	config := h.sampling
+	if config.Temperature == nil {
+		temp := defaultQueryTemperature
+		config.Temperature = &temp
+	}
+	return &config
+}
+
+// contextRecord renders a retrieved row as one record of the model context.
+func contextRecord(r map[string]any) string {
+	label := fmt.Sprintf("%v", r["entry_type"])
+	if it, ok := r["inspection_type"]; ok && it != nil {
+		label = fmt.Sprintf("%s/%v", label, it)
+	}
+	return fmt.Sprintf("[%v] (%s) %v", r["entry_date"], label, r["maintenance_narrative"])
+}
+
+// querySource renders a retrieved row as a source in the query response.
+func querySource(r map[string]any) map[string]any {
+	source := map[string]any{
+		"entryId":        fmt.Sprintf("%v", r["entry_id"]),
+		"chunkType":      r["chunk_type"],
+		"snippet":        snippet(fmt.Sprintf("%v", r["chunk_text"]), querySnippetLength),
+		"date":           fmt.Sprintf("%v", r["entry_date"]),
+		"type":           r["entry_type"],
+		"inspectionType": r["inspection_type"],
+	}
+	if sim, ok := r["similarity"]; ok {
+		source["similarity"] = sim
+	}
+	return source
+}
+
+const (
+	queryCitedSources  = 5
+	querySnippetLength = 200
+)
+
+// snippet truncates text to at most n runes, marking the cut with an ellipsis.
+func snippet(text string, n int) string {
+	text = strings.TrimSpace(text)
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	return strings.TrimSpace(string(runes[:n])) + "…"
+}
+
+// estimateTokens approximates the model token count of text (~4 chars/token).
+func estimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// ─── GET /aircraft/{tailNumber}/entries ──────────────────────────────────────
+
+func (h *Handler) handleEntries(ctx context.Context, tailNumber string, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	aid, notFound, err := h.getAircraftID(ctx, tailNumber)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	if notFound != nil {
+		return *notFound, nil
+	}
+
+	qp := models.ParseQueryParams(event)
+	entryType := qp.Params["type"]
+	dateFrom := qp.Params["dateFrom"]
+	dateTo := qp.Params["dateTo"]
+	needsReview := qp.Params["needsReview"]
+	shop := strings.TrimSpace(qp.Params["shop"])
+	mechanic := strings.TrimSpace(qp.Params["mechanic"])
+	includeSuperseded := strings.EqualFold(qp.Params["includeSuperseded"], "true")
+
+	orderBy, badSort := resolveSort(qp.Params["sort"], entrySorts)
+	if badSort != nil {
+		return *badSort, nil
+	}
+
+	whereClauses := []string{"me.aircraft_id = $1"}
+	args := db.Args{aid}
+
+	if entryType != "" {
+		whereClauses = append(whereClauses, "me.entry_type = "+args.Add(entryType))
+	}
+	if dateFrom != "" {
+		whereClauses = append(whereClauses, "me.entry_date >= "+args.Add(dateFrom))
+	}
+	if dateTo != "" {
+		whereClauses = append(whereClauses, "me.entry_date <= "+args.Add(dateTo))
+	}
+	if strings.EqualFold(needsReview, "true") {
+		whereClauses = append(whereClauses, "me.needs_review = TRUE")
+	}
+	if shop != "" {
+		whereClauses = append(whereClauses, "me.shop_name ILIKE "+args.Add("%"+escapeLike(shop)+"%"))
+	}
+	if mechanic != "" {
+		whereClauses = append(whereClauses, "me.mechanic_name ILIKE "+args.Add("%"+escapeLike(mechanic)+"%"))
+	}
+	if !includeSuperseded {
+		whereClauses = append(whereClauses, "me.superseded_by IS NULL")
+	}
+
+	if cursor, ok := qp.Params["cursor"]; ok {
+		return h.entriesAfterCursor(ctx, tailNumber, cursor, qp.Params["sort"], whereClauses, args, qp.Limit)
+	}
+
+	whereSQL := strings.Join(whereClauses, " AND ")
+
+	countRows, err := h.db.Query(ctx,
+		fmt.Sprintf("SELECT COUNT(*) AS total FROM maintenance_entries me WHERE %s", whereSQL),
+		args...)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	total, _ := toInt(countRows[0]["total"])
+
+	limit, offset := args.Add(qp.Limit), args.Add(qp.Offset)
+	entries, err := h.db.Query(ctx,
+		fmt.Sprintf(`SELECT %s
+		 FROM maintenance_entries me
+		 LEFT JOIN inspection_records ir ON ir.entry_id = me.id
+		 WHERE %s
+		 ORDER BY %s
+		 LIMIT %s OFFSET %s`, entryListColumns, whereSQL, orderBy, limit, offset),
+		args...)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	return models.APIResponse(200, map[string]any{
+		"tailNumber": strings.ToUpper(tailNumber),
+		"entries":    entries,
+		"pagination": models.NewPagination(total, qp.Page, qp.Limit),
+	})
+}
+
+// entryListColumns are the columns of each entry in the entry list.
+const entryListColumns = `me.id, me.entry_type, me.entry_date, me.hobbs_time, me.tach_time,
+		        me.flight_time, me.shop_name, me.mechanic_name,
+		        me.maintenance_narrative, me.confidence_score, me.needs_review,
+		        me.review_status, me.missing_data, me.extraction_notes,
+		        me.superseded_by, me.source, ir.inspection_type`
+
+// entryCursorSorts are the sorts cursor pagination supports, mapped to the
+// comparison that selects entry dates after the cursor's. Entries on the
+// cursor's date follow it by id, which both sorts order ascending.
+var entryCursorSorts = map[string]string{
+	"date":  ">",
+	"-date": "<",
+}
+
+// entryCursor is a position in the entry list: the date and id of the last
+// entry on the previous page. It travels as base64url-encoded JSON.
+type entryCursor struct {
+	Date string `json:"date"`
+	ID   string `json:"id"`
+}
+
+func encodeEntryCursor(row map[string]any) (string, error) {
+	date, ok := toDate(row["entry_date"])
+	if !ok {
+		return "", fmt.Errorf("entry %v has no date", row["id"])
+	}
+	b, err := json.Marshal(entryCursor{Date: date.Format("2006-01-02"), ID: fmt.Sprintf("%v", row["id"])})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeEntryCursor(s string) (entryCursor, bool) {
+	var c entryCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || json.Unmarshal(b, &c) != nil {
+		return c, false
+	}
+	if _, err := time.Parse("2006-01-02", c.Date); err != nil || !isUUID(c.ID) {
+		return c, false
+	}
+	return c, true
+}
+
+// entriesAfterCursor lists the page of entries after cursor, or the first
+// page when cursor is empty, with the cursor for the page after it. Unlike
+// OFFSET, keyset pagination stays fast on deep pages and neither skips nor
+// repeats entries when others are inserted between requests. where and args
+// are the list filters and their arguments.
+func (h *Handler) entriesAfterCursor(ctx context.Context, tailNumber, cursor, sortKey string, where []string, args db.Args, limit int) (events.APIGatewayProxyResponse, error) {
+	if sortKey == "" {
+		sortKey = "-date"
+	}
+	op, ok := entryCursorSorts[sortKey]
+	if !ok {
+		return errResponse(400, codeValidation, fmt.Sprintf("Cursor pagination requires sort date or -date, not %q", sortKey))
+	}
+
+	if cursor != "" {
+		c, ok := decodeEntryCursor(cursor)
+		if !ok {
+			return errResponse(400, codeValidation, "Invalid cursor")
+		}
+		date, id := args.Add(c.Date), args.Add(c.ID)
+		where = append(where, fmt.Sprintf("(me.entry_date %s %s OR (me.entry_date = %s AND me.id > %s))", op, date, date, id))
+	}
+
+	// One extra row tells whether there is a next page.
+	entries, err := h.db.Query(ctx,
+		fmt.Sprintf(`SELECT %s
+		 FROM maintenance_entries me
+		 LEFT JOIN inspection_records ir ON ir.entry_id = me.id
+		 WHERE %s
+		 ORDER BY %s
+		 LIMIT %s`, entryListColumns, strings.Join(where, " AND "), entrySorts[sortKey], args.Add(limit+1)),
+		args...)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	var next *string
+	if len(entries) > limit {
+		entries = entries[:limit]
+		c, err := encodeEntryCursor(entries[limit-1])
+		if err != nil {
+			return events.APIGatewayProxyResponse{}, err
+		}
+		next = &c
+	}
+
+	return models.APIResponse(200, map[string]any{
+		"tailNumber": strings.ToUpper(tailNumber),
+		"entries":    entries,
+		"pagination": models.CursorPagination{Limit: limit, NextCursor: next},
+	})
+}
+
+// ─── GET /aircraft/{tailNumber}/entries/search ──────────────────────────────
+
+// searchHeadlineOptions marks matched terms in the snippet with <mark> tags.
+const searchHeadlineOptions = "StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=30, MinWords=10"
+
+// handleSearchEntries runs a keyword search over entry narratives and shop
+// names. q uses web search syntax: words are ANDed, "quoted phrases" match
+// in order, "or" alternates and a leading - excludes a word. Results are
+// ranked by relevance, most recent first among ties.
+func (h *Handler) handleSearchEntries(ctx context.Context, tailNumber string, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	qp := models.ParseQueryParams(event)
+	q := strings.TrimSpace(qp.Params["q"])
+	if q == "" {
+		return errResponse(400, codeValidation, "q is required")
+	}
+
+	aid, notFound, err := h.getAircraftID(ctx, tailNumber)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	if notFound != nil {
+		return *notFound, nil
+	}
+
+	countRows, err := h.db.Query(ctx,
+		`SELECT COUNT(*) AS total
+		 FROM maintenance_entries me, websearch_to_tsquery('english', $2) q
+		 WHERE me.aircraft_id = $1 AND me.search_vector @@ q
+		   AND me.superseded_by IS NULL`, aid, q)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	total, _ := toInt(countRows[0]["total"])
+
+	entries, err := h.db.Query(ctx,
+		`SELECT me.id, me.entry_type, me.entry_date, me.hobbs_time, me.tach_time,
+		        me.flight_time, me.shop_name, me.mechanic_name,
+		        me.maintenance_narrative, me.confidence_score, me.needs_review,
+		        me.review_status, ir.inspection_type,
+		        ts_rank(me.search_vector, q) AS rank,
+		        ts_headline('english', me.maintenance_narrative, q, $3) AS snippet
+		 FROM maintenance_entries me
+		 CROSS JOIN websearch_to_tsquery('english', $2) q
+		 LEFT JOIN inspection_records ir ON ir.entry_id = me.id
+		 WHERE me.aircraft_id = $1 AND me.search_vector @@ q
+		   AND me.superseded_by IS NULL
+		 ORDER BY rank DESC, me.entry_date DESC, me.id
+		 LIMIT $4 OFFSET $5`,
+		aid, q, searchHeadlineOptions, qp.Limit, qp.Offset)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	return models.APIResponse(200, map[string]any{
+		"tailNumber": strings.ToUpper(tailNumber),
+		"query":      q,
+		"entries":    entries,
+		"pagination": models.NewPagination(total, qp.Page, qp.Limit),
+	})
+}
+
+// ─── GET /aircraft/{tailNumber}/entries/{entryId} ───────────────────────────
+
+func (h *Handler) handleEntryDetail(ctx context.Context, tailNumber, entryID string) (events.APIGatewayProxyResponse, error) {
+	aid, notFound, err := h.getAircraftID(ctx, tailNumber)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	if notFound != nil {
+		return *notFound, nil
+	}
+
+	entries, err := h.db.Query(ctx,
+		"SELECT me.* FROM maintenance_entries me WHERE me.id = $1 AND me.aircraft_id = $2",
+		entryID, aid)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	if len(entries) == 0 {
+		return errResponse(404, codeEntryNotFound, "Entry not found")
+	}
+
+	entry := entries[0]
+	delete(entry, "search_vector") // internal full-text index column
+
+	parts, _ := h.db.Query(ctx,
+		"SELECT * FROM parts_actions WHERE entry_id = $1 ORDER BY created_at", entryID)
+	ads, _ := h.db.Query(ctx,
+		"SELECT * FROM ad_compliance WHERE entry_id = $1 ORDER BY compliance_date", entryID)
+	inspections, _ := h.db.Query(ctx,
+		"SELECT * FROM inspection_records WHERE entry_id = $1", entryID)
+
+	entry["partsActions"] = parts
+	entry["adCompliance"] = ads
+	if len(inspections) > 0 {
+		entry["inspectionRecord"] = inspections[0]
+	} else {
+		entry["inspectionRecord"] = nil
+	}
+
+	// Link back to the slice image the entry was extracted from
+	entry["slice"] = nil
+	if key, ok := entry["slice_key"].(string); ok && key != "" {
+		slice := map[string]any{
+			"key":      key,
+			"y0":       entry["slice_y0"],
+			"y1":       entry["slice_y1"],
+			"imageUrl": nil,
+		}
+		if sliceURL, err := h.s3.PresignGetObject(ctx, h.bucket, key, presignTTL(h.presignGetTTL)); err != nil {
+			log.Printf("WARNING: presign slice %s: %v", key, err)
+		} else {
+			slice["imageUrl"] = sliceURL
+		}
+		entry["slice"] = slice
+	}
+
+	return models.APIResponse(200, map[string]any{
+		"tailNumber": strings.ToUpper(tailNumber),
+		"entry":      entry,
+	})
+}
+
+// ─── PATCH /aircraft/{tailNumber}/entries/{entryId} ─────────────────────────
+
+var patchableFields = map[string]string{
+	"entryDate":           "entry_date",
+	"entryType":           "entry_type",
+	"hobbsTime":           "hobbs_time",
+	"tachTime":            "tach_time",
+	"flightTime":          "flight_time",
+	"timeSinceOverhaul":   "time_since_overhaul",
+	"shopName":            "shop_name",
+	"shopAddress":         "shop_address",
+	"shopPhone":           "shop_phone",
+	"repairStationNumber": "repair_station_number",
+	"mechanicName":        "mechanic_name",
+	"mechanicCertificate": "mechanic_certificate",
+	"workOrderNumber":     "work_order_number",
+	"maintenanceNarrative": "maintenance_narrative",
+}
+
+// patchHourFields are the hour meter fields, stored as DECIMAL(10,1).
+var patchHourFields = map[string]bool{
+	"hobbsTime": true, "tachTime": true, "flightTime": true, "timeSinceOverhaul": true,
+}
+
+// maxPatchHours is the largest value a DECIMAL(10,1) column holds.
+const maxPatchHours = 999999999.9
+
+// patchMaxLengths mirrors the VARCHAR limits of the patchable text columns.
+var patchMaxLengths = map[string]int{
+	"shopName": 200, "shopPhone": 100, "repairStationNumber": 100,
+	"mechanicName": 200, "mechanicCertificate": 100, "workOrderNumber": 100,
+}
+
+// patchDateLayouts are the entryDate formats accepted; all are stored as
+// YYYY-MM-DD.
+var patchDateLayouts = []string{"2006-01-02", "01/02/2006", time.RFC3339}
+
+// validatePatchField checks a patched value against its column's type and
+// returns it normalized for the UPDATE, or a reason it was rejected.
+func validatePatchField(field string, v any) (any, string) {
+	switch {
+	case patchHourFields[field]:
+		if v == nil {
+			return nil, ""
+		}
+		var f float64
+		switch n := v.(type) {
+		case float64:
+			f = n
+		case string:
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+			if err != nil {
+				return nil, "must be a number"
+			}
+			f = parsed
+		default:
+			return nil, "must be a number"
+		}
+		if math.IsNaN(f) || f < 0 || f > maxPatchHours {
+			return nil, fmt.Sprintf("must be between 0 and %.1f", maxPatchHours)
+		}
+		return f, ""
+
+	case field == "entryDate":
+		if str, ok := v.(string); ok {
+			for _, layout := range patchDateLayouts {
+				if t, err := time.Parse(layout, strings.TrimSpace(str)); err == nil {
+					return t.Format("2006-01-02"), ""
+				}
+			}
+		}
+		return nil, "must be a date (YYYY-MM-DD)"
+
+	case field == "entryType":
+		return validateEnum(v, models.ValidEntryTypes)
+	case field == "inspectionType":
+		return validateEnum(v, models.ValidInspectionTypes)
+
+	case field == "maintenanceNarrative":
+		if str, ok := v.(string); ok && strings.TrimSpace(str) != "" {
+			return str, ""
+		}
+		return nil, "must be a non-empty string"
+	}
+
+	if v == nil {
+		return nil, ""
+	}
+	str, ok := v.(string)
+	if !ok {
+		return nil, "must be a string or null"
+	}
+	if limit := patchMaxLengths[field]; limit > 0 && utf8.RuneCountInString(str) > limit {
+		return nil, fmt.Sprintf("must be at most %d characters", limit)
+	}
+	return str, ""
+}
+
+// validateEnum accepts v only if it is one of the allowed strings.
+func validateEnum(v any, allowed map[string]bool) (any, string) {
+	if str, ok := v.(string); ok && allowed[str] {
+		return str, ""
+	}
+	return nil, "must be one of " + strings.Join(sortedKeys(allowed), ", ")
+}
+
+// sortedKeys returns m's keys in order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (h *Handler) handleUpdateEntry(ctx context.Context, tailNumber, entryID string, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	// The UPDATE runs through Query and the response re-reads the entry.
+	ctx = db.WithPrimary(ctx)
+	aid, notFound, err := h.getAircraftID(ctx, tailNumber)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	if notFound != nil {
+		return *notFound, nil
+	}
 
-	failedPages, _ := toInt64(row["failed_pages"])
-	if failedPages > 0 {
-		failedRows, err := h.db.Query(ctx,
-			`SELECT page_number FROM upload_pages
-			 WHERE document_id = $1 AND extraction_status = 'failed'
-			 ORDER BY page_number`, batchID)
-		if err == nil {
-			var nums []any
-			for _, r := range failedRows {
-				nums = append(nums, r["page_number"])
-			}
-			result["failedPageNumbers"] = nums
+	var body map[string]any
+	if err := json.Unmarshal([]byte(event.Body), &body); err != nil || len(body) == 0 {
+		return errResponse(400, codeValidation, "Request body is required")
+	}
+
+	reviewStatus, _ := body["reviewStatus"].(string)
+	reviewedBy, _ := body["reviewedBy"].(string)
+
+	if reviewStatus != "" && reviewStatus != "approved" && reviewStatus != "corrected" && reviewStatus != "rejected" {
+		return errResponse(400, codeValidation, "reviewStatus must be approved, corrected, or rejected")
+	}
+
+	// Validate every field before writing any, so a bad value can't leave
+	// the entry half-updated or surface as a database error.
+	// inspectionType lives on the entry's inspection record rather than the
+	// entry itself.
+	patch := map[string]any{}
+	invalid := map[string]string{}
+	for _, camel := range append(sortedKeys(patchableFields), "inspectionType") {
+		v, ok := body[camel]
+		if !ok {
+			continue
+		}
+		val, reason := validatePatchField(camel, v)
+		if reason != "" {
+			invalid[camel] = reason
+			continue
 		}
+		patch[camel] = val
+	}
+	if len(invalid) > 0 {
+		return (&apiError{
+			Status:  400,
+			Code:    codeValidation,
+			Message: "Invalid fields: " + strings.Join(sortedKeys(invalid), ", "),
+			Fields:  invalid,
+		}).response()
 	}
 
-	return models.APIResponse(200, result)
-}
+	var setClauses []string
+	var values []any
+	argIdx := 1
+	// revised lists the API field and column of everything the UPDATE
+	// changes, for the revision snapshot.
+	var revised [][2]string
 
-// ─── GET /uploads/{id}/pages/{pageNumber}/image ────────────────────────────
+	for camel, col := range patchableFields {
+		if v, ok := patch[camel]; ok {
+			setClauses = append(setClauses, fmt.Sprintf("%s = $%d", col, argIdx))
+			values = append(values, v)
+			argIdx++
+			revised = append(revised, [2]string{camel, col})
+		}
+	}
 
-func (h *Handler) handlePageImage(ctx context.Context, batchID, pageNumber string) (events.APIGatewayProxyResponse, error) {
+	if reviewStatus != "" {
+		setClauses = append(setClauses, fmt.Sprintf("review_status = $%d", argIdx))
+		values = append(values, reviewStatus)
+		argIdx++
+		revised = append(revised, [2]string{"reviewStatus", "review_status"})
+		setClauses = append(setClauses, "reviewed_at = NOW()")
+		if reviewedBy != "" {
+			setClauses = append(setClauses, fmt.Sprintf("reviewed_by = $%d", argIdx))
+			values = append(values, reviewedBy)
+			argIdx++
+			revised = append(revised, [2]string{"reviewedBy", "reviewed_by"})
+		}
+		if reviewStatus == "approved" || reviewStatus == "rejected" {
+			setClauses = append(setClauses, "needs_review = FALSE")
+			revised = append(revised, [2]string{"needsReview", "needs_review"})
+		}
+	}
+
+	inspectionType, hasInspectionType := patch["inspectionType"]
+	if len(setClauses) == 0 && !hasInspectionType {
+		return errResponse(400, codeValidation, "No fields to update")
+	}
+
+	setClauses = append(setClauses, "updated_at = NOW()")
+
+	var previous, updated []string
+	for _, r := range revised {
+		previous = append(previous, fmt.Sprintf("'%s', p.%s", r[0], r[1]))
+		updated = append(updated, fmt.Sprintf("'%s', u.%s", r[0], r[1]))
+	}
+	if hasInspectionType {
+		previous = append(previous,
+			"'inspectionType', (SELECT inspection_type FROM inspection_records WHERE entry_id = p.id LIMIT 1)")
+		updated = append(updated, fmt.Sprintf("'inspectionType', $%d::text", argIdx))
+		values = append(values, inspectionType)
+		argIdx++
+	}
+
+	var revisedBy any
+	if reviewedBy != "" {
+		revisedBy = reviewedBy
+	}
+	values = append(values, entryID, aid, revisedBy)
+
+	// The prior values are captured and the revision written in the same
+	// statement as the UPDATE, so a concurrent edit can't slip between
+	// them. FOR UPDATE makes prior wait for, and then read, any edit
+	// committed ahead of this one.
 	rows, err := h.db.Query(ctx,
-		`SELECT image_path FROM upload_pages WHERE document_id = $1 AND page_number = $2`,
-		batchID, pageNumber)
+		fmt.Sprintf(`WITH prior AS (
+			SELECT * FROM maintenance_entries WHERE id = $%[2]d AND aircraft_id = $%[3]d FOR UPDATE
+		), updated AS (
+			UPDATE maintenance_entries SET %[1]s WHERE id = $%[2]d AND aircraft_id = $%[3]d RETURNING *
+		), revision AS (
+			INSERT INTO entry_revisions (entry_id, aircraft_id, previous_values, new_values, revised_by)
+			SELECT u.id, u.aircraft_id, jsonb_build_object(%[5]s), jsonb_build_object(%[6]s), $%[4]d::text
+			FROM prior p JOIN updated u ON u.id = p.id
+		)
+		SELECT id FROM updated`,
+			strings.Join(setClauses, ", "), argIdx, argIdx+1, argIdx+2,
+			strings.Join(previous, ", "), strings.Join(updated, ", ")),
+		values...)
 	if err != nil {
 		return events.APIGatewayProxyResponse{}, err
 	}
 	if len(rows) == 0 {
-		return errResponse(404, "Page not found")
+		return errResponse(404, codeEntryNotFound, "Entry not found")
 	}
 
-	imagePath := fmt.Sprintf("%v", rows[0]["image_path"])
-	imageURL, err := h.s3.PresignGetObject(ctx, h.bucket, imagePath, time.Hour)
-	if err != nil {
-		return events.APIGatewayProxyResponse{}, err
+	if hasInspectionType {
+		if err := h.db.Exec(ctx,
+			`UPDATE inspection_records SET inspection_type = $1 WHERE entry_id = $2 AND aircraft_id = $3`,
+			inspectionType, entryID, aid); err != nil {
+			return events.APIGatewayProxyResponse{}, fmt.Errorf("update inspection type: %w", err)
+		}
 	}
 
-	return models.APIResponse(200, map[string]any{
-		"uploadId":   batchID,
-		"pageNumber": pageNumber,
-		"imageUrl":   imageURL,
-	})
+	return h.handleEntryDetail(ctx, tailNumber, entryID)
 }
 
-// ─── GET /aircraft/{tailNumber}/uploads ─────────────────────────────────────
+// ─── GET /aircraft/{tailNumber}/entries/{entryId}/history ───────────────────
+
+// handleEntryHistory lists the entry's revisions newest-first. Each holds the
+// values of the fields an edit changed, before and after, keyed by API field
+// name.
+func (h *Handler) handleEntryHistory(ctx context.Context, tailNumber, entryID string) (events.APIGatewayProxyResponse, error) {
+	aid, notFound, err := h.getAircraftID(ctx, tailNumber)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	if notFound != nil {
+		return *notFound, nil
+	}
+
+	entries, err := h.db.Query(ctx,
+		"SELECT id FROM maintenance_entries WHERE id = $1 AND aircraft_id = $2", entryID, aid)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	if len(entries) == 0 {
+		return errResponse(404, codeEntryNotFound, "Entry not found")
+	}
 
-func (h *Handler) handleListUploads(ctx context.Context, tailNumber string) (events.APIGatewayProxyResponse, error) {
-	tail := strings.ToUpper(tailNumber)
 	rows, err := h.db.Query(ctx,
-		`SELECT ub.id, ub.logbook_type, ub.upload_type, ub.source_filename,
-		        ub.processing_status, ub.page_count, ub.date_range_start,
-		        ub.date_range_end, ub.created_at
-		 FROM upload_batches ub
-		 JOIN aircraft a ON ub.aircraft_id = a.id
-		 WHERE a.registration = $1
-		 ORDER BY ub.created_at DESC`, tail)
+		`SELECT id, previous_values, new_values, revised_by, created_at
+		 FROM entry_revisions
+		 WHERE entry_id = $1 AND aircraft_id = $2
+		 ORDER BY created_at DESC, id DESC`,
+		entryID, aid)
 	if err != nil {
 		return events.APIGatewayProxyResponse{}, err
 	}
 
+	revisions := make([]map[string]any, 0, len(rows))
+	for _, r := range rows {
+		revisions = append(revisions, map[string]any{
+			"id":             r["id"],
+			"reviewedBy":     r["revised_by"],
+			"revisedAt":      r["created_at"],
+			"previousValues": r["previous_values"],
+			"newValues":      r["new_values"],
+		})
+	}
+
 	return models.APIResponse(200, map[string]any{
-		"tailNumber": tail,
-		"uploads":    rows,
+		"entryId":   entryID,
+		"revisions": revisions,
 	})
 }
 
-// ─── GET /aircraft/{tailNumber}/summary ─────────────────────────────────────
+// ─── GET /aircraft/{tailNumber}/entries/{entryId}/similar ───────────────────
 
-func (h *Handler) handleSummary(ctx context.Context, tailNumber string) (events.APIGatewayProxyResponse, error) {
-	tail := strings.ToUpper(tailNumber)
+const (
+	defaultSimilarEntries = 5
+	maxSimilarEntries     = 20
+)
+
+// handleSimilarEntries finds the aircraft's other entries whose narrative
+// embeddings are nearest the entry's own, most similar first. An entry with
+// no embedding (its narrative was too short to embed) has no neighbours; the
+// response says why instead of failing.
+func (h *Handler) handleSimilarEntries(ctx context.Context, tailNumber, entryID string, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	limit := defaultSimilarEntries
+	if raw := event.QueryStringParameters["limit"]; raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v <= 0 || v > maxSimilarEntries {
+			return errResponse(400, codeValidation, fmt.Sprintf("limit must be an integer from 1 to %d", maxSimilarEntries))
+		}
+		limit = v
+	}
 
-	aircraft, err := h.db.Query(ctx, "SELECT * FROM aircraft WHERE registration = $1", tail)
+	aid, notFound, err := h.getAircraftID(ctx, tailNumber)
 	if err != nil {
 		return events.APIGatewayProxyResponse{}, err
 	}
-	if len(aircraft) == 0 {
-		return errResponse(404, fmt.Sprintf("Aircraft %s not found", tail))
+	if notFound != nil {
+		return *notFound, nil
 	}
-	aid := fmt.Sprintf("%v", aircraft[0]["id"])
-
-	annual, _ := h.db.Query(ctx,
-		`SELECT me.entry_date, me.flight_time
-		 FROM inspection_records ir
-		 JOIN maintenance_entries me ON ir.entry_id = me.id
-		 WHERE ir.aircraft_id = $1 AND ir.inspection_type = 'annual'
-		 ORDER BY ir.inspection_date DESC LIMIT 1`, aid)
-
-	hundredhr, _ := h.db.Query(ctx,
-		`SELECT me.entry_date, me.flight_time
-		 FROM inspection_records ir
-		 JOIN maintenance_entries me ON ir.entry_id = me.id
-		 WHERE ir.aircraft_id = $1 AND ir.inspection_type = '100hr'
-		 ORDER BY ir.inspection_date DESC LIMIT 1`, aid)
-
-	oil, _ := h.db.Query(ctx,
-		`SELECT entry_date, flight_time FROM maintenance_entries
-		 WHERE aircraft_id = $1
-		   AND (lower(maintenance_narrative) LIKE '%%oil change%%'
-		        OR lower(maintenance_narrative) LIKE '%%oil filter%%')
-		 ORDER BY entry_date DESC LIMIT 1`, aid)
-
-	tt, _ := h.db.Query(ctx,
-		`SELECT flight_time FROM maintenance_entries
-		 WHERE aircraft_id = $1 AND flight_time IS NOT NULL
-		 ORDER BY entry_date DESC LIMIT 1`, aid)
 
-	expirations, _ := h.db.Query(ctx,
-		`SELECT 'life_limited_part' AS type, part_name AS name, expiration_date
-		 FROM life_limited_parts WHERE aircraft_id = $1 AND is_active = TRUE
-		   AND expiration_date IS NOT NULL AND expiration_date <= CURRENT_DATE + INTERVAL '90 days'
-		 UNION ALL
-		 SELECT inspection_type AS type, inspection_type || ' inspection' AS name, next_due_date AS expiration_date
-		 FROM inspection_records WHERE aircraft_id = $1
-		   AND next_due_date IS NOT NULL AND next_due_date <= CURRENT_DATE + INTERVAL '90 days'
-		 ORDER BY expiration_date`, aid, aid)
+	// Only embeddings from the same model are comparable.
+	rows, err := h.db.Query(ctx,
+		`SELECT m.id, emb.embedding::text AS embedding
+		 FROM maintenance_entries m
+		 LEFT JOIN maintenance_embeddings emb
+		   ON emb.entry_id = m.id AND emb.chunk_type = 'narrative' AND emb.model = $3
+		 WHERE m.id = $1 AND m.aircraft_id = $2`,
+		entryID, aid, h.embedding.ModelName())
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, vectorSearchError(err)
+	}
+	if len(rows) == 0 {
+		return errResponse(404, codeEntryNotFound, "Entry not found")
+	}
+	embedding, _ := rows[0]["embedding"].(string)
+	if embedding == "" {
+		return models.APIResponse(200, map[string]any{
+			"tailNumber": strings.ToUpper(tailNumber),
+			"entryId":    entryID,
+			"similar":    []any{},
+			"reason":     "Entry has no narrative embedding",
+		})
+	}
 
-	result := map[string]any{
-		"tailNumber":          tail,
-		"aircraft":            aircraft[0],
-		"lastAnnual":          firstOrNil(annual),
-		"last100hr":           firstOrNil(hundredhr),
-		"lastOilChange":       firstOrNil(oil),
-		"totalTime":           nil,
-		"upcomingExpirations": expirations,
+	results, err := h.db.Query(ctx,
+		`SELECT me.entry_id, me.chunk_text,
+		        m.entry_date, m.entry_type, ir.inspection_type,
+		        1 - (me.embedding <=> $1::halfvec) AS similarity
+		 FROM maintenance_embeddings me
+		 JOIN maintenance_entries m ON me.entry_id = m.id
+		 LEFT JOIN inspection_records ir ON ir.entry_id = m.id
+		 WHERE m.aircraft_id = $2 AND me.model = $3
+		   AND me.chunk_type = 'narrative' AND me.entry_id <> $4
+		   AND m.superseded_by IS NULL
+		 ORDER BY me.embedding <=> $1::halfvec
+		 LIMIT $5`, embedding, aid, h.embedding.ModelName(), entryID, limit)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, vectorSearchError(err)
 	}
 
-	if len(tt) > 0 {
-		result["totalTime"] = tt[0]["flight_time"]
+	similar := make([]map[string]any, 0, len(results))
+	for _, r := range results {
+		similar = append(similar, map[string]any{
+			"entryId":        fmt.Sprintf("%v", r["entry_id"]),
+			"snippet":        snippet(fmt.Sprintf("%v", r["chunk_text"]), querySnippetLength),
+			"date":           fmt.Sprintf("%v", r["entry_date"]),
+			"type":           r["entry_type"],
+			"inspectionType": r["inspection_type"],
+			"similarity":     r["similarity"],
+		})
 	}
 
-	return models.APIResponse(200, result)
+	return models.APIResponse(200, map[string]any{
+		"tailNumber": strings.ToUpper(tailNumber),
+		"entryId":    entryID,
+		"similar":    similar,
+	})
 }
 
-// ─── POST /aircraft/{tailNumber}/query ──────────────────────────────────────
+// ─── POST /aircraft/{tailNumber}/find-similar ──────────────────────────────
 
-func (h *Handler) handleQuery(ctx context.Context, tailNumber string, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+// handleFindSimilar finds the aircraft's entries whose narratives are nearest
+// a free-text description of work, most similar first, each with the parts
+// it recorded. Unlike the query endpoint it returns the entries themselves
+// rather than a generated answer, for planning a job from past ones.
+// Entries superseded by a re-upload are left out.
+func (h *Handler) handleFindSimilar(ctx context.Context, tailNumber string, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	var body struct {
-		Question string `json:"question"`
+		Text  string `json:"text"`
+		Limit *int   `json:"limit"`
 	}
-	if err := json.Unmarshal([]byte(event.Body), &body); err != nil || strings.TrimSpace(body.Question) == "" {
-		return errResponse(400, "question is required")
+	if err := json.Unmarshal([]byte(event.Body), &body); err != nil {
+		return errResponse(400, codeInvalidRequest, "invalid request body")
+	}
+	if strings.TrimSpace(body.Text) == "" {
+		return errResponse(400, codeValidation, "text is required")
+	}
+	limit := defaultSimilarEntries
+	if body.Limit != nil {
+		if *body.Limit <= 0 || *body.Limit > maxSimilarEntries {
+			return errResponse(400, codeValidation, fmt.Sprintf("limit must be an integer from 1 to %d", maxSimilarEntries))
+		}
+		limit = *body.Limit
 	}
 
 	tail := strings.ToUpper(tailNumber)
@@ -503,99 +3284,242 @@ func (h *Handler) handleQuery(ctx context.Context, tailNumber string, event even
 	if err != nil {
 		return events.APIGatewayProxyResponse{}, err
 	}
-
-	// Generate embedding for the question
-	embedding, err := geminiClient.EmbedContent(ctx, "gemini-embedding-001", body.Question)
+	embedding, err := h.embedding.Embed(ctx, geminiClient, body.Text)
 	if err != nil {
-		return events.APIGatewayProxyResponse{}, fmt.Errorf("embed question: %w", err)
+		return events.APIGatewayProxyResponse{}, fmt.Errorf("embed text: %w", err)
 	}
 
-	embeddingStr := formatEmbedding(embedding)
-
+	// Only embeddings from the same model are comparable with the text's.
 	results, err := h.db.Query(ctx,
-		`SELECT me.chunk_text, me.chunk_type,
-		        m.entry_date, m.entry_type, m.maintenance_narrative,
-		        ir.inspection_type,
+		`SELECT m.id, m.entry_date, m.entry_type, m.maintenance_narrative,
+		        m.flight_time, m.shop_name, m.mechanic_name, ir.inspection_type,
 		        1 - (me.embedding <=> $1::halfvec) AS similarity
 		 FROM maintenance_embeddings me
 		 JOIN maintenance_entries m ON me.entry_id = m.id
 		 LEFT JOIN inspection_records ir ON ir.entry_id = m.id
-		 WHERE m.aircraft_id = $2
+		 WHERE m.aircraft_id = $2 AND me.model = $3
+		   AND me.chunk_type = 'narrative' AND m.superseded_by IS NULL
 		 ORDER BY me.embedding <=> $1::halfvec
-		 LIMIT 10`, embeddingStr, aid)
+		 LIMIT $4`, gemini.FormatEmbedding(embedding), aid, h.embedding.ModelName(), limit)
 	if err != nil {
-		return events.APIGatewayProxyResponse{}, err
+		return events.APIGatewayProxyResponse{}, vectorSearchError(err)
 	}
 
-	if len(results) == 0 {
-		return models.APIResponse(200, map[string]any{
-			"tailNumber": tail,
-			"question":   body.Question,
-			"answer":     "No maintenance records found for this aircraft.",
-			"sources":    []any{},
-		})
+	entries := make([]map[string]any, 0, len(results))
+	byID := make(map[string]map[string]any, len(results))
+	ids := make([]string, 0, len(results))
+	for _, r := range results {
+		id := fmt.Sprintf("%v", r["id"])
+		entry := map[string]any{
+			"entryId":        id,
+			"date":           fmt.Sprintf("%v", r["entry_date"]),
+			"type":           r["entry_type"],
+			"inspectionType": r["inspection_type"],
+			"narrative":      r["maintenance_narrative"],
+			"flightTime":     r["flight_time"],
+			"shopName":       r["shop_name"],
+			"mechanicName":   r["mechanic_name"],
+			"similarity":     r["similarity"],
+			"partsActions":   []map[string]any{},
+		}
+		entries = append(entries, entry)
+		byID[id] = entry
+		ids = append(ids, id)
 	}
 
-	// Build context for Gemini
-	var contextParts []string
-	for _, r := range results {
-		label := fmt.Sprintf("%v", r["entry_type"])
-		if it, ok := r["inspection_type"]; ok && it != nil {
-			label = fmt.Sprintf("%s/%v", label, it)
+	if len(ids) > 0 {
+		parts, err := h.db.Query(ctx,
+			`SELECT entry_id, action_type, part_name, part_number, serial_number,
+			        old_part_number, old_serial_number, quantity, notes
+			 FROM parts_actions WHERE entry_id = ANY($1::uuid[])
+			 ORDER BY created_at`, ids)
+		if err != nil {
+			return events.APIGatewayProxyResponse{}, fmt.Errorf("get parts actions: %w", err)
+		}
+		for _, p := range parts {
+			entry, ok := byID[fmt.Sprintf("%v", p["entry_id"])]
+			if !ok {
+				continue
+			}
+			delete(p, "entry_id")
+			entry["partsActions"] = append(entry["partsActions"].([]map[string]any), p)
 		}
-		contextParts = append(contextParts,
-			fmt.Sprintf("[%v] (%s) %v", r["entry_date"], label, r["maintenance_narrative"]))
 	}
-	contextText := strings.Join(contextParts, "\n---\n")
 
-	ragPrompt := fmt.Sprintf(`You are an aircraft maintenance expert assistant. Answer the question based ONLY on the maintenance records provided below.
+	return models.APIResponse(200, map[string]any{
+		"tailNumber": tail,
+		"text":       body.Text,
+		"entries":    entries,
+	})
+}
 
-Aircraft: %s
+// ─── POST /aircraft/{tailNumber}/entries/{entryId}/recheck ──────────────────
 
-MAINTENANCE RECORDS:
-%s
+// handleRecheckEntry re-runs QA verification for a stored entry against the
+// slice image it was extracted from, without re-extracting. The entry is sent
+// to the QA model in the same JSON shape the extraction model produced, and
+// needs_review/extraction_notes are updated from the verdict.
+func (h *Handler) handleRecheckEntry(ctx context.Context, tailNumber, entryID string) (events.APIGatewayProxyResponse, error) {
+	aid, notFound, err := h.getAircraftID(ctx, tailNumber)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	if notFound != nil {
+		return *notFound, nil
+	}
+
+	rows, err := h.db.Query(ctx,
+		`SELECT me.slice_key, me.page_id::text AS page_id, me.needs_review,
+		        to_char(me.entry_date, 'YYYY-MM-DD') AS "date",
+		        me.entry_type AS "entryType",
+		        ir.inspection_type AS "inspectionType",
+		        ir.far_reference AS "farReference",
+		        me.hobbs_time::float8 AS "hobbsTime",
+		        me.tach_time::float8 AS "tachTime",
+		        me.flight_time::float8 AS "flightTime",
+		        me.time_since_overhaul::float8 AS "timeSinceOverhaul",
+		        me.shop_name AS "shopName",
+		        me.shop_address AS "shopAddress",
+		        me.shop_phone AS "shopPhone",
+		        me.repair_station_number AS "repairStationNumber",
+		        me.mechanic_name AS "mechanicName",
+		        me.mechanic_certificate AS "mechanicCertificate",
+		        me.work_order_number AS "workOrderNumber",
+		        me.maintenance_narrative AS "maintenanceNarrative"
+		 FROM maintenance_entries me
+		 LEFT JOIN inspection_records ir ON ir.entry_id = me.id
+		 WHERE me.id = $1 AND me.aircraft_id = $2`,
+		entryID, aid)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	if len(rows) == 0 {
+		return errResponse(404, codeEntryNotFound, "Entry not found")
+	}
+
+	entry := rows[0]
+	sliceKey, _ := entry["slice_key"].(string)
+	if sliceKey == "" {
+		return errResponse(409, codeNoSliceImage, "Entry has no slice image to verify against")
+	}
+	pageID, _ := entry["page_id"].(string)
+	flagged, _ := entry["needs_review"].(bool)
+	delete(entry, "slice_key")
+	delete(entry, "page_id")
+	delete(entry, "needs_review")
+
+	parts, err := h.db.Query(ctx,
+		`SELECT action_type AS "action", part_name AS "partName", part_number AS "partNumber",
+		        serial_number AS "serialNumber", old_part_number AS "oldPartNumber",
+		        old_serial_number AS "oldSerialNumber", quantity, notes
+		 FROM parts_actions WHERE entry_id = $1 ORDER BY created_at`, entryID)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	ads, err := h.db.Query(ctx,
+		`SELECT COALESCE(ad_number_raw, ad_number) AS "adNumber", compliance_method AS "method", notes
+		 FROM ad_compliance WHERE entry_id = $1 ORDER BY compliance_date`, entryID)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	entry["partsActions"] = parts
+	entry["adCompliance"] = ads
+
+	extractionJSON, err := json.Marshal([]map[string]any{entry})
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, fmt.Errorf("marshal entry for QA: %w", err)
+	}
+
+	reader, err := h.s3.GetObject(ctx, h.bucket, sliceKey)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, fmt.Errorf("download slice: %w", err)
+	}
+	imageData, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, fmt.Errorf("read slice: %w", err)
+	}
+
+	geminiClient, err := h.getGeminiClient(ctx)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	claudeClient, err := h.getClaudeClient(ctx)
+	if err != nil {
+		log.Printf("WARNING: Claude unavailable for recheck, using Gemini: %v", err)
+		claudeClient = nil
+	}
 
-QUESTION: %s
+	report, err := qa.Verify(ctx, claudeClient, geminiClient, imageData, sliceMIMEType(sliceKey), extractionJSON)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, fmt.Errorf("verify entry: %w", err)
+	}
 
-Provide a clear, accurate answer. Cite specific dates and entries. If the records don't contain enough information, say so.`, tail, contextText, body.Question)
+	// Only one entry was sent; a report without its verdict is inconclusive.
+	result := qa.Result{Verdict: qa.NeedsReview, Summary: "QA returned no verdict for this entry"}
+	for _, r := range report.Results {
+		if r.EntryIndex == 0 {
+			result = r
+			break
+		}
+	}
 
-	temp := float32(0.2)
-	answer, err := geminiClient.GenerateContent(ctx, "gemini-2.5-flash", []gemini.Part{
-		{Text: ragPrompt},
-	}, &gemini.GenerateConfig{Temperature: &temp})
-	if err != nil {
-		return events.APIGatewayProxyResponse{}, fmt.Errorf("generate answer: %w", err)
+	needsReview := result.Verdict != qa.Pass
+	note := ""
+	switch result.Verdict {
+	case qa.Pass:
+	case qa.Fail:
+		note = "QA recheck fail: " + result.Summary + ". "
+	default:
+		note = "QA recheck: " + result.Summary + ". "
 	}
 
-	// Build sources (top 5)
-	limit := 5
-	if len(results) < limit {
-		limit = len(results)
+	// A pass only means this check found nothing; flags raised by other
+	// checks stay.
+	if err := h.db.Exec(ctx,
+		`UPDATE maintenance_entries
+		 SET needs_review = needs_review OR $1,
+		     extraction_notes = CASE WHEN $2 = '' THEN extraction_notes ELSE COALESCE(extraction_notes, '') || $2 END,
+		     updated_at = NOW()
+		 WHERE id = $3`,
+		needsReview, note, entryID); err != nil {
+		return events.APIGatewayProxyResponse{}, err
 	}
-	var sources []map[string]any
-	for _, r := range results[:limit] {
-		source := map[string]any{
-			"date":           fmt.Sprintf("%v", r["entry_date"]),
-			"type":           r["entry_type"],
-			"inspectionType": r["inspection_type"],
+	if needsReview && pageID != "" {
+		if err := models.RefreshPageReview(ctx, h.db, pageID); err != nil {
+			return events.APIGatewayProxyResponse{}, fmt.Errorf("refresh page review: %w", err)
 		}
-		if sim, ok := r["similarity"]; ok {
-			source["similarity"] = sim
-		}
-		sources = append(sources, source)
 	}
 
+	issues := result.Issues
+	if issues == nil {
+		issues = []qa.FieldIssue{}
+	}
 	return models.APIResponse(200, map[string]any{
-		"tailNumber": tail,
-		"question":   body.Question,
-		"answer":     answer,
-		"sources":    sources,
+		"tailNumber":  strings.ToUpper(tailNumber),
+		"entryId":     entryID,
+		"verdict":     result.Verdict,
+		"summary":     result.Summary,
+		"issues":      issues,
+		"needsReview": needsReview || flagged,
 	})
 }
 
-// ─── GET /aircraft/{tailNumber}/entries ──────────────────────────────────────
+// sliceMIMEType returns the content type of a stored slice image from its key.
+func sliceMIMEType(key string) string {
+	switch strings.ToLower(filepath.Ext(key)) {
+	case ".png":
+		return "image/png"
+	case ".webp":
+		return "image/webp"
+	default:
+		return "image/jpeg"
+	}
+}
 
-func (h *Handler) handleEntries(ctx context.Context, tailNumber string, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+// ─── GET /aircraft/{tailNumber}/inspections ─────────────────────────────────
+
+func (h *Handler) handleInspections(ctx context.Context, tailNumber string, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	aid, notFound, err := h.getAircraftID(ctx, tailNumber)
 	if err != nil {
 		return events.APIGatewayProxyResponse{}, err
@@ -605,38 +3529,30 @@ func (h *Handler) handleEntries(ctx context.Context, tailNumber string, event ev
 	}
 
 	qp := models.ParseQueryParams(event)
-	entryType := qp.Params["type"]
-	dateFrom := qp.Params["dateFrom"]
-	dateTo := qp.Params["dateTo"]
-	needsReview := qp.Params["needsReview"]
+	inspectionType := qp.Params["type"]
 
-	whereClauses := []string{"me.aircraft_id = $1"}
+	orderBy, badSort := resolveSort(qp.Params["sort"], inspectionSorts)
+	if badSort != nil {
+		return *badSort, nil
+	}
+
+	whereClauses := []string{"ir.aircraft_id = $1", "me.superseded_by IS NULL"}
 	args := []any{aid}
 	argIdx := 2
 
-	if entryType != "" {
-		whereClauses = append(whereClauses, fmt.Sprintf("me.entry_type = $%d", argIdx))
-		args = append(args, entryType)
-		argIdx++
-	}
-	if dateFrom != "" {
-		whereClauses = append(whereClauses, fmt.Sprintf("me.entry_date >= $%d", argIdx))
-		args = append(args, dateFrom)
-		argIdx++
-	}
-	if dateTo != "" {
-		whereClauses = append(whereClauses, fmt.Sprintf("me.entry_date <= $%d", argIdx))
-		args = append(args, dateTo)
+	if inspectionType != "" {
+		whereClauses = append(whereClauses, fmt.Sprintf("ir.inspection_type = $%d", argIdx))
+		args = append(args, inspectionType)
 		argIdx++
 	}
-	if strings.EqualFold(needsReview, "true") {
-		whereClauses = append(whereClauses, "me.needs_review = TRUE")
-	}
 
 	whereSQL := strings.Join(whereClauses, " AND ")
 
 	countRows, err := h.db.Query(ctx,
-		fmt.Sprintf("SELECT COUNT(*) AS total FROM maintenance_entries me WHERE %s", whereSQL),
+		fmt.Sprintf(`SELECT COUNT(*) AS total
+		 FROM inspection_records ir
+		 LEFT JOIN maintenance_entries me ON ir.entry_id = me.id
+		 WHERE %s`, whereSQL),
 		args...)
 	if err != nil {
 		return events.APIGatewayProxyResponse{}, err
@@ -644,32 +3560,40 @@ func (h *Handler) handleEntries(ctx context.Context, tailNumber string, event ev
 	total, _ := toInt(countRows[0]["total"])
 
 	queryArgs := append(args, qp.Limit, qp.Offset)
-	entries, err := h.db.Query(ctx,
-		fmt.Sprintf(`SELECT me.id, me.entry_type, me.entry_date, me.hobbs_time, me.tach_time,
-		        me.flight_time, me.shop_name, me.mechanic_name,
-		        me.maintenance_narrative, me.confidence_score, me.needs_review,
-		        me.review_status, me.missing_data, me.extraction_notes,
-		        ir.inspection_type
-		 FROM maintenance_entries me
-		 LEFT JOIN inspection_records ir ON ir.entry_id = me.id
+	inspections, err := h.db.Query(ctx,
+		fmt.Sprintf(`SELECT ir.id, ir.inspection_type, ir.inspection_date, ir.aircraft_hours,
+		        ir.next_due_date, ir.next_due_hours, ir.far_reference,
+		        ir.inspector_name, ir.inspector_certificate, ir.notes,
+		        me.maintenance_narrative, me.shop_name
+		 FROM inspection_records ir
+		 LEFT JOIN maintenance_entries me ON ir.entry_id = me.id
 		 WHERE %s
-		 ORDER BY me.entry_date DESC
-		 LIMIT $%d OFFSET $%d`, whereSQL, argIdx, argIdx+1),
+		 ORDER BY %s
+		 LIMIT $%d OFFSET $%d`, whereSQL, orderBy, argIdx, argIdx+1),
 		queryArgs...)
 	if err != nil {
 		return events.APIGatewayProxyResponse{}, err
 	}
 
+	latestByType, _ := h.db.Query(ctx,
+		`SELECT DISTINCT ON (ir.inspection_type)
+		        ir.inspection_type, ir.inspection_date, ir.next_due_date, ir.next_due_hours
+		 FROM inspection_records ir
+		 LEFT JOIN maintenance_entries me ON ir.entry_id = me.id
+		 WHERE ir.aircraft_id = $1 AND me.superseded_by IS NULL
+		 ORDER BY ir.inspection_type, ir.inspection_date DESC`, aid)
+
 	return models.APIResponse(200, map[string]any{
-		"tailNumber": strings.ToUpper(tailNumber),
-		"entries":    entries,
-		"pagination": models.NewPagination(total, qp.Page, qp.Limit),
+		"tailNumber":   strings.ToUpper(tailNumber),
+		"inspections":  inspections,
+		"latestByType": latestByType,
+		"pagination":   models.NewPagination(total, qp.Page, qp.Limit),
 	})
 }
 
-// ─── GET /aircraft/{tailNumber}/entries/{entryId} ───────────────────────────
+// ─── GET /aircraft/{tailNumber}/ads ─────────────────────────────────────────
 
-func (h *Handler) handleEntryDetail(ctx context.Context, tailNumber, entryID string) (events.APIGatewayProxyResponse, error) {
+func (h *Handler) handleAds(ctx context.Context, tailNumber string, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
 	aid, notFound, err := h.getAircraftID(ctx, tailNumber)
 	if err != nil {
 		return events.APIGatewayProxyResponse{}, err
@@ -678,59 +3602,76 @@ func (h *Handler) handleEntryDetail(ctx context.Context, tailNumber, entryID str
 		return *notFound, nil
 	}
 
-	entries, err := h.db.Query(ctx,
-		"SELECT me.* FROM maintenance_entries me WHERE me.id = $1 AND me.aircraft_id = $2",
-		entryID, aid)
+	qp := models.ParseQueryParams(event)
+
+	orderBy, badSort := resolveSort(qp.Params["sort"], adSorts)
+	if badSort != nil {
+		return *badSort, nil
+	}
+
+	countRows, err := h.db.Query(ctx,
+		`SELECT COUNT(*) AS total
+		 FROM ad_compliance ad
+		 LEFT JOIN maintenance_entries me ON ad.entry_id = me.id
+		 WHERE ad.aircraft_id = $1 AND me.superseded_by IS NULL`, aid)
 	if err != nil {
 		return events.APIGatewayProxyResponse{}, err
 	}
-	if len(entries) == 0 {
-		return errResponse(404, "Entry not found")
-	}
-
-	entry := entries[0]
-
-	parts, _ := h.db.Query(ctx,
-		"SELECT * FROM parts_actions WHERE entry_id = $1 ORDER BY created_at", entryID)
-	ads, _ := h.db.Query(ctx,
-		"SELECT * FROM ad_compliance WHERE entry_id = $1 ORDER BY compliance_date", entryID)
-	inspections, _ := h.db.Query(ctx,
-		"SELECT * FROM inspection_records WHERE entry_id = $1", entryID)
+	total, _ := toInt(countRows[0]["total"])
 
-	entry["partsActions"] = parts
-	entry["adCompliance"] = ads
-	if len(inspections) > 0 {
-		entry["inspectionRecord"] = inspections[0]
-	} else {
-		entry["inspectionRecord"] = nil
+	ads, err := h.db.Query(ctx,
+		fmt.Sprintf(`SELECT ad.id, ad.ad_number, ad.ad_number_raw, ad.compliance_date, ad.compliance_method,
+		        ad.next_due_date, ad.next_due_hours, ad.notes,
+		        me.entry_date, me.maintenance_narrative, me.shop_name
+		 FROM ad_compliance ad
+		 LEFT JOIN maintenance_entries me ON ad.entry_id = me.id
+		 WHERE ad.aircraft_id = $1 AND me.superseded_by IS NULL
+		 ORDER BY %s
+		 LIMIT $2 OFFSET $3`, orderBy), aid, qp.Limit, qp.Offset)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
 	}
 
 	return models.APIResponse(200, map[string]any{
 		"tailNumber": strings.ToUpper(tailNumber),
-		"entry":      entry,
+		"ads":        ads,
+		"pagination": models.NewPagination(total, qp.Page, qp.Limit),
 	})
 }
 
-// ─── PATCH /aircraft/{tailNumber}/entries/{entryId} ─────────────────────────
+// ─── GET /aircraft/{tailNumber}/ads/status ──────────────────────────────────
+
+// AD statuses, in the order the status endpoint lists them. complied means
+// the latest compliance set no next due date or hours, so the AD isn't
+// recurring (or was terminated); unknown means it is due by hours but no
+// aircraft hours have been logged.
+const (
+	adStatusOverdue  = "overdue"
+	adStatusDueSoon  = "due_soon"
+	adStatusCurrent  = "current"
+	adStatusUnknown  = "unknown"
+	adStatusComplied = "complied"
+)
 
-var patchableFields = map[string]string{
-	"entryDate":           "entry_date",
-	"entryType":           "entry_type",
-	"hobbsTime":           "hobbs_time",
-	"tachTime":            "tach_time",
-	"flightTime":          "flight_time",
-	"timeSinceOverhaul":   "time_since_overhaul",
-	"shopName":            "shop_name",
-	"shopAddress":         "shop_address",
-	"shopPhone":           "shop_phone",
-	"repairStationNumber": "repair_station_number",
-	"mechanicName":        "mechanic_name",
-	"mechanicCertificate": "mechanic_certificate",
-	"workOrderNumber":     "work_order_number",
-	"maintenanceNarrative": "maintenance_narrative",
+var adStatusOrder = map[string]int{
+	adStatusOverdue:  0,
+	adStatusDueSoon:  1,
+	adStatusCurrent:  2,
+	adStatusUnknown:  3,
+	adStatusComplied: 4,
 }
 
-func (h *Handler) handleUpdateEntry(ctx context.Context, tailNumber, entryID string, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+const (
+	// A recurring AD is due soon within adDueSoonDays of its next due date
+	// or adDueSoonHours of its next due hours.
+	adDueSoonDays  = 30
+	adDueSoonHours = 10.0
+)
+
+// handleAdStatus reports each AD's latest compliance and whether its next
+// recurrence is overdue, due soon or current, against today and the
+// aircraft's most recently logged hours. Overdue ADs are listed first.
+func (h *Handler) handleAdStatus(ctx context.Context, tailNumber string) (events.APIGatewayProxyResponse, error) {
 	aid, notFound, err := h.getAircraftID(ctx, tailNumber)
 	if err != nil {
 		return events.APIGatewayProxyResponse{}, err
@@ -739,69 +3680,260 @@ func (h *Handler) handleUpdateEntry(ctx context.Context, tailNumber, entryID str
 		return *notFound, nil
 	}
 
-	var body map[string]any
-	if err := json.Unmarshal([]byte(event.Body), &body); err != nil || len(body) == 0 {
-		return errResponse(400, "Request body is required")
+	st, err := h.loadAdStatus(ctx, aid)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	counts := map[string]int{}
+	for _, ad := range st.ads {
+		counts[ad["status"].(string)]++
 	}
 
-	reviewStatus, _ := body["reviewStatus"].(string)
-	reviewedBy, _ := body["reviewedBy"].(string)
+	return models.APIResponse(200, map[string]any{
+		"tailNumber":   strings.ToUpper(tailNumber),
+		"asOf":         st.today.Format("2006-01-02"),
+		"currentHours": st.currentHours,
+		"ads":          st.ads,
+		"counts":       counts,
+	})
+}
 
-	if reviewStatus != "" && reviewStatus != "approved" && reviewStatus != "corrected" && reviewStatus != "rejected" {
-		return errResponse(400, "reviewStatus must be approved, corrected, or rejected")
+// adStatuses is the status of an aircraft's ADs as of today.
+type adStatuses struct {
+	today        time.Time
+	currentHours any
+	// ads are adStatus results, overdue first.
+	ads []map[string]any
+}
+
+// loadAdStatus classifies each of the aircraft's ADs by its latest
+// compliance against today and the most recently logged hours.
+func (h *Handler) loadAdStatus(ctx context.Context, aid string) (*adStatuses, error) {
+	latest, err := h.db.Query(ctx,
+		`SELECT DISTINCT ON (ad.ad_number)
+		        ad.ad_number, ad.compliance_date, ad.compliance_method, ad.next_due_date,
+		        ad.next_due_hours::float8 AS next_due_hours,
+		        COUNT(*) OVER (PARTITION BY ad.ad_number) AS compliance_count
+		 FROM ad_compliance ad
+		 LEFT JOIN maintenance_entries me ON ad.entry_id = me.id
+		 WHERE ad.aircraft_id = $1 AND me.superseded_by IS NULL
+		 ORDER BY ad.ad_number, ad.compliance_date DESC NULLS LAST, ad.created_at DESC`, aid)
+	if err != nil {
+		return nil, err
 	}
 
-	var setClauses []string
-	var values []any
-	argIdx := 1
+	hoursRows, err := h.db.Query(ctx,
+		`SELECT flight_time::float8 AS hours FROM maintenance_entries
+		 WHERE aircraft_id = $1 AND flight_time IS NOT NULL AND superseded_by IS NULL
+		 ORDER BY entry_date DESC LIMIT 1`, aid)
+	if err != nil {
+		return nil, err
+	}
+	var currentHours any
+	if len(hoursRows) > 0 {
+		currentHours = hoursRows[0]["hours"]
+	}
 
-	for camel, col := range patchableFields {
-		if v, ok := body[camel]; ok {
-			setClauses = append(setClauses, fmt.Sprintf("%s = $%d", col, argIdx))
-			values = append(values, v)
-			argIdx++
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	ads := make([]map[string]any, 0, len(latest))
+	for _, r := range latest {
+		ads = append(ads, adStatus(r, today, currentHours))
+	}
+	sort.SliceStable(ads, func(i, j int) bool {
+		si, sj := adStatusOrder[ads[i]["status"].(string)], adStatusOrder[ads[j]["status"].(string)]
+		if si != sj {
+			return si < sj
+		}
+		di, _ := ads[i]["nextDueDate"].(string)
+		dj, _ := ads[j]["nextDueDate"].(string)
+		if di != dj {
+			// Soonest first; ADs due only by hours after dated ones.
+			return dj == "" || (di != "" && di < dj)
 		}
+		return ads[i]["adNumber"].(string) < ads[j]["adNumber"].(string)
+	})
+	return &adStatuses{today: today, currentHours: currentHours, ads: ads}, nil
+}
+
+// adStatus classifies an AD from its latest compliance row. When it is due
+// by both date and hours, whichever comes first decides.
+func adStatus(row map[string]any, today time.Time, currentHours any) map[string]any {
+	adNumber, _ := row["ad_number"].(string)
+	count, _ := toInt(row["compliance_count"])
+	ad := map[string]any{
+		"adNumber":           adNumber,
+		"status":             adStatusComplied,
+		"recurring":          false,
+		"lastComplianceDate": nil,
+		"complianceMethod":   row["compliance_method"],
+		"complianceCount":    count,
+		"nextDueDate":        nil,
+		"nextDueHours":       nil,
+		"daysRemaining":      nil,
+		"hoursRemaining":     nil,
+	}
+	if d, ok := toDate(row["compliance_date"]); ok {
+		ad["lastComplianceDate"] = d.Format("2006-01-02")
 	}
 
-	if reviewStatus != "" {
-		setClauses = append(setClauses, fmt.Sprintf("review_status = $%d", argIdx))
-		values = append(values, reviewStatus)
-		argIdx++
-		setClauses = append(setClauses, "reviewed_at = NOW()")
-		if reviewedBy != "" {
-			setClauses = append(setClauses, fmt.Sprintf("reviewed_by = $%d", argIdx))
-			values = append(values, reviewedBy)
-			argIdx++
+	dueDate, hasDate := toDate(row["next_due_date"])
+	dueHours, hasHours := row["next_due_hours"].(float64)
+	if !hasDate && !hasHours {
+		return ad
+	}
+	ad["recurring"] = true
+
+	status := adStatusCurrent
+	worse := func(s string) {
+		if adStatusOrder[s] < adStatusOrder[status] {
+			status = s
 		}
-		if reviewStatus == "approved" || reviewStatus == "rejected" {
-			setClauses = append(setClauses, "needs_review = FALSE")
+	}
+	if hasDate {
+		days := int(dueDate.Sub(today).Hours() / 24)
+		ad["nextDueDate"] = dueDate.Format("2006-01-02")
+		ad["daysRemaining"] = days
+		switch {
+		case days < 0:
+			worse(adStatusOverdue)
+		case days <= adDueSoonDays:
+			worse(adStatusDueSoon)
 		}
 	}
+	if hasHours {
+		ad["nextDueHours"] = dueHours
+		if hours, ok := currentHours.(float64); ok {
+			remaining := dueHours - hours
+			ad["hoursRemaining"] = remaining
+			switch {
+			case remaining < 0:
+				worse(adStatusOverdue)
+			case remaining <= adDueSoonHours:
+				worse(adStatusDueSoon)
+			}
+		} else if !hasDate {
+			status = adStatusUnknown
+		}
+	}
+	ad["status"] = status
+	return ad
+}
 
-	if len(setClauses) == 0 {
-		return errResponse(400, "No fields to update")
+// ─── GET /aircraft/{tailNumber}/parts ───────────────────────────────────────
+
+func (h *Handler) handleParts(ctx context.Context, tailNumber string, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	aid, notFound, err := h.getAircraftID(ctx, tailNumber)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	if notFound != nil {
+		return *notFound, nil
 	}
 
-	setClauses = append(setClauses, "updated_at = NOW()")
-	values = append(values, entryID, aid)
+	params := event.QueryStringParameters
+	status := "active"
+	if params != nil {
+		if v, ok := params["status"]; ok {
+			status = v
+		}
+	}
+
+	whereClauses := []string{"aircraft_id = $1"}
+	args := []any{aid}
+
+	if status != "all" {
+		whereClauses = append(whereClauses, "is_active = TRUE")
+	}
+	whereSQL := strings.Join(whereClauses, " AND ")
+
+	parts, err := h.db.Query(ctx,
+		fmt.Sprintf(`SELECT id, part_name, part_number, serial_number,
+		        install_date, install_hours, life_limit_hours, life_limit_months,
+		        expiration_date, is_active, removal_date, notes
+		 FROM life_limited_parts
+		 WHERE %s
+		 ORDER BY expiration_date ASC NULLS LAST`, whereSQL),
+		args...)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	return models.APIResponse(200, map[string]any{
+		"tailNumber": strings.ToUpper(tailNumber),
+		"parts":      parts,
+		"total":      len(parts),
+	})
+}
+
+// ─── GET /aircraft/{tailNumber}/facets ──────────────────────────────────────
+
+// facetKeys maps the facet column tag in the query below to its response key.
+var facetKeys = map[string]string{
+	"shop_name":       "shops",
+	"mechanic_name":   "mechanics",
+	"entry_type":      "entryTypes",
+	"inspection_type": "inspectionTypes",
+}
+
+func (h *Handler) handleFacets(ctx context.Context, tailNumber string) (events.APIGatewayProxyResponse, error) {
+	aid, notFound, err := h.getAircraftID(ctx, tailNumber)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	if notFound != nil {
+		return *notFound, nil
+	}
 
 	rows, err := h.db.Query(ctx,
-		fmt.Sprintf(`UPDATE maintenance_entries SET %s WHERE id = $%d AND aircraft_id = $%d RETURNING id`,
-			strings.Join(setClauses, ", "), argIdx, argIdx+1),
-		values...)
+		`SELECT 'shop_name' AS facet, btrim(shop_name) AS value, COUNT(*) AS count
+		 FROM maintenance_entries
+		 WHERE aircraft_id = $1 AND btrim(shop_name) <> '' AND superseded_by IS NULL
+		 GROUP BY btrim(shop_name)
+		 UNION ALL
+		 SELECT 'mechanic_name', btrim(mechanic_name), COUNT(*)
+		 FROM maintenance_entries
+		 WHERE aircraft_id = $1 AND btrim(mechanic_name) <> '' AND superseded_by IS NULL
+		 GROUP BY btrim(mechanic_name)
+		 UNION ALL
+		 SELECT 'entry_type', entry_type, COUNT(*)
+		 FROM maintenance_entries
+		 WHERE aircraft_id = $1 AND entry_type <> '' AND superseded_by IS NULL
+		 GROUP BY entry_type
+		 UNION ALL
+		 SELECT 'inspection_type', ir.inspection_type, COUNT(*)
+		 FROM inspection_records ir
+		 LEFT JOIN maintenance_entries me ON ir.entry_id = me.id
+		 WHERE ir.aircraft_id = $1 AND ir.inspection_type <> '' AND me.superseded_by IS NULL
+		 GROUP BY ir.inspection_type
+		 ORDER BY facet, count DESC, value`, aid)
 	if err != nil {
 		return events.APIGatewayProxyResponse{}, err
 	}
-	if len(rows) == 0 {
-		return errResponse(404, "Entry not found")
+
+	facets := map[string][]map[string]any{}
+	for _, key := range facetKeys {
+		facets[key] = []map[string]any{}
+	}
+	for _, row := range rows {
+		key, ok := facetKeys[fmt.Sprintf("%v", row["facet"])]
+		value, _ := row["value"].(string)
+		if !ok || value == "" {
+			continue
+		}
+		count, _ := toInt64(row["count"])
+		facets[key] = append(facets[key], map[string]any{"value": value, "count": count})
 	}
 
-	return h.handleEntryDetail(ctx, tailNumber, entryID)
+	return models.APIResponse(200, map[string]any{
+		"tailNumber": strings.ToUpper(tailNumber),
+		"facets":     facets,
+	})
 }
 
-// ─── GET /aircraft/{tailNumber}/inspections ─────────────────────────────────
+// ─── GET /aircraft/{tailNumber}/weight-balance ──────────────────────────────
 
-func (h *Handler) handleInspections(ctx context.Context, tailNumber string, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+func (h *Handler) handleWeightBalance(ctx context.Context, tailNumber string) (events.APIGatewayProxyResponse, error) {
 	aid, notFound, err := h.getAircraftID(ctx, tailNumber)
 	if err != nil {
 		return events.APIGatewayProxyResponse{}, err
@@ -810,151 +3942,434 @@ func (h *Handler) handleInspections(ctx context.Context, tailNumber string, even
 		return *notFound, nil
 	}
 
-	qp := models.ParseQueryParams(event)
-	inspectionType := qp.Params["type"]
+	revisions, err := h.db.Query(ctx,
+		`SELECT wb.id, wb.entry_id, wb.revision_date, wb.empty_weight, wb.empty_cg,
+		        wb.useful_load, wb.equipment_changes, wb.notes,
+		        me.maintenance_narrative, me.shop_name
+		 FROM weight_balance_revisions wb
+		 LEFT JOIN maintenance_entries me ON wb.entry_id = me.id
+		 WHERE wb.aircraft_id = $1 AND me.superseded_by IS NULL
+		 ORDER BY wb.revision_date DESC, wb.created_at DESC`, aid)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
 
-	whereClauses := []string{"ir.aircraft_id = $1"}
-	args := []any{aid}
-	argIdx := 2
+	return models.APIResponse(200, map[string]any{
+		"tailNumber": strings.ToUpper(tailNumber),
+		"current":    firstOrNil(revisions),
+		"revisions":  revisions,
+	})
+}
 
-	if inspectionType != "" {
-		whereClauses = append(whereClauses, fmt.Sprintf("ir.inspection_type = $%d", argIdx))
-		args = append(args, inspectionType)
-		argIdx++
-	}
+// ─── GET /aircraft/{tailNumber}/gaps ────────────────────────────────────────
 
-	whereSQL := strings.Join(whereClauses, " AND ")
+const (
+	// A 100-hour inspection's interval may be overflown by
+	// hundredHourTolerance hours to reach a place where the inspection can
+	// be done (14 CFR 91.409(b)).
+	hundredHourTolerance = 10.0
 
-	countRows, err := h.db.Query(ctx,
-		fmt.Sprintf("SELECT COUNT(*) AS total FROM inspection_records ir WHERE %s", whereSQL),
-		args...)
+	defaultInactivityMonths = 12
+)
+
+// handleGaps reports intervals between consecutive inspections of the same
+// type that exceeded the regulatory window, and stretches with no logbook
+// entries at all longer than the inactivityMonths query parameter.
+func (h *Handler) handleGaps(ctx context.Context, tailNumber string, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	aid, notFound, err := h.getAircraftID(ctx, tailNumber)
 	if err != nil {
 		return events.APIGatewayProxyResponse{}, err
 	}
-	total, _ := toInt(countRows[0]["total"])
+	if notFound != nil {
+		return *notFound, nil
+	}
+
+	inactivityMonths := defaultInactivityMonths
+	if raw := event.QueryStringParameters["inactivityMonths"]; raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v <= 0 {
+			return errResponse(400, codeValidation, "inactivityMonths must be a positive integer")
+		}
+		inactivityMonths = v
+	}
 
-	queryArgs := append(args, qp.Limit, qp.Offset)
 	inspections, err := h.db.Query(ctx,
-		fmt.Sprintf(`SELECT ir.id, ir.inspection_type, ir.inspection_date, ir.aircraft_hours,
-		        ir.next_due_date, ir.next_due_hours, ir.far_reference,
-		        ir.inspector_name, ir.inspector_certificate, ir.notes,
-		        me.maintenance_narrative, me.shop_name
+		`SELECT ir.inspection_type, ir.inspection_date, ir.aircraft_hours::float8 AS aircraft_hours
 		 FROM inspection_records ir
 		 LEFT JOIN maintenance_entries me ON ir.entry_id = me.id
-		 WHERE %s
-		 ORDER BY ir.inspection_date DESC
-		 LIMIT $%d OFFSET $%d`, whereSQL, argIdx, argIdx+1),
-		queryArgs...)
+		 WHERE ir.aircraft_id = $1 AND me.superseded_by IS NULL
+		 ORDER BY ir.inspection_type, ir.inspection_date`, aid)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	entries, err := h.db.Query(ctx,
+		`SELECT DISTINCT entry_date FROM maintenance_entries
+		 WHERE aircraft_id = $1 AND entry_date IS NOT NULL AND superseded_by IS NULL
+		 ORDER BY entry_date`, aid)
 	if err != nil {
 		return events.APIGatewayProxyResponse{}, err
 	}
 
-	latestByType, _ := h.db.Query(ctx,
-		`SELECT DISTINCT ON (ir.inspection_type)
-		        ir.inspection_type, ir.inspection_date, ir.next_due_date, ir.next_due_hours
-		 FROM inspection_records ir
-		 WHERE ir.aircraft_id = $1
-		 ORDER BY ir.inspection_type, ir.inspection_date DESC`, aid)
+	var dates []time.Time
+	for _, r := range entries {
+		if d, ok := toDate(r["entry_date"]); ok {
+			dates = append(dates, d)
+		}
+	}
 
 	return models.APIResponse(200, map[string]any{
-		"tailNumber":   strings.ToUpper(tailNumber),
-		"inspections":  inspections,
-		"latestByType": latestByType,
-		"pagination":   models.NewPagination(total, qp.Page, qp.Limit),
+		"tailNumber":       strings.ToUpper(tailNumber),
+		"inspectionGaps":   inspectionGaps(inspections),
+		"entryGaps":        entryGaps(dates, inactivityMonths),
+		"inactivityMonths": inactivityMonths,
 	})
 }
 
-// ─── GET /aircraft/{tailNumber}/ads ─────────────────────────────────────────
+// inspectionGaps finds lapses between consecutive inspections of each type.
+// rows must be ordered by type, then date. A calendar inspection lapsed when
+// the next one came after the end of the month its interval ran out in; a
+// 100-hour inspection lapsed when more than the interval plus tolerance was
+// flown in between.
+func inspectionGaps(rows []map[string]any) []map[string]any {
+	gaps := []map[string]any{}
+	for i := 1; i < len(rows); i++ {
+		prev, cur := rows[i-1], rows[i]
+		typ, _ := cur["inspection_type"].(string)
+		if prevType, _ := prev["inspection_type"].(string); prevType != typ {
+			continue
+		}
+		start, ok1 := toDate(prev["inspection_date"])
+		end, ok2 := toDate(cur["inspection_date"])
+		if !ok1 || !ok2 {
+			continue
+		}
 
-func (h *Handler) handleAds(ctx context.Context, tailNumber string, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-	aid, notFound, err := h.getAircraftID(ctx, tailNumber)
+		rule := models.InspectionRules[typ]
+		if months := rule.Months; months > 0 {
+			dueBy := time.Date(start.Year(), start.Month()+time.Month(months)+1, 0, 0, 0, 0, 0, time.UTC)
+			if end.After(dueBy) {
+				gaps = append(gaps, map[string]any{
+					"inspectionType":         typ,
+					"startDate":              start.Format("2006-01-02"),
+					"endDate":                end.Format("2006-01-02"),
+					"dueBy":                  dueBy.Format("2006-01-02"),
+					"expectedIntervalMonths": months,
+					"daysOverdue":            int(end.Sub(dueBy).Hours() / 24),
+				})
+			}
+			continue
+		}
+
+		if typ == "100hr" {
+			startHours, ok1 := prev["aircraft_hours"].(float64)
+			endHours, ok2 := cur["aircraft_hours"].(float64)
+			if ok1 && ok2 && endHours-startHours > rule.Hours+hundredHourTolerance {
+				gaps = append(gaps, map[string]any{
+					"inspectionType":        typ,
+					"startDate":             start.Format("2006-01-02"),
+					"endDate":               end.Format("2006-01-02"),
+					"startHours":            startHours,
+					"endHours":              endHours,
+					"expectedIntervalHours": rule.Hours,
+					"hoursOver":             endHours - startHours - rule.Hours,
+				})
+			}
+		}
+	}
+	return gaps
+}
+
+// entryGaps returns the stretches between consecutive entry dates (sorted
+// ascending) longer than months.
+func entryGaps(dates []time.Time, months int) []map[string]any {
+	gaps := []map[string]any{}
+	for i := 1; i < len(dates); i++ {
+		start, end := dates[i-1], dates[i]
+		if end.After(start.AddDate(0, months, 0)) {
+			gaps = append(gaps, map[string]any{
+				"startDate": start.Format("2006-01-02"),
+				"endDate":   end.Format("2006-01-02"),
+				"days":      int(end.Sub(start).Hours() / 24),
+			})
+		}
+	}
+	return gaps
+}
+
+// ─── GET /aircraft/{tailNumber}/report.pdf ──────────────────────────────────
+
+// handleReport renders a printable PDF of the aircraft's identity, AD
+// compliance status and every entry, oldest first, with inspections
+// highlighted.
+func (h *Handler) handleReport(ctx context.Context, tailNumber string) (events.APIGatewayProxyResponse, error) {
+	tail := strings.ToUpper(tailNumber)
+	aircraft, err := h.db.Query(ctx, "SELECT * FROM aircraft WHERE registration = $1 AND tenant_id = $2", tail, tenantFrom(ctx))
 	if err != nil {
 		return events.APIGatewayProxyResponse{}, err
 	}
-	if notFound != nil {
-		return *notFound, nil
+	if len(aircraft) == 0 {
+		return errResponse(404, codeAircraftNotFound, fmt.Sprintf("Aircraft %s not found", tail))
 	}
+	a := aircraft[0]
+	aid := fmt.Sprintf("%v", a["id"])
 
-	qp := models.ParseQueryParams(event)
-
-	countRows, err := h.db.Query(ctx,
-		"SELECT COUNT(*) AS total FROM ad_compliance WHERE aircraft_id = $1", aid)
+	ads, err := h.loadAdStatus(ctx, aid)
 	if err != nil {
 		return events.APIGatewayProxyResponse{}, err
 	}
-	total, _ := toInt(countRows[0]["total"])
 
-	ads, err := h.db.Query(ctx,
-		`SELECT ad.id, ad.ad_number, ad.compliance_date, ad.compliance_method,
-		        ad.next_due_date, ad.next_due_hours, ad.notes,
-		        me.entry_date, me.maintenance_narrative, me.shop_name
-		 FROM ad_compliance ad
-		 LEFT JOIN maintenance_entries me ON ad.entry_id = me.id
-		 WHERE ad.aircraft_id = $1
-		 ORDER BY ad.compliance_date DESC
-		 LIMIT $2 OFFSET $3`, aid, qp.Limit, qp.Offset)
+	entries, err := h.db.Query(ctx,
+		`SELECT me.entry_date, me.flight_time::float8 AS hours, me.entry_type,
+		        me.maintenance_narrative,
+		        (SELECT string_agg(DISTINCT ir.inspection_type, ', ')
+		         FROM inspection_records ir WHERE ir.entry_id = me.id) AS inspection_types
+		 FROM maintenance_entries me
+		 WHERE me.aircraft_id = $1 AND me.superseded_by IS NULL
+		 ORDER BY me.entry_date ASC NULLS LAST, me.id`, aid)
 	if err != nil {
 		return events.APIGatewayProxyResponse{}, err
 	}
 
-	return models.APIResponse(200, map[string]any{
-		"tailNumber": strings.ToUpper(tailNumber),
-		"ads":        ads,
-		"pagination": models.NewPagination(total, qp.Page, qp.Limit),
-	})
+	r := &report.Report{
+		Aircraft: report.Aircraft{
+			Registration:    tail,
+			Make:            reportText(a["make"]),
+			Model:           reportText(a["model"]),
+			SerialNumber:    reportText(a["serial_number"]),
+			EngineModel:     reportText(a["engine_model"]),
+			EngineSerial:    reportText(a["engine_serial"]),
+			PropellerModel:  reportText(a["propeller_model"]),
+			PropellerSerial: reportText(a["propeller_serial"]),
+		},
+		GeneratedAt: time.Now().UTC(),
+	}
+	if hours, ok := ads.currentHours.(float64); ok {
+		r.TotalTime = formatHours(hours, true) + " hrs"
+	}
+	for _, ad := range ads.ads {
+		var due []string
+		if d, ok := ad["nextDueDate"].(string); ok {
+			due = append(due, d)
+		}
+		if hours, ok := ad["nextDueHours"].(float64); ok {
+			due = append(due, formatHours(hours, true)+" hrs")
+		}
+		r.ADs = append(r.ADs, report.AD{
+			Number:       reportText(ad["adNumber"]),
+			Status:       strings.ReplaceAll(reportText(ad["status"]), "_", " "),
+			LastComplied: reportText(ad["lastComplianceDate"]),
+			NextDue:      strings.Join(due, " or "),
+		})
+	}
+	for _, e := range entries {
+		entry := report.Entry{
+			Date:        reportText(e["entry_date"]),
+			Type:        strings.ReplaceAll(reportText(e["entry_type"]), "_", " "),
+			Narrative:   reportText(e["maintenance_narrative"]),
+			Inspections: strings.ReplaceAll(reportText(e["inspection_types"]), "_", " "),
+		}
+		if hours, ok := e["hours"].(float64); ok {
+			entry.Hours = formatHours(hours, true)
+		}
+		r.Entries = append(r.Entries, entry)
+	}
+
+	var buf bytes.Buffer
+	if err := report.Render(&buf, r); err != nil {
+		return events.APIGatewayProxyResponse{}, fmt.Errorf("render report: %w", err)
+	}
+	return models.BinaryResponse(200, "application/pdf", tail+"-maintenance-report.pdf", buf.Bytes()), nil
 }
 
-// ─── GET /aircraft/{tailNumber}/parts ───────────────────────────────────────
+// reportText renders a column value for the PDF report: dates as
+// YYYY-MM-DD, nil as empty.
+func reportText(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case time.Time:
+		return val.Format("2006-01-02")
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
 
-func (h *Handler) handleParts(ctx context.Context, tailNumber string, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-	aid, notFound, err := h.getAircraftID(ctx, tailNumber)
-	if err != nil {
-		return events.APIGatewayProxyResponse{}, err
+// ─── POST /fleet/query ──────────────────────────────────────────────────────
+
+const (
+	// maxFleetTails caps the tail numbers in one fleet query.
+	maxFleetTails = 50
+	// fleetQueryChunks is how many chunks are retrieved across the fleet.
+	fleetQueryChunks = 20
+)
+
+// handleFleetQuery answers a question over several aircraft at once. The
+// retrieval is the per-aircraft query's, scoped to every listed aircraft,
+// and each record and source is labelled with its tail number. Tail numbers
+// that match no aircraft are listed in unknownTailNumbers rather than
+// failing the request.
+func (h *Handler) handleFleetQuery(ctx context.Context, event events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var body struct {
+		TailNumbers []string `json:"tailNumbers"`
+		Question    string   `json:"question"`
 	}
-	if notFound != nil {
-		return *notFound, nil
+	if err := json.Unmarshal([]byte(event.Body), &body); err != nil {
+		return errResponse(400, codeInvalidRequest, "Invalid JSON body")
+	}
+	if strings.TrimSpace(body.Question) == "" {
+		return errResponse(400, codeValidation, "question is required")
 	}
 
-	params := event.QueryStringParameters
-	status := "active"
-	if params != nil {
-		if v, ok := params["status"]; ok {
-			status = v
+	var tails []string
+	seen := map[string]bool{}
+	for _, t := range body.TailNumbers {
+		t = strings.ToUpper(strings.TrimSpace(t))
+		if t != "" && !seen[t] {
+			seen[t] = true
+			tails = append(tails, t)
 		}
 	}
+	if len(tails) == 0 {
+		return errResponse(400, codeValidation, "tailNumbers is required")
+	}
+	if len(tails) > maxFleetTails {
+		return errResponse(400, codeValidation, fmt.Sprintf("at most %d tailNumbers are allowed", maxFleetTails))
+	}
 
-	whereClauses := []string{"aircraft_id = $1"}
-	args := []any{aid}
+	aircraft, err := h.db.Query(ctx,
+		"SELECT id, registration FROM aircraft WHERE registration = ANY($1) AND tenant_id = $2", tails, tenantFrom(ctx))
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	tailByID := map[string]string{}
+	found := map[string]bool{}
+	var ids []string
+	for _, a := range aircraft {
+		id, tail := fmt.Sprintf("%v", a["id"]), fmt.Sprintf("%v", a["registration"])
+		tailByID[id] = tail
+		found[tail] = true
+		ids = append(ids, id)
+	}
+	unknown := []string{}
+	resolved := []string{}
+	for _, t := range tails {
+		if found[t] {
+			resolved = append(resolved, t)
+		} else {
+			unknown = append(unknown, t)
+		}
+	}
 
-	if status != "all" {
-		whereClauses = append(whereClauses, "is_active = TRUE")
+	response := map[string]any{
+		"tailNumbers":        resolved,
+		"unknownTailNumbers": unknown,
+		"question":           body.Question,
+		"answer":             "No maintenance records found for these aircraft.",
+		"sources":            []any{},
+		"retrieved":          []any{},
+		"usage":              map[string]any{"chunks": 0, "contextTokens": 0},
+	}
+	if len(ids) == 0 {
+		return models.APIResponse(200, response)
 	}
-	whereSQL := strings.Join(whereClauses, " AND ")
 
-	parts, err := h.db.Query(ctx,
-		fmt.Sprintf(`SELECT id, part_name, part_number, serial_number,
-		        install_date, install_hours, life_limit_hours, life_limit_months,
-		        expiration_date, is_active, removal_date, notes
-		 FROM life_limited_parts
-		 WHERE %s
-		 ORDER BY expiration_date ASC NULLS LAST`, whereSQL),
-		args...)
+	geminiClient, err := h.getGeminiClient(ctx)
 	if err != nil {
 		return events.APIGatewayProxyResponse{}, err
 	}
 
-	return models.APIResponse(200, map[string]any{
-		"tailNumber": strings.ToUpper(tailNumber),
-		"parts":      parts,
-		"total":      len(parts),
-	})
+	embedding, err := h.embedding.Embed(ctx, geminiClient, body.Question)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, fmt.Errorf("embed question: %w", err)
+	}
+
+	results, err := h.db.Query(ctx,
+		`SELECT me.entry_id, me.chunk_text, me.chunk_type, m.aircraft_id,
+		        m.entry_date, m.entry_type, m.maintenance_narrative,
+		        ir.inspection_type,
+		        1 - (me.embedding <=> $1::halfvec) AS similarity
+		 FROM maintenance_embeddings me
+		 JOIN maintenance_entries m ON me.entry_id = m.id
+		 LEFT JOIN inspection_records ir ON ir.entry_id = m.id
+		 WHERE m.aircraft_id = ANY($2::uuid[]) AND me.model = $3 AND m.superseded_by IS NULL
+		 ORDER BY me.embedding <=> $1::halfvec
+		 LIMIT $4`, gemini.FormatEmbedding(embedding), ids, h.embedding.ModelName(), fleetQueryChunks)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, vectorSearchError(err)
+	}
+	if len(results) == 0 {
+		return models.APIResponse(200, response)
+	}
+
+	var contextParts []string
+	retrieved := make([]map[string]any, 0, len(results))
+	for _, r := range results {
+		tail := tailByID[fmt.Sprintf("%v", r["aircraft_id"])]
+		contextParts = append(contextParts, fmt.Sprintf("%s %s", tail, contextRecord(r)))
+		source := querySource(r)
+		source["tailNumber"] = tail
+		retrieved = append(retrieved, source)
+	}
+	contextText := strings.Join(contextParts, "\n---\n")
+
+	ragPrompt := fmt.Sprintf(`You are an aircraft maintenance expert assistant. Answer the question based ONLY on the maintenance records provided below.
+
+Aircraft: %s
+
+MAINTENANCE RECORDS (each starts with the aircraft's tail number):
+%s
+
+QUESTION: %s
+
+Provide a clear, accurate answer. Name the aircraft each finding applies to and cite specific dates and entries. If the records don't contain enough information, say so.`, strings.Join(resolved, ", "), contextText, body.Question)
+
+	answer, err := geminiClient.GenerateContent(ctx, "gemini-2.5-flash", []gemini.Part{
+		{Text: ragPrompt},
+	}, h.queryConfig())
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, fmt.Errorf("generate answer: %w", err)
+	}
+
+	response["answer"] = answer
+	response["sources"] = retrieved[:min(len(retrieved), queryCitedSources)]
+	response["retrieved"] = retrieved
+	response["usage"] = map[string]any{
+		"chunks":        len(results),
+		"contextTokens": estimateTokens(contextText),
+	}
+	return models.APIResponse(200, response)
 }
 
 // ─── Helpers ────────────────────────────────────────────────────────────────
 
+// escapeLike escapes LIKE wildcards so user input matches literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// resolveSort maps a `sort` query value to its ORDER BY clause. An empty value
+// falls back to "-date"; anything not in the allowlist yields a 400 response.
+func resolveSort(raw string, allowed map[string]string) (string, *events.APIGatewayProxyResponse) {
+	if raw == "" {
+		raw = "-date"
+	}
+	if orderBy, ok := allowed[raw]; ok {
+		return orderBy, nil
+	}
+	keys := make([]string, 0, len(allowed))
+	for k := range allowed {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	resp, _ := errResponse(400, codeValidation, fmt.Sprintf("Invalid sort %q (allowed: %s)", raw, strings.Join(keys, ", ")))
+	return "", &resp
+}
+
 func (h *Handler) getGeminiClient(ctx context.Context) (gemini.Client, error) {
 	if h.gemini != nil {
-		return h.gemini, nil
+		return gemini.WithTimeout(h.gemini, h.llmCallTimeout), nil
 	}
 
 	apiKey := os.Getenv("GEMINI_API_KEY")
@@ -971,22 +4386,73 @@ func (h *Handler) getGeminiClient(ctx context.Context) (gemini.Client, error) {
 		return nil, err
 	}
 	h.gemini = client
-	return client, nil
+	return gemini.WithTimeout(client, h.llmCallTimeout), nil
+}
+
+// getClaudeClient lazily initializes the Claude client used for QA rechecks.
+// Returns nil, nil when no ANTHROPIC_API_KEY is configured, so QA falls back
+// to Gemini.
+func (h *Handler) getClaudeClient(ctx context.Context) (anthropic.Client, error) {
+	if h.claude != nil {
+		return anthropic.WithTimeout(h.claude, h.llmCallTimeout), nil
+	}
+
+	apiKey := os.Getenv("ANTHROPIC_API_KEY")
+	if apiKey == "" {
+		secretARN := os.Getenv("GEMINI_SECRET_ARN") // Same secret, different key
+		if secretARN == "" {
+			return nil, nil
+		}
+		secretJSON, err := h.secrets.GetSecretJSON(ctx, secretARN)
+		if err != nil {
+			return nil, fmt.Errorf("get anthropic secret: %w", err)
+		}
+		apiKey = secretJSON["ANTHROPIC_API_KEY"]
+	}
+	if apiKey == "" {
+		return nil, nil
+	}
+
+	h.claude = anthropic.New(apiKey)
+	return anthropic.WithTimeout(h.claude, h.llmCallTimeout), nil
 }
 
-func formatEmbedding(embedding []float32) string {
+// formatHours renders an hours reading with one decimal place and never in
+// exponent form: 12345.6, or 12,345.6 when grouped.
+func formatHours(hours float64, grouped bool) string {
+	s := strconv.FormatFloat(hours, 'f', 1, 64)
+	if !grouped {
+		return s
+	}
+	sign, whole, frac := "", s[:len(s)-2], s[len(s)-2:]
+	if strings.HasPrefix(whole, "-") {
+		sign, whole = "-", whole[1:]
+	}
 	var b strings.Builder
-	b.WriteByte('[')
-	for i, v := range embedding {
-		if i > 0 {
+	b.WriteString(sign)
+	for i, r := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
 			b.WriteByte(',')
 		}
-		fmt.Fprintf(&b, "%g", v)
+		b.WriteRune(r)
 	}
-	b.WriteByte(']')
+	b.WriteString(frac)
 	return b.String()
 }
 
+// hoursText formats a numeric hours value with formatHours, ungrouped. Nil
+// and non-numeric values come back as nil.
+func hoursText(v any) any {
+	switch val := v.(type) {
+	case float64:
+		return formatHours(val, false)
+	case int64:
+		return formatHours(float64(val), false)
+	default:
+		return nil
+	}
+}
+
 func firstOrNil(rows []map[string]any) any {
 	if len(rows) > 0 {
 		return rows[0]
@@ -1014,6 +4480,40 @@ func toInt(v any) (int, bool) {
 	return int(i), ok
 }
 
+// toDate converts a DATE column value, which arrives as time.Time from the
+// database or as YYYY-MM-DD text.
+func toDate(v any) (time.Time, bool) {
+	switch val := v.(type) {
+	case time.Time:
+		return val, true
+	case string:
+		t, err := time.Parse("2006-01-02", val)
+		return t, err == nil
+	default:
+		return time.Time{}, false
+	}
+}
+
+// isUUID reports whether s is a UUID in canonical 8-4-4-4-12 hex form.
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i, c := range s {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
 func newUUID() string {
 	var uuid [16]byte
 	_, _ = cryptoRand.Read(uuid[:])
@@ -1022,3 +4522,45 @@ func newUUID() string {
 	return fmt.Sprintf("%08x-%04x-%04x-%04x-%012x",
 		uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:16])
 }
+
+// uuidV7State keeps newUUIDv7 monotonic within a process: ids generated in
+// the same millisecond (or after the clock steps backwards) reuse the last
+// timestamp and bump a 12-bit counter held in rand_a.
+var uuidV7State struct {
+	sync.Mutex
+	ms  int64
+	seq uint16
+}
+
+// newUUIDv7 returns an RFC 9562 version 7 UUID: a 48-bit Unix millisecond
+// timestamp followed by a counter and random bits, so ids sort by creation
+// time in their string form.
+func newUUIDv7() string {
+	var uuid [16]byte
+	_, _ = cryptoRand.Read(uuid[:])
+
+	uuidV7State.Lock()
+	ms := time.Now().UnixMilli()
+	if ms > uuidV7State.ms {
+		uuidV7State.ms = ms
+		// Start low in the counter space so a burst doesn't overflow it.
+		uuidV7State.seq = uint16(uuid[6]&0x07)<<8 | uint16(uuid[7])
+	} else {
+		uuidV7State.seq++
+		if uuidV7State.seq > 0x0fff {
+			uuidV7State.ms++
+			uuidV7State.seq = 0
+		}
+	}
+	ms, seq := uuidV7State.ms, uuidV7State.seq
+	uuidV7State.Unlock()
+
+	for i := 0; i < 6; i++ {
+		uuid[i] = byte(ms >> (40 - 8*i))
+	}
+	uuid[6] = 0x70 | byte(seq>>8) // version 7
+	uuid[7] = byte(seq)
+	uuid[8] = (uuid[8] & 0x3f) | 0x80 // variant 10
+	return fmt.Sprintf("%08x-%04x-%04x-%04x-%012x",
+		uuid[0:4], uuid[4:6], uuid[6:8], uuid[8:10], uuid[10:16])
+}
@@ -1,18 +1,37 @@
 package main
 
 import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
 	"context"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
 	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 
+	"github.com/projectcloudline/logbook-service/internal/db"
+	"github.com/projectcloudline/logbook-service/internal/faa"
 	"github.com/projectcloudline/logbook-service/internal/gemini"
+	"github.com/projectcloudline/logbook-service/internal/rawextraction"
+	"github.com/projectcloudline/logbook-service/internal/sourceurl"
 )
 
 // ─── Mock DB ────────────────────────────────────────────────────────────────
@@ -21,6 +40,7 @@ type mockDB struct {
 	queryFn  func(ctx context.Context, sql string, args ...any) ([]map[string]any, error)
 	insertFn func(ctx context.Context, sql string, args ...any) (string, error)
 	execFn   func(ctx context.Context, sql string, args ...any) error
+	pingFn   func(ctx context.Context) error
 }
 
 func (m *mockDB) Query(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
@@ -44,6 +64,13 @@ func (m *mockDB) Exec(ctx context.Context, sql string, args ...any) error {
 	return nil
 }
 
+func (m *mockDB) Ping(ctx context.Context) error {
+	if m.pingFn != nil {
+		return m.pingFn(ctx)
+	}
+	return nil
+}
+
 func (m *mockDB) Pool() *pgxpool.Pool { return nil }
 
 // ─── Mock S3 ────────────────────────────────────────────────────────────────
@@ -51,6 +78,11 @@ func (m *mockDB) Pool() *pgxpool.Pool { return nil }
 type mockS3 struct {
 	presignPutFn func(ctx context.Context, bucket, key, contentType string, expires time.Duration) (string, error)
 	presignGetFn func(ctx context.Context, bucket, key string, expires time.Duration) (string, error)
+	getObjectFn  func(ctx context.Context, bucket, key string) (io.ReadCloser, error)
+	putObjectFn  func(ctx context.Context, bucket, key, contentType string, body io.Reader) error
+	headObjectFn func(ctx context.Context, bucket, key string) (bool, int64, error)
+	listFn       func(ctx context.Context, bucket, prefix string) ([]string, error)
+	deleteFn     func(ctx context.Context, bucket, key string) error
 }
 
 func (m *mockS3) PresignPutObject(ctx context.Context, bucket, key, contentType string, expires time.Duration) (string, error) {
@@ -68,13 +100,54 @@ func (m *mockS3) PresignGetObject(ctx context.Context, bucket, key string, expir
 }
 
 func (m *mockS3) GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	if m.getObjectFn != nil {
+		return m.getObjectFn(ctx, bucket, key)
+	}
 	return io.NopCloser(strings.NewReader("data")), nil
 }
 
 func (m *mockS3) PutObject(ctx context.Context, bucket, key, contentType string, body io.Reader) error {
+	if m.putObjectFn != nil {
+		return m.putObjectFn(ctx, bucket, key, contentType, body)
+	}
+	return nil
+}
+
+func (m *mockS3) HeadObject(ctx context.Context, bucket, key string) (bool, int64, error) {
+	if m.headObjectFn != nil {
+		return m.headObjectFn(ctx, bucket, key)
+	}
+	return true, 0, nil
+}
+
+func (m *mockS3) ListObjects(ctx context.Context, bucket, prefix string) ([]string, error) {
+	if m.listFn != nil {
+		return m.listFn(ctx, bucket, prefix)
+	}
+	return nil, nil
+}
+
+func (m *mockS3) DeleteObject(ctx context.Context, bucket, key string) error {
+	if m.deleteFn != nil {
+		return m.deleteFn(ctx, bucket, key)
+	}
 	return nil
 }
 
+// ─── Mock SQS ───────────────────────────────────────────────────────────────
+
+type mockSQS struct {
+	queueURLs []string
+	messages  []string
+	err       error
+}
+
+func (m *mockSQS) SendMessage(ctx context.Context, queueURL, body string) error {
+	m.queueURLs = append(m.queueURLs, queueURL)
+	m.messages = append(m.messages, body)
+	return m.err
+}
+
 // ─── Mock Secrets ───────────────────────────────────────────────────────────
 
 type mockSecrets struct {
@@ -134,6 +207,21 @@ func parseBody(t *testing.T, body string) map[string]any {
 	return result
 }
 
+// parseError returns the code and message of an error response body.
+func parseError(t *testing.T, body string) (code, message string) {
+	t.Helper()
+	var result struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(body), &result); err != nil {
+		t.Fatalf("failed to parse error body: %v\nbody: %s", err, body)
+	}
+	return result.Error.Code, result.Error.Message
+}
+
 // ─── Tests ──────────────────────────────────────────────────────────────────
 
 func TestWarmerEvent(t *testing.T) {
@@ -151,6 +239,91 @@ func TestWarmerEvent(t *testing.T) {
 	}
 }
 
+func TestWarmerEvent_PingsDB(t *testing.T) {
+	for _, pingErr := range []error{nil, fmt.Errorf("connection refused")} {
+		pinged := false
+		h := newTestHandler(&mockDB{pingFn: func(ctx context.Context) error {
+			pinged = true
+			return pingErr
+		}})
+		resp, err := h.Handle(context.Background(), json.RawMessage(`{"source":"logbook.warmer"}`))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !pinged {
+			t.Error("warmer should ping the database")
+		}
+		// A failed ping is logged, not surfaced to EventBridge.
+		if resp.StatusCode != 200 {
+			t.Errorf("ping error %v: status = %d, want 200", pingErr, resp.StatusCode)
+		}
+	}
+}
+
+func TestHandleHealth(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      map[string]string
+		pingErr    error
+		headErr    error
+		wantStatus int
+		wantChecks map[string]any
+	}{
+		{
+			name:       "db ok",
+			wantStatus: 200,
+			wantChecks: map[string]any{"db": "ok"},
+		},
+		{
+			name:       "db down",
+			pingErr:    fmt.Errorf("connection refused"),
+			wantStatus: 503,
+			wantChecks: map[string]any{"db": "error"},
+		},
+		{
+			name:       "with s3",
+			query:      map[string]string{"s3": "true"},
+			wantStatus: 200,
+			wantChecks: map[string]any{"db": "ok", "s3": "ok"},
+		},
+		{
+			name:       "s3 down",
+			query:      map[string]string{"s3": "true"},
+			headErr:    fmt.Errorf("access denied"),
+			wantStatus: 503,
+			wantChecks: map[string]any{"db": "ok", "s3": "error"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(&mockDB{pingFn: func(ctx context.Context) error { return tt.pingErr }})
+			var headKey string
+			h.s3 = &mockS3{headObjectFn: func(ctx context.Context, bucket, key string) (bool, int64, error) {
+				headKey = key
+				return false, 0, tt.headErr
+			}}
+
+			event := makeEvent("GET", "/health", "", nil, tt.query)
+			resp, err := h.Handle(context.Background(), event)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			body := parseBody(t, resp.Body)
+			checks, _ := body["checks"].(map[string]any)
+			if fmt.Sprint(checks) != fmt.Sprint(tt.wantChecks) {
+				t.Errorf("checks = %v, want %v", checks, tt.wantChecks)
+			}
+			if _, ok := tt.wantChecks["s3"]; ok != (headKey != "") {
+				t.Errorf("S3 probed = %v, want %v", headKey != "", ok)
+			}
+		})
+	}
+}
+
 func TestNotFoundRoute(t *testing.T) {
 	h := newTestHandler(&mockDB{})
 	event := makeEvent("GET", "/nonexistent", "", nil, nil)
@@ -163,6 +336,255 @@ func TestNotFoundRoute(t *testing.T) {
 	}
 }
 
+func TestErrorCodes(t *testing.T) {
+	aircraftOnly := func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+		if strings.Contains(sql, "FROM aircraft") {
+			return []map[string]any{{"id": "aid-1"}}, nil
+		}
+		return nil, nil
+	}
+
+	tests := []struct {
+		name       string
+		event      json.RawMessage
+		queryFn    func(ctx context.Context, sql string, args ...any) ([]map[string]any, error)
+		wantStatus int
+		wantCode   string
+	}{
+		{
+			name:       "unknown route",
+			event:      makeEvent("GET", "/nonexistent", "", nil, nil),
+			wantStatus: 404,
+			wantCode:   "ROUTE_NOT_FOUND",
+		},
+		{
+			name:       "malformed upload body",
+			event:      makeEvent("POST", "/uploads", "not json", nil, nil),
+			wantStatus: 400,
+			wantCode:   "INVALID_REQUEST",
+		},
+		{
+			name:       "upload validation",
+			event:      makeEvent("POST", "/uploads", `{"tailNumber":"N123"}`, nil, nil),
+			wantStatus: 400,
+			wantCode:   "VALIDATION_ERROR",
+		},
+		{
+			name:       "unknown aircraft",
+			event:      makeEvent("GET", "/aircraft/{tailNumber}/entries", "", map[string]string{"tailNumber": "N999"}, nil),
+			wantStatus: 404,
+			wantCode:   "AIRCRAFT_NOT_FOUND",
+		},
+		{
+			name:       "unknown upload",
+			event:      makeEvent("GET", "/uploads/{id}/status", "", map[string]string{"id": "batch-1"}, nil),
+			wantStatus: 404,
+			wantCode:   "UPLOAD_NOT_FOUND",
+		},
+		{
+			name:       "unknown page",
+			event: makeEvent("GET", "/uploads/{id}/pages/{pageNumber}/image", "", map[string]string{"id": "batch-1", "pageNumber": "9"}, nil),
+			queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+				if strings.Contains(sql, "FROM upload_batches") {
+					return []map[string]any{{"id": "batch-1", "upload_type": "multi_image", "processing_status": "completed"}}, nil
+				}
+				return nil, nil
+			},
+			wantStatus: 404,
+			wantCode:   "PAGE_NOT_FOUND",
+		},
+		{
+			name:       "unknown entry",
+			event:      makeEvent("GET", "/aircraft/{tailNumber}/entries/{entryId}", "", map[string]string{"tailNumber": "N123", "entryId": "entry-1"}, nil),
+			queryFn:    aircraftOnly,
+			wantStatus: 404,
+			wantCode:   "ENTRY_NOT_FOUND",
+		},
+		{
+			name:  "expired upload",
+			event: makeEvent("POST", "/uploads/{id}/finalize", "", map[string]string{"id": "batch-1"}, nil),
+			queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+				return []map[string]any{{"id": "batch-1", "upload_type": "pdf", "processing_status": "expired"}}, nil
+			},
+			wantStatus: 409,
+			wantCode:   "UPLOAD_EXPIRED",
+		},
+		{
+			name:  "database failure",
+			event: makeEvent("GET", "/aircraft/{tailNumber}/entries", "", map[string]string{"tailNumber": "N123"}, nil),
+			queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+				return nil, fmt.Errorf(`ERROR: relation "aircraft" does not exist (SQLSTATE 42P01)`)
+			},
+			wantStatus: 500,
+			wantCode:   "INTERNAL_ERROR",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(&mockDB{queryFn: tt.queryFn})
+			resp, err := h.Handle(context.Background(), tt.event)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			code, msg := parseError(t, resp.Body)
+			if code != tt.wantCode {
+				t.Errorf("code = %q, want %q", code, tt.wantCode)
+			}
+			if msg == "" || strings.Contains(msg, "SQLSTATE") {
+				t.Errorf("message = %q", msg)
+			}
+			if resp.Headers["Access-Control-Allow-Origin"] == "" {
+				t.Error("error responses should carry CORS headers")
+			}
+		})
+	}
+}
+
+func TestHandle_APIErrorFromHandler(t *testing.T) {
+	h := newTestHandler(&mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			return nil, fmt.Errorf("lookup: %w", &apiError{Status: 409, Code: "UPLOAD_EXPIRED", Message: "Upload has expired"})
+		},
+	})
+	event := makeEvent("GET", "/uploads/{id}/status", "", map[string]string{"id": "batch-1"}, nil)
+	resp, err := h.Handle(context.Background(), event)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if code, msg := parseError(t, resp.Body); resp.StatusCode != 409 || code != "UPLOAD_EXPIRED" || msg != "Upload has expired" {
+		t.Errorf("got %d %q %q, want the wrapped apiError", resp.StatusCode, code, msg)
+	}
+}
+
+func TestHandle_RecoversFromPanic(t *testing.T) {
+	tests := []struct {
+		name  string
+		event json.RawMessage
+		db    *mockDB
+	}{
+		{
+			name:  "route handler",
+			event: makeEvent("GET", "/uploads/{id}/status", "", map[string]string{"id": "batch-1"}, nil),
+			db: &mockDB{queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+				var rows map[string]any
+				rows["oops"] = 1 // assignment to nil map
+				return nil, nil
+			}},
+		},
+		{
+			name:  "warmer",
+			event: json.RawMessage(`{"source":"logbook.warmer"}`),
+			db: &mockDB{pingFn: func(ctx context.Context) error {
+				panic("driver bug")
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(tt.db)
+			resp, err := h.Handle(context.Background(), tt.event)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.StatusCode != 500 {
+				t.Errorf("status = %d, want 500", resp.StatusCode)
+			}
+			if code, msg := parseError(t, resp.Body); code != "INTERNAL_ERROR" || strings.Contains(msg, "nil map") {
+				t.Errorf("error = %q %q", code, msg)
+			}
+			if resp.Headers["Access-Control-Allow-Origin"] == "" {
+				t.Error("panic response should carry CORS headers")
+			}
+		})
+	}
+}
+
+func TestCORSAllowlist(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://app.example.com")
+	h := newTestHandler(&mockDB{})
+
+	for _, tt := range []struct {
+		origin string
+		want   string
+	}{
+		{"https://app.example.com", "https://app.example.com"},
+		{"https://evil.example.com", ""},
+	} {
+		event := events.APIGatewayProxyRequest{
+			HTTPMethod: "GET",
+			Resource:   "/unknown",
+			Headers:    map[string]string{"origin": tt.origin},
+		}
+		raw, _ := json.Marshal(event)
+		resp, err := h.Handle(context.Background(), raw)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got := resp.Headers["Access-Control-Allow-Origin"]; got != tt.want {
+			t.Errorf("origin %s: Allow-Origin = %q, want %q", tt.origin, got, tt.want)
+		}
+		if resp.Headers["Vary"] != "Origin" {
+			t.Errorf("origin %s: expected Vary: Origin", tt.origin)
+		}
+	}
+}
+
+func TestPreflight(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://app.example.com")
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			t.Errorf("preflight should not hit the database: %s", sql)
+			return nil, nil
+		},
+	}
+	h := newTestHandler(db)
+
+	tests := []struct {
+		name       string
+		resource   string
+		pathParams map[string]string
+	}{
+		{"uploads", "/uploads", nil},
+		{"aircraft entry", "/aircraft/{tailNumber}/entries/{entryId}", map[string]string{"tailNumber": "N123", "entryId": "e-1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := events.APIGatewayProxyRequest{
+				HTTPMethod:     "OPTIONS",
+				Resource:       tt.resource,
+				PathParameters: tt.pathParams,
+				Headers:        map[string]string{"Origin": "https://app.example.com"},
+			}
+			raw, _ := json.Marshal(event)
+			resp, err := h.Handle(context.Background(), raw)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.StatusCode != 204 {
+				t.Errorf("status = %d, want 204", resp.StatusCode)
+			}
+			if got := resp.Headers["Access-Control-Allow-Origin"]; got != "https://app.example.com" {
+				t.Errorf("Allow-Origin = %q", got)
+			}
+			if !strings.Contains(resp.Headers["Access-Control-Allow-Methods"], "PATCH") {
+				t.Errorf("Allow-Methods = %q, want PATCH included", resp.Headers["Access-Control-Allow-Methods"])
+			}
+			if !strings.Contains(resp.Headers["Access-Control-Allow-Headers"], "X-Api-Key") {
+				t.Errorf("Allow-Headers = %q, want X-Api-Key included", resp.Headers["Access-Control-Allow-Headers"])
+			}
+			if resp.Headers["Access-Control-Max-Age"] == "" {
+				t.Error("expected Access-Control-Max-Age")
+			}
+		})
+	}
+}
+
 func TestHandleUpload(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -233,8 +655,10 @@ func TestHandleUpload(t *testing.T) {
 			}
 
 			if tt.wantErr != "" {
-				body := parseBody(t, resp.Body)
-				errMsg, _ := body["error"].(string)
+				code, errMsg := parseError(t, resp.Body)
+				if code != "VALIDATION_ERROR" {
+					t.Errorf("code = %q, want VALIDATION_ERROR", code)
+				}
 				if !strings.Contains(errMsg, tt.wantErr) {
 					t.Errorf("error = %q, want to contain %q", errMsg, tt.wantErr)
 				}
@@ -348,64 +772,449 @@ func TestHandlePageImage(t *testing.T) {
 	}
 }
 
-func TestHandleListUploads(t *testing.T) {
-	db := &mockDB{
-		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
-			return []map[string]any{
-				{"id": "upload-1", "logbook_type": "airframe"},
-				{"id": "upload-2", "logbook_type": "engine"},
-			}, nil
-		},
+func TestPresignTTL(t *testing.T) {
+	tests := []struct {
+		name             string
+		putTTL, getTTL   time.Duration
+		wantPut, wantGet time.Duration
+	}{
+		{name: "defaults", wantPut: time.Hour, wantGet: time.Hour},
+		{name: "configured", putTTL: 6 * time.Hour, getTTL: 15 * time.Minute, wantPut: 6 * time.Hour, wantGet: 15 * time.Minute},
+		{name: "over the S3 maximum", putTTL: 30 * 24 * time.Hour, getTTL: 8 * 24 * time.Hour, wantPut: maxPresignTTL, wantGet: maxPresignTTL},
 	}
-	h := newTestHandler(db)
 
-	event := makeEvent("GET", "/aircraft/{tailNumber}/uploads", "",
-		map[string]string{"tailNumber": "N123AB"}, nil)
-	resp, err := h.Handle(context.Background(), event)
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
-	}
-	if resp.StatusCode != 200 {
-		t.Errorf("status = %d, want 200", resp.StatusCode)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotPut, gotGet []time.Duration
+			h := newTestHandler(&mockDB{
+				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+					return []map[string]any{{"image_path": "pages/batch-1/page_0001.jpg"}}, nil
+				},
+				insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+					return "test-uuid-123", nil
+				},
+			})
+			h.s3 = &mockS3{
+				presignPutFn: func(ctx context.Context, bucket, key, contentType string, expires time.Duration) (string, error) {
+					gotPut = append(gotPut, expires)
+					return "https://s3.example.com/presigned-put", nil
+				},
+				presignGetFn: func(ctx context.Context, bucket, key string, expires time.Duration) (string, error) {
+					gotGet = append(gotGet, expires)
+					return "https://s3.example.com/presigned-get", nil
+				},
+			}
+			h.presignPutTTL = tt.putTTL
+			h.presignGetTTL = tt.getTTL
+
+			for _, event := range []json.RawMessage{
+				makeEvent("POST", "/uploads", `{"tailNumber":"N123","files":[{"filename":"log.pdf"}]}`, nil, nil),
+				makeEvent("POST", "/uploads", `{"tailNumber":"N123","files":[{"filename":"p1.jpg"},{"filename":"p2.jpg"}]}`, nil, nil),
+				makeEvent("GET", "/uploads/{id}/pages/{pageNumber}/image", "",
+					map[string]string{"id": "batch-1", "pageNumber": "1"}, nil),
+			} {
+				resp, err := h.Handle(context.Background(), event)
+				if err != nil || resp.StatusCode != 200 {
+					t.Fatalf("status = %d, err = %v, body: %s", resp.StatusCode, err, resp.Body)
+				}
+			}
+
+			if len(gotPut) != 3 || len(gotGet) != 1 {
+				t.Fatalf("presigned %d PUTs and %d GETs, want 3 and 1", len(gotPut), len(gotGet))
+			}
+			for _, d := range gotPut {
+				if d != tt.wantPut {
+					t.Errorf("PUT expiry = %s, want %s", d, tt.wantPut)
+				}
+			}
+			if gotGet[0] != tt.wantGet {
+				t.Errorf("GET expiry = %s, want %s", gotGet[0], tt.wantGet)
+			}
+		})
 	}
+}
 
-	body := parseBody(t, resp.Body)
-	if body["tailNumber"] != "N123AB" {
-		t.Errorf("tailNumber = %v, want N123AB", body["tailNumber"])
+func testPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("encode png: %v", err)
 	}
+	return buf.Bytes()
 }
 
-func TestHandleSummary(t *testing.T) {
+func TestHandlePageThumbnail(t *testing.T) {
+	pageImage := testPNG(t, 1200, 1600)
+	const thumbKey = "thumbnails/batch-1/page_0001.jpg"
+
 	tests := []struct {
 		name       string
+		pageNumber string
 		queryRows  []map[string]any
+		thumbCache []byte
+		pageImage  []byte
 		wantStatus int
+		wantCached bool
+		wantPut    bool
 	}{
 		{
-			name:       "aircraft not found",
+			name:       "invalid page number",
+			pageNumber: "abc",
+			wantStatus: 400,
+		},
+		{
+			name:       "page not found",
+			pageNumber: "1",
 			queryRows:  nil,
 			wantStatus: 404,
 		},
 		{
-			name:       "aircraft found",
-			queryRows:  []map[string]any{{"id": "aircraft-1", "registration": "N123AB"}},
+			name:       "cache miss generates and uploads thumbnail",
+			pageNumber: "1",
+			queryRows:  []map[string]any{{"image_path": "pages/batch-1/page_0001.jpg"}},
+			pageImage:  pageImage,
+			wantStatus: 200,
+			wantPut:    true,
+		},
+		{
+			name:       "cache hit reuses thumbnail",
+			pageNumber: "1",
+			queryRows:  []map[string]any{{"image_path": "pages/batch-1/page_0001.jpg"}},
+			thumbCache: []byte("cached-thumb"),
 			wantStatus: 200,
+			wantCached: true,
+		},
+		{
+			name:       "undecodable page image",
+			pageNumber: "1",
+			queryRows:  []map[string]any{{"image_path": "pages/batch-1/page_0001.jpg"}},
+			pageImage:  []byte("not an image"),
+			wantStatus: 422,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			callCount := 0
 			db := &mockDB{
 				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
-					callCount++
-					if callCount == 1 {
-						return tt.queryRows, nil
-					}
-					return nil, nil
+					return tt.queryRows, nil
 				},
 			}
-			h := newTestHandler(db)
+			var putKey string
+			var putBody []byte
+			s3 := &mockS3{
+				getObjectFn: func(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+					switch key {
+					case thumbKey:
+						if tt.thumbCache == nil {
+							return nil, fmt.Errorf("NoSuchKey")
+						}
+						return io.NopCloser(bytes.NewReader(tt.thumbCache)), nil
+					case "pages/batch-1/page_0001.jpg":
+						return io.NopCloser(bytes.NewReader(tt.pageImage)), nil
+					}
+					return nil, fmt.Errorf("unexpected key %s", key)
+				},
+				putObjectFn: func(ctx context.Context, bucket, key, contentType string, body io.Reader) error {
+					putKey = key
+					putBody, _ = io.ReadAll(body)
+					if contentType != "image/jpeg" {
+						t.Errorf("contentType = %q, want image/jpeg", contentType)
+					}
+					return nil
+				},
+				presignGetFn: func(ctx context.Context, bucket, key string, expires time.Duration) (string, error) {
+					return "https://s3.example.com/" + key, nil
+				},
+			}
+			h := newTestHandler(db)
+			h.s3 = s3
+
+			event := makeEvent("GET", "/uploads/{id}/pages/{pageNumber}/thumbnail", "",
+				map[string]string{"id": "batch-1", "pageNumber": tt.pageNumber}, nil)
+			resp, err := h.Handle(context.Background(), event)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body = %s", resp.StatusCode, tt.wantStatus, resp.Body)
+			}
+
+			if tt.wantPut {
+				if putKey != thumbKey {
+					t.Errorf("put key = %q, want %q", putKey, thumbKey)
+				}
+				cfg, err := jpeg.DecodeConfig(bytes.NewReader(putBody))
+				if err != nil {
+					t.Fatalf("uploaded thumbnail is not a JPEG: %v", err)
+				}
+				if cfg.Width != 300 || cfg.Height != 400 {
+					t.Errorf("thumbnail size = %dx%d, want 300x400", cfg.Width, cfg.Height)
+				}
+			} else if putKey != "" {
+				t.Errorf("unexpected upload to %q", putKey)
+			}
+
+			if tt.wantStatus != 200 {
+				return
+			}
+			body := parseBody(t, resp.Body)
+			if body["thumbnailUrl"] != "https://s3.example.com/"+thumbKey {
+				t.Errorf("thumbnailUrl = %v", body["thumbnailUrl"])
+			}
+			if body["cached"] != tt.wantCached {
+				t.Errorf("cached = %v, want %v", body["cached"], tt.wantCached)
+			}
+		})
+	}
+}
+
+func TestHandleSliceDiagnostics(t *testing.T) {
+	// Three dark bands separated by wide gaps, as in the slicer's own tests.
+	img := image.NewGray(image.Rect(0, 0, 200, 600))
+	for y := 0; y < 600; y++ {
+		dark := (y >= 50 && y < 130) || (y >= 230 && y < 330) || (y >= 430 && y < 530)
+		for x := 0; x < 200; x++ {
+			if !dark {
+				img.SetGray(x, y, color.Gray{Y: 255})
+			}
+		}
+	}
+	var page bytes.Buffer
+	if err := png.Encode(&page, img); err != nil {
+		t.Fatalf("encode png: %v", err)
+	}
+
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			return []map[string]any{{"image_path": "pages/batch-1/page_0002.png"}}, nil
+		},
+	}
+	h := newTestHandler(db)
+	h.slicerDiagnostics = true
+	h.adminKeys = map[string]bool{"admin-key": true}
+	h.s3 = &mockS3{
+		getObjectFn: func(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+			if key != "pages/batch-1/page_0002.png" {
+				return nil, fmt.Errorf("NoSuchKey")
+			}
+			return io.NopCloser(bytes.NewReader(page.Bytes())), nil
+		},
+	}
+
+	pathParams := map[string]string{"id": "batch-1", "pageNumber": "2"}
+	resp, err := h.Handle(context.Background(), keyedEvent("GET", "/uploads/{id}/pages/{pageNumber}/slices/diag", "", "tenant-key", pathParams))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if code, _ := parseError(t, resp.Body); resp.StatusCode != 403 || code != codeForbidden {
+		t.Errorf("non-admin: status = %d, code = %q, want 403 %s", resp.StatusCode, code, codeForbidden)
+	}
+
+	resp, err = h.Handle(context.Background(), keyedEvent("GET", "/uploads/{id}/pages/{pageNumber}/slices/diag", "", "admin-key", pathParams))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("status = %d, body = %s", resp.StatusCode, resp.Body)
+	}
+
+	body := parseBody(t, resp.Body)
+	if body["height"] != float64(600) || len(body["profile"].([]any)) != 600 {
+		t.Errorf("height = %v, profile rows = %d", body["height"], len(body["profile"].([]any)))
+	}
+	if opts := body["options"].(map[string]any); opts["dilationRadius"] == nil {
+		t.Errorf("options = %v, want scaled spatial parameters", opts)
+	}
+	absorbed := body["absorbedRegions"].([]any)
+	if len(absorbed) != 3 || len(body["slices"].([]any)) != 3 {
+		t.Fatalf("absorbed = %v, slices = %v, want 3 of each", absorbed, body["slices"])
+	}
+	for i, r := range absorbed {
+		m := r.(map[string]any)
+		if m["height"] != m["y1"].(float64)-m["y0"].(float64) || m["gap"] == nil {
+			t.Errorf("region %d = %v", i, m)
+		}
+	}
+}
+
+func TestHandleSliceDiagnostics_Disabled(t *testing.T) {
+	h := newTestHandler(&mockDB{})
+
+	event := makeEvent("GET", "/uploads/{id}/pages/{pageNumber}/slices/diag", "",
+		map[string]string{"id": "batch-1", "pageNumber": "2"}, nil)
+	resp, err := h.Handle(context.Background(), event)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if code, _ := parseError(t, resp.Body); resp.StatusCode != 404 || code != "ROUTE_NOT_FOUND" {
+		t.Errorf("status = %d, code = %q, want 404 ROUTE_NOT_FOUND when diagnostics are off", resp.StatusCode, code)
+	}
+}
+
+func TestHandleSlicesZip(t *testing.T) {
+	// The page now numbered 2 was page 5 when it was analyzed; the page
+	// that was number 2 then has been moved since.
+	objects := map[string]string{
+		"slices/batch-1/page_0005/slice_000_0123456789abcdef.jpg": "first slice",
+		"slices/batch-1/page_0005/slice_001_fedcba9876543210.jpg": "second slice",
+		"slices/batch-1/page_0002/slice_000_aaaaaaaaaaaaaaaa.jpg": "another page's slice",
+	}
+	sliceKeys := []map[string]any{
+		{"slice_key": "slices/batch-1/page_0005/slice_000_0123456789abcdef.jpg"},
+		{"slice_key": "slices/batch-1/page_0005/slice_001_fedcba9876543210.jpg"},
+	}
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			switch {
+			case strings.Contains(sql, "FROM upload_batches"):
+				return []map[string]any{{"id": "batch-1"}}, nil
+			case strings.Contains(sql, "FROM maintenance_entries"):
+				if args[0] != "page-2" {
+					t.Errorf("slices looked up for page %v, want page-2", args[0])
+				}
+				return sliceKeys, nil
+			case args[1] == 2:
+				return []map[string]any{{"id": "page-2"}}, nil
+			}
+			return nil, nil
+		},
+	}
+	h := newTestHandler(db)
+	h.s3 = &mockS3{
+		getObjectFn: func(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+			data, ok := objects[key]
+			if !ok {
+				return nil, fmt.Errorf("no such key %s", key)
+			}
+			return io.NopCloser(strings.NewReader(data)), nil
+		},
+	}
+
+	resp, err := h.Handle(context.Background(), makeEvent("GET", "/uploads/{id}/pages/{pageNumber}/slices.zip", "",
+		map[string]string{"id": "batch-1", "pageNumber": "2"}, nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("status = %d, body: %s", resp.StatusCode, resp.Body)
+	}
+	if resp.Headers["Content-Type"] != "application/zip" {
+		t.Errorf("Content-Type = %q", resp.Headers["Content-Type"])
+	}
+	if got := resp.Headers["Content-Disposition"]; got != "attachment; filename=batch-1-page-0002-slices.zip" {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+	if !resp.IsBase64Encoded {
+		t.Fatal("zip body should be base64-encoded")
+	}
+	body, err := base64.StdEncoding.DecodeString(resp.Body)
+	if err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatalf("open zip: %v", err)
+	}
+	got := map[string]string{}
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatalf("open %s: %v", f.Name, err)
+		}
+		data, _ := io.ReadAll(r)
+		r.Close()
+		got[f.Name] = string(data)
+	}
+	want := map[string]string{
+		"slice_000_0123456789abcdef.jpg": "first slice",
+		"slice_001_fedcba9876543210.jpg": "second slice",
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("zip holds %v, want %v", got, want)
+	}
+
+	// A page with no stored slices.
+	sliceKeys = nil
+	resp, _ = h.Handle(context.Background(), makeEvent("GET", "/uploads/{id}/pages/{pageNumber}/slices.zip", "",
+		map[string]string{"id": "batch-1", "pageNumber": "2"}, nil))
+	if code, _ := parseError(t, resp.Body); resp.StatusCode != 404 || code != codeNoSliceImage {
+		t.Errorf("no slices: status = %d, body: %s", resp.StatusCode, resp.Body)
+	}
+
+	// A page that does not exist.
+	resp, _ = h.Handle(context.Background(), makeEvent("GET", "/uploads/{id}/pages/{pageNumber}/slices.zip", "",
+		map[string]string{"id": "batch-1", "pageNumber": "3"}, nil))
+	if code, _ := parseError(t, resp.Body); resp.StatusCode != 404 || code != codePageNotFound {
+		t.Errorf("missing page: status = %d, body: %s", resp.StatusCode, resp.Body)
+	}
+
+	resp, _ = h.Handle(context.Background(), makeEvent("GET", "/uploads/{id}/pages/{pageNumber}/slices.zip", "",
+		map[string]string{"id": "batch-1", "pageNumber": "0"}, nil))
+	if resp.StatusCode != 400 {
+		t.Errorf("page 0: status = %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestHandleListUploads(t *testing.T) {
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			return []map[string]any{
+				{"id": "upload-1", "logbook_type": "airframe"},
+				{"id": "upload-2", "logbook_type": "engine"},
+			}, nil
+		},
+	}
+	h := newTestHandler(db)
+
+	event := makeEvent("GET", "/aircraft/{tailNumber}/uploads", "",
+		map[string]string{"tailNumber": "N123AB"}, nil)
+	resp, err := h.Handle(context.Background(), event)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+
+	body := parseBody(t, resp.Body)
+	if body["tailNumber"] != "N123AB" {
+		t.Errorf("tailNumber = %v, want N123AB", body["tailNumber"])
+	}
+}
+
+func TestHandleSummary(t *testing.T) {
+	tests := []struct {
+		name       string
+		queryRows  []map[string]any
+		wantStatus int
+	}{
+		{
+			name:       "aircraft not found",
+			queryRows:  nil,
+			wantStatus: 404,
+		},
+		{
+			name:       "aircraft found",
+			queryRows:  []map[string]any{{"id": "aircraft-1", "registration": "N123AB"}},
+			wantStatus: 200,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			callCount := 0
+			db := &mockDB{
+				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+					callCount++
+					if callCount == 1 {
+						return tt.queryRows, nil
+					}
+					return nil, nil
+				},
+			}
+			h := newTestHandler(db)
 
 			event := makeEvent("GET", "/aircraft/{tailNumber}/summary", "",
 				map[string]string{"tailNumber": "N123AB"}, nil)
@@ -420,6 +1229,82 @@ func TestHandleSummary(t *testing.T) {
 	}
 }
 
+func TestHandleSummary_CalendarChecks(t *testing.T) {
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			switch {
+			case strings.Contains(sql, "FROM aircraft"):
+				return []map[string]any{{"id": "aircraft-1", "registration": "N123AB"}}, nil
+			case strings.Contains(sql, "flight_time::float8 AS hours"):
+				return []map[string]any{{"flight_time": 123456789.9, "hours": 123456789.9}}, nil
+			case strings.Contains(sql, "DISTINCT ON (ir.inspection_type)"):
+				return []map[string]any{
+					{"inspection_type": "altimeter_static", "entry_date": "2023-03-01", "flight_time": 1810.2, "next_due_date": "2025-03-31"},
+					{"inspection_type": "elt", "entry_date": "2024-05-10", "flight_time": 1902.5, "next_due_date": "2025-05-31"},
+					{"inspection_type": "transponder", "entry_date": "2023-03-02", "flight_time": nil, "next_due_date": "2025-03-31"},
+				}, nil
+			}
+			return nil, nil
+		},
+	}
+	h := newTestHandler(db)
+
+	event := makeEvent("GET", "/aircraft/{tailNumber}/summary", "",
+		map[string]string{"tailNumber": "N123AB"}, nil)
+	resp, err := h.Handle(context.Background(), event)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("status = %d, body: %s", resp.StatusCode, resp.Body)
+	}
+
+	body := parseBody(t, resp.Body)
+	want := map[string]string{
+		"lastElt":             "map[entry_date:2024-05-10 flight_time:1902.5 next_due_date:2025-05-31]",
+		"lastAltimeterStatic": "map[entry_date:2023-03-01 flight_time:1810.2 next_due_date:2025-03-31]",
+		"lastTransponder":     "map[entry_date:2023-03-02 flight_time:<nil> next_due_date:2025-03-31]",
+	}
+	for key, w := range want {
+		if got := fmt.Sprint(body[key]); got != w {
+			t.Errorf("%s = %s, want %s", key, got, w)
+		}
+	}
+	if _, ok := body["lastAnnual"]; !ok {
+		t.Error("lastAnnual missing from response")
+	}
+	if body["totalTimeFormatted"] != "123456789.9" {
+		t.Errorf("totalTimeFormatted = %v, want 123456789.9", body["totalTimeFormatted"])
+	}
+}
+
+func TestHandleSummary_NoCalendarChecks(t *testing.T) {
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			if strings.Contains(sql, "FROM aircraft") {
+				return []map[string]any{{"id": "aircraft-1", "registration": "N123AB"}}, nil
+			}
+			return nil, nil
+		},
+	}
+	h := newTestHandler(db)
+
+	event := makeEvent("GET", "/aircraft/{tailNumber}/summary", "",
+		map[string]string{"tailNumber": "N123AB"}, nil)
+	resp, err := h.Handle(context.Background(), event)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	body := parseBody(t, resp.Body)
+	for _, key := range []string{"lastElt", "lastAltimeterStatic", "lastTransponder", "totalTimeFormatted"} {
+		v, ok := body[key]
+		if !ok || v != nil {
+			t.Errorf("%s = %v (present %v), want null", key, v, ok)
+		}
+	}
+}
+
 func TestHandleEntries(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -484,242 +1369,427 @@ func TestHandleEntries(t *testing.T) {
 	}
 }
 
-func TestHandleEntryDetail(t *testing.T) {
+func TestHandleSearchEntries(t *testing.T) {
 	tests := []struct {
 		name       string
-		hasAircraft bool
-		hasEntry   bool
+		query      map[string]string
+		rows       []map[string]any
 		wantStatus int
+		wantQuery  string
+		wantIDs    []string
+		wantMarks  []string
 	}{
-		{"aircraft not found", false, false, 404},
-		{"entry not found", true, false, 404},
-		{"success", true, true, 200},
+		{
+			name:       "missing q",
+			query:      map[string]string{"q": "  "},
+			wantStatus: 400,
+		},
+		{
+			name:  "single term ranked",
+			query: map[string]string{"q": "magneto"},
+			rows: []map[string]any{
+				{"id": "entry-2", "rank": 0.09, "snippet": "Replaced left <mark>magneto</mark>. Timed <mark>magneto</mark> to engine."},
+				{"id": "entry-1", "rank": 0.06, "snippet": "Inspected <mark>magneto</mark> points."},
+			},
+			wantStatus: 200,
+			wantQuery:  "magneto",
+			wantIDs:    []string{"entry-2", "entry-1"},
+			wantMarks:  []string{"<mark>magneto</mark>"},
+		},
+		{
+			name:  "multi-word",
+			query: map[string]string{"q": "magneto timing", "limit": "5"},
+			rows: []map[string]any{
+				{"id": "entry-3", "rank": 0.1, "snippet": "Checked <mark>magneto</mark> <mark>timing</mark>, 25° BTC."},
+			},
+			wantStatus: 200,
+			wantQuery:  "magneto timing",
+			wantIDs:    []string{"entry-3"},
+			wantMarks:  []string{"<mark>magneto</mark>", "<mark>timing</mark>"},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			callCount := 0
+			var searchSQL string
+			var searchArgs []any
 			db := &mockDB{
 				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
-					callCount++
-					if callCount == 1 { // aircraft lookup
-						if !tt.hasAircraft {
-							return nil, nil
-						}
+					switch {
+					case strings.Contains(sql, "FROM aircraft"):
 						return []map[string]any{{"id": "aid-1"}}, nil
+					case strings.Contains(sql, "COUNT"):
+						return []map[string]any{{"total": int64(len(tt.rows))}}, nil
 					}
-					if callCount == 2 { // entry lookup
-						if !tt.hasEntry {
-							return nil, nil
-						}
-						return []map[string]any{{"id": "entry-1", "entry_type": "maintenance"}}, nil
-					}
-					return nil, nil
+					searchSQL, searchArgs = sql, args
+					return tt.rows, nil
 				},
 			}
 			h := newTestHandler(db)
 
-			event := makeEvent("GET", "/aircraft/{tailNumber}/entries/{entryId}", "",
-				map[string]string{"tailNumber": "N123", "entryId": "entry-1"}, nil)
+			event := makeEvent("GET", "/aircraft/{tailNumber}/entries/search", "",
+				map[string]string{"tailNumber": "N123"}, tt.query)
 			resp, err := h.Handle(context.Background(), event)
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
 			if resp.StatusCode != tt.wantStatus {
-				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+				t.Fatalf("status = %d, want %d, body: %s", resp.StatusCode, tt.wantStatus, resp.Body)
+			}
+			if tt.wantStatus != 200 {
+				if code, _ := parseError(t, resp.Body); code != codeValidation {
+					t.Errorf("code = %q, want %q", code, codeValidation)
+				}
+				return
 			}
-		})
-	}
-}
 
-func TestHandleUpdateEntry(t *testing.T) {
-	tests := []struct {
-		name       string
-		body       string
-		wantStatus int
-		wantErr    string
-	}{
-		{
-			name:       "empty body",
-			body:       "{}",
-			wantStatus: 400,
-			wantErr:    "Request body is required",
-		},
-		{
-			name:       "invalid review status",
-			body:       `{"reviewStatus":"invalid"}`,
-			wantStatus: 400,
-			wantErr:    "reviewStatus must be",
-		},
-		{
-			name:       "successful update",
-			body:       `{"shopName":"New Shop","reviewStatus":"approved","reviewedBy":"user1"}`,
-			wantStatus: 200,
-		},
+			if !strings.Contains(searchSQL, "websearch_to_tsquery('english', $2)") ||
+				!strings.Contains(searchSQL, "ORDER BY rank DESC") {
+				t.Errorf("search SQL not ranked full-text: %s", searchSQL)
+			}
+			if searchArgs[1] != tt.wantQuery {
+				t.Errorf("query arg = %v, want %q", searchArgs[1], tt.wantQuery)
+			}
+
+			body := parseBody(t, resp.Body)
+			entries := body["entries"].([]any)
+			if len(entries) != len(tt.wantIDs) {
+				t.Fatalf("entries = %v", entries)
+			}
+			prevRank := 1.0
+			for i, e := range entries {
+				entry := e.(map[string]any)
+				if entry["id"] != tt.wantIDs[i] {
+					t.Errorf("entries[%d] = %v, want %s", i, entry["id"], tt.wantIDs[i])
+				}
+				rank := entry["rank"].(float64)
+				if rank > prevRank {
+					t.Errorf("entries not in rank order: %v", entries)
+				}
+				prevRank = rank
+				for _, mark := range tt.wantMarks {
+					if !strings.Contains(entry["snippet"].(string), mark) {
+						t.Errorf("snippet %q missing %s", entry["snippet"], mark)
+					}
+				}
+			}
+			if body["query"] != tt.wantQuery {
+				t.Errorf("query = %v", body["query"])
+			}
+			if pagination := body["pagination"].(map[string]any); pagination["total"] != float64(len(tt.rows)) {
+				t.Errorf("pagination = %v", pagination)
+			}
+		})
+	}
+}
+
+func TestHandleEntries_Sort(t *testing.T) {
+	tests := []struct {
+		sort       string
+		wantStatus int
+		wantOrder  string
+	}{
+		{"", 200, "ORDER BY me.entry_date DESC"},
+		{"date", 200, "ORDER BY me.entry_date ASC"},
+		{"-date", 200, "ORDER BY me.entry_date DESC"},
+		{"confidence", 200, "ORDER BY me.confidence_score ASC NULLS LAST"},
+		{"-confidence", 200, "ORDER BY me.confidence_score DESC NULLS LAST"},
+		{"created", 200, "ORDER BY me.created_at ASC"},
+		{"me.id; DROP TABLE aircraft", 400, ""},
+		{"shop", 400, ""},
 	}
 
 	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
+		t.Run("sort="+tt.sort, func(t *testing.T) {
+			var listSQL string
 			callCount := 0
 			db := &mockDB{
 				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
 					callCount++
-					if callCount == 1 { // aircraft lookup
+					if callCount == 1 {
 						return []map[string]any{{"id": "aid-1"}}, nil
 					}
-					// UPDATE RETURNING or subsequent queries
-					return []map[string]any{{"id": "entry-1", "entry_type": "maintenance"}}, nil
+					if strings.Contains(sql, "COUNT") {
+						return []map[string]any{{"total": int64(1)}}, nil
+					}
+					listSQL = sql
+					return []map[string]any{{"id": "entry-1"}}, nil
 				},
 			}
 			h := newTestHandler(db)
 
-			event := makeEvent("PATCH", "/aircraft/{tailNumber}/entries/{entryId}", tt.body,
-				map[string]string{"tailNumber": "N123", "entryId": "entry-1"}, nil)
+			var qp map[string]string
+			if tt.sort != "" {
+				qp = map[string]string{"sort": tt.sort}
+			}
+			event := makeEvent("GET", "/aircraft/{tailNumber}/entries", "",
+				map[string]string{"tailNumber": "N123"}, qp)
 			resp, err := h.Handle(context.Background(), event)
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
 			if resp.StatusCode != tt.wantStatus {
-				t.Errorf("status = %d, want %d, body: %s", resp.StatusCode, tt.wantStatus, resp.Body)
+				t.Fatalf("status = %d, want %d, body: %s", resp.StatusCode, tt.wantStatus, resp.Body)
 			}
-			if tt.wantErr != "" {
-				body := parseBody(t, resp.Body)
-				errMsg, _ := body["error"].(string)
-				if !strings.Contains(errMsg, tt.wantErr) {
-					t.Errorf("error = %q, want to contain %q", errMsg, tt.wantErr)
+			if tt.wantStatus == 400 {
+				if listSQL != "" {
+					t.Errorf("entries query should not run for invalid sort")
 				}
+				return
+			}
+			if !strings.Contains(listSQL, tt.wantOrder) {
+				t.Errorf("query missing %q:\n%s", tt.wantOrder, listSQL)
 			}
 		})
 	}
 }
 
-func TestHandleInspections(t *testing.T) {
-	callCount := 0
-	db := &mockDB{
-		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
-			callCount++
-			if callCount == 1 { // aircraft lookup
-				return []map[string]any{{"id": "aid-1"}}, nil
-			}
-			if strings.Contains(sql, "COUNT") {
-				return []map[string]any{{"total": int64(3)}}, nil
-			}
-			return []map[string]any{
-				{"id": "insp-1", "inspection_type": "annual"},
-			}, nil
-		},
+func TestHandleInspectionsAndAds_Sort(t *testing.T) {
+	tests := []struct {
+		resource   string
+		sort       string
+		wantStatus int
+		wantOrder  string
+	}{
+		{"/aircraft/{tailNumber}/inspections", "date", 200, "ORDER BY ir.inspection_date ASC"},
+		{"/aircraft/{tailNumber}/inspections", "-created", 200, "ORDER BY ir.created_at DESC"},
+		{"/aircraft/{tailNumber}/inspections", "confidence", 400, ""},
+		{"/aircraft/{tailNumber}/ads", "", 200, "ORDER BY ad.compliance_date DESC"},
+		{"/aircraft/{tailNumber}/ads", "created", 200, "ORDER BY ad.created_at ASC"},
+		{"/aircraft/{tailNumber}/ads", "bogus", 400, ""},
 	}
-	h := newTestHandler(db)
 
-	event := makeEvent("GET", "/aircraft/{tailNumber}/inspections", "",
-		map[string]string{"tailNumber": "N123"}, nil)
-	resp, err := h.Handle(context.Background(), event)
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
-	}
-	if resp.StatusCode != 200 {
-		t.Errorf("status = %d, want 200", resp.StatusCode)
-	}
-}
+	for _, tt := range tests {
+		t.Run(tt.resource+"?sort="+tt.sort, func(t *testing.T) {
+			var listSQL string
+			callCount := 0
+			db := &mockDB{
+				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+					callCount++
+					if callCount == 1 {
+						return []map[string]any{{"id": "aid-1"}}, nil
+					}
+					if strings.Contains(sql, "COUNT") {
+						return []map[string]any{{"total": int64(1)}}, nil
+					}
+					if strings.Contains(sql, "LIMIT") {
+						listSQL = sql
+					}
+					return []map[string]any{{"id": "row-1"}}, nil
+				},
+			}
+			h := newTestHandler(db)
 
-func TestHandleAds(t *testing.T) {
-	callCount := 0
-	db := &mockDB{
-		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
-			callCount++
-			if callCount == 1 { // aircraft lookup
-				return []map[string]any{{"id": "aid-1"}}, nil
+			var qp map[string]string
+			if tt.sort != "" {
+				qp = map[string]string{"sort": tt.sort}
 			}
-			if strings.Contains(sql, "COUNT") {
-				return []map[string]any{{"total": int64(2)}}, nil
+			event := makeEvent("GET", tt.resource, "", map[string]string{"tailNumber": "N123"}, qp)
+			resp, err := h.Handle(context.Background(), event)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
 			}
-			return []map[string]any{
-				{"id": "ad-1", "ad_number": "AD-2024-001"},
-			}, nil
-		},
-	}
-	h := newTestHandler(db)
-
-	event := makeEvent("GET", "/aircraft/{tailNumber}/ads", "",
-		map[string]string{"tailNumber": "N123"}, nil)
-	resp, err := h.Handle(context.Background(), event)
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
-	}
-	if resp.StatusCode != 200 {
-		t.Errorf("status = %d, want 200", resp.StatusCode)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body: %s", resp.StatusCode, tt.wantStatus, resp.Body)
+			}
+			if tt.wantStatus == 200 && !strings.Contains(listSQL, tt.wantOrder) {
+				t.Errorf("query missing %q:\n%s", tt.wantOrder, listSQL)
+			}
+		})
 	}
 }
 
-func TestHandleParts(t *testing.T) {
+func TestHandleEntries_ShopMechanicFilters(t *testing.T) {
 	tests := []struct {
 		name        string
 		queryParams map[string]string
-		wantStatus  int
+		wantClauses []string
+		wantArgs    []any
 	}{
-		{"default active parts", nil, 200},
-		{"all parts", map[string]string{"status": "all"}, 200},
+		{
+			name:        "shop only",
+			queryParams: map[string]string{"shop": "acme"},
+			wantClauses: []string{"me.shop_name ILIKE $2"},
+			wantArgs:    []any{"aid-1", "%acme%"},
+		},
+		{
+			name:        "mechanic only",
+			queryParams: map[string]string{"mechanic": "J. Smith"},
+			wantClauses: []string{"me.mechanic_name ILIKE $2"},
+			wantArgs:    []any{"aid-1", "%J. Smith%"},
+		},
+		{
+			name:        "combined with type",
+			queryParams: map[string]string{"type": "inspection", "shop": "acme", "mechanic": "smith"},
+			wantClauses: []string{"me.entry_type = $2", "me.shop_name ILIKE $3", "me.mechanic_name ILIKE $4"},
+			wantArgs:    []any{"aid-1", "inspection", "%acme%", "%smith%"},
+		},
+		{
+			name:        "wildcards escaped",
+			queryParams: map[string]string{"shop": "100%_air"},
+			wantClauses: []string{"me.shop_name ILIKE $2"},
+			wantArgs:    []any{"aid-1", `%100\%\_air%`},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			var countSQL, listSQL string
+			var countArgs []any
 			callCount := 0
 			db := &mockDB{
 				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
 					callCount++
-					if callCount == 1 { // aircraft lookup
+					if callCount == 1 {
 						return []map[string]any{{"id": "aid-1"}}, nil
 					}
-					return []map[string]any{
-						{"id": "part-1", "part_name": "Propeller"},
-					}, nil
+					if strings.Contains(sql, "COUNT") {
+						countSQL, countArgs = sql, args
+						return []map[string]any{{"total": int64(1)}}, nil
+					}
+					listSQL = sql
+					return []map[string]any{{"id": "entry-1"}}, nil
 				},
 			}
 			h := newTestHandler(db)
 
-			event := makeEvent("GET", "/aircraft/{tailNumber}/parts", "",
+			event := makeEvent("GET", "/aircraft/{tailNumber}/entries", "",
 				map[string]string{"tailNumber": "N123"}, tt.queryParams)
 			resp, err := h.Handle(context.Background(), event)
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
 			}
-			if resp.StatusCode != tt.wantStatus {
-				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			if resp.StatusCode != 200 {
+				t.Fatalf("status = %d, body: %s", resp.StatusCode, resp.Body)
+			}
+			for _, c := range tt.wantClauses {
+				if !strings.Contains(countSQL, c) {
+					t.Errorf("count query missing %q: %s", c, countSQL)
+				}
+				if !strings.Contains(listSQL, c) {
+					t.Errorf("list query missing %q: %s", c, listSQL)
+				}
+			}
+			if fmt.Sprint(countArgs) != fmt.Sprint(tt.wantArgs) {
+				t.Errorf("count args = %v, want %v", countArgs, tt.wantArgs)
 			}
 		})
 	}
 }
 
-func TestHandleQuery(t *testing.T) {
+func TestHandleEntries_FilterPlaceholders(t *testing.T) {
+	filters := map[string]string{
+		"type": "inspection", "dateFrom": "2024-01-01", "dateTo": "2024-12-31",
+		"needsReview": "true", "shop": "acme", "mechanic": "smith",
+	}
+	cursor := base64.RawURLEncoding.EncodeToString([]byte(`{"date":"2024-06-01","id":"00000000-0000-4000-8000-000000000001"}`))
+
 	tests := []struct {
-		name       string
-		body       string
-		wantStatus int
+		name        string
+		extra       map[string]string
+		wantClauses []string
+		wantArgs    []any
 	}{
 		{
-			name:       "missing question",
-			body:       `{}`,
-			wantStatus: 400,
+			name:  "offset pagination",
+			extra: map[string]string{"page": "3", "limit": "10"},
+			wantClauses: []string{
+				"me.aircraft_id = $1", "me.entry_type = $2", "me.entry_date >= $3", "me.entry_date <= $4",
+				"me.needs_review = TRUE", "me.shop_name ILIKE $5", "me.mechanic_name ILIKE $6",
+				"LIMIT $7 OFFSET $8",
+			},
+			wantArgs: []any{"aid-1", "inspection", "2024-01-01", "2024-12-31", "%acme%", "%smith%", 10, 20},
 		},
 		{
-			name:       "aircraft not found",
-			body:       `{"question":"When was the last oil change?"}`,
-			wantStatus: 404,
+			name:  "cursor pagination",
+			extra: map[string]string{"cursor": cursor, "limit": "10"},
+			wantClauses: []string{
+				"me.mechanic_name ILIKE $6",
+				"(me.entry_date < $7 OR (me.entry_date = $7 AND me.id > $8))",
+				"LIMIT $9",
+			},
+			wantArgs: []any{"aid-1", "inspection", "2024-01-01", "2024-12-31", "%acme%", "%smith%",
+				"2024-06-01", "00000000-0000-4000-8000-000000000001", 11},
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			var listSQL string
+			var listArgs []any
 			db := &mockDB{
 				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
-					return nil, nil // no aircraft found
+					if strings.Contains(sql, "FROM aircraft") {
+						return []map[string]any{{"id": "aid-1"}}, nil
+					}
+					if strings.Contains(sql, "COUNT") {
+						return []map[string]any{{"total": int64(0)}}, nil
+					}
+					listSQL, listArgs = sql, args
+					return nil, nil
 				},
 			}
 			h := newTestHandler(db)
-			h.gemini = &gemini.MockClient{}
 
-			event := makeEvent("POST", "/aircraft/{tailNumber}/query", tt.body,
-				map[string]string{"tailNumber": "N123"}, nil)
+			params := maps.Clone(filters)
+			maps.Copy(params, tt.extra)
+			resp, err := h.Handle(context.Background(), makeEvent("GET", "/aircraft/{tailNumber}/entries", "",
+				map[string]string{"tailNumber": "N123"}, params))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.StatusCode != 200 {
+				t.Fatalf("status = %d, body: %s", resp.StatusCode, resp.Body)
+			}
+			for _, c := range tt.wantClauses {
+				if !strings.Contains(listSQL, c) {
+					t.Errorf("list query missing %q: %s", c, listSQL)
+				}
+			}
+			if fmt.Sprint(listArgs) != fmt.Sprint(tt.wantArgs) {
+				t.Errorf("list args = %v, want %v", listArgs, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestHandleEntryDetail(t *testing.T) {
+	tests := []struct {
+		name       string
+		hasAircraft bool
+		hasEntry   bool
+		wantStatus int
+	}{
+		{"aircraft not found", false, false, 404},
+		{"entry not found", true, false, 404},
+		{"success", true, true, 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			callCount := 0
+			db := &mockDB{
+				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+					callCount++
+					if callCount == 1 { // aircraft lookup
+						if !tt.hasAircraft {
+							return nil, nil
+						}
+						return []map[string]any{{"id": "aid-1"}}, nil
+					}
+					if callCount == 2 { // entry lookup
+						if !tt.hasEntry {
+							return nil, nil
+						}
+						return []map[string]any{{"id": "entry-1", "entry_type": "maintenance"}}, nil
+					}
+					return nil, nil
+				},
+			}
+			h := newTestHandler(db)
+
+			event := makeEvent("GET", "/aircraft/{tailNumber}/entries/{entryId}", "",
+				map[string]string{"tailNumber": "N123", "entryId": "entry-1"}, nil)
 			resp, err := h.Handle(context.Background(), event)
 			if err != nil {
 				t.Fatalf("unexpected error: %v", err)
@@ -731,91 +1801,363 @@ func TestHandleQuery(t *testing.T) {
 	}
 }
 
-func TestHandleQuery_WithResults(t *testing.T) {
-	callCount := 0
-	db := &mockDB{
-		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
-			callCount++
-			if callCount == 1 { // aircraft lookup
-				return []map[string]any{{"id": "aid-1"}}, nil
-			}
-			// vector search results
-			return []map[string]any{
-				{
-					"chunk_text":             "Oil changed",
-					"chunk_type":             "narrative",
-					"entry_date":             "2024-01-15",
-					"entry_type":             "maintenance",
-					"maintenance_narrative":  "Changed oil and filter",
-					"inspection_type":        nil,
-					"similarity":             0.95,
-				},
-			}, nil
+func TestHandleEntryDetail_Slice(t *testing.T) {
+	tests := []struct {
+		name      string
+		entry     map[string]any
+		wantSlice bool
+	}{
+		{
+			name:  "no slice recorded",
+			entry: map[string]any{"id": "entry-1", "slice_key": nil},
+		},
+		{
+			name: "slice recorded",
+			entry: map[string]any{
+				"id":        "entry-1",
+				"slice_key": "slices/batch-1/page_0002/slice_001.jpg",
+				"slice_y0":  int32(120),
+				"slice_y1":  int32(340),
+			},
+			wantSlice: true,
 		},
 	}
 
-	h := newTestHandler(db)
-	h.gemini = &gemini.MockClient{
-		EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
-			return make([]float32, 768), nil
-		},
-		GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
-			return "The last oil change was performed on January 15, 2024.", nil
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			callCount := 0
+			db := &mockDB{
+				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+					callCount++
+					switch callCount {
+					case 1:
+						return []map[string]any{{"id": "aid-1"}}, nil
+					case 2:
+						return []map[string]any{tt.entry}, nil
+					}
+					return nil, nil
+				},
+			}
+			h := newTestHandler(db)
+			var presignedKey string
+			h.s3 = &mockS3{
+				presignGetFn: func(ctx context.Context, bucket, key string, expires time.Duration) (string, error) {
+					presignedKey = key
+					return "https://s3.example.com/" + key, nil
+				},
+			}
+
+			event := makeEvent("GET", "/aircraft/{tailNumber}/entries/{entryId}", "",
+				map[string]string{"tailNumber": "N123", "entryId": "entry-1"}, nil)
+			resp, err := h.Handle(context.Background(), event)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.StatusCode != 200 {
+				t.Fatalf("status = %d, want 200", resp.StatusCode)
+			}
+
+			entry := parseBody(t, resp.Body)["entry"].(map[string]any)
+			if !tt.wantSlice {
+				if entry["slice"] != nil {
+					t.Errorf("slice = %v, want nil", entry["slice"])
+				}
+				if presignedKey != "" {
+					t.Errorf("unexpected presign for %q", presignedKey)
+				}
+				return
+			}
+
+			slice, ok := entry["slice"].(map[string]any)
+			if !ok {
+				t.Fatalf("slice = %v, want object", entry["slice"])
+			}
+			if slice["key"] != tt.entry["slice_key"] {
+				t.Errorf("slice.key = %v", slice["key"])
+			}
+			if slice["y0"] != float64(120) || slice["y1"] != float64(340) {
+				t.Errorf("slice bounds = (%v, %v), want (120, 340)", slice["y0"], slice["y1"])
+			}
+			if slice["imageUrl"] != "https://s3.example.com/slices/batch-1/page_0002/slice_001.jpg" {
+				t.Errorf("slice.imageUrl = %v", slice["imageUrl"])
+			}
+		})
+	}
+}
+
+func TestHandleRecheckEntry(t *testing.T) {
+	tests := []struct {
+		name            string
+		sliceKey        any
+		qaResponse      string
+		wantStatus      int
+		wantVerdict     string
+		flagged         bool
+		wantNeedsReview bool
+		wantNote        string
+	}{
+		{
+			name:            "pass leaves entry unflagged",
+			sliceKey:        "slices/batch-1/page_0001/slice_000.webp",
+			qaResponse:      `{"results":[{"entryIndex":0,"verdict":"pass","issues":[],"summary":"OK"}]}`,
+			wantStatus:      200,
+			wantVerdict:     "pass",
+			wantNeedsReview: false,
+		},
+		{
+			name:            "pass keeps another check's flag",
+			sliceKey:        "slices/batch-1/page_0001/slice_000.jpg",
+			qaResponse:      `{"results":[{"entryIndex":0,"verdict":"pass","issues":[],"summary":"OK"}]}`,
+			flagged:         true,
+			wantStatus:      200,
+			wantVerdict:     "pass",
+			wantNeedsReview: false,
+		},
+		{
+			name:            "fail flags entry",
+			sliceKey:        "slices/batch-1/page_0001/slice_000.jpg",
+			qaResponse:      `{"results":[{"entryIndex":0,"verdict":"fail","issues":[{"field":"date","issue":"wrong_value","severity":"critical"}],"summary":"Date misread"}]}`,
+			wantStatus:      200,
+			wantVerdict:     "fail",
+			wantNeedsReview: true,
+			wantNote:        "QA recheck fail: Date misread. ",
+		},
+		{
+			name:            "missing verdict needs review",
+			sliceKey:        "slices/batch-1/page_0001/slice_000.jpg",
+			qaResponse:      `{"results":[]}`,
+			wantStatus:      200,
+			wantVerdict:     "needs_review",
+			wantNeedsReview: true,
+			wantNote:        "QA recheck: QA returned no verdict for this entry. ",
+		},
+		{
+			name:       "no slice recorded",
+			sliceKey:   nil,
+			wantStatus: 409,
 		},
 	}
 
-	event := makeEvent("POST", "/aircraft/{tailNumber}/query",
-		`{"question":"When was the last oil change?"}`,
-		map[string]string{"tailNumber": "N123"}, nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			callCount := 0
+			var updateSQL string
+			var updateArgs, pageArgs []any
+			db := &mockDB{
+				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+					if strings.Contains(sql, "WHERE page_id = $1") {
+						return []map[string]any{{"extraction_notes": "Date unclear. " + tt.wantNote}}, nil
+					}
+					callCount++
+					switch callCount {
+					case 1:
+						return []map[string]any{{"id": "aid-1"}}, nil
+					case 2:
+						return []map[string]any{{
+							"slice_key":            tt.sliceKey,
+							"page_id":              "page-1",
+							"needs_review":         tt.flagged,
+							"date":                 "2024-01-15",
+							"maintenanceNarrative": "Changed oil",
+						}}, nil
+					}
+					return nil, nil
+				},
+				execFn: func(ctx context.Context, sql string, args ...any) error {
+					if strings.Contains(sql, "UPDATE maintenance_entries") {
+						updateSQL, updateArgs = sql, args
+					}
+					if strings.Contains(sql, "UPDATE upload_pages") {
+						pageArgs = args
+					}
+					return nil
+				},
+			}
+			h := newTestHandler(db)
+			var fetchedKey string
+			h.s3 = &mockS3{
+				getObjectFn: func(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+					fetchedKey = key
+					return io.NopCloser(strings.NewReader("slice-bytes")), nil
+				},
+			}
+			var qaMIME, qaPrompt string
+			h.gemini = &gemini.MockClient{
+				GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+					for _, p := range parts {
+						if p.Data != nil {
+							qaMIME = p.MIMEType
+						} else {
+							qaPrompt = p.Text
+						}
+					}
+					return tt.qaResponse, nil
+				},
+			}
+
+			event := makeEvent("POST", "/aircraft/{tailNumber}/entries/{entryId}/recheck", "",
+				map[string]string{"tailNumber": "N123", "entryId": "entry-1"}, nil)
+			resp, err := h.Handle(context.Background(), event)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantStatus != 200 {
+				if updateArgs != nil {
+					t.Error("entry should not be updated")
+				}
+				return
+			}
+
+			if fetchedKey != tt.sliceKey {
+				t.Errorf("fetched %q, want %v", fetchedKey, tt.sliceKey)
+			}
+			if strings.HasSuffix(fetchedKey, ".webp") && qaMIME != "image/webp" {
+				t.Errorf("QA MIME type = %q, want image/webp", qaMIME)
+			}
+			if !strings.Contains(qaPrompt, `"maintenanceNarrative":"Changed oil"`) || strings.Contains(qaPrompt, "slice_key") {
+				t.Errorf("QA prompt does not carry the stored entry JSON: %s", qaPrompt)
+			}
+
+			if len(updateArgs) != 3 {
+				t.Fatalf("update args = %v", updateArgs)
+			}
+			if !strings.Contains(updateSQL, "needs_review = needs_review OR $1") {
+				t.Errorf("update may clear flags raised by other checks: %s", updateSQL)
+			}
+			if updateArgs[0] != tt.wantNeedsReview {
+				t.Errorf("needs_review = %v, want %v", updateArgs[0], tt.wantNeedsReview)
+			}
+			if updateArgs[1] != tt.wantNote {
+				t.Errorf("note = %q, want %q", updateArgs[1], tt.wantNote)
+			}
+
+			if tt.wantNeedsReview {
+				wantSummary := "Date unclear; " + strings.TrimSuffix(tt.wantNote, ". ")
+				if len(pageArgs) != 2 || pageArgs[0] != "page-1" || pageArgs[1] != wantSummary {
+					t.Errorf("page review args = %v, want [page-1 %s]", pageArgs, wantSummary)
+				}
+			} else if pageArgs != nil {
+				t.Errorf("page review refreshed on a pass: %v", pageArgs)
+			}
+
+			body := parseBody(t, resp.Body)
+			if body["verdict"] != tt.wantVerdict || body["needsReview"] != (tt.wantNeedsReview || tt.flagged) {
+				t.Errorf("body = %v", body)
+			}
+		})
+	}
+}
+
+func TestHandleRecheckEntry_NotFound(t *testing.T) {
+	callCount := 0
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			callCount++
+			if callCount == 1 {
+				return []map[string]any{{"id": "aid-1"}}, nil
+			}
+			return nil, nil
+		},
+	}
+	h := newTestHandler(db)
+
+	event := makeEvent("POST", "/aircraft/{tailNumber}/entries/{entryId}/recheck", "",
+		map[string]string{"tailNumber": "N123", "entryId": "missing"}, nil)
 	resp, err := h.Handle(context.Background(), event)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if resp.StatusCode != 200 {
-		t.Errorf("status = %d, want 200, body: %s", resp.StatusCode, resp.Body)
+	if resp.StatusCode != 404 {
+		t.Errorf("status = %d, want 404", resp.StatusCode)
 	}
+}
 
-	body := parseBody(t, resp.Body)
-	if body["answer"] == nil || body["answer"] == "" {
-		t.Error("missing answer in response")
+func TestHandleUpdateEntry(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantErr    string
+	}{
+		{
+			name:       "empty body",
+			body:       "{}",
+			wantStatus: 400,
+			wantErr:    "Request body is required",
+		},
+		{
+			name:       "invalid review status",
+			body:       `{"reviewStatus":"invalid"}`,
+			wantStatus: 400,
+			wantErr:    "reviewStatus must be",
+		},
+		{
+			name:       "successful update",
+			body:       `{"shopName":"New Shop","reviewStatus":"approved","reviewedBy":"user1"}`,
+			wantStatus: 200,
+		},
 	}
-	sources, ok := body["sources"].([]any)
-	if !ok || len(sources) == 0 {
-		t.Error("missing sources in response")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			callCount := 0
+			db := &mockDB{
+				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+					callCount++
+					if callCount == 1 { // aircraft lookup
+						return []map[string]any{{"id": "aid-1"}}, nil
+					}
+					// UPDATE RETURNING or subsequent queries
+					return []map[string]any{{"id": "entry-1", "entry_type": "maintenance"}}, nil
+				},
+			}
+			h := newTestHandler(db)
+
+			event := makeEvent("PATCH", "/aircraft/{tailNumber}/entries/{entryId}", tt.body,
+				map[string]string{"tailNumber": "N123", "entryId": "entry-1"}, nil)
+			resp, err := h.Handle(context.Background(), event)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d, body: %s", resp.StatusCode, tt.wantStatus, resp.Body)
+			}
+			if tt.wantErr != "" {
+				code, errMsg := parseError(t, resp.Body)
+				if code != "VALIDATION_ERROR" {
+					t.Errorf("code = %q, want VALIDATION_ERROR", code)
+				}
+				if !strings.Contains(errMsg, tt.wantErr) {
+					t.Errorf("error = %q, want to contain %q", errMsg, tt.wantErr)
+				}
+			}
+		})
 	}
 }
 
-func TestHandleStatus_WithFailedPages(t *testing.T) {
+func TestHandleInspections(t *testing.T) {
 	callCount := 0
 	db := &mockDB{
 		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
 			callCount++
-			if callCount == 1 {
-				return []map[string]any{{
-					"id":                 "batch-123",
-					"processing_status":  "completed_with_errors",
-					"page_count":         int64(5),
-					"source_filename":    "logbook.pdf",
-					"logbook_type":       "airframe",
-					"upload_type":        "pdf",
-					"created_at":         "2024-01-01T00:00:00Z",
-					"completed_pages":    int64(3),
-					"failed_pages":       int64(2),
-					"needs_review_pages": int64(0),
-					"total_pages":        int64(5),
-				}}, nil
+			if callCount == 1 { // aircraft lookup
+				return []map[string]any{{"id": "aid-1"}}, nil
+			}
+			if strings.Contains(sql, "COUNT") {
+				return []map[string]any{{"total": int64(3)}}, nil
 			}
-			// failed page numbers query
 			return []map[string]any{
-				{"page_number": int64(2)},
-				{"page_number": int64(4)},
+				{"id": "insp-1", "inspection_type": "annual"},
 			}, nil
 		},
 	}
 	h := newTestHandler(db)
 
-	event := makeEvent("GET", "/uploads/{id}/status", "",
-		map[string]string{"id": "batch-123"}, nil)
+	event := makeEvent("GET", "/aircraft/{tailNumber}/inspections", "",
+		map[string]string{"tailNumber": "N123"}, nil)
 	resp, err := h.Handle(context.Background(), event)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -823,36 +2165,28 @@ func TestHandleStatus_WithFailedPages(t *testing.T) {
 	if resp.StatusCode != 200 {
 		t.Errorf("status = %d, want 200", resp.StatusCode)
 	}
-
-	body := parseBody(t, resp.Body)
-	fpn, ok := body["failedPageNumbers"].([]any)
-	if !ok || len(fpn) != 2 {
-		t.Errorf("expected 2 failed page numbers, got %v", body["failedPageNumbers"])
-	}
 }
 
-func TestHandleStatus_NilPageCount(t *testing.T) {
+func TestHandleAds(t *testing.T) {
+	callCount := 0
 	db := &mockDB{
 		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
-			return []map[string]any{{
-				"id":                 "batch-123",
-				"processing_status":  "processing",
-				"page_count":         nil,
-				"source_filename":    "logbook.pdf",
-				"logbook_type":       "airframe",
-				"upload_type":        "pdf",
-				"created_at":         "2024-01-01T00:00:00Z",
-				"completed_pages":    int64(0),
-				"failed_pages":       int64(0),
-				"needs_review_pages": int64(0),
-				"total_pages":        int64(3),
-			}}, nil
+			callCount++
+			if callCount == 1 { // aircraft lookup
+				return []map[string]any{{"id": "aid-1"}}, nil
+			}
+			if strings.Contains(sql, "COUNT") {
+				return []map[string]any{{"total": int64(2)}}, nil
+			}
+			return []map[string]any{
+				{"id": "ad-1", "ad_number": "AD-2024-001"},
+			}, nil
 		},
 	}
 	h := newTestHandler(db)
 
-	event := makeEvent("GET", "/uploads/{id}/status", "",
-		map[string]string{"id": "batch-123"}, nil)
+	event := makeEvent("GET", "/aircraft/{tailNumber}/ads", "",
+		map[string]string{"tailNumber": "N123"}, nil)
 	resp, err := h.Handle(context.Background(), event)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -860,42 +2194,214 @@ func TestHandleStatus_NilPageCount(t *testing.T) {
 	if resp.StatusCode != 200 {
 		t.Errorf("status = %d, want 200", resp.StatusCode)
 	}
-	body := parseBody(t, resp.Body)
-	// pageCount should fall back to total_pages
-	if body["pageCount"] != float64(3) {
-		t.Errorf("pageCount = %v, want 3", body["pageCount"])
-	}
 }
 
-func TestHandleStatus_DBError(t *testing.T) {
-	db := &mockDB{
-		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
-			return nil, fmt.Errorf("db error")
-		},
+func TestHandleAdStatus(t *testing.T) {
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	days := func(n int) time.Time { return today.AddDate(0, 0, n) }
+
+	latest := []map[string]any{
+		// Recurring by date only.
+		{"ad_number": "2011-10-09", "compliance_date": days(-300), "compliance_method": "recurring",
+			"next_due_date": days(65), "compliance_count": int64(3)},
+		{"ad_number": "2020-18-05", "compliance_date": days(-380), "compliance_method": "inspection",
+			"next_due_date": days(-15), "compliance_count": int64(2)},
+		{"ad_number": "2019-05-11", "compliance_date": days(-350), "compliance_method": "recurring",
+			"next_due_date": days(14), "compliance_count": int64(1)},
+		// Recurring by hours only, against 1500.0 current hours.
+		{"ad_number": "2005-03-02", "compliance_date": days(-100), "compliance_method": "recurring",
+			"next_due_hours": 1495.0, "compliance_count": int64(4)},
+		{"ad_number": "2013-22-14", "compliance_date": days(-100), "compliance_method": "recurring",
+			"next_due_hours": 1506.0, "compliance_count": int64(1)},
+		// Date is current but hours are overdue: the sooner limit decides.
+		{"ad_number": "2016-02-08", "compliance_date": days(-90), "compliance_method": "recurring",
+			"next_due_date": days(275), "next_due_hours": 1450.0, "compliance_count": int64(1)},
+		// Terminating action: nothing further due.
+		{"ad_number": "2001-01-01", "compliance_date": days(-2000), "compliance_method": "terminating_action",
+			"compliance_count": int64(1)},
 	}
-	h := newTestHandler(db)
 
-	event := makeEvent("GET", "/uploads/{id}/status", "",
-		map[string]string{"id": "batch-123"}, nil)
-	_, err := h.Handle(context.Background(), event)
-	if err == nil {
-		t.Fatal("expected error from DB")
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			switch {
+			case strings.Contains(sql, "FROM aircraft"):
+				return []map[string]any{{"id": "aid-1"}}, nil
+			case strings.Contains(sql, "FROM ad_compliance"):
+				if !strings.Contains(sql, "DISTINCT ON (ad.ad_number)") {
+					t.Errorf("expected latest compliance per AD: %s", sql)
+				}
+				if !strings.Contains(sql, "me.superseded_by IS NULL") {
+					t.Errorf("expected superseded entries' compliance left out: %s", sql)
+				}
+				return latest, nil
+			case strings.Contains(sql, "flight_time"):
+				return []map[string]any{{"hours": 1500.0}}, nil
+			}
+			return nil, nil
+		},
+	}
+	h := newTestHandler(db)
+
+	event := makeEvent("GET", "/aircraft/{tailNumber}/ads/status", "",
+		map[string]string{"tailNumber": "N123"}, nil)
+	resp, err := h.Handle(context.Background(), event)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("status = %d, body: %s", resp.StatusCode, resp.Body)
+	}
+
+	body := parseBody(t, resp.Body)
+	want := []struct{ ad, status string }{
+		{"2020-18-05", "overdue"},
+		{"2016-02-08", "overdue"},
+		{"2005-03-02", "overdue"},
+		{"2019-05-11", "due_soon"},
+		{"2013-22-14", "due_soon"},
+		{"2011-10-09", "current"},
+		{"2001-01-01", "complied"},
+	}
+	ads := body["ads"].([]any)
+	if len(ads) != len(want) {
+		t.Fatalf("ads = %v", ads)
+	}
+	for i, w := range want {
+		ad := ads[i].(map[string]any)
+		if ad["adNumber"] != w.ad || ad["status"] != w.status {
+			t.Errorf("ads[%d] = %v %v, want %s %s", i, ad["adNumber"], ad["status"], w.ad, w.status)
+		}
+	}
+
+	overdue := ads[0].(map[string]any)
+	if overdue["daysRemaining"] != float64(-15) || overdue["recurring"] != true {
+		t.Errorf("overdue AD = %v", overdue)
+	}
+	if hoursAD := ads[2].(map[string]any); hoursAD["hoursRemaining"] != float64(-5) {
+		t.Errorf("hoursRemaining = %v, want -5", hoursAD["hoursRemaining"])
+	}
+	if complied := ads[6].(map[string]any); complied["recurring"] != false || complied["nextDueDate"] != nil {
+		t.Errorf("complied AD = %v", complied)
+	}
+	counts := body["counts"].(map[string]any)
+	if counts["overdue"] != float64(3) || counts["due_soon"] != float64(2) || counts["current"] != float64(1) {
+		t.Errorf("counts = %v", counts)
 	}
 }
 
-func TestHandleUpload_InvalidJSON(t *testing.T) {
-	h := newTestHandler(&mockDB{})
-	event := makeEvent("POST", "/uploads", "not json", nil, nil)
+func TestAdStatus_HoursUnknown(t *testing.T) {
+	ad := adStatus(map[string]any{"ad_number": "2005-03-02", "next_due_hours": 1495.0},
+		time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), nil)
+	if ad["status"] != adStatusUnknown || ad["hoursRemaining"] != nil {
+		t.Errorf("adStatus = %v, want unknown without current hours", ad)
+	}
+}
+
+func TestHandleParts(t *testing.T) {
+	tests := []struct {
+		name        string
+		queryParams map[string]string
+		wantStatus  int
+	}{
+		{"default active parts", nil, 200},
+		{"all parts", map[string]string{"status": "all"}, 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			callCount := 0
+			db := &mockDB{
+				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+					callCount++
+					if callCount == 1 { // aircraft lookup
+						return []map[string]any{{"id": "aid-1"}}, nil
+					}
+					return []map[string]any{
+						{"id": "part-1", "part_name": "Propeller"},
+					}, nil
+				},
+			}
+			h := newTestHandler(db)
+
+			event := makeEvent("GET", "/aircraft/{tailNumber}/parts", "",
+				map[string]string{"tailNumber": "N123"}, tt.queryParams)
+			resp, err := h.Handle(context.Background(), event)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestHandleFacets(t *testing.T) {
+	var facetSQL string
+	callCount := 0
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			callCount++
+			if callCount == 1 {
+				return []map[string]any{{"id": "aid-1"}}, nil
+			}
+			facetSQL = sql
+			return []map[string]any{
+				{"facet": "entry_type", "value": "maintenance", "count": int64(12)},
+				{"facet": "entry_type", "value": "inspection", "count": int64(4)},
+				{"facet": "inspection_type", "value": "annual", "count": int64(3)},
+				{"facet": "mechanic_name", "value": "J. Smith", "count": int64(7)},
+				{"facet": "shop_name", "value": "Acme Aviation", "count": int64(9)},
+				{"facet": "shop_name", "value": nil, "count": int64(2)},
+			}, nil
+		},
+	}
+	h := newTestHandler(db)
+
+	event := makeEvent("GET", "/aircraft/{tailNumber}/facets", "",
+		map[string]string{"tailNumber": "n123"}, nil)
 	resp, err := h.Handle(context.Background(), event)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if resp.StatusCode != 400 {
-		t.Errorf("status = %d, want 400", resp.StatusCode)
+	if resp.StatusCode != 200 {
+		t.Fatalf("status = %d, body: %s", resp.StatusCode, resp.Body)
+	}
+
+	for _, want := range []string{"btrim(shop_name) <> ''", "btrim(mechanic_name) <> ''", "count DESC"} {
+		if !strings.Contains(facetSQL, want) {
+			t.Errorf("facet query missing %q", want)
+		}
+	}
+
+	body := parseBody(t, resp.Body)
+	if body["tailNumber"] != "N123" {
+		t.Errorf("tailNumber = %v, want N123", body["tailNumber"])
+	}
+	facets, ok := body["facets"].(map[string]any)
+	if !ok {
+		t.Fatalf("expected facets object, got %v", body["facets"])
+	}
+
+	wantCounts := map[string]int{"shops": 1, "mechanics": 1, "entryTypes": 2, "inspectionTypes": 1}
+	for key, n := range wantCounts {
+		values, ok := facets[key].([]any)
+		if !ok {
+			t.Fatalf("facet %s missing or not an array: %v", key, facets[key])
+		}
+		if len(values) != n {
+			t.Errorf("facet %s has %d values, want %d", key, len(values), n)
+		}
+	}
+
+	first := facets["entryTypes"].([]any)[0].(map[string]any)
+	if first["value"] != "maintenance" || first["count"] != float64(12) {
+		t.Errorf("first entry type = %v, want maintenance/12", first)
 	}
 }
 
-func TestHandleEntries_WithNeedsReview(t *testing.T) {
+func TestHandleFacets_Empty(t *testing.T) {
 	callCount := 0
 	db := &mockDB{
 		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
@@ -903,29 +2409,66 @@ func TestHandleEntries_WithNeedsReview(t *testing.T) {
 			if callCount == 1 {
 				return []map[string]any{{"id": "aid-1"}}, nil
 			}
-			if strings.Contains(sql, "COUNT") {
-				return []map[string]any{{"total": int64(5)}}, nil
+			return nil, nil
+		},
+	}
+	h := newTestHandler(db)
+
+	event := makeEvent("GET", "/aircraft/{tailNumber}/facets", "",
+		map[string]string{"tailNumber": "N123"}, nil)
+	resp, err := h.Handle(context.Background(), event)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	facets := parseBody(t, resp.Body)["facets"].(map[string]any)
+	if shops, ok := facets["shops"].([]any); !ok || len(shops) != 0 {
+		t.Errorf("shops = %v, want empty array", facets["shops"])
+	}
+}
+
+func TestHandleWeightBalance(t *testing.T) {
+	callCount := 0
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			callCount++
+			if callCount == 1 { // aircraft lookup
+				return []map[string]any{{"id": "aid-1"}}, nil
+			}
+			if !strings.Contains(sql, "ORDER BY wb.revision_date DESC") {
+				t.Errorf("expected revisions ordered newest first, got: %s", sql)
 			}
 			return []map[string]any{
-				{"id": "entry-1", "entry_type": "maintenance", "needs_review": true},
+				{"id": "wb-2", "revision_date": "2024-03-01", "empty_weight": 1650.5},
+				{"id": "wb-1", "revision_date": "2019-06-10", "empty_weight": 1612.0},
 			}, nil
 		},
 	}
 	h := newTestHandler(db)
 
-	event := makeEvent("GET", "/aircraft/{tailNumber}/entries", "",
-		map[string]string{"tailNumber": "N123"},
-		map[string]string{"needsReview": "true", "dateFrom": "2024-01-01", "dateTo": "2024-12-31"})
+	event := makeEvent("GET", "/aircraft/{tailNumber}/weight-balance", "",
+		map[string]string{"tailNumber": "n123"}, nil)
 	resp, err := h.Handle(context.Background(), event)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	if resp.StatusCode != 200 {
-		t.Errorf("status = %d, want 200", resp.StatusCode)
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+
+	body := parseBody(t, resp.Body)
+	current, ok := body["current"].(map[string]any)
+	if !ok {
+		t.Fatalf("expected current revision, got %v", body["current"])
+	}
+	if current["id"] != "wb-2" {
+		t.Errorf("current id = %v, want wb-2", current["id"])
+	}
+	if revs, _ := body["revisions"].([]any); len(revs) != 2 {
+		t.Errorf("expected 2 revisions, got %v", body["revisions"])
 	}
 }
 
-func TestHandleUpdateEntry_NoFieldsToUpdate(t *testing.T) {
+func TestHandleWeightBalance_NoRevisions(t *testing.T) {
 	callCount := 0
 	db := &mockDB{
 		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
@@ -933,188 +2476,4079 @@ func TestHandleUpdateEntry_NoFieldsToUpdate(t *testing.T) {
 			if callCount == 1 {
 				return []map[string]any{{"id": "aid-1"}}, nil
 			}
-			return []map[string]any{{"id": "entry-1"}}, nil
+			return nil, nil
+		},
+	}
+	h := newTestHandler(db)
+
+	event := makeEvent("GET", "/aircraft/{tailNumber}/weight-balance", "",
+		map[string]string{"tailNumber": "N123"}, nil)
+	resp, err := h.Handle(context.Background(), event)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body := parseBody(t, resp.Body)
+	if body["current"] != nil {
+		t.Errorf("current = %v, want nil", body["current"])
+	}
+}
+
+func TestHandleQuery(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{
+			name:       "missing question",
+			body:       `{}`,
+			wantStatus: 400,
+		},
+		{
+			name:       "aircraft not found",
+			body:       `{"question":"When was the last oil change?"}`,
+			wantStatus: 404,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &mockDB{
+				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+					return nil, nil // no aircraft found
+				},
+			}
+			h := newTestHandler(db)
+			h.gemini = &gemini.MockClient{}
+
+			event := makeEvent("POST", "/aircraft/{tailNumber}/query", tt.body,
+				map[string]string{"tailNumber": "N123"}, nil)
+			resp, err := h.Handle(context.Background(), event)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestHandleQuery_WithResults(t *testing.T) {
+	callCount := 0
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			callCount++
+			if callCount == 1 { // aircraft lookup
+				return []map[string]any{{"id": "aid-1"}}, nil
+			}
+			// vector search results
+			return []map[string]any{
+				{
+					"chunk_text":             "Oil changed",
+					"chunk_type":             "narrative",
+					"entry_date":             "2024-01-15",
+					"entry_type":             "maintenance",
+					"maintenance_narrative":  "Changed oil and filter",
+					"inspection_type":        nil,
+					"similarity":             0.95,
+				},
+			}, nil
 		},
 	}
+
 	h := newTestHandler(db)
+	h.gemini = &gemini.MockClient{
+		EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
+			return make([]float32, gemini.DefaultEmbeddingDimensions), nil
+		},
+		GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+			return "The last oil change was performed on January 15, 2024.", nil
+		},
+	}
+
+	event := makeEvent("POST", "/aircraft/{tailNumber}/query",
+		`{"question":"When was the last oil change?"}`,
+		map[string]string{"tailNumber": "N123"}, nil)
+	resp, err := h.Handle(context.Background(), event)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Errorf("status = %d, want 200, body: %s", resp.StatusCode, resp.Body)
+	}
+
+	body := parseBody(t, resp.Body)
+	if body["answer"] == nil || body["answer"] == "" {
+		t.Error("missing answer in response")
+	}
+	sources, ok := body["sources"].([]any)
+	if !ok || len(sources) == 0 {
+		t.Error("missing sources in response")
+	}
+}
+
+func TestHandleQuery_Sampling(t *testing.T) {
+	temp, topP, topK := float32(0.7), float32(0.9), int32(40)
+	tests := []struct {
+		name     string
+		sampling gemini.GenerateConfig
+		want     string
+	}{
+		{name: "defaults", want: "temp=0.2 topP=<nil> topK=<nil>"},
+		{
+			name:     "configured",
+			sampling: gemini.GenerateConfig{Temperature: &temp, TopP: &topP, TopK: &topK},
+			want:     "temp=0.7 topP=0.9 topK=40",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			callCount := 0
+			db := &mockDB{
+				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+					callCount++
+					if callCount == 1 {
+						return []map[string]any{{"id": "aid-1"}}, nil
+					}
+					return []map[string]any{{"chunk_text": "Oil changed", "similarity": 0.95}}, nil
+				},
+			}
+			var got string
+			h := newTestHandler(db)
+			h.sampling = tt.sampling
+			h.gemini = &gemini.MockClient{
+				EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
+					return make([]float32, gemini.DefaultEmbeddingDimensions), nil
+				},
+				GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+					got = fmt.Sprintf("temp=%v topP=%v topK=%v", deref(config.Temperature), deref(config.TopP), deref(config.TopK))
+					return "Oil was changed.", nil
+				},
+			}
+
+			event := makeEvent("POST", "/aircraft/{tailNumber}/query",
+				`{"question":"When was the last oil change?"}`,
+				map[string]string{"tailNumber": "N123"}, nil)
+			resp, err := h.Handle(context.Background(), event)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.StatusCode != 200 {
+				t.Fatalf("status = %d, body: %s", resp.StatusCode, resp.Body)
+			}
+			if got != tt.want {
+				t.Errorf("config = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// deref returns *p, or nil for a nil pointer, for printing optional fields.
+func deref[T any](p *T) any {
+	if p == nil {
+		return nil
+	}
+	return *p
+}
+
+func TestHandleFleetQuery(t *testing.T) {
+	var retrievalArgs []any
+	var prompt string
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			switch {
+			case strings.Contains(sql, "FROM aircraft"):
+				if fmt.Sprint(args[0]) != "[N123AB N456CD N999ZZ]" {
+					t.Errorf("tail lookup args = %v", args)
+				}
+				return []map[string]any{
+					{"id": "aid-1", "registration": "N123AB"},
+					{"id": "aid-2", "registration": "N456CD"},
+				}, nil
+			case strings.Contains(sql, "ANY($2::uuid[])"):
+				retrievalArgs = args
+				return []map[string]any{
+					{"entry_id": "entry-2", "aircraft_id": "aid-2", "chunk_text": "Transponder check 91.413",
+						"chunk_type": "narrative", "entry_date": "2021-05-01", "entry_type": "inspection",
+						"maintenance_narrative": "Transponder check 91.413", "inspection_type": "transponder", "similarity": 0.91},
+					{"entry_id": "entry-1", "aircraft_id": "aid-1", "chunk_text": "Transponder check 91.413",
+						"chunk_type": "narrative", "entry_date": "2024-02-10", "entry_type": "inspection",
+						"maintenance_narrative": "Transponder check 91.413", "inspection_type": "transponder", "similarity": 0.88},
+				}, nil
+			}
+			return nil, nil
+		},
+	}
+	h := newTestHandler(db)
+	h.gemini = &gemini.MockClient{
+		EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
+			return make([]float32, gemini.DefaultEmbeddingDimensions), nil
+		},
+		GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+			prompt = parts[0].Text
+			return "N456CD's transponder check is overdue.", nil
+		},
+	}
+
+	event := makeEvent("POST", "/fleet/query",
+		`{"tailNumbers":["n123ab","N456CD","N999ZZ","N123AB"],"question":"Which aircraft have an overdue transponder check?"}`,
+		nil, nil)
+	resp, err := h.Handle(context.Background(), event)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("status = %d, body: %s", resp.StatusCode, resp.Body)
+	}
+
+	if len(retrievalArgs) != 4 || fmt.Sprint(retrievalArgs[1]) != "[aid-1 aid-2]" {
+		t.Errorf("retrieval args = %v, want both aircraft ids", retrievalArgs)
+	}
+	if !strings.Contains(prompt, "N456CD [2021-05-01] (inspection/transponder)") ||
+		!strings.Contains(prompt, "N123AB [2024-02-10] (inspection/transponder)") {
+		t.Errorf("prompt records should be labelled by tail:\n%s", prompt)
+	}
+
+	body := parseBody(t, resp.Body)
+	if fmt.Sprint(body["tailNumbers"]) != "[N123AB N456CD]" || fmt.Sprint(body["unknownTailNumbers"]) != "[N999ZZ]" {
+		t.Errorf("tailNumbers = %v, unknownTailNumbers = %v", body["tailNumbers"], body["unknownTailNumbers"])
+	}
+	if body["answer"] != "N456CD's transponder check is overdue." {
+		t.Errorf("answer = %v", body["answer"])
+	}
+	sources, _ := body["sources"].([]any)
+	var got []string
+	for _, src := range sources {
+		m := src.(map[string]any)
+		got = append(got, fmt.Sprintf("%v %v", m["tailNumber"], m["entryId"]))
+	}
+	if fmt.Sprint(got) != "[N456CD entry-2 N123AB entry-1]" {
+		t.Errorf("sources = %v", got)
+	}
+}
+
+func TestHandleFleetQuery_UnknownTails(t *testing.T) {
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			if strings.Contains(sql, "ANY($2::uuid[])") {
+				t.Error("no retrieval should run without any known aircraft")
+			}
+			return nil, nil
+		},
+	}
+	h := newTestHandler(db)
+	h.gemini = &gemini.MockClient{}
+
+	event := makeEvent("POST", "/fleet/query",
+		`{"tailNumbers":["N999ZZ"],"question":"Any overdue ADs?"}`, nil, nil)
+	resp, err := h.Handle(context.Background(), event)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("status = %d, body: %s", resp.StatusCode, resp.Body)
+	}
+	body := parseBody(t, resp.Body)
+	if fmt.Sprint(body["unknownTailNumbers"]) != "[N999ZZ]" || fmt.Sprint(body["tailNumbers"]) != "[]" {
+		t.Errorf("tailNumbers = %v, unknownTailNumbers = %v", body["tailNumbers"], body["unknownTailNumbers"])
+	}
+	if sources, _ := body["sources"].([]any); len(sources) != 0 {
+		t.Errorf("sources = %v", sources)
+	}
+}
+
+func TestHandleFleetQuery_Validation(t *testing.T) {
+	tooMany := make([]string, maxFleetTails+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("N%d", i)
+	}
+	manyJSON, _ := json.Marshal(tooMany)
+
+	tests := []struct {
+		name     string
+		body     string
+		wantCode string
+	}{
+		{name: "invalid JSON", body: `{`, wantCode: codeInvalidRequest},
+		{name: "missing question", body: `{"tailNumbers":["N123AB"]}`, wantCode: codeValidation},
+		{name: "missing tails", body: `{"question":"Any overdue ADs?"}`, wantCode: codeValidation},
+		{name: "blank tails", body: `{"tailNumbers":[" "],"question":"Any overdue ADs?"}`, wantCode: codeValidation},
+		{name: "too many tails", body: `{"tailNumbers":` + string(manyJSON) + `,"question":"Any overdue ADs?"}`, wantCode: codeValidation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(&mockDB{})
+			resp, err := h.Handle(context.Background(), makeEvent("POST", "/fleet/query", tt.body, nil, nil))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.StatusCode != 400 {
+				t.Fatalf("status = %d, want 400", resp.StatusCode)
+			}
+			if code, _ := parseError(t, resp.Body); code != tt.wantCode {
+				t.Errorf("code = %q, want %q", code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestHandleQuery_RetrievedSources(t *testing.T) {
+	long := strings.Repeat("Removed and replaced alternator. ", 20)
+	var rows []map[string]any
+	for i := 0; i < 7; i++ {
+		rows = append(rows, map[string]any{
+			"entry_id":              fmt.Sprintf("entry-%d", i),
+			"chunk_text":            long,
+			"chunk_type":            "narrative",
+			"entry_date":            "2024-01-15",
+			"entry_type":            "maintenance",
+			"maintenance_narrative": long,
+			"inspection_type":       nil,
+			"similarity":            0.9 - float64(i)/100,
+		})
+	}
+
+	callCount := 0
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			callCount++
+			if callCount == 1 {
+				return []map[string]any{{"id": "aid-1"}}, nil
+			}
+			return rows, nil
+		},
+	}
+	h := newTestHandler(db)
+	h.gemini = &gemini.MockClient{
+		EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
+			return make([]float32, gemini.DefaultEmbeddingDimensions), nil
+		},
+		GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+			return "The alternator was replaced.", nil
+		},
+	}
+
+	event := makeEvent("POST", "/aircraft/{tailNumber}/query",
+		`{"question":"When was the alternator replaced?"}`,
+		map[string]string{"tailNumber": "N123"}, nil)
+	resp, err := h.Handle(context.Background(), event)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body := parseBody(t, resp.Body)
+
+	retrieved, _ := body["retrieved"].([]any)
+	if len(retrieved) != len(rows) {
+		t.Fatalf("retrieved = %d, want %d", len(retrieved), len(rows))
+	}
+	sources, _ := body["sources"].([]any)
+	if len(sources) != 5 {
+		t.Errorf("sources = %d, want 5", len(sources))
+	}
+	for i, r := range retrieved {
+		src := r.(map[string]any)
+		if src["entryId"] != fmt.Sprintf("entry-%d", i) {
+			t.Errorf("retrieved[%d].entryId = %v", i, src["entryId"])
+		}
+		if src["chunkType"] != "narrative" {
+			t.Errorf("retrieved[%d].chunkType = %v", i, src["chunkType"])
+		}
+		if sn, _ := src["snippet"].(string); sn == "" || len([]rune(sn)) > 201 {
+			t.Errorf("retrieved[%d].snippet length = %d", i, len([]rune(sn)))
+		}
+	}
+
+	usage, _ := body["usage"].(map[string]any)
+	if usage["chunks"] != float64(len(rows)) {
+		t.Errorf("usage.chunks = %v, want %d", usage["chunks"], len(rows))
+	}
+	if tokens, _ := usage["contextTokens"].(float64); tokens <= 0 {
+		t.Errorf("usage.contextTokens = %v, want > 0", usage["contextTokens"])
+	}
+}
+
+func TestHandleStatus_WithFailedPages(t *testing.T) {
+	callCount := 0
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			callCount++
+			if callCount == 1 {
+				return []map[string]any{{
+					"id":                 "batch-123",
+					"processing_status":  "completed_with_errors",
+					"page_count":         int64(5),
+					"source_filename":    "logbook.pdf",
+					"logbook_type":       "airframe",
+					"upload_type":        "pdf",
+					"created_at":         "2024-01-01T00:00:00Z",
+					"completed_pages":    int64(3),
+					"failed_pages":       int64(2),
+					"needs_review_pages": int64(0),
+					"total_pages":        int64(5),
+				}}, nil
+			}
+			// failed page numbers query
+			return []map[string]any{
+				{"page_number": int64(2)},
+				{"page_number": int64(4)},
+			}, nil
+		},
+	}
+	h := newTestHandler(db)
+
+	event := makeEvent("GET", "/uploads/{id}/status", "",
+		map[string]string{"id": "batch-123"}, nil)
+	resp, err := h.Handle(context.Background(), event)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+
+	body := parseBody(t, resp.Body)
+	fpn, ok := body["failedPageNumbers"].([]any)
+	if !ok || len(fpn) != 2 {
+		t.Errorf("expected 2 failed page numbers, got %v", body["failedPageNumbers"])
+	}
+}
+
+func TestHandleStatus_WithReviewPages(t *testing.T) {
+	var reviewSQL string
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			if strings.Contains(sql, "upload_batches") {
+				return []map[string]any{{
+					"id":                 "batch-123",
+					"processing_status":  "completed",
+					"page_count":         int64(5),
+					"source_filename":    "logbook.pdf",
+					"logbook_type":       "airframe",
+					"upload_type":        "pdf",
+					"created_at":         "2024-01-01T00:00:00Z",
+					"completed_pages":    int64(5),
+					"failed_pages":       int64(0),
+					"needs_review_pages": int64(2),
+					"min_confidence":     0.41,
+					"total_pages":        int64(5),
+				}}, nil
+			}
+			reviewSQL = sql
+			return []map[string]any{
+				{"page_number": int64(4), "min_confidence": 0.41, "review_reason_summary": "QA: Date unclear"},
+				{"page_number": int64(2), "min_confidence": 0.7, "review_reason_summary": nil},
+			}, nil
+		},
+	}
+	h := newTestHandler(db)
+
+	event := makeEvent("GET", "/uploads/{id}/status", "",
+		map[string]string{"id": "batch-123"}, nil)
+	resp, err := h.Handle(context.Background(), event)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	if !strings.Contains(reviewSQL, "ORDER BY min_confidence ASC") {
+		t.Errorf("review pages not ordered by confidence: %s", reviewSQL)
+	}
+
+	body := parseBody(t, resp.Body)
+	if body["minConfidence"] != 0.41 {
+		t.Errorf("minConfidence = %v, want 0.41", body["minConfidence"])
+	}
+	pages, ok := body["reviewPages"].([]any)
+	if !ok || len(pages) != 2 {
+		t.Fatalf("expected 2 review pages, got %v", body["reviewPages"])
+	}
+	first := pages[0].(map[string]any)
+	if first["pageNumber"] != float64(4) || first["reviewReasonSummary"] != "QA: Date unclear" {
+		t.Errorf("first review page = %v", first)
+	}
+}
+
+func TestHandleBulkStatus(t *testing.T) {
+	const (
+		idDone   = "0190a8f2-1111-7000-8000-000000000001"
+		idFailed = "0190a8f2-2222-7000-8000-000000000002"
+		idGone   = "0190a8f2-3333-7000-8000-000000000003"
+	)
+	batches := map[string]map[string]any{
+		idDone: {
+			"id": idDone, "processing_status": "completed", "page_count": int64(3),
+			"completed_pages": int64(3), "failed_pages": int64(0), "needs_review_pages": int64(1),
+			"total_pages": int64(3),
+		},
+		idFailed: {
+			"id": idFailed, "processing_status": "completed_with_errors", "page_count": int64(4),
+			"completed_pages": int64(2), "failed_pages": int64(2), "needs_review_pages": int64(0),
+			"total_pages": int64(4),
+		},
+	}
+
+	var statusQueries int
+	var statusArgs []any
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			switch {
+			case strings.Contains(sql, "FROM upload_batches"):
+				statusQueries++
+				statusArgs = args
+				if !strings.Contains(sql, "a.tenant_id = $1 AND ub.id = ANY($2::uuid[])") {
+					t.Errorf("expected one aggregated query scoped to the tenant: %s", sql)
+				}
+				var rows []map[string]any
+				for _, id := range args[1].([]string) {
+					if b, ok := batches[id]; ok {
+						rows = append(rows, b)
+					}
+				}
+				return rows, nil
+			case strings.Contains(sql, "extraction_status = 'failed'"):
+				return []map[string]any{
+					{"document_id": idFailed, "page_number": int64(2)},
+					{"document_id": idFailed, "page_number": int64(4)},
+				}, nil
+			case strings.Contains(sql, "needs_review = TRUE"):
+				return []map[string]any{
+					{"document_id": idDone, "page_number": int64(1), "min_confidence": 0.5, "review_reason_summary": "QA: Date unclear"},
+				}, nil
+			}
+			return nil, nil
+		},
+	}
+	h := newTestHandler(db)
+
+	reqBody := fmt.Sprintf(`{"uploadIds": [%q, %q, %q, "not-a-uuid", %q, %q]}`, idFailed, idGone, idDone, idFailed, strings.ToUpper(idDone))
+	event := makeEvent("POST", "/uploads/status", reqBody, nil, nil)
+	resp, err := h.Handle(context.Background(), event)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("status = %d, want 200, body: %s", resp.StatusCode, resp.Body)
+	}
+	if statusQueries != 1 {
+		t.Errorf("status queries = %d, want 1", statusQueries)
+	}
+	if got := fmt.Sprint(statusArgs[1]); got != fmt.Sprint([]string{idFailed, idGone, idDone}) {
+		t.Errorf("queried ids = %s; malformed, repeated and differently cased ids should be dropped", got)
+	}
+
+	body := parseBody(t, resp.Body)
+	uploads := body["uploads"].([]any)
+	if len(uploads) != 2 {
+		t.Fatalf("uploads = %v", uploads)
+	}
+	failed := uploads[0].(map[string]any)
+	if failed["uploadId"] != idFailed || failed["status"] != "completed_with_errors" {
+		t.Errorf("uploads[0] = %v, want %s first (request order)", failed, idFailed)
+	}
+	if fpn, _ := failed["failedPageNumbers"].([]any); len(fpn) != 2 {
+		t.Errorf("failedPageNumbers = %v", failed["failedPageNumbers"])
+	}
+	done := uploads[1].(map[string]any)
+	if done["uploadId"] != idDone || done["pageCount"] != float64(3) {
+		t.Errorf("uploads[1] = %v", done)
+	}
+	if pages, _ := done["reviewPages"].([]any); len(pages) != 1 {
+		t.Errorf("reviewPages = %v", done["reviewPages"])
+	}
+	if got := fmt.Sprint(body["notFound"]); got != fmt.Sprintf("[%s not-a-uuid]", idGone) {
+		t.Errorf("notFound = %s", got)
+	}
+}
+
+func TestHandleBulkStatus_Validation(t *testing.T) {
+	tooMany := make([]string, maxBulkStatusIDs+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("0190a8f2-0000-7000-8000-%012d", i)
+	}
+	tooManyBody, _ := json.Marshal(map[string]any{"uploadIds": tooMany})
+
+	tests := []struct {
+		name     string
+		body     string
+		wantCode string
+	}{
+		{name: "invalid json", body: "{", wantCode: codeInvalidRequest},
+		{name: "empty list", body: `{"uploadIds": []}`, wantCode: codeValidation},
+		{name: "too many", body: string(tooManyBody), wantCode: codeValidation},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &mockDB{
+				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+					t.Errorf("unexpected query: %s", sql)
+					return nil, nil
+				},
+			}
+			h := newTestHandler(db)
+
+			resp, err := h.Handle(context.Background(), makeEvent("POST", "/uploads/status", tt.body, nil, nil))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.StatusCode != 400 {
+				t.Fatalf("status = %d, want 400", resp.StatusCode)
+			}
+			if code, _ := parseError(t, resp.Body); code != tt.wantCode {
+				t.Errorf("code = %q, want %q", code, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestHandleFinalizeUpload(t *testing.T) {
+	pages := []map[string]any{
+		{"page_number": int64(1), "image_path": "pages/batch-1/page_0001.jpg"},
+		{"page_number": int64(2), "image_path": "pages/batch-1/page_0002.jpg"},
+		{"page_number": int64(3), "image_path": "pages/batch-1/page_0003.png"},
+	}
+
+	tests := []struct {
+		name         string
+		batch        map[string]any
+		present      map[string]bool
+		wantStatus   int
+		wantComplete bool
+		wantMissing  []string
+		wantPromoted bool
+	}{
+		{
+			name:  "all images present",
+			batch: map[string]any{"id": "batch-1", "upload_type": "multi_image", "processing_status": "pending"},
+			present: map[string]bool{
+				"pages/batch-1/page_0001.jpg": true,
+				"pages/batch-1/page_0002.jpg": true,
+				"pages/batch-1/page_0003.png": true,
+			},
+			wantStatus:   200,
+			wantComplete: true,
+			wantPromoted: true,
+		},
+		{
+			name:  "some images missing",
+			batch: map[string]any{"id": "batch-1", "upload_type": "multi_image", "processing_status": "pending"},
+			present: map[string]bool{
+				"pages/batch-1/page_0002.jpg": true,
+			},
+			wantStatus:  200,
+			wantMissing: []string{"pages/batch-1/page_0001.jpg", "pages/batch-1/page_0003.png"},
+		},
+		{
+			name:        "pdf missing",
+			batch:       map[string]any{"id": "batch-1", "upload_type": "pdf", "s3_key": "uploads/batch-1/log.pdf", "processing_status": "pending"},
+			present:     map[string]bool{},
+			wantStatus:  200,
+			wantMissing: []string{"uploads/batch-1/log.pdf"},
+		},
+		{
+			name:         "pdf already picked up by split",
+			batch:        map[string]any{"id": "batch-1", "upload_type": "pdf", "s3_key": "uploads/batch-1/log.pdf", "processing_status": "processing"},
+			present:      map[string]bool{"uploads/batch-1/log.pdf": true},
+			wantStatus:   200,
+			wantComplete: true,
+		},
+		{
+			name:       "expired",
+			batch:      map[string]any{"id": "batch-1", "upload_type": "pdf", "s3_key": "uploads/batch-1/log.pdf", "processing_status": "expired"},
+			wantStatus: 409,
+		},
+		{
+			name:       "not found",
+			wantStatus: 404,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var execSQL []string
+			var missingArg any
+			db := &mockDB{
+				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+					if strings.Contains(sql, "FROM upload_batches") {
+						if tt.batch == nil {
+							return nil, nil
+						}
+						return []map[string]any{tt.batch}, nil
+					}
+					return pages, nil
+				},
+				execFn: func(ctx context.Context, sql string, args ...any) error {
+					execSQL = append(execSQL, sql)
+					if strings.Contains(sql, "file_missing") {
+						missingArg = args[1]
+					}
+					return nil
+				},
+			}
+			h := newTestHandler(db)
+			h.s3 = &mockS3{
+				headObjectFn: func(ctx context.Context, bucket, key string) (bool, int64, error) {
+					return tt.present[key], 0, nil
+				},
+			}
+
+			event := makeEvent("POST", "/uploads/{id}/finalize", "",
+				map[string]string{"id": "batch-1"}, nil)
+			resp, err := h.Handle(context.Background(), event)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantStatus != 200 {
+				return
+			}
+
+			body := parseBody(t, resp.Body)
+			if body["complete"] != tt.wantComplete {
+				t.Errorf("complete = %v, want %v", body["complete"], tt.wantComplete)
+			}
+			missing, _ := body["missingFiles"].([]any)
+			if len(missing) != len(tt.wantMissing) {
+				t.Fatalf("missingFiles = %v, want %v", missing, tt.wantMissing)
+			}
+			for i, m := range missing {
+				if key := m.(map[string]any)["s3Key"]; key != tt.wantMissing[i] {
+					t.Errorf("missing[%d] = %v, want %s", i, key, tt.wantMissing[i])
+				}
+			}
+
+			promoted := false
+			for _, sql := range execSQL {
+				if strings.Contains(sql, "processing_status = 'processing'") {
+					promoted = true
+				}
+			}
+			if promoted != tt.wantPromoted {
+				t.Errorf("batch promoted = %v, want %v", promoted, tt.wantPromoted)
+			}
+			if tt.batch["upload_type"] == "multi_image" {
+				got, _ := missingArg.([]int64)
+				var want []int64
+				for _, k := range tt.wantMissing {
+					for _, p := range pages {
+						if p["image_path"] == k {
+							want = append(want, p["page_number"].(int64))
+						}
+					}
+				}
+				if fmt.Sprint(got) != fmt.Sprint(want) && !(len(got) == 0 && len(want) == 0) {
+					t.Errorf("pages flagged missing = %v, want %v", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleFinalizeUpload_HeadError(t *testing.T) {
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			return []map[string]any{{"id": "batch-1", "upload_type": "pdf", "s3_key": "uploads/batch-1/log.pdf", "processing_status": "pending"}}, nil
+		},
+	}
+	h := newTestHandler(db)
+	h.s3 = &mockS3{
+		headObjectFn: func(ctx context.Context, bucket, key string) (bool, int64, error) {
+			return false, 0, fmt.Errorf("access denied")
+		},
+	}
+
+	event := makeEvent("POST", "/uploads/{id}/finalize", "",
+		map[string]string{"id": "batch-1"}, nil)
+	resp, err := h.Handle(context.Background(), event)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if code, _ := parseError(t, resp.Body); resp.StatusCode != 500 || code != "INTERNAL_ERROR" {
+		t.Errorf("status = %d, code = %q, want 500 INTERNAL_ERROR when S3 can't be checked", resp.StatusCode, code)
+	}
+}
+
+func TestHandleAppendPages(t *testing.T) {
+	var update []any
+	var inserted [][]any
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			if strings.Contains(sql, "UPDATE upload_batches") {
+				update = args
+				// A reopened batch drops the reason it failed last time.
+				if !strings.Contains(sql, "error_message = CASE WHEN processing_status = ANY($3) THEN NULL") {
+					t.Errorf("reopening doesn't clear error_message:\n%s", sql)
+				}
+				return []map[string]any{{"page_count": int64(5)}}, nil
+			}
+			return []map[string]any{{"upload_type": "multi_image", "processing_status": "completed"}}, nil
+		},
+		insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+			if strings.Contains(sql, "INSERT INTO upload_pages") {
+				inserted = append(inserted, args)
+			}
+			return "page-id", nil
+		},
+	}
+	h := newTestHandler(db)
+	var contentTypes []string
+	h.s3 = &mockS3{
+		presignPutFn: func(ctx context.Context, bucket, key, contentType string, expires time.Duration) (string, error) {
+			contentTypes = append(contentTypes, contentType)
+			return "https://s3.example.com/" + key, nil
+		},
+	}
+
+	event := makeEvent("POST", "/uploads/{id}/pages",
+		`{"files":[{"filename":"back-cover.jpg"},{"filename":"insert.PNG"}]}`,
+		map[string]string{"id": "batch-1"}, nil)
+	resp, err := h.Handle(context.Background(), event)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("status = %d, body = %s", resp.StatusCode, resp.Body)
+	}
+
+	if len(update) != 3 || update[0] != "batch-1" || update[1] != 2 {
+		t.Errorf("update args = %v, want batch-1 bumped by 2", update)
+	}
+	if got := fmt.Sprint(update[2]); !strings.Contains(got, "completed") {
+		t.Errorf("reopenable statuses = %s, want completed included", got)
+	}
+
+	wantKeys := []string{"pages/batch-1/page_0004.jpg", "pages/batch-1/page_0005.png"}
+	if len(inserted) != 2 {
+		t.Fatalf("inserted %d pages, want 2", len(inserted))
+	}
+	for i, args := range inserted {
+		if args[1] != 4+i || args[2] != wantKeys[i] {
+			t.Errorf("page %d insert = %v, want page %d at %s", i, args, 4+i, wantKeys[i])
+		}
+	}
+	if fmt.Sprint(contentTypes) != "[image/jpeg image/png]" {
+		t.Errorf("content types = %v", contentTypes)
+	}
+
+	body := parseBody(t, resp.Body)
+	if body["pageCount"] != float64(5) || body["uploadType"] != "multi_image" {
+		t.Errorf("body = %v", body)
+	}
+	files := body["files"].([]any)
+	if len(files) != 2 {
+		t.Fatalf("files = %v", files)
+	}
+	second := files[1].(map[string]any)
+	if second["filename"] != "insert.PNG" || second["pageId"] != "page-id" || second["pageNumber"] != float64(5) || second["uploadUrl"] != "https://s3.example.com/pages/batch-1/page_0005.png" {
+		t.Errorf("second file = %v", second)
+	}
+}
+
+func TestHandleAppendPages_Rejected(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		batch      map[string]any
+		wantStatus int
+		wantCode   string
+	}{
+		{
+			name:       "pdf batch",
+			body:       `{"files":[{"filename":"page.jpg"}]}`,
+			batch:      map[string]any{"upload_type": "pdf", "processing_status": "completed"},
+			wantStatus: 409,
+			wantCode:   "UPLOAD_NOT_APPENDABLE",
+		},
+		{
+			name:       "expired batch",
+			body:       `{"files":[{"filename":"page.jpg"}]}`,
+			batch:      map[string]any{"upload_type": "multi_image", "processing_status": "expired"},
+			wantStatus: 409,
+			wantCode:   "UPLOAD_EXPIRED",
+		},
+		{
+			name:       "not found",
+			body:       `{"files":[{"filename":"page.jpg"}]}`,
+			wantStatus: 404,
+			wantCode:   "UPLOAD_NOT_FOUND",
+		},
+		{
+			name:       "non-image file",
+			body:       `{"files":[{"filename":"more.pdf"}]}`,
+			batch:      map[string]any{"upload_type": "multi_image", "processing_status": "completed"},
+			wantStatus: 400,
+			wantCode:   "VALIDATION_ERROR",
+		},
+		{
+			name:       "no files",
+			body:       `{"files":[]}`,
+			batch:      map[string]any{"upload_type": "multi_image", "processing_status": "completed"},
+			wantStatus: 400,
+			wantCode:   "VALIDATION_ERROR",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &mockDB{
+				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+					if strings.Contains(sql, "UPDATE upload_batches") {
+						t.Errorf("batch updated: %s", sql)
+					}
+					if tt.batch == nil {
+						return nil, nil
+					}
+					return []map[string]any{tt.batch}, nil
+				},
+				insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+					t.Errorf("unexpected insert: %s", sql)
+					return "", nil
+				},
+			}
+			h := newTestHandler(db)
+
+			event := makeEvent("POST", "/uploads/{id}/pages", tt.body,
+				map[string]string{"id": "batch-1"}, nil)
+			resp, err := h.Handle(context.Background(), event)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if code, _ := parseError(t, resp.Body); resp.StatusCode != tt.wantStatus || code != tt.wantCode {
+				t.Errorf("status = %d, code = %q, want %d %s", resp.StatusCode, code, tt.wantStatus, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestHandleReorderPages(t *testing.T) {
+	var execArgs []any
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			if strings.Contains(sql, "FROM upload_pages") {
+				return []map[string]any{
+					{"id": "page-a", "page_number": int32(1)},
+					{"id": "page-b", "page_number": int32(2)},
+					{"id": "page-c", "page_number": int32(3)},
+				}, nil
+			}
+			return []map[string]any{{"processing_status": "completed"}}, nil
+		},
+		execFn: func(ctx context.Context, sql string, args ...any) error {
+			if !strings.Contains(sql, "UPDATE upload_pages") {
+				t.Errorf("unexpected exec: %s", sql)
+			}
+			execArgs = args
+			return nil
+		},
+	}
+	h := newTestHandler(db)
+
+	event := makeEvent("PATCH", "/uploads/{id}/pages/order",
+		`{"order":{"PAGE-A":3,"page-b":2,"page-c":1}}`,
+		map[string]string{"id": "batch-1"}, nil)
+	resp, err := h.Handle(context.Background(), event)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("status = %d, body = %s", resp.StatusCode, resp.Body)
+	}
+
+	if len(execArgs) != 3 || execArgs[0] != "batch-1" {
+		t.Fatalf("update args = %v", execArgs)
+	}
+	ids, numbers := execArgs[1].([]string), execArgs[2].([]int64)
+	changed := map[string]int64{}
+	for i := range ids {
+		changed[ids[i]] = numbers[i]
+	}
+	if len(changed) != 2 || changed["page-a"] != 3 || changed["page-c"] != 1 {
+		t.Errorf("updated = %v, want only page-a→3 and page-c→1", changed)
+	}
+
+	body := parseBody(t, resp.Body)
+	var got []string
+	for _, p := range body["pages"].([]any) {
+		m := p.(map[string]any)
+		got = append(got, fmt.Sprintf("%v:%v", m["pageId"], m["pageNumber"]))
+	}
+	if want := "[page-c:1 page-b:2 page-a:3]"; fmt.Sprint(got) != want {
+		t.Errorf("pages = %v, want %s", got, want)
+	}
+}
+
+func TestHandleReorderPages_Rejected(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		status     string
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "duplicate page number", body: `{"order":{"page-a":1,"page-b":1,"page-c":3}}`, wantStatus: 400, wantCode: "VALIDATION_ERROR"},
+		{name: "number outside the upload", body: `{"order":{"page-a":1,"page-b":2,"page-c":4}}`, wantStatus: 400, wantCode: "VALIDATION_ERROR"},
+		{name: "page missing", body: `{"order":{"page-a":2,"page-b":1}}`, wantStatus: 400, wantCode: "VALIDATION_ERROR"},
+		{name: "unknown page", body: `{"order":{"page-a":1,"page-b":2,"page-x":3}}`, wantStatus: 400, wantCode: "VALIDATION_ERROR"},
+		{name: "empty order", body: `{"order":{}}`, wantStatus: 400, wantCode: "VALIDATION_ERROR"},
+		{name: "expired", body: `{"order":{"page-a":1,"page-b":2,"page-c":3}}`, status: "expired", wantStatus: 409, wantCode: "UPLOAD_EXPIRED"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &mockDB{
+				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+					if strings.Contains(sql, "FROM upload_pages") {
+						return []map[string]any{
+							{"id": "page-a", "page_number": int32(1)},
+							{"id": "page-b", "page_number": int32(2)},
+							{"id": "page-c", "page_number": int32(3)},
+						}, nil
+					}
+					status := tt.status
+					if status == "" {
+						status = "completed"
+					}
+					return []map[string]any{{"processing_status": status}}, nil
+				},
+				execFn: func(ctx context.Context, sql string, args ...any) error {
+					t.Errorf("unexpected exec: %s", sql)
+					return nil
+				},
+			}
+			h := newTestHandler(db)
+
+			event := makeEvent("PATCH", "/uploads/{id}/pages/order", tt.body,
+				map[string]string{"id": "batch-1"}, nil)
+			resp, err := h.Handle(context.Background(), event)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if code, _ := parseError(t, resp.Body); resp.StatusCode != tt.wantStatus || code != tt.wantCode {
+				t.Errorf("status = %d, code = %q, want %d %s", resp.StatusCode, code, tt.wantStatus, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestHandlePageExtraction(t *testing.T) {
+	raw := `{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","maintenanceNarrative":"Changed oil"}]}`
+	compressed, err := rawextraction.Encode([]byte(raw), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		rows       []map[string]any
+		wantStatus int
+	}{
+		{
+			name:       "compressed row",
+			rows:       []map[string]any{{"page_type": "maintenance_entry", "raw_extraction": string(compressed)}},
+			wantStatus: 200,
+		},
+		{
+			name:       "legacy uncompressed row",
+			rows:       []map[string]any{{"page_type": "maintenance_entry", "raw_extraction": raw}},
+			wantStatus: 200,
+		},
+		{
+			name:       "not yet extracted",
+			rows:       []map[string]any{{"page_type": nil, "raw_extraction": nil}},
+			wantStatus: 404,
+		},
+		{
+			name:       "page not found",
+			wantStatus: 404,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &mockDB{
+				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+					return tt.rows, nil
+				},
+			}
+			h := newTestHandler(db)
+
+			event := makeEvent("GET", "/uploads/{id}/pages/{pageNumber}/extraction", "",
+				map[string]string{"id": "batch-1", "pageNumber": "1"}, nil)
+			resp, err := h.Handle(context.Background(), event)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantStatus != 200 {
+				return
+			}
+
+			body := parseBody(t, resp.Body)
+			extraction, ok := body["extraction"].(map[string]any)
+			if !ok {
+				t.Fatalf("extraction = %v, want decoded object", body["extraction"])
+			}
+			if extraction["pageType"] != "maintenance_entry" {
+				t.Errorf("pageType = %v", extraction["pageType"])
+			}
+			if entries, _ := extraction["entries"].([]any); len(entries) != 1 {
+				t.Errorf("entries = %v, want 1", extraction["entries"])
+			}
+		})
+	}
+}
+
+func TestHandleStatus_NilPageCount(t *testing.T) {
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			return []map[string]any{{
+				"id":                 "batch-123",
+				"processing_status":  "processing",
+				"page_count":         nil,
+				"source_filename":    "logbook.pdf",
+				"logbook_type":       "airframe",
+				"upload_type":        "pdf",
+				"created_at":         "2024-01-01T00:00:00Z",
+				"completed_pages":    int64(0),
+				"failed_pages":       int64(0),
+				"needs_review_pages": int64(0),
+				"total_pages":        int64(3),
+			}}, nil
+		},
+	}
+	h := newTestHandler(db)
+
+	event := makeEvent("GET", "/uploads/{id}/status", "",
+		map[string]string{"id": "batch-123"}, nil)
+	resp, err := h.Handle(context.Background(), event)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+	body := parseBody(t, resp.Body)
+	// pageCount should fall back to total_pages
+	if body["pageCount"] != float64(3) {
+		t.Errorf("pageCount = %v, want 3", body["pageCount"])
+	}
+}
+
+func TestHandleStatus_DBError(t *testing.T) {
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			return nil, fmt.Errorf("db error")
+		},
+	}
+	h := newTestHandler(db)
+
+	event := makeEvent("GET", "/uploads/{id}/status", "",
+		map[string]string{"id": "batch-123"}, nil)
+	resp, err := h.Handle(context.Background(), event)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != 500 {
+		t.Errorf("status = %d, want 500", resp.StatusCode)
+	}
+	code, msg := parseError(t, resp.Body)
+	if code != "INTERNAL_ERROR" || strings.Contains(msg, "db error") {
+		t.Errorf("error = %q %q, want INTERNAL_ERROR without the underlying error", code, msg)
+	}
+}
+
+func TestHandleUpload_InvalidJSON(t *testing.T) {
+	h := newTestHandler(&mockDB{})
+	event := makeEvent("POST", "/uploads", "not json", nil, nil)
+	resp, err := h.Handle(context.Background(), event)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != 400 {
+		t.Errorf("status = %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestHandleUpload_SourceURL(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		hosts      sourceurl.Allowlist
+		wantStatus int
+		wantErr    string
+		wantFile   string
+		wantType   string
+	}{
+		{
+			name:       "queues fetch",
+			body:       `{"tailNumber":"n123","logType":"airframe","sourceUrl":"https://scans.example.com/n123/logbook.pdf"}`,
+			hosts:      sourceurl.Allowlist{"scans.example.com"},
+			wantStatus: 202,
+			wantFile:   "logbook.pdf",
+			wantType:   "pdf",
+		},
+		{
+			name:       "image",
+			body:       `{"tailNumber":"n123","logType":"airframe","sourceUrl":"https://scans.example.com/n123/page.JPG"}`,
+			hosts:      sourceurl.Allowlist{"scans.example.com"},
+			wantStatus: 202,
+			wantFile:   "page.JPG",
+			wantType:   "image",
+		},
+		{
+			name:       "disallowed host",
+			body:       `{"tailNumber":"N123","sourceUrl":"https://evil.example.org/logbook.pdf"}`,
+			hosts:      sourceurl.Allowlist{"scans.example.com"},
+			wantStatus: 400,
+			wantErr:    "is not allowed",
+		},
+		{
+			name:       "http scheme",
+			body:       `{"tailNumber":"N123","sourceUrl":"http://scans.example.com/logbook.pdf"}`,
+			hosts:      sourceurl.Allowlist{"scans.example.com"},
+			wantStatus: 400,
+			wantErr:    "must use https",
+		},
+		{
+			name:       "unsupported file type",
+			body:       `{"tailNumber":"N123","sourceUrl":"https://scans.example.com/logbook.docx"}`,
+			hosts:      sourceurl.Allowlist{"scans.example.com"},
+			wantStatus: 400,
+			wantErr:    "must point to a PDF",
+		},
+		{
+			name:       "files and sourceUrl",
+			body:       `{"tailNumber":"N123","files":[{"filename":"a.pdf"}],"sourceUrl":"https://scans.example.com/logbook.pdf"}`,
+			hosts:      sourceurl.Allowlist{"scans.example.com"},
+			wantStatus: 400,
+			wantErr:    "either files or sourceUrl",
+		},
+		{
+			name:       "not enabled",
+			body:       `{"tailNumber":"N123","sourceUrl":"https://scans.example.com/logbook.pdf"}`,
+			wantStatus: 400,
+			wantErr:    "not enabled",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var batchArgs []any
+			db := &mockDB{
+				insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+					if strings.Contains(sql, "upload_batches") {
+						batchArgs = args
+					}
+					return "test-uuid-123", nil
+				},
+			}
+			sqsMock := &mockSQS{}
+			h := newTestHandler(db)
+			h.sqs = sqsMock
+			h.fetchQueueURL = "https://sqs.example.com/fetch"
+			h.sourceHosts = tt.hosts
+
+			event := makeEvent("POST", "/uploads", tt.body, nil, nil)
+			resp, err := h.Handle(context.Background(), event)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			body := parseBody(t, resp.Body)
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body: %v", resp.StatusCode, tt.wantStatus, body)
+			}
+
+			if tt.wantErr != "" {
+				code, errMsg := parseError(t, resp.Body)
+				if code != "VALIDATION_ERROR" {
+					t.Errorf("code = %q, want VALIDATION_ERROR", code)
+				}
+				if !strings.Contains(errMsg, tt.wantErr) {
+					t.Errorf("error = %q, want to contain %q", errMsg, tt.wantErr)
+				}
+				if len(sqsMock.messages) != 0 || batchArgs != nil {
+					t.Error("expected no batch or fetch for a rejected sourceUrl")
+				}
+				return
+			}
+
+			uploadID, _ := body["uploadId"].(string)
+			wantKey := "uploads/" + uploadID + "/" + tt.wantFile
+			wantURL := "https://scans.example.com/n123/" + tt.wantFile
+			if body["s3Key"] != wantKey || body["uploadType"] != tt.wantType {
+				t.Errorf("s3Key = %v, uploadType = %v, want %s and %s", body["s3Key"], body["uploadType"], wantKey, tt.wantType)
+			}
+			if len(batchArgs) != 9 || batchArgs[3] != tt.wantType || batchArgs[5] != wantKey || batchArgs[6] != wantURL {
+				t.Errorf("batch insert args = %v", batchArgs)
+			}
+			if len(sqsMock.messages) != 1 || sqsMock.queueURLs[0] != h.fetchQueueURL {
+				t.Fatalf("expected one fetch message on the fetch queue, got %v", sqsMock.queueURLs)
+			}
+			var msg map[string]string
+			if err := json.Unmarshal([]byte(sqsMock.messages[0]), &msg); err != nil {
+				t.Fatalf("invalid fetch message: %v", err)
+			}
+			if msg["uploadId"] != uploadID || msg["s3Key"] != wantKey || msg["sourceUrl"] != wantURL {
+				t.Errorf("fetch message = %v", msg)
+			}
+		})
+	}
+}
+
+func TestHandleUpload_CallbackURL(t *testing.T) {
+	tests := []struct {
+		name        string
+		callbackURL string
+		wantStatus  int
+		wantStored  any
+		wantErr     string
+	}{
+		{name: "stored with the batch", callbackURL: "https://hooks.example.com/logbook?id=7", wantStatus: 200, wantStored: "https://hooks.example.com/logbook?id=7"},
+		{name: "omitted", wantStatus: 200},
+		{name: "http scheme", callbackURL: "http://hooks.example.com/logbook", wantStatus: 400, wantErr: "must be an https URL"},
+		{name: "not a URL", callbackURL: "hooks", wantStatus: 400, wantErr: "must be an https URL"},
+		{name: "private address", callbackURL: "https://10.0.0.5/hook", wantStatus: 400, wantErr: "host is not allowed"},
+		{name: "metadata address", callbackURL: "https://169.254.169.254/latest", wantStatus: 400, wantErr: "host is not allowed"},
+		{name: "localhost", callbackURL: "https://localhost:8443/hook", wantStatus: 400, wantErr: "host is not allowed"},
+		{name: "IPv6 loopback", callbackURL: "https://[::1]/hook", wantStatus: 400, wantErr: "host is not allowed"},
+		{name: "shared address", callbackURL: "https://100.64.0.1/hook", wantStatus: 400, wantErr: "host is not allowed"},
+		{name: "too long", callbackURL: "https://hooks.example.com/" + strings.Repeat("a", maxCallbackURLLen), wantStatus: 400, wantErr: "at most 2048"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var batchArgs []any
+			db := &mockDB{
+				insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+					if strings.Contains(sql, "upload_batches") {
+						batchArgs = args
+					}
+					return "test-uuid-123", nil
+				},
+			}
+			h := newTestHandler(db)
+
+			body, _ := json.Marshal(map[string]any{
+				"tailNumber":  "N123",
+				"files":       []map[string]string{{"filename": "log.pdf"}},
+				"callbackUrl": tt.callbackURL,
+			})
+			resp, err := h.Handle(context.Background(), makeEvent("POST", "/uploads", string(body), nil, nil))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body: %s", resp.StatusCode, tt.wantStatus, resp.Body)
+			}
+			if tt.wantErr != "" {
+				if _, msg := parseError(t, resp.Body); !strings.Contains(msg, tt.wantErr) {
+					t.Errorf("error = %q, want to contain %q", msg, tt.wantErr)
+				}
+				if batchArgs != nil {
+					t.Error("no batch should be created for a rejected callbackUrl")
+				}
+				return
+			}
+			if len(batchArgs) != 7 || batchArgs[5] != tt.wantStored {
+				t.Errorf("batch insert args = %v, want callback_url %v", batchArgs, tt.wantStored)
+			}
+		})
+	}
+}
+
+// fakeUploads stores upload batches and pages the way the upload queries
+// expect, enforcing the per-aircraft idempotency key like the unique index.
+type fakeUploads struct {
+	batches      map[string]map[string]any // by idempotency key
+	pages        map[string][]map[string]any
+	batchInserts int
+}
+
+func newFakeUploads() *fakeUploads {
+	return &fakeUploads{batches: map[string]map[string]any{}, pages: map[string][]map[string]any{}}
+}
+
+func (f *fakeUploads) db() *mockDB {
+	return &mockDB{
+		insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+			switch {
+			case strings.Contains(sql, "INSERT INTO upload_batches"):
+				f.batchInserts++
+				row := map[string]any{"id": args[0], "upload_type": "pdf", "source_filename": args[3], "s3_key": args[4]}
+				if strings.Contains(sql, "multi_image") {
+					row = map[string]any{"id": args[0], "upload_type": "multi_image", "source_filename": args[3]}
+				}
+				if strings.Contains(sql, "source_url") {
+					row = map[string]any{"id": args[0], "upload_type": args[3], "source_filename": args[4], "s3_key": args[5], "source_url": args[6]}
+				}
+				if key := args[len(args)-1]; key != nil {
+					if _, dup := f.batches[key.(string)]; dup {
+						return "", fmt.Errorf("duplicate key value violates unique constraint")
+					}
+					f.batches[key.(string)] = row
+				}
+				return args[0].(string), nil
+			case strings.Contains(sql, "INSERT INTO upload_pages"):
+				batchID := args[0].(string)
+				f.pages[batchID] = append(f.pages[batchID], map[string]any{"page_number": int64(args[1].(int)), "image_path": args[2]})
+				return "page-id", nil
+			}
+			return "aircraft-1", nil
+		},
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			switch {
+			case strings.Contains(sql, "idempotency_key = $2"):
+				if row, ok := f.batches[args[1].(string)]; ok {
+					return []map[string]any{row}, nil
+				}
+			case strings.Contains(sql, "FROM upload_pages"):
+				return f.pages[args[0].(string)], nil
+			}
+			return nil, nil
+		},
+	}
+}
+
+func TestUpload_FAAEnrichment(t *testing.T) {
+	var mu sync.Mutex
+	var fetched []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetched = append(fetched, r.URL.Path)
+		mu.Unlock()
+		fmt.Fprint(w, `{"manufacturer":"CESSNA","model":"172S","serialNumber":"172S1234"}`)
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name        string
+		queueURL    string
+		disabled    bool
+		wantFetch   bool
+		wantMessage string
+	}{
+		{name: "background goroutine", wantFetch: true},
+		{name: "queued for worker", queueURL: "https://sqs/enrich", wantMessage: `{"aircraftId":"aid-1","tailNumber":"N123"}`},
+		{name: "disabled", disabled: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetched = nil
+			var updated bool
+			db := &mockDB{
+				insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+					if strings.Contains(sql, "INSERT INTO aircraft") {
+						return "aid-1", nil
+					}
+					return "test-id", nil
+				},
+				execFn: func(ctx context.Context, sql string, args ...any) error {
+					if strings.Contains(sql, "faa_enriched_at = NOW()") {
+						mu.Lock()
+						updated = true
+						mu.Unlock()
+					}
+					return nil
+				},
+			}
+			h := newTestHandler(db)
+			sqsMock := &mockSQS{}
+			h.sqs = sqsMock
+			h.enrichQueueURL = tt.queueURL
+			if !tt.disabled {
+				h.faa = &faa.Enricher{DB: db, Secrets: h.secrets, BaseURL: srv.URL, SecretARN: "faa-secret"}
+			}
+
+			event := makeEvent("POST", "/uploads", `{"tailNumber":"N123","files":[{"filename":"log.pdf"}]}`, nil, nil)
+			resp, err := h.Handle(context.Background(), event)
+			if err != nil || resp.StatusCode != 200 {
+				t.Fatalf("upload: status %d, err %v", resp.StatusCode, err)
+			}
+			h.enrichWG.Wait()
+
+			if tt.wantFetch != (len(fetched) == 1 && updated) {
+				t.Errorf("fetched = %v, updated = %v, want fetch %v", fetched, updated, tt.wantFetch)
+			}
+			if tt.wantMessage == "" {
+				if len(sqsMock.messages) != 0 {
+					t.Errorf("unexpected messages %v", sqsMock.messages)
+				}
+				return
+			}
+			if len(sqsMock.messages) != 1 || sqsMock.messages[0] != tt.wantMessage || sqsMock.queueURLs[0] != tt.queueURL {
+				t.Errorf("messages = %v to %v, want %s", sqsMock.messages, sqsMock.queueURLs, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestUpload_FAAEnrichmentDoesNotBlock(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		fmt.Fprint(w, `{}`)
+	}))
+	defer srv.Close()
+
+	db := &mockDB{}
+	h := newTestHandler(db)
+	h.faa = &faa.Enricher{DB: db, Secrets: h.secrets, BaseURL: srv.URL, SecretARN: "faa-secret"}
+
+	// The request context is cancelled as soon as the response is sent; the
+	// enrichment must not depend on it.
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		event := makeEvent("POST", "/uploads", `{"tailNumber":"N123","files":[{"filename":"log.pdf"}]}`, nil, nil)
+		if resp, err := h.Handle(ctx, event); err != nil || resp.StatusCode != 200 {
+			t.Errorf("upload: status %d, err %v", resp.StatusCode, err)
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Error("upload waited on the FAA registry")
+	}
+	cancel()
+
+	var updated bool
+	db.execFn = func(ctx context.Context, sql string, args ...any) error {
+		updated = ctx.Err() == nil
+		return nil
+	}
+	close(release)
+	h.enrichWG.Wait()
+	if !updated {
+		t.Error("enrichment should complete after the request context is cancelled")
+	}
+}
+
+func TestHandleUpload_IdempotencyKey(t *testing.T) {
+	post := func(t *testing.T, h *Handler, body string, headers map[string]string) (int, map[string]any, string) {
+		t.Helper()
+		raw, _ := json.Marshal(events.APIGatewayProxyRequest{
+			HTTPMethod: "POST",
+			Resource:   "/uploads",
+			Body:       body,
+			Headers:    headers,
+		})
+		resp, err := h.Handle(context.Background(), raw)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return resp.StatusCode, parseBody(t, resp.Body), resp.Headers["Idempotent-Replayed"]
+	}
+	pdfBody := `{"tailNumber":"N123","files":[{"filename":"log.pdf"}]}`
+
+	t.Run("repeat returns original batch", func(t *testing.T) {
+		fake := newFakeUploads()
+		h := newTestHandler(fake.db())
+		headers := map[string]string{"idempotency-key": "retry-abc"}
+
+		status, first, replayed := post(t, h, pdfBody, headers)
+		if status != 200 || replayed != "" {
+			t.Fatalf("first request: status %d, replayed %q", status, replayed)
+		}
+		status, second, replayed := post(t, h, pdfBody, headers)
+		if status != 200 || replayed != "true" {
+			t.Fatalf("repeat request: status %d, replayed %q", status, replayed)
+		}
+		if fake.batchInserts != 1 {
+			t.Errorf("batch inserts = %d, want 1", fake.batchInserts)
+		}
+		if first["uploadId"] != second["uploadId"] {
+			t.Errorf("uploadId = %v, want original %v", second["uploadId"], first["uploadId"])
+		}
+		firstFiles := first["files"].([]any)[0].(map[string]any)
+		secondFiles := second["files"].([]any)[0].(map[string]any)
+		if firstFiles["s3Key"] != secondFiles["s3Key"] || secondFiles["uploadUrl"] == nil {
+			t.Errorf("replayed files = %v, want %v", secondFiles, firstFiles)
+		}
+	})
+
+	t.Run("different keys create distinct batches", func(t *testing.T) {
+		fake := newFakeUploads()
+		h := newTestHandler(fake.db())
+
+		_, first, _ := post(t, h, pdfBody, map[string]string{"Idempotency-Key": "key-1"})
+		_, second, replayed := post(t, h, pdfBody, map[string]string{"Idempotency-Key": "key-2"})
+		if replayed != "" {
+			t.Error("second key should not replay")
+		}
+		if fake.batchInserts != 2 || first["uploadId"] == second["uploadId"] {
+			t.Errorf("batch inserts = %d, uploadIds %v and %v", fake.batchInserts, first["uploadId"], second["uploadId"])
+		}
+	})
+
+	t.Run("no key always creates", func(t *testing.T) {
+		fake := newFakeUploads()
+		h := newTestHandler(fake.db())
+
+		post(t, h, pdfBody, nil)
+		post(t, h, pdfBody, nil)
+		if fake.batchInserts != 2 {
+			t.Errorf("batch inserts = %d, want 2", fake.batchInserts)
+		}
+	})
+
+	t.Run("body field and multi-image replay", func(t *testing.T) {
+		fake := newFakeUploads()
+		h := newTestHandler(fake.db())
+		body := `{"tailNumber":"N123","idempotencyKey":"imgs-1","files":[{"filename":"a.jpg"},{"filename":"b.png"}]}`
+
+		_, first, _ := post(t, h, body, nil)
+		status, second, replayed := post(t, h, body, nil)
+		if status != 200 || replayed != "true" {
+			t.Fatalf("repeat request: status %d, replayed %q", status, replayed)
+		}
+		if first["uploadId"] != second["uploadId"] || second["pageCount"] != float64(2) {
+			t.Errorf("replayed %v, want batch %v with 2 pages", second, first["uploadId"])
+		}
+		files := second["files"].([]any)
+		if files[1].(map[string]any)["s3Key"] != first["files"].([]any)[1].(map[string]any)["s3Key"] {
+			t.Errorf("replayed page keys differ: %v", files)
+		}
+	})
+
+	t.Run("sourceUrl image replay", func(t *testing.T) {
+		fake := newFakeUploads()
+		h := newTestHandler(fake.db())
+		h.sqs = &mockSQS{}
+		h.fetchQueueURL = "https://sqs.example.com/fetch"
+		h.sourceHosts = sourceurl.Allowlist{"scans.example.com"}
+		body := `{"tailNumber":"N123","idempotencyKey":"url-1","sourceUrl":"https://scans.example.com/page.png"}`
+
+		_, first, _ := post(t, h, body, nil)
+		status, second, replayed := post(t, h, body, nil)
+		if status != 202 || replayed != "true" {
+			t.Fatalf("repeat request: status %d, replayed %q", status, replayed)
+		}
+		if second["uploadId"] != first["uploadId"] || second["uploadType"] != "image" || second["s3Key"] != first["s3Key"] {
+			t.Errorf("replayed %v, want %v", second, first)
+		}
+	})
+
+	t.Run("lost race replays winner", func(t *testing.T) {
+		fake := newFakeUploads()
+		h := newTestHandler(fake.db())
+		// Another request stored the key between our lookup and insert.
+		lookups := 0
+		db := fake.db()
+		query := db.queryFn
+		db.queryFn = func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			if strings.Contains(sql, "idempotency_key = $2") {
+				if lookups++; lookups == 1 {
+					fake.batches["race"] = map[string]any{"id": "winner", "upload_type": "pdf", "source_filename": "log.pdf", "s3_key": "uploads/winner/log.pdf"}
+					return nil, nil
+				}
+			}
+			return query(ctx, sql, args...)
+		}
+		h.db = db
+
+		status, body, replayed := post(t, h, pdfBody, map[string]string{"Idempotency-Key": "race"})
+		if status != 200 || replayed != "true" || body["uploadId"] != "winner" {
+			t.Errorf("status %d, replayed %q, uploadId %v; want winner's batch", status, replayed, body["uploadId"])
+		}
+	})
+
+	t.Run("key too long", func(t *testing.T) {
+		h := newTestHandler(newFakeUploads().db())
+		status, body, _ := post(t, h, pdfBody, map[string]string{"Idempotency-Key": strings.Repeat("k", 256)})
+		if status != 400 {
+			t.Errorf("status = %d, want 400 (%v)", status, body)
+		}
+	})
+}
+
+func TestHandleEntries_WithNeedsReview(t *testing.T) {
+	callCount := 0
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			callCount++
+			if callCount == 1 {
+				return []map[string]any{{"id": "aid-1"}}, nil
+			}
+			if strings.Contains(sql, "COUNT") {
+				return []map[string]any{{"total": int64(5)}}, nil
+			}
+			return []map[string]any{
+				{"id": "entry-1", "entry_type": "maintenance", "needs_review": true},
+			}, nil
+		},
+	}
+	h := newTestHandler(db)
+
+	event := makeEvent("GET", "/aircraft/{tailNumber}/entries", "",
+		map[string]string{"tailNumber": "N123"},
+		map[string]string{"needsReview": "true", "dateFrom": "2024-01-01", "dateTo": "2024-12-31"})
+	resp, err := h.Handle(context.Background(), event)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestHandleUpdateEntry_NoFieldsToUpdate(t *testing.T) {
+	callCount := 0
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			callCount++
+			if callCount == 1 {
+				return []map[string]any{{"id": "aid-1"}}, nil
+			}
+			return []map[string]any{{"id": "entry-1"}}, nil
+		},
+	}
+	h := newTestHandler(db)
+
+	// Send a body with unknown fields (no patchable fields and no reviewStatus)
+	event := makeEvent("PATCH", "/aircraft/{tailNumber}/entries/{entryId}",
+		`{"unknownField":"value"}`,
+		map[string]string{"tailNumber": "N123", "entryId": "entry-1"}, nil)
+	resp, err := h.Handle(context.Background(), event)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != 400 {
+		t.Errorf("status = %d, want 400", resp.StatusCode)
+	}
+	if _, msg := parseError(t, resp.Body); !strings.Contains(msg, "No fields") {
+		t.Errorf("error = %q, want 'No fields to update'", msg)
+	}
+}
+
+func TestHandleUpdateEntry_Validation(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		wantStatus  int
+		wantInvalid map[string]any
+		wantUpdate  map[string]any // column → value
+		wantInspect any
+	}{
+		{
+			name:        "invalid numeric",
+			body:        `{"hobbsTime":"abc","tachTime":-3,"shopName":"OK Shop"}`,
+			wantStatus:  400,
+			wantInvalid: map[string]any{"hobbsTime": "must be a number", "tachTime": "must be between 0 and 999999999.9"},
+		},
+		{
+			name:       "invalid enum",
+			body:       `{"entryType":"garbage","inspectionType":"monthly"}`,
+			wantStatus: 400,
+			wantInvalid: map[string]any{
+				"entryType":      "must be one of ad_compliance, inspection, maintenance, other",
+				"inspectionType": "must be one of 100hr, 50hr, altimeter_static, annual, elt, other, progressive, transponder",
+			},
+		},
+		{
+			name:        "invalid date and types",
+			body:        `{"entryDate":"last tuesday","maintenanceNarrative":"","shopName":42}`,
+			wantStatus:  400,
+			wantInvalid: map[string]any{"entryDate": "must be a date (YYYY-MM-DD)", "maintenanceNarrative": "must be a non-empty string", "shopName": "must be a string or null"},
+		},
+		{
+			name:       "valid mixed patch",
+			body:       `{"hobbsTime":"1234.5","flightTime":1.2,"tachTime":null,"entryDate":"03/15/2024","entryType":"inspection","inspectionType":"annual","shopName":"Acme","unknownField":"ignored"}`,
+			wantStatus: 200,
+			wantUpdate: map[string]any{
+				"hobbs_time": 1234.5, "flight_time": 1.2, "tach_time": nil,
+				"entry_date": "2024-03-15", "entry_type": "inspection", "shop_name": "Acme",
+			},
+			wantInspect: "annual",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var updateSQL string
+			var updateArgs []any
+			var inspectArgs []any
+			db := &mockDB{
+				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+					switch {
+					case strings.Contains(sql, "FROM aircraft"):
+						return []map[string]any{{"id": "aid-1"}}, nil
+					case strings.Contains(sql, "UPDATE maintenance_entries"):
+						updateSQL, updateArgs = sql, args
+						return []map[string]any{{"id": "entry-1"}}, nil
+					}
+					return []map[string]any{{"id": "entry-1", "entry_type": "inspection"}}, nil
+				},
+				execFn: func(ctx context.Context, sql string, args ...any) error {
+					if strings.Contains(sql, "UPDATE inspection_records") {
+						inspectArgs = args
+					}
+					return nil
+				},
+			}
+			h := newTestHandler(db)
+
+			event := makeEvent("PATCH", "/aircraft/{tailNumber}/entries/{entryId}", tt.body,
+				map[string]string{"tailNumber": "N123", "entryId": "entry-1"}, nil)
+			resp, err := h.Handle(context.Background(), event)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body: %s", resp.StatusCode, tt.wantStatus, resp.Body)
+			}
+
+			if tt.wantInvalid != nil {
+				if updateSQL != "" || inspectArgs != nil {
+					t.Error("nothing should be written when a field is invalid")
+				}
+				errBody, _ := parseBody(t, resp.Body)["error"].(map[string]any)
+				if fmt.Sprint(errBody["fields"]) != fmt.Sprint(tt.wantInvalid) {
+					t.Errorf("fields = %v, want %v", errBody["fields"], tt.wantInvalid)
+				}
+				return
+			}
+
+			// Map each SET column to its bound argument.
+			got := map[string]any{}
+			for _, clause := range strings.Split(strings.SplitN(strings.SplitN(updateSQL, " SET ", 2)[1], " WHERE ", 2)[0], ", ") {
+				var col string
+				var idx int
+				if n, _ := fmt.Sscanf(clause, "%s = $%d", &col, &idx); n == 2 {
+					got[col] = updateArgs[idx-1]
+				}
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.wantUpdate) {
+				t.Errorf("update = %v, want %v", got, tt.wantUpdate)
+			}
+			if len(inspectArgs) != 3 || inspectArgs[0] != tt.wantInspect || inspectArgs[1] != "entry-1" {
+				t.Errorf("inspection update args = %v", inspectArgs)
+			}
+		})
+	}
+}
+
+func TestHandleUpdateEntry_NotFound(t *testing.T) {
+	callCount := 0
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			callCount++
+			if callCount == 1 {
+				return []map[string]any{{"id": "aid-1"}}, nil
+			}
+			// UPDATE RETURNING returns empty — not found
+			return nil, nil
+		},
+	}
+	h := newTestHandler(db)
+
+	event := makeEvent("PATCH", "/aircraft/{tailNumber}/entries/{entryId}",
+		`{"shopName":"Test Shop"}`,
+		map[string]string{"tailNumber": "N123", "entryId": "entry-999"}, nil)
+	resp, err := h.Handle(context.Background(), event)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != 404 {
+		t.Errorf("status = %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestHandleUpdateEntry_RecordsRevision(t *testing.T) {
+	var updateSQL string
+	var updateArgs []any
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			switch {
+			case strings.Contains(sql, "FROM aircraft"):
+				return []map[string]any{{"id": "aid-1"}}, nil
+			case strings.Contains(sql, "UPDATE maintenance_entries"):
+				updateSQL, updateArgs = sql, args
+				return []map[string]any{{"id": "entry-1"}}, nil
+			}
+			return []map[string]any{{"id": "entry-1"}}, nil
+		},
+	}
+	h := newTestHandler(db)
+
+	event := makeEvent("PATCH", "/aircraft/{tailNumber}/entries/{entryId}",
+		`{"shopName":"Acme","reviewStatus":"corrected","reviewedBy":"jsmith","inspectionType":"annual"}`,
+		map[string]string{"tailNumber": "N123", "entryId": "entry-1"}, nil)
+	resp, err := h.Handle(context.Background(), event)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("status = %d, body: %s", resp.StatusCode, resp.Body)
+	}
+
+	// The revision is written by the same statement as the update.
+	for _, want := range []string{
+		"FOR UPDATE",
+		"INSERT INTO entry_revisions (entry_id, aircraft_id, previous_values, new_values, revised_by)",
+		"'shopName', p.shop_name", "'shopName', u.shop_name",
+		"'reviewStatus', p.review_status", "'reviewedBy', p.reviewed_by",
+		"'inspectionType', (SELECT inspection_type FROM inspection_records WHERE entry_id = p.id",
+	} {
+		if !strings.Contains(updateSQL, want) {
+			t.Errorf("update SQL missing %q:\n%s", want, updateSQL)
+		}
+	}
+	if strings.Contains(updateSQL, "needs_review") {
+		t.Error("a correction leaves needs_review alone, so it shouldn't be in the revision")
+	}
+	n := len(updateArgs)
+	if n < 4 || updateArgs[n-4] != "annual" || updateArgs[n-3] != "entry-1" || updateArgs[n-2] != "aid-1" || updateArgs[n-1] != "jsmith" {
+		t.Errorf("update args = %v", updateArgs)
+	}
+}
+
+func TestHandleEntryHistory(t *testing.T) {
+	newer := time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)
+	older := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		entryFound bool
+		wantStatus int
+	}{
+		{name: "lists revisions newest first", entryFound: true, wantStatus: 200},
+		{name: "entry not found", entryFound: false, wantStatus: 404},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var historySQL string
+			db := &mockDB{
+				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+					switch {
+					case strings.Contains(sql, "FROM aircraft"):
+						return []map[string]any{{"id": "aid-1"}}, nil
+					case strings.Contains(sql, "FROM maintenance_entries"):
+						if !tt.entryFound {
+							return nil, nil
+						}
+						return []map[string]any{{"id": "entry-1"}}, nil
+					case strings.Contains(sql, "FROM entry_revisions"):
+						historySQL = sql
+						return []map[string]any{
+							{"id": "rev-2", "revised_by": nil, "created_at": newer,
+								"previous_values": map[string]any{"shopName": "Acme"},
+								"new_values":      map[string]any{"shopName": "Acme Aviation"}},
+							{"id": "rev-1", "revised_by": "jsmith", "created_at": older,
+								"previous_values": map[string]any{"shopName": nil, "reviewStatus": "pending"},
+								"new_values":      map[string]any{"shopName": "Acme", "reviewStatus": "corrected"}},
+						}, nil
+					}
+					return nil, nil
+				},
+			}
+			h := newTestHandler(db)
+
+			event := makeEvent("GET", "/aircraft/{tailNumber}/entries/{entryId}/history", "",
+				map[string]string{"tailNumber": "N123", "entryId": "entry-1"}, nil)
+			resp, err := h.Handle(context.Background(), event)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body: %s", resp.StatusCode, tt.wantStatus, resp.Body)
+			}
+			if tt.wantStatus != 200 {
+				if code, _ := parseError(t, resp.Body); code != codeEntryNotFound {
+					t.Errorf("code = %q", code)
+				}
+				return
+			}
+
+			if !strings.Contains(historySQL, "ORDER BY created_at DESC") {
+				t.Errorf("history should be ordered newest first: %s", historySQL)
+			}
+			body := parseBody(t, resp.Body)
+			revs, _ := body["revisions"].([]any)
+			if len(revs) != 2 {
+				t.Fatalf("revisions = %v", body["revisions"])
+			}
+			first := revs[0].(map[string]any)
+			second := revs[1].(map[string]any)
+			if first["id"] != "rev-2" || second["id"] != "rev-1" {
+				t.Errorf("order = %v, %v", first["id"], second["id"])
+			}
+			if second["reviewedBy"] != "jsmith" || second["revisedAt"] != "2024-03-01T00:00:00Z" {
+				t.Errorf("second revision = %v", second)
+			}
+			if fmt.Sprint(second["previousValues"]) != "map[reviewStatus:pending shopName:<nil>]" ||
+				fmt.Sprint(second["newValues"]) != "map[reviewStatus:corrected shopName:Acme]" {
+				t.Errorf("second revision values = %v -> %v", second["previousValues"], second["newValues"])
+			}
+		})
+	}
+}
+
+func TestHandleSimilarEntries(t *testing.T) {
+	tests := []struct {
+		name        string
+		entry       []map[string]any
+		query       map[string]string
+		wantStatus  int
+		wantSimilar []string
+		wantReason  bool
+		wantLimit   any
+	}{
+		{
+			name:        "neighbours most similar first",
+			entry:       []map[string]any{{"id": "entry-1", "embedding": "[0.1,0.2,0.3]"}},
+			wantStatus:  200,
+			wantSimilar: []string{"entry-7 0.93", "entry-3 0.81"},
+			wantLimit:   5,
+		},
+		{
+			name:        "custom limit",
+			entry:       []map[string]any{{"id": "entry-1", "embedding": "[0.1,0.2,0.3]"}},
+			query:       map[string]string{"limit": "2"},
+			wantStatus:  200,
+			wantSimilar: []string{"entry-7 0.93", "entry-3 0.81"},
+			wantLimit:   2,
+		},
+		{
+			name:       "no embedding",
+			entry:      []map[string]any{{"id": "entry-1", "embedding": nil}},
+			wantStatus: 200,
+			wantReason: true,
+		},
+		{name: "entry not found", wantStatus: 404},
+		{name: "invalid limit", query: map[string]string{"limit": "50"}, wantStatus: 400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var neighbourArgs []any
+			db := &mockDB{
+				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+					switch {
+					case strings.Contains(sql, "FROM aircraft"):
+						return []map[string]any{{"id": "aid-1"}}, nil
+					case strings.Contains(sql, "emb.embedding::text"):
+						return tt.entry, nil
+					case strings.Contains(sql, "<=> $1::halfvec"):
+						neighbourArgs = args
+						return []map[string]any{
+							{"entry_id": "entry-7", "chunk_text": "Replaced left magneto", "entry_date": "2023-04-02",
+								"entry_type": "maintenance", "inspection_type": nil, "similarity": 0.93},
+							{"entry_id": "entry-3", "chunk_text": "Magneto timing checked", "entry_date": "2021-09-14",
+								"entry_type": "maintenance", "inspection_type": nil, "similarity": 0.81},
+						}, nil
+					}
+					return nil, nil
+				},
+			}
+			h := newTestHandler(db)
+
+			event := makeEvent("GET", "/aircraft/{tailNumber}/entries/{entryId}/similar", "",
+				map[string]string{"tailNumber": "N123", "entryId": "entry-1"}, tt.query)
+			resp, err := h.Handle(context.Background(), event)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body: %s", resp.StatusCode, tt.wantStatus, resp.Body)
+			}
+			if tt.wantStatus == 404 {
+				if code, _ := parseError(t, resp.Body); code != codeEntryNotFound {
+					t.Errorf("code = %q", code)
+				}
+				return
+			}
+			if tt.wantStatus != 200 {
+				return
+			}
+
+			body := parseBody(t, resp.Body)
+			similar, ok := body["similar"].([]any)
+			if !ok {
+				t.Fatalf("similar = %v", body["similar"])
+			}
+			if tt.wantReason {
+				if len(similar) != 0 || body["reason"] == nil {
+					t.Errorf("similar = %v, reason = %v, want an empty list with a reason", similar, body["reason"])
+				}
+				if neighbourArgs != nil {
+					t.Error("no neighbour search should run without an embedding")
+				}
+				return
+			}
+
+			var got []string
+			for _, s := range similar {
+				m := s.(map[string]any)
+				got = append(got, fmt.Sprintf("%v %v", m["entryId"], m["similarity"]))
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.wantSimilar) {
+				t.Errorf("similar = %v, want %v", got, tt.wantSimilar)
+			}
+			if len(neighbourArgs) != 5 || neighbourArgs[0] != "[0.1,0.2,0.3]" || neighbourArgs[3] != "entry-1" || neighbourArgs[4] != tt.wantLimit {
+				t.Errorf("neighbour args = %v", neighbourArgs)
+			}
+			if _, ok := body["reason"]; ok {
+				t.Error("reason should be absent when neighbours were searched")
+			}
+		})
+	}
+}
+
+func TestHandleInspections_WithTypeFilter(t *testing.T) {
+	callCount := 0
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			callCount++
+			if callCount == 1 {
+				return []map[string]any{{"id": "aid-1"}}, nil
+			}
+			if strings.Contains(sql, "COUNT") {
+				return []map[string]any{{"total": int64(2)}}, nil
+			}
+			return []map[string]any{
+				{"id": "insp-1", "inspection_type": "annual"},
+			}, nil
+		},
+	}
+	h := newTestHandler(db)
+
+	event := makeEvent("GET", "/aircraft/{tailNumber}/inspections", "",
+		map[string]string{"tailNumber": "N123"},
+		map[string]string{"type": "annual"})
+	resp, err := h.Handle(context.Background(), event)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestToInt64(t *testing.T) {
+	tests := []struct {
+		input any
+		want  int64
+		ok    bool
+	}{
+		{int64(42), 42, true},
+		{int32(42), 42, true},
+		{int(42), 42, true},
+		{float64(42.0), 42, true},
+		{"not a number", 0, false},
+		{nil, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := toInt64(tt.input)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("toInt64(%v) = (%d, %v), want (%d, %v)", tt.input, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestFirstOrNil(t *testing.T) {
+	if firstOrNil(nil) != nil {
+		t.Error("expected nil for empty slice")
+	}
+	if firstOrNil([]map[string]any{}) != nil {
+		t.Error("expected nil for empty slice")
+	}
+	rows := []map[string]any{{"key": "val"}}
+	result := firstOrNil(rows)
+	if result == nil {
+		t.Error("expected non-nil for non-empty slice")
+	}
+}
+
+func TestFormatHours(t *testing.T) {
+	tests := []struct {
+		hours   float64
+		grouped bool
+		want    string
+	}{
+		{0, false, "0.0"},
+		{0, true, "0.0"},
+		{1234.56, false, "1234.6"},
+		{123456789.9, false, "123456789.9"},
+		{123456789.9, true, "123,456,789.9"},
+		{1e21, false, "1000000000000000000000.0"},
+		{999.95, true, "1,000.0"},
+		{-1234.5, true, "-1,234.5"},
+	}
+	for _, tt := range tests {
+		if got := formatHours(tt.hours, tt.grouped); got != tt.want {
+			t.Errorf("formatHours(%v, %v) = %q, want %q", tt.hours, tt.grouped, got, tt.want)
+		}
+	}
+}
+
+func TestHoursText(t *testing.T) {
+	tests := []struct {
+		input any
+		want  any
+	}{
+		{float64(4321.25), "4321.2"},
+		{int64(1500), "1500.0"},
+		{nil, nil},
+		{"4321.2", nil},
+	}
+	for _, tt := range tests {
+		if got := hoursText(tt.input); got != tt.want {
+			t.Errorf("hoursText(%v) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestGetGeminiClient_Cached(t *testing.T) {
+	h := newTestHandler(&mockDB{})
+	mock := &gemini.MockClient{}
+	h.gemini = mock
+
+	client, err := h.getGeminiClient(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if client != mock {
+		t.Error("expected cached client to be returned")
+	}
+}
+
+func TestHandleQuery_NoResults(t *testing.T) {
+	callCount := 0
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			callCount++
+			if callCount == 1 {
+				return []map[string]any{{"id": "aid-1"}}, nil
+			}
+			return []map[string]any{}, nil
+		},
+	}
+	h := newTestHandler(db)
+	h.gemini = &gemini.MockClient{
+		EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
+			return make([]float32, gemini.DefaultEmbeddingDimensions), nil
+		},
+	}
+
+	event := makeEvent("POST", "/aircraft/{tailNumber}/query",
+		`{"question":"test?"}`,
+		map[string]string{"tailNumber": "N123"}, nil)
+	resp, err := h.Handle(context.Background(), event)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+	body := parseBody(t, resp.Body)
+	if body["answer"] != "No maintenance records found for this aircraft." {
+		t.Errorf("unexpected answer: %v", body["answer"])
+	}
+}
+
+func TestNewUUID(t *testing.T) {
+	id := newUUID()
+	if len(id) != 36 {
+		t.Errorf("UUID length = %d, want 36", len(id))
+	}
+	// Check format: 8-4-4-4-12
+	parts := strings.Split(id, "-")
+	if len(parts) != 5 {
+		t.Errorf("UUID parts = %d, want 5", len(parts))
+	}
+
+	// Ensure uniqueness
+	id2 := newUUID()
+	if id == id2 {
+		t.Error("UUIDs should be unique")
+	}
+}
+
+func TestNewUUIDv7(t *testing.T) {
+	before := time.Now().UnixMilli()
+	id := newUUIDv7()
+	after := time.Now().UnixMilli()
+
+	if len(id) != 36 || strings.Count(id, "-") != 4 {
+		t.Fatalf("UUID %q is not in 8-4-4-4-12 form", id)
+	}
+	raw, err := hex.DecodeString(strings.ReplaceAll(id, "-", ""))
+	if err != nil {
+		t.Fatalf("UUID %q is not hex: %v", id, err)
+	}
+	if v := raw[6] >> 4; v != 7 {
+		t.Errorf("version = %d, want 7", v)
+	}
+	if v := raw[8] >> 6; v != 0b10 {
+		t.Errorf("variant bits = %02b, want 10", v)
+	}
+	var ms int64
+	for _, b := range raw[:6] {
+		ms = ms<<8 | int64(b)
+	}
+	// The counter may carry into the next millisecond under heavy load.
+	if ms < before || ms > after+1 {
+		t.Errorf("timestamp = %d, want within [%d, %d]", ms, before, after)
+	}
+}
+
+func TestNewUUIDv7_Monotonic(t *testing.T) {
+	prev := newUUIDv7()
+	for i := 0; i < 10000; i++ {
+		id := newUUIDv7()
+		if id <= prev {
+			t.Fatalf("generation %d: %q does not sort after %q", i, id, prev)
+		}
+		prev = id
+	}
+}
+
+func TestInspectionGaps(t *testing.T) {
+	insp := func(typ, date string, hours any) map[string]any {
+		d, _ := time.Parse("2006-01-02", date)
+		return map[string]any{"inspection_type": typ, "inspection_date": d, "aircraft_hours": hours}
+	}
+
+	tests := []struct {
+		name string
+		rows []map[string]any
+		want []string // "type start→end"
+	}{
+		{
+			name: "compliant annuals within calendar month",
+			rows: []map[string]any{
+				insp("annual", "2019-03-15", nil),
+				insp("annual", "2020-03-31", nil),
+				insp("annual", "2021-02-10", nil),
+			},
+		},
+		{
+			name: "lapsed annual",
+			rows: []map[string]any{
+				insp("annual", "2019-03-15", nil),
+				insp("annual", "2020-03-30", nil),
+				insp("annual", "2021-05-02", nil),
+			},
+			want: []string{"annual 2020-03-30→2021-05-02"},
+		},
+		{
+			name: "transponder on 24 month interval",
+			rows: []map[string]any{
+				insp("transponder", "2018-06-01", nil),
+				insp("transponder", "2020-06-20", nil),
+				insp("transponder", "2022-07-01", nil),
+			},
+			want: []string{"transponder 2020-06-20→2022-07-01"},
+		},
+		{
+			name: "100hr within tolerance and overflown",
+			rows: []map[string]any{
+				insp("100hr", "2020-01-10", 1200.0),
+				insp("100hr", "2020-04-10", 1308.0),
+				insp("100hr", "2020-08-10", 1425.5),
+			},
+			want: []string{"100hr 2020-04-10→2020-08-10"},
+		},
+		{
+			name: "types are not compared with each other",
+			rows: []map[string]any{
+				insp("annual", "2015-01-01", nil),
+				insp("elt", "2020-01-01", nil),
+			},
+		},
+		{
+			name: "other inspections have no window",
+			rows: []map[string]any{
+				insp("other", "2010-01-01", nil),
+				insp("other", "2020-01-01", nil),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gaps := inspectionGaps(tt.rows)
+			var got []string
+			for _, g := range gaps {
+				got = append(got, fmt.Sprintf("%s %s→%s", g["inspectionType"], g["startDate"], g["endDate"]))
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("gaps = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	lapsed := inspectionGaps([]map[string]any{
+		insp("annual", "2020-03-30", nil),
+		insp("annual", "2021-05-02", nil),
+	})[0]
+	if lapsed["dueBy"] != "2021-03-31" || lapsed["daysOverdue"] != 32 || lapsed["expectedIntervalMonths"] != 12 {
+		t.Errorf("lapsed annual = %v", lapsed)
+	}
+}
+
+func TestEntryGaps(t *testing.T) {
+	date := func(s string) time.Time {
+		d, _ := time.Parse("2006-01-02", s)
+		return d
+	}
+	dates := []time.Time{
+		date("2015-01-10"),
+		date("2016-01-10"), // exactly 12 months: not a gap
+		date("2018-05-01"),
+		date("2018-06-01"),
+	}
+
+	gaps := entryGaps(dates, 12)
+	if len(gaps) != 1 {
+		t.Fatalf("gaps = %v, want 1", gaps)
+	}
+	if gaps[0]["startDate"] != "2016-01-10" || gaps[0]["endDate"] != "2018-05-01" {
+		t.Errorf("gap = %v", gaps[0])
+	}
+	if got := entryGaps(dates, 36); len(got) != 0 {
+		t.Errorf("36-month threshold gaps = %v, want none", got)
+	}
+}
+
+func TestHandleGaps(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      map[string]string
+		aircraft   []map[string]any
+		wantStatus int
+	}{
+		{"aircraft not found", nil, nil, 404},
+		{"invalid threshold", map[string]string{"inactivityMonths": "zero"}, []map[string]any{{"id": "aid-1"}}, 400},
+		{"gaps reported", map[string]string{"inactivityMonths": "24"}, []map[string]any{{"id": "aid-1"}}, 200},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &mockDB{
+				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+					switch {
+					case strings.Contains(sql, "FROM aircraft"):
+						return tt.aircraft, nil
+					case strings.Contains(sql, "FROM inspection_records"):
+						return []map[string]any{
+							{"inspection_type": "annual", "inspection_date": "2019-03-15"},
+							{"inspection_type": "annual", "inspection_date": "2020-06-01"},
+						}, nil
+					case strings.Contains(sql, "FROM maintenance_entries"):
+						return []map[string]any{
+							{"entry_date": "2012-01-01"},
+							{"entry_date": "2019-03-15"},
+							{"entry_date": "2020-06-01"},
+						}, nil
+					}
+					return nil, nil
+				},
+			}
+			h := newTestHandler(db)
+
+			event := makeEvent("GET", "/aircraft/{tailNumber}/gaps", "",
+				map[string]string{"tailNumber": "n123ab"}, tt.query)
+			resp, err := h.Handle(context.Background(), event)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if tt.wantStatus != 200 {
+				return
+			}
+
+			body := parseBody(t, resp.Body)
+			if body["inactivityMonths"] != float64(24) {
+				t.Errorf("inactivityMonths = %v, want 24", body["inactivityMonths"])
+			}
+			if gaps, _ := body["inspectionGaps"].([]any); len(gaps) != 1 {
+				t.Errorf("inspectionGaps = %v, want 1", body["inspectionGaps"])
+			}
+			if gaps, _ := body["entryGaps"].([]any); len(gaps) != 1 {
+				t.Errorf("entryGaps = %v, want 1", body["entryGaps"])
+			}
+		})
+	}
+}
+
+// sseEvent is one parsed server-sent event.
+type sseEvent struct {
+	name string
+	data map[string]any
+}
+
+func parseEvents(t *testing.T, stream string) []sseEvent {
+	t.Helper()
+	var evts []sseEvent
+	for _, block := range strings.Split(strings.TrimSuffix(stream, "\n\n"), "\n\n") {
+		name, data, ok := strings.Cut(block, "\ndata: ")
+		if !ok || !strings.HasPrefix(name, "event: ") {
+			t.Fatalf("malformed event %q", block)
+		}
+		evts = append(evts, sseEvent{name: strings.TrimPrefix(name, "event: "), data: parseBody(t, data)})
+	}
+	return evts
+}
+
+func eventNames(evts []sseEvent) string {
+	names := make([]string, len(evts))
+	for i, e := range evts {
+		names[i] = e.name
+	}
+	return strings.Join(names, ",")
+}
+
+func TestStreamQuery(t *testing.T) {
+	chunks := []string{"The last oil change ", "was on ", "January 15, 2024."}
+	tests := []struct {
+		name      string
+		streamErr error
+		wantNames string
+		wantText  string
+	}{
+		{
+			name:      "chunks in order",
+			wantNames: "sources,answer,answer,answer,done",
+			wantText:  "The last oil change was on January 15, 2024.",
+		},
+		{
+			name:      "generation fails mid-stream",
+			streamErr: fmt.Errorf("quota exceeded"),
+			wantNames: "sources,answer,answer,answer,error",
+			wantText:  "The last oil change was on January 15, 2024.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler(&mockDB{})
+			q := &ragQuery{
+				client: &gemini.MockClient{
+					GenerateContentStreamFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig, yield func(string) error) error {
+						if parts[0].Text != "prompt" {
+							t.Errorf("prompt = %q", parts[0].Text)
+						}
+						for _, c := range chunks {
+							if err := yield(c); err != nil {
+								return err
+							}
+						}
+						return tt.streamErr
+					},
+				},
+				prompt: "prompt",
+				response: map[string]any{
+					"tailNumber": "N123",
+					"sources":    []map[string]any{{"entryId": "e1"}},
+				},
+			}
+
+			var buf bytes.Buffer
+			if err := h.streamQuery(context.Background(), q, &buf); err != nil {
+				t.Fatalf("streamQuery: %v", err)
+			}
+			evts := parseEvents(t, buf.String())
+			if got := eventNames(evts); got != tt.wantNames {
+				t.Fatalf("events = %s, want %s", got, tt.wantNames)
+			}
+			if _, ok := evts[0].data["answer"]; ok {
+				t.Error("sources event should not carry the answer")
+			}
+			if evts[0].data["tailNumber"] != "N123" {
+				t.Errorf("sources event = %v", evts[0].data)
+			}
+			var text strings.Builder
+			for _, e := range evts {
+				if e.name == "answer" {
+					text.WriteString(e.data["text"].(string))
+				}
+			}
+			if text.String() != tt.wantText {
+				t.Errorf("answer = %q, want %q", text.String(), tt.wantText)
+			}
+		})
+	}
+}
+
+func TestStreamQuery_NoRecords(t *testing.T) {
+	h := newTestHandler(&mockDB{})
+	q := &ragQuery{
+		client: &gemini.MockClient{
+			GenerateContentStreamFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig, yield func(string) error) error {
+				t.Error("nothing should be generated without records")
+				return nil
+			},
+		},
+		response: map[string]any{"answer": "No maintenance records found for this aircraft."},
+	}
+
+	var buf bytes.Buffer
+	if err := h.streamQuery(context.Background(), q, &buf); err != nil {
+		t.Fatalf("streamQuery: %v", err)
+	}
+	evts := parseEvents(t, buf.String())
+	if got := eventNames(evts); got != "sources,answer,done" {
+		t.Fatalf("events = %s", got)
+	}
+	if evts[1].data["text"] != "No maintenance records found for this aircraft." {
+		t.Errorf("answer = %v", evts[1].data)
+	}
+}
+
+func TestInvoke_Query(t *testing.T) {
+	newHandler := func(streaming bool) *Handler {
+		callCount := 0
+		h := newTestHandler(&mockDB{
+			queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+				callCount++
+				if callCount == 1 {
+					return []map[string]any{{"id": "aid-1"}}, nil
+				}
+				return []map[string]any{{
+					"entry_id":              "e1",
+					"chunk_text":            "Oil changed",
+					"chunk_type":            "narrative",
+					"entry_date":            "2024-01-15",
+					"entry_type":            "maintenance",
+					"maintenance_narrative": "Changed oil and filter",
+					"similarity":            0.95,
+				}}, nil
+			},
+		})
+		h.gemini = &gemini.MockClient{
+			EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
+				return make([]float32, gemini.DefaultEmbeddingDimensions), nil
+			},
+			GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+				return "January 15, 2024.", nil
+			},
+		}
+		h.queryStreaming = streaming
+		return h
+	}
+	queryEvent := func(accept string) json.RawMessage {
+		b, _ := json.Marshal(events.APIGatewayProxyRequest{
+			HTTPMethod:     "POST",
+			Resource:       "/aircraft/{tailNumber}/query",
+			Body:           `{"question":"When was the last oil change?"}`,
+			PathParameters: map[string]string{"tailNumber": "N123"},
+			Headers:        map[string]string{"accept": accept},
+		})
+		return b
+	}
+
+	want, err := newHandler(false).Handle(context.Background(), queryEvent("application/json"))
+	if err != nil {
+		t.Fatalf("Handle: %v", err)
+	}
+
+	t.Run("streaming off", func(t *testing.T) {
+		got, err := newHandler(false).Invoke(context.Background(), queryEvent("text/event-stream"))
+		if err != nil {
+			t.Fatalf("Invoke: %v", err)
+		}
+		resp, ok := got.(events.APIGatewayProxyResponse)
+		if !ok {
+			t.Fatalf("Invoke returned %T", got)
+		}
+		if resp.Body != want.Body {
+			t.Errorf("body = %s, want %s", resp.Body, want.Body)
+		}
+	})
+
+	t.Run("json fallback", func(t *testing.T) {
+		got, err := newHandler(true).Invoke(context.Background(), queryEvent("application/json"))
+		if err != nil {
+			t.Fatalf("Invoke: %v", err)
+		}
+		resp, ok := got.(*events.LambdaFunctionURLStreamingResponse)
+		if !ok {
+			t.Fatalf("Invoke returned %T", got)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != 200 || string(body) != want.Body {
+			t.Errorf("status = %d, body = %s, want %s", resp.StatusCode, body, want.Body)
+		}
+	})
+
+	t.Run("event stream", func(t *testing.T) {
+		got, err := newHandler(true).Invoke(context.Background(), queryEvent("text/event-stream"))
+		if err != nil {
+			t.Fatalf("Invoke: %v", err)
+		}
+		resp, ok := got.(*events.LambdaFunctionURLStreamingResponse)
+		if !ok {
+			t.Fatalf("Invoke returned %T", got)
+		}
+		if resp.StatusCode != 200 || resp.Headers["Content-Type"] != "text/event-stream" {
+			t.Errorf("status = %d, headers = %v", resp.StatusCode, resp.Headers)
+		}
+		if resp.Headers["Access-Control-Allow-Origin"] == "" {
+			t.Error("missing CORS headers")
+		}
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("read stream: %v", err)
+		}
+		evts := parseEvents(t, string(body))
+		if got := eventNames(evts); got != "sources,answer,done" {
+			t.Fatalf("events = %s", got)
+		}
+		if sources, _ := evts[0].data["sources"].([]any); len(sources) != 1 {
+			t.Errorf("sources = %v", evts[0].data["sources"])
+		}
+		if evts[1].data["text"] != "January 15, 2024." {
+			t.Errorf("answer = %v", evts[1].data)
+		}
+	})
+
+	t.Run("event stream error before streaming", func(t *testing.T) {
+		h := newHandler(true)
+		h.db = &mockDB{}
+		got, err := h.Invoke(context.Background(), queryEvent("text/event-stream"))
+		if err != nil {
+			t.Fatalf("Invoke: %v", err)
+		}
+		resp, ok := got.(*events.LambdaFunctionURLStreamingResponse)
+		if !ok {
+			t.Fatalf("Invoke returned %T", got)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != 404 {
+			t.Errorf("status = %d, want 404, body: %s", resp.StatusCode, body)
+		}
+		if code, _ := parseError(t, string(body)); code != codeAircraftNotFound {
+			t.Errorf("code = %s", code)
+		}
+	})
+}
+
+func TestTenantScoping(t *testing.T) {
+	// N123 belongs to tenant-a; every other query finds nothing.
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			if strings.Contains(sql, "FROM aircraft WHERE registration = $1 AND tenant_id = $2") {
+				if args[0] == "N123" && args[1] == "tenant-a" {
+					return []map[string]any{{"id": "aid-1", "registration": "N123"}}, nil
+				}
+				return nil, nil
+			}
+			return nil, nil
+		},
+		insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+			return "test-uuid-123", nil
+		},
+	}
+	h := newTestHandler(db)
+	h.gemini = &gemini.MockClient{
+		EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
+			return make([]float32, gemini.DefaultEmbeddingDimensions), nil
+		},
+	}
+
+	requests := []struct {
+		method, resource, body string
+	}{
+		{"GET", "/aircraft/{tailNumber}/summary", ""},
+		{"GET", "/aircraft/{tailNumber}/parts", ""},
+		{"GET", "/aircraft/{tailNumber}/facets", ""},
+		{"GET", "/aircraft/{tailNumber}/weight-balance", ""},
+		{"GET", "/aircraft/{tailNumber}/gaps", ""},
+		{"POST", "/aircraft/{tailNumber}/query", `{"question":"When was the last oil change?"}`},
+		{"POST", "/uploads", `{"tailNumber":"N123","files":[{"filename":"log.pdf"}]}`},
+	}
+	for _, tenant := range []struct {
+		apiKeyID   string
+		wantStatus int
+	}{
+		{"tenant-a", 200},
+		{"tenant-b", 404},
+	} {
+		for _, r := range requests {
+			t.Run(tenant.apiKeyID+" "+r.method+" "+r.resource, func(t *testing.T) {
+				b, _ := json.Marshal(events.APIGatewayProxyRequest{
+					HTTPMethod:     r.method,
+					Resource:       r.resource,
+					Body:           r.body,
+					PathParameters: map[string]string{"tailNumber": "n123"},
+					RequestContext: events.APIGatewayProxyRequestContext{
+						Identity: events.APIGatewayRequestIdentity{APIKeyID: tenant.apiKeyID},
+					},
+				})
+				resp, err := h.Handle(context.Background(), b)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				// An upload creates the tenant's own aircraft for the tail.
+				wantStatus := tenant.wantStatus
+				if r.resource == "/uploads" {
+					wantStatus = 200
+				}
+				if resp.StatusCode != wantStatus {
+					t.Fatalf("status = %d, want %d, body: %s", resp.StatusCode, wantStatus, resp.Body)
+				}
+				if wantStatus == 404 {
+					if code, _ := parseError(t, resp.Body); code != codeAircraftNotFound {
+						t.Errorf("code = %s, want %s", code, codeAircraftNotFound)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestTenantScoping_Uploads(t *testing.T) {
+	const batchID = "00000000-0000-4000-8000-000000000001"
+	// The batch belongs to an aircraft of tenant-a; its pages and everything
+	// else are found for anyone who gets past the batch lookup.
+	var pastBatch []string
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			if strings.Contains(sql, "FROM upload_batches") {
+				if !strings.Contains(sql, "a.tenant_id") {
+					t.Errorf("upload query not scoped to the tenant: %s", sql)
+				}
+				if slices.Contains(args, any("tenant-a")) {
+					return []map[string]any{{
+						"id": batchID, "upload_type": "multi_image", "processing_status": "processing",
+						"page_count": int64(1), "total_pages": int64(1),
+					}}, nil
+				}
+				return nil, nil
+			}
+			pastBatch = append(pastBatch, sql)
+			return []map[string]any{{"id": "page-1", "page_number": int64(1), "image_path": "pages/" + batchID + "/page_0001.jpg"}}, nil
+		},
+	}
+	h := newTestHandler(db)
+	h.adminKeys = map[string]bool{"tenant-a": true, "tenant-b": true}
+	h.slicerDiagnostics = true
+
+	page := map[string]string{"id": batchID, "pageNumber": "1"}
+	requests := []struct {
+		method, resource, body string
+		pathParams             map[string]string
+	}{
+		{"GET", "/uploads/{id}/status", "", map[string]string{"id": batchID}},
+		{"POST", "/uploads/{id}/finalize", "", map[string]string{"id": batchID}},
+		{"POST", "/uploads/{id}/pages", `{"files":[{"filename":"p2.jpg"}]}`, map[string]string{"id": batchID}},
+		{"PATCH", "/uploads/{id}/pages/order", `{"order":{"page-1":1}}`, map[string]string{"id": batchID}},
+		{"GET", "/uploads/{id}/pages/{pageNumber}/image", "", page},
+		{"GET", "/uploads/{id}/pages/{pageNumber}/thumbnail", "", page},
+		{"GET", "/uploads/{id}/pages/{pageNumber}/slices/diag", "", page},
+		{"GET", "/uploads/{id}/pages/{pageNumber}/slices.zip", "", page},
+		{"GET", "/uploads/{id}/pages/{pageNumber}/extraction", "", page},
+		{"POST", "/uploads/{id}/candidates", `{"promptVersion":"v2"}`, map[string]string{"id": batchID}},
+		{"GET", "/uploads/{id}/pages/{pageNumber}/extraction/candidates/{promptVersion}", "",
+			map[string]string{"id": batchID, "pageNumber": "1", "promptVersion": "v2"}},
+	}
+	for _, r := range requests {
+		t.Run(r.method+" "+r.resource, func(t *testing.T) {
+			pastBatch = nil
+			resp, err := h.Handle(context.Background(), keyedEvent(r.method, r.resource, r.body, "tenant-b", r.pathParams))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if code, _ := parseError(t, resp.Body); resp.StatusCode != 404 || code != codeUploadNotFound {
+				t.Errorf("status = %d, body: %s, want 404 %s", resp.StatusCode, resp.Body, codeUploadNotFound)
+			}
+			if len(pastBatch) > 0 {
+				t.Errorf("queried past a batch the tenant doesn't own: %v", pastBatch)
+			}
+
+			// The owner gets past the lookup.
+			resp, err = h.Handle(context.Background(), keyedEvent(r.method, r.resource, r.body, "tenant-a", r.pathParams))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if code, _ := parseError(t, resp.Body); code == codeUploadNotFound {
+				t.Errorf("owner got %d %s", resp.StatusCode, code)
+			}
+		})
+	}
+
+	// Bulk status reports another tenant's upload as not found.
+	resp, err := h.Handle(context.Background(), keyedEvent("POST", "/uploads/status",
+		fmt.Sprintf(`{"uploadIds":[%q]}`, batchID), "tenant-b", nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != 200 || strings.Contains(resp.Body, `"processing"`) {
+		t.Errorf("bulk status leaked another tenant's upload: %d %s", resp.StatusCode, resp.Body)
+	}
+}
+
+func TestCallerTenant(t *testing.T) {
+	event := events.APIGatewayProxyRequest{
+		RequestContext: events.APIGatewayProxyRequestContext{
+			Identity: events.APIGatewayRequestIdentity{APIKeyID: "key-1"},
+		},
+	}
+	if got := callerTenant(event); got != "key-1" {
+		t.Errorf("callerTenant = %q, want the API key ID", got)
+	}
+	event.RequestContext.Authorizer = map[string]any{"tenantId": "tenant-a"}
+	if got := callerTenant(event); got != "tenant-a" {
+		t.Errorf("callerTenant = %q, want the authorizer's tenantId", got)
+	}
+}
+
+func TestHandleReport(t *testing.T) {
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			switch {
+			case strings.Contains(sql, "FROM aircraft"):
+				if args[0] != "N123" {
+					return nil, nil
+				}
+				return []map[string]any{{"id": "aid-1", "registration": "N123", "make": "Cessna", "model": "172S"}}, nil
+			case strings.Contains(sql, "FROM ad_compliance"):
+				return []map[string]any{{
+					"ad_number": "2011-10-09", "compliance_date": "2024-03-01",
+					"next_due_date": "2020-03-01", "compliance_count": int64(2),
+				}}, nil
+			case strings.Contains(sql, "AS inspection_types"):
+				return []map[string]any{
+					{"entry_date": time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC), "hours": 2345.6, "entry_type": "maintenance", "maintenance_narrative": "Changed oil and filter"},
+					{"entry_date": time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), "hours": 2350.1, "entry_type": "inspection", "maintenance_narrative": "Annual inspection, airworthy", "inspection_types": "annual"},
+				}, nil
+			case strings.Contains(sql, "FROM maintenance_entries"):
+				return []map[string]any{{"hours": 2350.1}}, nil
+			}
+			return nil, nil
+		},
+	}
+	h := newTestHandler(db)
+
+	resp, err := h.Handle(context.Background(), makeEvent("GET", "/aircraft/{tailNumber}/report.pdf", "",
+		map[string]string{"tailNumber": "n123"}, nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("status = %d, body: %s", resp.StatusCode, resp.Body)
+	}
+	if resp.Headers["Content-Type"] != "application/pdf" {
+		t.Errorf("Content-Type = %q", resp.Headers["Content-Type"])
+	}
+	if got := resp.Headers["Content-Disposition"]; got != "attachment; filename=N123-maintenance-report.pdf" {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+	if !resp.IsBase64Encoded {
+		t.Fatal("PDF body should be base64-encoded")
+	}
+	pdf, err := base64.StdEncoding.DecodeString(resp.Body)
+	if err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if !bytes.HasPrefix(pdf, []byte("%PDF")) {
+		t.Fatalf("body starts %q, want a PDF", pdf[:min(len(pdf), 8)])
+	}
+
+	// Text is drawn inside compressed content streams.
+	var text strings.Builder
+	for rest := pdf; ; {
+		i := bytes.Index(rest, []byte("stream\n"))
+		if i < 0 {
+			break
+		}
+		rest = rest[i+len("stream\n"):]
+		end := bytes.Index(rest, []byte("endstream"))
+		if r, err := zlib.NewReader(bytes.NewReader(rest[:end])); err == nil {
+			b, _ := io.ReadAll(r)
+			text.Write(b)
+		}
+		rest = rest[end+len("endstream"):]
+	}
+	for _, want := range []string{"N123", "Cessna 172S", "2,350.1 hrs", "2011-10-09", "overdue", "Changed oil and filter", "Inspection: annual"} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("report is missing %q", want)
+		}
+	}
+
+	resp, err = h.Handle(context.Background(), makeEvent("GET", "/aircraft/{tailNumber}/report.pdf", "",
+		map[string]string{"tailNumber": "N999"}, nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != 404 {
+		t.Errorf("unknown aircraft status = %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestVectorSearch_Unavailable(t *testing.T) {
+	missingType := fmt.Errorf("query: %w", &pgconn.PgError{Code: "42704", Message: `type "halfvec" does not exist`})
+
+	tests := []struct {
+		name  string
+		event json.RawMessage
+	}{
+		{"query", makeEvent("POST", "/aircraft/{tailNumber}/query", `{"question":"When was the last oil change?"}`,
+			map[string]string{"tailNumber": "N123"}, nil)},
+		{"similar entries", makeEvent("GET", "/aircraft/{tailNumber}/entries/{entryId}/similar", "",
+			map[string]string{"tailNumber": "N123", "entryId": "entry-1"}, nil)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &mockDB{
+				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+					if strings.Contains(sql, "FROM aircraft") {
+						return []map[string]any{{"id": "aid-1"}}, nil
+					}
+					return nil, missingType
+				},
+			}
+			h := newTestHandler(db)
+			h.gemini = &gemini.MockClient{
+				EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
+					return make([]float32, gemini.DefaultEmbeddingDimensions), nil
+				},
+			}
+
+			resp, err := h.Handle(context.Background(), tt.event)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.StatusCode != 503 {
+				t.Fatalf("status = %d, want 503, body: %s", resp.StatusCode, resp.Body)
+			}
+			code, msg := parseError(t, resp.Body)
+			if code != codeSearchUnavailable {
+				t.Errorf("code = %q, want %q", code, codeSearchUnavailable)
+			}
+			if !strings.Contains(msg, "CREATE EXTENSION vector") || strings.Contains(msg, "does not exist") {
+				t.Errorf("message = %q, want the fix and no raw pg error", msg)
+			}
+		})
+	}
+}
+
+// keysetEntries is an entry table that answers cursor-paginated list queries
+// in -date order the way Postgres would.
+type keysetEntries struct {
+	rows []map[string]any
+}
+
+func (k *keysetEntries) insert(id, date string) {
+	d, _ := time.Parse("2006-01-02", date)
+	k.rows = append(k.rows, map[string]any{"id": id, "entry_date": d})
+	slices.SortFunc(k.rows, func(a, b map[string]any) int {
+		if c := b["entry_date"].(time.Time).Compare(a["entry_date"].(time.Time)); c != 0 {
+			return c
+		}
+		return strings.Compare(a["id"].(string), b["id"].(string))
+	})
+}
+
+// query takes the list query's args after the aircraft id: the cursor date
+// and id, if any, then the limit.
+func (k *keysetEntries) query(args []any) []map[string]any {
+	limit := args[len(args)-1].(int)
+	var out []map[string]any
+	for _, r := range k.rows {
+		if len(args) == 3 {
+			after, _ := time.Parse("2006-01-02", args[0].(string))
+			d := r["entry_date"].(time.Time)
+			if d.After(after) || d.Equal(after) && r["id"].(string) <= args[1].(string) {
+				continue
+			}
+		}
+		if len(out) == limit {
+			break
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+func TestHandleEntries_CursorPagination(t *testing.T) {
+	id := func(n int) string { return fmt.Sprintf("00000000-0000-4000-8000-%012d", n) }
+	table := &keysetEntries{}
+	// Two entries share a date so a page boundary falls between them.
+	for i, date := range []string{"2024-05-01", "2024-04-01", "2024-04-01", "2024-03-01", "2024-02-01"} {
+		table.insert(id(i+1), date)
+	}
+
+	var listSQL string
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			if strings.Contains(sql, "FROM aircraft") {
+				return []map[string]any{{"id": "aid-1"}}, nil
+			}
+			if strings.Contains(sql, "COUNT") {
+				t.Error("cursor pagination should not count entries")
+			}
+			listSQL = sql
+			return table.query(args[1:]), nil
+		},
+	}
+	h := newTestHandler(db)
+
+	var seen []string
+	cursor := ""
+	for page := 1; ; page++ {
+		if page > 5 {
+			t.Fatal("pagination did not terminate")
+		}
+		event := makeEvent("GET", "/aircraft/{tailNumber}/entries", "",
+			map[string]string{"tailNumber": "N123"}, map[string]string{"cursor": cursor, "limit": "2"})
+		resp, err := h.Handle(context.Background(), event)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if resp.StatusCode != 200 {
+			t.Fatalf("status = %d, body: %s", resp.StatusCode, resp.Body)
+		}
+		if strings.Contains(listSQL, "OFFSET") {
+			t.Errorf("cursor query uses OFFSET: %s", listSQL)
+		}
+		body := parseBody(t, resp.Body)
+		for _, e := range body["entries"].([]any) {
+			seen = append(seen, e.(map[string]any)["id"].(string))
+		}
+
+		// A newer entry arriving mid-traversal would shift an offset page.
+		if page == 1 {
+			table.insert(id(9), "2024-06-01")
+		}
+
+		next := body["pagination"].(map[string]any)["nextCursor"]
+		if next == nil {
+			break
+		}
+		cursor = next.(string)
+	}
+
+	want := []string{id(1), id(2), id(3), id(4), id(5)}
+	if !slices.Equal(seen, want) {
+		t.Errorf("entries = %v, want %v", seen, want)
+	}
+}
+
+func TestHandleEntries_CursorErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		query map[string]string
+	}{
+		{"malformed cursor", map[string]string{"cursor": "not a cursor"}},
+		{"cursor without date", map[string]string{"cursor": base64.RawURLEncoding.EncodeToString([]byte(`{"id":"00000000-0000-4000-8000-000000000001"}`))}},
+		{"unsupported sort", map[string]string{"cursor": "", "sort": "confidence"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &mockDB{
+				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+					if strings.Contains(sql, "FROM aircraft") {
+						return []map[string]any{{"id": "aid-1"}}, nil
+					}
+					t.Errorf("unexpected query: %s", sql)
+					return nil, nil
+				},
+			}
+			h := newTestHandler(db)
+
+			event := makeEvent("GET", "/aircraft/{tailNumber}/entries", "",
+				map[string]string{"tailNumber": "N123"}, tt.query)
+			resp, err := h.Handle(context.Background(), event)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.StatusCode != 400 {
+				t.Fatalf("status = %d, want 400, body: %s", resp.StatusCode, resp.Body)
+			}
+			if code, _ := parseError(t, resp.Body); code != codeValidation {
+				t.Errorf("code = %q, want %q", code, codeValidation)
+			}
+		})
+	}
+}
+
+func TestHandleSummary_CreateOnRead(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      map[string]string
+		wantStatus int
+		wantInsert bool
+	}{
+		{"disabled by default", nil, 404, false},
+		{"create=false", map[string]string{"create": "false"}, 404, false},
+		{"create=true", map[string]string{"create": "true"}, 200, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			created := false
+			var insertArgs []any
+			db := &mockDB{
+				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+					if strings.Contains(sql, "FROM aircraft") {
+						if !created {
+							return nil, nil
+						}
+						return []map[string]any{{"id": "aircraft-new", "registration": "N55XY"}}, nil
+					}
+					return nil, nil
+				},
+				insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+					if !strings.Contains(sql, "INSERT INTO aircraft") {
+						t.Errorf("unexpected insert: %s", sql)
+					}
+					created = true
+					insertArgs = args
+					return "aircraft-new", nil
+				},
+			}
+			h := newTestHandler(db)
+
+			event := makeEvent("GET", "/aircraft/{tailNumber}/summary", "",
+				map[string]string{"tailNumber": "n55xy"}, tt.query)
+			resp, err := h.Handle(context.Background(), event)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body: %s", resp.StatusCode, tt.wantStatus, resp.Body)
+			}
+			if created != tt.wantInsert {
+				t.Errorf("aircraft created = %v, want %v", created, tt.wantInsert)
+			}
+			if !tt.wantInsert {
+				return
+			}
+			if insertArgs[0] != "N55XY" {
+				t.Errorf("registration = %v, want N55XY", insertArgs[0])
+			}
+			body := parseBody(t, resp.Body)
+			if body["aircraft"].(map[string]any)["id"] != "aircraft-new" {
+				t.Errorf("aircraft = %v, want the created aircraft", body["aircraft"])
+			}
+			for _, key := range []string{"lastAnnual", "last100hr", "lastOilChange", "totalTime", "lastElt"} {
+				if body[key] != nil {
+					t.Errorf("%s = %v, want null for a new aircraft", key, body[key])
+				}
+			}
+		})
+	}
+}
+
+func TestHandleSummary_CreateOnReadOtherTenant(t *testing.T) {
+	// tenant-a holds N55XY; tenant-b creating it gets an aircraft of its own.
+	type key struct{ tenant, tail string }
+	aircraft := map[key]string{{"tenant-a", "N55XY"}: "aircraft-a"}
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			if strings.Contains(sql, "FROM aircraft WHERE registration = $1 AND tenant_id = $2") {
+				if id, ok := aircraft[key{args[1].(string), args[0].(string)}]; ok {
+					return []map[string]any{{"id": id, "registration": args[0]}}, nil
+				}
+			}
+			return nil, nil
+		},
+		insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+			if !strings.Contains(sql, "ON CONFLICT (tenant_id, registration)") || strings.Contains(sql, "WHERE") {
+				t.Errorf("upsert should only conflict with the tenant's own aircraft: %s", sql)
+			}
+			k := key{args[1].(string), args[0].(string)}
+			if _, ok := aircraft[k]; !ok {
+				aircraft[k] = "aircraft-" + strings.TrimPrefix(k.tenant, "tenant-")
+			}
+			return aircraft[k], nil
+		},
+	}
+	h := newTestHandler(db)
+
+	for _, tt := range []struct{ apiKeyID, wantID string }{
+		{"tenant-b", "aircraft-b"},
+		{"tenant-a", "aircraft-a"},
+	} {
+		b, _ := json.Marshal(events.APIGatewayProxyRequest{
+			HTTPMethod:            "GET",
+			Resource:              "/aircraft/{tailNumber}/summary",
+			PathParameters:        map[string]string{"tailNumber": "N55XY"},
+			QueryStringParameters: map[string]string{"create": "true"},
+			RequestContext: events.APIGatewayProxyRequestContext{
+				Identity: events.APIGatewayRequestIdentity{APIKeyID: tt.apiKeyID},
+			},
+		})
+		resp, err := h.Handle(context.Background(), b)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if resp.StatusCode != 200 {
+			t.Fatalf("%s: status = %d, want 200, body: %s", tt.apiKeyID, resp.StatusCode, resp.Body)
+		}
+		body := parseBody(t, resp.Body)
+		if id := body["aircraft"].(map[string]any)["id"]; id != tt.wantID {
+			t.Errorf("%s: aircraft = %v, want %s", tt.apiKeyID, id, tt.wantID)
+		}
+	}
+}
+
+// keyedEvent is makeEvent for a request authenticated with apiKeyID.
+func keyedEvent(method, resource, body, apiKeyID string, pathParams map[string]string) json.RawMessage {
+	b, _ := json.Marshal(events.APIGatewayProxyRequest{
+		HTTPMethod:     method,
+		Resource:       resource,
+		Body:           body,
+		PathParameters: pathParams,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			Identity: events.APIGatewayRequestIdentity{APIKeyID: apiKeyID},
+		},
+	})
+	return b
+}
+
+func TestCandidateEndpoints_AdminOnly(t *testing.T) {
+	requests := []struct {
+		method, resource, body string
+		pathParams             map[string]string
+	}{
+		{"POST", "/uploads/{id}/candidates", `{"promptVersion":"v2"}`, map[string]string{"id": "batch-1"}},
+		{"GET", "/uploads/{id}/pages/{pageNumber}/extraction/candidates/{promptVersion}", "",
+			map[string]string{"id": "batch-1", "pageNumber": "1", "promptVersion": "v2"}},
+	}
+	for _, r := range requests {
+		t.Run(r.method+" "+r.resource, func(t *testing.T) {
+			db := &mockDB{
+				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+					t.Errorf("non-admin request reached the database: %s", sql)
+					return nil, nil
+				},
+			}
+			sqs := &mockSQS{}
+			h := newTestHandler(db)
+			h.sqs = sqs
+			h.adminKeys = map[string]bool{"admin-key": true}
+
+			resp, err := h.Handle(context.Background(), keyedEvent(r.method, r.resource, r.body, "tenant-key", r.pathParams))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.StatusCode != 403 {
+				t.Fatalf("status = %d, want 403, body: %s", resp.StatusCode, resp.Body)
+			}
+			if code, _ := parseError(t, resp.Body); code != codeForbidden {
+				t.Errorf("code = %s, want %s", code, codeForbidden)
+			}
+			if len(sqs.messages) != 0 {
+				t.Errorf("queued %d messages for a non-admin", len(sqs.messages))
+			}
+		})
+	}
+}
+
+func TestHandleQueueCandidates(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		pages      []map[string]any
+		wantStatus int
+	}{
+		{
+			name: "queues every page",
+			body: `{"promptVersion":"2026-10-a"}`,
+			pages: []map[string]any{
+				{"id": "page-1", "page_number": int32(1), "image_path": "pages/batch-1/page_0001.jpg"},
+				{"id": "page-2", "page_number": int32(2), "image_path": "pages/batch-1/page_0002.jpg"},
+			},
+			wantStatus: 202,
+		},
+		{name: "missing version", body: `{}`, wantStatus: 400},
+		{name: "unsafe version", body: `{"promptVersion":"../v2"}`, wantStatus: 400},
+		{name: "no pages", body: `{"promptVersion":"v2"}`, wantStatus: 404},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var execs []string
+			db := &mockDB{
+				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+					return tt.pages, nil
+				},
+				execFn: func(ctx context.Context, sql string, args ...any) error {
+					execs = append(execs, sql)
+					return nil
+				},
+			}
+			sqs := &mockSQS{}
+			h := newTestHandler(db)
+			h.sqs = sqs
+			h.analyzeQueueURL = "analyze-queue"
+			h.adminKeys = map[string]bool{"admin-key": true}
+
+			resp, err := h.Handle(context.Background(), keyedEvent("POST", "/uploads/{id}/candidates", tt.body, "admin-key",
+				map[string]string{"id": "batch-1"}))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body: %s", resp.StatusCode, tt.wantStatus, resp.Body)
+			}
+			if len(execs) != 0 {
+				t.Errorf("queueing candidates wrote to the database: %v", execs)
+			}
+			if tt.wantStatus != 202 {
+				return
+			}
+
+			if len(sqs.messages) != len(tt.pages) {
+				t.Fatalf("queued %d messages, want %d", len(sqs.messages), len(tt.pages))
+			}
+			for i, raw := range sqs.messages {
+				if sqs.queueURLs[i] != "analyze-queue" {
+					t.Errorf("queue = %s, want analyze-queue", sqs.queueURLs[i])
+				}
+				var msg map[string]any
+				if err := json.Unmarshal([]byte(raw), &msg); err != nil {
+					t.Fatalf("bad message %s: %v", raw, err)
+				}
+				if msg["pageId"] != tt.pages[i]["id"] || msg["s3Key"] != tt.pages[i]["image_path"] ||
+					msg["pageNumber"] != float64(i+1) || msg["promptVersion"] != "2026-10-a" || msg["uploadId"] != "batch-1" {
+					t.Errorf("message %d = %s", i, raw)
+				}
+			}
+			if body := parseBody(t, resp.Body); body["pagesQueued"] != float64(2) {
+				t.Errorf("pagesQueued = %v, want 2", body["pagesQueued"])
+			}
+		})
+	}
+}
+
+func TestHandleCandidateDiff(t *testing.T) {
+	live := `{"pageType":"maintenance_entry","entries":[` +
+		`{"date":"2024-01-15","maintenanceNarrative":"Changed oil","shopName":"Acme"},` +
+		`{"date":"2024-02-01","maintenanceNarrative":"Replaced tire"}]}`
+	candidate := `{"pageType":"maintenance_entry","entries":[` +
+		`{"date":"2024-01-18","maintenanceNarrative":"Changed oil","shopName":"Acme","tachTime":1234.5},` +
+		`{"date":"2024-02-01","maintenanceNarrative":"Replaced tire"},` +
+		`{"date":"2024-03-05","maintenanceNarrative":"Annual inspection"}]}`
+	compressed, err := rawextraction.Encode([]byte(candidate), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		row        map[string]any
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "diff", row: map[string]any{"live": live, "candidate": string(compressed)}, wantStatus: 200},
+		{name: "no candidate", row: map[string]any{"live": live, "candidate": nil}, wantStatus: 404, wantCode: codeCandidateNotFound},
+		{name: "not extracted", row: map[string]any{"live": nil, "candidate": candidate}, wantStatus: 404, wantCode: codePageNotExtracted},
+		{name: "no page", wantStatus: 404, wantCode: codePageNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotArgs []any
+			db := &mockDB{
+				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+					if strings.Contains(sql, "FROM upload_batches") {
+						return []map[string]any{{"id": "batch-1"}}, nil
+					}
+					gotArgs = args
+					if tt.row == nil {
+						return nil, nil
+					}
+					return []map[string]any{tt.row}, nil
+				},
+			}
+			h := newTestHandler(db)
+			h.adminKeys = map[string]bool{"admin-key": true}
+
+			resp, err := h.Handle(context.Background(), keyedEvent("GET",
+				"/uploads/{id}/pages/{pageNumber}/extraction/candidates/{promptVersion}", "", "admin-key",
+				map[string]string{"id": "batch-1", "pageNumber": "3", "promptVersion": "v2"}))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body: %s", resp.StatusCode, tt.wantStatus, resp.Body)
+			}
+			if tt.wantCode != "" {
+				if code, _ := parseError(t, resp.Body); code != tt.wantCode {
+					t.Errorf("code = %s, want %s", code, tt.wantCode)
+				}
+				return
+			}
+			if gotArgs[0] != "batch-1" || gotArgs[1] != "3" || gotArgs[2] != "v2" {
+				t.Errorf("query args = %v", gotArgs)
+			}
+
+			var body struct {
+				Candidate struct {
+					Entries []any `json:"entries"`
+				} `json:"candidate"`
+				Diff struct {
+					Identical        bool              `json:"identical"`
+					LiveEntries      int               `json:"liveEntries"`
+					CandidateEntries int               `json:"candidateEntries"`
+					Changes          []candidateChange `json:"changes"`
+				} `json:"diff"`
+			}
+			if err := json.Unmarshal([]byte(resp.Body), &body); err != nil {
+				t.Fatal(err)
+			}
+			if len(body.Candidate.Entries) != 3 {
+				t.Errorf("candidate has %d entries, want the decompressed 3", len(body.Candidate.Entries))
+			}
+			if body.Diff.Identical || body.Diff.LiveEntries != 2 || body.Diff.CandidateEntries != 3 {
+				t.Errorf("diff = %+v", body.Diff)
+			}
+			changes := body.Diff.Changes
+			if len(changes) != 3 {
+				t.Fatalf("changes = %+v, want 3", changes)
+			}
+			if c := changes[0]; c.Entry != 0 || c.Field != "date" || c.Live != "2024-01-15" || c.Candidate != "2024-01-18" {
+				t.Errorf("changes[0] = %+v, want the corrected date", c)
+			}
+			if c := changes[1]; c.Entry != 0 || c.Field != "tachTime" || c.Live != nil || c.Candidate != 1234.5 {
+				t.Errorf("changes[1] = %+v, want the added tach time", c)
+			}
+			if c := changes[2]; c.Entry != 2 || c.Field != "" || c.Live != nil || c.Candidate == nil {
+				t.Errorf("changes[2] = %+v, want the added entry", c)
+			}
+		})
+	}
+}
+
+func TestDiffExtractions_Identical(t *testing.T) {
+	e := pageExtraction{PageType: "maintenance_entry", Entries: []map[string]any{{"date": "2024-01-15"}}}
+	if changes := diffExtractions(e, e); len(changes) != 0 {
+		t.Errorf("changes = %v, want none", changes)
+	}
+}
+
+func deleteAircraftEvent(apiKeyID string, query map[string]string) json.RawMessage {
+	b, _ := json.Marshal(events.APIGatewayProxyRequest{
+		HTTPMethod:            "DELETE",
+		Resource:              "/aircraft/{tailNumber}",
+		PathParameters:        map[string]string{"tailNumber": "n12345"},
+		QueryStringParameters: query,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			Identity: events.APIGatewayRequestIdentity{APIKeyID: apiKeyID},
+		},
+	})
+	return b
+}
+
+func TestHandleDeleteAircraft(t *testing.T) {
+	counts := map[string]any{
+		"embeddings": int64(4), "partsActions": int64(3), "adCompliance": int64(1),
+		"inspections": int64(1), "weightBalanceRevisions": int64(0), "entryRevisions": int64(2),
+		"entries": int64(4), "pages": int64(2), "uploads": int64(1),
+		"lifeLimitedParts": int64(1), "aircraft": int64(1),
+	}
+	var deleteSQL string
+	var deletedKeys []string
+	mock := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			if strings.Contains(sql, "SELECT id FROM aircraft") {
+				return []map[string]any{{"id": "aircraft-1"}}, nil
+			}
+			if !db.IsPrimary(ctx) {
+				t.Errorf("query not sent to the primary: %s", sql)
+			}
+			if strings.HasPrefix(sql, "SELECT id, s3_key FROM upload_batches") {
+				return []map[string]any{
+					{"id": "batch-1", "s3_key": "uploads/batch-1/logbook.pdf"},
+					{"id": "batch-2", "s3_key": "uploads/legacy/batch-2/logbook.pdf"},
+				}, nil
+			}
+			deleteSQL = sql
+			if len(deletedKeys) == 0 {
+				t.Error("rows deleted before the S3 objects")
+			}
+			if args[0] != "aircraft-1" {
+				t.Errorf("deleted aircraft %v, want aircraft-1", args[0])
+			}
+			return []map[string]any{counts}, nil
+		},
+	}
+	h := newTestHandler(mock)
+	h.adminKeys = map[string]bool{"admin-key": true}
+	objects := map[string][]string{
+		"uploads/batch-1/":    {"uploads/batch-1/logbook.pdf"},
+		"pages/batch-1/":      {"pages/batch-1/page_0001.jpg", "pages/batch-1/page_0002.jpg"},
+		"slices/batch-1/":     {"slices/batch-1/page_0001/slice_000.jpg"},
+		"thumbnails/batch-1/": {"thumbnails/batch-1/page_0001.jpg"},
+		"pages/batch-2/":      {"pages/batch-2/page_0001.jpg"},
+	}
+	h.s3 = &mockS3{
+		listFn: func(ctx context.Context, bucket, prefix string) ([]string, error) {
+			return objects[prefix], nil
+		},
+		deleteFn: func(ctx context.Context, bucket, key string) error {
+			deletedKeys = append(deletedKeys, key)
+			return nil
+		},
+	}
 
-	// Send a body with unknown fields (no patchable fields and no reviewStatus)
-	event := makeEvent("PATCH", "/aircraft/{tailNumber}/entries/{entryId}",
-		`{"unknownField":"value"}`,
-		map[string]string{"tailNumber": "N123", "entryId": "entry-1"}, nil)
-	resp, err := h.Handle(context.Background(), event)
+	resp, err := h.Handle(context.Background(), deleteAircraftEvent("admin-key", map[string]string{"confirm": "true"}))
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if resp.StatusCode != 400 {
-		t.Errorf("status = %d, want 400", resp.StatusCode)
+	if resp.StatusCode != 200 {
+		t.Fatalf("status = %d, want 200, body: %s", resp.StatusCode, resp.Body)
+	}
+
+	// Dependents must be deleted before the rows they reference.
+	order := []string{
+		"maintenance_embeddings", "parts_actions", "ad_compliance", "inspection_records",
+		"weight_balance_revisions", "entry_revisions", "maintenance_entries",
+		"upload_pages", "upload_batches", "life_limited_parts", "aircraft",
+	}
+	last := -1
+	for _, table := range order {
+		i := strings.Index(deleteSQL, "DELETE FROM "+table+" ")
+		if i < 0 {
+			i = strings.Index(deleteSQL, "DELETE FROM "+table+"\n")
+		}
+		if i < 0 {
+			t.Errorf("no DELETE FROM %s in:\n%s", table, deleteSQL)
+			continue
+		}
+		if i < last {
+			t.Errorf("%s is deleted out of order", table)
+		}
+		last = i
+	}
+	if got := strings.Count(deleteSQL, "DELETE FROM"); got != len(order) {
+		t.Errorf("%d DELETEs, want %d", got, len(order))
+	}
+
+	wantKeys := []string{
+		"uploads/batch-1/logbook.pdf", "pages/batch-1/page_0001.jpg", "pages/batch-1/page_0002.jpg",
+		"slices/batch-1/page_0001/slice_000.jpg", "thumbnails/batch-1/page_0001.jpg",
+		"pages/batch-2/page_0001.jpg", "uploads/legacy/batch-2/logbook.pdf",
+	}
+	if !slices.Equal(deletedKeys, wantKeys) {
+		t.Errorf("deleted objects = %v, want %v", deletedKeys, wantKeys)
 	}
+
 	body := parseBody(t, resp.Body)
-	if !strings.Contains(body["error"].(string), "No fields") {
-		t.Errorf("error = %v, want 'No fields to update'", body["error"])
+	if body["tailNumber"] != "N12345" {
+		t.Errorf("tailNumber = %v, want N12345", body["tailNumber"])
+	}
+	deleted, _ := body["deleted"].(map[string]any)
+	for k, v := range counts {
+		if deleted[k] != float64(v.(int64)) {
+			t.Errorf("deleted[%s] = %v, want %v", k, deleted[k], v)
+		}
 	}
 }
 
-func TestHandleUpdateEntry_NotFound(t *testing.T) {
-	callCount := 0
-	db := &mockDB{
+func TestHandleDeleteAircraft_S3FailureKeepsRows(t *testing.T) {
+	mock := &mockDB{
 		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
-			callCount++
-			if callCount == 1 {
-				return []map[string]any{{"id": "aid-1"}}, nil
+			if strings.Contains(sql, "DELETE") {
+				t.Errorf("rows deleted after the S3 cleanup failed: %s", sql)
 			}
-			// UPDATE RETURNING returns empty — not found
-			return nil, nil
+			if strings.Contains(sql, "FROM upload_batches") {
+				return []map[string]any{{"id": "batch-1", "s3_key": "uploads/batch-1/logbook.pdf"}}, nil
+			}
+			return []map[string]any{{"id": "aircraft-1"}}, nil
 		},
 	}
-	h := newTestHandler(db)
+	h := newTestHandler(mock)
+	h.adminKeys = map[string]bool{"admin-key": true}
+	h.s3 = &mockS3{deleteFn: func(ctx context.Context, bucket, key string) error {
+		return fmt.Errorf("access denied")
+	}}
 
-	event := makeEvent("PATCH", "/aircraft/{tailNumber}/entries/{entryId}",
-		`{"shopName":"Test Shop"}`,
-		map[string]string{"tailNumber": "N123", "entryId": "entry-999"}, nil)
-	resp, err := h.Handle(context.Background(), event)
+	resp, err := h.Handle(context.Background(), deleteAircraftEvent("admin-key", map[string]string{"confirm": "true"}))
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if resp.StatusCode != 404 {
-		t.Errorf("status = %d, want 404", resp.StatusCode)
+	if resp.StatusCode != 500 {
+		t.Errorf("status = %d, want 500, body: %s", resp.StatusCode, resp.Body)
 	}
 }
 
-func TestHandleInspections_WithTypeFilter(t *testing.T) {
-	callCount := 0
-	db := &mockDB{
-		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
-			callCount++
-			if callCount == 1 {
-				return []map[string]any{{"id": "aid-1"}}, nil
+func TestHandleDeleteAircraft_Rejected(t *testing.T) {
+	tests := []struct {
+		name       string
+		apiKeyID   string
+		query      map[string]string
+		found      bool
+		wantStatus int
+		wantCode   string
+	}{
+		{name: "not admin", apiKeyID: "tenant-key", query: map[string]string{"confirm": "true"}, found: true, wantStatus: 403, wantCode: codeForbidden},
+		{name: "no confirmation", apiKeyID: "admin-key", found: true, wantStatus: 400, wantCode: codeValidation},
+		{name: "confirm false", apiKeyID: "admin-key", query: map[string]string{"confirm": "false"}, found: true, wantStatus: 400, wantCode: codeValidation},
+		{name: "unknown aircraft", apiKeyID: "admin-key", query: map[string]string{"confirm": "true"}, wantStatus: 404, wantCode: codeAircraftNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &mockDB{
+				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+					if strings.Contains(sql, "DELETE") {
+						t.Errorf("rejected request deleted: %s", sql)
+					}
+					if tt.found {
+						return []map[string]any{{"id": "aircraft-1"}}, nil
+					}
+					return nil, nil
+				},
 			}
-			if strings.Contains(sql, "COUNT") {
-				return []map[string]any{{"total": int64(2)}}, nil
+			h := newTestHandler(db)
+			h.adminKeys = map[string]bool{"admin-key": true}
+
+			resp, err := h.Handle(context.Background(), deleteAircraftEvent(tt.apiKeyID, tt.query))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
 			}
-			return []map[string]any{
-				{"id": "insp-1", "inspection_type": "annual"},
-			}, nil
-		},
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body: %s", resp.StatusCode, tt.wantStatus, resp.Body)
+			}
+			if code, _ := parseError(t, resp.Body); code != tt.wantCode {
+				t.Errorf("code = %s, want %s", code, tt.wantCode)
+			}
+		})
 	}
-	h := newTestHandler(db)
+}
 
-	event := makeEvent("GET", "/aircraft/{tailNumber}/inspections", "",
-		map[string]string{"tailNumber": "N123"},
-		map[string]string{"type": "annual"})
-	resp, err := h.Handle(context.Background(), event)
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+// currentOnly drops the superseded rows unless sql includes them, as the
+// superseded_by filter would.
+func currentOnly(sql string, rows []map[string]any) []map[string]any {
+	if !strings.Contains(sql, "superseded_by IS NULL") {
+		return rows
 	}
-	if resp.StatusCode != 200 {
-		t.Errorf("status = %d, want 200", resp.StatusCode)
+	var kept []map[string]any
+	for _, r := range rows {
+		if r["superseded_by"] == nil {
+			kept = append(kept, r)
+		}
 	}
+	return kept
 }
 
-func TestToInt64(t *testing.T) {
+func TestHandleEntries_Superseded(t *testing.T) {
+	rows := []map[string]any{
+		{"id": "entry-new", "entry_date": "2024-01-15", "superseded_by": nil},
+		{"id": "entry-old", "entry_date": "2024-01-15", "superseded_by": "entry-new"},
+	}
 	tests := []struct {
-		input any
-		want  int64
-		ok    bool
+		name        string
+		queryParams map[string]string
+		want        []any
 	}{
-		{int64(42), 42, true},
-		{int32(42), 42, true},
-		{int(42), 42, true},
-		{float64(42.0), 42, true},
-		{"not a number", 0, false},
-		{nil, 0, false},
+		{name: "hidden by default", want: []any{"entry-new"}},
+		{name: "shown when requested", queryParams: map[string]string{"includeSuperseded": "true"}, want: []any{"entry-new", "entry-old"}},
 	}
+
 	for _, tt := range tests {
-		got, ok := toInt64(tt.input)
-		if got != tt.want || ok != tt.ok {
-			t.Errorf("toInt64(%v) = (%d, %v), want (%d, %v)", tt.input, got, ok, tt.want, tt.ok)
-		}
+		t.Run(tt.name, func(t *testing.T) {
+			db := &mockDB{
+				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+					switch {
+					case strings.Contains(sql, "FROM aircraft"):
+						return []map[string]any{{"id": "aid-1"}}, nil
+					case strings.Contains(sql, "COUNT"):
+						return []map[string]any{{"total": int64(len(currentOnly(sql, rows)))}}, nil
+					default:
+						return currentOnly(sql, rows), nil
+					}
+				},
+			}
+			h := newTestHandler(db)
+
+			resp, err := h.Handle(context.Background(), makeEvent("GET", "/aircraft/{tailNumber}/entries", "",
+				map[string]string{"tailNumber": "N123"}, tt.queryParams))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.StatusCode != 200 {
+				t.Fatalf("status = %d, body: %s", resp.StatusCode, resp.Body)
+			}
+			body := parseBody(t, resp.Body)
+			var ids []any
+			for _, e := range body["entries"].([]any) {
+				ids = append(ids, e.(map[string]any)["id"])
+			}
+			if !slices.Equal(ids, tt.want) {
+				t.Errorf("entries = %v, want %v", ids, tt.want)
+			}
+			if total := body["pagination"].(map[string]any)["total"]; total != float64(len(tt.want)) {
+				t.Errorf("total = %v, want %d", total, len(tt.want))
+			}
+		})
 	}
 }
 
-func TestFirstOrNil(t *testing.T) {
-	if firstOrNil(nil) != nil {
-		t.Error("expected nil for empty slice")
+func TestHandleSummary_Superseded(t *testing.T) {
+	// The superseded annual was misread with a later date; the re-upload
+	// corrected it.
+	annuals := []map[string]any{
+		{"entry_date": "2024-06-01", "superseded_by": "entry-new"},
+		{"entry_date": "2024-03-01", "superseded_by": nil},
 	}
-	if firstOrNil([]map[string]any{}) != nil {
-		t.Error("expected nil for empty slice")
+	tests := []struct {
+		name        string
+		queryParams map[string]string
+		want        string
+	}{
+		{name: "hidden by default", want: "2024-03-01"},
+		{name: "shown when requested", queryParams: map[string]string{"includeSuperseded": "true"}, want: "2024-06-01"},
 	}
-	rows := []map[string]any{{"key": "val"}}
-	result := firstOrNil(rows)
-	if result == nil {
-		t.Error("expected non-nil for non-empty slice")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &mockDB{
+				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+					switch {
+					case strings.Contains(sql, "FROM aircraft"):
+						return []map[string]any{{"id": "aid-1", "registration": "N123"}}, nil
+					case strings.Contains(sql, "inspection_type = 'annual'"):
+						return currentOnly(sql, annuals)[:1], nil
+					default:
+						return nil, nil
+					}
+				},
+			}
+			h := newTestHandler(db)
+
+			resp, err := h.Handle(context.Background(), makeEvent("GET", "/aircraft/{tailNumber}/summary", "",
+				map[string]string{"tailNumber": "N123"}, tt.queryParams))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.StatusCode != 200 {
+				t.Fatalf("status = %d, body: %s", resp.StatusCode, resp.Body)
+			}
+			annual, _ := parseBody(t, resp.Body)["lastAnnual"].(map[string]any)
+			if annual["entry_date"] != tt.want {
+				t.Errorf("lastAnnual = %v, want %s", annual, tt.want)
+			}
+		})
 	}
 }
 
-func TestGetGeminiClient_Cached(t *testing.T) {
-	h := newTestHandler(&mockDB{})
-	mock := &gemini.MockClient{}
-	h.gemini = mock
-
-	client, err := h.getGeminiClient(context.Background())
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+func TestAircraftReads_LeaveOutSuperseded(t *testing.T) {
+	routes := []struct {
+		resource    string
+		queryParams map[string]string
+	}{
+		{resource: "/aircraft/{tailNumber}/entries/search", queryParams: map[string]string{"q": "oil"}},
+		{resource: "/aircraft/{tailNumber}/inspections"},
+		{resource: "/aircraft/{tailNumber}/ads"},
+		{resource: "/aircraft/{tailNumber}/ads/status"},
+		{resource: "/aircraft/{tailNumber}/facets"},
+		{resource: "/aircraft/{tailNumber}/weight-balance"},
+		{resource: "/aircraft/{tailNumber}/gaps"},
+		{resource: "/aircraft/{tailNumber}/report.pdf"},
 	}
-	if client != mock {
-		t.Error("expected cached client to be returned")
+	// Every table read here holds entries or records taken from them.
+	entryTables := []string{"maintenance_entries", "inspection_records", "ad_compliance", "weight_balance_revisions"}
+
+	for _, rt := range routes {
+		t.Run(rt.resource, func(t *testing.T) {
+			var reads int
+			db := &mockDB{
+				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+					if strings.Contains(sql, "FROM aircraft") {
+						return []map[string]any{{"id": "aid-1", "registration": "N123"}}, nil
+					}
+					if slices.ContainsFunc(entryTables, func(table string) bool { return strings.Contains(sql, table) }) {
+						reads++
+						if !strings.Contains(sql, "superseded_by IS NULL") {
+							t.Errorf("superseded entries not left out:\n%s", sql)
+						}
+					}
+					if strings.Contains(sql, "COUNT(*) AS total") {
+						return []map[string]any{{"total": int64(0)}}, nil
+					}
+					return nil, nil
+				},
+			}
+			h := newTestHandler(db)
+
+			resp, err := h.Handle(context.Background(), makeEvent("GET", rt.resource, "",
+				map[string]string{"tailNumber": "N123"}, rt.queryParams))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.StatusCode != 200 {
+				t.Fatalf("status = %d, body: %s", resp.StatusCode, resp.Body)
+			}
+			if reads == 0 {
+				t.Error("no entry reads seen")
+			}
+		})
 	}
 }
 
-func TestHandleQuery_NoResults(t *testing.T) {
-	callCount := 0
+func TestHandleFindSimilar(t *testing.T) {
+	var searchSQL string
+	var searchArgs, partsArgs []any
 	db := &mockDB{
 		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
-			callCount++
-			if callCount == 1 {
+			switch {
+			case strings.Contains(sql, "FROM aircraft"):
 				return []map[string]any{{"id": "aid-1"}}, nil
+			case strings.Contains(sql, "FROM maintenance_embeddings"):
+				searchSQL, searchArgs = sql, args
+				return []map[string]any{
+					{"id": "entry-mag", "entry_date": "2023-05-02", "entry_type": "maintenance",
+						"maintenance_narrative": "Removed and replaced left magneto", "similarity": 0.93},
+					{"id": "entry-timing", "entry_date": "2021-08-10", "entry_type": "maintenance",
+						"maintenance_narrative": "Timed magnetos to 25 BTDC", "similarity": 0.81},
+				}, nil
+			case strings.Contains(sql, "FROM parts_actions"):
+				partsArgs = args
+				return []map[string]any{
+					{"entry_id": "entry-mag", "action_type": "removed", "part_name": "Magneto", "part_number": "4371", "quantity": int32(1)},
+					{"entry_id": "entry-mag", "action_type": "installed", "part_name": "Magneto", "part_number": "4371", "quantity": int32(1)},
+				}, nil
 			}
-			return []map[string]any{}, nil
+			t.Errorf("unexpected query: %s", sql)
+			return nil, nil
 		},
 	}
+	var embedded string
 	h := newTestHandler(db)
 	h.gemini = &gemini.MockClient{
 		EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
-			return make([]float32, 768), nil
+			embedded = text
+			return make([]float32, gemini.DefaultEmbeddingDimensions), nil
 		},
 	}
 
-	event := makeEvent("POST", "/aircraft/{tailNumber}/query",
-		`{"question":"test?"}`,
-		map[string]string{"tailNumber": "N123"}, nil)
-	resp, err := h.Handle(context.Background(), event)
+	resp, err := h.Handle(context.Background(), makeEvent("POST", "/aircraft/{tailNumber}/find-similar",
+		`{"text":"replace left magneto","limit":2}`, map[string]string{"tailNumber": "n123"}, nil))
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 	if resp.StatusCode != 200 {
-		t.Errorf("status = %d, want 200", resp.StatusCode)
+		t.Fatalf("status = %d, body: %s", resp.StatusCode, resp.Body)
+	}
+
+	if embedded != "replace left magneto" {
+		t.Errorf("embedded %q", embedded)
+	}
+	if searchArgs[1] != "aid-1" || searchArgs[3] != 2 {
+		t.Errorf("search args = %v", searchArgs)
+	}
+	if !strings.Contains(searchSQL, "superseded_by IS NULL") {
+		t.Errorf("search includes superseded entries: %s", searchSQL)
 	}
+	if ids, _ := partsArgs[0].([]string); !slices.Equal(ids, []string{"entry-mag", "entry-timing"}) {
+		t.Errorf("parts looked up for %v", partsArgs[0])
+	}
+
 	body := parseBody(t, resp.Body)
-	if body["answer"] != "No maintenance records found for this aircraft." {
-		t.Errorf("unexpected answer: %v", body["answer"])
+	if body["tailNumber"] != "N123" {
+		t.Errorf("tailNumber = %v", body["tailNumber"])
+	}
+	entries := body["entries"].([]any)
+	if len(entries) != 2 {
+		t.Fatalf("entries = %v, want 2", entries)
+	}
+	first, second := entries[0].(map[string]any), entries[1].(map[string]any)
+	if first["entryId"] != "entry-mag" || first["similarity"] != 0.93 || second["entryId"] != "entry-timing" {
+		t.Errorf("entries out of rank order: %v", entries)
+	}
+	parts := first["partsActions"].([]any)
+	if len(parts) != 2 || parts[0].(map[string]any)["action_type"] != "removed" || parts[1].(map[string]any)["action_type"] != "installed" {
+		t.Errorf("first entry parts = %v", parts)
+	}
+	if _, ok := parts[0].(map[string]any)["entry_id"]; ok {
+		t.Errorf("part repeats its entry_id: %v", parts[0])
+	}
+	if p := second["partsActions"].([]any); len(p) != 0 {
+		t.Errorf("second entry parts = %v, want none", p)
 	}
 }
 
-func TestFormatEmbedding(t *testing.T) {
-	result := formatEmbedding([]float32{0.1, 0.2, 0.3})
-	if result != "[0.1,0.2,0.3]" {
-		t.Errorf("got %q, want %q", result, "[0.1,0.2,0.3]")
+func TestHandleFindSimilar_Rejected(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		found      bool
+		wantStatus int
+	}{
+		{name: "invalid body", body: `not json`, found: true, wantStatus: 400},
+		{name: "missing text", body: `{"text":"  "}`, found: true, wantStatus: 400},
+		{name: "limit too large", body: `{"text":"magneto","limit":21}`, found: true, wantStatus: 400},
+		{name: "zero limit", body: `{"text":"magneto","limit":0}`, found: true, wantStatus: 400},
+		{name: "unknown aircraft", body: `{"text":"magneto"}`, wantStatus: 404},
 	}
-}
 
-func TestNewUUID(t *testing.T) {
-	id := newUUID()
-	if len(id) != 36 {
-		t.Errorf("UUID length = %d, want 36", len(id))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &mockDB{
+				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+					if tt.found {
+						return []map[string]any{{"id": "aid-1"}}, nil
+					}
+					return nil, nil
+				},
+			}
+			h := newTestHandler(db)
+			h.gemini = &gemini.MockClient{
+				EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
+					t.Error("rejected request was embedded")
+					return nil, nil
+				},
+			}
+
+			resp, err := h.Handle(context.Background(), makeEvent("POST", "/aircraft/{tailNumber}/find-similar",
+				tt.body, map[string]string{"tailNumber": "N123"}, nil))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d, body: %s", resp.StatusCode, tt.wantStatus, resp.Body)
+			}
+		})
 	}
-	// Check format: 8-4-4-4-12
-	parts := strings.Split(id, "-")
-	if len(parts) != 5 {
-		t.Errorf("UUID parts = %d, want 5", len(parts))
+}
+
+func TestHandleEntryDetail_ExtractionModel(t *testing.T) {
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			switch {
+			case strings.Contains(sql, "FROM aircraft"):
+				return []map[string]any{{"id": "aid-1"}}, nil
+			case strings.Contains(sql, "FROM maintenance_entries"):
+				return []map[string]any{{
+					"id": "entry-1", "entry_type": "maintenance",
+					"extraction_model": "gemini-2.5-flash", "prompt_version": "3f2a9c01b7de",
+				}}, nil
+			}
+			return nil, nil
+		},
 	}
+	h := newTestHandler(db)
 
-	// Ensure uniqueness
-	id2 := newUUID()
-	if id == id2 {
-		t.Error("UUIDs should be unique")
+	resp, err := h.Handle(context.Background(), makeEvent("GET", "/aircraft/{tailNumber}/entries/{entryId}", "",
+		map[string]string{"tailNumber": "N123", "entryId": "entry-1"}, nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("status = %d, body: %s", resp.StatusCode, resp.Body)
+	}
+	entry := parseBody(t, resp.Body)["entry"].(map[string]any)
+	if entry["extraction_model"] != "gemini-2.5-flash" || entry["prompt_version"] != "3f2a9c01b7de" {
+		t.Errorf("entry = %v, want its extraction model and prompt version", entry)
 	}
 }
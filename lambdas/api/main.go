@@ -6,14 +6,21 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-lambda-go/lambda"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
 
 	"github.com/projectcloudline/logbook-service/internal/awsutil"
 	"github.com/projectcloudline/logbook-service/internal/db"
+	"github.com/projectcloudline/logbook-service/internal/faa"
+	"github.com/projectcloudline/logbook-service/internal/gemini"
+	"github.com/projectcloudline/logbook-service/internal/sourceurl"
 )
 
 func main() {
@@ -28,7 +35,7 @@ func main() {
 
 	s3Client := awsutil.NewS3Client(s3.NewFromConfig(cfg))
 
-	database := db.New(func(ctx context.Context) (map[string]string, error) {
+	dbCreds := func(ctx context.Context) (map[string]string, error) {
 		if host := os.Getenv("DB_HOST"); host != "" {
 			return map[string]string{
 				"host":     host,
@@ -48,16 +55,127 @@ func main() {
 			return nil, fmt.Errorf("parse db secret: %w", err)
 		}
 		return creds, nil
-	})
+	}
+	// Reads go to DB_READ_HOST when set so they don't starve the write pool.
+	database := db.NewWithReplica(dbCreds, db.WithHost(dbCreds, os.Getenv("DB_READ_HOST")))
+	// Say at cold start whether the database can store and search embeddings.
+	db.LogVectorSupport(ctx, database)
 
 	h := &Handler{
 		db:      database,
 		s3:      s3Client,
 		secrets: secrets,
 		bucket:  os.Getenv("BUCKET_NAME"),
+
+		sqs:           awsutil.NewSQSClient(sqs.NewFromConfig(cfg)),
+		fetchQueueURL: os.Getenv("FETCH_QUEUE_URL"),
+		sourceHosts:   sourceurl.ParseAllowlist(os.Getenv("SOURCE_URL_ALLOWED_HOSTS")),
+
+		faa: &faa.Enricher{
+			DB:        database,
+			Secrets:   secrets,
+			BaseURL:   os.Getenv("FAA_REGISTRY_URL"),
+			SecretARN: os.Getenv("FAA_REGISTRY_SECRET_ARN"),
+			TTL:       faaEnrichmentTTL(),
+		},
+		enrichQueueURL: os.Getenv("ENRICH_QUEUE_URL"),
+		sampling:       generateSampling(),
+		llmCallTimeout: gemini.CallTimeoutFromEnv(),
+		embedding:      gemini.EmbeddingConfigFromEnv(),
+
+		queryStreaming:    os.Getenv("QUERY_STREAMING_ENABLED") == "true",
+		slicerDiagnostics: os.Getenv("SLICER_DIAGNOSTICS_ENABLED") == "true",
+		presignPutTTL:     presignDuration("PRESIGN_PUT_TTL"),
+		presignGetTTL:     presignDuration("PRESIGN_GET_TTL"),
+
+		analyzeQueueURL: os.Getenv("ANALYZE_QUEUE_URL"),
+		adminKeys:       adminKeys(),
+	}
+
+	lambda.Start(h.Invoke)
+}
+
+// adminKeys parses ADMIN_API_KEY_IDS, the comma-separated API Gateway key IDs
+// allowed to use admin endpoints.
+func adminKeys() map[string]bool {
+	keys := map[string]bool{}
+	for _, id := range strings.Split(os.Getenv("ADMIN_API_KEY_IDS"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			keys[id] = true
+		}
+	}
+	return keys
+}
+
+// faaEnrichmentTTL parses FAA_ENRICHMENT_TTL_HOURS, how long FAA registry
+// data is reused before an upload refreshes it. Unset or invalid values use
+// the default.
+func faaEnrichmentTTL() time.Duration {
+	raw := os.Getenv("FAA_ENRICHMENT_TTL_HOURS")
+	if raw == "" {
+		return 0
 	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v <= 0 {
+		log.Printf("WARNING: ignoring invalid FAA_ENRICHMENT_TTL_HOURS %q", raw)
+		return 0
+	}
+	return time.Duration(v) * time.Hour
+}
+
+// presignDuration parses the named env var as a Go duration ("15m", "6h"),
+// the lifetime of presigned URLs. Unset or invalid values use the default;
+// values past S3's 7 day maximum are clamped to it.
+func presignDuration(key string) time.Duration {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return 0
+	}
+	v, err := time.ParseDuration(raw)
+	if err != nil || v <= 0 {
+		log.Printf("WARNING: ignoring invalid %s %q", key, raw)
+		return 0
+	}
+	if v > maxPresignTTL {
+		log.Printf("WARNING: %s %q exceeds the S3 maximum, using %s", key, raw, maxPresignTTL)
+		return maxPresignTTL
+	}
+	return v
+}
 
-	lambda.Start(h.Handle)
+// generateSampling parses GENERATE_TEMPERATURE (0–2), GENERATE_TOP_P (0–1)
+// and GENERATE_TOP_K (a positive integer) for Gemini generation calls. Unset
+// or invalid values leave that setting at its default.
+func generateSampling() gemini.GenerateConfig {
+	var cfg gemini.GenerateConfig
+	if raw := os.Getenv("GENERATE_TEMPERATURE"); raw != "" {
+		v, err := strconv.ParseFloat(raw, 32)
+		if err != nil || v < 0 || v > 2 {
+			log.Printf("WARNING: ignoring invalid GENERATE_TEMPERATURE %q", raw)
+		} else {
+			temp := float32(v)
+			cfg.Temperature = &temp
+		}
+	}
+	if raw := os.Getenv("GENERATE_TOP_P"); raw != "" {
+		v, err := strconv.ParseFloat(raw, 32)
+		if err != nil || v <= 0 || v > 1 {
+			log.Printf("WARNING: ignoring invalid GENERATE_TOP_P %q", raw)
+		} else {
+			topP := float32(v)
+			cfg.TopP = &topP
+		}
+	}
+	if raw := os.Getenv("GENERATE_TOP_K"); raw != "" {
+		v, err := strconv.ParseInt(raw, 10, 32)
+		if err != nil || v <= 0 {
+			log.Printf("WARNING: ignoring invalid GENERATE_TOP_K %q", raw)
+		} else {
+			topK := int32(v)
+			cfg.TopK = &topK
+		}
+	}
+	return cfg
 }
 
 func envOrDefault(key, def string) string {
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/projectcloudline/logbook-service/internal/awsutil"
+	"github.com/projectcloudline/logbook-service/internal/db"
+)
+
+// Handler holds dependencies for the Cleanup Lambda.
+type Handler struct {
+	db     db.DB
+	s3     awsutil.S3Client
+	bucket string
+	// ttlHours is how long a batch may sit in 'pending' before it is expired.
+	ttlHours int
+	// deleteObjects removes any S3 objects that did arrive for expired batches.
+	deleteObjects bool
+	// stallHours is how long a batch may sit in 'processing' with no page
+	// changing status before it is marked stalled. Zero disables the check.
+	stallHours int
+	// requeueStalled sends a stalled batch's unfinished pages back to the
+	// analyze queue, once: the batch leaves 'processing', so it is never
+	// picked up again.
+	requeueStalled  bool
+	sqs             awsutil.SQSClient
+	analyzeQueueURL string
+}
+
+type expiredBatch struct {
+	id    string
+	s3Key string
+}
+
+// Handle expires abandoned upload batches and flags stalled ones. Triggered
+// on a schedule by EventBridge.
+func (h *Handler) Handle(ctx context.Context, event events.CloudWatchEvent) error {
+	batches, err := h.expireBatches(ctx)
+	if err != nil {
+		return err
+	}
+	log.Printf("Expired %d upload batches pending for more than %dh", len(batches), h.ttlHours)
+
+	if h.deleteObjects {
+		for _, b := range batches {
+			h.deleteBatchObjects(ctx, b)
+		}
+	}
+
+	if h.stallHours <= 0 {
+		return nil
+	}
+	stalled, err := h.markStalledBatches(ctx)
+	if err != nil {
+		return err
+	}
+	log.Printf("Marked %d upload batches stalled after %dh without progress", len(stalled), h.stallHours)
+
+	if !h.requeueStalled {
+		return nil
+	}
+	for _, id := range stalled {
+		h.requeuePages(ctx, id)
+	}
+	return nil
+}
+
+// expireBatches marks pending batches older than the TTL as expired and
+// returns them. Batches that have started processing are never touched.
+func (h *Handler) expireBatches(ctx context.Context) ([]expiredBatch, error) {
+	rows, err := h.db.Query(ctx,
+		`UPDATE upload_batches
+		 SET processing_status = 'expired', updated_at = NOW()
+		 WHERE processing_status = 'pending'
+		   AND created_at < NOW() - make_interval(hours => $1)
+		 RETURNING id, s3_key`, h.ttlHours)
+	if err != nil {
+		return nil, fmt.Errorf("expire batches: %w", err)
+	}
+
+	batches := make([]expiredBatch, 0, len(rows))
+	for _, r := range rows {
+		b := expiredBatch{id: fmt.Sprintf("%v", r["id"])}
+		if key, ok := r["s3_key"].(string); ok {
+			b.s3Key = key
+		}
+		batches = append(batches, b)
+	}
+	return batches, nil
+}
+
+// markStalledBatches marks processing batches as stalled when neither the
+// batch nor any of its pages has changed within the stall window, and returns
+// their IDs. That happens when an analyze Lambda dies or a queue message is
+// lost, leaving a page that will never finish. A stalled batch still
+// completes if its pages do.
+func (h *Handler) markStalledBatches(ctx context.Context) ([]string, error) {
+	rows, err := h.db.Query(ctx,
+		`UPDATE upload_batches ub
+		 SET processing_status = 'stalled', updated_at = NOW()
+		 WHERE ub.processing_status = 'processing'
+		   AND ub.updated_at < NOW() - make_interval(hours => $1)
+		   AND NOT EXISTS (
+		       SELECT 1 FROM upload_pages up
+		       WHERE up.document_id = ub.id
+		         AND up.updated_at >= NOW() - make_interval(hours => $1))
+		 RETURNING ub.id`, h.stallHours)
+	if err != nil {
+		return nil, fmt.Errorf("mark stalled batches: %w", err)
+	}
+
+	ids := make([]string, 0, len(rows))
+	for _, r := range rows {
+		ids = append(ids, fmt.Sprintf("%v", r["id"]))
+	}
+	return ids, nil
+}
+
+// requeuePages sends a stalled batch's pages that have sat in processing for
+// the whole stall window back to the analyze queue. Pending pages may still
+// have a message in flight, so they are left alone. Failures are logged, not
+// fatal — the batch is already marked stalled for an operator to look at.
+func (h *Handler) requeuePages(ctx context.Context, batchID string) {
+	pages, err := h.db.Query(ctx,
+		`SELECT id, page_number, image_path FROM upload_pages
+		 WHERE document_id = $1 AND extraction_status = 'processing'
+		   AND updated_at < NOW() - make_interval(hours => $2)
+		   AND NOT file_missing
+		 ORDER BY page_number`, batchID, h.stallHours)
+	if err != nil {
+		log.Printf("WARNING: list pages for stalled batch %s: %v", batchID, err)
+		return
+	}
+
+	queued := 0
+	for _, p := range pages {
+		msg, _ := json.Marshal(map[string]any{
+			"uploadId":   batchID,
+			"pageId":     fmt.Sprintf("%v", p["id"]),
+			"pageNumber": p["page_number"],
+			"s3Key":      p["image_path"],
+		})
+		if err := h.sqs.SendMessage(ctx, h.analyzeQueueURL, string(msg)); err != nil {
+			log.Printf("WARNING: requeue page %v of stalled batch %s: %v", p["page_number"], batchID, err)
+			continue
+		}
+		queued++
+	}
+	log.Printf("Requeued %d of %d unfinished pages for stalled batch %s", queued, len(pages), batchID)
+}
+
+// deleteBatchObjects removes the batch's source file (PDF uploads) and any
+// page images (multi-image uploads). Failures are logged, not fatal — the
+// batch is already expired and a missing object is the common case.
+func (h *Handler) deleteBatchObjects(ctx context.Context, b expiredBatch) {
+	var keys []string
+	if b.s3Key != "" {
+		keys = append(keys, b.s3Key)
+	}
+
+	pages, err := h.db.Query(ctx,
+		"SELECT image_path FROM upload_pages WHERE document_id = $1", b.id)
+	if err != nil {
+		log.Printf("WARNING: list pages for expired batch %s: %v", b.id, err)
+	}
+	for _, p := range pages {
+		if key, ok := p["image_path"].(string); ok && key != "" {
+			keys = append(keys, key)
+		}
+	}
+
+	for _, key := range keys {
+		if err := h.s3.DeleteObject(ctx, h.bucket, key); err != nil {
+			log.Printf("WARNING: delete %s for expired batch %s: %v", key, b.id, err)
+		}
+	}
+}
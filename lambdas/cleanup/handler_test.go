@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ─── Mock DB ────────────────────────────────────────────────────────────────
+
+type mockDB struct {
+	queryFn func(ctx context.Context, sql string, args ...any) ([]map[string]any, error)
+}
+
+func (m *mockDB) Query(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+	if m.queryFn != nil {
+		return m.queryFn(ctx, sql, args...)
+	}
+	return nil, nil
+}
+
+func (m *mockDB) Insert(ctx context.Context, sql string, args ...any) (string, error) {
+	return "test-id", nil
+}
+
+func (m *mockDB) Exec(ctx context.Context, sql string, args ...any) error {
+	return nil
+}
+
+func (m *mockDB) Ping(ctx context.Context) error { return nil }
+
+func (m *mockDB) Pool() *pgxpool.Pool { return nil }
+
+// ─── Mock S3 ────────────────────────────────────────────────────────────────
+
+type mockS3 struct {
+	deleteErr   error
+	deleteCalls []string
+}
+
+func (m *mockS3) PresignPutObject(ctx context.Context, bucket, key, contentType string, expires time.Duration) (string, error) {
+	return "https://example.com/put", nil
+}
+
+func (m *mockS3) PresignGetObject(ctx context.Context, bucket, key string, expires time.Duration) (string, error) {
+	return "https://example.com/get", nil
+}
+
+func (m *mockS3) GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader("data")), nil
+}
+
+func (m *mockS3) PutObject(ctx context.Context, bucket, key, contentType string, body io.Reader) error {
+	return nil
+}
+
+func (m *mockS3) HeadObject(ctx context.Context, bucket, key string) (bool, int64, error) {
+	return false, 0, nil
+}
+
+func (m *mockS3) ListObjects(ctx context.Context, bucket, prefix string) ([]string, error) {
+	return nil, nil
+}
+
+func (m *mockS3) DeleteObject(ctx context.Context, bucket, key string) error {
+	m.deleteCalls = append(m.deleteCalls, key)
+	return m.deleteErr
+}
+
+// ─── Mock SQS ───────────────────────────────────────────────────────────────
+
+type mockSQS struct {
+	sendErr  error
+	queueURL string
+	messages []string
+}
+
+func (m *mockSQS) SendMessage(ctx context.Context, queueURL, body string) error {
+	m.queueURL = queueURL
+	m.messages = append(m.messages, body)
+	return m.sendErr
+}
+
+// ─── Tests ──────────────────────────────────────────────────────────────────
+
+func TestExpireBatches_SelectionQuery(t *testing.T) {
+	var gotSQL string
+	var gotArgs []any
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			gotSQL, gotArgs = sql, args
+			return []map[string]any{
+				{"id": "batch-1", "s3_key": "uploads/batch-1/logbook.pdf"},
+				{"id": "batch-2", "s3_key": nil},
+			}, nil
+		},
+	}
+	h := &Handler{db: db, s3: &mockS3{}, ttlHours: 48}
+
+	batches, err := h.expireBatches(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Only pending batches are expired; processing/completed ones are left alone.
+	if !strings.Contains(gotSQL, "WHERE processing_status = 'pending'") {
+		t.Errorf("query must only select pending batches:\n%s", gotSQL)
+	}
+	if !strings.Contains(gotSQL, "SET processing_status = 'expired'") {
+		t.Errorf("query must mark batches expired:\n%s", gotSQL)
+	}
+	if len(gotArgs) != 1 || gotArgs[0] != 48 {
+		t.Errorf("args = %v, want [48]", gotArgs)
+	}
+	if len(batches) != 2 {
+		t.Fatalf("batches = %d, want 2", len(batches))
+	}
+	if batches[0].s3Key != "uploads/batch-1/logbook.pdf" || batches[1].s3Key != "" {
+		t.Errorf("unexpected s3 keys: %+v", batches)
+	}
+}
+
+func TestHandle_DeletesOrphanedObjects(t *testing.T) {
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			if strings.Contains(sql, "UPDATE upload_batches") {
+				return []map[string]any{
+					{"id": "pdf-batch", "s3_key": "uploads/pdf-batch/logbook.pdf"},
+					{"id": "img-batch", "s3_key": nil},
+				}, nil
+			}
+			if strings.Contains(sql, "upload_pages") && args[0] == "img-batch" {
+				return []map[string]any{
+					{"image_path": "pages/img-batch/page_0001.jpg"},
+					{"image_path": "pages/img-batch/page_0002.jpg"},
+				}, nil
+			}
+			return nil, nil
+		},
+	}
+	s3 := &mockS3{}
+	h := &Handler{db: db, s3: s3, bucket: "test-bucket", ttlHours: 48, deleteObjects: true}
+
+	if err := h.Handle(context.Background(), events.CloudWatchEvent{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []string{
+		"uploads/pdf-batch/logbook.pdf",
+		"pages/img-batch/page_0001.jpg",
+		"pages/img-batch/page_0002.jpg",
+	}
+	if fmt.Sprint(s3.deleteCalls) != fmt.Sprint(want) {
+		t.Errorf("deleted = %v, want %v", s3.deleteCalls, want)
+	}
+}
+
+func TestHandle_KeepsObjectsByDefault(t *testing.T) {
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			if strings.Contains(sql, "UPDATE upload_batches") {
+				return []map[string]any{{"id": "pdf-batch", "s3_key": "uploads/pdf-batch/logbook.pdf"}}, nil
+			}
+			return nil, nil
+		},
+	}
+	s3 := &mockS3{}
+	h := &Handler{db: db, s3: s3, ttlHours: 48}
+
+	if err := h.Handle(context.Background(), events.CloudWatchEvent{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(s3.deleteCalls) != 0 {
+		t.Errorf("expected no deletes, got %v", s3.deleteCalls)
+	}
+}
+
+func TestHandle_DeleteFailureIsNonFatal(t *testing.T) {
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			if strings.Contains(sql, "UPDATE upload_batches") {
+				return []map[string]any{{"id": "pdf-batch", "s3_key": "uploads/pdf-batch/logbook.pdf"}}, nil
+			}
+			return nil, fmt.Errorf("db unavailable")
+		},
+	}
+	s3 := &mockS3{deleteErr: fmt.Errorf("access denied")}
+	h := &Handler{db: db, s3: s3, ttlHours: 48, deleteObjects: true}
+
+	if err := h.Handle(context.Background(), events.CloudWatchEvent{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(s3.deleteCalls) != 1 {
+		t.Errorf("deleteCalls = %v, want the batch source file", s3.deleteCalls)
+	}
+}
+
+func TestHandle_QueryError(t *testing.T) {
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			return nil, fmt.Errorf("connection refused")
+		},
+	}
+	h := &Handler{db: db, s3: &mockS3{}, ttlHours: 48}
+
+	if err := h.Handle(context.Background(), events.CloudWatchEvent{}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestUploadTTLHours(t *testing.T) {
+	tests := []struct {
+		env  string
+		want int
+	}{
+		{"", 48},
+		{"12", 12},
+		{"0", 48},
+		{"abc", 48},
+	}
+	for _, tt := range tests {
+		t.Setenv("UPLOAD_TTL_HOURS", tt.env)
+		if got := uploadTTLHours(); got != tt.want {
+			t.Errorf("UPLOAD_TTL_HOURS=%q: got %d, want %d", tt.env, got, tt.want)
+		}
+	}
+}
+
+func TestMarkStalledBatches_Query(t *testing.T) {
+	var gotSQL string
+	var gotArgs []any
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			gotSQL, gotArgs = sql, args
+			return []map[string]any{{"id": "batch-1"}, {"id": "batch-2"}}, nil
+		},
+	}
+	h := &Handler{db: db, stallHours: 2}
+
+	ids, err := h.markStalledBatches(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, want := range []string{
+		"SET processing_status = 'stalled'",
+		// Only processing batches stall; pending ones expire instead.
+		"WHERE ub.processing_status = 'processing'",
+		"ub.updated_at < NOW() - make_interval(hours => $1)",
+		// Any page changing within the window counts as progress.
+		"up.updated_at >= NOW() - make_interval(hours => $1)",
+	} {
+		if !strings.Contains(gotSQL, want) {
+			t.Errorf("query is missing %q:\n%s", want, gotSQL)
+		}
+	}
+	if len(gotArgs) != 1 || gotArgs[0] != 2 {
+		t.Errorf("args = %v, want [2]", gotArgs)
+	}
+	if fmt.Sprint(ids) != "[batch-1 batch-2]" {
+		t.Errorf("ids = %v", ids)
+	}
+}
+
+func TestHandle_RequeuesStalledPages(t *testing.T) {
+	var pagesSQL string
+	var pagesArgs []any
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			switch {
+			case strings.Contains(sql, "'stalled'"):
+				return []map[string]any{{"id": "batch-1"}}, nil
+			case strings.Contains(sql, "FROM upload_pages"):
+				pagesSQL, pagesArgs = sql, args
+				return []map[string]any{
+					{"id": "page-2", "page_number": int32(2), "image_path": "pages/batch-1/page_0002.jpg"},
+					{"id": "page-5", "page_number": int32(5), "image_path": "pages/batch-1/page_0005.jpg"},
+				}, nil
+			}
+			return nil, nil
+		},
+	}
+	sqs := &mockSQS{}
+	h := &Handler{db: db, s3: &mockS3{}, ttlHours: 48, stallHours: 2,
+		requeueStalled: true, sqs: sqs, analyzeQueueURL: "https://sqs.example.com/analyze"}
+
+	if err := h.Handle(context.Background(), events.CloudWatchEvent{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !strings.Contains(pagesSQL, "extraction_status = 'processing'") ||
+		!strings.Contains(pagesSQL, "updated_at < NOW() - make_interval(hours => $2)") {
+		t.Errorf("only pages stuck in processing should be requeued:\n%s", pagesSQL)
+	}
+	if pagesArgs[1] != 2 {
+		t.Errorf("stall window = %v, want 2", pagesArgs[1])
+	}
+	if sqs.queueURL != "https://sqs.example.com/analyze" {
+		t.Errorf("queue = %q", sqs.queueURL)
+	}
+	if len(sqs.messages) != 2 {
+		t.Fatalf("messages = %d, want 2", len(sqs.messages))
+	}
+	var msg struct {
+		UploadID   string `json:"uploadId"`
+		PageID     string `json:"pageId"`
+		PageNumber int    `json:"pageNumber"`
+		S3Key      string `json:"s3Key"`
+	}
+	if err := json.Unmarshal([]byte(sqs.messages[1]), &msg); err != nil {
+		t.Fatalf("message: %v", err)
+	}
+	if msg.UploadID != "batch-1" || msg.PageID != "page-5" || msg.PageNumber != 5 || msg.S3Key != "pages/batch-1/page_0005.jpg" {
+		t.Errorf("message = %+v", msg)
+	}
+}
+
+func TestHandle_StalledNotRequeuedByDefault(t *testing.T) {
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			if strings.Contains(sql, "'stalled'") {
+				return []map[string]any{{"id": "batch-1"}}, nil
+			}
+			return []map[string]any{{"id": "page-1", "page_number": int32(1), "image_path": "pages/batch-1/page_0001.jpg"}}, nil
+		},
+	}
+	sqs := &mockSQS{}
+	h := &Handler{db: db, s3: &mockS3{}, ttlHours: 48, stallHours: 2, sqs: sqs}
+
+	if err := h.Handle(context.Background(), events.CloudWatchEvent{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(sqs.messages) != 0 {
+		t.Errorf("expected no messages, got %v", sqs.messages)
+	}
+}
+
+func TestHandle_RequeueFailureIsNonFatal(t *testing.T) {
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			switch {
+			case strings.Contains(sql, "'stalled'"):
+				return []map[string]any{{"id": "batch-1"}, {"id": "batch-2"}}, nil
+			case strings.Contains(sql, "FROM upload_pages"):
+				return []map[string]any{{"id": "page-1", "page_number": int32(1), "image_path": "pages/x/page_0001.jpg"}}, nil
+			}
+			return nil, nil
+		},
+	}
+	sqs := &mockSQS{sendErr: fmt.Errorf("throttled")}
+	h := &Handler{db: db, s3: &mockS3{}, ttlHours: 48, stallHours: 2, requeueStalled: true, sqs: sqs}
+
+	if err := h.Handle(context.Background(), events.CloudWatchEvent{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(sqs.messages) != 2 {
+		t.Errorf("messages = %d, want an attempt per batch", len(sqs.messages))
+	}
+}
+
+func TestStallHours(t *testing.T) {
+	tests := []struct {
+		env  string
+		want int
+	}{
+		{"", 2},
+		{"6", 6},
+		{"0", 0},
+		{"-1", 2},
+		{"abc", 2},
+	}
+	for _, tt := range tests {
+		t.Setenv("STALL_TTL_HOURS", tt.env)
+		if got := stallHours(); got != tt.want {
+			t.Errorf("STALL_TTL_HOURS=%q: got %d, want %d", tt.env, got, tt.want)
+		}
+	}
+}
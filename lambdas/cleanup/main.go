@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+
+	"github.com/projectcloudline/logbook-service/internal/awsutil"
+	"github.com/projectcloudline/logbook-service/internal/db"
+)
+
+const (
+	defaultUploadTTLHours = 48
+	defaultStallHours     = 2
+)
+
+func main() {
+	ctx := context.Background()
+	cfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		log.Fatalf("load AWS config: %v", err)
+	}
+
+	smClient := secretsmanager.NewFromConfig(cfg)
+	secrets := awsutil.NewSecretsProvider(smClient)
+	s3Client := awsutil.NewS3Client(s3.NewFromConfig(cfg))
+	sqsClient := awsutil.NewSQSClient(sqs.NewFromConfig(cfg))
+
+	database := db.New(func(ctx context.Context) (map[string]string, error) {
+		if host := os.Getenv("DB_HOST"); host != "" {
+			return map[string]string{
+				"host":     host,
+				"port":     envOrDefault("DB_PORT", "5432"),
+				"dbname":   envOrDefault("DB_NAME", "postgres"),
+				"username": envOrDefault("DB_USER", "postgres"),
+				"password": envOrDefault("DB_PASSWORD", "postgres"),
+			}, nil
+		}
+		arn := os.Getenv("DB_SECRET_ARN")
+		raw, err := secrets.GetSecret(ctx, arn)
+		if err != nil {
+			return nil, fmt.Errorf("get db secret: %w", err)
+		}
+		var creds map[string]string
+		if err := json.Unmarshal([]byte(raw), &creds); err != nil {
+			return nil, fmt.Errorf("parse db secret: %w", err)
+		}
+		return creds, nil
+	})
+
+	h := &Handler{
+		db:            database,
+		s3:            s3Client,
+		bucket:        os.Getenv("BUCKET_NAME"),
+		ttlHours:      uploadTTLHours(),
+		deleteObjects: os.Getenv("CLEANUP_DELETE_OBJECTS") == "true",
+		stallHours:    stallHours(),
+		// Requeueing needs somewhere to send the pages.
+		requeueStalled:  os.Getenv("CLEANUP_REQUEUE_STALLED") == "true" && os.Getenv("ANALYZE_QUEUE_URL") != "",
+		sqs:             sqsClient,
+		analyzeQueueURL: os.Getenv("ANALYZE_QUEUE_URL"),
+	}
+
+	lambda.Start(h.Handle)
+}
+
+// uploadTTLHours parses UPLOAD_TTL_HOURS, falling back to the default when
+// unset or not a positive integer.
+func uploadTTLHours() int {
+	raw := os.Getenv("UPLOAD_TTL_HOURS")
+	if raw == "" {
+		return defaultUploadTTLHours
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v <= 0 {
+		log.Printf("WARNING: ignoring invalid UPLOAD_TTL_HOURS %q", raw)
+		return defaultUploadTTLHours
+	}
+	return v
+}
+
+// stallHours parses STALL_TTL_HOURS, falling back to the default when unset
+// or not an integer. Zero turns stall detection off.
+func stallHours() int {
+	raw := os.Getenv("STALL_TTL_HOURS")
+	if raw == "" {
+		return defaultStallHours
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v < 0 {
+		log.Printf("WARNING: ignoring invalid STALL_TTL_HOURS %q", raw)
+		return defaultStallHours
+	}
+	return v
+}
+
+func envOrDefault(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/projectcloudline/logbook-service/internal/faa"
+)
+
+// enricher is the part of faa.Enricher the worker uses.
+type enricher interface {
+	Enrich(ctx context.Context, aircraftID, tailNumber string) error
+}
+
+// Handler holds dependencies for the Enrich Lambda, which refreshes aircraft
+// records from the FAA registry for uploads the API queued.
+type Handler struct {
+	faa enricher
+}
+
+// Handle enriches each queued aircraft. Transient failures are returned so
+// SQS redelivers the message; tail numbers the registry doesn't know are
+// logged and dropped.
+func (h *Handler) Handle(ctx context.Context, event events.SQSEvent) error {
+	for _, record := range event.Records {
+		var msg faa.Message
+		if err := json.Unmarshal([]byte(record.Body), &msg); err != nil {
+			return fmt.Errorf("parse message: %w", err)
+		}
+
+		log.Printf("Enriching aircraft %s (%s) from the FAA registry", msg.AircraftID, msg.TailNumber)
+
+		if err := h.enrich(ctx, msg); err != nil {
+			if errors.Is(err, faa.ErrNotRegistered) {
+				log.Printf("WARNING: %s is not in the FAA registry", msg.TailNumber)
+				continue
+			}
+			return fmt.Errorf("enrich %s: %w", msg.TailNumber, err)
+		}
+	}
+	return nil
+}
+
+func (h *Handler) enrich(ctx context.Context, msg faa.Message) error {
+	ctx, cancel := context.WithTimeout(ctx, faa.Timeout)
+	defer cancel()
+	return h.faa.Enrich(ctx, msg.AircraftID, msg.TailNumber)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/projectcloudline/logbook-service/internal/faa"
+)
+
+type mockEnricher struct {
+	calls []string
+	errs  map[string]error
+}
+
+func (m *mockEnricher) Enrich(ctx context.Context, aircraftID, tailNumber string) error {
+	if _, ok := ctx.Deadline(); !ok {
+		return fmt.Errorf("enrichment should run under a timeout")
+	}
+	m.calls = append(m.calls, aircraftID+" "+tailNumber)
+	return m.errs[tailNumber]
+}
+
+func sqsEvent(bodies ...string) events.SQSEvent {
+	var event events.SQSEvent
+	for _, b := range bodies {
+		event.Records = append(event.Records, events.SQSMessage{Body: b})
+	}
+	return event
+}
+
+func TestHandle(t *testing.T) {
+	tests := []struct {
+		name      string
+		bodies    []string
+		errs      map[string]error
+		wantCalls []string
+		wantErr   string
+	}{
+		{
+			name:      "enriches each aircraft",
+			bodies:    []string{`{"aircraftId":"aid-1","tailNumber":"N123"}`, `{"aircraftId":"aid-2","tailNumber":"N456"}`},
+			wantCalls: []string{"aid-1 N123", "aid-2 N456"},
+		},
+		{
+			name:      "unregistered tail is dropped",
+			bodies:    []string{`{"aircraftId":"aid-1","tailNumber":"N000"}`, `{"aircraftId":"aid-2","tailNumber":"N456"}`},
+			errs:      map[string]error{"N000": faa.ErrNotRegistered},
+			wantCalls: []string{"aid-1 N000", "aid-2 N456"},
+		},
+		{
+			name:      "transient failure is retried",
+			bodies:    []string{`{"aircraftId":"aid-1","tailNumber":"N123"}`},
+			errs:      map[string]error{"N123": fmt.Errorf("registry lookup: status 503")},
+			wantCalls: []string{"aid-1 N123"},
+			wantErr:   "enrich N123: registry lookup: status 503",
+		},
+		{
+			name:    "malformed message",
+			bodies:  []string{`not json`},
+			wantErr: "parse message",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &mockEnricher{errs: tt.errs}
+			h := &Handler{faa: m}
+
+			err := h.Handle(context.Background(), sqsEvent(tt.bodies...))
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+			if strings.Join(m.calls, ", ") != strings.Join(tt.wantCalls, ", ") {
+				t.Errorf("calls = %v, want %v", m.calls, tt.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+
+	"github.com/projectcloudline/logbook-service/internal/awsutil"
+	"github.com/projectcloudline/logbook-service/internal/db"
+	"github.com/projectcloudline/logbook-service/internal/faa"
+)
+
+func main() {
+	ctx := context.Background()
+	cfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		log.Fatalf("load AWS config: %v", err)
+	}
+
+	smClient := secretsmanager.NewFromConfig(cfg)
+	secrets := awsutil.NewSecretsProvider(smClient)
+
+	database := db.New(func(ctx context.Context) (map[string]string, error) {
+		if host := os.Getenv("DB_HOST"); host != "" {
+			return map[string]string{
+				"host":     host,
+				"port":     envOrDefault("DB_PORT", "5432"),
+				"dbname":   envOrDefault("DB_NAME", "postgres"),
+				"username": envOrDefault("DB_USER", "postgres"),
+				"password": envOrDefault("DB_PASSWORD", "postgres"),
+			}, nil
+		}
+		arn := os.Getenv("DB_SECRET_ARN")
+		raw, err := secrets.GetSecret(ctx, arn)
+		if err != nil {
+			return nil, fmt.Errorf("get db secret: %w", err)
+		}
+		var creds map[string]string
+		if err := json.Unmarshal([]byte(raw), &creds); err != nil {
+			return nil, fmt.Errorf("parse db secret: %w", err)
+		}
+		return creds, nil
+	})
+
+	h := &Handler{
+		faa: &faa.Enricher{
+			DB:        database,
+			Secrets:   secrets,
+			BaseURL:   os.Getenv("FAA_REGISTRY_URL"),
+			SecretARN: os.Getenv("FAA_REGISTRY_SECRET_ARN"),
+			TTL:       faaEnrichmentTTL(),
+		},
+	}
+
+	lambda.Start(h.Handle)
+}
+
+// faaEnrichmentTTL parses FAA_ENRICHMENT_TTL_HOURS, how long FAA registry
+// data is reused before it is refreshed. Unset or invalid values use the
+// default.
+func faaEnrichmentTTL() time.Duration {
+	raw := os.Getenv("FAA_ENRICHMENT_TTL_HOURS")
+	if raw == "" {
+		return 0
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v <= 0 {
+		log.Printf("WARNING: ignoring invalid FAA_ENRICHMENT_TTL_HOURS %q", raw)
+		return 0
+	}
+	return time.Duration(v) * time.Hour
+}
+
+func envOrDefault(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+
+	"github.com/projectcloudline/logbook-service/internal/awsutil"
+	"github.com/projectcloudline/logbook-service/internal/db"
+	"github.com/projectcloudline/logbook-service/internal/sourceurl"
+)
+
+// defaultMaxBytes caps a fetched logbook at 200 MiB.
+const defaultMaxBytes = 200 << 20
+
+// Handler holds dependencies for the Fetch Lambda.
+type Handler struct {
+	db     db.DB
+	s3     awsutil.S3Client
+	bucket string
+	http   *http.Client
+	// allowed lists the hosts logbooks may be fetched from; redirects are
+	// checked against it too.
+	allowed sourceurl.Allowlist
+	// maxBytes caps the download size. 0 means defaultMaxBytes.
+	maxBytes int64
+}
+
+type fetchMessage struct {
+	UploadID  string `json:"uploadId"`
+	SourceURL string `json:"sourceUrl"`
+	S3Key     string `json:"s3Key"`
+}
+
+// errPermanent marks fetch failures that a retry won't fix.
+var errPermanent = errors.New("permanent fetch failure")
+
+// Handle downloads queued source URLs into the uploads/ prefix, where the S3
+// notification hands them to the split Lambda like any other upload.
+func (h *Handler) Handle(ctx context.Context, event events.SQSEvent) error {
+	for _, record := range event.Records {
+		var msg fetchMessage
+		if err := json.Unmarshal([]byte(record.Body), &msg); err != nil {
+			return fmt.Errorf("parse message: %w", err)
+		}
+
+		log.Printf("Fetching upload %s from %s", msg.UploadID, msg.SourceURL)
+
+		if err := h.fetch(ctx, msg); err != nil {
+			if errors.Is(err, errPermanent) {
+				log.Printf("ERROR fetching upload %s: %v", msg.UploadID, err)
+				h.markFailed(ctx, msg.UploadID)
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *Handler) fetch(ctx context.Context, msg fetchMessage) error {
+	if !strings.HasPrefix(msg.S3Key, "uploads/"+msg.UploadID+"/") {
+		return fmt.Errorf("%w: unexpected s3 key %q", errPermanent, msg.S3Key)
+	}
+	u, err := h.allowed.Validate(msg.SourceURL)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errPermanent, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("%w: build request: %v", errPermanent, err)
+	}
+	resp, err := h.client().Do(req)
+	if err != nil {
+		if errors.Is(err, errPermanent) {
+			return err
+		}
+		return fmt.Errorf("download: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 500:
+		return fmt.Errorf("download: status %d", resp.StatusCode)
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("%w: status %d", errPermanent, resp.StatusCode)
+	}
+
+	limit := h.maxDownloadBytes()
+	if resp.ContentLength > limit {
+		return fmt.Errorf("%w: %d bytes exceeds the %d byte limit", errPermanent, resp.ContentLength, limit)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return fmt.Errorf("read body: %w", err)
+	}
+	if int64(len(data)) > limit {
+		return fmt.Errorf("%w: body exceeds the %d byte limit", errPermanent, limit)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	if err := h.s3.PutObject(ctx, h.bucket, msg.S3Key, contentType, bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("store upload: %w", err)
+	}
+
+	log.Printf("Stored %d bytes at s3://%s/%s", len(data), h.bucket, msg.S3Key)
+	return nil
+}
+
+// client returns the HTTP client, re-validating every redirect hop against
+// the allowlist so an allowed host can't bounce the fetch elsewhere.
+func (h *Handler) client() *http.Client {
+	c := http.DefaultClient
+	if h.http != nil {
+		c = h.http
+	}
+	checked := *c
+	checked.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 5 {
+			return fmt.Errorf("%w: too many redirects", errPermanent)
+		}
+		if _, err := h.allowed.Validate(req.URL.String()); err != nil {
+			return fmt.Errorf("%w: redirect: %v", errPermanent, err)
+		}
+		return nil
+	}
+	return &checked
+}
+
+func (h *Handler) maxDownloadBytes() int64 {
+	if h.maxBytes > 0 {
+		return h.maxBytes
+	}
+	return defaultMaxBytes
+}
+
+func (h *Handler) markFailed(ctx context.Context, batchID string) {
+	_ = h.db.Exec(ctx,
+		"UPDATE upload_batches SET processing_status = 'failed', updated_at = NOW() WHERE id = $1",
+		batchID)
+}
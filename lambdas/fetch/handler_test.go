@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/projectcloudline/logbook-service/internal/sourceurl"
+)
+
+// ─── Mock DB ────────────────────────────────────────────────────────────────
+
+type mockDB struct {
+	execSQL []string
+}
+
+func (m *mockDB) Query(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+	return nil, nil
+}
+
+func (m *mockDB) Insert(ctx context.Context, sql string, args ...any) (string, error) {
+	return "test-id", nil
+}
+
+func (m *mockDB) Exec(ctx context.Context, sql string, args ...any) error {
+	m.execSQL = append(m.execSQL, sql)
+	return nil
+}
+
+func (m *mockDB) Ping(ctx context.Context) error { return nil }
+
+func (m *mockDB) Pool() *pgxpool.Pool { return nil }
+
+// ─── Mock S3 ────────────────────────────────────────────────────────────────
+
+type putObjectCall struct {
+	key         string
+	contentType string
+	data        string
+}
+
+type mockS3 struct {
+	putCalls []putObjectCall
+}
+
+func (m *mockS3) PresignPutObject(ctx context.Context, bucket, key, contentType string, expires time.Duration) (string, error) {
+	return "https://example.com/put", nil
+}
+
+func (m *mockS3) PresignGetObject(ctx context.Context, bucket, key string, expires time.Duration) (string, error) {
+	return "https://example.com/get", nil
+}
+
+func (m *mockS3) GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader("data")), nil
+}
+
+func (m *mockS3) PutObject(ctx context.Context, bucket, key, contentType string, body io.Reader) error {
+	data, _ := io.ReadAll(body)
+	m.putCalls = append(m.putCalls, putObjectCall{key: key, contentType: contentType, data: string(data)})
+	return nil
+}
+
+func (m *mockS3) HeadObject(ctx context.Context, bucket, key string) (bool, int64, error) {
+	return false, 0, nil
+}
+
+func (m *mockS3) ListObjects(ctx context.Context, bucket, prefix string) ([]string, error) {
+	return nil, nil
+}
+
+func (m *mockS3) DeleteObject(ctx context.Context, bucket, key string) error {
+	return nil
+}
+
+// ─── Helpers ────────────────────────────────────────────────────────────────
+
+// newTestServer serves mux over TLS and returns a client that routes every
+// host to it, so tests can use real allowlisted hostnames on the default port.
+func newTestServer(t *testing.T, mux http.Handler) *http.Client {
+	srv := httptest.NewTLSServer(mux)
+	t.Cleanup(srv.Close)
+	addr := srv.Listener.Addr().String()
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}}
+}
+
+func sqsEvent(t *testing.T, msg fetchMessage) events.SQSEvent {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events.SQSEvent{Records: []events.SQSMessage{{Body: string(body)}}}
+}
+
+// ─── Tests ──────────────────────────────────────────────────────────────────
+
+func TestHandle(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/logbook.pdf", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		io.WriteString(w, "%PDF-1.7 logbook")
+	})
+	mux.HandleFunc("/big.pdf", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, strings.Repeat("x", 2048))
+	})
+	mux.HandleFunc("/chunked.pdf", func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 4; i++ {
+			io.WriteString(w, strings.Repeat("x", 512))
+			w.(http.Flusher).Flush()
+		}
+	})
+	mux.HandleFunc("/missing.pdf", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("/flaky.pdf", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	mux.HandleFunc("/moved.pdf", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://scans.example.com/logbook.pdf", http.StatusFound)
+	})
+	mux.HandleFunc("/escape.pdf", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://evil.example.org/logbook.pdf", http.StatusFound)
+	})
+
+	tests := []struct {
+		name       string
+		sourceURL  string
+		s3Key      string
+		wantErr    bool
+		wantPut    string // stored body; empty means nothing stored
+		wantFailed bool
+	}{
+		{
+			name:      "stores download under uploads prefix",
+			sourceURL: "https://scans.example.com/logbook.pdf",
+			wantPut:   "%PDF-1.7 logbook",
+		},
+		{
+			name:      "follows allowed redirect",
+			sourceURL: "https://scans.example.com/moved.pdf",
+			wantPut:   "%PDF-1.7 logbook",
+		},
+		{
+			name:       "disallowed host",
+			sourceURL:  "https://evil.example.org/logbook.pdf",
+			wantFailed: true,
+		},
+		{
+			name:       "redirect to disallowed host",
+			sourceURL:  "https://scans.example.com/escape.pdf",
+			wantFailed: true,
+		},
+		{
+			name:       "content length over limit",
+			sourceURL:  "https://scans.example.com/big.pdf",
+			wantFailed: true,
+		},
+		{
+			name:       "streamed body over limit",
+			sourceURL:  "https://scans.example.com/chunked.pdf",
+			wantFailed: true,
+		},
+		{
+			name:       "not found",
+			sourceURL:  "https://scans.example.com/missing.pdf",
+			wantFailed: true,
+		},
+		{
+			name:       "key outside batch upload prefix",
+			sourceURL:  "https://scans.example.com/logbook.pdf",
+			s3Key:      "pages/batch-1/page_0001.jpg",
+			wantFailed: true,
+		},
+		{
+			name:      "server error is retried",
+			sourceURL: "https://scans.example.com/flaky.pdf",
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &mockDB{}
+			s3Mock := &mockS3{}
+			h := &Handler{
+				db:       db,
+				s3:       s3Mock,
+				bucket:   "test-bucket",
+				http:     newTestServer(t, mux),
+				allowed:  sourceurl.Allowlist{"scans.example.com"},
+				maxBytes: 1024,
+			}
+			key := tt.s3Key
+			if key == "" {
+				key = "uploads/batch-1/logbook.pdf"
+			}
+
+			err := h.Handle(context.Background(), sqsEvent(t, fetchMessage{
+				UploadID:  "batch-1",
+				SourceURL: tt.sourceURL,
+				S3Key:     key,
+			}))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantPut == "" {
+				if len(s3Mock.putCalls) != 0 {
+					t.Errorf("expected nothing stored, got %v", s3Mock.putCalls)
+				}
+			} else {
+				if len(s3Mock.putCalls) != 1 {
+					t.Fatalf("putCalls = %d, want 1", len(s3Mock.putCalls))
+				}
+				call := s3Mock.putCalls[0]
+				if call.key != key || call.data != tt.wantPut {
+					t.Errorf("put %s = %q, want %s = %q", call.key, call.data, key, tt.wantPut)
+				}
+				if call.contentType != "application/pdf" {
+					t.Errorf("content type = %s, want application/pdf", call.contentType)
+				}
+			}
+
+			failed := len(db.execSQL) == 1 && strings.Contains(db.execSQL[0], "'failed'")
+			if failed != tt.wantFailed {
+				t.Errorf("batch marked failed = %v, want %v (exec: %v)", failed, tt.wantFailed, db.execSQL)
+			}
+		})
+	}
+}
+
+func TestHandle_InvalidMessage(t *testing.T) {
+	h := &Handler{db: &mockDB{}, s3: &mockS3{}}
+	err := h.Handle(context.Background(), events.SQSEvent{
+		Records: []events.SQSMessage{{Body: "not json"}},
+	})
+	if err == nil {
+		t.Error("expected error for unparseable message")
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+
+	"github.com/projectcloudline/logbook-service/internal/awsutil"
+	"github.com/projectcloudline/logbook-service/internal/db"
+	"github.com/projectcloudline/logbook-service/internal/sourceurl"
+)
+
+func main() {
+	ctx := context.Background()
+	cfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		log.Fatalf("load AWS config: %v", err)
+	}
+
+	smClient := secretsmanager.NewFromConfig(cfg)
+	secrets := awsutil.NewSecretsProvider(smClient)
+	s3Client := awsutil.NewS3Client(s3.NewFromConfig(cfg))
+
+	database := db.New(func(ctx context.Context) (map[string]string, error) {
+		if host := os.Getenv("DB_HOST"); host != "" {
+			return map[string]string{
+				"host":     host,
+				"port":     envOrDefault("DB_PORT", "5432"),
+				"dbname":   envOrDefault("DB_NAME", "postgres"),
+				"username": envOrDefault("DB_USER", "postgres"),
+				"password": envOrDefault("DB_PASSWORD", "postgres"),
+			}, nil
+		}
+		arn := os.Getenv("DB_SECRET_ARN")
+		raw, err := secrets.GetSecret(ctx, arn)
+		if err != nil {
+			return nil, fmt.Errorf("get db secret: %w", err)
+		}
+		var creds map[string]string
+		if err := json.Unmarshal([]byte(raw), &creds); err != nil {
+			return nil, fmt.Errorf("parse db secret: %w", err)
+		}
+		return creds, nil
+	})
+
+	h := &Handler{
+		db:       database,
+		s3:       s3Client,
+		bucket:   os.Getenv("BUCKET_NAME"),
+		http:     &http.Client{Timeout: 2 * time.Minute},
+		allowed:  sourceurl.ParseAllowlist(os.Getenv("SOURCE_URL_ALLOWED_HOSTS")),
+		maxBytes: maxBytes(),
+	}
+
+	lambda.Start(h.Handle)
+}
+
+// maxBytes parses SOURCE_URL_MAX_BYTES, falling back to the default when
+// unset or not a positive integer.
+func maxBytes() int64 {
+	raw := os.Getenv("SOURCE_URL_MAX_BYTES")
+	if raw == "" {
+		return defaultMaxBytes
+	}
+	v, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || v <= 0 {
+		log.Printf("WARNING: ignoring invalid SOURCE_URL_MAX_BYTES %q", raw)
+		return defaultMaxBytes
+	}
+	return v
+}
+
+func envOrDefault(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
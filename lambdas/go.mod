@@ -13,6 +13,7 @@ require (
 	github.com/aws/aws-sdk-go-v2/service/secretsmanager v1.34.8
 	github.com/aws/aws-sdk-go-v2/service/sqs v1.37.3
 	github.com/jackc/pgx/v5 v5.7.2
+	github.com/jung-kurt/gofpdf v1.16.2
 	github.com/pgvector/pgvector-go v0.2.2
 	golang.org/x/image v0.36.0
 	google.golang.org/genai v0.7.0
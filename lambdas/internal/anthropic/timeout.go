@@ -0,0 +1,28 @@
+package anthropic
+
+import (
+	"context"
+	"time"
+)
+
+// WithTimeout returns a Client that gives each call on c at most d, so a
+// hung connection fails that call with context.DeadlineExceeded instead of
+// holding the caller until its own deadline. A d of zero or less returns c
+// unchanged.
+func WithTimeout(c Client, d time.Duration) Client {
+	if d <= 0 {
+		return c
+	}
+	return &timeoutClient{client: c, timeout: d}
+}
+
+type timeoutClient struct {
+	client  Client
+	timeout time.Duration
+}
+
+func (c *timeoutClient) CreateMessage(ctx context.Context, model string, maxTokens int64, messages []Message) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.client.CreateMessage(ctx, model, maxTokens, messages)
+}
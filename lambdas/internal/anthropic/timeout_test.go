@@ -0,0 +1,30 @@
+package anthropic
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWithTimeout(t *testing.T) {
+	mock := &MockClient{
+		CreateMessageFn: func(ctx context.Context, model string, maxTokens int64, messages []Message) (string, error) {
+			select {
+			case <-ctx.Done():
+				return "", ctx.Err()
+			case <-time.After(5 * time.Second):
+				t.Error("call was not cancelled")
+				return "", errors.New("not cancelled")
+			}
+		},
+	}
+
+	_, err := WithTimeout(mock, 10*time.Millisecond).CreateMessage(context.Background(), "m", 16, nil)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("error = %v, want context.DeadlineExceeded", err)
+	}
+	if c := WithTimeout(mock, 0); c != Client(mock) {
+		t.Errorf("WithTimeout(c, 0) = %T, want c itself", c)
+	}
+}
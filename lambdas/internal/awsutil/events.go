@@ -0,0 +1,55 @@
+package awsutil
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+// EventPublisher emits events for internal consumers such as indexers and
+// notifiers.
+type EventPublisher interface {
+	Publish(ctx context.Context, eventType string, detail any) error
+}
+
+// Event is the envelope every published message body carries.
+type Event struct {
+	Type   string    `json:"type"`
+	Time   time.Time `json:"time"`
+	Detail any       `json:"detail"`
+}
+
+type sqsEventPublisher struct {
+	client   SQSAPI
+	queueURL string
+}
+
+// NewSQSEventPublisher creates an EventPublisher that sends each event to an
+// SQS queue, with the type also set as the "eventType" message attribute so
+// consumers can filter without parsing the body.
+func NewSQSEventPublisher(client SQSAPI, queueURL string) EventPublisher {
+	return &sqsEventPublisher{client: client, queueURL: queueURL}
+}
+
+func (p *sqsEventPublisher) Publish(ctx context.Context, eventType string, detail any) error {
+	body, err := json.Marshal(Event{Type: eventType, Time: time.Now().UTC(), Detail: detail})
+	if err != nil {
+		return fmt.Errorf("marshal %s event: %w", eventType, err)
+	}
+	_, err = p.client.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(p.queueURL),
+		MessageBody: aws.String(string(body)),
+		MessageAttributes: map[string]types.MessageAttributeValue{
+			"eventType": {DataType: aws.String("String"), StringValue: aws.String(eventType)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("publish %s event: %w", eventType, err)
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package awsutil
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+)
+
+type recordingSQSAPI struct {
+	inputs []*sqs.SendMessageInput
+}
+
+func (m *recordingSQSAPI) SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	m.inputs = append(m.inputs, params)
+	return &sqs.SendMessageOutput{}, nil
+}
+
+func TestSQSEventPublisher_Publish(t *testing.T) {
+	mock := &recordingSQSAPI{}
+	p := NewSQSEventPublisher(mock, "https://sqs.example.com/events")
+
+	if err := p.Publish(context.Background(), "batch.completed", map[string]string{"uploadId": "batch-1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(mock.inputs) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(mock.inputs))
+	}
+	in := mock.inputs[0]
+	if aws.ToString(in.QueueUrl) != "https://sqs.example.com/events" {
+		t.Errorf("queue = %q", aws.ToString(in.QueueUrl))
+	}
+	if got := aws.ToString(in.MessageAttributes["eventType"].StringValue); got != "batch.completed" {
+		t.Errorf("eventType attribute = %q", got)
+	}
+
+	var body struct {
+		Type   string            `json:"type"`
+		Time   string            `json:"time"`
+		Detail map[string]string `json:"detail"`
+	}
+	if err := json.Unmarshal([]byte(aws.ToString(in.MessageBody)), &body); err != nil {
+		t.Fatalf("body: %v", err)
+	}
+	if body.Type != "batch.completed" || body.Time == "" || body.Detail["uploadId"] != "batch-1" {
+		t.Errorf("body = %+v", body)
+	}
+}
@@ -2,12 +2,14 @@ package awsutil
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
 // S3Client defines S3 operations used by Lambda handlers.
@@ -16,6 +18,13 @@ type S3Client interface {
 	PresignGetObject(ctx context.Context, bucket, key string, expires time.Duration) (string, error)
 	GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, error)
 	PutObject(ctx context.Context, bucket, key, contentType string, body io.Reader) error
+	DeleteObject(ctx context.Context, bucket, key string) error
+	// HeadObject reports whether the object exists and its size, without
+	// downloading it. A missing object is not an error.
+	HeadObject(ctx context.Context, bucket, key string) (exists bool, size int64, err error)
+	// ListObjects returns the keys of every object under prefix, in key
+	// order.
+	ListObjects(ctx context.Context, bucket, prefix string) ([]string, error)
 }
 
 type s3Client struct {
@@ -83,3 +92,53 @@ func (c *s3Client) PutObject(ctx context.Context, bucket, key, contentType strin
 	}
 	return nil
 }
+
+func (c *s3Client) HeadObject(ctx context.Context, bucket, key string) (bool, int64, error) {
+	resp, err := c.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var notFound *types.NotFound
+		if errors.As(err, &notFound) {
+			return false, 0, nil
+		}
+		return false, 0, fmt.Errorf("head object %s: %w", key, err)
+	}
+	return true, aws.ToInt64(resp.ContentLength), nil
+}
+
+func (c *s3Client) ListObjects(ctx context.Context, bucket, prefix string) ([]string, error) {
+	return listObjects(ctx, c.client, bucket, prefix)
+}
+
+// listObjects follows continuation tokens until every key under prefix has
+// been read; a single ListObjectsV2 call returns at most 1,000.
+func listObjects(ctx context.Context, api s3.ListObjectsV2APIClient, bucket, prefix string) ([]string, error) {
+	var keys []string
+	pages := s3.NewListObjectsV2Paginator(api, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("list objects %s: %w", prefix, err)
+		}
+		for _, obj := range page.Contents {
+			keys = append(keys, aws.ToString(obj.Key))
+		}
+	}
+	return keys, nil
+}
+
+func (c *s3Client) DeleteObject(ctx context.Context, bucket, key string) error {
+	_, err := c.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("delete object %s: %w", key, err)
+	}
+	return nil
+}
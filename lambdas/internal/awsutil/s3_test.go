@@ -0,0 +1,88 @@
+package awsutil
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// pagingS3API serves keys a few at a time, the way S3 does past 1,000.
+type pagingS3API struct {
+	keys     []string
+	pageSize int
+	err      error
+	inputs   []*s3.ListObjectsV2Input
+}
+
+func (m *pagingS3API) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	m.inputs = append(m.inputs, params)
+	if m.err != nil {
+		return nil, m.err
+	}
+	start := 0
+	if params.ContinuationToken != nil {
+		start, _ = strconv.Atoi(aws.ToString(params.ContinuationToken))
+	}
+	end := min(start+m.pageSize, len(m.keys))
+	out := &s3.ListObjectsV2Output{IsTruncated: aws.Bool(end < len(m.keys))}
+	for _, k := range m.keys[start:end] {
+		out.Contents = append(out.Contents, types.Object{Key: aws.String(k)})
+	}
+	if end < len(m.keys) {
+		out.NextContinuationToken = aws.String(strconv.Itoa(end))
+	}
+	return out, nil
+}
+
+func TestListObjects_Paginates(t *testing.T) {
+	mock := &pagingS3API{
+		keys: []string{
+			"slices/b1/page_0001/slice_000.jpg",
+			"slices/b1/page_0001/slice_001.jpg",
+			"slices/b1/page_0001/slice_002.jpg",
+			"slices/b1/page_0001/slice_003.jpg",
+			"slices/b1/page_0001/slice_004.jpg",
+		},
+		pageSize: 2,
+	}
+
+	keys, err := listObjects(context.Background(), mock, "bucket", "slices/b1/page_0001/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(keys, mock.keys) {
+		t.Errorf("keys = %v, want %v", keys, mock.keys)
+	}
+	if len(mock.inputs) != 3 {
+		t.Fatalf("expected 3 list calls, got %d", len(mock.inputs))
+	}
+	for _, in := range mock.inputs {
+		if aws.ToString(in.Bucket) != "bucket" || aws.ToString(in.Prefix) != "slices/b1/page_0001/" {
+			t.Errorf("list input bucket=%q prefix=%q", aws.ToString(in.Bucket), aws.ToString(in.Prefix))
+		}
+	}
+}
+
+func TestListObjects_Empty(t *testing.T) {
+	keys, err := listObjects(context.Background(), &pagingS3API{pageSize: 2}, "bucket", "slices/none/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(keys) != 0 {
+		t.Errorf("keys = %v, want none", keys)
+	}
+}
+
+func TestListObjects_Error(t *testing.T) {
+	denied := errors.New("access denied")
+	_, err := listObjects(context.Background(), &pagingS3API{err: denied}, "bucket", "slices/b1/")
+	if !errors.Is(err, denied) {
+		t.Errorf("err = %v, want it to wrap %v", err, denied)
+	}
+}
@@ -0,0 +1,51 @@
+package db
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Args collects the arguments of a statement assembled from optional
+// clauses. Each value added returns its own placeholder, so clauses are
+// never written with a hand-kept counter that can drift from the argument
+// list. Values are always bound, never formatted into the SQL.
+//
+//	args := db.Args{aircraftID} // $1
+//	where := []string{"aircraft_id = $1"}
+//	if entryType != "" {
+//		where = append(where, "entry_type = "+args.Add(entryType))
+//	}
+//	rows, err := d.Query(ctx, "SELECT ... WHERE "+strings.Join(where, " AND "), args...)
+type Args []any
+
+// Add appends v and returns its placeholder, such as "$3".
+func (a *Args) Add(v any) string {
+	*a = append(*a, v)
+	return "$" + strconv.Itoa(len(*a))
+}
+
+// Any binds values as a single array argument and returns "ANY($n)", for
+// clauses like "id = "+args.Any(ids). The statement's text is the same
+// however many values there are. An empty list matches nothing; a nil slice
+// is bound as an empty array rather than NULL.
+func Any[T any](a *Args, values []T) string {
+	if values == nil {
+		values = []T{}
+	}
+	return "ANY(" + a.Add(values) + ")"
+}
+
+// In binds each value as its own argument and returns the parenthesized
+// placeholder list for an IN clause, such as "($2, $3, $4)". Prefer Any
+// unless the values can't be sent as one array, for instance because their
+// types differ. An empty list returns "(NULL)", which matches nothing.
+func In[T any](a *Args, values []T) string {
+	if len(values) == 0 {
+		return "(NULL)"
+	}
+	placeholders := make([]string, len(values))
+	for i, v := range values {
+		placeholders[i] = a.Add(v)
+	}
+	return "(" + strings.Join(placeholders, ", ") + ")"
+}
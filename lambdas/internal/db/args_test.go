@@ -0,0 +1,80 @@
+package db
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestArgs_Add(t *testing.T) {
+	args := Args{"aircraft-1"}
+	if got := args.Add("inspection"); got != "$2" {
+		t.Errorf("first placeholder = %q, want $2", got)
+	}
+	if got := args.Add(25); got != "$3" {
+		t.Errorf("second placeholder = %q, want $3", got)
+	}
+	if fmt.Sprint(args) != "[aircraft-1 inspection 25]" {
+		t.Errorf("args = %v", args)
+	}
+}
+
+func TestAny(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []string
+		want   []string
+	}{
+		{"nil", nil, []string{}},
+		{"empty", []string{}, []string{}},
+		{"one", []string{"a"}, []string{"a"}},
+		{"several", []string{"a", "b", "c"}, []string{"a", "b", "c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := Args{"aircraft-1"}
+			// One placeholder whatever the length.
+			if got := Any(&args, tt.values); got != "ANY($2)" {
+				t.Errorf("clause = %q, want ANY($2)", got)
+			}
+			if len(args) != 2 {
+				t.Fatalf("args = %v, want the list bound as one argument", args)
+			}
+			bound, ok := args[1].([]string)
+			if !ok || bound == nil || fmt.Sprint(bound) != fmt.Sprint(tt.want) {
+				t.Errorf("bound %#v, want %#v", args[1], tt.want)
+			}
+		})
+	}
+}
+
+func TestIn(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []int
+		want   string
+	}{
+		{"empty", nil, "(NULL)"},
+		{"one", []int{7}, "($2)"},
+		{"several", []int{7, 8, 9}, "($2, $3, $4)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := Args{"aircraft-1"}
+			if got := In(&args, tt.values); got != tt.want {
+				t.Errorf("clause = %q, want %q", got, tt.want)
+			}
+			if len(args) != 1+len(tt.values) {
+				t.Fatalf("args = %v, want one per value", args)
+			}
+			for i, v := range tt.values {
+				if args[1+i] != v {
+					t.Errorf("args[%d] = %v, want %v", 1+i, args[1+i], v)
+				}
+			}
+			// Placeholders keep counting after the list.
+			if got := args.Add("x"); got != fmt.Sprintf("$%d", len(tt.values)+2) {
+				t.Errorf("next placeholder = %q", got)
+			}
+		})
+	}
+}
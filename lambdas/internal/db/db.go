@@ -4,10 +4,16 @@ package db
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"regexp"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	pgxvec "github.com/pgvector/pgvector-go/pgx"
 )
@@ -17,6 +23,9 @@ type DB interface {
 	Query(ctx context.Context, sql string, args ...any) ([]map[string]any, error)
 	Insert(ctx context.Context, sql string, args ...any) (string, error)
 	Exec(ctx context.Context, sql string, args ...any) error
+	// Ping connects if needed and round-trips a trivial query, so callers can
+	// warm the pool ahead of real traffic and probe database health.
+	Ping(ctx context.Context) error
 	Pool() *pgxpool.Pool
 }
 
@@ -24,12 +33,73 @@ type DB interface {
 // host, port, dbname, username, password.
 type CredentialsFunc func(ctx context.Context) (map[string]string, error)
 
+// WithHost returns a CredentialsFunc that reuses credsFn's credentials
+// against a different host, e.g. an Aurora reader endpoint. It returns nil
+// when host is empty so the result can be passed straight to NewWithReplica.
+func WithHost(credsFn CredentialsFunc, host string) CredentialsFunc {
+	if host == "" {
+		return nil
+	}
+	return func(ctx context.Context) (map[string]string, error) {
+		creds, err := credsFn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		replica := make(map[string]string, len(creds))
+		for k, v := range creds {
+			replica[k] = v
+		}
+		replica["host"] = host
+		return replica, nil
+	}
+}
+
+type primaryKey struct{}
+
+// WithPrimary marks ctx so that Query runs against the primary even when a
+// replica is configured. Use it for reads that must see a just-committed
+// write. Statements that write through Query (UPDATE ... RETURNING) go to the
+// primary anyway, but marking them too keeps the intent visible.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// IsPrimary reports whether ctx was marked with WithPrimary.
+func IsPrimary(ctx context.Context) bool {
+	return ctx.Value(primaryKey{}) != nil
+}
+
+// querier is the subset of *pgxpool.Pool that PgxDB runs statements against.
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
 // PgxDB implements DB using pgxpool.
+//
+// Initialization is lazy and retried: a transient failure (credentials not
+// yet readable, pool creation failing while RDS is cold) is returned to the
+// caller but not cached, so the next call tries again instead of poisoning the
+// container. Only a malformed connection config is treated as permanent.
+//
+// When a replica is configured, Query reads from its own pool so bursts of
+// reads don't starve the small write pool; Insert and Exec always use the
+// primary, as does a Query that modifies data. Replica reads may lag the
+// primary slightly.
 type PgxDB struct {
-	credsFn CredentialsFunc
-	pool    *pgxpool.Pool
-	once    sync.Once
-	initErr error
+	credsFn     CredentialsFunc
+	readCredsFn CredentialsFunc
+	pool        *pgxpool.Pool
+	readPool    *pgxpool.Pool
+	mu          sync.Mutex
+	initErr     error
+	readInitErr error
+
+	// primary and replica are what statements run against — the pools above
+	// once initialized.
+	primary querier
+	replica querier
 }
 
 // New creates a new PgxDB with lazy pool initialization.
@@ -37,67 +107,233 @@ func New(credsFn CredentialsFunc) *PgxDB {
 	return &PgxDB{credsFn: credsFn}
 }
 
+// NewWithReplica creates a PgxDB that sends Query to a read replica reached
+// with readCredsFn. A nil readCredsFn behaves like New.
+func NewWithReplica(credsFn, readCredsFn CredentialsFunc) *PgxDB {
+	return &PgxDB{credsFn: credsFn, readCredsFn: readCredsFn}
+}
+
 func (d *PgxDB) init(ctx context.Context) error {
-	d.once.Do(func() {
-		creds, err := d.credsFn(ctx)
-		if err != nil {
-			d.initErr = fmt.Errorf("get db credentials: %w", err)
-			return
-		}
+	d.mu.Lock()
+	defer d.mu.Unlock()
 
-		host := creds["host"]
-		port := creds["port"]
-		if port == "" {
-			port = "5432"
-		}
-		dbname := creds["dbname"]
-		if dbname == "" {
-			dbname = creds["database"]
+	if d.primary != nil || d.initErr != nil {
+		return d.initErr
+	}
+
+	pool, permanent, err := openPool(ctx, d.credsFn)
+	if err != nil {
+		if permanent {
+			d.initErr = err
 		}
-		if dbname == "" {
-			dbname = "postgres"
+		return err
+	}
+	d.pool, d.primary = pool, pool
+	return nil
+}
+
+// reader returns the querier sql should use: the replica when one is
+// configured, ctx doesn't ask for the primary and sql only reads, otherwise
+// the primary.
+func (d *PgxDB) reader(ctx context.Context, sql string) (querier, error) {
+	if d.readCredsFn == nil || IsPrimary(ctx) || modifiesData(sql) {
+		if err := d.init(ctx); err != nil {
+			return nil, err
 		}
-		user := creds["username"]
-		pass := creds["password"]
+		return d.primary, nil
+	}
 
-		connStr := fmt.Sprintf(
-			"postgres://%s:%s@%s:%s/%s?search_path=logbook,public&pool_max_conns=2&connect_timeout=10",
-			user, pass, host, port, dbname,
-		)
+	d.mu.Lock()
+	defer d.mu.Unlock()
 
-		config, err := pgxpool.ParseConfig(connStr)
-		if err != nil {
-			d.initErr = fmt.Errorf("parse pool config: %w", err)
-			return
-		}
+	if d.replica != nil || d.readInitErr != nil {
+		return d.replica, d.readInitErr
+	}
 
-		config.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
-			return pgxvec.RegisterTypes(ctx, conn)
+	pool, permanent, err := openPool(ctx, d.readCredsFn)
+	if err != nil {
+		err = fmt.Errorf("replica: %w", err)
+		if permanent {
+			d.readInitErr = err
 		}
+		return nil, err
+	}
+	d.readPool, d.replica = pool, pool
+	return d.replica, nil
+}
 
-		pool, err := pgxpool.NewWithConfig(ctx, config)
-		if err != nil {
-			d.initErr = fmt.Errorf("create pool: %w", err)
-			return
-		}
-		d.pool = pool
-	})
-	return d.initErr
+// writeKeyword matches the statements a read replica can't run: data
+// modification, including inside a WITH, and locking reads (FOR UPDATE,
+// FOR NO KEY UPDATE, FOR SHARE, FOR KEY SHARE).
+var writeKeyword = regexp.MustCompile(`(?i)\b(INSERT|UPDATE|DELETE|MERGE|TRUNCATE)\b|\bFOR\s+(NO\s+KEY\s+)?(UPDATE|SHARE)\b|\bFOR\s+KEY\s+SHARE\b`)
+
+// stringLiteral matches single-quoted SQL strings, whose contents are not
+// keywords.
+var stringLiteral = regexp.MustCompile(`'(?:[^']|'')*'`)
+
+// modifiesData reports whether sql may write, so it must go to the primary.
+// It errs towards yes: a read that merely mentions a write keyword only costs
+// a trip to the primary.
+func modifiesData(sql string) bool {
+	return writeKeyword.MatchString(stringLiteral.ReplaceAllString(sql, "''"))
+}
+
+// openPool builds a pool from the credentials credsFn returns. permanent
+// reports an error that retrying will not fix.
+func openPool(ctx context.Context, credsFn CredentialsFunc) (pool *pgxpool.Pool, permanent bool, err error) {
+	creds, err := credsFn(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("get db credentials: %w", err)
+	}
+
+	host := creds["host"]
+	port := creds["port"]
+	if port == "" {
+		port = "5432"
+	}
+	dbname := creds["dbname"]
+	if dbname == "" {
+		dbname = creds["database"]
+	}
+	if dbname == "" {
+		dbname = "postgres"
+	}
+	user := creds["username"]
+	pass := creds["password"]
+
+	connStr := fmt.Sprintf(
+		"postgres://%s:%s@%s:%s/%s?search_path=logbook,public&pool_max_conns=2&connect_timeout=10",
+		user, pass, host, port, dbname,
+	)
+
+	config, err := pgxpool.ParseConfig(connStr)
+	if err != nil {
+		// A malformed config will not fix itself — cache it.
+		return nil, true, fmt.Errorf("parse pool config: %w", err)
+	}
+
+	config.AfterConnect = registerVectorTypes
+
+	pool, err = pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		return nil, false, fmt.Errorf("create pool: %w", err)
+	}
+	return pool, false, nil
+}
+
+// registerVectorTypes registers pgvector's types on conn. A database without
+// the extension has none to register; its connections still serve
+// everything but vector search, which fails with errors IsVectorUnavailable
+// recognizes instead of every connection failing.
+func registerVectorTypes(ctx context.Context, conn *pgx.Conn) error {
+	var installed bool
+	if err := conn.QueryRow(ctx, "SELECT to_regtype('vector') IS NOT NULL").Scan(&installed); err != nil {
+		return fmt.Errorf("check for pgvector: %w", err)
+	}
+	if !installed {
+		return nil
+	}
+	return pgxvec.RegisterTypes(ctx, conn)
+}
+
+// ErrVectorUnavailable reports that the database lacks the pgvector
+// extension's halfvec type, which embeddings are stored and searched as.
+var ErrVectorUnavailable = errors.New("pgvector halfvec type is not available: install pgvector 0.7 or later and run CREATE EXTENSION vector, then apply sql/schema.sql")
+
+// IsVectorUnavailable reports whether err is ErrVectorUnavailable or a
+// Postgres error from a statement that needs pgvector run against a
+// database without it: the halfvec type or its operators missing, or the
+// embeddings table or column that could not be created without them.
+func IsVectorUnavailable(err error) bool {
+	if errors.Is(err, ErrVectorUnavailable) {
+		return true
+	}
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	switch pgErr.Code {
+	case "42704", "42883": // undefined_object, undefined_function
+		return strings.Contains(pgErr.Message, "vec")
+	case "42P01", "42703": // undefined_table, undefined_column
+		return strings.Contains(pgErr.Message, "embedding")
+	}
+	return false
+}
+
+// VectorAvailable reports whether the database has pgvector's halfvec type.
+func VectorAvailable(ctx context.Context, d DB) (bool, error) {
+	rows, err := d.Query(ctx, "SELECT to_regtype('halfvec') IS NOT NULL AS available")
+	if err != nil {
+		return false, err
+	}
+	if len(rows) == 0 {
+		return false, nil
+	}
+	available, _ := rows[0]["available"].(bool)
+	return available, nil
+}
+
+// vectorCheckTimeout bounds LogVectorSupport, so an unreachable database
+// delays a cold start only briefly.
+const vectorCheckTimeout = 5 * time.Second
+
+// LogVectorSupport logs whether the database has pgvector's halfvec type,
+// so a cold start shows up front why vector search or embedding would fail.
+func LogVectorSupport(ctx context.Context, d DB) {
+	ctx, cancel := context.WithTimeout(ctx, vectorCheckTimeout)
+	defer cancel()
+	available, err := VectorAvailable(ctx, d)
+	switch {
+	case err != nil:
+		log.Printf("WARNING: could not check for pgvector: %v", err)
+	case !available:
+		log.Printf("WARNING: %v", ErrVectorUnavailable)
+	default:
+		log.Printf("pgvector halfvec type available")
+	}
 }
 
 // Pool returns the underlying pgxpool.Pool, initializing it if needed.
 func (d *PgxDB) Pool() *pgxpool.Pool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	return d.pool
 }
 
+// Ping initializes the pools if needed and runs SELECT 1 on each, so a
+// warmup pays the connect cost and a health check sees an unreachable
+// database or replica.
+func (d *PgxDB) Ping(ctx context.Context) error {
+	if err := d.init(ctx); err != nil {
+		return err
+	}
+	if _, err := d.primary.Exec(ctx, "SELECT 1"); err != nil {
+		return fmt.Errorf("ping: %w", err)
+	}
+	if d.readCredsFn == nil {
+		return nil
+	}
+
+	q, err := d.reader(ctx, "SELECT 1")
+	if err != nil {
+		return err
+	}
+	if _, err := q.Exec(ctx, "SELECT 1"); err != nil {
+		return fmt.Errorf("ping replica: %w", err)
+	}
+	return nil
+}
+
 // Query executes a SQL query and returns results as a slice of maps.
 // This mirrors Python's RealDictCursor behavior.
 func (d *PgxDB) Query(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
-	if err := d.init(ctx); err != nil {
+	q, err := d.reader(ctx, sql)
+	if err != nil {
 		return nil, err
 	}
 
-	rows, err := d.pool.Query(ctx, sql, args...)
+	rows, err := q.Query(ctx, sql, args...)
 	if err != nil {
 		return nil, fmt.Errorf("query: %w", err)
 	}
@@ -133,7 +369,7 @@ func (d *PgxDB) Insert(ctx context.Context, sql string, args ...any) (string, er
 	}
 
 	var id any
-	err := d.pool.QueryRow(ctx, sql, args...).Scan(&id)
+	err := d.primary.QueryRow(ctx, sql, args...).Scan(&id)
 	if err != nil {
 		return "", fmt.Errorf("insert: %w", err)
 	}
@@ -147,7 +383,7 @@ func (d *PgxDB) Exec(ctx context.Context, sql string, args ...any) error {
 		return err
 	}
 
-	_, err := d.pool.Exec(ctx, sql, args...)
+	_, err := d.primary.Exec(ctx, sql, args...)
 	if err != nil {
 		return fmt.Errorf("exec: %w", err)
 	}
@@ -3,8 +3,13 @@ package db
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"testing"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 func TestNew(t *testing.T) {
@@ -52,6 +57,68 @@ func TestNew_CredsError(t *testing.T) {
 	}
 }
 
+func TestInit_RetriesAfterTransientFailure(t *testing.T) {
+	calls := 0
+	d := New(func(ctx context.Context) (map[string]string, error) {
+		calls++
+		if calls == 1 {
+			return nil, fmt.Errorf("secret rotation in progress")
+		}
+		return map[string]string{
+			"host":     "localhost",
+			"port":     "5432",
+			"dbname":   "testdb",
+			"username": "user",
+			"password": "pass",
+		}, nil
+	})
+
+	if err := d.init(context.Background()); err == nil {
+		t.Fatal("expected first init to fail")
+	}
+	if d.Pool() != nil {
+		t.Fatal("expected nil pool after failed init")
+	}
+
+	// pgxpool connects lazily, so the retry succeeds without a live server.
+	if err := d.init(context.Background()); err != nil {
+		t.Fatalf("expected retry to succeed, got: %v", err)
+	}
+	if d.Pool() == nil {
+		t.Fatal("expected pool after successful retry")
+	}
+	if calls != 2 {
+		t.Errorf("credsFn calls = %d, want 2", calls)
+	}
+
+	// Once initialized, the pool is reused without fetching credentials again.
+	if err := d.init(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("credsFn calls = %d after success, want 2", calls)
+	}
+	d.Pool().Close()
+}
+
+func TestInit_CachesConfigError(t *testing.T) {
+	calls := 0
+	d := New(func(ctx context.Context) (map[string]string, error) {
+		calls++
+		return map[string]string{"host": "localhost", "port": "not-a-port"}, nil
+	})
+
+	for i := 0; i < 2; i++ {
+		err := d.init(context.Background())
+		if err == nil || !strings.HasPrefix(err.Error(), "parse pool config") {
+			t.Fatalf("attempt %d: expected parse pool config error, got %v", i+1, err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("credsFn calls = %d, want 1 (config errors are permanent)", calls)
+	}
+}
+
 func TestSerializeValue(t *testing.T) {
 	tests := []struct {
 		name string
@@ -143,3 +210,263 @@ func TestNew_ExecInitError(t *testing.T) {
 		t.Errorf("unexpected error: %v", err)
 	}
 }
+
+// recorder is a querier that records which pool each statement ran against.
+type recorder struct {
+	name  string
+	calls *[]string
+}
+
+var errRecorded = errors.New("recorded")
+
+func (r recorder) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	*r.calls = append(*r.calls, r.name+": "+sql)
+	return nil, errRecorded
+}
+
+func (r recorder) QueryRow(ctx context.Context, sql string, args ...any) pgx.Row {
+	*r.calls = append(*r.calls, r.name+": "+sql)
+	return recordedRow{}
+}
+
+func (r recorder) Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error) {
+	*r.calls = append(*r.calls, r.name+": "+sql)
+	return pgconn.CommandTag{}, nil
+}
+
+type recordedRow struct{}
+
+func (recordedRow) Scan(dest ...any) error {
+	*dest[0].(*any) = "id-1"
+	return nil
+}
+
+func TestRouting(t *testing.T) {
+	creds := func(ctx context.Context) (map[string]string, error) { return nil, nil }
+
+	tests := []struct {
+		name       string
+		withRead   bool
+		forcePrime bool
+		want       []string
+	}{
+		{
+			name:     "replica configured",
+			withRead: true,
+			want:     []string{"replica: SELECT 1", "primary: INSERT", "primary: DELETE"},
+		},
+		{
+			name: "no replica falls back to primary",
+			want: []string{"primary: SELECT 1", "primary: INSERT", "primary: DELETE"},
+		},
+		{
+			name:       "WithPrimary overrides replica",
+			withRead:   true,
+			forcePrime: true,
+			want:       []string{"primary: SELECT 1", "primary: INSERT", "primary: DELETE"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+			d := New(creds)
+			d.primary = recorder{"primary", &calls}
+			if tt.withRead {
+				d.readCredsFn = creds
+				d.replica = recorder{"replica", &calls}
+			}
+
+			ctx := context.Background()
+			if tt.forcePrime {
+				ctx = WithPrimary(ctx)
+			}
+			if _, err := d.Query(ctx, "SELECT 1"); !errors.Is(err, errRecorded) {
+				t.Fatalf("Query error = %v", err)
+			}
+			if id, err := d.Insert(ctx, "INSERT"); err != nil || id != "id-1" {
+				t.Fatalf("Insert = %q, %v", id, err)
+			}
+			if err := d.Exec(ctx, "DELETE"); err != nil {
+				t.Fatalf("Exec error = %v", err)
+			}
+
+			if strings.Join(calls, ", ") != strings.Join(tt.want, ", ") {
+				t.Errorf("calls = %v, want %v", calls, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouting_WritesThroughQuery(t *testing.T) {
+	creds := func(ctx context.Context) (map[string]string, error) { return nil, nil }
+	var calls []string
+	d := NewWithReplica(creds, creds)
+	d.primary = recorder{"primary", &calls}
+	d.replica = recorder{"replica", &calls}
+
+	for _, sql := range []string{
+		"UPDATE upload_batches SET page_count = 2 WHERE id = $1 RETURNING page_count",
+		"WITH gone AS (DELETE FROM aircraft WHERE id = $1 RETURNING 1) SELECT COUNT(*) FROM gone",
+		"insert into upload_pages (id) values ($1) returning id",
+		"SELECT id FROM upload_pages WHERE id = $1 FOR UPDATE",
+		"SELECT id FROM upload_pages WHERE id = $1 FOR NO KEY UPDATE",
+		"SELECT id FROM upload_pages WHERE id = $1 for share",
+		"SELECT id FROM upload_pages WHERE id = $1\n\t FOR KEY SHARE SKIP LOCKED",
+		"SELECT id, updated_at FROM upload_batches WHERE status = 'delete me'",
+	} {
+		calls = nil
+		if _, err := d.Query(context.Background(), sql); !errors.Is(err, errRecorded) {
+			t.Fatalf("Query error = %v", err)
+		}
+		want := "primary: " + sql
+		if strings.Contains(sql, "delete me") {
+			want = "replica: " + sql
+		}
+		if len(calls) != 1 || calls[0] != want {
+			t.Errorf("calls = %v, want %q", calls, want)
+		}
+	}
+}
+
+func TestNewWithReplica_SeparatePools(t *testing.T) {
+	primary := func(ctx context.Context) (map[string]string, error) {
+		return map[string]string{"host": "primary.local", "username": "user", "password": "pass"}, nil
+	}
+	d := NewWithReplica(primary, WithHost(primary, "replica.local"))
+
+	// pgxpool connects lazily, so both pools initialize without a server.
+	if _, err := d.reader(context.Background(), "SELECT 1"); err != nil {
+		t.Fatalf("reader: %v", err)
+	}
+	if d.readPool == nil || d.Pool() != nil {
+		t.Fatal("a read should only initialize the replica pool")
+	}
+	defer d.readPool.Close()
+	if got := d.readPool.Config().ConnConfig.Host; got != "replica.local" {
+		t.Errorf("replica host = %q, want replica.local", got)
+	}
+
+	if err := d.init(context.Background()); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	defer d.Pool().Close()
+	if got := d.Pool().Config().ConnConfig.Host; got != "primary.local" {
+		t.Errorf("primary host = %q, want primary.local", got)
+	}
+}
+
+func TestNewWithReplica_CredsError(t *testing.T) {
+	primary := func(ctx context.Context) (map[string]string, error) {
+		return nil, fmt.Errorf("secret not found")
+	}
+	d := NewWithReplica(primary, WithHost(primary, "replica.local"))
+
+	_, err := d.Query(context.Background(), "SELECT 1")
+	if err == nil || err.Error() != "replica: get db credentials: secret not found" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestPing(t *testing.T) {
+	creds := func(ctx context.Context) (map[string]string, error) { return nil, nil }
+
+	var calls []string
+	d := NewWithReplica(creds, creds)
+	d.primary = recorder{"primary", &calls}
+	d.replica = recorder{"replica", &calls}
+	if err := d.Ping(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := "primary: SELECT 1, replica: SELECT 1"; strings.Join(calls, ", ") != want {
+		t.Errorf("calls = %v, want %s", calls, want)
+	}
+}
+
+func TestPing_CredsError(t *testing.T) {
+	d := New(func(ctx context.Context) (map[string]string, error) {
+		return nil, fmt.Errorf("secret not found")
+	})
+	err := d.Ping(context.Background())
+	if err == nil || err.Error() != "get db credentials: secret not found" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestPing_Unreachable(t *testing.T) {
+	d := New(func(ctx context.Context) (map[string]string, error) {
+		// Port 1 refuses connections immediately.
+		return map[string]string{"host": "127.0.0.1", "port": "1", "username": "user", "password": "pass"}, nil
+	})
+	err := d.Ping(context.Background())
+	if err == nil || !strings.HasPrefix(err.Error(), "ping: ") {
+		t.Errorf("expected ping error, got %v", err)
+	}
+	d.Pool().Close()
+}
+
+func TestWithHost(t *testing.T) {
+	if WithHost(nil, "") != nil {
+		t.Error("empty host should disable the replica")
+	}
+
+	primary := func(ctx context.Context) (map[string]string, error) {
+		return map[string]string{"host": "primary.local", "port": "5433", "username": "user"}, nil
+	}
+	creds, err := WithHost(primary, "replica.local")(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if creds["host"] != "replica.local" || creds["port"] != "5433" || creds["username"] != "user" {
+		t.Errorf("creds = %v", creds)
+	}
+}
+
+func TestIsVectorUnavailable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"sentinel", fmt.Errorf("search: %w", ErrVectorUnavailable), true},
+		{"missing type", fmt.Errorf("query: %w", &pgconn.PgError{Code: "42704", Message: `type "halfvec" does not exist`}), true},
+		{"missing operator", &pgconn.PgError{Code: "42883", Message: "operator does not exist: halfvec <=> halfvec"}, true},
+		{"missing table", &pgconn.PgError{Code: "42P01", Message: `relation "maintenance_embeddings" does not exist`}, true},
+		{"other missing type", &pgconn.PgError{Code: "42704", Message: `type "citext" does not exist`}, false},
+		{"other missing table", &pgconn.PgError{Code: "42P01", Message: `relation "aircraft" does not exist`}, false},
+		{"other pg error", &pgconn.PgError{Code: "23505", Message: "duplicate key value violates unique constraint"}, false},
+		{"plain error", errors.New("halfvec"), false},
+		{"nil", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsVectorUnavailable(tt.err); got != tt.want {
+				t.Errorf("IsVectorUnavailable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// queryDB is a DB whose Query returns fixed results.
+type queryDB struct {
+	DB
+	rows []map[string]any
+	err  error
+}
+
+func (q queryDB) Query(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+	return q.rows, q.err
+}
+
+func TestVectorAvailable(t *testing.T) {
+	ctx := context.Background()
+	if ok, err := VectorAvailable(ctx, queryDB{rows: []map[string]any{{"available": true}}}); !ok || err != nil {
+		t.Errorf("installed: got %v, %v", ok, err)
+	}
+	if ok, err := VectorAvailable(ctx, queryDB{rows: []map[string]any{{"available": false}}}); ok || err != nil {
+		t.Errorf("missing: got %v, %v", ok, err)
+	}
+	if _, err := VectorAvailable(ctx, queryDB{err: errRecorded}); !errors.Is(err, errRecorded) {
+		t.Errorf("query error: got %v", err)
+	}
+}
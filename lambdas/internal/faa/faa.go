@@ -0,0 +1,207 @@
+// Package faa enriches aircraft records with make, model and serial number
+// from the FAA registry service.
+package faa
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/projectcloudline/logbook-service/internal/awsutil"
+	"github.com/projectcloudline/logbook-service/internal/db"
+	"github.com/projectcloudline/logbook-service/internal/identity"
+	"github.com/projectcloudline/logbook-service/internal/models"
+)
+
+const (
+	// DefaultTTL is how long registry data is reused before it is refreshed;
+	// registrations rarely change.
+	DefaultTTL = 7 * 24 * time.Hour
+	// Timeout bounds a whole enrichment.
+	Timeout = 10 * time.Second
+)
+
+// ErrNotRegistered is returned when the registry has no record of the tail
+// number. Retrying will not help.
+var ErrNotRegistered = errors.New("faa: tail number not in registry")
+
+// Message is the SQS body queued for the enrich worker.
+type Message struct {
+	AircraftID string `json:"aircraftId"`
+	TailNumber string `json:"tailNumber"`
+}
+
+// Enricher looks aircraft up in the FAA registry and stores the result.
+type Enricher struct {
+	DB      db.DB
+	Secrets awsutil.SecretsProvider
+	// BaseURL is the registry service root; lookups GET {BaseURL}/registry/{tail}.
+	BaseURL string
+	// SecretARN names the secret holding the registry API key.
+	SecretARN string
+	// TTL skips aircraft enriched more recently than this. Zero uses DefaultTTL.
+	TTL time.Duration
+	// HTTP is the client used for lookups. Nil uses one with a 5s timeout.
+	HTTP *http.Client
+}
+
+// Enrich fills in the aircraft's make, model and serial number from the
+// registry. Aircraft enriched within the TTL are skipped without a lookup.
+func (e *Enricher) Enrich(ctx context.Context, aircraftID, tailNumber string) error {
+	fresh, err := e.fresh(ctx, aircraftID)
+	if err != nil {
+		return err
+	}
+	if fresh {
+		return nil
+	}
+
+	apiKey, err := e.Secrets.GetSecret(ctx, e.SecretARN)
+	if err != nil {
+		return fmt.Errorf("get registry api key: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		fmt.Sprintf("%s/registry/%s", e.BaseURL, tailNumber), nil)
+	if err != nil {
+		return fmt.Errorf("build registry request: %w", err)
+	}
+	req.Header.Set("x-api-key", apiKey)
+
+	resp, err := e.client().Do(req)
+	if err != nil {
+		return fmt.Errorf("registry lookup: %w", err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotRegistered
+	case resp.StatusCode != http.StatusOK:
+		return fmt.Errorf("registry lookup: status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("read registry response: %w", err)
+	}
+	var data map[string]any
+	if err := json.Unmarshal(body, &data); err != nil {
+		return fmt.Errorf("parse registry response: %w", err)
+	}
+
+	if err := e.DB.Exec(ctx,
+		`UPDATE aircraft SET make = $1, model = $2, serial_number = $3,
+		 faa_enriched_at = NOW(), updated_at = NOW() WHERE id = $4`,
+		data["manufacturer"], data["model"], data["serialNumber"], aircraftID,
+	); err != nil {
+		return fmt.Errorf("update aircraft: %w", err)
+	}
+
+	// Entries analyzed before the registry data arrived had nothing to be
+	// checked against. The aircraft is now fresh, so a failure here would
+	// not be retried by enriching again; it is logged instead.
+	registered := identity.Aircraft{
+		SerialNumber: str(data["serialNumber"]),
+		Make:         str(data["manufacturer"]),
+		Model:        str(data["model"]),
+	}
+	if err := e.recheckEntries(ctx, aircraftID, registered); err != nil {
+		log.Printf("WARNING: re-check entry identity for %s: %v", tailNumber, err)
+	}
+	return nil
+}
+
+// recheckEntries flags the aircraft's entries that name a different aircraft
+// than the one registered, and refreshes the review rollup of their upload
+// pages. Entries already flagged are left alone, and no flag is cleared.
+// Entries a person has reviewed are left alone too; auto-approved ones were
+// approved because nothing had flagged them, so they go back to pending.
+func (e *Enricher) recheckEntries(ctx context.Context, aircraftID string, registered identity.Aircraft) error {
+	if registered.SerialNumber == "" {
+		return nil
+	}
+	rows, err := e.DB.Query(db.WithPrimary(ctx),
+		`SELECT id, page_id::text AS page_id, aircraft_serial, aircraft_make, aircraft_model
+		 FROM maintenance_entries
+		 WHERE aircraft_id = $1 AND COALESCE(aircraft_serial, '') <> ''
+		   AND NOT ($2 = ANY(COALESCE(missing_data, '{}')))
+		   AND (review_status = 'pending' OR reviewed_by = $3)`,
+		aircraftID, identity.MismatchTag, models.AutoApproveActor)
+	if err != nil {
+		return fmt.Errorf("list entries: %w", err)
+	}
+
+	flagged := 0
+	var pageIDs []string
+	seen := make(map[string]bool)
+	for _, row := range rows {
+		note := identity.Mismatch(identity.Aircraft{
+			SerialNumber: str(row["aircraft_serial"]),
+			Make:         str(row["aircraft_make"]),
+			Model:        str(row["aircraft_model"]),
+		}, registered)
+		if note == "" {
+			continue
+		}
+		if err := e.DB.Exec(ctx,
+			`UPDATE maintenance_entries
+			 SET needs_review = TRUE, review_status = 'pending',
+			     reviewed_by = NULL, reviewed_at = NULL,
+			     extraction_notes = COALESCE(extraction_notes, '') || $2,
+			     missing_data = array_append(COALESCE(missing_data, '{}'), $3),
+			     updated_at = NOW()
+			 WHERE id = $1 AND (review_status = 'pending' OR reviewed_by = $4)`,
+			row["id"], note, identity.MismatchTag, models.AutoApproveActor); err != nil {
+			return fmt.Errorf("flag entry %v: %w", row["id"], err)
+		}
+		flagged++
+		if pageID := str(row["page_id"]); pageID != "" && !seen[pageID] {
+			seen[pageID] = true
+			pageIDs = append(pageIDs, pageID)
+		}
+	}
+	if flagged > 0 {
+		log.Printf("Flagged %d of %d entries for aircraft %s as naming another aircraft", flagged, len(rows), aircraftID)
+	}
+	for _, pageID := range pageIDs {
+		if err := models.RefreshPageReview(ctx, e.DB, pageID); err != nil {
+			return fmt.Errorf("refresh review of page %s: %w", pageID, err)
+		}
+	}
+	return nil
+}
+
+func str(v any) string {
+	s, _ := v.(string)
+	return s
+}
+
+// fresh reports whether the aircraft was enriched within the TTL.
+func (e *Enricher) fresh(ctx context.Context, aircraftID string) (bool, error) {
+	ttl := e.TTL
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	rows, err := e.DB.Query(db.WithPrimary(ctx),
+		"SELECT faa_enriched_at FROM aircraft WHERE id = $1", aircraftID)
+	if err != nil {
+		return false, fmt.Errorf("check enrichment age: %w", err)
+	}
+	if len(rows) == 0 {
+		return false, nil
+	}
+	at, ok := rows[0]["faa_enriched_at"].(time.Time)
+	return ok && time.Since(at) < ttl, nil
+}
+
+func (e *Enricher) client() *http.Client {
+	if e.HTTP != nil {
+		return e.HTTP
+	}
+	return &http.Client{Timeout: 5 * time.Second}
+}
@@ -0,0 +1,258 @@
+package faa
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/projectcloudline/logbook-service/internal/models"
+)
+
+type mockDB struct {
+	enrichedAt any
+	updates    [][]any
+	// entries are returned when the aircraft's entries are listed.
+	entries    []map[string]any
+	entryQuery []any
+	flagged    [][]any
+	flagSQL    string
+	// pageNotes are the notes of each page's flagged entries.
+	pageNotes   map[string][]string
+	pageReviews [][]any
+}
+
+func (m *mockDB) Query(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+	if strings.Contains(sql, "faa_enriched_at") {
+		return []map[string]any{{"faa_enriched_at": m.enrichedAt}}, nil
+	}
+	if strings.Contains(sql, "WHERE page_id = $1") {
+		var rows []map[string]any
+		for _, n := range m.pageNotes[args[0].(string)] {
+			rows = append(rows, map[string]any{"extraction_notes": n})
+		}
+		return rows, nil
+	}
+	if strings.Contains(sql, "FROM maintenance_entries") {
+		m.entryQuery = args
+		if !strings.Contains(sql, "review_status = 'pending' OR reviewed_by = $3") {
+			return m.entries, nil
+		}
+		var rows []map[string]any
+		for _, e := range m.entries {
+			if e["review_status"] == "pending" || e["reviewed_by"] == args[2] {
+				rows = append(rows, e)
+			}
+		}
+		return rows, nil
+	}
+	return nil, nil
+}
+
+func (m *mockDB) Insert(ctx context.Context, sql string, args ...any) (string, error) {
+	return "", nil
+}
+
+func (m *mockDB) Exec(ctx context.Context, sql string, args ...any) error {
+	if strings.Contains(sql, "UPDATE aircraft") {
+		m.updates = append(m.updates, args)
+	}
+	if strings.Contains(sql, "UPDATE maintenance_entries") {
+		m.flagged = append(m.flagged, args)
+		m.flagSQL = sql
+	}
+	if strings.Contains(sql, "UPDATE upload_pages") {
+		m.pageReviews = append(m.pageReviews, args)
+	}
+	return nil
+}
+
+func (m *mockDB) Ping(ctx context.Context) error { return nil }
+
+func (m *mockDB) Pool() *pgxpool.Pool { return nil }
+
+type mockSecrets map[string]string
+
+func (m mockSecrets) GetSecret(ctx context.Context, arn string) (string, error) {
+	if v, ok := m[arn]; ok {
+		return v, nil
+	}
+	return "", fmt.Errorf("secret not found: %s", arn)
+}
+
+func (m mockSecrets) GetSecretJSON(ctx context.Context, arn string) (map[string]string, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func TestEnrich(t *testing.T) {
+	tests := []struct {
+		name       string
+		enrichedAt any
+		ttl        time.Duration
+		status     int
+		wantFetch  bool
+		wantUpdate bool
+		wantErr    error
+	}{
+		{name: "never enriched", enrichedAt: nil, status: 200, wantFetch: true, wantUpdate: true},
+		{name: "within default TTL", enrichedAt: time.Now().Add(-time.Hour), status: 200},
+		{name: "stale", enrichedAt: time.Now().Add(-30 * 24 * time.Hour), status: 200, wantFetch: true, wantUpdate: true},
+		{name: "stale under custom TTL", enrichedAt: time.Now().Add(-2 * time.Hour), ttl: time.Hour, status: 200, wantFetch: true, wantUpdate: true},
+		{name: "not registered", status: 404, wantFetch: true, wantErr: ErrNotRegistered},
+		{name: "registry error", status: 503, wantFetch: true, wantErr: errors.New("registry lookup: status 503")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var fetched []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fetched = append(fetched, r.URL.Path+" "+r.Header.Get("x-api-key"))
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, `{"manufacturer":"CESSNA","model":"172S","serialNumber":"172S1234"}`)
+			}))
+			defer srv.Close()
+
+			db := &mockDB{enrichedAt: tt.enrichedAt}
+			e := &Enricher{
+				DB:        db,
+				Secrets:   mockSecrets{"faa-secret": "test-api-key"},
+				BaseURL:   srv.URL,
+				SecretARN: "faa-secret",
+				TTL:       tt.ttl,
+			}
+
+			err := e.Enrich(context.Background(), "aid-1", "N123")
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.wantErr != nil && (err == nil || (!errors.Is(err, tt.wantErr) && err.Error() != tt.wantErr.Error())):
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantFetch != (len(fetched) == 1) {
+				t.Fatalf("fetched = %v, want fetch %v", fetched, tt.wantFetch)
+			}
+			if tt.wantFetch && fetched[0] != "/registry/N123 test-api-key" {
+				t.Errorf("fetched %q", fetched[0])
+			}
+			if !tt.wantUpdate {
+				if len(db.updates) != 0 {
+					t.Errorf("unexpected update %v", db.updates)
+				}
+				return
+			}
+			if len(db.updates) != 1 {
+				t.Fatalf("updates = %v", db.updates)
+			}
+			if got := fmt.Sprint(db.updates[0]); got != "[CESSNA 172S 172S1234 aid-1]" {
+				t.Errorf("update args = %s", got)
+			}
+		})
+	}
+}
+
+func TestEnrich_SecretError(t *testing.T) {
+	e := &Enricher{DB: &mockDB{}, Secrets: mockSecrets{}, SecretARN: "missing"}
+	if err := e.Enrich(context.Background(), "aid-1", "N123"); err == nil {
+		t.Fatal("expected error when the API key is unavailable")
+	}
+}
+
+func TestEnrich_RechecksEntries(t *testing.T) {
+	tests := []struct {
+		name        string
+		registry    string
+		wantFlagged []string
+		wantPages   []string
+	}{
+		{
+			name:        "conflicting entries are flagged",
+			registry:    `{"manufacturer":"CESSNA","model":"172S","serialNumber":"172S1234"}`,
+			wantFlagged: []string{"entry-other-serial", "entry-other-type", "entry-auto-approved"},
+			wantPages: []string{
+				"page-1 Date unclear; Aircraft identity mismatch: serial \"17299999\" != \"172S1234\"",
+			},
+		},
+		{
+			name:     "no registered serial",
+			registry: `{"manufacturer":"CESSNA","model":"172S"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, tt.registry)
+			}))
+			defer srv.Close()
+
+			// The entries were analyzed before the aircraft had a serial
+			// number, so none of them was checked.
+			db := &mockDB{entries: []map[string]any{
+				{"id": "entry-match", "page_id": "page-1", "aircraft_serial": "172S-1234", "aircraft_make": "Cessna", "aircraft_model": "172", "review_status": "pending"},
+				{"id": "entry-other-serial", "page_id": "page-1", "aircraft_serial": "17299999", "aircraft_make": nil, "aircraft_model": nil, "review_status": "pending"},
+				{"id": "entry-other-type", "page_id": nil, "aircraft_serial": "172S1234", "aircraft_make": "Piper", "aircraft_model": "Cherokee", "review_status": "pending"},
+				// Someone approved this one as it stands; it isn't reopened.
+				{"id": "entry-approved", "page_id": nil, "aircraft_serial": "17288888", "aircraft_make": nil, "aircraft_model": nil,
+					"review_status": "approved", "reviewed_by": "jane@example.com"},
+				// Approved only because nothing had flagged it yet.
+				{"id": "entry-auto-approved", "page_id": nil, "aircraft_serial": "17277777", "aircraft_make": nil, "aircraft_model": nil,
+					"review_status": "approved", "reviewed_by": models.AutoApproveActor},
+			}, pageNotes: map[string][]string{
+				"page-1": {"Date unclear.", "Aircraft identity mismatch: serial \"17299999\" != \"172S1234\""},
+			}}
+			e := &Enricher{
+				DB:        db,
+				Secrets:   mockSecrets{"faa-secret": "test-api-key"},
+				BaseURL:   srv.URL,
+				SecretARN: "faa-secret",
+			}
+
+			if err := e.Enrich(context.Background(), "aid-1", "N123"); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if tt.wantFlagged == nil {
+				if db.entryQuery != nil || len(db.flagged) != 0 {
+					t.Errorf("entries re-checked without a registered serial: %v", db.flagged)
+				}
+				if len(db.pageReviews) != 0 {
+					t.Errorf("page reviews refreshed without a registered serial: %v", db.pageReviews)
+				}
+				return
+			}
+			if fmt.Sprint(db.entryQuery) != "[aid-1 aircraft_identity_mismatch "+models.AutoApproveActor+"]" {
+				t.Errorf("entry query args = %v", db.entryQuery)
+			}
+			if !strings.Contains(db.flagSQL, "review_status = 'pending'") || !strings.Contains(db.flagSQL, "reviewed_by = NULL") {
+				t.Errorf("flagged entries not returned to pending review:\n%s", db.flagSQL)
+			}
+			var flagged []string
+			for _, args := range db.flagged {
+				flagged = append(flagged, args[0].(string))
+				if note := args[1].(string); !strings.HasPrefix(note, "Aircraft identity mismatch: ") {
+					t.Errorf("note = %q", note)
+				}
+				if args[2] != "aircraft_identity_mismatch" {
+					t.Errorf("missing_data tag = %v", args[2])
+				}
+			}
+			if strings.Join(flagged, ",") != strings.Join(tt.wantFlagged, ",") {
+				t.Errorf("flagged %v, want %v", flagged, tt.wantFlagged)
+			}
+			var pages []string
+			for _, args := range db.pageReviews {
+				pages = append(pages, fmt.Sprintf("%v %v", args[0], args[1]))
+			}
+			if strings.Join(pages, "\n") != strings.Join(tt.wantPages, "\n") {
+				t.Errorf("page reviews %q, want %q", pages, tt.wantPages)
+			}
+		})
+	}
+}
@@ -11,7 +11,16 @@ import (
 // Client defines operations for interacting with Gemini models.
 type Client interface {
 	GenerateContent(ctx context.Context, model string, parts []Part, config *GenerateConfig) (string, error)
+	// GenerateContentStream generates content like GenerateContent but hands
+	// the text to yield chunk by chunk as the model produces it. An error
+	// from yield stops the stream and is returned.
+	GenerateContentStream(ctx context.Context, model string, parts []Part, config *GenerateConfig, yield func(text string) error) error
 	EmbedContent(ctx context.Context, model string, text string) ([]float32, error)
+	// BatchEmbedContent embeds several texts in one request, returning one
+	// embedding per text in order.
+	BatchEmbedContent(ctx context.Context, model string, texts []string) ([][]float32, error)
+	// CountTokens returns how many input tokens parts amount to for model.
+	CountTokens(ctx context.Context, model string, parts []Part) (int, error)
 }
 
 // Part represents a content part for Gemini requests.
@@ -21,10 +30,45 @@ type Part struct {
 	MIMEType string
 }
 
-// GenerateConfig holds configuration for content generation.
+// GenerateConfig holds configuration for content generation. Nil sampling
+// fields use the model's defaults.
 type GenerateConfig struct {
 	Temperature      *float32
+	TopP             *float32
+	TopK             *int32
 	ResponseMIMEType string
+	// ResponseSchema constrains the response to JSON of this shape. It
+	// needs ResponseMIMEType "application/json".
+	ResponseSchema *Schema
+}
+
+// Type is a Schema value type.
+type Type string
+
+const (
+	TypeString  Type = "STRING"
+	TypeNumber  Type = "NUMBER"
+	TypeInteger Type = "INTEGER"
+	TypeBoolean Type = "BOOLEAN"
+	TypeArray   Type = "ARRAY"
+	TypeObject  Type = "OBJECT"
+)
+
+// Schema describes a JSON value, in the subset of OpenAPI Gemini accepts
+// for structured output.
+type Schema struct {
+	Type        Type
+	Description string
+	// Enum lists the allowed values of a string.
+	Enum     []string
+	Nullable bool
+	// Items is the schema of an array's elements.
+	Items *Schema
+	// Properties are an object's fields. The model writes them in
+	// PropertyOrdering order, or alphabetically when it is empty.
+	Properties       map[string]*Schema
+	PropertyOrdering []string
+	Required         []string
 }
 
 type geminiClient struct {
@@ -43,7 +87,8 @@ func New(ctx context.Context, apiKey string) (Client, error) {
 	return &geminiClient{client: client}, nil
 }
 
-func (c *geminiClient) GenerateContent(ctx context.Context, model string, parts []Part, config *GenerateConfig) (string, error) {
+// toGenaiParts converts parts to SDK parts, dropping empty ones.
+func toGenaiParts(parts []Part) []*genai.Part {
 	var genaiParts []*genai.Part
 	for _, p := range parts {
 		if p.Text != "" {
@@ -52,31 +97,112 @@ func (c *geminiClient) GenerateContent(ctx context.Context, model string, parts
 			genaiParts = append(genaiParts, genai.NewPartFromBytes(p.Data, p.MIMEType))
 		}
 	}
+	return genaiParts
+}
 
-	var genConfig *genai.GenerateContentConfig
-	if config != nil {
-		genConfig = &genai.GenerateContentConfig{}
-		if config.Temperature != nil {
-			genConfig.Temperature = genai.Ptr(float32(*config.Temperature))
-		}
-		if config.ResponseMIMEType != "" {
-			genConfig.ResponseMIMEType = config.ResponseMIMEType
+// toGenaiConfig converts config to the SDK's generation config.
+func toGenaiConfig(config *GenerateConfig) *genai.GenerateContentConfig {
+	if config == nil {
+		return nil
+	}
+	genConfig := &genai.GenerateContentConfig{}
+	if config.Temperature != nil {
+		genConfig.Temperature = genai.Ptr(float32(*config.Temperature))
+	}
+	if config.TopP != nil {
+		genConfig.TopP = genai.Ptr(*config.TopP)
+	}
+	if config.TopK != nil {
+		genConfig.TopK = genai.Ptr(float32(*config.TopK))
+	}
+	if config.ResponseMIMEType != "" {
+		genConfig.ResponseMIMEType = config.ResponseMIMEType
+	}
+	genConfig.ResponseSchema = toGenaiSchema(config.ResponseSchema)
+	return genConfig
+}
+
+// toGenaiSchema converts s to the SDK's schema.
+func toGenaiSchema(s *Schema) *genai.Schema {
+	if s == nil {
+		return nil
+	}
+	out := &genai.Schema{
+		Type:             genai.Type(s.Type),
+		Description:      s.Description,
+		Enum:             s.Enum,
+		Items:            toGenaiSchema(s.Items),
+		PropertyOrdering: s.PropertyOrdering,
+		Required:         s.Required,
+	}
+	if s.Nullable {
+		out.Nullable = genai.Ptr(true)
+	}
+	if len(s.Properties) > 0 {
+		out.Properties = make(map[string]*genai.Schema, len(s.Properties))
+		for name, p := range s.Properties {
+			out.Properties[name] = toGenaiSchema(p)
 		}
 	}
+	return out
+}
 
+func (c *geminiClient) GenerateContent(ctx context.Context, model string, parts []Part, config *GenerateConfig) (string, error) {
 	resp, err := c.client.Models.GenerateContent(ctx, model, []*genai.Content{
-		genai.NewContentFromParts(genaiParts, "user"),
-	}, genConfig)
+		genai.NewContentFromParts(toGenaiParts(parts), "user"),
+	}, toGenaiConfig(config))
 	if err != nil {
 		return "", fmt.Errorf("generate content: %w", err)
 	}
+	if resp != nil {
+		addUsage(ctx, metadataUsage(resp.UsageMetadata))
+	}
+	return responseText(resp), nil
+}
+
+func (c *geminiClient) GenerateContentStream(ctx context.Context, model string, parts []Part, config *GenerateConfig, yield func(text string) error) error {
+	stream := c.client.Models.GenerateContentStream(ctx, model, []*genai.Content{
+		genai.NewContentFromParts(toGenaiParts(parts), "user"),
+	}, toGenaiConfig(config))
+	// Each chunk's usage is the running total, so only the last counts.
+	var usage *genai.GenerateContentResponseUsageMetadata
+	defer func() { addUsage(ctx, metadataUsage(usage)) }()
+	for resp, err := range stream {
+		if err != nil {
+			return fmt.Errorf("generate content stream: %w", err)
+		}
+		if resp != nil && resp.UsageMetadata != nil {
+			usage = resp.UsageMetadata
+		}
+		if text := responseText(resp); text != "" {
+			if err := yield(text); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
 
+// responseText returns the text of the first candidate's first part, or ""
+// when the response has none.
+func responseText(resp *genai.GenerateContentResponse) string {
 	if resp == nil || len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil || len(resp.Candidates[0].Content.Parts) == 0 {
-		return "", nil
+		return ""
 	}
+	return resp.Candidates[0].Content.Parts[0].Text
+}
 
-	text := resp.Candidates[0].Content.Parts[0].Text
-	return text, nil
+func (c *geminiClient) CountTokens(ctx context.Context, model string, parts []Part) (int, error) {
+	resp, err := c.client.Models.CountTokens(ctx, model, []*genai.Content{
+		genai.NewContentFromParts(toGenaiParts(parts), "user"),
+	}, nil)
+	if err != nil {
+		return 0, fmt.Errorf("count tokens: %w", err)
+	}
+	if resp == nil {
+		return 0, nil
+	}
+	return int(resp.TotalTokens), nil
 }
 
 func (c *geminiClient) EmbedContent(ctx context.Context, model string, text string) ([]float32, error) {
@@ -93,3 +219,34 @@ func (c *geminiClient) EmbedContent(ctx context.Context, model string, text stri
 
 	return resp.Embeddings[0].Values, nil
 }
+
+func (c *geminiClient) BatchEmbedContent(ctx context.Context, model string, texts []string) ([][]float32, error) {
+	contents := make([]*genai.Content, len(texts))
+	for i, text := range texts {
+		contents[i] = genai.NewContentFromText(text, "user")
+	}
+	resp, err := c.client.Models.EmbedContent(ctx, model, contents, nil)
+	if err != nil {
+		return nil, fmt.Errorf("batch embed content: %w", err)
+	}
+
+	if resp == nil || len(resp.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("batch embed: got %d embeddings for %d texts", embeddingCount(resp), len(texts))
+	}
+
+	embeddings := make([][]float32, len(resp.Embeddings))
+	for i, e := range resp.Embeddings {
+		if e == nil || len(e.Values) == 0 {
+			return nil, fmt.Errorf("empty embedding for text %d", i)
+		}
+		embeddings[i] = e.Values
+	}
+	return embeddings, nil
+}
+
+func embeddingCount(resp *genai.EmbedContentResponse) int {
+	if resp == nil {
+		return 0
+	}
+	return len(resp.Embeddings)
+}
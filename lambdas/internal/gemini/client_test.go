@@ -3,6 +3,8 @@ package gemini
 import (
 	"context"
 	"testing"
+
+	"google.golang.org/genai"
 )
 
 func TestMockClient_GenerateContent(t *testing.T) {
@@ -103,4 +105,75 @@ func TestMockClient_NoFunctions(t *testing.T) {
 	if len(embedding) != 3 {
 		t.Errorf("expected default embedding of length 3, got %d", len(embedding))
 	}
+
+	// CountTokens with nil function should count nothing
+	tokens, err := mock.CountTokens(context.Background(), "model", []Part{{Text: "text"}})
+	if err != nil || tokens != 0 {
+		t.Errorf("CountTokens = (%d, %v), want (0, nil)", tokens, err)
+	}
+}
+
+func TestMockClient_GenerateContentStream(t *testing.T) {
+	mock := &MockClient{
+		GenerateContentFn: func(ctx context.Context, model string, parts []Part, config *GenerateConfig) (string, error) {
+			return "whole answer", nil
+		},
+	}
+
+	// Without a stream function the GenerateContent text comes as one chunk
+	var chunks []string
+	err := mock.GenerateContentStream(context.Background(), "model", []Part{{Text: "q"}}, nil, func(text string) error {
+		chunks = append(chunks, text)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(chunks) != 1 || chunks[0] != "whole answer" {
+		t.Errorf("chunks = %q, want [\"whole answer\"]", chunks)
+	}
+}
+
+func TestToGenaiConfig_ResponseSchema(t *testing.T) {
+	schema := &Schema{
+		Type:             TypeObject,
+		Properties:       map[string]*Schema{"name": {Type: TypeString, Nullable: true}, "kind": {Type: TypeString, Enum: []string{"a", "b"}}},
+		PropertyOrdering: []string{"name", "kind"},
+		Required:         []string{"kind"},
+	}
+	got := toGenaiConfig(&GenerateConfig{ResponseMIMEType: "application/json", ResponseSchema: schema}).ResponseSchema
+	if got == nil {
+		t.Fatal("ResponseSchema not passed through")
+	}
+	if got.Type != genai.TypeObject || len(got.Required) != 1 || len(got.PropertyOrdering) != 2 {
+		t.Errorf("object schema = %+v", got)
+	}
+	if name := got.Properties["name"]; name == nil || name.Nullable == nil || !*name.Nullable {
+		t.Errorf("name property = %+v, want a nullable string", name)
+	}
+	if kind := got.Properties["kind"]; kind == nil || kind.Nullable != nil || len(kind.Enum) != 2 {
+		t.Errorf("kind property = %+v, want a non-nullable enum", kind)
+	}
+
+	if toGenaiConfig(&GenerateConfig{}).ResponseSchema != nil {
+		t.Error("ResponseSchema set without one configured")
+	}
+}
+
+func TestWithUsage(t *testing.T) {
+	var u Usage
+	ctx := WithUsage(context.Background(), &u)
+	addUsage(ctx, metadataUsage(&genai.GenerateContentResponseUsageMetadata{
+		PromptTokenCount:     genai.Ptr[int32](1000),
+		CandidatesTokenCount: genai.Ptr[int32](50),
+		TotalTokenCount:      1050,
+	}))
+	addUsage(ctx, metadataUsage(&genai.GenerateContentResponseUsageMetadata{PromptTokenCount: genai.Ptr[int32](10)}))
+	addUsage(ctx, metadataUsage(nil))
+	if want := (Usage{PromptTokens: 1010, CandidatesTokens: 50}); u != want {
+		t.Errorf("usage = %+v, want %+v", u, want)
+	}
+
+	// Without WithUsage there is nowhere to add to.
+	addUsage(context.Background(), Usage{PromptTokens: 1})
 }
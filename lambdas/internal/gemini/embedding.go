@@ -0,0 +1,116 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultEmbeddingModel is used when no embedding model is configured.
+	DefaultEmbeddingModel = "gemini-embedding-001"
+	// DefaultEmbeddingDimensions matches the halfvec(3072) column that
+	// maintenance_embeddings stores vectors in.
+	DefaultEmbeddingDimensions = 3072
+)
+
+// ErrEmbeddingDimensions is returned when a model's embedding length doesn't
+// match the configured dimension. Storing or comparing such a vector against
+// the halfvec column would fail, or worse, silently compare unlike spaces.
+var ErrEmbeddingDimensions = errors.New("embedding dimension mismatch")
+
+// EmbeddingConfig selects the embedding model and the vector size it must
+// produce. Changing the dimension also requires migrating the stored vectors.
+type EmbeddingConfig struct {
+	// Model is the embedding model name. Empty uses DefaultEmbeddingModel.
+	Model string
+	// Dimensions is the expected vector length. Zero uses
+	// DefaultEmbeddingDimensions.
+	Dimensions int
+}
+
+// EmbeddingConfigFromEnv reads EMBEDDING_MODEL and EMBEDDING_DIMENSIONS.
+// Unset or invalid values use the defaults.
+func EmbeddingConfigFromEnv() EmbeddingConfig {
+	cfg := EmbeddingConfig{Model: os.Getenv("EMBEDDING_MODEL")}
+	if raw := os.Getenv("EMBEDDING_DIMENSIONS"); raw != "" {
+		v, err := strconv.Atoi(raw)
+		if err != nil || v <= 0 {
+			log.Printf("WARNING: ignoring invalid EMBEDDING_DIMENSIONS %q", raw)
+		} else {
+			cfg.Dimensions = v
+		}
+	}
+	return cfg
+}
+
+// ModelName returns the configured model or the default.
+func (c EmbeddingConfig) ModelName() string {
+	if c.Model == "" {
+		return DefaultEmbeddingModel
+	}
+	return c.Model
+}
+
+// ExpectedDimensions returns the configured dimension or the default.
+func (c EmbeddingConfig) ExpectedDimensions() int {
+	if c.Dimensions <= 0 {
+		return DefaultEmbeddingDimensions
+	}
+	return c.Dimensions
+}
+
+// Embed embeds text with the configured model and checks the vector length.
+// A mismatch returns an error wrapping ErrEmbeddingDimensions.
+func (c EmbeddingConfig) Embed(ctx context.Context, client Client, text string) ([]float32, error) {
+	model := c.ModelName()
+	embedding, err := client.EmbedContent(ctx, model, text)
+	if err != nil {
+		return nil, err
+	}
+	if want := c.ExpectedDimensions(); len(embedding) != want {
+		return nil, fmt.Errorf("%w: %s returned %d dimensions, want %d",
+			ErrEmbeddingDimensions, model, len(embedding), want)
+	}
+	return embedding, nil
+}
+
+// BatchEmbed embeds texts in one request with the configured model and checks
+// every vector's length.
+func (c EmbeddingConfig) BatchEmbed(ctx context.Context, client Client, texts []string) ([][]float32, error) {
+	model := c.ModelName()
+	embeddings, err := client.BatchEmbedContent(ctx, model, texts)
+	if err != nil {
+		return nil, err
+	}
+	if len(embeddings) != len(texts) {
+		return nil, fmt.Errorf("%s returned %d embeddings for %d texts", model, len(embeddings), len(texts))
+	}
+	want := c.ExpectedDimensions()
+	for i, e := range embeddings {
+		if len(e) != want {
+			return nil, fmt.Errorf("%w: %s returned %d dimensions for text %d, want %d",
+				ErrEmbeddingDimensions, model, len(e), i, want)
+		}
+	}
+	return embeddings, nil
+}
+
+// FormatEmbedding renders embedding as a pgvector literal, "[0.1,0.2,0.3]",
+// for binding to a vector or halfvec parameter.
+func FormatEmbedding(embedding []float32) string {
+	var b strings.Builder
+	b.WriteByte('[')
+	for i, v := range embedding {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%g", v)
+	}
+	b.WriteByte(']')
+	return b.String()
+}
@@ -0,0 +1,126 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestEmbeddingConfig_Embed(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    EmbeddingConfig
+		returned  int
+		wantModel string
+		wantErr   bool
+	}{
+		{name: "defaults", returned: DefaultEmbeddingDimensions, wantModel: DefaultEmbeddingModel},
+		{name: "configured", config: EmbeddingConfig{Model: "custom-embed", Dimensions: 768}, returned: 768, wantModel: "custom-embed"},
+		{name: "too short", config: EmbeddingConfig{Model: "custom-embed"}, returned: 768, wantModel: "custom-embed", wantErr: true},
+		{name: "too long", config: EmbeddingConfig{Dimensions: 768}, returned: 3072, wantModel: DefaultEmbeddingModel, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotModel string
+			client := &MockClient{
+				EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
+					gotModel = model
+					return make([]float32, tt.returned), nil
+				},
+			}
+
+			embedding, err := tt.config.Embed(context.Background(), client, "text")
+			if gotModel != tt.wantModel {
+				t.Errorf("model = %q, want %q", gotModel, tt.wantModel)
+			}
+			if tt.wantErr {
+				if !errors.Is(err, ErrEmbeddingDimensions) || embedding != nil {
+					t.Errorf("Embed = %d dims, %v; want ErrEmbeddingDimensions", len(embedding), err)
+				}
+				return
+			}
+			if err != nil || len(embedding) != tt.returned {
+				t.Errorf("Embed = %d dims, %v", len(embedding), err)
+			}
+		})
+	}
+}
+
+func TestEmbeddingConfig_EmbedError(t *testing.T) {
+	client := &MockClient{
+		EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
+			return nil, errors.New("quota exceeded")
+		},
+	}
+	if _, err := (EmbeddingConfig{}).Embed(context.Background(), client, "text"); err == nil || errors.Is(err, ErrEmbeddingDimensions) {
+		t.Errorf("err = %v, want the client error", err)
+	}
+}
+
+func TestEmbeddingConfig_BatchEmbed(t *testing.T) {
+	tests := []struct {
+		name    string
+		dims    []int
+		wantErr error
+	}{
+		{name: "all vectors match", dims: []int{768, 768}},
+		{name: "one vector short", dims: []int{768, 512}, wantErr: ErrEmbeddingDimensions},
+		{name: "missing vector", dims: []int{768}, wantErr: errors.New("count")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &MockClient{
+				BatchEmbedContentFn: func(ctx context.Context, model string, texts []string) ([][]float32, error) {
+					out := make([][]float32, len(tt.dims))
+					for i, d := range tt.dims {
+						out[i] = make([]float32, d)
+					}
+					return out, nil
+				},
+			}
+
+			config := EmbeddingConfig{Model: "custom-embed", Dimensions: 768}
+			embeddings, err := config.BatchEmbed(context.Background(), client, []string{"a", "b"})
+			switch {
+			case tt.wantErr == nil && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tt.wantErr == nil && len(embeddings) != 2:
+				t.Errorf("embeddings = %d, want 2", len(embeddings))
+			case tt.wantErr == ErrEmbeddingDimensions && !errors.Is(err, ErrEmbeddingDimensions):
+				t.Errorf("err = %v, want ErrEmbeddingDimensions", err)
+			case tt.wantErr != nil && err == nil:
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
+
+func TestEmbeddingConfigFromEnv(t *testing.T) {
+	tests := []struct {
+		name, model, dims string
+		want              EmbeddingConfig
+	}{
+		{name: "unset"},
+		{name: "configured", model: "custom-embed", dims: "768", want: EmbeddingConfig{Model: "custom-embed", Dimensions: 768}},
+		{name: "invalid dimensions", dims: "-1"},
+		{name: "non-numeric dimensions", dims: "big"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("EMBEDDING_MODEL", tt.model)
+			t.Setenv("EMBEDDING_DIMENSIONS", tt.dims)
+			if got := EmbeddingConfigFromEnv(); got != tt.want {
+				t.Errorf("EmbeddingConfigFromEnv() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatEmbedding(t *testing.T) {
+	result := FormatEmbedding([]float32{0.1, 0.2, 0.3})
+	if result != "[0.1,0.2,0.3]" {
+		t.Errorf("got %q, want %q", result, "[0.1,0.2,0.3]")
+	}
+}
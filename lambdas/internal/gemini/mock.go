@@ -4,15 +4,44 @@ import "context"
 
 // MockClient implements the Client interface for testing.
 type MockClient struct {
-	GenerateContentFn func(ctx context.Context, model string, parts []Part, config *GenerateConfig) (string, error)
-	EmbedContentFn    func(ctx context.Context, model string, text string) ([]float32, error)
+	GenerateContentFn       func(ctx context.Context, model string, parts []Part, config *GenerateConfig) (string, error)
+	GenerateContentStreamFn func(ctx context.Context, model string, parts []Part, config *GenerateConfig, yield func(text string) error) error
+	EmbedContentFn          func(ctx context.Context, model string, text string) ([]float32, error)
+	BatchEmbedContentFn     func(ctx context.Context, model string, texts []string) ([][]float32, error)
+	CountTokensFn           func(ctx context.Context, model string, parts []Part) (int, error)
+	// UsageFn, when set, gives the usage each successful GenerateContent
+	// reports to a ctx from WithUsage.
+	UsageFn func(parts []Part, text string) Usage
 }
 
 func (m *MockClient) GenerateContent(ctx context.Context, model string, parts []Part, config *GenerateConfig) (string, error) {
+	var text string
 	if m.GenerateContentFn != nil {
-		return m.GenerateContentFn(ctx, model, parts, config)
+		var err error
+		if text, err = m.GenerateContentFn(ctx, model, parts, config); err != nil {
+			return text, err
+		}
 	}
-	return "", nil
+	if m.UsageFn != nil {
+		addUsage(ctx, m.UsageFn(parts, text))
+	}
+	return text, nil
+}
+
+// GenerateContentStream defaults to yielding the whole of GenerateContent's
+// text as a single chunk.
+func (m *MockClient) GenerateContentStream(ctx context.Context, model string, parts []Part, config *GenerateConfig, yield func(text string) error) error {
+	if m.GenerateContentStreamFn != nil {
+		return m.GenerateContentStreamFn(ctx, model, parts, config, yield)
+	}
+	text, err := m.GenerateContent(ctx, model, parts, config)
+	if err != nil {
+		return err
+	}
+	if text == "" {
+		return nil
+	}
+	return yield(text)
 }
 
 func (m *MockClient) EmbedContent(ctx context.Context, model string, text string) ([]float32, error) {
@@ -21,3 +50,27 @@ func (m *MockClient) EmbedContent(ctx context.Context, model string, text string
 	}
 	return []float32{0.1, 0.2, 0.3}, nil
 }
+
+// BatchEmbedContent defaults to calling EmbedContent for each text.
+func (m *MockClient) BatchEmbedContent(ctx context.Context, model string, texts []string) ([][]float32, error) {
+	if m.BatchEmbedContentFn != nil {
+		return m.BatchEmbedContentFn(ctx, model, texts)
+	}
+	embeddings := make([][]float32, len(texts))
+	for i, text := range texts {
+		e, err := m.EmbedContent(ctx, model, text)
+		if err != nil {
+			return nil, err
+		}
+		embeddings[i] = e
+	}
+	return embeddings, nil
+}
+
+// CountTokens defaults to zero tokens.
+func (m *MockClient) CountTokens(ctx context.Context, model string, parts []Part) (int, error) {
+	if m.CountTokensFn != nil {
+		return m.CountTokensFn(ctx, model, parts)
+	}
+	return 0, nil
+}
@@ -0,0 +1,72 @@
+package gemini
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+)
+
+// WithTimeout returns a Client that gives each call on c at most d, so a
+// hung connection fails that call with context.DeadlineExceeded instead of
+// holding the caller until its own deadline. A d of zero or less returns c
+// unchanged.
+func WithTimeout(c Client, d time.Duration) Client {
+	if d <= 0 {
+		return c
+	}
+	return &timeoutClient{client: c, timeout: d}
+}
+
+// CallTimeoutFromEnv parses LLM_CALL_TIMEOUT as a Go duration ("90s",
+// "2m"), the most any one model call may take; the Lambdas give their Claude
+// calls the same bound. Unset or invalid values return zero, leaving calls
+// bounded only by the invocation deadline.
+func CallTimeoutFromEnv() time.Duration {
+	raw := os.Getenv("LLM_CALL_TIMEOUT")
+	if raw == "" {
+		return 0
+	}
+	v, err := time.ParseDuration(raw)
+	if err != nil || v <= 0 {
+		log.Printf("WARNING: ignoring invalid LLM_CALL_TIMEOUT %q", raw)
+		return 0
+	}
+	return v
+}
+
+type timeoutClient struct {
+	client  Client
+	timeout time.Duration
+}
+
+func (c *timeoutClient) GenerateContent(ctx context.Context, model string, parts []Part, config *GenerateConfig) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.client.GenerateContent(ctx, model, parts, config)
+}
+
+// GenerateContentStream bounds the whole stream, not each chunk.
+func (c *timeoutClient) GenerateContentStream(ctx context.Context, model string, parts []Part, config *GenerateConfig, yield func(text string) error) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.client.GenerateContentStream(ctx, model, parts, config, yield)
+}
+
+func (c *timeoutClient) EmbedContent(ctx context.Context, model string, text string) ([]float32, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.client.EmbedContent(ctx, model, text)
+}
+
+func (c *timeoutClient) BatchEmbedContent(ctx context.Context, model string, texts []string) ([][]float32, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.client.BatchEmbedContent(ctx, model, texts)
+}
+
+func (c *timeoutClient) CountTokens(ctx context.Context, model string, parts []Part) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.client.CountTokens(ctx, model, parts)
+}
@@ -0,0 +1,110 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// blockUntilDone waits for ctx to end, failing the test if no deadline
+// arrives in time.
+func blockUntilDone(t *testing.T, ctx context.Context) error {
+	t.Helper()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(5 * time.Second):
+		t.Error("call was not cancelled")
+		return errors.New("not cancelled")
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	mock := &MockClient{
+		GenerateContentFn: func(ctx context.Context, model string, parts []Part, config *GenerateConfig) (string, error) {
+			return "", blockUntilDone(t, ctx)
+		},
+		EmbedContentFn: func(ctx context.Context, model string, text string) ([]float32, error) {
+			return nil, blockUntilDone(t, ctx)
+		},
+		BatchEmbedContentFn: func(ctx context.Context, model string, texts []string) ([][]float32, error) {
+			return nil, blockUntilDone(t, ctx)
+		},
+		CountTokensFn: func(ctx context.Context, model string, parts []Part) (int, error) {
+			return 0, blockUntilDone(t, ctx)
+		},
+	}
+	c := WithTimeout(mock, 10*time.Millisecond)
+	ctx := context.Background()
+
+	calls := map[string]func() error{
+		"GenerateContent": func() error {
+			_, err := c.GenerateContent(ctx, "m", nil, nil)
+			return err
+		},
+		"GenerateContentStream": func() error {
+			return c.GenerateContentStream(ctx, "m", nil, nil, func(string) error { return nil })
+		},
+		"EmbedContent": func() error {
+			_, err := c.EmbedContent(ctx, "m", "text")
+			return err
+		},
+		"BatchEmbedContent": func() error {
+			_, err := c.BatchEmbedContent(ctx, "m", []string{"text"})
+			return err
+		},
+		"CountTokens": func() error {
+			_, err := c.CountTokens(ctx, "m", nil)
+			return err
+		},
+	}
+	for name, call := range calls {
+		t.Run(name, func(t *testing.T) {
+			if err := call(); !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("error = %v, want context.DeadlineExceeded", err)
+			}
+		})
+	}
+}
+
+func TestWithTimeout_Disabled(t *testing.T) {
+	mock := &MockClient{}
+	if c := WithTimeout(mock, 0); c != Client(mock) {
+		t.Errorf("WithTimeout(c, 0) = %T, want c itself", c)
+	}
+}
+
+func TestWithTimeout_FastCall(t *testing.T) {
+	mock := &MockClient{
+		GenerateContentFn: func(ctx context.Context, model string, parts []Part, config *GenerateConfig) (string, error) {
+			if _, ok := ctx.Deadline(); !ok {
+				t.Error("call has no deadline")
+			}
+			return "ok", nil
+		},
+	}
+	got, err := WithTimeout(mock, time.Minute).GenerateContent(context.Background(), "m", nil, nil)
+	if err != nil || got != "ok" {
+		t.Errorf("GenerateContent = (%q, %v), want (\"ok\", nil)", got, err)
+	}
+}
+
+func TestCallTimeoutFromEnv(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want time.Duration
+	}{
+		{"", 0},
+		{"90s", 90 * time.Second},
+		{"2m", 2 * time.Minute},
+		{"90", 0},
+		{"-5s", 0},
+	}
+	for _, tt := range tests {
+		t.Setenv("LLM_CALL_TIMEOUT", tt.raw)
+		if got := CallTimeoutFromEnv(); got != tt.want {
+			t.Errorf("LLM_CALL_TIMEOUT=%q: got %v, want %v", tt.raw, got, tt.want)
+		}
+	}
+}
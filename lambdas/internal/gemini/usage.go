@@ -0,0 +1,44 @@
+package gemini
+
+import (
+	"context"
+
+	"google.golang.org/genai"
+)
+
+// Usage is the token count a generation response reports.
+type Usage struct {
+	PromptTokens     int
+	CandidatesTokens int
+}
+
+type usageKey struct{}
+
+// WithUsage returns a ctx under which GenerateContent and
+// GenerateContentStream add the tokens their responses report to u.
+func WithUsage(ctx context.Context, u *Usage) context.Context {
+	return context.WithValue(ctx, usageKey{}, u)
+}
+
+// addUsage adds got to the Usage on ctx, if there is one.
+func addUsage(ctx context.Context, got Usage) {
+	if u, _ := ctx.Value(usageKey{}).(*Usage); u != nil {
+		u.PromptTokens += got.PromptTokens
+		u.CandidatesTokens += got.CandidatesTokens
+	}
+}
+
+// metadataUsage returns the counts md reports; a nil md or count is zero.
+func metadataUsage(md *genai.GenerateContentResponseUsageMetadata) Usage {
+	var u Usage
+	if md == nil {
+		return u
+	}
+	if md.PromptTokenCount != nil {
+		u.PromptTokens = int(*md.PromptTokenCount)
+	}
+	if md.CandidatesTokenCount != nil {
+		u.CandidatesTokens = int(*md.CandidatesTokenCount)
+	}
+	return u
+}
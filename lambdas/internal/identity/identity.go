@@ -0,0 +1,71 @@
+// Package identity compares the aircraft a logbook entry names with the
+// aircraft record it was uploaded under, as filled in from the FAA registry.
+package identity
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MismatchTag is recorded in an entry's missing_data when it names another
+// aircraft.
+const MismatchTag = "aircraft_identity_mismatch"
+
+// Aircraft is the identifying data of an aircraft, either as written in an
+// entry or as registered.
+type Aircraft struct {
+	SerialNumber string
+	Make         string
+	Model        string
+}
+
+// Mismatch returns a note explaining why the aircraft an entry names is not
+// the expected one, or "" when it matches or there is no serial number on
+// either side to compare.
+func Mismatch(entry, expected Aircraft) string {
+	if expected.SerialNumber == "" {
+		return "" // No FAA data to compare against
+	}
+	if entry.SerialNumber == "" {
+		return "" // Gemini didn't extract a serial
+	}
+
+	serialMatch := normalize(entry.SerialNumber) == normalize(expected.SerialNumber)
+
+	makeMatch := true
+	modelMatch := true
+	if entry.Make != "" && expected.Make != "" {
+		makeMatch = fuzzyMatch(entry.Make, expected.Make)
+	}
+	if entry.Model != "" && expected.Model != "" {
+		modelMatch = fuzzyMatch(entry.Model, expected.Model)
+	}
+
+	if serialMatch && (makeMatch || modelMatch) {
+		return ""
+	}
+	var reasons []string
+	if !serialMatch {
+		reasons = append(reasons, fmt.Sprintf("serial %q != %q", entry.SerialNumber, expected.SerialNumber))
+	}
+	if !makeMatch {
+		reasons = append(reasons, fmt.Sprintf("make %q !~ %q", entry.Make, expected.Make))
+	}
+	if !modelMatch {
+		reasons = append(reasons, fmt.Sprintf("model %q !~ %q", entry.Model, expected.Model))
+	}
+	return fmt.Sprintf("Aircraft identity mismatch: %s", strings.Join(reasons, ", "))
+}
+
+func normalize(s string) string {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	s = strings.ReplaceAll(s, "-", "")
+	s = strings.ReplaceAll(s, " ", "")
+	return s
+}
+
+func fuzzyMatch(extracted, expected string) bool {
+	a := normalize(extracted)
+	b := normalize(expected)
+	return strings.Contains(a, b) || strings.Contains(b, a)
+}
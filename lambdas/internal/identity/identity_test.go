@@ -0,0 +1,85 @@
+package identity
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMismatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		entry    Aircraft
+		expected Aircraft
+		want     string
+	}{
+		{name: "no expected serial", entry: Aircraft{SerialNumber: "12345"}},
+		{name: "no entry serial", expected: Aircraft{SerialNumber: "12345"}},
+		{name: "serial matches", entry: Aircraft{SerialNumber: "172-84765"}, expected: Aircraft{SerialNumber: "17284765"}},
+		{
+			name:     "serial differs",
+			entry:    Aircraft{SerialNumber: "99999"},
+			expected: Aircraft{SerialNumber: "12345"},
+			want:     `serial "99999" != "12345"`,
+		},
+		{
+			name:     "make and model both differ",
+			entry:    Aircraft{SerialNumber: "12345", Make: "Piper", Model: "Cherokee"},
+			expected: Aircraft{SerialNumber: "12345", Make: "Cessna", Model: "172N"},
+			want:     `make "Piper" !~ "Cessna", model "Cherokee" !~ "172N"`,
+		},
+		{
+			name:     "make matches",
+			entry:    Aircraft{SerialNumber: "12345", Make: "CESSNA", Model: "182"},
+			expected: Aircraft{SerialNumber: "12345", Make: "Cessna", Model: "172N"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Mismatch(tt.entry, tt.expected)
+			if tt.want == "" {
+				if got != "" {
+					t.Errorf("Mismatch = %q, want none", got)
+				}
+				return
+			}
+			if !strings.HasPrefix(got, "Aircraft identity mismatch: ") || !strings.HasSuffix(got, tt.want) {
+				t.Errorf("Mismatch = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"N-123AB", "N123AB"},
+		{"cessna 172", "CESSNA172"},
+		{"  hello  ", "HELLO"},
+	}
+	for _, tt := range tests {
+		got := normalize(tt.in)
+		if got != tt.want {
+			t.Errorf("normalize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"Cessna", "CESSNA", true},
+		{"172N", "172", true},
+		{"Piper", "Cessna", false},
+	}
+	for _, tt := range tests {
+		got := fuzzyMatch(tt.a, tt.b)
+		if got != tt.want {
+			t.Errorf("fuzzyMatch(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package imageutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+)
+
+// ErrImageTooLarge is returned by DecodeBounded when an image has more
+// pixels than the budget allows.
+var ErrImageTooLarge = errors.New("image too large")
+
+// DecodeBounded decodes data if it holds at most maxPixels pixels. The
+// dimensions are read from the header with image.DecodeConfig first, so a
+// larger image is rejected with ErrImageTooLarge before any pixel data is
+// decoded and the budget bounds what is ever held in memory. maxPixels <= 0
+// disables the guard.
+func DecodeBounded(data []byte, maxPixels int) (image.Image, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode image config: %w", err)
+	}
+	if pixels := cfg.Width * cfg.Height; maxPixels > 0 && pixels > maxPixels {
+		return nil, fmt.Errorf("%w: %dx%d (%.1f MP) exceeds the %.1f MP limit",
+			ErrImageTooLarge, cfg.Width, cfg.Height, megapixels(pixels), megapixels(maxPixels))
+	}
+	return Decode(bytes.NewReader(data))
+}
+
+func megapixels(n int) float64 {
+	return float64(n) / 1e6
+}
@@ -0,0 +1,71 @@
+package imageutil
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// pngHeader returns a PNG signature and IHDR chunk for a w×h RGBA image with
+// no pixel data. DecodeConfig accepts it; a full decode would fail.
+func pngHeader(w, h uint32) []byte {
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:4], w)
+	binary.BigEndian.PutUint32(ihdr[4:8], h)
+	ihdr[8] = 8 // bit depth
+	ihdr[9] = 6 // color type: RGBA
+
+	buf := []byte("\x89PNG\r\n\x1a\n")
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(ihdr)))
+	chunk := append([]byte("IHDR"), ihdr...)
+	buf = append(buf, chunk...)
+	return binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(chunk))
+}
+
+func TestDecodeBounded_RejectsFromHeader(t *testing.T) {
+	data := pngHeader(60000, 40000)
+
+	_, err := DecodeBounded(data, 24_000_000)
+	if !errors.Is(err, ErrImageTooLarge) {
+		t.Fatalf("expected ErrImageTooLarge, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "60000x40000") {
+		t.Errorf("error %q does not name the dimensions", err)
+	}
+}
+
+func TestDecodeBounded_OverBudget(t *testing.T) {
+	var buf bytes.Buffer
+	png.Encode(&buf, makeImage(200, 100))
+
+	// Even slightly over the budget is rejected rather than decoded.
+	if _, err := DecodeBounded(buf.Bytes(), 19_999); !errors.Is(err, ErrImageTooLarge) {
+		t.Errorf("expected ErrImageTooLarge, got %v", err)
+	}
+}
+
+func TestDecodeBounded_WithinBudget(t *testing.T) {
+	var buf bytes.Buffer
+	png.Encode(&buf, makeImage(200, 100))
+
+	for _, budget := range []int{0, 20000, 1_000_000} {
+		img, err := DecodeBounded(buf.Bytes(), budget)
+		if err != nil {
+			t.Fatalf("budget %d: unexpected error: %v", budget, err)
+		}
+		if b := img.Bounds(); b.Dx() != 200 || b.Dy() != 100 {
+			t.Errorf("budget %d: size = %dx%d, want 200x100", budget, b.Dx(), b.Dy())
+		}
+	}
+}
+
+func TestDecodeBounded_InvalidImage(t *testing.T) {
+	_, err := DecodeBounded([]byte("not an image"), 1000)
+	if err == nil || errors.Is(err, ErrImageTooLarge) {
+		t.Errorf("expected decode error, got %v", err)
+	}
+}
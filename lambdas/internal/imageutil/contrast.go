@@ -0,0 +1,74 @@
+package imageutil
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+)
+
+// contrastClip is the fraction of pixels clipped at each end of the histogram
+// before stretching, so a few specks of pure black or glare don't pin the range.
+const contrastClip = 0.01
+
+// StretchContrast converts img to grayscale and linearly stretches its luma
+// histogram so the darkest and brightest contrastClip of pixels map to 0 and
+// 255. Faint pencil on yellowed paper becomes dark strokes on white.
+func StretchContrast(img image.Image) *image.Gray {
+	b := img.Bounds()
+	gray := image.NewGray(image.Rect(0, 0, b.Dx(), b.Dy()))
+	var hist [256]int
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			l := color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y
+			gray.Pix[(y-b.Min.Y)*gray.Stride+(x-b.Min.X)] = l
+			hist[l]++
+		}
+	}
+
+	total := b.Dx() * b.Dy()
+	clip := int(float64(total) * contrastClip)
+	lo, hi := 0, 255
+	for n := 0; lo < 255; lo++ {
+		if n += hist[lo]; n > clip {
+			break
+		}
+	}
+	for n := 0; hi > 0; hi-- {
+		if n += hist[hi]; n > clip {
+			break
+		}
+	}
+	if hi <= lo {
+		return gray // flat image — nothing to stretch
+	}
+
+	var lut [256]uint8
+	for i := range lut {
+		switch {
+		case i <= lo:
+			lut[i] = 0
+		case i >= hi:
+			lut[i] = 255
+		default:
+			lut[i] = uint8((i - lo) * 255 / (hi - lo))
+		}
+	}
+	for i, v := range gray.Pix {
+		gray.Pix[i] = lut[v]
+	}
+	return gray
+}
+
+// ContrastJPEG decodes imageBytes, applies StretchContrast and re-encodes the
+// result as JPEG.
+func ContrastJPEG(imageBytes []byte, quality int) ([]byte, error) {
+	img, err := Decode(bytes.NewReader(imageBytes))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := EncodeJPEG(&buf, StretchContrast(img), quality); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,88 @@
+package imageutil
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// faintPage is yellowed paper (luma ~200) with faint pencil strokes (~150).
+func faintPage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{R: 225, G: 205, B: 150, A: 255}
+			if y%10 < 3 && x%4 != 0 {
+				c = color.RGBA{R: 160, G: 150, B: 140, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func lumaRange(img image.Image) (lo, hi uint8) {
+	lo, hi = 255, 0
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			l := color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y
+			lo, hi = min(lo, l), max(hi, l)
+		}
+	}
+	return lo, hi
+}
+
+func TestStretchContrast(t *testing.T) {
+	src := faintPage(80, 60)
+	srcLo, srcHi := lumaRange(src)
+	if srcHi-srcLo > 60 {
+		t.Fatalf("test image range %d–%d is not low contrast", srcLo, srcHi)
+	}
+
+	out := StretchContrast(src)
+	if out.Bounds().Dx() != 80 || out.Bounds().Dy() != 60 {
+		t.Fatalf("size = %v, want 80x60", out.Bounds().Size())
+	}
+	if lo, hi := lumaRange(out); lo != 0 || hi != 255 {
+		t.Errorf("stretched range = %d–%d, want 0–255", lo, hi)
+	}
+}
+
+func TestStretchContrast_FlatImage(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 10, 10))
+	for i := range img.Pix {
+		img.Pix[i] = 180
+	}
+	out := StretchContrast(img)
+	if lo, hi := lumaRange(out); lo != 180 || hi != 180 {
+		t.Errorf("flat image changed to %d–%d", lo, hi)
+	}
+}
+
+func TestContrastJPEG(t *testing.T) {
+	var src bytes.Buffer
+	png.Encode(&src, faintPage(80, 60))
+
+	out, err := ContrastJPEG(src.Bytes(), 90)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(out))
+	if err != nil {
+		t.Fatalf("output is not a valid JPEG: %v", err)
+	}
+	if img.Bounds().Dx() != 80 || img.Bounds().Dy() != 60 {
+		t.Errorf("size = %v, want 80x60", img.Bounds().Size())
+	}
+	if _, ok := img.(*image.Gray); !ok {
+		t.Errorf("decoded %T, want grayscale", img)
+	}
+
+	if _, err := ContrastJPEG([]byte("not an image"), 90); err == nil {
+		t.Error("expected decode error")
+	}
+}
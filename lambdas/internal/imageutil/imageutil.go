@@ -0,0 +1,99 @@
+// Package imageutil provides the image decode, resize and encode helpers
+// shared by the Lambdas and the slicer.
+package imageutil
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"os"
+
+	_ "golang.org/x/image/bmp"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// Decode decodes any image format registered with the standard library or
+// golang.org/x/image (JPEG, PNG, GIF, BMP, TIFF, WebP). HEIC is not supported
+// in pure Go and must be converted first.
+func Decode(r io.Reader) (image.Image, error) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return nil, fmt.Errorf("decode image: %w", err)
+	}
+	return img, nil
+}
+
+// EncodeJPEG encodes img as JPEG at the given quality.
+func EncodeJPEG(w io.Writer, img image.Image, quality int) error {
+	if err := jpeg.Encode(w, img, &jpeg.Options{Quality: quality}); err != nil {
+		return fmt.Errorf("encode jpeg: %w", err)
+	}
+	return nil
+}
+
+// ConvertFileToJPEG decodes the image at inPath and writes it to outPath as JPEG.
+func ConvertFileToJPEG(inPath, outPath string, quality int) error {
+	in, err := os.Open(inPath)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", inPath, err)
+	}
+	defer in.Close()
+
+	img, err := Decode(in)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(outPath)
+	if err != nil {
+		return fmt.Errorf("create output: %w", err)
+	}
+	if err := EncodeJPEG(out, img, quality); err != nil {
+		out.Close()
+		os.Remove(outPath)
+		return err
+	}
+	return out.Close()
+}
+
+// Thumbnail scales img down so its longest side is at most maxDim pixels,
+// preserving aspect ratio. Images already within bounds are returned as-is.
+func Thumbnail(img image.Image, maxDim int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= maxDim && h <= maxDim {
+		return img
+	}
+
+	if w >= h {
+		h = max(1, h*maxDim/w)
+		w = maxDim
+	} else {
+		w = max(1, w*maxDim/h)
+		h = maxDim
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.ApproxBiLinear.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+// JPEGThumbnail decodes imageBytes and returns a JPEG thumbnail whose longest
+// side is at most maxDim pixels.
+func JPEGThumbnail(imageBytes []byte, maxDim, quality int) ([]byte, error) {
+	img, err := Decode(bytes.NewReader(imageBytes))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := EncodeJPEG(&buf, Thumbnail(img, maxDim), quality); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,105 @@
+package imageutil
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func makeImage(w, h int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+	return img
+}
+
+func TestThumbnail(t *testing.T) {
+	tests := []struct {
+		name         string
+		w, h, maxDim int
+		wantW, wantH int
+	}{
+		{"portrait page", 1700, 2200, 400, 309, 400},
+		{"landscape", 2200, 1100, 400, 400, 200},
+		{"already small", 200, 100, 400, 200, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Thumbnail(makeImage(tt.w, tt.h), tt.maxDim).Bounds()
+			if got.Dx() != tt.wantW || got.Dy() != tt.wantH {
+				t.Errorf("size = %dx%d, want %dx%d", got.Dx(), got.Dy(), tt.wantW, tt.wantH)
+			}
+		})
+	}
+}
+
+func TestJPEGThumbnail(t *testing.T) {
+	var src bytes.Buffer
+	if err := png.Encode(&src, makeImage(800, 1000)); err != nil {
+		t.Fatal(err)
+	}
+
+	thumb, err := JPEGThumbnail(src.Bytes(), 100, 80)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	img, err := jpeg.Decode(bytes.NewReader(thumb))
+	if err != nil {
+		t.Fatalf("thumbnail is not a valid JPEG: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != 80 || b.Dy() != 100 {
+		t.Errorf("size = %dx%d, want 80x100", b.Dx(), b.Dy())
+	}
+}
+
+func TestJPEGThumbnail_InvalidImage(t *testing.T) {
+	if _, err := JPEGThumbnail([]byte("not an image"), 100, 80); err == nil {
+		t.Fatal("expected decode error")
+	}
+}
+
+func TestConvertFileToJPEG(t *testing.T) {
+	dir := t.TempDir()
+	in := filepath.Join(dir, "page.png")
+	out := filepath.Join(dir, "page.jpg")
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, makeImage(50, 40)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(in, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ConvertFileToJPEG(in, out, 90); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(data)); err != nil {
+		t.Errorf("output is not a valid JPEG: %v", err)
+	}
+}
+
+func TestConvertFileToJPEG_Errors(t *testing.T) {
+	dir := t.TempDir()
+	if err := ConvertFileToJPEG(filepath.Join(dir, "missing.png"), filepath.Join(dir, "out.jpg"), 90); err == nil {
+		t.Error("expected error for missing input")
+	}
+
+	bad := filepath.Join(dir, "bad.gif")
+	os.WriteFile(bad, []byte("garbage"), 0o644)
+	if err := ConvertFileToJPEG(bad, filepath.Join(dir, "out.jpg"), 90); err == nil {
+		t.Error("expected error for undecodable input")
+	}
+}
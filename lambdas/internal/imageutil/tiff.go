@@ -0,0 +1,122 @@
+package imageutil
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+
+	"golang.org/x/image/tiff"
+)
+
+// maxTIFFFrames bounds the IFD chain walk so a corrupt or looping file can't
+// run away.
+const maxTIFFFrames = 1000
+
+// EachTIFFFrame decodes the pages of a (possibly multi-page) TIFF one at a
+// time, calling fn with each page's number (from 1), the page count and the
+// decoded frame. Only one decoded frame is held at once, so fn should finish
+// with the frame before returning. An error from fn, or a frame that won't
+// decode, stops the walk; the frames before it have already been handed to
+// fn.
+//
+// golang.org/x/image/tiff only decodes the first image directory (IFD), so
+// each later frame is decoded by pointing the header at its IFD instead.
+func EachTIFFFrame(data []byte, fn func(page, total int, img image.Image) error) error {
+	offsets, err := tiffIFDOffsets(data)
+	if err != nil {
+		return err
+	}
+	order, _ := tiffByteOrder(data)
+
+	for i, off := range offsets {
+		r := &tiffFrameReader{data: data}
+		copy(r.header[:], data[:8])
+		order.PutUint32(r.header[4:8], off)
+
+		img, err := tiff.Decode(r)
+		if err != nil {
+			return fmt.Errorf("decode tiff frame %d: %w", i+1, err)
+		}
+		if err := fn(i+1, len(offsets), img); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tiffIFDOffsets walks the IFD chain and returns the offset of each directory.
+func tiffIFDOffsets(data []byte) ([]uint32, error) {
+	if len(data) < 8 {
+		return nil, errors.New("tiff: file too short")
+	}
+	order, err := tiffByteOrder(data)
+	if err != nil {
+		return nil, err
+	}
+	if order.Uint16(data[2:4]) != 42 {
+		return nil, errors.New("tiff: unsupported version (BigTIFF is not supported)")
+	}
+
+	var offsets []uint32
+	seen := make(map[uint32]bool)
+	for off := order.Uint32(data[4:8]); off != 0; {
+		if seen[off] || len(offsets) >= maxTIFFFrames {
+			return nil, errors.New("tiff: invalid IFD chain")
+		}
+		seen[off] = true
+		if int64(off)+2 > int64(len(data)) {
+			return nil, fmt.Errorf("tiff: IFD offset %d out of range", off)
+		}
+		n := int64(order.Uint16(data[off : off+2]))
+		next := int64(off) + 2 + 12*n
+		if next+4 > int64(len(data)) {
+			return nil, fmt.Errorf("tiff: IFD at %d is truncated", off)
+		}
+		offsets = append(offsets, off)
+		off = order.Uint32(data[next : next+4])
+	}
+	if len(offsets) == 0 {
+		return nil, errors.New("tiff: no image directories")
+	}
+	return offsets, nil
+}
+
+func tiffByteOrder(data []byte) (binary.ByteOrder, error) {
+	switch string(data[:2]) {
+	case "II":
+		return binary.LittleEndian, nil
+	case "MM":
+		return binary.BigEndian, nil
+	}
+	return nil, errors.New("tiff: invalid byte order mark")
+}
+
+// tiffFrameReader serves data with its 8-byte header replaced, so the first
+// IFD offset points at the frame to decode.
+type tiffFrameReader struct {
+	data   []byte
+	header [8]byte
+	pos    int64
+}
+
+func (r *tiffFrameReader) ReadAt(p []byte, off int64) (int, error) {
+	if off >= int64(len(r.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, r.data[off:])
+	if off < int64(len(r.header)) {
+		copy(p, r.header[off:])
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (r *tiffFrameReader) Read(p []byte) (int, error) {
+	n, err := r.ReadAt(p, r.pos)
+	r.pos += int64(n)
+	return n, err
+}
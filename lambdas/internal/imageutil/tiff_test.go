@@ -0,0 +1,160 @@
+package imageutil
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"testing"
+)
+
+// encodeTestTIFF writes an uncompressed little-endian grayscale TIFF with one
+// IFD per frame.
+func encodeTestTIFF(frames ...*image.Gray) []byte {
+	le := binary.LittleEndian
+	buf := []byte{'I', 'I', 42, 0, 0, 0, 0, 0}
+	nextPtr := 4 // where to write the offset of the next IFD
+
+	for _, f := range frames {
+		w, h := f.Bounds().Dx(), f.Bounds().Dy()
+		pixOff := len(buf)
+		for y := 0; y < h; y++ {
+			buf = append(buf, f.Pix[y*f.Stride:y*f.Stride+w]...)
+		}
+		if len(buf)%2 == 1 {
+			buf = append(buf, 0)
+		}
+
+		le.PutUint32(buf[nextPtr:], uint32(len(buf)))
+		entries := [][3]uint32{ // tag, type (3=SHORT, 4=LONG), value
+			{256, 4, uint32(w)},
+			{257, 4, uint32(h)},
+			{258, 3, 8},
+			{259, 3, 1},
+			{262, 3, 1},
+			{273, 4, uint32(pixOff)},
+			{277, 3, 1},
+			{278, 4, uint32(h)},
+			{279, 4, uint32(w * h)},
+		}
+		buf = le.AppendUint16(buf, uint16(len(entries)))
+		for _, e := range entries {
+			buf = le.AppendUint16(buf, uint16(e[0]))
+			buf = le.AppendUint16(buf, uint16(e[1]))
+			buf = le.AppendUint32(buf, 1)
+			buf = le.AppendUint32(buf, e[2])
+		}
+		nextPtr = len(buf)
+		buf = le.AppendUint32(buf, 0)
+	}
+	return buf
+}
+
+func grayFrame(w, h int, shade uint8) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = shade
+	}
+	return img
+}
+
+func TestEachTIFFFrame(t *testing.T) {
+	data := encodeTestTIFF(grayFrame(30, 20, 10), grayFrame(16, 40, 200), grayFrame(5, 5, 99))
+
+	var frames []image.Image
+	err := EachTIFFFrame(data, func(page, total int, img image.Image) error {
+		if page != len(frames)+1 || total != 3 {
+			t.Errorf("called with page %d of %d after %d frames", page, total, len(frames))
+		}
+		frames = append(frames, img)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(frames) != 3 {
+		t.Fatalf("got %d frames, want 3", len(frames))
+	}
+
+	want := []struct {
+		w, h  int
+		shade uint8
+	}{{30, 20, 10}, {16, 40, 200}, {5, 5, 99}}
+	for i, f := range frames {
+		b := f.Bounds()
+		if b.Dx() != want[i].w || b.Dy() != want[i].h {
+			t.Errorf("frame %d size = %dx%d, want %dx%d", i, b.Dx(), b.Dy(), want[i].w, want[i].h)
+		}
+		r, _, _, _ := f.At(b.Min.X, b.Min.Y).RGBA()
+		if uint8(r>>8) != want[i].shade {
+			t.Errorf("frame %d shade = %d, want %d", i, r>>8, want[i].shade)
+		}
+	}
+}
+
+func TestEachTIFFFrame_Stops(t *testing.T) {
+	data := encodeTestTIFF(grayFrame(4, 4, 10), grayFrame(4, 4, 20), grayFrame(4, 4, 30))
+	corruptTIFFFrame(data, 2)
+
+	// A frame that won't decode stops the walk after the good ones.
+	var pages []int
+	err := EachTIFFFrame(data, func(page, total int, img image.Image) error {
+		pages = append(pages, page)
+		return nil
+	})
+	if err == nil || len(pages) != 1 || pages[0] != 1 {
+		t.Errorf("pages = %v, err = %v; want page 1 then an error", pages, err)
+	}
+
+	// So does an error from fn, which is returned as is.
+	stop := errors.New("stop")
+	pages = nil
+	err = EachTIFFFrame(encodeTestTIFF(grayFrame(4, 4, 10), grayFrame(4, 4, 20)), func(page, total int, img image.Image) error {
+		pages = append(pages, page)
+		return stop
+	})
+	if !errors.Is(err, stop) || len(pages) != 1 {
+		t.Errorf("pages = %v, err = %v; want page 1 then %v", pages, err, stop)
+	}
+}
+
+// corruptTIFFFrame points the strip offset of the given frame (from 1) past
+// the end of data, so that frame fails to decode.
+func corruptTIFFFrame(data []byte, frame int) {
+	le := binary.LittleEndian
+	off := le.Uint32(data[4:8])
+	for range frame - 1 {
+		n := uint32(le.Uint16(data[off:]))
+		off = le.Uint32(data[off+2+12*n:])
+	}
+	n := uint32(le.Uint16(data[off:]))
+	for e := off + 2; e < off+2+12*n; e += 12 {
+		if le.Uint16(data[e:]) == 273 {
+			le.PutUint32(data[e+8:], uint32(len(data))+1000)
+		}
+	}
+}
+
+func TestEachTIFFFrame_Errors(t *testing.T) {
+	looping := encodeTestTIFF(grayFrame(2, 2, 0))
+	// Point the IFD's next-offset back at itself.
+	ifd := binary.LittleEndian.Uint32(looping[4:8])
+	binary.LittleEndian.PutUint32(looping[len(looping)-4:], ifd)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"too short", []byte("II*")},
+		{"bad byte order", []byte("XX*\x00\x08\x00\x00\x00")},
+		{"no directories", []byte("II*\x00\x00\x00\x00\x00")},
+		{"offset out of range", []byte("II*\x00\xff\x00\x00\x00")},
+		{"looping chain", looping},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := EachTIFFFrame(tt.data, func(int, int, image.Image) error { return nil }); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
@@ -2,10 +2,14 @@
 package models
 
 import (
+	"encoding/base64"
 	"encoding/json"
-	"fmt"
+	"log"
 	"math"
+	"mime"
+	"os"
 	"strconv"
+	"strings"
 
 	"github.com/aws/aws-lambda-go/events"
 )
@@ -16,30 +20,117 @@ const (
 )
 
 // APIResponse builds a standard API Gateway Lambda proxy response with CORS headers.
+// The Access-Control-Allow-Origin header is only set when the allowlist is a
+// wildcard; use APIResponseWithOrigin to echo back a specific request origin.
 func APIResponse(statusCode int, body any) (events.APIGatewayProxyResponse, error) {
+	return APIResponseWithOrigin(statusCode, body, "")
+}
+
+// APIResponseWithOrigin builds an API response whose CORS headers are resolved
+// against the request's Origin header and the CORS_ALLOWED_ORIGINS allowlist.
+func APIResponseWithOrigin(statusCode int, body any, origin string) (events.APIGatewayProxyResponse, error) {
 	b, err := json.Marshal(body)
 	if err != nil {
+		log.Printf("ERROR: json marshal response: %v", err)
 		return events.APIGatewayProxyResponse{
 			StatusCode: 500,
-			Headers:    corsHeaders(),
-			Body:       fmt.Sprintf(`{"error":"json marshal: %s"}`, err.Error()),
+			Headers:    responseHeaders(origin),
+			Body:       `{"error":{"code":"INTERNAL_ERROR","message":"Internal server error"}}`,
 		}, nil
 	}
 
 	return events.APIGatewayProxyResponse{
 		StatusCode: statusCode,
-		Headers:    corsHeaders(),
+		Headers:    responseHeaders(origin),
 		Body:       string(b),
 	}, nil
 }
 
-func corsHeaders() map[string]string {
-	return map[string]string{
-		"Content-Type":                "application/json",
-		"Access-Control-Allow-Origin": "*",
+// BinaryResponse builds a non-JSON response for a file download. The body is
+// base64-encoded, as API Gateway expects for binary media types; it decodes
+// it for clients whose Accept header matches one the API is configured with.
+// filename, when set, is offered as an attachment via Content-Disposition.
+func BinaryResponse(statusCode int, contentType, filename string, body []byte) events.APIGatewayProxyResponse {
+	headers := CORSHeaders("")
+	headers["Content-Type"] = contentType
+	if filename != "" {
+		headers["Content-Disposition"] = mime.FormatMediaType("attachment", map[string]string{"filename": filename})
+	}
+	return events.APIGatewayProxyResponse{
+		StatusCode:      statusCode,
+		Headers:         headers,
+		Body:            base64.StdEncoding.EncodeToString(body),
+		IsBase64Encoded: true,
+	}
+}
+
+func responseHeaders(origin string) map[string]string {
+	headers := CORSHeaders(origin)
+	headers["Content-Type"] = "application/json"
+	return headers
+}
+
+const (
+	corsAllowMethods = "GET,POST,PATCH,DELETE,OPTIONS"
+	corsAllowHeaders = "Content-Type,X-Api-Key,Authorization"
+	corsMaxAge       = "86400"
+)
+
+// CORSHeaders returns the CORS headers for a request from origin.
+//
+// CORS_ALLOWED_ORIGINS is a comma-separated allowlist. When it is unset or
+// contains "*", every origin is allowed via a wildcard. Otherwise the request
+// origin is echoed back only if it is on the list; a disallowed origin gets no
+// Access-Control-Allow-Origin header, so the browser blocks the response.
+func CORSHeaders(origin string) map[string]string {
+	headers := map[string]string{}
+
+	allowed := allowedOrigins()
+	switch {
+	case allowed == nil || allowed["*"]:
+		headers["Access-Control-Allow-Origin"] = "*"
+	case origin != "" && allowed[origin]:
+		headers["Access-Control-Allow-Origin"] = origin
+		headers["Vary"] = "Origin"
+	default:
+		headers["Vary"] = "Origin"
+		return headers
+	}
+
+	headers["Access-Control-Allow-Methods"] = corsAllowMethods
+	headers["Access-Control-Allow-Headers"] = corsAllowHeaders
+	return headers
+}
+
+// PreflightResponse answers a CORS preflight (OPTIONS) request with 204 and
+// the CORS headers resolved for origin, plus Access-Control-Max-Age so browsers
+// can cache the result.
+func PreflightResponse(origin string) events.APIGatewayProxyResponse {
+	headers := CORSHeaders(origin)
+	if headers["Access-Control-Allow-Methods"] != "" {
+		headers["Access-Control-Max-Age"] = corsMaxAge
+	}
+	return events.APIGatewayProxyResponse{
+		StatusCode: 204,
+		Headers:    headers,
 	}
 }
 
+// allowedOrigins parses CORS_ALLOWED_ORIGINS. Returns nil when unset.
+func allowedOrigins() map[string]bool {
+	raw := strings.TrimSpace(os.Getenv("CORS_ALLOWED_ORIGINS"))
+	if raw == "" {
+		return nil
+	}
+	allowed := map[string]bool{}
+	for _, o := range strings.Split(raw, ",") {
+		if o = strings.TrimRight(strings.TrimSpace(o), "/"); o != "" {
+			allowed[o] = true
+		}
+	}
+	return allowed
+}
+
 // Pagination holds pagination metadata for list responses.
 type Pagination struct {
 	Page       int `json:"page"`
@@ -65,6 +156,13 @@ func NewPagination(total, page, limit int) Pagination {
 	}
 }
 
+// CursorPagination holds keyset pagination metadata for list responses.
+// NextCursor is nil on the last page.
+type CursorPagination struct {
+	Limit      int     `json:"limit"`
+	NextCursor *string `json:"nextCursor"`
+}
+
 // QueryParams holds parsed pagination and filter parameters from a request.
 type QueryParams struct {
 	Params map[string]string
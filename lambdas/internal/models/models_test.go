@@ -65,6 +65,86 @@ func TestAPIResponse(t *testing.T) {
 	}
 }
 
+func TestCORSHeaders(t *testing.T) {
+	tests := []struct {
+		name        string
+		allowlist   string
+		origin      string
+		wantOrigin  string
+		wantVary    bool
+		wantMethods bool
+	}{
+		{
+			name:        "unset allows any origin",
+			allowlist:   "",
+			origin:      "https://evil.example.com",
+			wantOrigin:  "*",
+			wantMethods: true,
+		},
+		{
+			name:        "wildcard in list allows any origin",
+			allowlist:   "https://app.example.com, *",
+			origin:      "https://other.example.com",
+			wantOrigin:  "*",
+			wantMethods: true,
+		},
+		{
+			name:        "allowed origin is echoed",
+			allowlist:   "https://app.example.com, https://admin.example.com/",
+			origin:      "https://admin.example.com",
+			wantOrigin:  "https://admin.example.com",
+			wantVary:    true,
+			wantMethods: true,
+		},
+		{
+			name:       "disallowed origin gets no allow-origin",
+			allowlist:  "https://app.example.com",
+			origin:     "https://evil.example.com",
+			wantOrigin: "",
+			wantVary:   true,
+		},
+		{
+			name:       "missing origin with allowlist",
+			allowlist:  "https://app.example.com",
+			origin:     "",
+			wantOrigin: "",
+			wantVary:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CORS_ALLOWED_ORIGINS", tt.allowlist)
+			h := CORSHeaders(tt.origin)
+
+			if got := h["Access-Control-Allow-Origin"]; got != tt.wantOrigin {
+				t.Errorf("Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if got := h["Vary"] == "Origin"; got != tt.wantVary {
+				t.Errorf("Vary: Origin present = %v, want %v", got, tt.wantVary)
+			}
+			if got := h["Access-Control-Allow-Methods"] != ""; got != tt.wantMethods {
+				t.Errorf("Allow-Methods present = %v, want %v", got, tt.wantMethods)
+			}
+		})
+	}
+}
+
+func TestAPIResponseWithOrigin(t *testing.T) {
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://app.example.com")
+
+	resp, err := APIResponseWithOrigin(200, map[string]string{"ok": "yes"}, "https://app.example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Headers["Access-Control-Allow-Origin"] != "https://app.example.com" {
+		t.Errorf("Allow-Origin = %q", resp.Headers["Access-Control-Allow-Origin"])
+	}
+	if resp.Headers["Content-Type"] != "application/json" {
+		t.Errorf("Content-Type = %q", resp.Headers["Content-Type"])
+	}
+}
+
 func TestNewPagination(t *testing.T) {
 	tests := []struct {
 		name       string
@@ -164,3 +244,44 @@ func TestParseQueryParams(t *testing.T) {
 		})
 	}
 }
+
+func TestAPIResponse_MarshalError(t *testing.T) {
+	resp, err := APIResponse(200, map[string]any{"bad": make(chan int)})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.StatusCode != 500 {
+		t.Errorf("status = %d, want 500", resp.StatusCode)
+	}
+	if resp.Body != `{"error":{"code":"INTERNAL_ERROR","message":"Internal server error"}}` {
+		t.Errorf("body = %s", resp.Body)
+	}
+}
+
+func TestBinaryResponse(t *testing.T) {
+	resp := BinaryResponse(200, "application/pdf", "N123 report.pdf", []byte("%PDF-1.3"))
+	if !resp.IsBase64Encoded || resp.Body != "JVBERi0xLjM=" {
+		t.Errorf("body = %q (base64 %v), want the encoded bytes", resp.Body, resp.IsBase64Encoded)
+	}
+	if resp.Headers["Content-Type"] != "application/pdf" {
+		t.Errorf("Content-Type = %q", resp.Headers["Content-Type"])
+	}
+	if got := resp.Headers["Content-Disposition"]; got != `attachment; filename="N123 report.pdf"` {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+	if resp.Headers["Access-Control-Allow-Origin"] != "*" {
+		t.Errorf("missing CORS headers: %v", resp.Headers)
+	}
+
+	if _, ok := BinaryResponse(200, "image/png", "", nil).Headers["Content-Disposition"]; ok {
+		t.Error("Content-Disposition set without a filename")
+	}
+}
+
+func TestInspectionRules_ValidTypes(t *testing.T) {
+	for typ := range InspectionRules {
+		if !ValidInspectionTypes[typ] {
+			t.Errorf("InspectionRules has %q, which is not a valid inspection type", typ)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"context"
+	"strings"
+
+	"github.com/projectcloudline/logbook-service/internal/db"
+)
+
+// AutoApproveActor is recorded as reviewed_by on entries approved without a
+// human.
+const AutoApproveActor = "system:auto-approve"
+
+// ReviewReasonSummary joins the extraction notes of an upload page's flagged
+// entries into the page's review_reason_summary: each note is split into its
+// sentences, and the distinct ones are joined with "; ".
+func ReviewReasonSummary(notes []string) string {
+	var reasons []string
+	seen := make(map[string]bool)
+	for _, n := range notes {
+		for _, reason := range strings.Split(n, ". ") {
+			reason = strings.TrimSuffix(strings.TrimSpace(reason), ".")
+			if reason != "" && !seen[reason] {
+				seen[reason] = true
+				reasons = append(reasons, reason)
+			}
+		}
+	}
+	return strings.Join(reasons, "; ")
+}
+
+// RefreshPageReview recomputes an upload page's review rollup from its
+// current entries after some of them were flagged outside extraction. The
+// page's confidence is left as is, since flagging doesn't change an entry's
+// confidence.
+func RefreshPageReview(ctx context.Context, d db.DB, pageID string) error {
+	rows, err := d.Query(db.WithPrimary(ctx),
+		`SELECT extraction_notes FROM maintenance_entries
+		 WHERE page_id = $1 AND needs_review AND superseded_by IS NULL
+		 ORDER BY created_at, id`,
+		pageID)
+	if err != nil {
+		return err
+	}
+	notes := make([]string, 0, len(rows))
+	for _, row := range rows {
+		n, _ := row["extraction_notes"].(string)
+		notes = append(notes, n)
+	}
+	return d.Exec(ctx,
+		"UPDATE upload_pages SET needs_review = TRUE, review_reason_summary = $2 WHERE id = $1",
+		pageID, ReviewReasonSummary(notes))
+}
@@ -0,0 +1,38 @@
+package models
+
+// ValidEntryTypes are the values maintenance_entries.entry_type accepts.
+var ValidEntryTypes = map[string]bool{
+	"maintenance": true, "inspection": true, "ad_compliance": true, "other": true,
+}
+
+// ValidInspectionTypes are the values inspection_records.inspection_type
+// accepts.
+var ValidInspectionTypes = map[string]bool{
+	"annual": true, "100hr": true, "50hr": true, "progressive": true,
+	"altimeter_static": true, "transponder": true, "elt": true, "other": true,
+}
+
+// InspectionRule is what the regulations require of an inspection type.
+type InspectionRule struct {
+	// Months is how many calendar months the inspection stays current, 0
+	// when it isn't calendar-based. It runs to the end of the last month.
+	Months int
+	// Hours is how many hours of time in service it stays current, 0 when
+	// it isn't hour-based.
+	Hours float64
+	// FARs are the 14 CFR sections requiring it. Part 43, which logbooks
+	// also cite, governs how any inspection is done and says nothing about
+	// which.
+	FARs []string
+}
+
+// InspectionRules are the rules of each inspection type that has any;
+// 50-hour and other inspections have none.
+var InspectionRules = map[string]InspectionRule{
+	"annual":           {Months: 12, FARs: []string{"91.409"}}, // 91.409(a)
+	"100hr":            {Hours: 100, FARs: []string{"91.409"}}, // 91.409(b)
+	"progressive":      {FARs: []string{"91.409"}},             // 91.409(d)
+	"altimeter_static": {Months: 24, FARs: []string{"91.411"}},
+	"transponder":      {Months: 24, FARs: []string{"91.413"}},
+	"elt":              {Months: 12, FARs: []string{"91.207"}}, // 91.207(d)
+}
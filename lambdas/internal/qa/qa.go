@@ -0,0 +1,206 @@
+// Package qa verifies extracted logbook entries against their slice images
+// using a second model, Claude when configured with Gemini as the fallback.
+package qa
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/projectcloudline/logbook-service/internal/anthropic"
+	"github.com/projectcloudline/logbook-service/internal/gemini"
+)
+
+const (
+	claudeModel = "claude-haiku-4-5-20251001"
+	geminiModel = "gemini-2.5-flash"
+)
+
+// Verdict is the QA model's judgement of a single entry.
+type Verdict string
+
+const (
+	Pass        Verdict = "pass"
+	Fail        Verdict = "fail"
+	NeedsReview Verdict = "needs_review"
+)
+
+// FieldIssue describes one field the QA model disagrees with.
+type FieldIssue struct {
+	Field     string `json:"field"`
+	Issue     string `json:"issue"`
+	Expected  string `json:"expected"`
+	Extracted string `json:"extracted"`
+	Severity  string `json:"severity"`
+}
+
+// Result is the verdict for the entry at EntryIndex in the verified extraction.
+type Result struct {
+	EntryIndex int          `json:"entryIndex"`
+	Verdict    Verdict      `json:"verdict"`
+	Issues     []FieldIssue `json:"issues"`
+	Summary    string       `json:"summary"`
+}
+
+// Report is the QA model's response for one extraction.
+type Report struct {
+	Results []Result `json:"results"`
+}
+
+// Verify sends the slice image and extraction JSON (an array of entries) to
+// the QA model. Claude is used when claude is non-nil, falling back to Gemini
+// if the Claude call fails.
+func Verify(ctx context.Context, claude anthropic.Client, geminiClient gemini.Client, imageData []byte, mimeType string, extractionJSON []byte) (*Report, error) {
+	qaPrompt := VerificationPrompt + "\n\nExtraction to verify:\n" + string(extractionJSON)
+
+	var responseText string
+	var err error
+
+	// Try Claude first, fall back to Gemini
+	if claude != nil {
+		responseText, err = claude.CreateMessage(ctx, claudeModel, 4096, []anthropic.Message{
+			{
+				Role: "user",
+				Content: []anthropic.ContentPart{
+					{ImageData: imageData, MIMEType: mimeType},
+					{Text: qaPrompt},
+				},
+			},
+		})
+		if err != nil {
+			log.Printf("WARNING: Claude QA failed, falling back to Gemini: %v", err)
+			responseText, err = geminiQA(ctx, geminiClient, imageData, mimeType, qaPrompt)
+			if err != nil {
+				return nil, fmt.Errorf("gemini QA fallback: %w", err)
+			}
+		}
+	} else {
+		// No Claude available — use Gemini for QA
+		responseText, err = geminiQA(ctx, geminiClient, imageData, mimeType, qaPrompt)
+		if err != nil {
+			return nil, fmt.Errorf("gemini QA: %w", err)
+		}
+	}
+
+	responseText = stripFences(responseText)
+	if responseText == "" {
+		return nil, errors.New("empty QA response")
+	}
+
+	var report Report
+	if err := json.Unmarshal([]byte(responseText), &report); err != nil {
+		return nil, fmt.Errorf("parse QA response: %w", err)
+	}
+
+	return &report, nil
+}
+
+// geminiQA sends a QA request to Gemini (used as fallback when Claude is unavailable).
+func geminiQA(ctx context.Context, geminiClient gemini.Client, imageData []byte, mimeType, qaPrompt string) (string, error) {
+	if geminiClient == nil {
+		return "", errors.New("no gemini client")
+	}
+	temp := float32(0.1)
+	return geminiClient.GenerateContent(ctx, geminiModel, []gemini.Part{
+		{Text: qaPrompt},
+		{Data: imageData, MIMEType: mimeType},
+	}, &gemini.GenerateConfig{
+		Temperature:      &temp,
+		ResponseMIMEType: "application/json",
+	})
+}
+
+// stripFences removes a surrounding markdown code fence from a model response.
+func stripFences(s string) string {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "`") {
+		s = strings.TrimLeft(s, "`")
+		s = strings.TrimPrefix(s, "json")
+		s = strings.TrimLeft(s, " \t\r\n")
+	}
+	s = strings.TrimRight(s, "` \t\r\n")
+	return strings.TrimSpace(s)
+}
+
+// VerificationPrompt is sent to the QA model (Claude or Gemini fallback) with
+// the slice image and the extraction JSON. The QA model verifies each extracted
+// entry against the image and returns a structured verdict.
+const VerificationPrompt = `You are a QA specialist verifying another AI model's extraction of aircraft maintenance logbook entries. You will receive:
+1. An image of a cropped logbook entry
+2. The JSON extraction produced by the extraction model
+
+YOUR ROLE: Verify that the extraction accurately reflects what is visible in the image.
+
+CRITICAL RULES:
+- You CANNOT infer, guess, or fill in data that is not clearly visible in the image
+- You CANNOT correct grammar, spelling, or abbreviations — the extraction SHOULD preserve these exactly as written
+- You MUST compare each field value against what is actually visible in the image
+- Abbreviations like "w/o", "R/R", "c/w", "IAW", "P/N", "S/N" are CORRECT and should NOT be flagged
+- Minor formatting differences (spacing, capitalization) are NOT issues unless they change meaning
+
+AIRCRAFT IDENTITY RULES:
+- Logbook entries often omit the aircraft make, model, or even registration — this is NORMAL and NOT an issue
+- All entries in a logbook are presumed to belong to the aircraft that logbook is for
+- Only flag aircraft identity fields if the extracted value CONFLICTS with what is visible (e.g., wrong N-number, wrong serial)
+- Do NOT flag missing aircraft identity fields (null/empty make, model, registration, serial)
+- Do NOT infer aircraft make/model from context (e.g., from service bulletin references or part numbers)
+
+WHAT TO CHECK:
+- Date: Does the extracted date match what is visible?
+- Aircraft identifiers: ONLY if present — check that extracted values match (do NOT flag missing values)
+- Time readings: Hobbs, tach, flight time, TSO/TSMOH
+- Shop/mechanic information: Names, certificate numbers, addresses
+- Maintenance narrative: Is every visible word captured? Is anything added that is not visible? Is anything truncated?
+- Parts actions: Part numbers, serial numbers, action types, quantities
+- AD compliance: AD numbers, compliance methods
+- Entry type classification: Is the categorization reasonable?
+
+ERROR TAXONOMY — use these exact values for the "issue" field:
+
+Entry-level issues:
+- "missing_entry" — a visible entry in the image was not extracted at all
+- "fabricated_entry" — an entry in the extraction has no corresponding content in the image
+
+Field-level issues:
+- "incorrect" — field value does not match what is visible (wrong characters, numbers, words)
+- "truncated" — narrative or field value is cut short, missing visible words
+- "missing_field" — field is clearly visible in the image but extracted as null or empty
+- "added_text" — words present in the extraction that are not visible in the image
+- "wrong_classification" — entryType, inspectionType, or action type is miscategorized
+
+Severity:
+- "critical" — wrong part number, serial number, AD number, date; missing or added narrative text; fabricated or missed entries
+- "minor" — formatting differences, classification edge cases, ambiguous or illegible readings
+
+VERDICT LOGIC:
+- "pass" — no critical issues found
+- "needs_review" — only minor issues or ambiguous/illegible areas where you cannot determine correctness
+- "fail" — one or more critical issues are present
+
+Return JSON format:
+{
+  "results": [
+    {
+      "entryIndex": 0,
+      "verdict": "pass | fail | needs_review",
+      "issues": [
+        {
+          "field": "maintenanceNarrative",
+          "issue": "truncated",
+          "expected": "what you see in the image",
+          "extracted": "what the extraction contains",
+          "severity": "critical"
+        }
+      ],
+      "summary": "Brief explanation of your verdict"
+    }
+  ]
+}
+
+If the extraction has no entries and the image shows no entries (blank/header), return:
+{"results": []}
+
+IMPORTANT: Be precise and conservative. Only flag genuine discrepancies you can clearly see. When in doubt about legibility, use "needs_review" verdict with a "minor" severity issue explaining the ambiguity.`
@@ -0,0 +1,95 @@
+package qa
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/projectcloudline/logbook-service/internal/anthropic"
+	"github.com/projectcloudline/logbook-service/internal/gemini"
+)
+
+const passReport = `{"results":[{"entryIndex":0,"verdict":"pass","issues":[],"summary":"OK"}]}`
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name        string
+		claude      anthropic.Client
+		geminiResp  string
+		wantVerdict Verdict
+		wantGemini  int
+		wantErr     bool
+	}{
+		{
+			name: "claude handles QA",
+			claude: &anthropic.MockClient{
+				CreateMessageFn: func(ctx context.Context, model string, maxTokens int64, messages []anthropic.Message) (string, error) {
+					if !strings.Contains(messages[0].Content[1].Text, `"date":"2024-01-15"`) {
+						t.Error("prompt does not include the extraction JSON")
+					}
+					return "```json\n" + passReport + "\n```", nil
+				},
+			},
+			wantVerdict: Pass,
+		},
+		{
+			name: "claude error falls back to gemini",
+			claude: &anthropic.MockClient{
+				CreateMessageFn: func(ctx context.Context, model string, maxTokens int64, messages []anthropic.Message) (string, error) {
+					return "", errors.New("overloaded")
+				},
+			},
+			geminiResp:  `{"results":[{"entryIndex":0,"verdict":"fail","summary":"Wrong date"}]}`,
+			wantVerdict: Fail,
+			wantGemini:  1,
+		},
+		{
+			name:        "gemini without claude",
+			geminiResp:  `{"results":[{"entryIndex":0,"verdict":"needs_review","summary":"Faded"}]}`,
+			wantVerdict: NeedsReview,
+			wantGemini:  1,
+		},
+		{
+			name:       "empty response",
+			geminiResp: "  ",
+			wantGemini: 1,
+			wantErr:    true,
+		},
+		{
+			name:       "unparseable response",
+			geminiResp: "not json",
+			wantGemini: 1,
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			geminiCalls := 0
+			g := &gemini.MockClient{
+				GenerateContentFn: func(ctx context.Context, model string, parts []gemini.Part, config *gemini.GenerateConfig) (string, error) {
+					geminiCalls++
+					return tt.geminiResp, nil
+				},
+			}
+
+			report, err := Verify(context.Background(), tt.claude, g, []byte("img"), "image/jpeg", []byte(`[{"date":"2024-01-15"}]`))
+			if geminiCalls != tt.wantGemini {
+				t.Errorf("gemini calls = %d, want %d", geminiCalls, tt.wantGemini)
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Error("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(report.Results) != 1 || report.Results[0].Verdict != tt.wantVerdict {
+				t.Errorf("results = %+v, want verdict %q", report.Results, tt.wantVerdict)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+// Package rawextraction encodes the raw model output kept in
+// upload_pages.raw_extraction, optionally gzip-compressed.
+package rawextraction
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// EncodingGzip marks a gzip-compressed, base64-encoded extraction.
+const EncodingGzip = "gzip+base64"
+
+// envelope wraps compressed extractions so the column stays valid JSONB.
+type envelope struct {
+	Encoding string `json:"encoding"`
+	Data     string `json:"data"`
+}
+
+// Encode returns the value to store for the extraction JSON raw. Uncompressed
+// values are stored as-is.
+func Encode(raw []byte, compress bool) ([]byte, error) {
+	if !compress {
+		return raw, nil
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(raw); err != nil {
+		return nil, fmt.Errorf("gzip extraction: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("gzip extraction: %w", err)
+	}
+	return json.Marshal(envelope{
+		Encoding: EncodingGzip,
+		Data:     base64.StdEncoding.EncodeToString(buf.Bytes()),
+	})
+}
+
+// Decode returns the extraction JSON from a stored value, decompressing it
+// when it is a compressed envelope. Legacy rows are returned unchanged.
+func Decode(stored []byte) ([]byte, error) {
+	var env envelope
+	if json.Unmarshal(stored, &env) != nil || env.Encoding == "" {
+		return stored, nil
+	}
+	if env.Encoding != EncodingGzip {
+		return nil, fmt.Errorf("unknown extraction encoding %q", env.Encoding)
+	}
+	compressed, err := base64.StdEncoding.DecodeString(env.Data)
+	if err != nil {
+		return nil, fmt.Errorf("decode extraction: %w", err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, fmt.Errorf("gunzip extraction: %w", err)
+	}
+	defer zr.Close()
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("gunzip extraction: %w", err)
+	}
+	return raw, nil
+}
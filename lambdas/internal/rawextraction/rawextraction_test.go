@@ -0,0 +1,78 @@
+package rawextraction
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	raw := []byte(`{"pageType":"maintenance_entry","entries":[{"date":"2024-01-15","maintenanceNarrative":"` +
+		strings.Repeat("Changed oil and filter. ", 200) + `"}]}`)
+
+	tests := []struct {
+		name     string
+		compress bool
+	}{
+		{"compressed", true},
+		{"uncompressed", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored, err := Encode(raw, tt.compress)
+			if err != nil {
+				t.Fatalf("Encode: %v", err)
+			}
+			if !json.Valid(stored) {
+				t.Fatalf("stored value is not valid JSON: %s", stored)
+			}
+			if tt.compress {
+				if len(stored) >= len(raw) {
+					t.Errorf("compressed size %d, want smaller than %d", len(stored), len(raw))
+				}
+				if !strings.Contains(string(stored), EncodingGzip) {
+					t.Errorf("stored value missing encoding marker: %s", stored)
+				}
+			}
+
+			got, err := Decode(stored)
+			if err != nil {
+				t.Fatalf("Decode: %v", err)
+			}
+			if string(got) != string(raw) {
+				t.Errorf("round trip mismatch:\n got %.80s\nwant %.80s", got, raw)
+			}
+		})
+	}
+}
+
+func TestDecode_Legacy(t *testing.T) {
+	tests := []string{
+		`{"pageType":"other","entries":[]}`,
+		`{"entries":[{"encoding":"utf-8"}]}`,
+		`[]`,
+	}
+	for _, legacy := range tests {
+		got, err := Decode([]byte(legacy))
+		if err != nil {
+			t.Errorf("Decode(%s): %v", legacy, err)
+		}
+		if string(got) != legacy {
+			t.Errorf("Decode(%s) = %s, want unchanged", legacy, got)
+		}
+	}
+}
+
+func TestDecode_Invalid(t *testing.T) {
+	tests := []string{
+		`{"encoding":"zstd","data":"AAAA"}`,
+		`{"encoding":"gzip+base64","data":"not base64!"}`,
+		`{"encoding":"gzip+base64","data":"aGVsbG8="}`,
+	}
+	for _, stored := range tests {
+		if _, err := Decode([]byte(stored)); err == nil {
+			t.Errorf("Decode(%s): expected error", stored)
+		}
+	}
+}
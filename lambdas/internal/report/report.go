@@ -0,0 +1,237 @@
+// Package report renders an aircraft's maintenance history as a printable
+// PDF, for owners to hand to a mechanic or buyer.
+package report
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// Report is everything the PDF shows. Values are preformatted text; empty
+// ones print as "—".
+type Report struct {
+	Aircraft    Aircraft
+	GeneratedAt time.Time
+	// TotalTime is the aircraft's latest logged hours.
+	TotalTime string
+	ADs       []AD
+	// Entries are listed in the order given, which should be chronological.
+	Entries []Entry
+}
+
+// Aircraft identifies the aircraft the report is for.
+type Aircraft struct {
+	Registration    string
+	Make            string
+	Model           string
+	SerialNumber    string
+	EngineModel     string
+	EngineSerial    string
+	PropellerModel  string
+	PropellerSerial string
+}
+
+// AD is one airworthiness directive's compliance status.
+type AD struct {
+	Number       string
+	Status       string
+	LastComplied string
+	NextDue      string
+}
+
+// Entry is one logbook entry.
+type Entry struct {
+	Date      string
+	Hours     string
+	Type      string
+	Narrative string
+	// Inspections names the inspections the entry records, if any. Their
+	// rows are highlighted.
+	Inspections string
+}
+
+const (
+	margin     = 15.0
+	lineHeight = 4.5
+	fontFamily = "Helvetica"
+)
+
+var (
+	adColumns    = []column{{"AD", 45}, {"Status", 30}, {"Last complied", 35}, {"Next due", 70}}
+	entryColumns = []column{{"Date", 24}, {"Hours", 20}, {"Type", 34}, {"Details", 102}}
+)
+
+type column struct {
+	title string
+	width float64
+}
+
+// Render writes r to w as an A4 PDF.
+func Render(w io.Writer, r *Report) error {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetMargins(margin, margin, margin)
+	pdf.SetAutoPageBreak(false, margin)
+	pdf.SetCreationDate(r.GeneratedAt)
+	pdf.SetTitle(fmt.Sprintf("Maintenance report %s", r.Aircraft.Registration), true)
+	pdf.AliasNbPages("")
+	// Core fonts are Windows-1252; translate so accents and dashes survive.
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-margin + 5)
+		pdf.SetFont(fontFamily, "", 8)
+		pdf.CellFormat(0, lineHeight, tr(fmt.Sprintf("%s maintenance report · page %d of {nb}", r.Aircraft.Registration, pdf.PageNo())), "", 0, "C", false, 0, "")
+	})
+
+	pdf.AddPage()
+	pdf.SetFont(fontFamily, "B", 16)
+	pdf.CellFormat(0, 8, tr("Maintenance report: "+r.Aircraft.Registration), "", 1, "L", false, 0, "")
+	pdf.SetFont(fontFamily, "", 9)
+	pdf.CellFormat(0, lineHeight, "Generated "+r.GeneratedAt.UTC().Format("2006-01-02 15:04 MST"), "", 1, "L", false, 0, "")
+
+	heading(pdf, "Aircraft")
+	a := r.Aircraft
+	field(pdf, tr, "Registration", a.Registration)
+	field(pdf, tr, "Make / model", join(a.Make, a.Model))
+	field(pdf, tr, "Serial number", a.SerialNumber)
+	field(pdf, tr, "Engine", join(a.EngineModel, serial(a.EngineSerial)))
+	field(pdf, tr, "Propeller", join(a.PropellerModel, serial(a.PropellerSerial)))
+
+	heading(pdf, "Compliance")
+	field(pdf, tr, "Total time", r.TotalTime)
+	if len(r.ADs) == 0 {
+		note(pdf, "No airworthiness directive compliance recorded.")
+	} else {
+		table(pdf, tr, adColumns, len(r.ADs), func(i int) ([]string, bool) {
+			ad := r.ADs[i]
+			return []string{ad.Number, ad.Status, ad.LastComplied, ad.NextDue}, false
+		})
+	}
+
+	heading(pdf, "Maintenance entries")
+	if len(r.Entries) == 0 {
+		note(pdf, "No maintenance entries recorded.")
+	} else {
+		table(pdf, tr, entryColumns, len(r.Entries), func(i int) ([]string, bool) {
+			e := r.Entries[i]
+			typ := e.Type
+			if e.Inspections != "" {
+				typ = strings.TrimSpace(typ + "\nInspection: " + e.Inspections)
+			}
+			return []string{e.Date, e.Hours, typ, e.Narrative}, e.Inspections != ""
+		})
+	}
+
+	return pdf.Output(w)
+}
+
+// heading starts a section, on a new page when little room is left.
+func heading(pdf *gofpdf.Fpdf, title string) {
+	ensureRoom(pdf, 30)
+	pdf.Ln(4)
+	pdf.SetFont(fontFamily, "B", 12)
+	pdf.CellFormat(0, 7, title, "B", 1, "L", false, 0, "")
+	pdf.Ln(1)
+}
+
+func field(pdf *gofpdf.Fpdf, tr func(string) string, label, value string) {
+	pdf.SetFont(fontFamily, "B", 9)
+	pdf.CellFormat(35, lineHeight+1, label, "", 0, "L", false, 0, "")
+	pdf.SetFont(fontFamily, "", 9)
+	pdf.CellFormat(0, lineHeight+1, tr(orDash(value)), "", 1, "L", false, 0, "")
+}
+
+func note(pdf *gofpdf.Fpdf, text string) {
+	pdf.SetFont(fontFamily, "I", 9)
+	pdf.CellFormat(0, lineHeight+1, text, "", 1, "L", false, 0, "")
+}
+
+// table draws rows under a header row that repeats on each new page. row
+// returns a row's cells and whether to highlight it.
+func table(pdf *gofpdf.Fpdf, tr func(string) string, cols []column, n int, row func(i int) ([]string, bool)) {
+	header := func() {
+		pdf.SetFont(fontFamily, "B", 9)
+		pdf.SetFillColor(225, 225, 225)
+		for _, c := range cols {
+			pdf.CellFormat(c.width, lineHeight+2, c.title, "1", 0, "L", true, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+	header()
+
+	pdf.SetDrawColor(190, 190, 190)
+	defer pdf.SetDrawColor(0, 0, 0)
+	for i := range n {
+		cells, highlight := row(i)
+		pdf.SetFont(fontFamily, "", 8)
+		lines := make([][][]byte, len(cols))
+		height := 0.0
+		for j, c := range cols {
+			lines[j] = pdf.SplitLines([]byte(tr(orDash(cells[j]))), c.width)
+			height = max(height, float64(len(lines[j]))*lineHeight+1)
+		}
+		if ensureRoom(pdf, height) {
+			header()
+			pdf.SetFont(fontFamily, "", 8)
+		}
+
+		x, y := pdf.GetX(), pdf.GetY()
+		width := 0.0
+		for _, c := range cols {
+			width += c.width
+		}
+		if highlight {
+			pdf.SetFillColor(255, 243, 205)
+			pdf.Rect(x, y, width, height, "F")
+		}
+		offset := 0.0
+		for j, c := range cols {
+			for k, line := range lines[j] {
+				pdf.SetXY(x+offset, y+0.5+float64(k)*lineHeight)
+				pdf.CellFormat(c.width, lineHeight, string(line), "", 0, "L", false, 0, "")
+			}
+			offset += c.width
+		}
+		pdf.Line(x, y+height, x+width, y+height)
+		pdf.SetXY(x, y+height)
+	}
+}
+
+// ensureRoom starts a new page unless height fits above the bottom margin,
+// reporting whether it did.
+func ensureRoom(pdf *gofpdf.Fpdf, height float64) bool {
+	_, pageHeight := pdf.GetPageSize()
+	if pdf.GetY()+height <= pageHeight-margin-5 {
+		return false
+	}
+	pdf.AddPage()
+	return true
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "—"
+	}
+	return s
+}
+
+// join joins the non-empty parts with spaces.
+func join(parts ...string) string {
+	var kept []string
+	for _, p := range parts {
+		if p != "" {
+			kept = append(kept, p)
+		}
+	}
+	return strings.Join(kept, " ")
+}
+
+func serial(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "(s/n " + s + ")"
+}
@@ -0,0 +1,96 @@
+package report
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pdfText inflates every content stream in a PDF, which is where the text
+// operators live.
+func pdfText(t *testing.T, b []byte) string {
+	t.Helper()
+	var out strings.Builder
+	for {
+		i := bytes.Index(b, []byte("stream\n"))
+		if i < 0 {
+			return out.String()
+		}
+		b = b[i+len("stream\n"):]
+		end := bytes.Index(b, []byte("endstream"))
+		if end < 0 {
+			t.Fatal("unterminated stream")
+		}
+		if r, err := zlib.NewReader(bytes.NewReader(b[:end])); err == nil {
+			data, _ := io.ReadAll(r)
+			out.Write(data)
+		}
+		b = b[end+len("endstream"):]
+	}
+}
+
+func TestRender(t *testing.T) {
+	r := &Report{
+		Aircraft: Aircraft{
+			Registration: "N123AB",
+			Make:         "Cessna",
+			Model:        "172S",
+			EngineModel:  "IO-360-L2A",
+		},
+		GeneratedAt: time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC),
+		TotalTime:   "2,345.6",
+		ADs:         []AD{{Number: "2020-12-34", Status: "overdue", NextDue: "2026-01-01"}},
+		Entries: []Entry{
+			{Date: "2024-01-15", Hours: "2,300.0", Type: "maintenance", Narrative: "Changed oil and filter"},
+			{Date: "2024-06-01", Hours: "2,340.2", Type: "inspection", Narrative: "Annual inspection completed", Inspections: "annual"},
+		},
+	}
+	// Enough entries to run onto further pages.
+	for i := range 80 {
+		r.Entries = append(r.Entries, Entry{
+			Date:      "2025-01-01",
+			Type:      "maintenance",
+			Narrative: fmt.Sprintf("Routine entry %d: %s", i, strings.Repeat("replaced part and inspected ", 6)),
+		})
+	}
+
+	var buf bytes.Buffer
+	if err := Render(&buf, r); err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte("%PDF-")) {
+		t.Fatalf("output starts %q, want a PDF header", buf.Bytes()[:min(buf.Len(), 8)])
+	}
+
+	text := pdfText(t, buf.Bytes())
+	for _, want := range []string{
+		"Maintenance report: N123AB",
+		"Cessna 172S",
+		"2020-12-34",
+		"Changed oil and filter",
+		"Inspection: annual",
+		"Routine entry 79",
+		"page 3 of",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("PDF text is missing %q", want)
+		}
+	}
+}
+
+func TestRender_Empty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Render(&buf, &Report{Aircraft: Aircraft{Registration: "N1"}}); err != nil {
+		t.Fatalf("Render: %v", err)
+	}
+	text := pdfText(t, buf.Bytes())
+	for _, want := range []string{"No airworthiness directive compliance recorded.", "No maintenance entries recorded."} {
+		if !strings.Contains(text, want) {
+			t.Errorf("PDF text is missing %q", want)
+		}
+	}
+}
@@ -225,8 +225,8 @@ func TestSliceProfileDiag(t *testing.T) {
 	}
 
 	// Show after absorb
-	minEntryHeight := height / 8
-	absorbed := absorbSmallRegions(regions, minEntryHeight)
+	minEntryHeight := int(float64(height) * opts.MinEntryFraction)
+	absorbed := absorbSmallRegions(regions, minEntryHeight, opts.PreferMergeDown)
 	t.Logf("\nRegions after absorb (minEntryHeight=%d): %d", minEntryHeight, len(absorbed))
 	for i, r := range absorbed {
 		t.Logf("  region %d: y=[%d, %d) height=%d", i, r[0], r[1], r[1]-r[0])
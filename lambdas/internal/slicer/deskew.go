@@ -0,0 +1,117 @@
+package slicer
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/math/f64"
+)
+
+const (
+	maxSkewDegrees    = 5.0  // Search window: +/- this many degrees
+	coarseSkewStep    = 0.5  // Coarse search step (degrees)
+	fineSkewStep      = 0.05 // Refinement step around the coarse best (degrees)
+	minDeskewDegrees  = 0.1  // Skip rotation for negligible skew
+	skewSampleStride  = 2    // Sample every Nth pixel in x and y when estimating
+	skewMaxDarkPoints = 200000
+)
+
+// estimateSkew returns the angle (degrees, positive = text lines slope down
+// to the right) that best aligns the dark pixels into horizontal rows. Each
+// candidate angle shears the dark pixels onto rows and scores the resulting
+// projection profile by its sum of squares, which peaks when text lines fall
+// into as few rows as possible.
+func estimateSkew(img image.Image, bounds image.Rectangle, threshold uint8) float64 {
+	var xs, ys []float64
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += skewSampleStride {
+		for x := bounds.Min.X; x < bounds.Max.X; x += skewSampleStride {
+			if luma(img.At(x, y)) < threshold {
+				xs = append(xs, float64(x-bounds.Min.X))
+				ys = append(ys, float64(y-bounds.Min.Y))
+			}
+		}
+	}
+	if len(xs) == 0 {
+		return 0
+	}
+	// Keep the search bounded on large, ink-heavy pages.
+	if step := len(xs)/skewMaxDarkPoints + 1; step > 1 {
+		for i := 0; i*step < len(xs); i++ {
+			xs[i], ys[i] = xs[i*step], ys[i*step]
+		}
+		n := (len(xs) + step - 1) / step
+		xs, ys = xs[:n], ys[:n]
+	}
+
+	width, height := float64(bounds.Dx()), float64(bounds.Dy())
+	offset := width * math.Tan(maxSkewDegrees*math.Pi/180)
+	// Rows are binned at the sampling stride so that unsheared (0°) samples,
+	// which all land on every Nth row, aren't favoured.
+	bins := make([]int, int(height+2*offset)/skewSampleStride+2)
+
+	score := func(deg float64) float64 {
+		for i := range bins {
+			bins[i] = 0
+		}
+		slope := math.Tan(deg * math.Pi / 180)
+		for i := range xs {
+			row := int(ys[i]-xs[i]*slope+offset) / skewSampleStride
+			if row >= 0 && row < len(bins) {
+				bins[row]++
+			}
+		}
+		var sum float64
+		for _, c := range bins {
+			sum += float64(c) * float64(c)
+		}
+		return sum
+	}
+
+	search := func(from, to, step float64) float64 {
+		best, bestScore := 0.0, -1.0
+		for deg := from; deg <= to+step/2; deg += step {
+			if s := score(deg); s > bestScore || (s == bestScore && math.Abs(deg) < math.Abs(best)) {
+				best, bestScore = deg, s
+			}
+		}
+		return best
+	}
+
+	coarse := search(-maxSkewDegrees, maxSkewDegrees, coarseSkewStep)
+	return search(coarse-coarseSkewStep, coarse+coarseSkewStep, fineSkewStep)
+}
+
+// rotate returns img rotated by deg degrees (positive = clockwise on screen)
+// about its center, keeping the original bounds. Uncovered corners are white.
+func rotate(img image.Image, deg float64) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), &image.Uniform{color.White}, image.Point{}, draw.Src)
+
+	rad := deg * math.Pi / 180
+	sin, cos := math.Sin(rad), math.Cos(rad)
+	cx := float64(b.Min.X) + float64(b.Dx())/2
+	cy := float64(b.Min.Y) + float64(b.Dy())/2
+	dcx, dcy := float64(b.Dx())/2, float64(b.Dy())/2
+
+	// Source → destination: translate to origin, rotate, translate to dst center.
+	s2d := f64.Aff3{
+		cos, -sin, dcx - cos*cx + sin*cy,
+		sin, cos, dcy - sin*cx - cos*cy,
+	}
+	xdraw.ApproxBiLinear.Transform(dst, s2d, img, b, xdraw.Src, nil)
+	return dst
+}
+
+// deskew straightens img if its text is measurably rotated, returning the
+// (possibly unchanged) image and the correction applied in degrees.
+func deskew(img image.Image, threshold uint8) (image.Image, float64) {
+	skew := estimateSkew(img, img.Bounds(), threshold)
+	if math.Abs(skew) < minDeskewDegrees {
+		return img, 0
+	}
+	return rotate(img, -skew), -skew
+}
@@ -0,0 +1,65 @@
+package slicer
+
+// Diagnostics explains how SliceImage would cut an image, so pages that
+// slice poorly can be understood without the image on hand. Rows are those
+// of the decoded image, after any deskew and auto-rotation.
+type Diagnostics struct {
+	Width, Height    int     // Decoded image
+	Options          Options // Spatial parameters scaled to Height
+	Threshold        uint8   // Darkness threshold used (the Otsu pick with AdaptiveThreshold)
+	DeskewAngle      float64 // Degrees the page was rotated by, 0 without Deskew
+	Flipped          bool    // Page was turned 180° as upside down, only with AutoRotate
+	NoiseFloor       int     // Dark pixels per row ignored as grid lines and noise
+	ContentThreshold int     // Smoothed value a row needs to count as content
+	MinEntryHeight   int     // Regions shorter than this are absorbed
+	Profile          []int   // Dark pixels per row
+	Smoothed         []int   // Profile after the noise floor and smoothing
+	Regions          []Region
+	Absorbed         []Region // Regions after small ones are absorbed
+	Slices           []Region // Padded crops SliceImage keeps; empty means the whole image
+}
+
+// Region is the run of rows [Y0, Y1).
+type Region struct {
+	Y0, Y1 int
+	Gap    int // Rows since the previous region ended (since row 0 for the first)
+}
+
+// Height is the number of rows in the region.
+func (r Region) Height() int { return r.Y1 - r.Y0 }
+
+// Diagnose runs the slicer's detection on an image without encoding any
+// slices and reports each intermediate step.
+func Diagnose(imageBytes []byte, opts Options) (*Diagnostics, error) {
+	d, err := detect(imageBytes, opts)
+	if err != nil {
+		return nil, err
+	}
+	bounds := d.img.Bounds()
+	return &Diagnostics{
+		Width:            bounds.Dx(),
+		Height:           bounds.Dy(),
+		Options:          d.opts,
+		Threshold:        d.threshold,
+		DeskewAngle:      d.angle,
+		Flipped:          d.flipped,
+		NoiseFloor:       d.noiseFloor,
+		ContentThreshold: d.contentThreshold,
+		MinEntryHeight:   d.minEntryHeight,
+		Profile:          d.darkRows,
+		Smoothed:         d.smoothed,
+		Regions:          toRegions(d.found),
+		Absorbed:         toRegions(d.regions),
+		Slices:           toRegions(d.windows()),
+	}, nil
+}
+
+func toRegions(rows [][2]int) []Region {
+	regions := make([]Region, len(rows))
+	prev := 0
+	for i, r := range rows {
+		regions[i] = Region{Y0: r[0], Y1: r[1], Gap: r[0] - prev}
+		prev = r[1]
+	}
+	return regions
+}
@@ -0,0 +1,102 @@
+package slicer
+
+import (
+	"image"
+	"slices"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/math/f64"
+)
+
+// Upside-down pages are recognised from the shape of their text lines. Latin
+// script puts more ink above a line's x-height band (ascenders, capitals,
+// digits) than below it (descenders), so on an inverted page the lighter
+// side of each line is on top.
+const (
+	minOrientationLines = 3     // Text lines needed to judge a page
+	minInvertedScore    = 0.25  // Imbalance toward the bottom needed to turn a page over
+	lineInkFraction     = 0.005 // Dark pixels per row, as a fraction of width, that make a row part of a line
+	minLineHeight       = 4     // Shorter runs of rows are specks, not lines
+)
+
+// orientationScore measures how upright the text lines in a projection
+// profile look, from -1 (upside down) to 1 (upright), and reports how many
+// lines it judged. Each line's ink above its core band counts for upright
+// and ink below it against. Ink present in every row, such as vertical rule
+// lines, is discounted first.
+func orientationScore(profile []int, width int) (score float64, lines int) {
+	if len(profile) == 0 {
+		return 0, 0
+	}
+	sorted := slices.Clone(profile)
+	slices.Sort(sorted)
+	baseline := sorted[len(sorted)/2]
+	ink := func(y int) int { return max(profile[y]-baseline, 0) }
+	minInk := max(1, int(float64(width)*lineInkFraction))
+
+	var above, below int
+	for y := 0; y < len(profile); {
+		if ink(y) < minInk {
+			y++
+			continue
+		}
+		start := y
+		for y < len(profile) && ink(y) >= minInk {
+			y++
+		}
+		end := y
+		if end-start < minLineHeight {
+			continue
+		}
+
+		// The core band is the run from the first to the last row carrying
+		// at least half the line's peak ink.
+		peak := 0
+		for i := start; i < end; i++ {
+			peak = max(peak, ink(i))
+		}
+		core0, core1 := start, end-1
+		for ink(core0)*2 < peak {
+			core0++
+		}
+		for ink(core1)*2 < peak {
+			core1--
+		}
+		for i := start; i < core0; i++ {
+			above += ink(i)
+		}
+		for i := core1 + 1; i < end; i++ {
+			below += ink(i)
+		}
+		lines++
+	}
+	if above+below == 0 {
+		return 0, lines
+	}
+	return float64(above-below) / float64(above+below), lines
+}
+
+// rotate180 returns img turned upside down.
+func rotate180(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	// Source → destination: mirror both axes about the center.
+	s2d := f64.Aff3{
+		-1, 0, float64(b.Max.X),
+		0, -1, float64(b.Max.Y),
+	}
+	xdraw.NearestNeighbor.Transform(dst, s2d, img, b, xdraw.Src, nil)
+	return dst
+}
+
+// orient turns img the right way up when its text lines clearly look upside
+// down, reporting whether it did. Pages with too few lines to judge, or
+// without a clear imbalance, are left as they are.
+func orient(img image.Image, threshold uint8) (image.Image, bool) {
+	b := img.Bounds()
+	score, lines := orientationScore(projectionProfile(img, b, threshold), b.Dx())
+	if lines < minOrientationLines || score > -minInvertedScore {
+		return img, false
+	}
+	return rotate180(img), true
+}
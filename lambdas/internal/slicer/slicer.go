@@ -2,37 +2,86 @@ package slicer
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"image"
+	"image/color"
 	"image/draw"
 	_ "image/gif"
 	"image/jpeg"
-	_ "image/png"
+	"image/png"
 	"io"
 	"log"
 	"os"
 	"os/exec"
+	"runtime"
+	"strconv"
+	"sync"
 
 	_ "golang.org/x/image/bmp"
 	_ "golang.org/x/image/tiff"
 	_ "golang.org/x/image/webp"
+
+	"github.com/projectcloudline/logbook-service/internal/imageutil"
+)
+
+// OutputFormat selects how slice images are encoded.
+type OutputFormat string
+
+const (
+	FormatJPEG OutputFormat = "jpeg" // lossy, quality from Options.JPEGQuality
+	FormatPNG  OutputFormat = "png"  // lossless
+	FormatWebP OutputFormat = "webp" // lossy, quality from Options.JPEGQuality; encoded by libwebp's cwebp
 )
 
+// MIMEType returns the content type for images encoded in format f.
+// The zero value is treated as JPEG.
+func (f OutputFormat) MIMEType() (string, error) {
+	switch f {
+	case "", FormatJPEG:
+		return "image/jpeg", nil
+	case FormatPNG:
+		return "image/png", nil
+	case FormatWebP:
+		return "image/webp", nil
+	default:
+		return "", fmt.Errorf("unsupported output format %q", string(f))
+	}
+}
+
 // Options controls the slicing algorithm.
 type Options struct {
-	DarknessThreshold uint8 // Luma below this = "dark" (default: 128)
-	DilationRadius    int   // Rows to smear +/- (default: 15)
-	MinGapHeight      int   // Min gap rows to split (default: 10)
-	MinSliceHeight    int   // Discard tiny slices (default: 40)
-	Padding           int   // Extra rows above/below cut (default: 15)
-	JPEGQuality       int   // Output quality (default: 85)
+	DarknessThreshold uint8        // Luma below this = "dark" (default: 128)
+	DilationRadius    int          // Rows to smear +/- (default: 15)
+	MinGapHeight      int          // Min gap rows to split (default: 10)
+	MinSliceHeight    int          // Discard tiny slices (default: 40)
+	Padding           int          // Extra rows above/below cut (default: 15)
+	JPEGQuality       int          // Output quality (default: 85)
+	OutputFormat      OutputFormat // Slice encoding (default: jpeg)
+	CWebPPath         string       // cwebp binary for FormatWebP (default: cwebp from PATH)
+	AdaptiveThreshold bool         // Pick the darkness threshold per image via Otsu (default: false)
+	Deskew            bool         // Straighten pages rotated up to ±5° before slicing (default: false)
+	AutoRotate        bool         // Turn pages whose text looks upside down by 180° before slicing (default: false)
+	DropBlankSlices   bool         // Discard slices that are essentially blank (default: true)
+	MaxPixels         int          // Decode pixel budget; larger images are rejected before decoding, 0 = unlimited (default: 24 MP)
+	MinEntryFraction  float64      // Regions shorter than this fraction of the height are absorbed into a neighbor, 0 = default (default: 1/8)
+	PreferMergeDown   bool         // Absorb short regions into the region below, not the nearer one (default: false)
+	ModelJPEGQuality  int          // Quality of a separate JPEG copy for the models, 0 = no copy unless ModelGrayscale (default: 0)
+	ModelGrayscale    bool         // Encode the models' copy as single-channel grayscale, at ModelJPEGQuality or JPEGQuality (default: false)
 }
 
 // Slice represents a cropped strip of the original image.
 type Slice struct {
 	Index     int
-	ImageData []byte // JPEG-encoded
-	Y0, Y1    int    // Crop coords in original
+	ImageData []byte // Encoded in Options.OutputFormat, unless Original
+	MIMEType  string // Content type of ImageData
+	Y0, Y1    int    // Crop rows in original (after deskew, if enabled; mapped back through auto-rotate)
+	// Original reports that the page needed no split and ImageData is the
+	// input bytes themselves, passed through in their own format.
+	Original bool
+	// ModelImageData is a JPEG encoding of the same crop for the models,
+	// when Options asks for one; nil otherwise and for Original slices.
+	ModelImageData []byte
 }
 
 // DefaultOptions returns sensible defaults for logbook page slicing.
@@ -47,9 +96,22 @@ func DefaultOptions() Options {
 		MinSliceHeight:    150,
 		Padding:           15,
 		JPEGQuality:       85,
+		OutputFormat:      FormatJPEG,
+		DropBlankSlices:   true,
+		MaxPixels:         24_000_000,
+		MinEntryFraction:  defaultMinEntryFraction,
 	}
 }
 
+// defaultMinEntryFraction is the share of the page height a region needs
+// to stand as an entry of its own.
+const defaultMinEntryFraction = 1.0 / 8
+
+// blankSliceDarkRatio is the fraction of dark pixels below which a cropped
+// slice is considered blank. It sits under the noise floor used for region
+// detection, so only slices with essentially no ink are dropped.
+const blankSliceDarkRatio = 0.02
+
 // referenceHeight is the image height that DefaultOptions spatial parameters
 // are calibrated against (iPhone portrait photo at ~4032x3024).
 const referenceHeight = 3024
@@ -76,25 +138,154 @@ func scaleToHeight(opts Options, height int) Options {
 
 // SliceImage decodes an image and splits it into horizontal strips at blank
 // gaps between entries. If fewer than 2 regions are detected, the full image
-// is returned as a single slice.
+// is returned as a single slice. Input formats are those detect supports.
+func SliceImage(imageBytes []byte, opts Options) ([]Slice, error) {
+	mimeType, err := opts.OutputFormat.MIMEType()
+	if err != nil {
+		return nil, err
+	}
+
+	d, err := detect(imageBytes, opts)
+	if err != nil {
+		return nil, err
+	}
+	img, opts := d.img, d.opts
+	bounds := img.Bounds()
+	width := bounds.Dx()
+	height := bounds.Dy()
+
+	// Report crop rows against the image as given: one turned 180° by
+	// AutoRotate counts them from the other end.
+	origRows := func(y0, y1 int) (int, int) {
+		if d.flipped {
+			return height - y1, height - y0
+		}
+		return y0, y1
+	}
+
+	// Crop each window and encode in the output format.
+	var slices []Slice
+	for idx, w := range d.windows() {
+		cropRect := image.Rect(bounds.Min.X, bounds.Min.Y+w[0], bounds.Min.X+width, bounds.Min.Y+w[1])
+		data, modelData, err := encodeSlice(img, cropRect, opts)
+		if err != nil {
+			return nil, fmt.Errorf("encode slice %d: %w", idx, err)
+		}
+		y0, y1 := origRows(w[0], w[1])
+		slices = append(slices, Slice{Index: idx, ImageData: data, MIMEType: mimeType, Y0: y0, Y1: y1, ModelImageData: modelData})
+	}
+
+	// Fewer than 2 regions, or every region was filtered out — fall back to
+	// the full image, as given when it can stand in for a re-encode.
+	if len(slices) == 0 {
+		if origMIME, ok := d.passthroughMIME(imageBytes); ok {
+			return []Slice{{Index: 0, ImageData: imageBytes, MIMEType: origMIME, Y0: 0, Y1: height, Original: true}}, nil
+		}
+		data, modelData, err := encodeSlice(img, bounds, opts)
+		if err != nil {
+			return nil, fmt.Errorf("encode full image: %w", err)
+		}
+		return []Slice{{Index: 0, ImageData: data, MIMEType: mimeType, Y0: 0, Y1: height, ModelImageData: modelData}}, nil
+	}
+
+	return slices, nil
+}
+
+// detection is everything SliceImage works out about an image before it
+// crops anything. Rows are those of the decoded image, after any deskew and
+// auto-rotation.
+type detection struct {
+	img  image.Image
+	opts Options // spatial parameters scaled to the decoded height
+
+	threshold        uint8
+	angle            float64
+	flipped          bool  // turned 180° by AutoRotate
+	darkRows         []int // dark pixels per row
+	smoothed         []int // darkRows after the noise floor and smoothing
+	noiseFloor       int
+	contentThreshold int
+	minEntryHeight   int
+	found            [][2]int // content regions in smoothed
+	regions          [][2]int // found, with small regions absorbed
+	converted        bool     // decoded from an external JPEG conversion
+}
+
+// passthroughFormats are the decoded formats whose bytes a whole-image slice
+// may carry unchanged, with their content types. Others (GIF, BMP, TIFF and
+// externally converted formats) are re-encoded since extraction models don't
+// all accept them.
+var passthroughFormats = map[string]string{
+	"jpeg": "image/jpeg",
+	"png":  "image/png",
+	"webp": "image/webp",
+}
+
+// passthroughMIME returns the content type imageBytes can be passed through
+// with as the whole page. It can't when detection changed the pixels, by
+// deskewing or rotating, or the format isn't one of passthroughFormats.
+func (d *detection) passthroughMIME(imageBytes []byte) (string, bool) {
+	if d.converted || d.angle != 0 || d.flipped {
+		return "", false
+	}
+	_, format, err := image.DecodeConfig(bytes.NewReader(imageBytes))
+	if err != nil {
+		return "", false
+	}
+	mimeType, ok := passthroughFormats[format]
+	return mimeType, ok
+}
+
+// detect decodes an image and finds its content regions.
 //
 // Supports JPEG, PNG, GIF, BMP, TIFF, and WebP natively. For HEIC/HEIF and
 // other formats not decodable by Go, it attempts conversion to JPEG via
 // external tools (sips on macOS, magick/convert on Linux).
-func SliceImage(imageBytes []byte, opts Options) ([]Slice, error) {
-	img, _, err := image.Decode(bytes.NewReader(imageBytes))
+func detect(imageBytes []byte, opts Options) (*detection, error) {
+	// Dimensions are checked before the full decode so very large scans are
+	// rejected instead of exhausting memory.
+	img, err := imageutil.DecodeBounded(imageBytes, opts.MaxPixels)
+	if errors.Is(err, imageutil.ErrImageTooLarge) {
+		return nil, err
+	}
+	native := err == nil
 	if err != nil {
 		// Native decode failed — try converting via external tool.
 		converted, convErr := convertToJPEG(imageBytes)
 		if convErr != nil {
 			return nil, fmt.Errorf("decode image: %w (conversion also failed: %v)", err, convErr)
 		}
-		img, _, err = image.Decode(bytes.NewReader(converted))
+		img, err = imageutil.DecodeBounded(converted, opts.MaxPixels)
 		if err != nil {
 			return nil, fmt.Errorf("decode converted image: %w", err)
 		}
 		log.Printf("slicer: converted non-native image format to JPEG (%d → %d bytes)", len(imageBytes), len(converted))
 	}
+	d := &detection{converted: !native}
+
+	// The adaptive threshold separates ink from paper even when the page
+	// background is shadowed or yellowed below the fixed threshold.
+	d.threshold = opts.DarknessThreshold
+	if opts.AdaptiveThreshold {
+		d.threshold = otsuThreshold(lumaHistogram(img, img.Bounds()))
+	}
+
+	// Rotated pages smear the projection profile and merge adjacent
+	// entries, so straighten them first.
+	if opts.Deskew {
+		if img, d.angle = deskew(img, d.threshold); d.angle != 0 {
+			log.Printf("slicer: deskewed page by %.2f°", d.angle)
+		}
+	}
+	// Upside-down pages slice as well as upright ones but read badly, and
+	// their entries come out last first. Judging after deskew keeps the
+	// text lines sharp in the profile.
+	if opts.AutoRotate {
+		if img, d.flipped = orient(img, d.threshold); d.flipped {
+			log.Printf("slicer: page looks upside down, rotated 180°")
+		}
+	}
+	d.img = img
 
 	bounds := img.Bounds()
 	width := bounds.Dx()
@@ -102,20 +293,21 @@ func SliceImage(imageBytes []byte, opts Options) ([]Slice, error) {
 
 	// Scale spatial parameters to the actual image height so the algorithm
 	// works consistently across different resolutions (phone cameras, scanners, etc).
-	opts = scaleToHeight(opts, height)
+	d.opts = scaleToHeight(opts, height)
 
 	// Step 1: Compute vertical projection profile — count dark pixels per row.
-	profile := projectionProfile(img, bounds, opts.DarknessThreshold)
+	profile := projectionProfile(img, bounds, d.threshold)
+	d.darkRows = append([]int(nil), profile...)
 
 	// Step 2: Subtract noise floor. Real-world photos of logbooks always have
 	// dark pixels from table grid lines, binding shadows, and sensor noise.
 	// We use 7% of image width as the floor: this zeroes out both pure
 	// background noise (2-4% of width) and empty table rows with vertical
 	// grid lines (5-7% of width). Only actual text content (8%+) survives.
-	noiseFloor := width * 7 / 100
+	d.noiseFloor = width * 7 / 100
 	for i, v := range profile {
-		if v > noiseFloor {
-			profile[i] = v - noiseFloor
+		if v > d.noiseFloor {
+			profile[i] = v - d.noiseFloor
 		} else {
 			profile[i] = 0
 		}
@@ -126,39 +318,46 @@ func SliceImage(imageBytes []byte, opts Options) ([]Slice, error) {
 	// (which stay non-zero because surrounding content contributes to the
 	// average) from wide between-entry gaps (which average to zero because
 	// all rows in the window are empty).
-	smoothed := smoothProfile(profile, opts.DilationRadius)
+	d.smoothed = smoothProfile(profile, d.opts.DilationRadius)
 
 	// Step 4: Apply content threshold. After the aggressive noise floor and
 	// smoothing, remaining non-zero values represent genuine text content.
 	// A low threshold catches weak content (like aircraft info headers) that
 	// the smoothing reduces in amplitude.
-	contentThreshold := width / 100 // ~1% of width
+	d.contentThreshold = width / 100 // ~1% of width
 
 	// Step 5: Find gap regions (contiguous runs below threshold in smoothed profile).
-	regions := findRegions(smoothed, height, opts.MinGapHeight, contentThreshold)
+	d.found = findRegions(d.smoothed, height, d.opts.MinGapHeight, d.contentThreshold)
 
 	// Step 6: Absorb small regions into neighbors. Logbook entries have an
 	// aircraft info header above the entry text, sometimes separated by a gap
 	// wider than the gap between consecutive entries. This merges orphaned
-	// aircraft info sections and tiny fragments back into the nearest entry.
-	minEntryHeight := height / 8
-	regions = absorbSmallRegions(regions, minEntryHeight)
+	// aircraft info sections and tiny fragments back into the nearest entry,
+	// or the entry below with PreferMergeDown.
+	fraction := d.opts.MinEntryFraction
+	if fraction <= 0 {
+		fraction = defaultMinEntryFraction
+	}
+	d.minEntryHeight = int(float64(height) * fraction)
+	d.regions = absorbSmallRegions(d.found, d.minEntryHeight, d.opts.PreferMergeDown)
 
-	// If fewer than 2 regions, return the full image as one slice.
-	if len(regions) < 2 {
-		data, err := encodeJPEG(img, bounds, opts.JPEGQuality)
-		if err != nil {
-			return nil, fmt.Errorf("encode full image: %w", err)
-		}
-		return []Slice{{Index: 0, ImageData: data, Y0: 0, Y1: height}}, nil
+	return d, nil
+}
+
+// windows returns the rows SliceImage crops: each region with padding,
+// minus those too short or blank. It is empty when the image should be kept
+// whole.
+func (d *detection) windows() [][2]int {
+	if len(d.regions) < 2 {
+		return nil
 	}
+	width := d.img.Bounds().Dx()
+	height := d.img.Bounds().Dy()
 
-	// Step 7: Crop each region with padding and encode as JPEG.
-	var slices []Slice
-	idx := 0
-	for _, r := range regions {
-		y0 := r[0] - opts.Padding
-		y1 := r[1] + opts.Padding
+	var windows [][2]int
+	for _, r := range d.regions {
+		y0 := r[0] - d.opts.Padding
+		y1 := r[1] + d.opts.Padding
 		if y0 < 0 {
 			y0 = 0
 		}
@@ -166,28 +365,53 @@ func SliceImage(imageBytes []byte, opts Options) ([]Slice, error) {
 			y1 = height
 		}
 
-		if y1-y0 < opts.MinSliceHeight {
+		if y1-y0 < d.opts.MinSliceHeight {
 			continue
 		}
 
-		cropRect := image.Rect(bounds.Min.X, bounds.Min.Y+y0, bounds.Min.X+width, bounds.Min.Y+y1)
-		data, err := encodeJPEG(img, cropRect, opts.JPEGQuality)
-		if err != nil {
-			return nil, fmt.Errorf("encode slice %d: %w", idx, err)
+		// Padding and smoothing can leave slices with no real content; each
+		// would still cost an extraction call and an upload.
+		if d.opts.DropBlankSlices && isBlank(d.darkRows[y0:y1], width) {
+			continue
 		}
-		slices = append(slices, Slice{Index: idx, ImageData: data, Y0: y0, Y1: y1})
-		idx++
+		windows = append(windows, [2]int{y0, y1})
 	}
+	return windows
+}
 
-	if len(slices) == 0 {
-		data, err := encodeJPEG(img, bounds, opts.JPEGQuality)
-		if err != nil {
-			return nil, fmt.Errorf("encode full image: %w", err)
-		}
-		return []Slice{{Index: 0, ImageData: data, Y0: 0, Y1: height}}, nil
+// isBlank reports whether rows (dark-pixel counts per row) have a mean dark
+// ratio below blankSliceDarkRatio.
+func isBlank(rows []int, width int) bool {
+	if len(rows) == 0 || width == 0 {
+		return true
+	}
+	dark := 0
+	for _, n := range rows {
+		dark += n
 	}
+	return float64(dark)/float64(len(rows)*width) < blankSliceDarkRatio
+}
 
-	return slices, nil
+// ContentRatio decodes an image and returns the share of its pixels that are
+// ink above the per-row noise floor SliceImage uses. Paper texture, empty
+// grid rows and sensor noise fall under the floor, so blank pages come out
+// at or near zero.
+func ContentRatio(imageBytes []byte, opts Options) (float64, error) {
+	d, err := detect(imageBytes, opts)
+	if err != nil {
+		return 0, err
+	}
+	b := d.img.Bounds()
+	if b.Dx() == 0 || b.Dy() == 0 {
+		return 0, nil
+	}
+	content := 0
+	for _, n := range d.darkRows {
+		if n > d.noiseFloor {
+			content += n - d.noiseFloor
+		}
+	}
+	return float64(content) / float64(b.Dx()*b.Dy()), nil
 }
 
 // convertToJPEG attempts to convert image bytes to JPEG using external tools.
@@ -214,7 +438,7 @@ func convertToJPEG(imageBytes []byte) ([]byte, error) {
 			continue
 		}
 
-		result, err := runConverter(path, conv.args, imageBytes)
+		result, err := runConverter(path, conv.args, imageBytes, ".jpg")
 		if err != nil {
 			log.Printf("slicer: %s conversion failed: %v", conv.name, err)
 			continue
@@ -225,8 +449,9 @@ func convertToJPEG(imageBytes []byte) ([]byte, error) {
 	return nil, fmt.Errorf("no image converter available (tried sips, magick, convert)")
 }
 
-// runConverter writes input to a temp file, runs the converter, reads the output.
-func runConverter(bin string, argsFn func(string, string) []string, imageBytes []byte) ([]byte, error) {
+// runConverter writes input to a temp file, runs the converter, reads the
+// output, which it names with outExt.
+func runConverter(bin string, argsFn func(string, string) []string, imageBytes []byte, outExt string) ([]byte, error) {
 	inFile, err := os.CreateTemp("", "slicer-in-*")
 	if err != nil {
 		return nil, fmt.Errorf("create temp input: %w", err)
@@ -239,7 +464,7 @@ func runConverter(bin string, argsFn func(string, string) []string, imageBytes [
 	}
 	inFile.Close()
 
-	outPath := inFile.Name() + ".jpg"
+	outPath := inFile.Name() + outExt
 	defer os.Remove(outPath)
 
 	args := argsFn(inFile.Name(), outPath)
@@ -257,25 +482,131 @@ func runConverter(bin string, argsFn func(string, string) []string, imageBytes [
 	return io.ReadAll(outFile)
 }
 
-// projectionProfile counts dark pixels per row.
+// encodeWebP encodes img as a lossy WebP with libwebp's cwebp, since
+// golang.org/x/image only ships a WebP decoder. The crop is handed to cwebp
+// as a quickly encoded PNG.
+func encodeWebP(w io.Writer, img image.Image, opts Options) error {
+	bin := opts.CWebPPath
+	if bin == "" {
+		bin = "cwebp"
+	}
+	path, err := exec.LookPath(bin)
+	if err != nil {
+		return fmt.Errorf("encode webp: %w", err)
+	}
+	var in bytes.Buffer
+	enc := png.Encoder{CompressionLevel: png.BestSpeed}
+	if err := enc.Encode(&in, img); err != nil {
+		return err
+	}
+	quality := strconv.Itoa(opts.JPEGQuality)
+	data, err := runConverter(path, func(inPath, outPath string) []string {
+		return []string{"-quiet", "-q", quality, inPath, "-o", outPath}
+	}, in.Bytes(), ".webp")
+	if err != nil {
+		return fmt.Errorf("encode webp: %w", err)
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// parallelProfilePixels is the image size from which projectionProfile
+// splits rows across goroutines; below it the handoff costs more than it
+// saves.
+const parallelProfilePixels = 1 << 20
+
+// projectionProfile counts dark pixels per row. Large images are counted in
+// parallel bands of rows, one per available CPU.
 func projectionProfile(img image.Image, bounds image.Rectangle, threshold uint8) []int {
-	height := bounds.Dy()
-	width := bounds.Dx()
-	profile := make([]int, height)
+	profile := make([]int, bounds.Dy())
+	workers := min(runtime.GOMAXPROCS(0), len(profile))
+	if workers < 2 || bounds.Dx()*bounds.Dy() < parallelProfilePixels {
+		profileRows(img, bounds, threshold, profile, 0, len(profile))
+		return profile
+	}
 
-	for y := 0; y < height; y++ {
+	var wg sync.WaitGroup
+	band := (len(profile) + workers - 1) / workers
+	for y0 := 0; y0 < len(profile); y0 += band {
+		wg.Add(1)
+		go func(y0, y1 int) {
+			defer wg.Done()
+			profileRows(img, bounds, threshold, profile, y0, y1)
+		}(y0, min(y0+band, len(profile)))
+	}
+	wg.Wait()
+	return profile
+}
+
+// profileRows fills profile[y0:y1] with the dark pixel count of those rows
+// of bounds.
+func profileRows(img image.Image, bounds image.Rectangle, threshold uint8, profile []int, y0, y1 int) {
+	width := bounds.Dx()
+	for y := y0; y < y1; y++ {
 		count := 0
 		for x := 0; x < width; x++ {
-			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
-			// Luma using BT.601 coefficients (values are 16-bit, shift to 8-bit).
-			luma := uint8((19595*(r>>8) + 38470*(g>>8) + 7471*(b>>8) + 1<<15) >> 16)
-			if luma < threshold {
+			if luma(img.At(bounds.Min.X+x, bounds.Min.Y+y)) < threshold {
 				count++
 			}
 		}
 		profile[y] = count
 	}
-	return profile
+}
+
+// luma returns the BT.601 luma of c (values are 16-bit, shift to 8-bit).
+func luma(c color.Color) uint8 {
+	r, g, b, _ := c.RGBA()
+	return uint8((19595*(r>>8) + 38470*(g>>8) + 7471*(b>>8) + 1<<15) >> 16)
+}
+
+// lumaHistogram counts pixels at each luma level.
+func lumaHistogram(img image.Image, bounds image.Rectangle) [256]int {
+	var hist [256]int
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			hist[luma(img.At(x, y))]++
+		}
+	}
+	return hist
+}
+
+// otsuThreshold picks the luma threshold that maximizes the between-class
+// variance of the histogram (Otsu's method). Pixels with luma below the
+// returned value are "dark".
+func otsuThreshold(hist [256]int) uint8 {
+	total := 0
+	sum := 0.0
+	for v, n := range hist {
+		total += n
+		sum += float64(v * n)
+	}
+	if total == 0 {
+		return 128
+	}
+
+	var best uint8 = 128
+	bestVar := -1.0
+	weightDark := 0
+	sumDark := 0.0
+	for t := 0; t < 255; t++ {
+		weightDark += hist[t]
+		if weightDark == 0 {
+			continue
+		}
+		weightLight := total - weightDark
+		if weightLight == 0 {
+			break
+		}
+		sumDark += float64(t * hist[t])
+		meanDark := sumDark / float64(weightDark)
+		meanLight := (sum - sumDark) / float64(weightLight)
+		between := float64(weightDark) * float64(weightLight) * (meanDark - meanLight) * (meanDark - meanLight)
+		if between > bestVar {
+			bestVar = between
+			best = uint8(t + 1)
+		}
+	}
+	return best
 }
 
 // smoothProfile applies a moving average with the given radius.
@@ -367,8 +698,11 @@ func findRegions(dilated []int, height, minGapHeight, contentThreshold int) [][2
 // absorbSmallRegions iteratively merges regions that are too small to be a
 // standalone logbook entry into their nearest neighbor (smallest gap).
 // This handles orphaned aircraft info headers and small fragments that are
-// visually part of an adjacent entry but separated by a gap.
-func absorbSmallRegions(regions [][2]int, minHeight int) [][2]int {
+// visually part of an adjacent entry but separated by a gap. With
+// preferDown, a small region joins the region below it whatever the gaps,
+// since a header belongs to the entry it introduces; only the last region
+// merges upward.
+func absorbSmallRegions(regions [][2]int, minHeight int, preferDown bool) [][2]int {
 	for {
 		// Find smallest region below threshold.
 		smallIdx := -1
@@ -387,7 +721,7 @@ func absorbSmallRegions(regions [][2]int, minHeight int) [][2]int {
 			break // Nothing to merge with.
 		}
 
-		// Find adjacent region with smallest gap.
+		// Find adjacent region with smallest gap, or the one below.
 		mergeWith := -1
 		bestGap := 0
 		if smallIdx > 0 {
@@ -397,7 +731,7 @@ func absorbSmallRegions(regions [][2]int, minHeight int) [][2]int {
 		}
 		if smallIdx < len(regions)-1 {
 			gap := regions[smallIdx+1][0] - regions[smallIdx][1]
-			if mergeWith == -1 || gap < bestGap {
+			if mergeWith == -1 || gap < bestGap || preferDown {
 				mergeWith = smallIdx + 1
 			}
 		}
@@ -431,14 +765,44 @@ func mergeRegions(regions [][2]int, minGap int) [][2]int {
 	return merged
 }
 
-// encodeJPEG crops the image to the given rectangle and encodes as JPEG.
-func encodeJPEG(img image.Image, rect image.Rectangle, quality int) ([]byte, error) {
+// encodeSlice crops the image to the given rectangle and encodes it in
+// opts.OutputFormat, along with the models' JPEG copy when opts asks for one.
+func encodeSlice(img image.Image, rect image.Rectangle, opts Options) (data, modelData []byte, err error) {
 	cropped := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
 	draw.Draw(cropped, cropped.Bounds(), img, rect.Min, draw.Src)
 
 	var buf bytes.Buffer
-	if err := jpeg.Encode(&buf, cropped, &jpeg.Options{Quality: quality}); err != nil {
-		return nil, err
+	switch opts.OutputFormat {
+	case FormatPNG:
+		err = png.Encode(&buf, cropped)
+	case FormatWebP:
+		err = encodeWebP(&buf, cropped, opts)
+	default:
+		err = jpeg.Encode(&buf, cropped, &jpeg.Options{Quality: opts.JPEGQuality})
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if opts.ModelJPEGQuality <= 0 && !opts.ModelGrayscale {
+		return buf.Bytes(), nil, nil
+	}
+	quality := opts.ModelJPEGQuality
+	if quality <= 0 {
+		quality = opts.JPEGQuality
+	}
+	// A grayscale JPEG has a single full-resolution component, so thin
+	// colored strokes aren't smeared by chroma subsampling; ink still stands
+	// out from the paper by its darkness.
+	var modelImg image.Image = cropped
+	if opts.ModelGrayscale {
+		gray := image.NewGray(cropped.Bounds())
+		draw.Draw(gray, gray.Bounds(), cropped, image.Point{}, draw.Src)
+		modelImg = gray
+	}
+	var model bytes.Buffer
+	if err := imageutil.EncodeJPEG(&model, modelImg, quality); err != nil {
+		return nil, nil, err
 	}
-	return buf.Bytes(), nil
+	return buf.Bytes(), model.Bytes(), nil
 }
@@ -2,11 +2,23 @@ package slicer
 
 import (
 	"bytes"
+	"errors"
 	"image"
 	"image/color"
 	"image/draw"
+	"image/gif"
 	"image/jpeg"
+	"image/png"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
 	"testing"
+
+	"golang.org/x/image/webp"
+
+	"github.com/projectcloudline/logbook-service/internal/imageutil"
 )
 
 // newTestImage creates a white image with horizontal dark bands for testing.
@@ -174,6 +186,136 @@ func TestSliceImage_ThreeBands(t *testing.T) {
 	}
 }
 
+func TestSliceImage_OutputFormats(t *testing.T) {
+	img := newTestImage(200, 600, [][2]int{
+		{50, 130},
+		{230, 330},
+		{430, 530},
+	})
+	jpegData := encodeTestJPEG(img)
+
+	tests := []struct {
+		format   OutputFormat
+		wantMIME string
+		decode   func([]byte) (image.Image, error)
+	}{
+		{"", "image/jpeg", func(b []byte) (image.Image, error) { return jpeg.Decode(bytes.NewReader(b)) }},
+		{FormatJPEG, "image/jpeg", func(b []byte) (image.Image, error) { return jpeg.Decode(bytes.NewReader(b)) }},
+		{FormatPNG, "image/png", func(b []byte) (image.Image, error) { return png.Decode(bytes.NewReader(b)) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.OutputFormat = tt.format
+
+			slices, err := SliceImage(jpegData, opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(slices) != 3 {
+				t.Fatalf("got %d slices, want 3", len(slices))
+			}
+
+			for i, s := range slices {
+				if s.MIMEType != tt.wantMIME {
+					t.Errorf("slice %d MIMEType = %q, want %q", i, s.MIMEType, tt.wantMIME)
+				}
+				decoded, err := tt.decode(s.ImageData)
+				if err != nil {
+					t.Fatalf("slice %d does not decode as %s: %v", i, tt.wantMIME, err)
+				}
+				if b := decoded.Bounds(); b.Dx() != 200 || b.Dy() != s.Y1-s.Y0 {
+					t.Errorf("slice %d size = %dx%d, want 200x%d", i, b.Dx(), b.Dy(), s.Y1-s.Y0)
+				}
+			}
+		})
+	}
+}
+
+func TestSliceImage_UnsupportedOutputFormat(t *testing.T) {
+	opts := DefaultOptions()
+	opts.OutputFormat = "avif"
+	if _, err := SliceImage(encodeTestJPEG(newTestImage(50, 50, nil)), opts); err == nil {
+		t.Fatal("expected error for unsupported output format")
+	}
+}
+
+func TestSliceImage_WebP(t *testing.T) {
+	if _, err := exec.LookPath("cwebp"); err != nil {
+		t.Skip("cwebp not found in PATH")
+	}
+	img := newTestImage(200, 600, [][2]int{
+		{50, 130},
+		{230, 330},
+		{430, 530},
+	})
+	opts := DefaultOptions()
+	opts.OutputFormat = FormatWebP
+
+	slices, err := SliceImage(encodeTestJPEG(img), opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(slices) != 3 {
+		t.Fatalf("got %d slices, want 3", len(slices))
+	}
+	for i, s := range slices {
+		if s.MIMEType != "image/webp" {
+			t.Errorf("slice %d MIMEType = %q, want image/webp", i, s.MIMEType)
+		}
+		decoded, err := webp.Decode(bytes.NewReader(s.ImageData))
+		if err != nil {
+			t.Fatalf("slice %d does not decode as WebP: %v", i, err)
+		}
+		if b := decoded.Bounds(); b.Dx() != 200 || b.Dy() != s.Y1-s.Y0 {
+			t.Errorf("slice %d size = %dx%d, want 200x%d", i, b.Dx(), b.Dy(), s.Y1-s.Y0)
+		}
+	}
+}
+
+// webpFixture is a 2x2 lossless WebP.
+var webpFixture = []byte("RIFF\x18\x00\x00\x00WEBPVP8L\v\x00\x00\x00/\x01@\x00\x00\xc5\xfcG\xf4?\x1c\x00")
+
+func TestSliceImage_WebPEncoder(t *testing.T) {
+	dir := t.TempDir()
+	fixture := filepath.Join(dir, "fixture.webp")
+	if err := os.WriteFile(fixture, webpFixture, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// The fake cwebp checks it was asked for a quiet encode at the
+	// configured quality and writes the fixture as its output.
+	cwebp := filepath.Join(dir, "cwebp")
+	script := "#!/bin/sh\n[ \"$1 $2 $3\" = \"-quiet -q 70\" ] && [ \"$5\" = -o ] || exit 1\ncp " + fixture + " \"$6\"\n"
+	if err := os.WriteFile(cwebp, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	img := newTestImage(200, 600, [][2]int{{50, 130}, {430, 530}})
+	opts := DefaultOptions()
+	opts.OutputFormat = FormatWebP
+	opts.JPEGQuality = 70
+	opts.CWebPPath = cwebp
+
+	slices, err := SliceImage(encodeTestJPEG(img), opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(slices) != 2 {
+		t.Fatalf("got %d slices, want 2", len(slices))
+	}
+	for i, s := range slices {
+		if s.MIMEType != "image/webp" || !bytes.Equal(s.ImageData, webpFixture) {
+			t.Errorf("slice %d = %s of %d bytes, want the cwebp output", i, s.MIMEType, len(s.ImageData))
+		}
+	}
+
+	opts.CWebPPath = filepath.Join(dir, "missing")
+	if _, err := SliceImage(encodeTestJPEG(img), opts); err == nil {
+		t.Error("expected an error without a cwebp binary")
+	}
+}
+
 func TestSliceImage_UniformWhite(t *testing.T) {
 	// All-white image should return 1 slice (the full image).
 	img := newTestImage(200, 400, nil)
@@ -405,7 +547,7 @@ func TestAbsorbSmallRegions(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := absorbSmallRegions(tt.regions, tt.minHeight)
+			got := absorbSmallRegions(tt.regions, tt.minHeight, false)
 			if len(got) != len(tt.want) {
 				t.Fatalf("got %d regions, want %d: %v", len(got), len(tt.want), got)
 			}
@@ -418,6 +560,83 @@ func TestAbsorbSmallRegions(t *testing.T) {
 	}
 }
 
+func TestAbsorbSmallRegions_PreferMergeDown(t *testing.T) {
+	tests := []struct {
+		name       string
+		regions    [][2]int
+		minHeight  int
+		preferDown bool
+		want       [][2]int
+	}{
+		{
+			name:      "header nearer the entry above merges up by default",
+			regions:   [][2]int{{0, 999}, {1030, 1077}, {1213, 2309}, {2354, 3024}},
+			minHeight: 378,
+			// Header (47 rows): gap above = 31, gap below = 136.
+			want: [][2]int{{0, 1077}, {1213, 2309}, {2354, 3024}},
+		},
+		{
+			name:       "header nearer the entry above merges down with the bias",
+			regions:    [][2]int{{0, 999}, {1030, 1077}, {1213, 2309}, {2354, 3024}},
+			minHeight:  378,
+			preferDown: true,
+			want:       [][2]int{{0, 999}, {1030, 2309}, {2354, 3024}},
+		},
+		{
+			name:       "documented layout is unchanged by the bias",
+			regions:    [][2]int{{0, 999}, {1084, 1131}, {1213, 1447}, {1523, 2309}, {2354, 3024}},
+			minHeight:  378,
+			preferDown: true,
+			want:       [][2]int{{0, 999}, {1084, 2309}, {2354, 3024}},
+		},
+		{
+			name:       "last region still merges up",
+			regions:    [][2]int{{0, 999}, {1084, 2309}, {2354, 2400}},
+			minHeight:  378,
+			preferDown: true,
+			want:       [][2]int{{0, 999}, {1084, 2400}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := absorbSmallRegions(tt.regions, tt.minHeight, tt.preferDown)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d regions, want %d: %v", len(got), len(tt.want), got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("region %d = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDiagnose_MinEntryFraction(t *testing.T) {
+	img := newTestImage(200, 600, [][2]int{{50, 130}, {230, 330}, {430, 530}})
+	data := encodeTestJPEG(img)
+
+	for _, tt := range []struct {
+		fraction float64
+		want     int
+	}{
+		{0, 75}, // unset falls back to 1/8
+		{defaultMinEntryFraction, 75},
+		{0.25, 150},
+	} {
+		opts := DefaultOptions()
+		opts.MinEntryFraction = tt.fraction
+		d, err := Diagnose(data, opts)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if d.MinEntryHeight != tt.want {
+			t.Errorf("MinEntryFraction %v: MinEntryHeight = %d, want %d", tt.fraction, d.MinEntryHeight, tt.want)
+		}
+	}
+}
+
 func TestSliceImage_GrayscaleDetection(t *testing.T) {
 	// Test with gray pixels near the threshold boundary.
 	img := newTestImage(100, 200, nil)
@@ -444,3 +663,710 @@ func TestSliceImage_GrayscaleDetection(t *testing.T) {
 		t.Errorf("got %d slices, want 2", len(slices))
 	}
 }
+
+func TestOtsuThreshold(t *testing.T) {
+	var hist [256]int
+	hist[40] = 300
+	hist[110] = 1000
+
+	got := otsuThreshold(hist)
+	if got <= 40 || got > 110 {
+		t.Errorf("threshold = %d, want in (40, 110]", got)
+	}
+
+	var empty [256]int
+	if got := otsuThreshold(empty); got != 128 {
+		t.Errorf("empty histogram threshold = %d, want 128", got)
+	}
+}
+
+func TestSliceImage_AdaptiveThreshold(t *testing.T) {
+	// Shadowed page: background luma ~100 sits below the fixed threshold of
+	// 128, so every row looks dark and the fixed path can't find the gaps.
+	img := image.NewRGBA(image.Rect(0, 0, 200, 600))
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.Gray{Y: 100}}, image.Point{}, draw.Src)
+	for _, b := range [][2]int{{50, 130}, {230, 330}, {430, 530}} {
+		draw.Draw(img, image.Rect(0, b[0], 200, b[1]), &image.Uniform{color.Gray{Y: 30}}, image.Point{}, draw.Src)
+	}
+	jpegData := encodeTestJPEG(img)
+
+	fixed, err := SliceImage(jpegData, DefaultOptions())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(fixed) != 1 {
+		t.Errorf("fixed threshold: got %d slices, want 1 (background reads as ink)", len(fixed))
+	}
+
+	opts := DefaultOptions()
+	opts.AdaptiveThreshold = true
+	adaptive, err := SliceImage(jpegData, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(adaptive) != 3 {
+		t.Errorf("adaptive threshold: got %d slices, want 3", len(adaptive))
+	}
+}
+
+func TestEstimateSkew(t *testing.T) {
+	img := newTestImage(1200, 800, [][2]int{{100, 160}, {300, 360}, {500, 560}})
+
+	for _, deg := range []float64{-3, 0, 2} {
+		rotated := rotate(img, deg)
+		got := estimateSkew(rotated, rotated.Bounds(), 128)
+		if math.Abs(got-deg) > 0.2 {
+			t.Errorf("rotated by %.1f°: estimated skew %.2f°", deg, got)
+		}
+	}
+}
+
+func TestSliceImage_Deskew(t *testing.T) {
+	// Full-width bands separated by 100-row gaps. Rotating 3° tilts each band
+	// by ~126 rows across the page, which closes the gaps in the profile.
+	img := newTestImage(2400, 1000, [][2]int{
+		{90, 310},
+		{410, 630},
+		{730, 950},
+	})
+	jpegData := encodeTestJPEG(rotate(img, 3))
+
+	skewed, err := SliceImage(jpegData, DefaultOptions())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(skewed) == 3 {
+		t.Errorf("without deskew: got 3 slices, expected the rotation to merge bands")
+	}
+
+	opts := DefaultOptions()
+	opts.Deskew = true
+	slices, err := SliceImage(jpegData, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(slices) != 3 {
+		t.Errorf("with deskew: got %d slices, want 3", len(slices))
+	}
+}
+
+func TestIsBlank(t *testing.T) {
+	tests := []struct {
+		name string
+		rows []int
+		want bool
+	}{
+		{"empty", nil, true},
+		{"all white", []int{0, 0, 0, 0}, true},
+		{"faint specks", []int{0, 3, 0, 2}, true},
+		{"text", []int{0, 40, 60, 10}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isBlank(tt.rows, 100); got != tt.want {
+				t.Errorf("isBlank = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSliceImage_DropBlankSlices(t *testing.T) {
+	// Two solid bands plus a tall region of sparse specks: every 20th row is
+	// 35% dark, which is enough for region detection but averages <2% ink.
+	img := newTestImage(200, 1200, [][2]int{{100, 350}, {850, 1100}})
+	for y := 500; y < 750; y += 20 {
+		for x := 0; x < 70; x++ {
+			img.Set(x, y, color.Black)
+		}
+	}
+	jpegData := encodeTestJPEG(img)
+
+	opts := DefaultOptions()
+	opts.DropBlankSlices = false
+	kept, err := SliceImage(jpegData, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(kept) != 3 {
+		t.Fatalf("without blank filtering: got %d slices, want 3", len(kept))
+	}
+
+	slices, err := SliceImage(jpegData, DefaultOptions())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(slices) != 2 {
+		t.Fatalf("got %d slices, want 2", len(slices))
+	}
+	for i, s := range slices {
+		if s.Index != i {
+			t.Errorf("slice %d has Index=%d", i, s.Index)
+		}
+		if s.Y0 > 500 && s.Y1 < 850 {
+			t.Errorf("blank region [%d,%d) was not dropped", s.Y0, s.Y1)
+		}
+	}
+}
+
+func TestSliceImage_DropBlankSlices_FallsBackToFullImage(t *testing.T) {
+	// Only sparse specks: every region is blank, so the full page is returned.
+	img := newTestImage(200, 1200, nil)
+	for _, start := range []int{100, 700} {
+		for y := start; y < start+250; y += 20 {
+			for x := 0; x < 70; x++ {
+				img.Set(x, y, color.Black)
+			}
+		}
+	}
+
+	jpegData := encodeTestJPEG(img)
+
+	opts := DefaultOptions()
+	opts.DropBlankSlices = false
+	if kept, err := SliceImage(jpegData, opts); err != nil || len(kept) != 2 {
+		t.Fatalf("without blank filtering: got %d slices (err %v), want 2", len(kept), err)
+	}
+
+	slices, err := SliceImage(jpegData, DefaultOptions())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(slices) != 1 || slices[0].Y0 != 0 || slices[0].Y1 != 1200 {
+		t.Fatalf("got %d slices, want the full image", len(slices))
+	}
+}
+
+func TestSliceImage_MaxPixels(t *testing.T) {
+	img := newTestImage(200, 600, [][2]int{
+		{50, 130},
+		{230, 330},
+		{430, 530},
+	})
+	jpegData := encodeTestJPEG(img)
+
+	// 120,000 pixels fit a budget of exactly that and slice as usual.
+	opts := DefaultOptions()
+	opts.MaxPixels = 120000
+	slices, err := SliceImage(jpegData, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(slices) != 3 {
+		t.Fatalf("got %d slices, want 3", len(slices))
+	}
+
+	// Any more than the budget is rejected before decoding.
+	opts.MaxPixels = 119999
+	if _, err := SliceImage(jpegData, opts); !errors.Is(err, imageutil.ErrImageTooLarge) {
+		t.Errorf("expected ErrImageTooLarge, got %v", err)
+	}
+}
+
+func TestDiagnose_ThreeBands(t *testing.T) {
+	img := newTestImage(200, 600, [][2]int{
+		{50, 130},
+		{230, 330},
+		{430, 530},
+	})
+
+	d, err := Diagnose(encodeTestJPEG(img), DefaultOptions())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if d.Width != 200 || d.Height != 600 || len(d.Profile) != 600 || len(d.Smoothed) != 600 {
+		t.Errorf("size = %dx%d, profile %d rows, smoothed %d rows", d.Width, d.Height, len(d.Profile), len(d.Smoothed))
+	}
+	if want := scaleToHeight(DefaultOptions(), 600); d.Options != want {
+		t.Errorf("options = %+v, want scaled %+v", d.Options, want)
+	}
+	if len(d.Absorbed) != 3 || len(d.Slices) != 3 {
+		t.Fatalf("absorbed %d regions, kept %d slices, want 3 each", len(d.Absorbed), len(d.Slices))
+	}
+	prev := 0
+	for i, r := range d.Absorbed {
+		if r.Gap != r.Y0-prev || r.Height() <= 0 {
+			t.Errorf("region %d = %+v, gap should follow row %d", i, r, prev)
+		}
+		prev = r.Y1
+	}
+
+	// Diagnose must agree with what SliceImage actually cuts.
+	slices, err := SliceImage(encodeTestJPEG(img), DefaultOptions())
+	if err != nil {
+		t.Fatalf("slice: %v", err)
+	}
+	for i, s := range slices {
+		if s.Y0 != d.Slices[i].Y0 || s.Y1 != d.Slices[i].Y1 {
+			t.Errorf("slice %d = [%d,%d), diagnostics say %+v", i, s.Y0, s.Y1, d.Slices[i])
+		}
+	}
+}
+
+func TestContentRatio(t *testing.T) {
+	tests := []struct {
+		name     string
+		bands    [][2]int
+		min, max float64
+	}{
+		{name: "blank", max: 0},
+		{name: "one band", bands: [][2]int{{250, 310}}, min: 0.09, max: 0.1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ContentRatio(encodeTestJPEG(newTestImage(200, 600, tt.bands)), DefaultOptions())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			// A fully dark row is 93% ink once the 7% noise floor is taken off.
+			if got < tt.min || got > tt.max {
+				t.Errorf("ContentRatio = %.4f, want in [%.2f, %.2f]", got, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestSliceImage_OriginalPassthrough(t *testing.T) {
+	// A single band leaves the page whole; the PNG comes back untouched.
+	var pngData bytes.Buffer
+	if err := png.Encode(&pngData, newTestImage(200, 300, [][2]int{{100, 200}})); err != nil {
+		t.Fatal(err)
+	}
+
+	slices, err := SliceImage(pngData.Bytes(), DefaultOptions())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(slices) != 1 {
+		t.Fatalf("got %d slices, want 1", len(slices))
+	}
+	s := slices[0]
+	if !s.Original {
+		t.Error("Original = false for an unsplit page")
+	}
+	if s.MIMEType != "image/png" {
+		t.Errorf("MIMEType = %q, want image/png", s.MIMEType)
+	}
+	if !bytes.Equal(s.ImageData, pngData.Bytes()) {
+		t.Error("ImageData is not the original PNG bytes")
+	}
+	if s.Y0 != 0 || s.Y1 != 300 {
+		t.Errorf("bounds = [%d,%d), want [0,300)", s.Y0, s.Y1)
+	}
+}
+
+func TestSliceImage_OriginalNotPassedThrough(t *testing.T) {
+	page := newTestImage(200, 300, [][2]int{{100, 200}})
+
+	t.Run("split page", func(t *testing.T) {
+		img := newTestImage(200, 600, [][2]int{{50, 130}, {230, 330}, {430, 530}})
+		slices, err := SliceImage(encodeTestJPEG(img), DefaultOptions())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, s := range slices {
+			if s.Original {
+				t.Errorf("slice %d marked Original", s.Index)
+			}
+		}
+	})
+
+	t.Run("format models may not accept", func(t *testing.T) {
+		var gifData bytes.Buffer
+		if err := gif.Encode(&gifData, page, nil); err != nil {
+			t.Fatal(err)
+		}
+		slices, err := SliceImage(gifData.Bytes(), DefaultOptions())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(slices) != 1 || slices[0].Original || slices[0].MIMEType != "image/jpeg" {
+			t.Errorf("GIF page: Original = %v, MIMEType = %q; want a JPEG re-encode", slices[0].Original, slices[0].MIMEType)
+		}
+	})
+}
+
+// newTextImage draws entries of text-like lines on a white page: each line
+// has sparse ascender strokes above a dense core band and fewer descenders
+// below it, like handwriting. entries gives each entry's first row and line
+// count; lines are 28 rows tall on a 40 row pitch.
+func newTextImage(width, height int, entries [][2]int) *image.RGBA {
+	img := newTestImage(width, height, nil)
+	for _, e := range entries {
+		for l := 0; l < e[1]; l++ {
+			top := e[0] + l*40
+			for y := top; y < top+28 && y < height; y++ {
+				for x := 0; x < width; x++ {
+					var dark bool
+					switch {
+					case y < top+10: // ascenders
+						dark = x%8 < 2
+					case y < top+22: // core band
+						dark = x%5 < 3
+					default: // descenders
+						dark = x%20 == 0
+					}
+					if dark {
+						img.Set(x, y, color.Black)
+					}
+				}
+			}
+		}
+	}
+	return img
+}
+
+func TestOrientationScore(t *testing.T) {
+	img := newTextImage(400, 1000, [][2]int{{50, 4}, {350, 5}, {690, 6}})
+	upright, lines := orientationScore(projectionProfile(img, img.Bounds(), 128), 400)
+	if lines != 15 {
+		t.Errorf("judged %d lines, want 15", lines)
+	}
+	if upright < minInvertedScore {
+		t.Errorf("upright score = %.2f, want clearly positive", upright)
+	}
+	flipped := rotate180(img)
+	if inverted, _ := orientationScore(projectionProfile(flipped, flipped.Bounds(), 128), 400); inverted > -minInvertedScore {
+		t.Errorf("inverted score = %.2f, want clearly negative", inverted)
+	}
+
+	// Solid bands have no ascenders or descenders to go by.
+	bands := newTestImage(400, 1000, [][2]int{{50, 130}, {230, 330}, {430, 530}})
+	if score, _ := orientationScore(projectionProfile(bands, bands.Bounds(), 128), 400); score != 0 {
+		t.Errorf("solid band score = %.2f, want 0", score)
+	}
+}
+
+func TestSliceImage_AutoRotate(t *testing.T) {
+	// Entries of 4, 5 and 6 lines, so their order shows in the slice heights.
+	img := newTextImage(400, 1000, [][2]int{{50, 4}, {350, 5}, {690, 6}})
+	heights := func(t *testing.T, slices []Slice) []int {
+		t.Helper()
+		if len(slices) != 3 {
+			t.Fatalf("got %d slices, want 3", len(slices))
+		}
+		var hs []int
+		for i, s := range slices {
+			if i > 0 && s.Y0 < slices[i-1].Y1 && slices[i-1].Y0 < s.Y1 {
+				t.Errorf("slice %d [%d,%d) overlaps slice %d", i, s.Y0, s.Y1, i-1)
+			}
+			hs = append(hs, s.Y1-s.Y0)
+		}
+		return hs
+	}
+	ascending := func(hs []int) bool { return hs[0] < hs[1] && hs[1] < hs[2] }
+
+	flipped := encodeTestJPEG(rotate180(img))
+	opts := DefaultOptions()
+	slices, err := SliceImage(flipped, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if hs := heights(t, slices); ascending(hs) {
+		t.Fatalf("without AutoRotate: slice heights %v, expected the flipped order", hs)
+	}
+
+	opts.AutoRotate = true
+	slices, err = SliceImage(flipped, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if hs := heights(t, slices); !ascending(hs) {
+		t.Errorf("with AutoRotate: slice heights %v, want upright order", hs)
+	}
+	// Each slice is upright too.
+	for i, s := range slices {
+		decoded, err := jpeg.Decode(bytes.NewReader(s.ImageData))
+		if err != nil {
+			t.Fatalf("slice %d: %v", i, err)
+		}
+		if score, _ := orientationScore(projectionProfile(decoded, decoded.Bounds(), 128), 400); score <= 0 {
+			t.Errorf("slice %d orientation score = %.2f, want upright", i, score)
+		}
+	}
+	// Coordinates are rows of the page as given, where upright entry i lies
+	// as far from the bottom as it did from the top.
+	for i, e := range [][2]int{{50, 4}, {350, 5}, {690, 6}} {
+		y0, y1 := 1000-(e[0]+e[1]*40-12), 1000-e[0]
+		if s := slices[i]; s.Y0 > y0 || s.Y1 < y1 || s.Y1 > 1000 {
+			t.Errorf("slice %d [%d,%d) does not cover the flipped entry's rows [%d,%d)", i, s.Y0, s.Y1, y0, y1)
+		}
+	}
+
+	// An upright page is left alone.
+	upright, err := SliceImage(encodeTestJPEG(img), opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if hs := heights(t, upright); !ascending(hs) {
+		t.Errorf("upright page: slice heights %v, want upright order", hs)
+	}
+	d, err := Diagnose(encodeTestJPEG(img), opts)
+	if err != nil {
+		t.Fatalf("Diagnose: %v", err)
+	}
+	if d.Flipped {
+		t.Error("upright page was flipped")
+	}
+}
+
+func TestRotate180(t *testing.T) {
+	img := image.NewRGBA(image.Rect(10, 20, 13, 22))
+	img.Set(10, 20, color.Black)
+	img.Set(12, 21, color.White)
+	got := rotate180(img)
+	if b := got.Bounds(); b.Dx() != 3 || b.Dy() != 2 {
+		t.Fatalf("bounds = %v, want 3x2", b)
+	}
+	if c := got.RGBAAt(2, 1); c != (color.RGBA{0, 0, 0, 255}) {
+		t.Errorf("bottom-right = %v, want the black top-left pixel", c)
+	}
+	if c := got.RGBAAt(0, 0); c != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("top-left = %v, want the white bottom-right pixel", c)
+	}
+}
+
+// newLargePage draws a 3000x4000 logbook-like page: entries of text lines
+// with ragged ends, at the size phone photos and scans usually come in.
+func newLargePage() *image.RGBA {
+	const width, height = 3000, 4000
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.White}, image.Point{}, draw.Src)
+	dark := &image.Uniform{color.Gray{Y: 30}}
+	for entry := 0; entry < 8; entry++ {
+		top := 150 + entry*470
+		for line := 0; line < 5; line++ {
+			y := top + line*70
+			end := width - 200 - (entry*37+line*113)%900
+			draw.Draw(img, image.Rect(150, y, end, y+30), dark, image.Point{}, draw.Src)
+		}
+	}
+	return img
+}
+
+func TestProjectionProfile_ParallelMatchesSerial(t *testing.T) {
+	// Enough procs for several bands even on a single-CPU runner.
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	img := newLargePage()
+	// Offset bounds check the parallel bands index rows relative to them.
+	for _, bounds := range []image.Rectangle{img.Bounds(), image.Rect(100, 37, 2900, 3911)} {
+		if bounds.Dx()*bounds.Dy() < parallelProfilePixels {
+			t.Fatalf("bounds %v too small to exercise the parallel path", bounds)
+		}
+		got := projectionProfile(img, bounds, 128)
+		want := make([]int, bounds.Dy())
+		profileRows(img, bounds, 128, want, 0, len(want))
+		if len(got) != len(want) {
+			t.Fatalf("len = %d, want %d", len(got), len(want))
+		}
+		for y := range want {
+			if got[y] != want[y] {
+				t.Fatalf("bounds %v: profile[%d] = %d, want %d", bounds, y, got[y], want[y])
+			}
+		}
+	}
+}
+
+func BenchmarkSliceImage(b *testing.B) {
+	data := encodeTestJPEG(newLargePage())
+	opts := DefaultOptions()
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for b.Loop() {
+		if _, err := SliceImage(data, opts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkProjectionProfile(b *testing.B) {
+	img := newLargePage()
+	b.Run("parallel", func(b *testing.B) {
+		for b.Loop() {
+			projectionProfile(img, img.Bounds(), 128)
+		}
+	})
+	b.Run("serial", func(b *testing.B) {
+		profile := make([]int, img.Bounds().Dy())
+		for b.Loop() {
+			profileRows(img, img.Bounds(), 128, profile, 0, len(profile))
+		}
+	})
+}
+
+func BenchmarkSmoothProfile(b *testing.B) {
+	img := newLargePage()
+	profile := projectionProfile(img, img.Bounds(), 128)
+	radius := scaleToHeight(DefaultOptions(), img.Bounds().Dy()).DilationRadius
+	b.Run("smooth", func(b *testing.B) {
+		for b.Loop() {
+			smoothProfile(profile, radius)
+		}
+	})
+	// The per-element dilation smoothProfile replaced, for comparison.
+	b.Run("dilate", func(b *testing.B) {
+		for b.Loop() {
+			dilateProfile(profile, radius)
+		}
+	})
+}
+
+// lumaQuantDC returns the DC entry of a JPEG's first quantization table,
+// which falls as the encoding quality rises.
+func lumaQuantDC(t *testing.T, data []byte) byte {
+	t.Helper()
+	i := bytes.Index(data, []byte{0xff, 0xdb})
+	if i < 0 || len(data) < i+6 {
+		t.Fatal("no quantization table in JPEG")
+	}
+	return data[i+5]
+}
+
+func TestSliceImage_ModelCopy(t *testing.T) {
+	jpegData := encodeTestJPEG(newTestImage(200, 600, [][2]int{
+		{50, 130},
+		{230, 330},
+		{430, 530},
+	}))
+
+	tests := []struct {
+		name        string
+		quality     int
+		grayscale   bool
+		wantCopy    bool
+		wantQuantDC byte
+	}{
+		{name: "none"},
+		// Quality 98 scales the luma DC step of 16 down to 1; 85 gives 5.
+		{name: "quality", quality: 98, wantCopy: true, wantQuantDC: 1},
+		{name: "grayscale", grayscale: true, wantCopy: true, wantQuantDC: 5},
+		{name: "grayscale at quality", quality: 98, grayscale: true, wantCopy: true, wantQuantDC: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.OutputFormat = FormatPNG
+			opts.ModelJPEGQuality = tt.quality
+			opts.ModelGrayscale = tt.grayscale
+
+			slices, err := SliceImage(jpegData, opts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(slices) != 3 {
+				t.Fatalf("got %d slices, want 3", len(slices))
+			}
+			for i, s := range slices {
+				if s.MIMEType != "image/png" {
+					t.Errorf("slice %d audit copy is %s, want image/png", i, s.MIMEType)
+				}
+				if !tt.wantCopy {
+					if s.ModelImageData != nil {
+						t.Errorf("slice %d has a model copy", i)
+					}
+					continue
+				}
+
+				decoded, err := jpeg.Decode(bytes.NewReader(s.ModelImageData))
+				if err != nil {
+					t.Fatalf("slice %d model copy does not decode: %v", i, err)
+				}
+				if b := decoded.Bounds(); b.Dx() != 200 || b.Dy() != s.Y1-s.Y0 {
+					t.Errorf("slice %d model copy is %dx%d, want 200x%d", i, b.Dx(), b.Dy(), s.Y1-s.Y0)
+				}
+				if _, gray := decoded.(*image.Gray); gray != tt.grayscale {
+					t.Errorf("slice %d model copy decodes as %T, grayscale %v", i, decoded, tt.grayscale)
+				}
+				if got := lumaQuantDC(t, s.ModelImageData); got != tt.wantQuantDC {
+					t.Errorf("slice %d luma DC quantizer = %d, want %d", i, got, tt.wantQuantDC)
+				}
+			}
+		})
+	}
+}
+
+// lumaPSNR is the peak signal-to-noise ratio of got's luma against want's,
+// in dB: what the models read of the ink, whatever its color.
+func lumaPSNR(want, got image.Image) float64 {
+	b := want.Bounds()
+	var sum float64
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			w := color.GrayModel.Convert(want.At(b.Min.X+x, b.Min.Y+y)).(color.Gray)
+			g := color.GrayModel.Convert(got.At(got.Bounds().Min.X+x, got.Bounds().Min.Y+y)).(color.Gray)
+			d := float64(w.Y) - float64(g.Y)
+			sum += d * d
+		}
+	}
+	mse := sum / float64(b.Dx()*b.Dy())
+	if mse == 0 {
+		return math.Inf(1)
+	}
+	return 10 * math.Log10(255*255/mse)
+}
+
+// TestModelCopy_Tradeoff measures the models' copy on a synthetic
+// handwritten entry: blue pen strokes one to two pixels wide and a red stamp
+// on cream paper. On a 600×160 strip it measured
+//
+//	color q85       19 KB   38 dB
+//	color q95       31 KB   45 dB
+//	grayscale q95   23 KB   48 dB
+//
+// Raising the quality costs 60% more bytes for 6 dB of luma, since the
+// subsampled chroma still bleeds into the strokes' edges; a single gray
+// channel gains another 3 dB in a quarter fewer bytes than color q95.
+func TestModelCopy_Tradeoff(t *testing.T) {
+	paper := color.RGBA{R: 245, G: 240, B: 222, A: 255}
+	ink := color.RGBA{R: 30, G: 50, B: 160, A: 255}
+	stamp := color.RGBA{R: 200, G: 30, B: 40, A: 255}
+	img := image.NewRGBA(image.Rect(0, 0, 600, 160))
+	for y := 0; y < 160; y++ {
+		for x := 0; x < 600; x++ {
+			c := paper
+			// Three lines of "writing": wavy strokes with a slant.
+			for line := range 3 {
+				base := 30 + line*40
+				wave := base + int(8*math.Sin(float64(x)/5)) + (x%23)/6
+				if x%29 < 22 && (y == wave || y == wave+1 && x%3 != 0) {
+					c = ink
+				}
+			}
+			// A stamp outline in the corner.
+			if x >= 480 && x < 580 && y >= 20 && y < 80 && (x < 482 || x >= 578 || y < 22 || y >= 78) {
+				c = stamp
+			}
+			img.Set(x, y, c)
+		}
+	}
+
+	encode := func(grayscale bool, quality int) (int, float64) {
+		opts := DefaultOptions()
+		opts.ModelJPEGQuality = quality
+		opts.ModelGrayscale = grayscale
+		_, model, err := encodeSlice(img, img.Bounds(), opts)
+		if err != nil {
+			t.Fatalf("encode: %v", err)
+		}
+		got, err := jpeg.Decode(bytes.NewReader(model))
+		if err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return len(model), lumaPSNR(img, got)
+	}
+
+	size85, psnr85 := encode(false, 85)
+	size95, psnr95 := encode(false, 95)
+	sizeGray, psnrGray := encode(true, 95)
+	t.Logf("color q85: %d bytes, %.1f dB", size85, psnr85)
+	t.Logf("color q95: %d bytes, %.1f dB", size95, psnr95)
+	t.Logf("grayscale q95: %d bytes, %.1f dB", sizeGray, psnrGray)
+
+	if !(psnr85 < psnr95 && psnr95 < psnrGray) {
+		t.Errorf("luma PSNR = %.1f, %.1f, %.1f dB, want each copy closer than the last", psnr85, psnr95, psnrGray)
+	}
+	if sizeGray >= size95 {
+		t.Errorf("grayscale copy is %d bytes, want smaller than color's %d", sizeGray, size95)
+	}
+}
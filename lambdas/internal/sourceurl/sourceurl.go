@@ -0,0 +1,73 @@
+// Package sourceurl validates remote URLs that logbooks can be ingested from.
+package sourceurl
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Allowlist holds the hosts logbooks may be fetched from. An entry of the form
+// "*.example.com" matches any subdomain of example.com, but not example.com
+// itself. An empty allowlist rejects every URL.
+type Allowlist []string
+
+// ParseAllowlist parses a comma-separated host list, as found in the
+// SOURCE_URL_ALLOWED_HOSTS environment variable.
+func ParseAllowlist(s string) Allowlist {
+	var a Allowlist
+	for _, h := range strings.Split(s, ",") {
+		if h = strings.ToLower(strings.TrimSpace(h)); h != "" {
+			a = append(a, h)
+		}
+	}
+	return a
+}
+
+// Allows reports whether host matches an allowlist entry.
+func (a Allowlist) Allows(host string) bool {
+	host = strings.ToLower(host)
+	for _, entry := range a {
+		if suffix, ok := strings.CutPrefix(entry, "*"); ok {
+			if strings.HasSuffix(host, suffix) && len(host) > len(suffix) {
+				return true
+			}
+		} else if host == entry {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate parses raw and checks that it is an https URL on an allowed host,
+// without credentials or a non-default port.
+func (a Allowlist) Validate(raw string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return nil, errors.New("sourceUrl is not a valid URL")
+	}
+	if u.Scheme != "https" {
+		return nil, errors.New("sourceUrl must use https")
+	}
+	if u.User != nil {
+		return nil, errors.New("sourceUrl must not contain credentials")
+	}
+	if p := u.Port(); p != "" && p != "443" {
+		return nil, errors.New("sourceUrl must use the default https port")
+	}
+	if u.Hostname() == "" || !a.Allows(u.Hostname()) {
+		return nil, fmt.Errorf("sourceUrl host %q is not allowed", u.Hostname())
+	}
+	return u, nil
+}
+
+// Filename returns the last path segment of u, which names the stored upload.
+func Filename(u *url.URL) string {
+	name := path.Base(u.Path)
+	if name == "." || name == "/" {
+		return ""
+	}
+	return name
+}
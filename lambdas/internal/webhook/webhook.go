@@ -0,0 +1,222 @@
+// Package webhook delivers signed JSON notifications to integrator callback
+// URLs.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/projectcloudline/logbook-service/internal/awsutil"
+)
+
+// SignatureHeader carries the HMAC-SHA256 of the timestamp, a ".", and the
+// request body, as "sha256=<hex>", keyed with the webhook secret.
+const SignatureHeader = "X-Logbook-Signature"
+
+// TimestampHeader carries the delivery's Unix time in seconds. It is part of
+// the signed message, so receivers can refuse stale deliveries as replays.
+const TimestampHeader = "X-Logbook-Timestamp"
+
+const (
+	// DefaultAttempts is how many times a delivery is tried when Attempts is
+	// unset.
+	DefaultAttempts = 3
+	// DefaultTimeout bounds each attempt when Timeout is unset.
+	DefaultTimeout = 5 * time.Second
+)
+
+// Doer sends HTTP requests. *http.Client satisfies it.
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Notifier POSTs signed payloads, retrying network errors, 429s and 5xx
+// responses.
+type Notifier struct {
+	Secrets awsutil.SecretsProvider
+	// SecretARN names the secret holding the signing key.
+	SecretARN string
+	// HTTP sends the requests. Nil uses a client that refuses to connect to
+	// internal addresses and doesn't follow redirects.
+	HTTP Doer
+	// Attempts is the total number of tries. Zero uses DefaultAttempts.
+	Attempts int
+	// Timeout bounds each attempt. Zero uses DefaultTimeout.
+	Timeout time.Duration
+	// Backoff is the wait before the first retry; it doubles after each.
+	// Zero uses 500ms.
+	Backoff time.Duration
+
+	mu     sync.Mutex
+	secret []byte
+}
+
+// Sign returns the SignatureHeader value for body sent with the given
+// TimestampHeader value.
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Send POSTs payload as JSON to url, signed with the webhook secret.
+func (n *Notifier) Send(ctx context.Context, url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal webhook payload: %w", err)
+	}
+	secret, err := n.signingKey(ctx)
+	if err != nil {
+		return err
+	}
+
+	attempts := n.Attempts
+	if attempts <= 0 {
+		attempts = DefaultAttempts
+	}
+	backoff := n.Backoff
+	if backoff <= 0 {
+		backoff = 500 * time.Millisecond
+	}
+
+	for attempt := 1; ; attempt++ {
+		retry, err := n.post(ctx, url, body, secret)
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= attempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post makes one delivery attempt and reports whether a failure is worth
+// retrying. Each attempt is signed with its own timestamp.
+func (n *Notifier) post(ctx context.Context, url string, body, secret []byte) (retry bool, err error) {
+	timeout := n.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("build webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(secret, timestamp, body))
+
+	resp, err := n.client().Do(req)
+	if err != nil {
+		return !errors.Is(err, errBlockedAddr), fmt.Errorf("post webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("post webhook: status %d", resp.StatusCode)
+	default:
+		return false, fmt.Errorf("post webhook: status %d", resp.StatusCode)
+	}
+}
+
+// signingKey fetches the secret once per Notifier.
+func (n *Notifier) signingKey(ctx context.Context) ([]byte, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.secret != nil {
+		return n.secret, nil
+	}
+	secret, err := n.Secrets.GetSecret(ctx, n.SecretARN)
+	if err != nil {
+		return nil, fmt.Errorf("get webhook secret: %w", err)
+	}
+	n.secret = []byte(secret)
+	return n.secret, nil
+}
+
+func (n *Notifier) client() Doer {
+	if n.HTTP != nil {
+		return n.HTTP
+	}
+	return defaultClient
+}
+
+// defaultClient delivers to integrator-supplied URLs, so it only dials public
+// addresses, checked after DNS resolution so a hostname can't point it at our
+// own network, and treats a redirect as the response rather than following it.
+var defaultClient = newClient(checkDialAddr)
+
+// errBlockedAddr is returned when a callback URL resolves to an address
+// webhooks may not be delivered to.
+var errBlockedAddr = errors.New("webhook address is not allowed")
+
+func newClient(control func(network, address string, c syscall.RawConn) error) *http.Client {
+	dialer := &net.Dialer{Timeout: DefaultTimeout, Control: control}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// checkDialAddr is a net.Dialer Control function refusing connections to
+// addresses that BlockedAddr rejects.
+func checkDialAddr(network, address string, _ syscall.RawConn) error {
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errBlockedAddr, address)
+	}
+	if BlockedAddr(ap.Addr()) {
+		return fmt.Errorf("%w: %s", errBlockedAddr, ap.Addr())
+	}
+	return nil
+}
+
+// sharedAddressSpace is the carrier-grade NAT range (RFC 6598), which
+// IsPrivate doesn't cover.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// BlockedAddr reports whether webhooks must not be delivered to addr:
+// loopback, private, link-local (including the 169.254.169.254 and
+// fd00:ec2::254 instance metadata endpoints), shared, multicast and
+// unspecified addresses.
+func BlockedAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return !addr.IsValid() || addr.IsLoopback() || addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() ||
+		addr.IsUnspecified() || sharedAddressSpace.Contains(addr)
+}
@@ -0,0 +1,167 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type mockSecrets map[string]string
+
+func (m mockSecrets) GetSecret(ctx context.Context, arn string) (string, error) {
+	if v, ok := m[arn]; ok {
+		return v, nil
+	}
+	return "", fmt.Errorf("secret not found: %s", arn)
+}
+
+func (m mockSecrets) GetSecretJSON(ctx context.Context, arn string) (map[string]string, error) {
+	return nil, fmt.Errorf("not implemented")
+}
+
+func TestSign(t *testing.T) {
+	// echo -n '1700000000.{"a":1}' | openssl dgst -sha256 -hmac secret
+	want := "sha256=49f24e537407743fa4a0242bb63b94b9a47ee99cbbe071ccd8a22550ae411686"
+	if got := Sign([]byte("secret"), "1700000000", []byte(`{"a":1}`)); got != want {
+		t.Errorf("Sign = %q, want %q", got, want)
+	}
+}
+
+func TestSend(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantAttempts int
+		wantErr      bool
+	}{
+		{name: "delivered", statuses: []int{200}, wantAttempts: 1},
+		{name: "retries server errors", statuses: []int{503, 500, 204}, wantAttempts: 3},
+		{name: "retries rate limiting", statuses: []int{429, 200}, wantAttempts: 2},
+		{name: "gives up after attempts", statuses: []int{500, 500, 500, 500}, wantAttempts: 3, wantErr: true},
+		{name: "client error is not retried", statuses: []int{400, 200}, wantAttempts: 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts int
+			var bodies, signatures, timestamps []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := io.ReadAll(r.Body)
+				bodies = append(bodies, string(b))
+				signatures = append(signatures, r.Header.Get(SignatureHeader))
+				timestamps = append(timestamps, r.Header.Get(TimestampHeader))
+				w.WriteHeader(tt.statuses[attempts])
+				attempts++
+			}))
+			defer srv.Close()
+
+			n := &Notifier{
+				Secrets:   mockSecrets{"hook-secret": "s3cret"},
+				SecretARN: "hook-secret",
+				HTTP:      srv.Client(),
+				Backoff:   time.Millisecond,
+			}
+			err := n.Send(context.Background(), srv.URL, map[string]any{"uploadId": "batch-1"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+			for i := range bodies {
+				if bodies[i] != `{"uploadId":"batch-1"}` {
+					t.Errorf("body = %s", bodies[i])
+				}
+				sent, err := strconv.ParseInt(timestamps[i], 10, 64)
+				if err != nil || time.Since(time.Unix(sent, 0)) > time.Minute {
+					t.Errorf("timestamp = %q", timestamps[i])
+				}
+				if want := Sign([]byte("s3cret"), timestamps[i], []byte(bodies[i])); signatures[i] != want {
+					t.Errorf("signature = %q, want %q", signatures[i], want)
+				}
+			}
+		})
+	}
+}
+
+func TestSend_SecretError(t *testing.T) {
+	n := &Notifier{Secrets: mockSecrets{}, SecretARN: "missing"}
+	if err := n.Send(context.Background(), "http://example.invalid", map[string]any{}); err == nil {
+		t.Fatal("expected error when the signing secret is unavailable")
+	}
+}
+
+func TestSend_RefusesInternalAddresses(t *testing.T) {
+	var attempts int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+	}))
+	defer srv.Close()
+
+	// The default client resolves and checks the address before dialing, so
+	// the loopback test server is never reached, and the refusal isn't retried.
+	n := &Notifier{Secrets: mockSecrets{"hook-secret": "s3cret"}, SecretARN: "hook-secret", Backoff: time.Millisecond}
+	err := n.Send(context.Background(), srv.URL, map[string]any{})
+	if !errors.Is(err, errBlockedAddr) {
+		t.Errorf("err = %v, want %v", err, errBlockedAddr)
+	}
+	if attempts != 0 {
+		t.Errorf("attempts = %d, want 0", attempts)
+	}
+}
+
+func TestSend_DoesNotFollowRedirects(t *testing.T) {
+	var redirected bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/internal" {
+			redirected = true
+			return
+		}
+		http.Redirect(w, r, "/internal", http.StatusTemporaryRedirect)
+	}))
+	defer srv.Close()
+
+	// The default client's redirect policy, without the dial check so it can
+	// reach the loopback test server.
+	n := &Notifier{Secrets: mockSecrets{"hook-secret": "s3cret"}, SecretARN: "hook-secret", HTTP: newClient(nil)}
+	if err := n.Send(context.Background(), srv.URL+"/hook", map[string]any{}); err == nil {
+		t.Error("expected a redirect to fail the delivery")
+	}
+	if redirected {
+		t.Error("followed the redirect")
+	}
+}
+
+func TestBlockedAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"93.184.216.34", false},
+		{"2606:2800:220:1:248:1893:25c8:1946", false},
+		{"127.0.0.1", true},
+		{"::1", true},
+		{"10.1.2.3", true},
+		{"172.16.0.1", true},
+		{"192.168.1.1", true},
+		{"169.254.169.254", true},
+		{"fd00:ec2::254", true},
+		{"fe80::1", true},
+		{"100.64.0.1", true},
+		{"0.0.0.0", true},
+		{"::ffff:127.0.0.1", true},
+		{"224.0.0.1", true},
+	}
+	for _, tt := range tests {
+		if got := BlockedAddr(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("BlockedAddr(%s) = %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
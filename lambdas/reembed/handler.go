@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/projectcloudline/logbook-service/internal/awsutil"
+	"github.com/projectcloudline/logbook-service/internal/db"
+	"github.com/projectcloudline/logbook-service/internal/gemini"
+)
+
+const (
+	defaultBatchSize  = 50
+	defaultMaxBatches = 100
+	// deadlineMargin stops the run while there is still time to write the
+	// batch in flight before Lambda times out.
+	deadlineMargin = 30 * time.Second
+)
+
+// Handler holds dependencies for the Reembed Lambda.
+type Handler struct {
+	db            db.DB
+	secrets       awsutil.SecretsProvider
+	gemini        gemini.Client
+	geminiSecrets string // GEMINI_SECRET_ARN
+
+	// embedding is the current model; embeddings from any other are stale.
+	embedding gemini.EmbeddingConfig
+	// batchSize is how many embeddings go in each BatchEmbedContent call.
+	// Zero uses defaultBatchSize.
+	batchSize int
+	// maxBatches caps the batches one invocation processes. Zero uses
+	// defaultMaxBatches.
+	maxBatches int
+}
+
+// Request optionally overrides the batch settings for one invocation.
+type Request struct {
+	BatchSize  int `json:"batchSize"`
+	MaxBatches int `json:"maxBatches"`
+}
+
+// Result summarizes an invocation. Done is true once no stale embeddings are
+// left.
+type Result struct {
+	Model      string `json:"model"`
+	Reembedded int    `json:"reembedded"`
+	Failed     int    `json:"failed"`
+	Remaining  int64  `json:"remaining"`
+	Done       bool   `json:"done"`
+}
+
+// staleEmbedding is a stored embedding from a model other than the current one.
+type staleEmbedding struct {
+	id   string
+	text string
+}
+
+// Handle regenerates embeddings whose model differs from the current one, in
+// batches, until none are left, maxBatches is reached or the Lambda deadline
+// nears. Progress is the model column itself: each re-embedded row is
+// stamped with the current model as it is written, so an interrupted run
+// simply resumes with the rows still stale. Invoke it again until Done.
+func (h *Handler) Handle(ctx context.Context, req Request) (Result, error) {
+	model := h.embedding.ModelName()
+	result := Result{Model: model}
+
+	batchSize := firstPositive(req.BatchSize, h.batchSize, defaultBatchSize)
+	maxBatches := firstPositive(req.MaxBatches, h.maxBatches, defaultMaxBatches)
+
+	client, err := h.getGeminiClient(ctx)
+	if err != nil {
+		return result, err
+	}
+
+	// after is a keyset cursor, so rows that fail to update aren't picked
+	// up again in the same run.
+	var after any
+	for batch := 0; batch < maxBatches; batch++ {
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < deadlineMargin {
+			log.Printf("Stopping before the Lambda deadline")
+			break
+		}
+
+		rows, err := h.staleEmbeddings(ctx, model, after, batchSize)
+		if err != nil {
+			return result, err
+		}
+		if len(rows) == 0 {
+			break
+		}
+		after = rows[len(rows)-1].id
+
+		texts := make([]string, len(rows))
+		for i, r := range rows {
+			texts[i] = r.text
+		}
+		embeddings, err := h.embedding.BatchEmbed(ctx, client, texts)
+		if err != nil {
+			return result, fmt.Errorf("re-embed batch %d: %w", batch+1, err)
+		}
+
+		for i, r := range rows {
+			if err := h.db.Exec(ctx,
+				`UPDATE maintenance_embeddings SET embedding = $1::halfvec, model = $2
+				 WHERE id = $3 AND model IS DISTINCT FROM $2`,
+				gemini.FormatEmbedding(embeddings[i]), model, r.id); err != nil {
+				log.Printf("WARNING: update embedding %s failed: %v", r.id, err)
+				result.Failed++
+				continue
+			}
+			result.Reembedded++
+		}
+		log.Printf("Re-embedded batch %d: %d rows with %s", batch+1, len(rows), model)
+	}
+
+	remaining, err := h.countStale(ctx, model)
+	if err != nil {
+		return result, err
+	}
+	result.Remaining = remaining
+	result.Done = remaining == 0
+	log.Printf("Re-embedded %d embeddings (%d failed); %d still stale", result.Reembedded, result.Failed, remaining)
+	return result, nil
+}
+
+// staleEmbeddings returns up to limit embeddings not produced by model, in
+// id order after the cursor (nil starts from the beginning).
+func (h *Handler) staleEmbeddings(ctx context.Context, model string, after any, limit int) ([]staleEmbedding, error) {
+	rows, err := h.db.Query(ctx,
+		`SELECT id, chunk_text FROM maintenance_embeddings
+		 WHERE model IS DISTINCT FROM $1 AND ($2::uuid IS NULL OR id > $2::uuid)
+		 ORDER BY id
+		 LIMIT $3`, model, after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("select stale embeddings: %w", err)
+	}
+	stale := make([]staleEmbedding, 0, len(rows))
+	for _, r := range rows {
+		text, _ := r["chunk_text"].(string)
+		stale = append(stale, staleEmbedding{id: fmt.Sprintf("%v", r["id"]), text: text})
+	}
+	return stale, nil
+}
+
+func (h *Handler) countStale(ctx context.Context, model string) (int64, error) {
+	rows, err := h.db.Query(ctx,
+		"SELECT COUNT(*) AS stale FROM maintenance_embeddings WHERE model IS DISTINCT FROM $1", model)
+	if err != nil {
+		return 0, fmt.Errorf("count stale embeddings: %w", err)
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	n, _ := rows[0]["stale"].(int64)
+	return n, nil
+}
+
+func (h *Handler) getGeminiClient(ctx context.Context) (gemini.Client, error) {
+	if h.gemini != nil {
+		return h.gemini, nil
+	}
+
+	raw, err := h.secrets.GetSecret(ctx, h.geminiSecrets)
+	if err != nil {
+		return nil, fmt.Errorf("get gemini secret: %w", err)
+	}
+	var secretMap map[string]string
+	if err := json.Unmarshal([]byte(raw), &secretMap); err != nil {
+		return nil, fmt.Errorf("parse gemini secret: %w", err)
+	}
+
+	client, err := gemini.New(ctx, secretMap["GEMINI_API_KEY"])
+	if err != nil {
+		return nil, err
+	}
+	h.gemini = client
+	return client, nil
+}
+
+func firstPositive(vals ...int) int {
+	for _, v := range vals {
+		if v > 0 {
+			return v
+		}
+	}
+	return 0
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/projectcloudline/logbook-service/internal/gemini"
+)
+
+// fakeEmbeddings is an in-memory maintenance_embeddings table keyed by id.
+type fakeEmbeddings struct {
+	models  map[string]any // id → model (nil for rows written before the column)
+	selects [][]any
+	updates [][]any
+}
+
+func (f *fakeEmbeddings) Query(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+	var ids []string
+	for id, model := range f.models {
+		if model != args[0] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	if strings.Contains(sql, "COUNT(*)") {
+		return []map[string]any{{"stale": int64(len(ids))}}, nil
+	}
+
+	f.selects = append(f.selects, args)
+	var rows []map[string]any
+	for _, id := range ids {
+		if after, ok := args[1].(string); ok && id <= after {
+			continue
+		}
+		if len(rows) == args[2].(int) {
+			break
+		}
+		rows = append(rows, map[string]any{"id": id, "chunk_text": "text " + id})
+	}
+	return rows, nil
+}
+
+func (f *fakeEmbeddings) Insert(ctx context.Context, sql string, args ...any) (string, error) {
+	return "", nil
+}
+
+func (f *fakeEmbeddings) Exec(ctx context.Context, sql string, args ...any) error {
+	f.updates = append(f.updates, args)
+	f.models[args[2].(string)] = args[1]
+	return nil
+}
+
+func (f *fakeEmbeddings) Ping(ctx context.Context) error { return nil }
+
+func (f *fakeEmbeddings) Pool() *pgxpool.Pool { return nil }
+
+func vector(dims int) []float32 {
+	return make([]float32, dims)
+}
+
+func TestStaleEmbeddings(t *testing.T) {
+	db := &fakeEmbeddings{models: map[string]any{
+		"e1": "text-embedding-004",
+		"e2": nil,
+		"e3": "gemini-embedding-001",
+		"e4": "text-embedding-004",
+	}}
+	h := &Handler{db: db}
+
+	rows, err := h.staleEmbeddings(context.Background(), "gemini-embedding-001", nil, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var ids []string
+	for _, r := range rows {
+		ids = append(ids, r.id)
+	}
+	if got := strings.Join(ids, ","); got != "e1,e2,e4" {
+		t.Errorf("stale ids = %s, want e1,e2,e4", got)
+	}
+	if rows[0].text != "text e1" {
+		t.Errorf("text = %q", rows[0].text)
+	}
+
+	rows, _ = h.staleEmbeddings(context.Background(), "gemini-embedding-001", "e2", 10)
+	if len(rows) != 1 || rows[0].id != "e4" {
+		t.Errorf("rows after cursor = %v, want [e4]", rows)
+	}
+}
+
+func TestHandle_BatchedReembed(t *testing.T) {
+	db := &fakeEmbeddings{models: map[string]any{
+		"e1": "text-embedding-004",
+		"e2": nil,
+		"e3": "gemini-embedding-001",
+		"e4": "text-embedding-004",
+		"e5": "text-embedding-004",
+	}}
+	var batches [][]string
+	client := &gemini.MockClient{
+		BatchEmbedContentFn: func(ctx context.Context, model string, texts []string) ([][]float32, error) {
+			if model != "gemini-embedding-001" {
+				t.Errorf("model = %q", model)
+			}
+			batches = append(batches, texts)
+			out := make([][]float32, len(texts))
+			for i := range texts {
+				out[i] = vector(gemini.DefaultEmbeddingDimensions)
+			}
+			return out, nil
+		},
+	}
+	h := &Handler{db: db, gemini: client, batchSize: 2}
+
+	result, err := h.Handle(context.Background(), Request{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(batches) != 2 || len(batches[0]) != 2 || len(batches[1]) != 2 {
+		t.Fatalf("batches = %v, want two batches of two", batches)
+	}
+	if batches[0][0] != "text e1" || batches[1][1] != "text e5" {
+		t.Errorf("batches = %v", batches)
+	}
+	if len(db.updates) != 4 {
+		t.Fatalf("updates = %d, want 4", len(db.updates))
+	}
+	for _, u := range db.updates {
+		if u[1] != "gemini-embedding-001" {
+			t.Errorf("update model = %v", u[1])
+		}
+	}
+	if result.Reembedded != 4 || result.Remaining != 0 || !result.Done {
+		t.Errorf("result = %+v", result)
+	}
+	// The second select resumes after the last id of the first batch.
+	if len(db.selects) < 2 || db.selects[1][1] != "e2" {
+		t.Errorf("selects = %v", db.selects)
+	}
+}
+
+func TestHandle_MaxBatches(t *testing.T) {
+	db := &fakeEmbeddings{models: map[string]any{"e1": nil, "e2": nil, "e3": nil}}
+	h := &Handler{db: db, gemini: &gemini.MockClient{
+		EmbedContentFn: func(ctx context.Context, model, text string) ([]float32, error) {
+			return vector(gemini.DefaultEmbeddingDimensions), nil
+		},
+	}}
+
+	result, err := h.Handle(context.Background(), Request{BatchSize: 1, MaxBatches: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if result.Reembedded != 2 || result.Remaining != 1 || result.Done {
+		t.Errorf("result = %+v, want 2 re-embedded and 1 remaining", result)
+	}
+
+	// A second invocation picks up where the first stopped.
+	result, _ = h.Handle(context.Background(), Request{BatchSize: 1, MaxBatches: 2})
+	if result.Reembedded != 1 || !result.Done {
+		t.Errorf("resumed result = %+v", result)
+	}
+}
+
+func TestHandle_DimensionMismatch(t *testing.T) {
+	db := &fakeEmbeddings{models: map[string]any{"e1": nil}}
+	h := &Handler{db: db, gemini: &gemini.MockClient{
+		EmbedContentFn: func(ctx context.Context, model, text string) ([]float32, error) {
+			return vector(768), nil
+		},
+	}}
+
+	_, err := h.Handle(context.Background(), Request{})
+	if !errors.Is(err, gemini.ErrEmbeddingDimensions) {
+		t.Fatalf("err = %v, want ErrEmbeddingDimensions", err)
+	}
+	if len(db.updates) != 0 {
+		t.Errorf("updates = %v, want none", db.updates)
+	}
+}
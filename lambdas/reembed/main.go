@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+
+	"github.com/projectcloudline/logbook-service/internal/awsutil"
+	"github.com/projectcloudline/logbook-service/internal/db"
+	"github.com/projectcloudline/logbook-service/internal/gemini"
+)
+
+func main() {
+	ctx := context.Background()
+	cfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		log.Fatalf("load AWS config: %v", err)
+	}
+
+	smClient := secretsmanager.NewFromConfig(cfg)
+	secrets := awsutil.NewSecretsProvider(smClient)
+
+	database := db.New(func(ctx context.Context) (map[string]string, error) {
+		if host := os.Getenv("DB_HOST"); host != "" {
+			return map[string]string{
+				"host":     host,
+				"port":     envOrDefault("DB_PORT", "5432"),
+				"dbname":   envOrDefault("DB_NAME", "postgres"),
+				"username": envOrDefault("DB_USER", "postgres"),
+				"password": envOrDefault("DB_PASSWORD", "postgres"),
+			}, nil
+		}
+		arn := os.Getenv("DB_SECRET_ARN")
+		raw, err := secrets.GetSecret(ctx, arn)
+		if err != nil {
+			return nil, fmt.Errorf("get db secret: %w", err)
+		}
+		var creds map[string]string
+		if err := json.Unmarshal([]byte(raw), &creds); err != nil {
+			return nil, fmt.Errorf("parse db secret: %w", err)
+		}
+		return creds, nil
+	})
+
+	h := &Handler{
+		db:            database,
+		secrets:       secrets,
+		geminiSecrets: os.Getenv("GEMINI_SECRET_ARN"),
+		embedding:     gemini.EmbeddingConfigFromEnv(),
+		batchSize:     positiveInt("REEMBED_BATCH_SIZE"),
+		maxBatches:    positiveInt("REEMBED_MAX_BATCHES"),
+	}
+
+	lambda.Start(h.Handle)
+}
+
+// positiveInt parses a positive integer env var. Unset or invalid values
+// return 0, which uses the handler default.
+func positiveInt(key string) int {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return 0
+	}
+	v, err := strconv.Atoi(raw)
+	if err != nil || v <= 0 {
+		log.Printf("WARNING: ignoring invalid %s %q", key, raw)
+		return 0
+	}
+	return v
+}
+
+func envOrDefault(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
@@ -6,25 +6,22 @@ import (
 	"encoding/json"
 	"fmt"
 	"image"
-	_ "image/gif"
-	"image/jpeg"
-	_ "image/png"
 	"io"
 	"log"
 	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
-	_ "golang.org/x/image/bmp"
-	_ "golang.org/x/image/tiff"
-	_ "golang.org/x/image/webp"
 
 	"github.com/projectcloudline/logbook-service/internal/awsutil"
 	"github.com/projectcloudline/logbook-service/internal/db"
+	"github.com/projectcloudline/logbook-service/internal/imageutil"
 )
 
 var imageExtensions = map[string]bool{
@@ -32,6 +29,58 @@ var imageExtensions = map[string]bool{
 	".bmp": true, ".tiff": true, ".tif": true, ".heic": true, ".heif": true,
 }
 
+// canonicalExtensions maps extension aliases to the form detectFileType
+// returns.
+var canonicalExtensions = map[string]string{
+	".jpeg": ".jpg",
+	".tif":  ".tiff",
+	".heif": ".heic",
+}
+
+// heifBrands are the ISO BMFF major brands of HEIC/HEIF images.
+var heifBrands = map[string]bool{
+	"heic": true, "heix": true, "heim": true, "heis": true,
+	"hevc": true, "hevx": true, "mif1": true, "msf1": true,
+}
+
+// detectFileType identifies a file from its leading bytes, returning the
+// canonical extension of its type, or "" when the signature isn't one split
+// can handle.
+func detectFileType(data []byte) string {
+	head := data
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}):
+		return ".jpg"
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return ".png"
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return ".gif"
+	case bytes.HasPrefix(data, []byte("II*\x00")), bytes.HasPrefix(data, []byte("MM\x00*")):
+		return ".tiff"
+	case len(data) >= 12 && string(data[4:8]) == "ftyp" && heifBrands[string(data[8:12])]:
+		return ".heic"
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return ".webp"
+	case bytes.HasPrefix(data, []byte("BM")) && len(data) >= 14:
+		return ".bmp"
+	case bytes.Contains(head, []byte("%PDF-")):
+		// PDF readers accept the header anywhere in the first 1KB.
+		return ".pdf"
+	default:
+		return ""
+	}
+}
+
+func canonicalExtension(ext string) string {
+	if c, ok := canonicalExtensions[ext]; ok {
+		return c
+	}
+	return ext
+}
+
 // Handler holds dependencies for the Split Lambda.
 type Handler struct {
 	db       db.DB
@@ -43,39 +92,103 @@ type Handler struct {
 	mutoolPath string
 	// heifConvertPath overrides the default heif-convert binary path (for testing)
 	heifConvertPath string
+	// retryDelay is the wait before retrying a step of storing a split
+	// page. Zero uses defaultRetryDelay.
+	retryDelay time.Duration
+
+	// pagesPrefix and uploadsPrefix are the key prefixes, ending in "/", of
+	// page images and of uploaded files. Pages split from an upload are
+	// written under pagesPrefix. Empty uses defaultPagesPrefix and
+	// defaultUploadsPrefix.
+	pagesPrefix   string
+	uploadsPrefix string
+
+	// ignorePrefixes are key prefixes skipped before anything else, for the
+	// artifacts the service writes itself. Nil uses defaultIgnorePrefixes.
+	ignorePrefixes []string
+}
+
+const (
+	defaultPagesPrefix   = "pages/"
+	defaultUploadsPrefix = "uploads/"
+)
+
+// defaultIgnorePrefixes are where the other Lambdas write slice images,
+// thumbnails and reports, none of which split handles.
+var defaultIgnorePrefixes = []string{"slices/", "thumbnails/", "reports/"}
+
+// prefixes returns the handler's key prefixes, with defaults for unset ones.
+func (h *Handler) prefixes() (pages, uploads string, ignore []string) {
+	pages, uploads, ignore = h.pagesPrefix, h.uploadsPrefix, h.ignorePrefixes
+	if pages == "" {
+		pages = defaultPagesPrefix
+	}
+	if uploads == "" {
+		uploads = defaultUploadsPrefix
+	}
+	if ignore == nil {
+		ignore = defaultIgnorePrefixes
+	}
+	return pages, uploads, ignore
+}
+
+// pageKey returns the S3 key of a page image split from an upload.
+func (h *Handler) pageKey(batchID, filename string) string {
+	pages, _, _ := h.prefixes()
+	return pages + batchID + "/" + filename
 }
 
 // Handle processes S3 PUT events for uploaded logbook files.
 func (h *Handler) Handle(ctx context.Context, event events.S3Event) error {
+	pages, uploads, ignore := h.prefixes()
 	for _, record := range event.Records {
 		s3Key, _ := url.QueryUnescape(record.S3.Object.Key)
 		bucket := record.S3.Bucket.Name
 
+		if hasAnyPrefix(s3Key, ignore) {
+			continue
+		}
+
 		log.Printf("Processing upload: s3://%s/%s", bucket, s3Key)
 
-		parts := strings.Split(s3Key, "/")
-		if len(parts) < 3 {
+		var prefix string
+		switch {
+		case strings.HasPrefix(s3Key, pages):
+			prefix = pages
+		case strings.HasPrefix(s3Key, uploads):
+			prefix = uploads
+		default:
+			log.Printf("Ignoring key %s — not in %s or %s prefix", s3Key, uploads, pages)
+			continue
+		}
+
+		// The rest of the key is {batchId}/{filename}.
+		batchID, filename, ok := strings.Cut(strings.TrimPrefix(s3Key, prefix), "/")
+		if !ok || batchID == "" || filename == "" {
 			log.Printf("Ignoring key %s — unexpected format", s3Key)
 			continue
 		}
 
-		switch parts[0] {
-		case "pages":
-			if err := h.handlePageArrival(ctx, parts[1], s3Key); err != nil {
-				return err
-			}
-		case "uploads":
-			filename := strings.Join(parts[2:], "/")
-			if err := h.handlePDFUpload(ctx, parts[1], filename, s3Key, bucket); err != nil {
+		if prefix == pages {
+			if err := h.handlePageArrival(ctx, batchID, s3Key); err != nil {
 				return err
 			}
-		default:
-			log.Printf("Ignoring key %s — not in uploads/ or pages/ prefix", s3Key)
+		} else if err := h.handlePDFUpload(ctx, batchID, filename, s3Key, bucket); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, p := range prefixes {
+		if strings.HasPrefix(s, p) {
+			return true
+		}
+	}
+	return false
+}
+
 func (h *Handler) handlePageArrival(ctx context.Context, batchID, s3Key string) error {
 	// Parse page number from key: pages/{batchId}/page_XXXX.jpg
 	filename := filepath.Base(s3Key)
@@ -91,10 +204,11 @@ func (h *Handler) handlePageArrival(ctx context.Context, batchID, s3Key string)
 		return nil
 	}
 
-	// Look up existing page record
+	// Look up existing page record by its key: pages can be reordered before
+	// their file arrives, so the number in the key may be stale.
 	rows, err := h.db.Query(ctx,
-		"SELECT id FROM upload_pages WHERE document_id = $1 AND page_number = $2",
-		batchID, pageNumber)
+		"SELECT id, page_number FROM upload_pages WHERE document_id = $1 AND image_path = $2",
+		batchID, s3Key)
 	if err != nil {
 		return fmt.Errorf("query page: %w", err)
 	}
@@ -104,6 +218,9 @@ func (h *Handler) handlePageArrival(ctx context.Context, batchID, s3Key string)
 	}
 
 	pageID := fmt.Sprintf("%v", rows[0]["id"])
+	if n, ok := rows[0]["page_number"].(int32); ok {
+		pageNumber = int(n)
+	}
 
 	// Set batch to processing
 	_ = h.db.Exec(ctx,
@@ -117,9 +234,10 @@ func (h *Handler) handlePageArrival(ctx context.Context, batchID, s3Key string)
 func (h *Handler) handlePDFUpload(ctx context.Context, batchID, filename, s3Key, bucket string) error {
 	ext := strings.ToLower(filepath.Ext(filename))
 
-	// Mark as processing
+	// Mark as processing. A re-split starts over, so what an earlier attempt
+	// recorded no longer applies.
 	if err := h.db.Exec(ctx,
-		"UPDATE upload_batches SET processing_status = 'processing', updated_at = NOW() WHERE id = $1",
+		"UPDATE upload_batches SET processing_status = 'processing', error_message = NULL, split_incomplete = FALSE, updated_at = NOW() WHERE id = $1",
 		batchID); err != nil {
 		return fmt.Errorf("update status: %w", err)
 	}
@@ -130,108 +248,280 @@ func (h *Handler) handlePDFUpload(ctx context.Context, batchID, filename, s3Key,
 	}
 	defer os.RemoveAll(tmpdir)
 
-	localFile := filepath.Join(tmpdir, filepath.Base(filename))
+	if ext != ".pdf" && !imageExtensions[ext] {
+		h.markFailed(ctx, batchID, fmt.Sprintf("Unsupported file type %s", ext))
+		return fmt.Errorf("unsupported file type: %s", ext)
+	}
 
 	// Download file from S3
 	reader, err := h.s3.GetObject(ctx, bucket, s3Key)
 	if err != nil {
-		h.markFailed(ctx, batchID)
+		h.markFailed(ctx, batchID, "The uploaded file could not be read")
 		return fmt.Errorf("download file: %w", err)
 	}
 	data, err := io.ReadAll(reader)
 	reader.Close()
 	if err != nil {
-		h.markFailed(ctx, batchID)
+		h.markFailed(ctx, batchID, "The uploaded file could not be read")
 		return fmt.Errorf("read file: %w", err)
 	}
+
+	// The extension is only the client's claim; route by what the bytes
+	// actually are.
+	detected := detectFileType(data)
+	if detected == "" {
+		h.markFailed(ctx, batchID, fmt.Sprintf("%s is not a PDF or a supported image; its contents weren't recognized", filepath.Base(filename)))
+		return fmt.Errorf("unrecognized file signature: %s", filename)
+	}
+	if detected != canonicalExtension(ext) {
+		log.Printf("WARNING: %s is labeled %s but its contents are %s; processing it as %s",
+			s3Key, ext, detected, detected)
+		ext = detected
+	}
+
+	base := filepath.Base(filename)
+	localFile := filepath.Join(tmpdir, strings.TrimSuffix(base, filepath.Ext(base))+ext)
 	if err := os.WriteFile(localFile, data, 0644); err != nil {
-		h.markFailed(ctx, batchID)
+		h.markFailed(ctx, batchID, "The uploaded file could not be read")
 		return fmt.Errorf("write file: %w", err)
 	}
 
-	var pageKeys []string
-	if ext == ".pdf" {
-		pageKeys, err = h.splitPDF(ctx, localFile, batchID, tmpdir)
-	} else if imageExtensions[ext] {
-		pageKeys, err = h.handleSingleImage(ctx, localFile, batchID)
-	} else {
-		h.markFailed(ctx, batchID)
-		return fmt.Errorf("unsupported file type: %s", ext)
+	q := &pageQueue{h: h, batchID: batchID}
+	switch canonicalExtension(ext) {
+	case ".pdf":
+		err = h.splitPDF(ctx, localFile, tmpdir, q)
+	case ".tiff":
+		err = h.splitTIFF(ctx, localFile, q)
+	default:
+		var pageKeys []string
+		if pageKeys, err = h.handleSingleImage(ctx, localFile, batchID); err == nil {
+			err = q.addAll(ctx, pageKeys)
+		}
 	}
 	if err != nil {
-		h.markFailed(ctx, batchID)
+		if q.pages == 0 {
+			h.markFailed(ctx, batchID, "The file could not be split into pages")
+			return err
+		}
+		// The pages already recorded are worth analyzing; keep them and
+		// let the batch finish with errors rather than failing it.
+		log.Printf("WARNING: splitting %s stopped after %d pages: %v", s3Key, q.pages, err)
+		h.markPartial(ctx, batchID, q.pages,
+			fmt.Sprintf("Only the first %d pages could be split from %s; the rest were not processed", q.pages, filepath.Base(filename)))
+	}
+	// With no pages nothing is queued for analysis, so the batch would never
+	// complete; fail it instead of leaving it processing.
+	if q.pages == 0 {
+		h.markFailed(ctx, batchID, fmt.Sprintf("No pages could be rendered from %s; it may be empty or corrupt", filepath.Base(filename)))
+		return fmt.Errorf("no pages rendered from %s", filename)
+	}
+	if err := q.flush(ctx); err != nil {
+		// Held pages would stay pending and the batch never complete.
+		h.markFailed(ctx, batchID, "The file's pages could not be queued for analysis")
 		return err
 	}
 
-	// Update page count
-	if err := h.db.Exec(ctx,
-		"UPDATE upload_batches SET page_count = $1, updated_at = NOW() WHERE id = $2",
-		len(pageKeys), batchID); err != nil {
-		return fmt.Errorf("update page count: %w", err)
-	}
+	log.Printf("Queued %d pages for analysis", q.pages)
+	return nil
+}
+
+// pageQueue records a batch's pages as they are split: each page's row is
+// inserted, page_count raised to match, and the page queued for analysis.
+// The newest page is only queued once the next is recorded or flush is
+// called. Until then it stays pending, so analyze can't find every page
+// done and complete the batch while later pages are still being split.
+type pageQueue struct {
+	h       *Handler
+	batchID string
+	pages   int // Pages recorded so far
+
+	held []heldPage // Recorded but not yet queued, oldest first
+}
 
-	// Create page records and queue messages
-	for i, pageKey := range pageKeys {
-		pageNum := i + 1
-		pageID, err := h.db.Insert(ctx,
+type heldPage struct {
+	id, s3Key string
+	number    int
+}
+
+// add records s3Key as the batch's next page.
+func (q *pageQueue) add(ctx context.Context, s3Key string) error {
+	pageNum := q.pages + 1
+	var pageID string
+	err := q.h.withRetry(ctx, func() (err error) {
+		pageID, err = q.h.db.Insert(ctx,
 			`INSERT INTO upload_pages (document_id, page_number, image_path, extraction_status)
 			 VALUES ($1, $2, $3, 'pending') RETURNING id`,
-			batchID, pageNum, pageKey)
-		if err != nil {
-			return fmt.Errorf("insert page: %w", err)
+			q.batchID, pageNum, s3Key)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("insert page %d: %w", pageNum, err)
+	}
+	q.pages = pageNum
+	q.held = append(q.held, heldPage{id: pageID, s3Key: s3Key, number: pageNum})
+
+	if err := q.h.withRetry(ctx, func() error {
+		return q.h.db.Exec(ctx,
+			"UPDATE upload_batches SET page_count = $1, updated_at = NOW() WHERE id = $2",
+			pageNum, q.batchID)
+	}); err != nil {
+		return fmt.Errorf("update page count: %w", err)
+	}
+	return q.queue(ctx, 1)
+}
+
+func (q *pageQueue) addAll(ctx context.Context, s3Keys []string) error {
+	for _, key := range s3Keys {
+		if err := q.add(ctx, key); err != nil {
+			return err
 		}
+	}
+	return nil
+}
+
+// flush queues every held page.
+func (q *pageQueue) flush(ctx context.Context) error {
+	return q.queue(ctx, 0)
+}
+
+// queue sends held pages for analysis, oldest first, until keep are left.
+func (q *pageQueue) queue(ctx context.Context, keep int) error {
+	for len(q.held) > keep {
+		p := q.held[0]
+		if err := q.h.withRetry(ctx, func() error {
+			return q.h.sendAnalyzeMessage(ctx, q.batchID, p.id, p.number, p.s3Key)
+		}); err != nil {
+			return fmt.Errorf("queue page %d: %w", p.number, err)
+		}
+		q.held = q.held[1:]
+	}
+	return nil
+}
+
+// Each step of storing a split page is retried, with the wait doubling from
+// the handler's retry delay, before the split gives up on the page.
+const (
+	splitAttempts     = 3
+	defaultRetryDelay = 500 * time.Millisecond
+)
 
-		if err := h.sendAnalyzeMessage(ctx, batchID, pageID, pageNum, pageKey); err != nil {
-			return fmt.Errorf("queue page: %w", err)
+// withRetry runs op until it succeeds, splitAttempts are spent or ctx is
+// done, returning the last error.
+func (h *Handler) withRetry(ctx context.Context, op func() error) error {
+	delay := h.retryDelay
+	if delay == 0 {
+		delay = defaultRetryDelay
+	}
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || attempt == splitAttempts {
+			return err
+		}
+		log.Printf("  Attempt %d failed, retrying in %s: %v", attempt, delay, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
 		}
+		delay *= 2
 	}
+}
 
-	log.Printf("Queued %d pages for analysis", len(pageKeys))
+// splitPDF renders, uploads and records the PDF's pages one at a time, so a
+// failure part-way through a large file leaves the earlier pages queued and
+// only one rendered page on disk at once.
+func (h *Handler) splitPDF(ctx context.Context, pdfPath, tmpdir string, q *pageQueue) error {
+	total, err := h.pdfPageCount(ctx, pdfPath)
+	if err != nil {
+		return err
+	}
+
+	for i := 1; i <= total; i++ {
+		data, err := h.renderPDFPage(ctx, pdfPath, tmpdir, i)
+		if err != nil {
+			return fmt.Errorf("render page %d: %w", i, err)
+		}
+
+		s3Key := h.pageKey(q.batchID, fmt.Sprintf("page_%04d.jpg", i))
+		if err := h.withRetry(ctx, func() error {
+			return h.s3.PutObject(ctx, h.bucket, s3Key, "image/jpeg", bytes.NewReader(data))
+		}); err != nil {
+			return fmt.Errorf("upload page %d: %w", i, err)
+		}
+		if err := q.add(ctx, s3Key); err != nil {
+			return err
+		}
+		log.Printf("  Split page %d/%d: %s", i, total, s3Key)
+	}
 	return nil
 }
 
-func (h *Handler) splitPDF(ctx context.Context, pdfPath, batchID, tmpdir string) ([]string, error) {
-	mutool := h.getMutoolPath()
+// mutoolPagesLine is the page count line of mutool info's output.
+var mutoolPagesLine = regexp.MustCompile(`(?m)^Pages:\s*(\d+)`)
 
-	// mutool draw -o /tmp/pages/page-%04d.jpg -r 200 -F jpeg input.pdf
-	outputPattern := filepath.Join(tmpdir, "page-%04d.jpg")
-	cmd := exec.CommandContext(ctx, mutool, "draw", "-o", outputPattern, "-r", "200", "-F", "jpeg", pdfPath)
-	cmd.Stdout = os.Stdout
+// pdfPageCount returns how many pages the PDF has, or 0 when mutool reports
+// none.
+func (h *Handler) pdfPageCount(ctx context.Context, pdfPath string) (int, error) {
+	cmd := exec.CommandContext(ctx, h.getMutoolPath(), "info", pdfPath)
 	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("mutool info: %w", err)
+	}
+	m := mutoolPagesLine.FindSubmatch(out)
+	if m == nil {
+		return 0, nil
+	}
+	return strconv.Atoi(string(m[1]))
+}
 
+// renderPDFPage renders one page as a JPEG and returns its bytes.
+func (h *Handler) renderPDFPage(ctx context.Context, pdfPath, tmpdir string, page int) ([]byte, error) {
+	// mutool draw -o /tmp/page.jpg -r 200 -F jpeg input.pdf 7
+	out := filepath.Join(tmpdir, fmt.Sprintf("page-%04d.jpg", page))
+	cmd := exec.CommandContext(ctx, h.getMutoolPath(), "draw", "-o", out, "-r", "200", "-F", "jpeg", pdfPath, strconv.Itoa(page))
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
 	if err := cmd.Run(); err != nil {
 		return nil, fmt.Errorf("mutool draw: %w", err)
 	}
+	defer os.Remove(out)
+	return os.ReadFile(out)
+}
 
-	// Find generated page files
-	matches, err := filepath.Glob(filepath.Join(tmpdir, "page-*.jpg"))
+// splitTIFF uploads and records one JPEG page per TIFF frame. Scanners
+// commonly write a whole logbook as a single multi-page TIFF; single-frame
+// files take the same path and produce one page. Like splitPDF it works a
+// page at a time, so only one decoded frame is in memory at once and a
+// failure part-way through leaves the earlier pages queued.
+func (h *Handler) splitTIFF(ctx context.Context, localFile string, q *pageQueue) error {
+	data, err := os.ReadFile(localFile)
 	if err != nil {
-		return nil, fmt.Errorf("glob pages: %w", err)
+		return fmt.Errorf("read tiff: %w", err)
 	}
 
-	var pageKeys []string
-	for i, match := range matches {
-		pageFilename := fmt.Sprintf("page_%04d.jpg", i+1)
-		s3Key := fmt.Sprintf("pages/%s/%s", batchID, pageFilename)
-
-		fileData, err := os.ReadFile(match)
-		if err != nil {
-			return nil, fmt.Errorf("read page %d: %w", i+1, err)
+	return imageutil.EachTIFFFrame(data, func(page, total int, frame image.Image) error {
+		var buf bytes.Buffer
+		if err := imageutil.EncodeJPEG(&buf, frame, 90); err != nil {
+			return fmt.Errorf("encode page %d: %w", page, err)
 		}
 
-		if err := h.s3.PutObject(ctx, h.bucket, s3Key, "image/jpeg", bytes.NewReader(fileData)); err != nil {
-			return nil, fmt.Errorf("upload page %d: %w", i+1, err)
+		s3Key := h.pageKey(q.batchID, fmt.Sprintf("page_%04d.jpg", page))
+		if err := h.withRetry(ctx, func() error {
+			return h.s3.PutObject(ctx, h.bucket, s3Key, "image/jpeg", bytes.NewReader(buf.Bytes()))
+		}); err != nil {
+			return fmt.Errorf("upload page %d: %w", page, err)
 		}
-
-		pageKeys = append(pageKeys, s3Key)
-		log.Printf("  Uploaded page %d/%d: %s", i+1, len(matches), s3Key)
-	}
-
-	return pageKeys, nil
+		if err := q.add(ctx, s3Key); err != nil {
+			return err
+		}
+		log.Printf("  Split page %d/%d: %s", page, total, s3Key)
+		return nil
+	})
 }
 
 func (h *Handler) handleSingleImage(ctx context.Context, localFile, batchID string) ([]string, error) {
-	s3Key := fmt.Sprintf("pages/%s/page_0001.jpg", batchID)
+	s3Key := h.pageKey(batchID, "page_0001.jpg")
 
 	ext := strings.ToLower(filepath.Ext(localFile))
 	normalizedFile, cleanup, err := h.normalizeImage(localFile, ext)
@@ -259,7 +549,7 @@ func (h *Handler) handleSingleImage(ctx context.Context, localFile, batchID stri
 //
 // JPEG/PNG: returned as-is (natively supported everywhere).
 // HEIC/HEIF: converted via bundled heif-convert binary.
-// GIF/BMP/TIFF/WebP: decoded with Go stdlib/x decoders and re-encoded as JPEG.
+// GIF/BMP/TIFF/WebP: decoded with Go stdlib/x decoders (via imageutil) and re-encoded as JPEG.
 func (h *Handler) normalizeImage(localFile, ext string) (string, func(), error) {
 	switch ext {
 	case ".jpg", ".jpeg", ".png":
@@ -276,28 +566,10 @@ func (h *Handler) normalizeImage(localFile, ext string) (string, func(), error)
 		return outPath, cleanup, nil
 
 	case ".gif", ".bmp", ".tiff", ".tif", ".webp":
-		f, err := os.Open(localFile)
-		if err != nil {
-			return "", nil, fmt.Errorf("open %s: %w", ext, err)
-		}
-		defer f.Close()
-
-		img, _, err := image.Decode(f)
-		if err != nil {
-			return "", nil, fmt.Errorf("decode %s: %w", ext, err)
-		}
-
 		outPath := strings.TrimSuffix(localFile, ext) + ".jpg"
-		out, err := os.Create(outPath)
-		if err != nil {
-			return "", nil, fmt.Errorf("create output: %w", err)
+		if err := imageutil.ConvertFileToJPEG(localFile, outPath, 90); err != nil {
+			return "", nil, fmt.Errorf("convert %s: %w", ext, err)
 		}
-		if err := jpeg.Encode(out, img, &jpeg.Options{Quality: 90}); err != nil {
-			out.Close()
-			os.Remove(outPath)
-			return "", nil, fmt.Errorf("encode jpeg: %w", err)
-		}
-		out.Close()
 
 		cleanup := func() { os.Remove(outPath) }
 		return outPath, cleanup, nil
@@ -307,10 +579,20 @@ func (h *Handler) normalizeImage(localFile, ext string) (string, func(), error)
 	}
 }
 
-func (h *Handler) markFailed(ctx context.Context, batchID string) {
+// markPartial records why splitting stopped after pages pages, leaving the
+// batch processing them. split_incomplete makes it finish
+// completed_with_errors.
+func (h *Handler) markPartial(ctx context.Context, batchID string, pages int, reason string) {
 	_ = h.db.Exec(ctx,
-		"UPDATE upload_batches SET processing_status = 'failed', updated_at = NOW() WHERE id = $1",
-		batchID)
+		"UPDATE upload_batches SET page_count = $2, error_message = $3, split_incomplete = TRUE, updated_at = NOW() WHERE id = $1",
+		batchID, pages, reason)
+}
+
+// markFailed fails the batch, recording reason for the upload status.
+func (h *Handler) markFailed(ctx context.Context, batchID, reason string) {
+	_ = h.db.Exec(ctx,
+		"UPDATE upload_batches SET processing_status = 'failed', error_message = $2, updated_at = NOW() WHERE id = $1",
+		batchID, reason)
 }
 
 func (h *Handler) sendAnalyzeMessage(ctx context.Context, batchID, pageID string, pageNumber int, s3Key string) error {
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"image"
@@ -12,6 +13,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -49,6 +51,8 @@ func (m *mockDB) Exec(ctx context.Context, sql string, args ...any) error {
 	return nil
 }
 
+func (m *mockDB) Ping(ctx context.Context) error { return nil }
+
 func (m *mockDB) Pool() *pgxpool.Pool { return nil }
 
 // ─── Mock S3 ────────────────────────────────────────────────────────────────
@@ -66,7 +70,22 @@ func (m *mockS3) PresignGetObject(ctx context.Context, bucket, key string, expir
 }
 
 func (m *mockS3) GetObject(ctx context.Context, bucket, key string) (io.ReadCloser, error) {
-	return io.NopCloser(strings.NewReader("fake-file-data")), nil
+	return io.NopCloser(strings.NewReader(fakeFileData(key))), nil
+}
+
+// fakeFileData returns placeholder content carrying the file signature its
+// extension implies, so it passes content sniffing without being decodable.
+func fakeFileData(key string) string {
+	switch strings.ToLower(filepath.Ext(key)) {
+	case ".pdf":
+		return "%PDF-1.7\nfake-file-data"
+	case ".png":
+		return "\x89PNG\r\n\x1a\nfake-file-data"
+	case ".tif", ".tiff":
+		return "II*\x00fake-file-data"
+	default:
+		return "\xff\xd8\xfffake-file-data"
+	}
 }
 
 func (m *mockS3) PutObject(ctx context.Context, bucket, key, contentType string, body io.Reader) error {
@@ -74,6 +93,18 @@ func (m *mockS3) PutObject(ctx context.Context, bucket, key, contentType string,
 	return nil
 }
 
+func (m *mockS3) HeadObject(ctx context.Context, bucket, key string) (bool, int64, error) {
+	return false, 0, nil
+}
+
+func (m *mockS3) ListObjects(ctx context.Context, bucket, prefix string) ([]string, error) {
+	return nil, nil
+}
+
+func (m *mockS3) DeleteObject(ctx context.Context, bucket, key string) error {
+	return nil
+}
+
 // ─── Mock SQS ───────────────────────────────────────────────────────────────
 
 type mockSQS struct {
@@ -93,12 +124,21 @@ func TestHandlePageArrival(t *testing.T) {
 		s3Key       string
 		queryRows   []map[string]any
 		wantMessage bool
+		wantPage    float64
 	}{
 		{
 			name:        "page record found — queues message",
 			s3Key:       "pages/batch-1/page_0001.jpg",
-			queryRows:   []map[string]any{{"id": "page-id-1"}},
+			queryRows:   []map[string]any{{"id": "page-id-1", "page_number": int32(1)}},
+			wantMessage: true,
+			wantPage:    1,
+		},
+		{
+			name:        "reordered page — uses stored page number",
+			s3Key:       "pages/batch-1/page_0001.jpg",
+			queryRows:   []map[string]any{{"id": "page-id-1", "page_number": int32(3)}},
 			wantMessage: true,
+			wantPage:    3,
 		},
 		{
 			name:        "no page record — skips",
@@ -113,6 +153,9 @@ func TestHandlePageArrival(t *testing.T) {
 			sqs := &mockSQS{}
 			db := &mockDB{
 				queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+					if args[1] != tt.s3Key {
+						t.Errorf("page looked up by %v, want image path %s", args[1], tt.s3Key)
+					}
 					return tt.queryRows, nil
 				},
 			}
@@ -149,6 +192,9 @@ func TestHandlePageArrival(t *testing.T) {
 				if msg["uploadId"] != "batch-1" {
 					t.Errorf("uploadId = %v, want batch-1", msg["uploadId"])
 				}
+				if msg["pageNumber"] != tt.wantPage {
+					t.Errorf("pageNumber = %v, want %v", msg["pageNumber"], tt.wantPage)
+				}
 			}
 		})
 	}
@@ -262,11 +308,14 @@ func TestMarkFailed(t *testing.T) {
 			if !strings.Contains(sql, "failed") {
 				t.Error("expected 'failed' in SQL")
 			}
+			if len(args) != 2 || args[1] != "bad file" {
+				t.Errorf("expected the reason to be recorded, got args %v", args)
+			}
 			return nil
 		},
 	}
 	h := &Handler{db: db}
-	h.markFailed(context.Background(), "batch-1")
+	h.markFailed(context.Background(), "batch-1", "bad file")
 	if !execCalled {
 		t.Error("expected exec to be called")
 	}
@@ -296,6 +345,143 @@ func TestHandlePDFUpload_UnsupportedExtension(t *testing.T) {
 	}
 }
 
+func TestDetectFileType(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"pdf", "%PDF-1.4\n...", ".pdf"},
+		{"pdf after junk", "\r\n\r\n%PDF-1.7\n...", ".pdf"},
+		{"jpeg", "\xff\xd8\xff\xe0\x00\x10JFIF", ".jpg"},
+		{"png", "\x89PNG\r\n\x1a\n\x00\x00", ".png"},
+		{"gif", "GIF89a\x01\x00", ".gif"},
+		{"tiff little-endian", "II*\x00\x08\x00", ".tiff"},
+		{"tiff big-endian", "MM\x00*\x00\x08", ".tiff"},
+		{"heic", "\x00\x00\x00\x18ftypheic\x00\x00", ".heic"},
+		{"webp", "RIFF\x24\x00\x00\x00WEBPVP8 ", ".webp"},
+		{"bmp", "BM\x36\x00\x00\x00\x00\x00\x00\x00\x36\x00\x00\x00", ".bmp"},
+		{"mp4 is not heic", "\x00\x00\x00\x18ftypisom\x00\x00", ""},
+		{"zip", "PK\x03\x04\x14\x00", ""},
+		{"empty", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectFileType([]byte(tt.data)); got != tt.want {
+				t.Errorf("detectFileType = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandlePDFUpload_MislabeledImage(t *testing.T) {
+	var buf strings.Builder
+	png.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 4)))
+
+	sqsMock := &mockSQS{}
+	s3Mock := &mockS3WithData{data: buf.String()}
+	h := &Handler{
+		db:       &mockDB{},
+		s3:       s3Mock,
+		sqs:      sqsMock,
+		bucket:   "test-bucket",
+		queueURL: "https://sqs.example.com/queue",
+		// Splitting it as a PDF would fail: there is no mutool here.
+		mutoolPath: "/nonexistent/mutool",
+	}
+
+	err := h.handlePDFUpload(context.Background(), "batch-1", "logbook.pdf", "uploads/batch-1/logbook.pdf", "test-bucket")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(s3Mock.putCalls) != 1 || s3Mock.putCalls[0] != "pages/batch-1/page_0001.jpg" {
+		t.Errorf("expected the image as a single page, got puts %v", s3Mock.putCalls)
+	}
+	if len(sqsMock.messages) != 1 {
+		t.Errorf("expected 1 SQS message, got %d", len(sqsMock.messages))
+	}
+}
+
+func TestHandlePDFUpload_UnknownSignature(t *testing.T) {
+	var failed []any
+	db := &mockDB{
+		execFn: func(ctx context.Context, sql string, args ...any) error {
+			if strings.Contains(sql, "'failed'") {
+				failed = args
+			}
+			return nil
+		},
+	}
+	s3Mock := &mockS3WithData{data: "\x7fELF\x02\x01\x01\x00binary"}
+	h := &Handler{db: db, s3: s3Mock, sqs: &mockSQS{}, bucket: "test-bucket"}
+
+	err := h.handlePDFUpload(context.Background(), "batch-1", "logbook.pdf", "uploads/batch-1/logbook.pdf", "test-bucket")
+	if err == nil || !strings.Contains(err.Error(), "unrecognized file signature") {
+		t.Fatalf("err = %v, want unrecognized file signature", err)
+	}
+	if len(failed) != 2 {
+		t.Fatalf("expected the batch to be marked failed, got %v", failed)
+	}
+	if msg, _ := failed[1].(string); !strings.Contains(msg, "logbook.pdf is not a PDF or a supported image") {
+		t.Errorf("failure message = %q", msg)
+	}
+	if len(s3Mock.putCalls) != 0 {
+		t.Errorf("expected no pages, got %v", s3Mock.putCalls)
+	}
+}
+
+func TestHandlePDFUpload_ZeroPages(t *testing.T) {
+	// A mutool that succeeds without rendering anything, as it does for an
+	// empty or page-less PDF.
+	dir := t.TempDir()
+	mutool := filepath.Join(dir, "fake-mutool")
+	os.WriteFile(mutool, []byte("#!/bin/sh\nexit 0\n"), 0755)
+
+	var statuses []string
+	var failedArgs []any
+	db := &mockDB{
+		execFn: func(ctx context.Context, sql string, args ...any) error {
+			switch {
+			case strings.Contains(sql, "'failed'"):
+				statuses = append(statuses, "failed")
+				failedArgs = args
+			case strings.Contains(sql, "'processing'"):
+				statuses = append(statuses, "processing")
+			case strings.Contains(sql, "page_count"):
+				t.Errorf("page_count should not be set when no pages rendered")
+			}
+			return nil
+		},
+		insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+			t.Errorf("unexpected page insert")
+			return "", nil
+		},
+	}
+	sqsMock := &mockSQS{}
+	h := &Handler{
+		db:         db,
+		s3:         &mockS3{},
+		sqs:        sqsMock,
+		bucket:     "test-bucket",
+		mutoolPath: mutool,
+	}
+
+	err := h.handlePDFUpload(context.Background(), "batch-1", "empty.pdf", "uploads/batch-1/empty.pdf", "test-bucket")
+	if err == nil || !strings.Contains(err.Error(), "no pages rendered") {
+		t.Fatalf("err = %v, want no pages rendered", err)
+	}
+	if len(statuses) == 0 || statuses[len(statuses)-1] != "failed" {
+		t.Fatalf("batch statuses = %v, want it to end failed", statuses)
+	}
+	if msg, _ := failedArgs[1].(string); !strings.Contains(msg, "No pages could be rendered from empty.pdf") {
+		t.Errorf("failure message = %q", msg)
+	}
+	if len(sqsMock.messages) != 0 {
+		t.Errorf("expected nothing queued, got %v", sqsMock.messages)
+	}
+}
+
 func TestHandlePageArrival_URLEncoded(t *testing.T) {
 	sqs := &mockSQS{}
 	db := &mockDB{
@@ -351,6 +537,18 @@ func (m *mockFailingS3) PutObject(ctx context.Context, bucket, key, contentType
 	return fmt.Errorf("s3 upload failed")
 }
 
+func (m *mockFailingS3) HeadObject(ctx context.Context, bucket, key string) (bool, int64, error) {
+	return false, 0, fmt.Errorf("s3 head failed")
+}
+
+func (m *mockFailingS3) ListObjects(ctx context.Context, bucket, prefix string) ([]string, error) {
+	return nil, fmt.Errorf("s3 list failed")
+}
+
+func (m *mockFailingS3) DeleteObject(ctx context.Context, bucket, key string) error {
+	return fmt.Errorf("s3 delete failed")
+}
+
 func TestHandlePDFUpload_S3Error(t *testing.T) {
 	db := &mockDB{
 		execFn: func(ctx context.Context, sql string, args ...any) error {
@@ -535,11 +733,12 @@ func TestHandlePDFUpload_InsertError(t *testing.T) {
 	}
 
 	h := &Handler{
-		db:       db,
-		s3:       s3Mock,
-		sqs:      &mockSQS{},
-		bucket:   "test-bucket",
-		queueURL: "https://sqs.example.com/queue",
+		db:         db,
+		s3:         s3Mock,
+		sqs:        &mockSQS{},
+		bucket:     "test-bucket",
+		queueURL:   "https://sqs.example.com/queue",
+		retryDelay: time.Millisecond,
 	}
 
 	err := h.handlePDFUpload(context.Background(), "batch-1", "photo.jpg", "uploads/batch-1/photo.jpg", "test-bucket")
@@ -565,6 +764,17 @@ func (m *mockS3PutFails) GetObject(ctx context.Context, bucket, key string) (io.
 func (m *mockS3PutFails) PutObject(ctx context.Context, bucket, key, contentType string, body io.Reader) error {
 	return fmt.Errorf("s3 put failed")
 }
+func (m *mockS3PutFails) HeadObject(ctx context.Context, bucket, key string) (bool, int64, error) {
+	return false, 0, nil
+}
+
+func (m *mockS3PutFails) ListObjects(ctx context.Context, bucket, prefix string) ([]string, error) {
+	return nil, nil
+}
+
+func (m *mockS3PutFails) DeleteObject(ctx context.Context, bucket, key string) error {
+	return nil
+}
 
 func TestHandlePDFUpload_PutObjectFails(t *testing.T) {
 	db := &mockDB{
@@ -868,6 +1078,170 @@ func TestHandleSingleImage_GIF(t *testing.T) {
 	}
 }
 
+func TestHandlePDFUpload_MultiPageTIFF(t *testing.T) {
+	sqsMock := &mockSQS{}
+	var inserted []any
+	db := &mockDB{
+		execFn: func(ctx context.Context, sql string, args ...any) error {
+			return nil
+		},
+		insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+			inserted = append(inserted, args[1])
+			return fmt.Sprintf("page-id-%d", len(inserted)), nil
+		},
+	}
+
+	tiffS3 := &mockS3WithData{data: string(twoFrameTIFF())}
+
+	h := &Handler{
+		db:       db,
+		s3:       tiffS3,
+		sqs:      sqsMock,
+		bucket:   "test-bucket",
+		queueURL: "https://sqs.example.com/queue",
+	}
+
+	err := h.handlePDFUpload(context.Background(), "batch-1", "scan.tiff", "uploads/batch-1/scan.tiff", "test-bucket")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	wantKeys := []string{"pages/batch-1/page_0001.jpg", "pages/batch-1/page_0002.jpg"}
+	if len(tiffS3.putCalls) != len(wantKeys) {
+		t.Fatalf("expected %d S3 put calls, got %v", len(wantKeys), tiffS3.putCalls)
+	}
+	for i, key := range wantKeys {
+		if tiffS3.putCalls[i] != key {
+			t.Errorf("put %d key = %q, want %q", i, tiffS3.putCalls[i], key)
+		}
+	}
+	if len(inserted) != 2 || inserted[0] != 1 || inserted[1] != 2 {
+		t.Errorf("expected page rows 1 and 2, got %v", inserted)
+	}
+	if len(sqsMock.messages) != 2 {
+		t.Fatalf("expected 2 SQS messages, got %d", len(sqsMock.messages))
+	}
+	for i, msg := range sqsMock.messages {
+		var m map[string]any
+		json.Unmarshal([]byte(msg), &m)
+		if m["s3Key"] != wantKeys[i] {
+			t.Errorf("message %d s3Key = %v, want %q", i, m["s3Key"], wantKeys[i])
+		}
+	}
+}
+
+func TestHandlePDFUpload_InvalidTIFF(t *testing.T) {
+	db := &mockDB{
+		execFn: func(ctx context.Context, sql string, args ...any) error {
+			return nil
+		},
+	}
+	h := &Handler{
+		db:     db,
+		s3:     &mockS3{},
+		sqs:    &mockSQS{},
+		bucket: "test-bucket",
+	}
+
+	err := h.handlePDFUpload(context.Background(), "batch-1", "scan.tif", "uploads/batch-1/scan.tif", "test-bucket")
+	if err == nil {
+		t.Fatal("expected error for invalid TIFF")
+	}
+}
+
+func TestHandlePDFUpload_TIFFCorruptFrame(t *testing.T) {
+	// The second frame's pixel data lies past the end of the file.
+	data := twoFrameTIFF()
+	le := binary.LittleEndian
+	first := le.Uint32(data[4:8])
+	second := le.Uint32(data[first+2+12*uint32(le.Uint16(data[first:])):])
+	for e := second + 2; e < second+2+12*uint32(le.Uint16(data[second:])); e += 12 {
+		if le.Uint16(data[e:]) == 273 {
+			le.PutUint32(data[e+8:], uint32(len(data))+1000)
+		}
+	}
+
+	sqsMock := &mockSQS{}
+	var inserted []any
+	var partial []any
+	db := &mockDB{
+		execFn: func(ctx context.Context, sql string, args ...any) error {
+			if strings.Contains(sql, "split_incomplete = TRUE") {
+				partial = args
+			}
+			return nil
+		},
+		insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+			inserted = append(inserted, args[1])
+			return fmt.Sprintf("page-id-%d", len(inserted)), nil
+		},
+	}
+	tiffS3 := &mockS3WithData{data: string(data)}
+	h := &Handler{
+		db:       db,
+		s3:       tiffS3,
+		sqs:      sqsMock,
+		bucket:   "test-bucket",
+		queueURL: "https://sqs.example.com/queue",
+	}
+
+	// The first page is uploaded, recorded and queued before the second
+	// fails to decode, and is kept.
+	if err := h.handlePDFUpload(context.Background(), "batch-1", "scan.tiff", "uploads/batch-1/scan.tiff", "test-bucket"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tiffS3.putCalls) != 1 || tiffS3.putCalls[0] != "pages/batch-1/page_0001.jpg" {
+		t.Errorf("put calls = %v, want page 1 only", tiffS3.putCalls)
+	}
+	if len(inserted) != 1 || len(sqsMock.messages) != 1 {
+		t.Errorf("inserted %v and queued %d, want page 1 once", inserted, len(sqsMock.messages))
+	}
+	if len(partial) < 2 || partial[1] != 1 {
+		t.Errorf("partial split = %v, want 1 page recorded", partial)
+	}
+}
+
+// twoFrameTIFF builds an uncompressed little-endian grayscale TIFF with two
+// image directories of different sizes.
+func twoFrameTIFF() []byte {
+	le := binary.LittleEndian
+	buf := []byte{'I', 'I', 42, 0, 0, 0, 0, 0}
+	nextPtr := 4
+
+	for _, size := range []image.Point{{20, 10}, {12, 30}} {
+		pixOff := len(buf)
+		for i := 0; i < size.X*size.Y; i++ {
+			buf = append(buf, byte(i))
+		}
+		if len(buf)%2 == 1 {
+			buf = append(buf, 0)
+		}
+
+		le.PutUint32(buf[nextPtr:], uint32(len(buf)))
+		entries := [][3]uint32{ // tag, type (3=SHORT, 4=LONG), value
+			{256, 4, uint32(size.X)},
+			{257, 4, uint32(size.Y)},
+			{258, 3, 8},
+			{259, 3, 1},
+			{262, 3, 1},
+			{273, 4, uint32(pixOff)},
+			{277, 3, 1},
+			{278, 4, uint32(size.Y)},
+			{279, 4, uint32(size.X * size.Y)},
+		}
+		buf = le.AppendUint16(buf, uint16(len(entries)))
+		for _, e := range entries {
+			buf = le.AppendUint16(buf, uint16(e[0]))
+			buf = le.AppendUint16(buf, uint16(e[1]))
+			buf = le.AppendUint32(buf, 1)
+			buf = le.AppendUint32(buf, e[2])
+		}
+		nextPtr = len(buf)
+		buf = le.AppendUint32(buf, 0)
+	}
+	return buf
+}
+
 // mockS3WithData returns specific data from GetObject.
 type mockS3WithData struct {
 	data     string
@@ -887,3 +1261,313 @@ func (m *mockS3WithData) PutObject(ctx context.Context, bucket, key, contentType
 	m.putCalls = append(m.putCalls, key)
 	return nil
 }
+func (m *mockS3WithData) HeadObject(ctx context.Context, bucket, key string) (bool, int64, error) {
+	return false, 0, nil
+}
+
+func (m *mockS3WithData) ListObjects(ctx context.Context, bucket, prefix string) ([]string, error) {
+	return nil, nil
+}
+
+func (m *mockS3WithData) DeleteObject(ctx context.Context, bucket, key string) error {
+	return nil
+}
+
+func TestHandleSkipsIgnoredPrefixes(t *testing.T) {
+	fail := func(what string) { t.Errorf("unexpected %s for an ignored key", what) }
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			fail("query")
+			return nil, nil
+		},
+		insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+			fail("insert")
+			return "", nil
+		},
+		execFn: func(ctx context.Context, sql string, args ...any) error {
+			fail("exec")
+			return nil
+		},
+	}
+
+	tests := []struct {
+		name   string
+		ignore []string
+		key    string
+	}{
+		{"slices", nil, "slices/batch-1/page_0001/slice_000_0123456789abcdef.jpg"},
+		{"thumbnails", nil, "thumbnails/batch-1/page_0001.jpg"},
+		{"reports", nil, "reports/N123AB/report.pdf"},
+		{"configured", []string{"archive/"}, "archive/batch-1/logbook.pdf"},
+		{"configured over a handled prefix", []string{"uploads/legacy/"}, "uploads/legacy/batch-1/logbook.pdf"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// S3 and SQS fail every call, so reaching either is an error.
+			h := &Handler{db: db, s3: &mockFailingS3{}, sqs: &mockSQS{}, ignorePrefixes: tt.ignore}
+			err := h.Handle(context.Background(), events.S3Event{
+				Records: []events.S3EventRecord{{
+					S3: events.S3Entity{
+						Bucket: events.S3Bucket{Name: "test-bucket"},
+						Object: events.S3Object{Key: tt.key},
+					},
+				}},
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestHandleConfiguredPrefixes(t *testing.T) {
+	s3Mock := &mockS3{}
+	sqsMock := &mockSQS{}
+	var queried []any
+	db := &mockDB{
+		queryFn: func(ctx context.Context, sql string, args ...any) ([]map[string]any, error) {
+			queried = append(queried, args[1])
+			return []map[string]any{{"id": "page-id-1"}}, nil
+		},
+		insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+			return "page-id-1", nil
+		},
+	}
+	h := &Handler{
+		db:            db,
+		s3:            s3Mock,
+		sqs:           sqsMock,
+		bucket:        "test-bucket",
+		queueURL:      "https://sqs.example.com/queue",
+		pagesPrefix:   "tenant-a/pages/",
+		uploadsPrefix: "tenant-a/uploads/",
+	}
+
+	var records []events.S3EventRecord
+	for _, key := range []string{
+		"tenant-a/uploads/batch-1/photo.jpg",
+		"tenant-a/pages/batch-1/page_0002.jpg",
+		"pages/batch-1/page_0003.jpg", // the default prefix no longer applies
+	} {
+		records = append(records, events.S3EventRecord{S3: events.S3Entity{
+			Bucket: events.S3Bucket{Name: "test-bucket"},
+			Object: events.S3Object{Key: key},
+		}})
+	}
+	if err := h.Handle(context.Background(), events.S3Event{Records: records}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(s3Mock.putCalls) != 1 || s3Mock.putCalls[0] != "tenant-a/pages/batch-1/page_0001.jpg" {
+		t.Errorf("put keys = %v, want the page under the configured prefix", s3Mock.putCalls)
+	}
+	if len(queried) != 1 || queried[0] != "tenant-a/pages/batch-1/page_0002.jpg" {
+		t.Errorf("page lookups = %v, want only the configured pages prefix", queried)
+	}
+	if len(sqsMock.messages) != 2 {
+		t.Errorf("expected 2 SQS messages, got %d", len(sqsMock.messages))
+	}
+}
+
+func TestIgnorePrefixes(t *testing.T) {
+	tests := []struct {
+		name  string
+		set   bool
+		value string
+		want  []string
+	}{
+		{"unset uses defaults", false, "", nil},
+		{"empty ignores nothing", true, "", []string{}},
+		{"list", true, "slices/, thumbnails ,,reports", []string{"slices/", "thumbnails/", "reports/"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.set {
+				t.Setenv("SPLIT_IGNORE_PREFIXES", tt.value)
+			} else {
+				os.Unsetenv("SPLIT_IGNORE_PREFIXES")
+			}
+			got := ignorePrefixes()
+			if (got == nil) != (tt.want == nil) || strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("ignorePrefixes() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeMutool writes a mutool that reports pages pages and renders each as a
+// small placeholder file.
+func fakeMutool(t *testing.T, pages int) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "fake-mutool")
+	script := fmt.Sprintf(`#!/bin/sh
+case "$1" in
+info) echo "PDF-1.7"; echo "Pages: %d" ;;
+draw) printf 'page %%s' "$9" > "$3" ;;
+esac
+`, pages)
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// flakyS3 fails PutObject for the keys in fail, as many times as given, or
+// every time for a negative count.
+type flakyS3 struct {
+	mockS3
+	fail map[string]int
+}
+
+func (m *flakyS3) PutObject(ctx context.Context, bucket, key, contentType string, body io.Reader) error {
+	if n := m.fail[key]; n != 0 {
+		m.fail[key] = n - 1
+		return fmt.Errorf("s3 put failed")
+	}
+	return m.mockS3.PutObject(ctx, bucket, key, contentType, body)
+}
+
+// splitLog records what a split did to the database and queue, in order.
+type splitLog struct {
+	steps    []string
+	statuses []string
+	partial  []any
+}
+
+func (l *splitLog) handler(t *testing.T, pages int, s3 *flakyS3) *Handler {
+	sqs := &recordingSQS{log: l}
+	return &Handler{
+		db: &mockDB{
+			insertFn: func(ctx context.Context, sql string, args ...any) (string, error) {
+				l.steps = append(l.steps, fmt.Sprintf("insert %v", args[1]))
+				return fmt.Sprintf("page-id-%v", args[1]), nil
+			},
+			execFn: func(ctx context.Context, sql string, args ...any) error {
+				switch {
+				case strings.Contains(sql, "'failed'"):
+					l.statuses = append(l.statuses, "failed")
+				case strings.Contains(sql, "split_incomplete = TRUE"):
+					l.partial = args
+				case strings.Contains(sql, "page_count"):
+					l.steps = append(l.steps, fmt.Sprintf("count %v", args[0]))
+				}
+				return nil
+			},
+		},
+		s3:         s3,
+		sqs:        sqs,
+		bucket:     "test-bucket",
+		queueURL:   "https://sqs.example.com/queue",
+		mutoolPath: fakeMutool(t, pages),
+		retryDelay: time.Millisecond,
+	}
+}
+
+type recordingSQS struct {
+	log *splitLog
+}
+
+func (m *recordingSQS) SendMessage(ctx context.Context, queueURL, body string) error {
+	var msg map[string]any
+	json.Unmarshal([]byte(body), &msg)
+	m.log.steps = append(m.log.steps, fmt.Sprintf("queue %v", msg["pageNumber"]))
+	return nil
+}
+
+func TestHandlePDFUpload_StreamsPages(t *testing.T) {
+	var l splitLog
+	s3 := &flakyS3{}
+	h := l.handler(t, 3, s3)
+
+	if err := h.handlePDFUpload(context.Background(), "batch-1", "logbook.pdf", "uploads/batch-1/logbook.pdf", "test-bucket"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Each page is queued only once the next is recorded, so the newest
+	// page is always pending until the split finishes.
+	want := []string{
+		"insert 1", "count 1",
+		"insert 2", "count 2", "queue 1",
+		"insert 3", "count 3", "queue 2",
+		"queue 3",
+	}
+	if !slices.Equal(l.steps, want) {
+		t.Errorf("steps = %v, want %v", l.steps, want)
+	}
+	wantKeys := []string{"pages/batch-1/page_0001.jpg", "pages/batch-1/page_0002.jpg", "pages/batch-1/page_0003.jpg"}
+	if !slices.Equal(s3.putCalls, wantKeys) {
+		t.Errorf("puts = %v, want %v", s3.putCalls, wantKeys)
+	}
+	if l.partial != nil || len(l.statuses) != 0 {
+		t.Errorf("partial = %v, statuses = %v; want a clean split", l.partial, l.statuses)
+	}
+}
+
+func TestHandlePDFUpload_PartialFailure(t *testing.T) {
+	// Page 4 of 300 never uploads; the three before it are kept.
+	var l splitLog
+	s3 := &flakyS3{fail: map[string]int{"pages/batch-1/page_0004.jpg": -1}}
+	h := l.handler(t, 300, s3)
+
+	if err := h.handlePDFUpload(context.Background(), "batch-1", "logbook.pdf", "uploads/batch-1/logbook.pdf", "test-bucket"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var queued []string
+	for _, step := range l.steps {
+		if strings.HasPrefix(step, "queue") {
+			queued = append(queued, step)
+		}
+	}
+	if want := []string{"queue 1", "queue 2", "queue 3"}; !slices.Equal(queued, want) {
+		t.Errorf("queued = %v, want %v", queued, want)
+	}
+	if len(s3.putCalls) != 3 {
+		t.Errorf("puts = %v, want the split to stop at page 4", s3.putCalls)
+	}
+	if len(l.statuses) != 0 {
+		t.Errorf("statuses = %v, want the batch left processing", l.statuses)
+	}
+	if l.partial == nil {
+		t.Fatal("no partial failure recorded")
+	}
+	if l.partial[1] != 3 {
+		t.Errorf("page_count = %v, want 3", l.partial[1])
+	}
+	if msg, _ := l.partial[2].(string); !strings.Contains(msg, "Only the first 3 pages could be split from logbook.pdf") {
+		t.Errorf("error message = %q", msg)
+	}
+}
+
+func TestHandlePDFUpload_RetriesTransientFailures(t *testing.T) {
+	var l splitLog
+	s3 := &flakyS3{fail: map[string]int{"pages/batch-1/page_0002.jpg": splitAttempts - 1}}
+	h := l.handler(t, 3, s3)
+
+	if err := h.handlePDFUpload(context.Background(), "batch-1", "logbook.pdf", "uploads/batch-1/logbook.pdf", "test-bucket"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(s3.putCalls) != 3 {
+		t.Errorf("puts = %v, want all 3 pages", s3.putCalls)
+	}
+	if l.partial != nil {
+		t.Errorf("recorded a partial failure %v after a retry succeeded", l.partial)
+	}
+}
+
+func TestHandlePDFUpload_FirstPageFails(t *testing.T) {
+	var l splitLog
+	s3 := &flakyS3{fail: map[string]int{"pages/batch-1/page_0001.jpg": -1}}
+	h := l.handler(t, 3, s3)
+
+	err := h.handlePDFUpload(context.Background(), "batch-1", "logbook.pdf", "uploads/batch-1/logbook.pdf", "test-bucket")
+	if err == nil || !strings.Contains(err.Error(), "upload page 1") {
+		t.Fatalf("err = %v, want upload page 1 failure", err)
+	}
+	if !slices.Equal(l.statuses, []string{"failed"}) {
+		t.Errorf("statuses = %v, want the batch failed", l.statuses)
+	}
+	if len(l.steps) != 0 {
+		t.Errorf("steps = %v, want nothing recorded", l.steps)
+	}
+}
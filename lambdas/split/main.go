@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/aws/aws-lambda-go/lambda"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
@@ -57,6 +58,12 @@ func main() {
 		sqs:      sqsClient,
 		bucket:   os.Getenv("BUCKET_NAME"),
 		queueURL: os.Getenv("ANALYZE_QUEUE_URL"),
+
+		// The prefixes must match the keys the API presigns uploads and
+		// page images to.
+		pagesPrefix:    keyPrefix(os.Getenv("SPLIT_PAGES_PREFIX")),
+		uploadsPrefix:  keyPrefix(os.Getenv("SPLIT_UPLOADS_PREFIX")),
+		ignorePrefixes: ignorePrefixes(),
 	}
 
 	lambda.Start(h.Handle)
@@ -68,3 +75,29 @@ func envOrDefault(key, def string) string {
 	}
 	return def
 }
+
+// keyPrefix normalizes an S3 key prefix to end in "/", so "pages" can't
+// also match "pages-old/". Empty stays empty.
+func keyPrefix(raw string) string {
+	p := strings.TrimSpace(raw)
+	if p == "" || strings.HasSuffix(p, "/") {
+		return p
+	}
+	return p + "/"
+}
+
+// ignorePrefixes parses SPLIT_IGNORE_PREFIXES, a comma-separated list of key
+// prefixes to skip. Unset uses the defaults; set but empty ignores nothing.
+func ignorePrefixes() []string {
+	raw, ok := os.LookupEnv("SPLIT_IGNORE_PREFIXES")
+	if !ok {
+		return nil
+	}
+	prefixes := []string{}
+	for _, p := range strings.Split(raw, ",") {
+		if p = keyPrefix(p); p != "" {
+			prefixes = append(prefixes, p)
+		}
+	}
+	return prefixes
+}
@@ -47,6 +47,10 @@ export class LogbookServiceStack extends cdk.Stack {
     const faaRegistryApiKey = secretsmanager.Secret.fromSecretNameV2(this, 'FaaRegistryApiKey',
       'staging/cloudline/faa-registry-api/api-key'
     );
+    // HMAC key for signing upload completion webhooks
+    const webhookSigningSecret = secretsmanager.Secret.fromSecretNameV2(this, 'WebhookSigningSecret',
+      'dev/forge/app/webhook-signing-secret'
+    );
 
     // ─── S3 Bucket ─────────────────────────────────────────────
     const bucket = new s3.Bucket(this, 'LogbookBucket', {
@@ -73,6 +77,46 @@ export class LogbookServiceStack extends cdk.Stack {
       deadLetterQueue: { queue: dlq, maxReceiveCount: 3 },
     });
 
+    const fetchDlq = new sqs.Queue(this, 'FetchDLQ', {
+      queueName: 'logbook-fetch-dlq',
+      retentionPeriod: cdk.Duration.days(14),
+    });
+
+    const fetchQueue = new sqs.Queue(this, 'FetchQueue', {
+      queueName: 'logbook-fetch-queue',
+      visibilityTimeout: cdk.Duration.minutes(5),
+      deadLetterQueue: { queue: fetchDlq, maxReceiveCount: 3 },
+    });
+
+    const enrichDlq = new sqs.Queue(this, 'EnrichDLQ', {
+      queueName: 'logbook-enrich-dlq',
+      retentionPeriod: cdk.Duration.days(14),
+    });
+
+    const enrichQueue = new sqs.Queue(this, 'EnrichQueue', {
+      queueName: 'logbook-enrich-queue',
+      visibilityTimeout: cdk.Duration.minutes(1),
+      deadLetterQueue: { queue: enrichDlq, maxReceiveCount: 3 },
+    });
+
+    // Batch completion events for internal consumers (indexers, notifiers)
+    const batchEventsQueue = new sqs.Queue(this, 'BatchEventsQueue', {
+      queueName: 'logbook-batch-events',
+      retentionPeriod: cdk.Duration.days(14),
+    });
+
+    // Hand FAA enrichment to the Enrich worker instead of a background
+    // goroutine in the API Lambda, which is frozen once a response is sent.
+    const faaEnrichViaQueue = this.node.tryGetContext('faaEnrichViaQueue') === 'true';
+
+    // Stream RAG query answers to clients that accept text/event-stream.
+    // Switches POST /aircraft/{tailNumber}/query to a response streaming
+    // integration, which the API Lambda must then answer in kind.
+    const queryStreaming = this.node.tryGetContext('queryStreaming') === 'true';
+
+    // Hosts sourceUrl uploads may be fetched from (comma-separated; empty disables them)
+    const sourceUrlAllowedHosts: string = this.node.tryGetContext('sourceUrlAllowedHosts') ?? '';
+
     // ─── Shared env vars ───────────────────────────────────────
     const sharedEnv: Record<string, string> = {
       BUCKET_NAME: bucket.bucketName,
@@ -93,6 +137,20 @@ export class LogbookServiceStack extends cdk.Stack {
         ...sharedEnv,
         FAA_REGISTRY_URL: 'https://faa-registry.staging.cloudline.aero',
         FAA_REGISTRY_SECRET_ARN: faaRegistryApiKey.secretArn,
+        CORS_ALLOWED_ORIGINS: this.node.tryGetContext('corsAllowedOrigins') ?? '*',
+        FETCH_QUEUE_URL: fetchQueue.queueUrl,
+        SOURCE_URL_ALLOWED_HOSTS: sourceUrlAllowedHosts,
+        // Reader endpoint for list/RAG queries (empty reads from the primary)
+        DB_READ_HOST: this.node.tryGetContext('dbReadHost') ?? '',
+        ENRICH_QUEUE_URL: faaEnrichViaQueue ? enrichQueue.queueUrl : '',
+        // Operator-only slicer diagnostics endpoint, off unless enabled
+        SLICER_DIAGNOSTICS_ENABLED: this.node.tryGetContext('slicerDiagnostics') === 'true' ? 'true' : 'false',
+        QUERY_STREAMING_ENABLED: queryStreaming ? 'true' : 'false',
+        // Presigned URL lifetimes as Go durations, e.g. '6h' (empty is 1h)
+        PRESIGN_PUT_TTL: this.node.tryGetContext('presignPutTtl') ?? '',
+        PRESIGN_GET_TTL: this.node.tryGetContext('presignGetTtl') ?? '',
+        // API key IDs allowed to use admin endpoints (comma-separated; empty allows none)
+        ADMIN_API_KEY_IDS: this.node.tryGetContext('adminApiKeyIds') ?? '',
       },
       ...lambdaVpcConfig,
     });
@@ -119,6 +177,38 @@ export class LogbookServiceStack extends cdk.Stack {
       ...lambdaVpcConfig,
     });
 
+    // ─── Fetch Lambda (Go) ──────────────────────────────────────
+    const fetchFunction = new lambdago.GoFunction(this, 'FetchFunction', {
+      functionName: 'logbook-fetch',
+      entry: path.join(__dirname, '..', 'lambdas', 'fetch'),
+      runtime: lambda.Runtime.PROVIDED_AL2023,
+      architecture: lambda.Architecture.ARM_64,
+      timeout: cdk.Duration.minutes(3),
+      memorySize: 512,
+      environment: {
+        ...sharedEnv,
+        SOURCE_URL_ALLOWED_HOSTS: sourceUrlAllowedHosts,
+        SOURCE_URL_MAX_BYTES: String(200 * 1024 * 1024),
+      },
+      ...lambdaVpcConfig,
+    });
+
+    // ─── Enrich Lambda (Go) ─────────────────────────────────────
+    const enrichFunction = new lambdago.GoFunction(this, 'EnrichFunction', {
+      functionName: 'logbook-enrich',
+      entry: path.join(__dirname, '..', 'lambdas', 'enrich'),
+      runtime: lambda.Runtime.PROVIDED_AL2023,
+      architecture: lambda.Architecture.ARM_64,
+      timeout: cdk.Duration.seconds(30),
+      memorySize: 128,
+      environment: {
+        ...sharedEnv,
+        FAA_REGISTRY_URL: 'https://faa-registry.staging.cloudline.aero',
+        FAA_REGISTRY_SECRET_ARN: faaRegistryApiKey.secretArn,
+      },
+      ...lambdaVpcConfig,
+    });
+
     // ─── Analyze Lambda (Go) ────────────────────────────────────
     const analyzeFunction = new lambdago.GoFunction(this, 'AnalyzeFunction', {
       functionName: 'logbook-analyze',
@@ -127,25 +217,87 @@ export class LogbookServiceStack extends cdk.Stack {
       architecture: lambda.Architecture.ARM_64,
       timeout: cdk.Duration.minutes(5),
       memorySize: 512,
-      environment: sharedEnv,
+      environment: {
+        ...sharedEnv,
+        WEBHOOK_SECRET_ARN: webhookSigningSecret.secretArn,
+        BATCH_EVENTS_QUEUE_URL: batchEventsQueue.queueUrl,
+      },
+      bundling: {
+        commandHooks: {
+          beforeBundling: (_inputDir: string, _outputDir: string) => [],
+          afterBundling: (inputDir: string, outputDir: string) => [
+            `cp ${inputDir}/bin/cwebp-arm64 ${outputDir}/bin/cwebp-arm64 2>/dev/null || true`,
+          ],
+        },
+      },
       reservedConcurrentExecutions: 5, // rate-limit Gemini calls
       ...lambdaVpcConfig,
     });
 
+    // ─── Cleanup Lambda (Go) ────────────────────────────────────
+    const cleanupFunction = new lambdago.GoFunction(this, 'CleanupFunction', {
+      functionName: 'logbook-cleanup',
+      entry: path.join(__dirname, '..', 'lambdas', 'cleanup'),
+      runtime: lambda.Runtime.PROVIDED_AL2023,
+      architecture: lambda.Architecture.ARM_64,
+      timeout: cdk.Duration.minutes(2),
+      memorySize: 256,
+      environment: {
+        ...sharedEnv,
+        UPLOAD_TTL_HOURS: '48',
+        CLEANUP_DELETE_OBJECTS: 'true',
+        STALL_TTL_HOURS: '2',
+        CLEANUP_REQUEUE_STALLED: 'true',
+      },
+      ...lambdaVpcConfig,
+    });
+
+    // ─── Reembed Lambda (Go) ────────────────────────────────────
+    // Invoked manually after changing the embedding model; re-run until the
+    // result reports done.
+    const reembedFunction = new lambdago.GoFunction(this, 'ReembedFunction', {
+      functionName: 'logbook-reembed',
+      entry: path.join(__dirname, '..', 'lambdas', 'reembed'),
+      runtime: lambda.Runtime.PROVIDED_AL2023,
+      architecture: lambda.Architecture.ARM_64,
+      timeout: cdk.Duration.minutes(15),
+      memorySize: 256,
+      environment: sharedEnv,
+      reservedConcurrentExecutions: 1,
+      ...lambdaVpcConfig,
+    });
+
     // ─── Permissions ───────────────────────────────────────────
     bucket.grantReadWrite(apiFunction);
     bucket.grantReadWrite(splitFunction);
     bucket.grantReadWrite(analyzeFunction);
+    bucket.grantPut(fetchFunction);
+    bucket.grantRead(cleanupFunction);
+    bucket.grantDelete(cleanupFunction);
 
     dbSecret.grantRead(apiFunction);
     dbSecret.grantRead(splitFunction);
     dbSecret.grantRead(analyzeFunction);
+    dbSecret.grantRead(cleanupFunction);
+    dbSecret.grantRead(fetchFunction);
+    dbSecret.grantRead(enrichFunction);
+    dbSecret.grantRead(reembedFunction);
     appSecrets.grantRead(analyzeFunction);
-    appSecrets.grantRead(apiFunction); // for RAG endpoint
+    appSecrets.grantRead(apiFunction); // for RAG and QA recheck endpoints
+    appSecrets.grantRead(reembedFunction);
     faaRegistryApiKey.grantRead(apiFunction);
+    faaRegistryApiKey.grantRead(enrichFunction);
+    webhookSigningSecret.grantRead(analyzeFunction);
 
     analyzeQueue.grantSendMessages(splitFunction);
+    analyzeQueue.grantSendMessages(apiFunction); // candidate re-extraction
+    analyzeQueue.grantSendMessages(cleanupFunction); // stalled page requeue
     analyzeQueue.grantConsumeMessages(analyzeFunction);
+    batchEventsQueue.grantSendMessages(analyzeFunction);
+    fetchQueue.grantSendMessages(apiFunction);
+    fetchQueue.grantConsumeMessages(fetchFunction);
+    enrichQueue.grantSendMessages(apiFunction);
+    enrichQueue.grantConsumeMessages(enrichFunction);
 
     // ─── Event Sources ─────────────────────────────────────────
     bucket.addEventNotification(
@@ -166,6 +318,18 @@ export class LogbookServiceStack extends cdk.Stack {
       })
     );
 
+    fetchFunction.addEventSource(
+      new lambdaEventSources.SqsEventSource(fetchQueue, {
+        batchSize: 1,
+      })
+    );
+
+    enrichFunction.addEventSource(
+      new lambdaEventSources.SqsEventSource(enrichQueue, {
+        batchSize: 1,
+      })
+    );
+
     // ─── Custom Domain ────────────────────────────────────────
     const domainName = 'logbooks.cloudline.aero';
     const hostedZone = route53.HostedZone.fromHostedZoneAttributes(this, 'LogbooksZone', {
@@ -183,6 +347,9 @@ export class LogbookServiceStack extends cdk.Stack {
       restApiName: 'Logbook Service',
       description: 'Aircraft logbook digitization API',
       apiKeySourceType: apigateway.ApiKeySourceType.HEADER,
+      // Lambda returns these base64-encoded; API Gateway decodes them for
+      // clients that accept them.
+      binaryMediaTypes: ['application/pdf', 'application/zip'],
       deployOptions: { stageName: 'v1' },
       endpointTypes: [apigateway.EndpointType.REGIONAL],
       domainName: {
@@ -194,26 +361,74 @@ export class LogbookServiceStack extends cdk.Stack {
 
     const lambdaIntegration = new apigateway.LambdaIntegration(apiFunction);
 
+    // GET /health
+    const health = api.root.addResource('health');
+    health.addMethod('GET', lambdaIntegration, { apiKeyRequired: true });
+
     // POST /uploads
     const uploads = api.root.addResource('uploads');
     uploads.addMethod('POST', lambdaIntegration, { apiKeyRequired: true });
 
+    // POST /uploads/status (bulk)
+    const bulkStatus = uploads.addResource('status');
+    bulkStatus.addMethod('POST', lambdaIntegration, { apiKeyRequired: true });
+
     // /uploads/{id}/*
     const uploadById = uploads.addResource('{id}');
 
+    // POST /uploads/{id}/finalize
+    const finalize = uploadById.addResource('finalize');
+    finalize.addMethod('POST', lambdaIntegration, { apiKeyRequired: true });
+
     // GET /uploads/{id}/status
     const status = uploadById.addResource('status');
     status.addMethod('GET', lambdaIntegration, { apiKeyRequired: true });
 
-    // GET /uploads/{id}/pages/{pageNumber}/image
+    // POST /uploads/{id}/pages
     const uploadPages = uploadById.addResource('pages');
+    uploadPages.addMethod('POST', lambdaIntegration, { apiKeyRequired: true });
+
+    // PATCH /uploads/{id}/pages/order
+    const pageOrder = uploadPages.addResource('order');
+    pageOrder.addMethod('PATCH', lambdaIntegration, { apiKeyRequired: true });
+
+    // GET /uploads/{id}/pages/{pageNumber}/image
     const uploadPageByNumber = uploadPages.addResource('{pageNumber}');
     const pageImage = uploadPageByNumber.addResource('image');
     pageImage.addMethod('GET', lambdaIntegration, { apiKeyRequired: true });
 
+    // GET /uploads/{id}/pages/{pageNumber}/thumbnail
+    const pageThumbnail = uploadPageByNumber.addResource('thumbnail');
+    pageThumbnail.addMethod('GET', lambdaIntegration, { apiKeyRequired: true });
+
+    // GET /uploads/{id}/pages/{pageNumber}/slices/diag
+    const pageSlices = uploadPageByNumber.addResource('slices');
+    const sliceDiag = pageSlices.addResource('diag');
+    sliceDiag.addMethod('GET', lambdaIntegration, { apiKeyRequired: true });
+
+    // GET /uploads/{id}/pages/{pageNumber}/slices.zip
+    const slicesZip = uploadPageByNumber.addResource('slices.zip');
+    slicesZip.addMethod('GET', lambdaIntegration, { apiKeyRequired: true });
+
+    // GET /uploads/{id}/pages/{pageNumber}/extraction
+    const pageExtraction = uploadPageByNumber.addResource('extraction');
+    pageExtraction.addMethod('GET', lambdaIntegration, { apiKeyRequired: true });
+
+    // GET /uploads/{id}/pages/{pageNumber}/extraction/candidates/{promptVersion} (admin)
+    const extractionCandidates = pageExtraction.addResource('candidates');
+    const candidateByVersion = extractionCandidates.addResource('{promptVersion}');
+    candidateByVersion.addMethod('GET', lambdaIntegration, { apiKeyRequired: true });
+
+    // POST /uploads/{id}/candidates (admin)
+    const uploadCandidates = uploadById.addResource('candidates');
+    uploadCandidates.addMethod('POST', lambdaIntegration, { apiKeyRequired: true });
+
     // /aircraft/{tailNumber}/*
     const aircraft = api.root.addResource('aircraft');
     const byTail = aircraft.addResource('{tailNumber}');
+    // DELETE /aircraft/{tailNumber} (admin)
+    byTail.addMethod('DELETE', lambdaIntegration, { apiKeyRequired: true });
+
     const tailUploads = byTail.addResource('uploads');
     tailUploads.addMethod('GET', lambdaIntegration, { apiKeyRequired: true });
 
@@ -221,24 +436,82 @@ export class LogbookServiceStack extends cdk.Stack {
     summary.addMethod('GET', lambdaIntegration, { apiKeyRequired: true });
 
     const query = byTail.addResource('query');
-    query.addMethod('POST', lambdaIntegration, { apiKeyRequired: true });
+    const queryPost = query.addMethod('POST', lambdaIntegration, { apiKeyRequired: true });
+    if (queryStreaming) {
+      // LambdaIntegration has no response streaming option in this CDK
+      // version, so set the transfer mode and streaming URI directly.
+      const cfnQueryPost = queryPost.node.defaultChild as apigateway.CfnMethod;
+      cfnQueryPost.addPropertyOverride('Integration.ResponseTransferMode', 'STREAM');
+      cfnQueryPost.addPropertyOverride('Integration.Uri', cdk.Fn.sub(
+        'arn:${AWS::Partition}:apigateway:${AWS::Region}:lambda:path/2021-11-15/functions/${FunctionArn}/response-streaming-invocations',
+        { FunctionArn: apiFunction.functionArn },
+      ));
+    }
+
+    const findSimilar = byTail.addResource('find-similar');
+    findSimilar.addMethod('POST', lambdaIntegration, { apiKeyRequired: true });
 
     const entries = byTail.addResource('entries');
     entries.addMethod('GET', lambdaIntegration, { apiKeyRequired: true });
 
+    const entrySearch = entries.addResource('search');
+    entrySearch.addMethod('GET', lambdaIntegration, { apiKeyRequired: true });
+
     const entryById = entries.addResource('{entryId}');
     entryById.addMethod('GET', lambdaIntegration, { apiKeyRequired: true });
     entryById.addMethod('PATCH', lambdaIntegration, { apiKeyRequired: true });
 
+    const entryHistory = entryById.addResource('history');
+    entryHistory.addMethod('GET', lambdaIntegration, { apiKeyRequired: true });
+
+    const entrySimilar = entryById.addResource('similar');
+    entrySimilar.addMethod('GET', lambdaIntegration, { apiKeyRequired: true });
+
+    const entryRecheck = entryById.addResource('recheck');
+    entryRecheck.addMethod('POST', lambdaIntegration, { apiKeyRequired: true });
+
     const inspections = byTail.addResource('inspections');
     inspections.addMethod('GET', lambdaIntegration, { apiKeyRequired: true });
 
     const ads = byTail.addResource('ads');
     ads.addMethod('GET', lambdaIntegration, { apiKeyRequired: true });
 
+    const adStatus = ads.addResource('status');
+    adStatus.addMethod('GET', lambdaIntegration, { apiKeyRequired: true });
+
     const parts = byTail.addResource('parts');
     parts.addMethod('GET', lambdaIntegration, { apiKeyRequired: true });
 
+    const facets = byTail.addResource('facets');
+    facets.addMethod('GET', lambdaIntegration, { apiKeyRequired: true });
+
+    const weightBalance = byTail.addResource('weight-balance');
+    weightBalance.addMethod('GET', lambdaIntegration, { apiKeyRequired: true });
+
+    const gaps = byTail.addResource('gaps');
+    gaps.addMethod('GET', lambdaIntegration, { apiKeyRequired: true });
+
+    const report = byTail.addResource('report.pdf');
+    report.addMethod('GET', lambdaIntegration, { apiKeyRequired: true });
+
+    // POST /fleet/query
+    const fleet = api.root.addResource('fleet');
+    const fleetQuery = fleet.addResource('query');
+    fleetQuery.addMethod('POST', lambdaIntegration, { apiKeyRequired: true });
+
+    // OPTIONS preflight on every resource — answered by the API Lambda.
+    // Browsers never send the API key on a preflight, so none is required.
+    const addPreflight = (resource: apigateway.Resource) => {
+      resource.addMethod('OPTIONS', lambdaIntegration);
+      for (const child of resource.node.children) {
+        if (child instanceof apigateway.Resource) addPreflight(child);
+      }
+    };
+    addPreflight(health);
+    addPreflight(uploads);
+    addPreflight(aircraft);
+    addPreflight(fleet);
+
     // ─── API Key & Usage Plan ──────────────────────────────────
     const apiKey = api.addApiKey('LogbookApiKey', {
       apiKeyName: 'logbook-service-key',
@@ -259,6 +532,12 @@ export class LogbookServiceStack extends cdk.Stack {
       })],
     });
 
+    // ─── Upload Expiry ─────────────────────────────────────────
+    new events.Rule(this, 'UploadCleanupRule', {
+      schedule: events.Schedule.rate(cdk.Duration.hours(1)),
+      targets: [new eventsTargets.LambdaFunction(cleanupFunction)],
+    });
+
     // ─── DNS Record ────────────────────────────────────────────
     new route53.ARecord(this, 'LogbooksARecord', {
       zone: hostedZone,
@@ -270,6 +549,7 @@ export class LogbookServiceStack extends cdk.Stack {
     new cdk.CfnOutput(this, 'ApiUrl', { value: api.url });
     new cdk.CfnOutput(this, 'BucketName', { value: bucket.bucketName });
     new cdk.CfnOutput(this, 'QueueUrl', { value: analyzeQueue.queueUrl });
+    new cdk.CfnOutput(this, 'BatchEventsQueueUrl', { value: batchEventsQueue.queueUrl });
     new cdk.CfnOutput(this, 'ApiKeyId', {
       value: apiKey.keyId,
       description: 'Retrieve with: aws apigateway get-api-key --api-key <id> --include-value',
@@ -129,9 +129,10 @@ def create_upload_record(tail_number, logbook_type, filename, batch_id, s3_key):
     """Create aircraft + upload_batches records in DB."""
     from shared.db import execute_insert
 
+    # Local API requests carry no API key, so they are the '' tenant.
     aircraft_id = execute_insert(
-        """INSERT INTO aircraft (registration) VALUES (%s)
-           ON CONFLICT (registration) DO UPDATE SET updated_at = NOW()
+        """INSERT INTO aircraft (registration, tenant_id) VALUES (%s, '')
+           ON CONFLICT (tenant_id, registration) DO UPDATE SET updated_at = NOW()
            RETURNING id""",
         (tail_number,)
     )
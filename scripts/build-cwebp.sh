@@ -0,0 +1,57 @@
+#!/usr/bin/env bash
+#
+# Build a statically-linked cwebp binary for ARM64 Amazon Linux 2023.
+# Uses Docker to compile inside the Lambda runtime environment.
+#
+# Output: lambdas/bin/cwebp-arm64
+#
+set -euo pipefail
+
+SCRIPT_DIR="$(cd "$(dirname "$0")" && pwd)"
+PROJECT_ROOT="$(cd "$SCRIPT_DIR/.." && pwd)"
+OUTPUT_DIR="$PROJECT_ROOT/lambdas/bin"
+
+LIBWEBP_VERSION="v1.4.0"
+
+mkdir -p "$OUTPUT_DIR"
+
+echo "Building cwebp ${LIBWEBP_VERSION} for ARM64 (Amazon Linux 2023)..."
+
+docker run --rm --platform linux/arm64 \
+  -v "$OUTPUT_DIR:/output" \
+  public.ecr.aws/amazonlinux/amazonlinux:2023 \
+  bash -c "
+set -euo pipefail
+
+# Install build dependencies
+dnf install -y gcc make cmake3 git libpng-devel libpng-static zlib-static
+
+# Clone canonical libwebp repo
+cd /tmp
+git clone --depth 1 --branch ${LIBWEBP_VERSION} https://chromium.googlesource.com/webm/libwebp
+cd libwebp
+
+# Build cwebp with static linking
+mkdir build && cd build
+cmake .. \
+  -DCMAKE_BUILD_TYPE=Release \
+  -DBUILD_SHARED_LIBS=OFF \
+  -DWEBP_BUILD_CWEBP=ON \
+  -DWEBP_BUILD_DWEBP=OFF \
+  -DWEBP_BUILD_GIF2WEBP=OFF \
+  -DWEBP_BUILD_IMG2WEBP=OFF \
+  -DWEBP_BUILD_VWEBP=OFF \
+  -DWEBP_BUILD_WEBPINFO=OFF \
+  -DWEBP_BUILD_WEBPMUX=OFF \
+  -DWEBP_BUILD_EXTRAS=OFF \
+  -DCMAKE_EXE_LINKER_FLAGS=-static
+make -j\$(nproc) cwebp
+
+# Copy output
+cp cwebp /output/cwebp-arm64
+chmod +x /output/cwebp-arm64
+echo 'Build complete'
+"
+
+echo "Output: $OUTPUT_DIR/cwebp-arm64"
+file "$OUTPUT_DIR/cwebp-arm64"
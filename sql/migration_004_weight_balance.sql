@@ -0,0 +1,21 @@
+-- Migration 004: Add weight_balance_revisions
+-- Stores weight-and-balance revisions (new empty weight, empty CG, useful load)
+-- extracted from logbook entries so the current W&B can be looked up directly.
+-- Idempotent — safe to run multiple times.
+
+SET search_path TO logbook, public;
+
+CREATE TABLE IF NOT EXISTS weight_balance_revisions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    aircraft_id UUID NOT NULL REFERENCES aircraft(id),
+    entry_id UUID REFERENCES maintenance_entries(id) ON DELETE CASCADE,
+    revision_date DATE NOT NULL,
+    empty_weight DECIMAL(10,2),
+    empty_cg DECIMAL(10,2),
+    useful_load DECIMAL(10,2),
+    equipment_changes TEXT,
+    notes TEXT,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_wb_aircraft_date ON weight_balance_revisions(aircraft_id, revision_date DESC);
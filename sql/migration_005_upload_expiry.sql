@@ -0,0 +1,15 @@
+-- Migration 005: Add 'expired' upload batch status
+-- The cleanup Lambda marks batches that were never uploaded as expired.
+-- Idempotent — safe to run multiple times.
+
+SET search_path TO logbook, public;
+BEGIN;
+
+ALTER TABLE upload_batches DROP CONSTRAINT IF EXISTS upload_batches_processing_status_check;
+ALTER TABLE upload_batches ADD CONSTRAINT upload_batches_processing_status_check
+    CHECK (processing_status IN ('pending', 'processing', 'completed', 'completed_with_errors', 'failed', 'expired'));
+
+CREATE INDEX IF NOT EXISTS idx_upload_batches_pending ON upload_batches(created_at)
+    WHERE processing_status = 'pending';
+
+COMMIT;
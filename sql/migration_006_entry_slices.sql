@@ -0,0 +1,10 @@
+-- Migration 006: Link maintenance entries to the slice they were extracted from
+-- slice_key is the S3 key of the slice image; slice_y0/slice_y1 are its pixel
+-- bounds on the page (NULL when the whole page was used).
+-- Idempotent — safe to run multiple times.
+
+SET search_path TO logbook, public;
+
+ALTER TABLE maintenance_entries ADD COLUMN IF NOT EXISTS slice_key TEXT;
+ALTER TABLE maintenance_entries ADD COLUMN IF NOT EXISTS slice_y0 INTEGER;
+ALTER TABLE maintenance_entries ADD COLUMN IF NOT EXISTS slice_y1 INTEGER;
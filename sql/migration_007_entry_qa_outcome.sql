@@ -0,0 +1,9 @@
+-- Migration 007: Record the QA outcome on maintenance entries
+-- qa_verdict is the final QA verdict (pass, fail, needs_review, error; NULL
+-- when QA did not run); qa_retries is the number of re-extractions spent.
+-- Idempotent — safe to run multiple times.
+
+SET search_path TO logbook, public;
+
+ALTER TABLE maintenance_entries ADD COLUMN IF NOT EXISTS qa_verdict VARCHAR(20);
+ALTER TABLE maintenance_entries ADD COLUMN IF NOT EXISTS qa_retries INTEGER DEFAULT 0;
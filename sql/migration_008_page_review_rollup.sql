@@ -0,0 +1,9 @@
+-- Migration 008: Page-level review rollup on upload_pages
+-- min_confidence is the lowest confidence of the page's entries;
+-- review_reason_summary joins the distinct notes of entries needing review.
+-- Idempotent — safe to run multiple times.
+
+SET search_path TO logbook, public;
+
+ALTER TABLE upload_pages ADD COLUMN IF NOT EXISTS min_confidence DECIMAL(3,2);
+ALTER TABLE upload_pages ADD COLUMN IF NOT EXISTS review_reason_summary TEXT;
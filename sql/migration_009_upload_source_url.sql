@@ -0,0 +1,8 @@
+-- Migration 009: Record the remote URL of fetched uploads
+-- Uploads created with a sourceUrl are downloaded server-side by the fetch
+-- Lambda; source_url keeps where they came from.
+-- Idempotent — safe to run multiple times.
+
+SET search_path TO logbook, public;
+
+ALTER TABLE upload_batches ADD COLUMN IF NOT EXISTS source_url TEXT;
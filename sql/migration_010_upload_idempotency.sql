@@ -0,0 +1,11 @@
+-- Migration 010: Idempotency keys for POST /uploads
+-- A retried request with the same key returns the batch the first one
+-- created instead of a duplicate. Keys are unique per aircraft.
+-- Idempotent — safe to run multiple times.
+
+SET search_path TO logbook, public;
+
+ALTER TABLE upload_batches ADD COLUMN IF NOT EXISTS idempotency_key VARCHAR(255);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_upload_batches_idempotency ON upload_batches(aircraft_id, idempotency_key)
+    WHERE idempotency_key IS NOT NULL;
@@ -0,0 +1,8 @@
+-- Migration 011: Flag pages whose file never reached S3
+-- POST /uploads/{id}/finalize sets file_missing on multi-image pages whose
+-- object is absent, and clears it once the file arrives.
+-- Idempotent — safe to run multiple times.
+
+SET search_path TO logbook, public;
+
+ALTER TABLE upload_pages ADD COLUMN IF NOT EXISTS file_missing BOOLEAN DEFAULT FALSE;
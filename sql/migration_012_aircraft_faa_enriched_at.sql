@@ -0,0 +1,8 @@
+-- Migration 012: Track when aircraft were last enriched from the FAA registry
+-- Uploads skip the registry lookup while faa_enriched_at is within the TTL.
+-- updated_at can't serve: every upload bumps it.
+-- Idempotent — safe to run multiple times.
+
+SET search_path TO logbook, public;
+
+ALTER TABLE aircraft ADD COLUMN IF NOT EXISTS faa_enriched_at TIMESTAMPTZ;
@@ -0,0 +1,18 @@
+-- Migration 013: Edit history for maintenance entries
+-- Each PATCH records the changed fields' values before and after the edit,
+-- and who made it, so corrections to extracted entries leave an audit trail.
+-- Idempotent — safe to run multiple times.
+
+SET search_path TO logbook, public;
+
+CREATE TABLE IF NOT EXISTS entry_revisions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    entry_id UUID NOT NULL REFERENCES maintenance_entries(id) ON DELETE CASCADE,
+    aircraft_id UUID NOT NULL REFERENCES aircraft(id),
+    previous_values JSONB NOT NULL,
+    new_values JSONB NOT NULL,
+    revised_by VARCHAR(100),
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_entry_revisions_entry ON entry_revisions(entry_id, created_at DESC);
@@ -0,0 +1,8 @@
+-- Migration 014: Completion webhook URL for uploads
+-- When a batch reaches a terminal status the analyze Lambda POSTs a signed
+-- notification to callback_url, if the upload gave one.
+-- Idempotent — safe to run multiple times.
+
+SET search_path TO logbook, public;
+
+ALTER TABLE upload_batches ADD COLUMN IF NOT EXISTS callback_url VARCHAR(2048);
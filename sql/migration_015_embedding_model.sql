@@ -0,0 +1,14 @@
+-- Migration 015: Record which model produced each embedding
+-- Vectors from different models can't be compared, so queries only match
+-- embeddings from the current model and the reembed Lambda regenerates the
+-- rest. Everything stored before this column existed came from
+-- gemini-embedding-001.
+-- Idempotent — safe to run multiple times.
+
+SET search_path TO logbook, public;
+
+ALTER TABLE maintenance_embeddings ADD COLUMN IF NOT EXISTS model VARCHAR(100);
+
+UPDATE maintenance_embeddings SET model = 'gemini-embedding-001' WHERE model IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_embeddings_model ON maintenance_embeddings(model);
@@ -0,0 +1,15 @@
+-- Migration 016: Full-text search over maintenance entries
+-- GET /aircraft/{tailNumber}/entries/search matches keywords against the
+-- narrative and, at a lower weight, the shop name. The generated column keeps
+-- the search vector in step with edits.
+-- Idempotent — safe to run multiple times.
+
+SET search_path TO logbook, public;
+
+ALTER TABLE maintenance_entries ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', coalesce(maintenance_narrative, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce(shop_name, '')), 'B')
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_maintenance_search ON maintenance_entries USING GIN (search_vector);
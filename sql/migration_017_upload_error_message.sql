@@ -0,0 +1,9 @@
+-- Migration 017: Why an upload failed
+-- The split Lambda records a reason when it fails a batch (for example a file
+-- whose contents aren't a PDF or supported image), shown by the upload status
+-- endpoint.
+-- Idempotent — safe to run multiple times.
+
+SET search_path TO logbook, public;
+
+ALTER TABLE upload_batches ADD COLUMN IF NOT EXISTS error_message TEXT;
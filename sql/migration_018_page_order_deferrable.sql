@@ -0,0 +1,31 @@
+-- Migration 018: Let a single statement reorder pages
+-- PATCH /uploads/{id}/pages/order renumbers a batch's pages with one UPDATE.
+-- A non-deferrable UNIQUE(document_id, page_number) is checked row by row and
+-- rejects swaps mid-statement; a deferrable one is checked at statement end.
+-- The constraint may still carry its pre-002 logbook_pages name, so it is
+-- looked up rather than dropped by name.
+-- Idempotent — safe to run multiple times.
+
+SET search_path TO logbook, public;
+
+DO $$
+DECLARE
+    old_name TEXT;
+BEGIN
+    SELECT c.conname INTO old_name
+    FROM pg_constraint c
+    WHERE c.conrelid = 'upload_pages'::regclass
+      AND c.contype = 'u'
+      AND NOT c.condeferrable
+      AND array_length(c.conkey, 1) = 2
+      AND c.conkey @> ARRAY(
+          SELECT attnum FROM pg_attribute
+          WHERE attrelid = 'upload_pages'::regclass
+            AND attname IN ('document_id', 'page_number'));
+
+    IF old_name IS NOT NULL THEN
+        EXECUTE format('ALTER TABLE upload_pages DROP CONSTRAINT %I', old_name);
+        ALTER TABLE upload_pages ADD CONSTRAINT upload_pages_document_id_page_number_key
+            UNIQUE (document_id, page_number) DEFERRABLE INITIALLY IMMEDIATE;
+    END IF;
+END $$;
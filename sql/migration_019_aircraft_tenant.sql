@@ -0,0 +1,26 @@
+-- Migration 019: Scope aircraft to the tenant that owns them
+-- The API only finds an aircraft for callers of its tenant, identified by the
+-- API key the request was authenticated with, and a tail number is unique
+-- per tenant. Aircraft without a tenant are found by no one: backfill
+-- existing rows with their owner's API key ID, e.g.
+--   UPDATE aircraft SET tenant_id = '<api key id>' WHERE tenant_id IS NULL;
+-- before that owner uploads the tail again, which would otherwise create a
+-- second aircraft.
+-- Idempotent — safe to run multiple times.
+
+SET search_path TO logbook, public;
+
+ALTER TABLE aircraft ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(128);
+
+-- A tail number is unique per tenant, so a second tenant uploading it gets an
+-- aircraft of its own rather than being locked out.
+ALTER TABLE aircraft DROP CONSTRAINT IF EXISTS aircraft_registration_key;
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint
+                   WHERE conrelid = 'aircraft'::regclass AND conname = 'aircraft_tenant_id_registration_key') THEN
+        ALTER TABLE aircraft ADD CONSTRAINT aircraft_tenant_id_registration_key
+            UNIQUE (tenant_id, registration);
+    END IF;
+END $$;
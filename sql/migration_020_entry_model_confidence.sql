@@ -0,0 +1,9 @@
+-- Migration 020: Keep the model's own confidence alongside the calibrated one
+-- confidence_score now holds the model's confidence recalibrated against the
+-- QA verdict; model_confidence keeps what the model reported. Existing rows
+-- keep their uncalibrated confidence_score and a NULL model_confidence.
+-- Idempotent — safe to run multiple times.
+
+SET search_path TO logbook, public;
+
+ALTER TABLE maintenance_entries ADD COLUMN IF NOT EXISTS model_confidence DECIMAL(3,2);
@@ -0,0 +1,8 @@
+-- Migration 021: Candidate extractions for prompt comparison
+-- Re-extracting an upload with a new prompt version stores each page's result
+-- here, keyed by the version, instead of replacing the live raw_extraction.
+-- Idempotent — safe to run multiple times.
+
+SET search_path TO logbook, public;
+
+ALTER TABLE upload_pages ADD COLUMN IF NOT EXISTS raw_extraction_candidate JSONB;
@@ -0,0 +1,8 @@
+-- Migration 022: Uncertain fields on maintenance entries
+-- The fields the extraction model reported it was unsure of, together with
+-- the fields QA raised issues with, so reviewers know what to check first.
+-- Idempotent — safe to run multiple times.
+
+SET search_path TO logbook, public;
+
+ALTER TABLE maintenance_entries ADD COLUMN IF NOT EXISTS uncertain_fields JSONB;
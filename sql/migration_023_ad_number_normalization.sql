@@ -0,0 +1,29 @@
+-- Migration 023: Normalized AD numbers
+-- ad_number now holds the FAA form (YYYY-NN-NN, YY-NN-NN before 2000, with
+-- " R<n>" for revisions) so compliance with one AD groups together however
+-- the logbook wrote it; ad_number_raw keeps it as written. Existing rows are
+-- normalized the same way the analyze lambda does; unrecognizable numbers
+-- are left as they are.
+-- Idempotent — safe to run multiple times.
+
+SET search_path TO logbook, public;
+
+ALTER TABLE ad_compliance ADD COLUMN IF NOT EXISTS ad_number_raw VARCHAR(50);
+
+UPDATE ad_compliance
+SET ad_number_raw = ad_number,
+    ad_number = regexp_replace(ad_number,
+        '^\s*(?:AD)?[\s#:.-]*(\d{4}|\d{2})[\s.-]*(\d{2})[\s.-]*(\d{2})[\s.-]*R(\d+)\s*$',
+        '\1-\2-\3 R\4', 'i')
+WHERE ad_number_raw IS NULL
+  AND ad_number ~* '^\s*(?:AD)?[\s#:.-]*(\d{4}|\d{2})[\s.-]*(\d{2})[\s.-]*(\d{2})[\s.-]*R(\d+)\s*$';
+
+UPDATE ad_compliance
+SET ad_number_raw = ad_number,
+    ad_number = regexp_replace(ad_number,
+        '^\s*(?:AD)?[\s#:.-]*(\d{4}|\d{2})[\s.-]*(\d{2})[\s.-]*(\d{2})\s*$',
+        '\1-\2-\3', 'i')
+WHERE ad_number_raw IS NULL
+  AND ad_number ~* '^\s*(?:AD)?[\s#:.-]*(\d{4}|\d{2})[\s.-]*(\d{2})[\s.-]*(\d{2})\s*$';
+
+UPDATE ad_compliance SET ad_number_raw = ad_number WHERE ad_number_raw IS NULL;
@@ -0,0 +1,14 @@
+-- Migration 024: Link entries superseded by a corrected re-upload
+-- When a page is uploaded again to fix a bad scan, the analyze lambda points
+-- each earlier entry it re-extracted (same date, similar narrative) at the
+-- new entry. Superseded entries are hidden from entry lists and the summary
+-- unless asked for. Existing rows are not linked.
+-- Idempotent — safe to run multiple times.
+
+SET search_path TO logbook, public;
+
+ALTER TABLE maintenance_entries ADD COLUMN IF NOT EXISTS superseded_by UUID
+    REFERENCES maintenance_entries(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_maintenance_superseded ON maintenance_entries(superseded_by)
+    WHERE superseded_by IS NOT NULL;
@@ -0,0 +1,11 @@
+-- Migration 025: Mark entries read from stickers
+-- Adhesive stickers and placards (oil change reminders, STC labels) are not
+-- logbook entries. The analyze lambda stores what it reads from them as
+-- entry_type 'other' with source 'sticker', or skips them when
+-- STICKER_SLICES=skip. Entries read from the logbook itself have no source.
+-- Idempotent — safe to run multiple times.
+
+SET search_path TO logbook, public;
+
+ALTER TABLE maintenance_entries ADD COLUMN IF NOT EXISTS source VARCHAR(20)
+    CHECK (source IN ('sticker'));
@@ -0,0 +1,12 @@
+-- Migration 026: Keep the aircraft each entry names
+-- The analyze lambda compares the serial number, make and model written in
+-- an entry with the aircraft record. FAA enrichment can fill that record in
+-- after pages are analyzed, so the values are kept to check entries again
+-- once it does. Existing rows are left empty and are not re-checked.
+-- Idempotent — safe to run multiple times.
+
+SET search_path TO logbook, public;
+
+ALTER TABLE maintenance_entries ADD COLUMN IF NOT EXISTS aircraft_serial VARCHAR(100);
+ALTER TABLE maintenance_entries ADD COLUMN IF NOT EXISTS aircraft_make VARCHAR(100);
+ALTER TABLE maintenance_entries ADD COLUMN IF NOT EXISTS aircraft_model VARCHAR(100);
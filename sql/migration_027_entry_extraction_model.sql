@@ -0,0 +1,11 @@
+-- Migration 027: Record the model and prompt each entry was extracted with
+-- Pages already record their extraction model, but a page can be
+-- reprocessed after a model or prompt change, so entries now keep their own.
+-- prompt_version is a short hash of the prompt text. Existing rows are left
+-- empty.
+-- Idempotent — safe to run multiple times.
+
+SET search_path TO logbook, public;
+
+ALTER TABLE maintenance_entries ADD COLUMN IF NOT EXISTS extraction_model VARCHAR(50);
+ALTER TABLE maintenance_entries ADD COLUMN IF NOT EXISTS prompt_version VARCHAR(64);
@@ -0,0 +1,23 @@
+-- Migration 028: Add 'stalled' upload batch status
+-- The cleanup Lambda marks batches stuck in processing as stalled when no
+-- page has changed for a while. Pages get an updated_at, kept by trigger, so
+-- their progress can be seen.
+-- Idempotent — safe to run multiple times.
+
+SET search_path TO logbook, public;
+BEGIN;
+
+ALTER TABLE upload_batches DROP CONSTRAINT IF EXISTS upload_batches_processing_status_check;
+ALTER TABLE upload_batches ADD CONSTRAINT upload_batches_processing_status_check
+    CHECK (processing_status IN ('pending', 'processing', 'completed', 'completed_with_errors', 'failed', 'expired', 'stalled'));
+
+CREATE INDEX IF NOT EXISTS idx_upload_batches_processing ON upload_batches(updated_at)
+    WHERE processing_status = 'processing';
+
+ALTER TABLE upload_pages ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ DEFAULT NOW();
+
+DROP TRIGGER IF EXISTS upload_pages_updated_at ON upload_pages;
+CREATE TRIGGER upload_pages_updated_at BEFORE UPDATE ON upload_pages
+    FOR EACH ROW EXECUTE FUNCTION logbook.update_updated_at();
+
+COMMIT;
@@ -0,0 +1,15 @@
+-- Migration 029: Record an incomplete split in its own column
+-- Split used to mark a batch it lost pages from only by setting
+-- error_message, which nothing cleared, so a reprocessed batch could never
+-- complete cleanly. split_incomplete carries that instead and is reset when
+-- split starts over. Batches still in flight with a message keep their
+-- meaning.
+-- Idempotent — safe to run multiple times.
+
+SET search_path TO logbook, public;
+
+ALTER TABLE upload_batches ADD COLUMN IF NOT EXISTS split_incomplete BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE upload_batches SET split_incomplete = TRUE
+WHERE error_message IS NOT NULL AND processing_status IN ('processing', 'stalled')
+  AND NOT split_incomplete;
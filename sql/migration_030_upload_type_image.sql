@@ -0,0 +1,19 @@
+-- Migration 030: Add 'image' upload type
+-- A sourceUrl upload of a single image was recorded as a PDF upload. It is a
+-- single file under uploads/ like a PDF, so it keeps s3_key, but split
+-- treats it as an image. Existing URL uploads of images are corrected from
+-- their file name.
+-- Idempotent — safe to run multiple times.
+
+SET search_path TO logbook, public;
+BEGIN;
+
+ALTER TABLE upload_batches DROP CONSTRAINT IF EXISTS upload_batches_upload_type_check;
+ALTER TABLE upload_batches ADD CONSTRAINT upload_batches_upload_type_check
+    CHECK (upload_type IN ('pdf', 'image', 'multi_image'));
+
+UPDATE upload_batches SET upload_type = 'image'
+WHERE upload_type = 'pdf' AND source_url IS NOT NULL
+  AND lower(source_filename) !~ '\.pdf$';
+
+COMMIT;
@@ -13,7 +13,8 @@ CREATE EXTENSION IF NOT EXISTS "vector";
 
 CREATE TABLE IF NOT EXISTS aircraft (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
-    registration VARCHAR(10) NOT NULL UNIQUE,
+    registration VARCHAR(10) NOT NULL,
+    tenant_id VARCHAR(128),            -- owning tenant; API lookups are scoped to it
     serial_number VARCHAR(50),
     make VARCHAR(100),
     model VARCHAR(50),
@@ -21,8 +22,10 @@ CREATE TABLE IF NOT EXISTS aircraft (
     engine_serial VARCHAR(50),
     propeller_model VARCHAR(50),
     propeller_serial VARCHAR(50),
+    faa_enriched_at TIMESTAMPTZ,
     created_at TIMESTAMPTZ DEFAULT NOW(),
-    updated_at TIMESTAMPTZ DEFAULT NOW()
+    updated_at TIMESTAMPTZ DEFAULT NOW(),
+    UNIQUE(tenant_id, registration)    -- each tenant has its own aircraft per tail
 );
 
 CREATE TABLE IF NOT EXISTS upload_batches (
@@ -30,19 +33,33 @@ CREATE TABLE IF NOT EXISTS upload_batches (
     aircraft_id UUID REFERENCES aircraft(id),
     logbook_type VARCHAR(20) CHECK (logbook_type IN ('airframe', 'engine', 'propeller', 'avionics', 'appliance')),
     upload_type VARCHAR(20) DEFAULT 'pdf'
-        CHECK (upload_type IN ('pdf', 'multi_image')),
+        CHECK (upload_type IN ('pdf', 'image', 'multi_image')),
     source_filename VARCHAR(500) NOT NULL,
     s3_key VARCHAR(500),
+    source_url TEXT,                   -- set when fetched server-side from a sourceUrl
+    idempotency_key VARCHAR(255),      -- client retry key, unique per aircraft
+    callback_url VARCHAR(2048),        -- completion webhook target
     file_hash VARCHAR(64),
     page_count INTEGER,
     date_range_start DATE,
     date_range_end DATE,
     processing_status VARCHAR(20) DEFAULT 'pending'
-        CHECK (processing_status IN ('pending', 'processing', 'completed', 'completed_with_errors', 'failed')),
+        CHECK (processing_status IN ('pending', 'processing', 'completed', 'completed_with_errors', 'failed', 'expired', 'stalled')),
+    error_message TEXT,                -- why the batch failed, when it did
+    split_incomplete BOOLEAN NOT NULL DEFAULT FALSE, -- split stopped early and lost pages
     created_at TIMESTAMPTZ DEFAULT NOW(),
     updated_at TIMESTAMPTZ DEFAULT NOW()
 );
 
+CREATE INDEX IF NOT EXISTS idx_upload_batches_pending ON upload_batches(created_at)
+    WHERE processing_status = 'pending';
+
+CREATE INDEX IF NOT EXISTS idx_upload_batches_processing ON upload_batches(updated_at)
+    WHERE processing_status = 'processing';
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_upload_batches_idempotency ON upload_batches(aircraft_id, idempotency_key)
+    WHERE idempotency_key IS NOT NULL;
+
 CREATE TABLE IF NOT EXISTS upload_pages (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
     document_id UUID NOT NULL REFERENCES upload_batches(id) ON DELETE CASCADE,
@@ -54,10 +71,16 @@ CREATE TABLE IF NOT EXISTS upload_pages (
     extraction_model VARCHAR(50),
     extraction_timestamp TIMESTAMPTZ,
     raw_extraction JSONB,
+    raw_extraction_candidate JSONB,    -- candidate extractions keyed by prompt version
     needs_review BOOLEAN DEFAULT FALSE,
     review_notes TEXT,
+    file_missing BOOLEAN DEFAULT FALSE, -- set by finalize when the image never arrived
+    min_confidence DECIMAL(3,2),       -- lowest entry confidence on the page
+    review_reason_summary TEXT,        -- distinct notes of entries needing review
     created_at TIMESTAMPTZ DEFAULT NOW(),
-    UNIQUE(document_id, page_number)
+    updated_at TIMESTAMPTZ DEFAULT NOW(), -- shows progress to stall detection
+    -- Deferrable so a page reorder can swap numbers in one UPDATE
+    UNIQUE(document_id, page_number) DEFERRABLE INITIALLY IMMEDIATE
 );
 
 -- =====================================================
@@ -91,12 +114,33 @@ CREATE TABLE IF NOT EXISTS maintenance_entries (
         CHECK (review_status IN ('pending', 'approved', 'corrected', 'rejected')),
     reviewed_by VARCHAR(100),
     reviewed_at TIMESTAMPTZ,
+    slice_key TEXT,
+    slice_y0 INTEGER,
+    slice_y1 INTEGER,
+    qa_verdict VARCHAR(20),
+    qa_retries INTEGER DEFAULT 0,
+    model_confidence DECIMAL(3,2),
+    uncertain_fields JSONB,            -- fields the model or QA flagged as doubtful
+    superseded_by UUID REFERENCES maintenance_entries(id) ON DELETE SET NULL, -- entry from a corrected re-upload
+    source VARCHAR(20) CHECK (source IN ('sticker')), -- set when read from a sticker, not the logbook
+    aircraft_serial VARCHAR(100),      -- aircraft as written in the entry, checked
+    aircraft_make VARCHAR(100),        -- against the aircraft record when FAA
+    aircraft_model VARCHAR(100),       -- enrichment fills it in
+    extraction_model VARCHAR(50),
+    prompt_version VARCHAR(64),        -- hash of the extraction prompt text
     created_at TIMESTAMPTZ DEFAULT NOW(),
-    updated_at TIMESTAMPTZ DEFAULT NOW()
+    updated_at TIMESTAMPTZ DEFAULT NOW(),
+    search_vector tsvector GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', coalesce(maintenance_narrative, '')), 'A') ||
+        setweight(to_tsvector('english', coalesce(shop_name, '')), 'B')
+    ) STORED
 );
 
 CREATE INDEX IF NOT EXISTS idx_maintenance_aircraft_date ON maintenance_entries(aircraft_id, entry_date);
 CREATE INDEX IF NOT EXISTS idx_maintenance_needs_review ON maintenance_entries(needs_review) WHERE needs_review = TRUE;
+CREATE INDEX IF NOT EXISTS idx_maintenance_search ON maintenance_entries USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS idx_maintenance_superseded ON maintenance_entries(superseded_by)
+    WHERE superseded_by IS NOT NULL;
 
 -- =====================================================
 -- PARTS TRACKING
@@ -128,7 +172,8 @@ CREATE TABLE IF NOT EXISTS ad_compliance (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
     entry_id UUID REFERENCES maintenance_entries(id) ON DELETE CASCADE,
     aircraft_id UUID NOT NULL REFERENCES aircraft(id),
-    ad_number VARCHAR(50) NOT NULL,
+    ad_number VARCHAR(50) NOT NULL,      -- normalized (YYYY-NN-NN) when recognizable
+    ad_number_raw VARCHAR(50),           -- as written in the logbook
     compliance_date DATE,
     compliance_method VARCHAR(20)
         CHECK (compliance_method IN ('inspection', 'replacement', 'modification', 'terminating_action', 'recurring', 'not_applicable', 'other')),
@@ -166,6 +211,22 @@ CREATE TABLE IF NOT EXISTS life_limited_parts (
 CREATE INDEX IF NOT EXISTS idx_llp_aircraft ON life_limited_parts(aircraft_id);
 CREATE INDEX IF NOT EXISTS idx_llp_expiration ON life_limited_parts(expiration_date) WHERE is_active = TRUE;
 
+-- =====================================================
+-- ENTRY REVISIONS (edit history; previous/new values keyed by API field)
+-- =====================================================
+
+CREATE TABLE IF NOT EXISTS entry_revisions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    entry_id UUID NOT NULL REFERENCES maintenance_entries(id) ON DELETE CASCADE,
+    aircraft_id UUID NOT NULL REFERENCES aircraft(id),
+    previous_values JSONB NOT NULL,
+    new_values JSONB NOT NULL,
+    revised_by VARCHAR(100),
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_entry_revisions_entry ON entry_revisions(entry_id, created_at DESC);
+
 -- =====================================================
 -- INSPECTION RECORDS
 -- =====================================================
@@ -189,6 +250,25 @@ CREATE TABLE IF NOT EXISTS inspection_records (
 
 CREATE INDEX IF NOT EXISTS idx_inspection_aircraft ON inspection_records(aircraft_id);
 
+-- =====================================================
+-- WEIGHT AND BALANCE
+-- =====================================================
+
+CREATE TABLE IF NOT EXISTS weight_balance_revisions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    aircraft_id UUID NOT NULL REFERENCES aircraft(id),
+    entry_id UUID REFERENCES maintenance_entries(id) ON DELETE CASCADE,
+    revision_date DATE NOT NULL,
+    empty_weight DECIMAL(10,2),
+    empty_cg DECIMAL(10,2),
+    useful_load DECIMAL(10,2),
+    equipment_changes TEXT,
+    notes TEXT,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_wb_aircraft_date ON weight_balance_revisions(aircraft_id, revision_date DESC);
+
 -- =====================================================
 -- EMBEDDINGS (3072 half-precision dims for gemini-embedding-001)
 -- =====================================================
@@ -197,6 +277,7 @@ CREATE TABLE IF NOT EXISTS maintenance_embeddings (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
     entry_id UUID NOT NULL REFERENCES maintenance_entries(id) ON DELETE CASCADE,
     embedding halfvec(3072),
+    model VARCHAR(100),                -- embedding model that produced the vector
     chunk_text TEXT NOT NULL,
     chunk_type VARCHAR(30) DEFAULT 'narrative'
         CHECK (chunk_type IN ('narrative', 'parts', 'ad_compliance', 'full_entry')),
@@ -206,6 +287,7 @@ CREATE TABLE IF NOT EXISTS maintenance_embeddings (
 
 CREATE INDEX IF NOT EXISTS idx_embeddings_vector ON maintenance_embeddings
     USING hnsw (embedding halfvec_cosine_ops);
+CREATE INDEX IF NOT EXISTS idx_embeddings_model ON maintenance_embeddings(model);
 
 -- =====================================================
 -- TRIGGERS
@@ -227,6 +309,10 @@ DROP TRIGGER IF EXISTS maintenance_entries_updated_at ON maintenance_entries;
 CREATE TRIGGER maintenance_entries_updated_at BEFORE UPDATE ON maintenance_entries
     FOR EACH ROW EXECUTE FUNCTION logbook.update_updated_at();
 
+DROP TRIGGER IF EXISTS upload_pages_updated_at ON upload_pages;
+CREATE TRIGGER upload_pages_updated_at BEFORE UPDATE ON upload_pages
+    FOR EACH ROW EXECUTE FUNCTION logbook.update_updated_at();
+
 DROP TRIGGER IF EXISTS life_limited_parts_updated_at ON life_limited_parts;
 CREATE TRIGGER life_limited_parts_updated_at BEFORE UPDATE ON life_limited_parts
     FOR EACH ROW EXECUTE FUNCTION logbook.update_updated_at();